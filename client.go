@@ -1,9 +1,36 @@
 package storage
 
 import (
+	// Standard Library Imports
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	// External Imports
+	"github.com/go-jose/go-jose/v3"
 	"github.com/ory/fosite"
 )
 
+// PKCEEnforcer provides a way for clients to report whether PKCE must be
+// enforced, enabling PKCE to be required on a per-client basis.
+type PKCEEnforcer interface {
+	IsPKCEEnforced() bool
+}
+
+// RefreshTokenPolicy provides a way for clients to report whether refresh
+// tokens may be issued to them, so that the authorization server can decide
+// on a per-client basis whether to issue refresh tokens.
+type RefreshTokenPolicy interface {
+	IsOfflineAccessRequired() bool
+	CanIssueRefreshToken(grantedScopes fosite.Arguments) bool
+}
+
+// OfflineAccessScopes lists the scopes which request a refresh token, see
+// Client.OfflineAccessRequired.
+var OfflineAccessScopes = []string{"offline_access", "offline"}
+
 // Client provides the structure of an OAuth2.0 Client.
 type Client struct {
 	// // Client Meta
@@ -31,14 +58,16 @@ type Client struct {
 	AllowedTenantAccess []string `bson:"allowed_tenant_access" json:"allowed_tenant_access,omitempty" xml:"allowed_tenant_access,omitempty"`
 
 	// GrantTypes contains a list of grant types the client is allowed to use.
+	// Unknown grant types are rejected, see RegisterGrantType.
 	//
-	// Pattern: client_credentials|authorize_code|implicit|refresh_token
+	// Pattern: authorization_code|client_credentials|implicit|password|refresh_token
 	GrantTypes []string `bson:"grant_types" json:"grant_types" xml:"grant_types"`
 
 	// ResponseTypes contains a list of the OAuth 2.0 response type strings
-	// that the client can use at the authorization endpoint.
+	// that the client can use at the authorization endpoint. Each space
+	// delimited response type must be known, see RegisterResponseType.
 	//
-	// Pattern: id_token|code|token
+	// Pattern: id_token|code|token|none
 	ResponseTypes []string `bson:"response_types" json:"response_types" xml:"response_types"`
 
 	// Scopes contains a list of values the client is entitled to use when
@@ -56,6 +85,19 @@ type Client struct {
 	// Disabled stops the client from being able to authenticate to the system.
 	Disabled bool `bson:"disabled" json:"disabled" xml:"disabled"`
 
+	// EnforcePKCE requires the client to use Proof Key for Code Exchange
+	// (PKCE) when performing the authorization code flow.
+	EnforcePKCE bool `bson:"enforce_pkce" json:"enforce_pkce" xml:"enforce_pkce"`
+
+	// DisableRefreshTokens stops refresh tokens from being issued to, or
+	// redeemed by, the client, by withholding the refresh_token grant type
+	// from fosite.
+	DisableRefreshTokens bool `bson:"disable_refresh_tokens" json:"disable_refresh_tokens" xml:"disable_refresh_tokens"`
+
+	// OfflineAccessRequired only issues refresh tokens to the client if one
+	// of the OfflineAccessScopes has been granted.
+	OfflineAccessRequired bool `bson:"offline_access_required" json:"offline_access_required" xml:"offline_access_required"`
+
 	// // Client Content
 	// Name contains a human-readable string name of the client to be presented
 	// to the end-user during authorization.
@@ -68,10 +110,29 @@ type Client struct {
 	// not be made available again.
 	Secret string `bson:"secret,omitempty" json:"secret,omitempty" xml:"secret,omitempty"`
 
+	// PreviousSecret is the hash of the client's secret prior to it being
+	// rotated via RotateSecret. The previous secret continues to authenticate
+	// the client until PreviousSecretExpiry, so that deployments can be moved
+	// over to the new secret without downtime.
+	PreviousSecret string `bson:"previous_secret,omitempty" json:"previous_secret,omitempty" xml:"previous_secret,omitempty"`
+
+	// PreviousSecretExpiry is the time in seconds from the unix epoch at which
+	// the previous secret stops authenticating the client.
+	PreviousSecretExpiry int64 `bson:"previous_secret_expiry,omitempty" json:"previous_secret_expiry,omitempty" xml:"previous_secret_expiry,omitempty"`
+
 	// RedirectURIs contains a list of allowed redirect urls for the client, for
 	// example: http://mydomain/oauth/callback.
 	RedirectURIs []string `bson:"redirect_uris" json:"redirect_uris" xml:"redirect_uris"`
 
+	// AllowedCORSOrigins contains a list of origins, for example:
+	// https://mydomain.com, that browser-based clients are allowed to make
+	// cross-origin requests from.
+	AllowedCORSOrigins []string `bson:"allowed_cors_origins" json:"allowed_cors_origins,omitempty" xml:"allowed_cors_origins,omitempty"`
+
+	// JSONWebKeys contains the client's public keys, for example, used to
+	// verify the client's assertions when authenticating via private_key_jwt.
+	JSONWebKeys *jose.JSONWebKeySet `bson:"jwks,omitempty" json:"jwks,omitempty" xml:"-"`
+
 	// Owner identifies the owner of the OAuth 2.0 Client.
 	Owner string `bson:"owner" json:"owner" xml:"owner"`
 
@@ -108,6 +169,12 @@ type Client struct {
 
 	// Provider auth provider
 	Provider string `bson:"provider" json:"provider" xml:"provider"`
+
+	// Extra captures any client metadata that isn't otherwise modeled, such as
+	// vendor specific metadata provided via dynamic client registration.
+	// Extra keys are stored alongside the modeled fields, so must not clash
+	// with them.
+	Extra map[string]interface{} `bson:",inline" json:"extra,omitempty" xml:"-"`
 }
 
 // GetID returns the client's Client ID.
@@ -120,12 +187,35 @@ func (c *Client) GetRedirectURIs() []string {
 	return c.RedirectURIs
 }
 
+// GetJSONWebKeys returns the client's JSON Web Key Set containing the public
+// keys used by the client to authenticate.
+func (c *Client) GetJSONWebKeys() *jose.JSONWebKeySet {
+	return c.JSONWebKeys
+}
+
 // GetHashedSecret returns the Client's Hashed Secret for authenticating with
 // the Identity Provider.
 func (c *Client) GetHashedSecret() []byte {
 	return []byte(c.Secret)
 }
 
+// GetRotatedHashes returns the hashes of the Client's rotated secrets which
+// are still able to authenticate the Client.
+// Implements fosite.ClientWithSecretRotation.
+func (c *Client) GetRotatedHashes() [][]byte {
+	return c.RotatedHashes(time.Now())
+}
+
+// RotatedHashes returns the hashes of the Client's rotated secrets which are
+// still able to authenticate the Client at the given time.
+func (c *Client) RotatedHashes(now time.Time) [][]byte {
+	if c.PreviousSecret == "" || now.Unix() >= c.PreviousSecretExpiry {
+		return nil
+	}
+
+	return [][]byte{[]byte(c.PreviousSecret)}
+}
+
 // GetScopes returns an array of strings, wrapped as `fosite.Arguments` to
 // provide functions that allow verifying the
 // Client's scopes against incoming requests.
@@ -146,6 +236,17 @@ func (c *Client) GetGrantTypes() fosite.Arguments {
 	if len(c.GrantTypes) == 0 {
 		return fosite.Arguments{"authorization_code"}
 	}
+	if c.DisableRefreshTokens {
+		// fosite neither issues nor redeems refresh tokens for clients
+		// without the refresh_token grant type.
+		grantTypes := make(fosite.Arguments, 0, len(c.GrantTypes))
+		for _, grantType := range c.GrantTypes {
+			if grantType != "refresh_token" {
+				grantTypes = append(grantTypes, grantType)
+			}
+		}
+		return grantTypes
+	}
 	return c.GrantTypes
 }
 
@@ -189,6 +290,30 @@ func (c *Client) IsDisabled() bool {
 	return c.Disabled
 }
 
+// IsPKCEEnforced returns a boolean as to whether the Client must use PKCE
+// when performing the authorization code flow.
+func (c *Client) IsPKCEEnforced() bool {
+	return c.EnforcePKCE
+}
+
+// IsOfflineAccessRequired returns a boolean as to whether refresh tokens are
+// only issued to the Client if offline access has been granted.
+func (c *Client) IsOfflineAccessRequired() bool {
+	return c.OfflineAccessRequired
+}
+
+// CanIssueRefreshToken returns a boolean as to whether a refresh token may be
+// issued to the Client, given the scopes granted to the request. The Client
+// must be allowed the refresh_token grant type and, if offline access is
+// required, must have been granted one of the OfflineAccessScopes.
+func (c *Client) CanIssueRefreshToken(grantedScopes fosite.Arguments) bool {
+	if !c.GetGrantTypes().Has("refresh_token") {
+		return false
+	}
+
+	return !c.OfflineAccessRequired || grantedScopes.HasOneOf(OfflineAccessScopes...)
+}
+
 // EnableScopeAccess enables client scope access.
 func (c *Client) EnableScopeAccess(scopes ...string) {
 	for i := range scopes {
@@ -296,6 +421,18 @@ func (c Client) Equal(x Client) bool {
 		return false
 	}
 
+	if c.EnforcePKCE != x.EnforcePKCE {
+		return false
+	}
+
+	if c.DisableRefreshTokens != x.DisableRefreshTokens {
+		return false
+	}
+
+	if c.OfflineAccessRequired != x.OfflineAccessRequired {
+		return false
+	}
+
 	if c.Name != x.Name {
 		return false
 	}
@@ -304,10 +441,26 @@ func (c Client) Equal(x Client) bool {
 		return false
 	}
 
+	if c.PreviousSecret != x.PreviousSecret {
+		return false
+	}
+
+	if c.PreviousSecretExpiry != x.PreviousSecretExpiry {
+		return false
+	}
+
 	if !stringArrayEquals(c.RedirectURIs, x.RedirectURIs) {
 		return false
 	}
 
+	if !stringArrayEquals(c.AllowedCORSOrigins, x.AllowedCORSOrigins) {
+		return false
+	}
+
+	if !reflect.DeepEqual(c.JSONWebKeys, x.JSONWebKeys) {
+		return false
+	}
+
 	if c.Owner != x.Owner {
 		return false
 	}
@@ -336,6 +489,10 @@ func (c Client) Equal(x Client) bool {
 		return false
 	}
 
+	if (len(c.Extra) > 0 || len(x.Extra) > 0) && !reflect.DeepEqual(c.Extra, x.Extra) {
+		return false
+	}
+
 	return true
 }
 
@@ -343,3 +500,94 @@ func (c Client) Equal(x Client) bool {
 func (c Client) IsEmpty() bool {
 	return c.Equal(Client{})
 }
+
+var (
+	knownTypesMutex sync.RWMutex
+
+	// knownGrantTypes lists the grant types clients may be allowed to use.
+	knownGrantTypes = map[string]bool{
+		"authorization_code": true,
+		"client_credentials": true,
+		"implicit":           true,
+		"password":           true,
+		"refresh_token":      true,
+		"urn:ietf:params:oauth:grant-type:device_code":    true,
+		"urn:ietf:params:oauth:grant-type:jwt-bearer":     true,
+		"urn:ietf:params:oauth:grant-type:saml2-bearer":   true,
+		"urn:ietf:params:oauth:grant-type:token-exchange": true,
+	}
+
+	// knownResponseTypes lists the response types which may be combined,
+	// space delimited, into the response types clients may be allowed to
+	// use.
+	knownResponseTypes = map[string]bool{
+		"code":     true,
+		"id_token": true,
+		"none":     true,
+		"token":    true,
+	}
+)
+
+// RegisterGrantType registers custom grant types, for example, those handled
+// by a custom fosite handler, so clients may be allowed to use them.
+func RegisterGrantType(grantTypes ...string) {
+	knownTypesMutex.Lock()
+	defer knownTypesMutex.Unlock()
+
+	for _, grantType := range grantTypes {
+		knownGrantTypes[grantType] = true
+	}
+}
+
+// RegisterResponseType registers custom response types, so clients may be
+// allowed to use them, alone or combined with other response types.
+func RegisterResponseType(responseTypes ...string) {
+	knownTypesMutex.Lock()
+	defer knownTypesMutex.Unlock()
+
+	for _, responseType := range responseTypes {
+		knownResponseTypes[responseType] = true
+	}
+}
+
+// Validate returns ErrUnknownGrantType or ErrUnknownResponseType, describing
+// the offending value, if the client has been allowed to use a grant type or
+// response type which isn't known.
+func (c Client) Validate() error {
+	knownTypesMutex.RLock()
+	defer knownTypesMutex.RUnlock()
+
+	for _, grantType := range c.GrantTypes {
+		if !knownGrantTypes[grantType] {
+			return fmt.Errorf("%w: %q", ErrUnknownGrantType, grantType)
+		}
+	}
+
+	for _, responseType := range c.ResponseTypes {
+		values := strings.Fields(responseType)
+		if len(values) == 0 {
+			return fmt.Errorf("%w: %q", ErrUnknownResponseType, responseType)
+		}
+		for _, value := range values {
+			if !knownResponseTypes[value] {
+				return fmt.Errorf("%w: %q", ErrUnknownResponseType, responseType)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateSecret returns ErrPublicClientSecret if the client is public, and
+// therefore authenticates implicitly, but has a secret, or
+// ErrMissingClientSecret if the client is confidential but has no secret.
+func (c Client) ValidateSecret() error {
+	if c.Public && c.Secret != "" {
+		return fmt.Errorf("%w: client %q is public, so must not be given a secret", ErrPublicClientSecret, c.ID)
+	}
+	if !c.Public && c.Secret == "" {
+		return fmt.Errorf("%w: client %q is confidential, so must be given a secret", ErrMissingClientSecret, c.ID)
+	}
+
+	return nil
+}
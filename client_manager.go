@@ -6,6 +6,7 @@ import (
 	"time"
 
 	// External Imports
+	"github.com/go-jose/go-jose/v3"
 	"github.com/ory/fosite"
 )
 
@@ -23,18 +24,40 @@ type ClientStore interface {
 	fosite.Storage
 
 	List(ctx context.Context, filter ListClientsRequest) ([]Client, error)
+	// ListByScope returns every client permitted to request the scope, for
+	// security reviews of who can obtain it.
+	ListByScope(ctx context.Context, scope string) ([]Client, error)
+	// ListByContact returns every client listing the contact, for finding
+	// the clients an administrator is responsible for.
+	ListByContact(ctx context.Context, contact string) ([]Client, error)
+	// Create stores the client. Create, Update and Upsert reject clients
+	// allowed unknown grant or response types, see Client.Validate.
 	Create(ctx context.Context, client Client) (Client, error)
 	Get(ctx context.Context, clientID string) (Client, error)
+	GetOrCreate(ctx context.Context, client Client) (Client, bool, error)
+	// Upsert creates the client, or updates it if it already exists, hashing
+	// the secret if it has changed and preserving the original create time,
+	// for idempotently declaring clients when provisioning.
+	Upsert(ctx context.Context, client Client) (Client, error)
+	Exists(ctx context.Context, clientID string) (bool, error)
 	Update(ctx context.Context, clientID string, client Client) (Client, error)
 	Delete(ctx context.Context, clientID string) error
 	Authenticate(ctx context.Context, clientID string, secret string) (Client, error)
+	RotateSecret(ctx context.Context, clientID string, secret string, overlap time.Duration) (Client, error)
 	GrantScopes(ctx context.Context, clientID string, scopes []string) (Client, error)
+	// GrantScopesToMany grants the scopes to each of the specified clients,
+	// ignoring any that don't exist, for onboarding a cohort to a new API.
+	GrantScopesToMany(ctx context.Context, clientIDs []string, scopes []string) error
 	RemoveScopes(ctx context.Context, clientID string, scopes []string) (Client, error)
+	RemoveAllScopes(ctx context.Context, clientID string) (Client, error)
+	Disable(ctx context.Context, clientID string) (Client, error)
+	Enable(ctx context.Context, clientID string) (Client, error)
 
 	IsJWTUsed(ctx context.Context, jti string) (bool, error)
 	MarkJWTUsedForTime(ctx context.Context, jti string, exp time.Time) error
 	ClientAssertionJWTValid(_ context.Context, jti string) error
 	SetClientAssertionJWT(_ context.Context, jti string, exp time.Time) error
+	GetClientAssertionKey(ctx context.Context, clientID string, keyID string, jti string) (*jose.JSONWebKey, error)
 }
 
 // ListClientsRequest enables listing and filtering client records.
@@ -45,6 +68,8 @@ type ListClientsRequest struct {
 	AllowedRegion string `json:"allowed_region" xml:"allowed_region"`
 	// RedirectURI filters clients based on redirectURI.
 	RedirectURI string `json:"redirect_uri" xml:"redirect_uri"`
+	// AllowedCORSOrigin filters clients based on an Allowed CORS Origin.
+	AllowedCORSOrigin string `json:"allowed_cors_origin" xml:"allowed_cors_origin"`
 	// GrantType filters clients based on GrantType.
 	GrantType string `json:"grant_type" xml:"grant_type"`
 	// ResponseType filters clients based on ResponseType.
@@ -66,6 +91,15 @@ type ListClientsRequest struct {
 	// - given ["cats, dogs"] the client must have "cats" OR "dogs in their
 	//   scopes.
 	ScopesUnion []string `json:"scopes_union" xml:"scopes_union"`
+	// ScopePrefix filters clients that have at least one scope beginning
+	// with the prefix, for hierarchical scopes.
+	// For example:
+	// - given "photos" the client must have a scope such as "photos" or
+	//   "photos.read".
+	// - given "photos." the client must have a descendant scope of "photos".
+	//
+	// ScopePrefix applies in addition to ScopesIntersection or ScopesUnion.
+	ScopePrefix string `json:"scope_prefix" xml:"scope_prefix"`
 	// Contact filters clients based on Contact.
 	Contact string `json:"contact" xml:"contact"`
 	// Public filters clients based on Public status.
@@ -74,4 +108,10 @@ type ListClientsRequest struct {
 	Disabled bool `json:"disabled" xml:"disabled"`
 	// Published filters clients based on published status.
 	Published bool `json:"published" xml:"published"`
+	// After lists the clients following the token returned by the last
+	// client's NextAfter, ordered by ID, enabling stable paging.
+	After string `json:"after" xml:"after"`
+	// Limit caps the number of clients returned. If zero, every matching
+	// client is returned.
+	Limit int64 `json:"limit" xml:"limit"`
 }
@@ -2,7 +2,9 @@ package storage_test
 
 import (
 	// Standard Library Imports
+	"errors"
 	"testing"
+	"time"
 
 	// External Imports
 	"github.com/ory/fosite"
@@ -19,3 +21,225 @@ func TestClient_ImplementsFositeClientInterface(t *testing.T) {
 		t.Error("storage.Client does not implement interface fosite.Client")
 	}
 }
+
+func TestClient_ImplementsPKCEEnforcerInterface(t *testing.T) {
+	c := &storage.Client{}
+
+	var i interface{} = c
+	if _, ok := i.(storage.PKCEEnforcer); !ok {
+		t.Error("storage.Client does not implement interface storage.PKCEEnforcer")
+	}
+}
+
+func TestClient_ImplementsRefreshTokenPolicyInterface(t *testing.T) {
+	c := &storage.Client{}
+
+	var i interface{} = c
+	if _, ok := i.(storage.RefreshTokenPolicy); !ok {
+		t.Error("storage.Client does not implement interface storage.RefreshTokenPolicy")
+	}
+}
+
+func TestClient_ImplementsFositeClientWithSecretRotationInterface(t *testing.T) {
+	c := &storage.Client{}
+
+	var i interface{} = c
+	if _, ok := i.(fosite.ClientWithSecretRotation); !ok {
+		t.Error("storage.Client does not implement interface fosite.ClientWithSecretRotation")
+	}
+}
+
+func TestClient_RotatedHashes(t *testing.T) {
+	now := time.Now()
+	c := &storage.Client{Secret: "current"}
+	if got := c.RotatedHashes(now); got != nil {
+		t.Errorf("expected no rotated hashes without a previous secret, got: %q", got)
+	}
+
+	c.PreviousSecret = "previous"
+	c.PreviousSecretExpiry = now.Add(time.Minute).Unix()
+	if got := c.RotatedHashes(now); len(got) != 1 || string(got[0]) != "previous" {
+		t.Errorf("expected the previous secret within the overlap window, got: %q", got)
+	}
+
+	if got := c.RotatedHashes(now.Add(time.Minute)); got != nil {
+		t.Errorf("expected no rotated hashes once the overlap window has expired, got: %q", got)
+	}
+}
+
+func TestClient_IsPKCEEnforced(t *testing.T) {
+	c := &storage.Client{}
+	if c.IsPKCEEnforced() {
+		t.Error("PKCE should not be enforced by default")
+	}
+
+	c.EnforcePKCE = true
+	if !c.IsPKCEEnforced() {
+		t.Error("PKCE should be enforced when EnforcePKCE is set")
+	}
+}
+
+func TestClient_CanIssueRefreshToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		client        storage.Client
+		grantedScopes fosite.Arguments
+		want          bool
+	}{
+		{
+			name:   "should issue refresh tokens to clients allowed the grant type",
+			client: storage.Client{GrantTypes: []string{"authorization_code", "refresh_token"}},
+			want:   true,
+		},
+		{
+			name:   "should not issue refresh tokens to clients without the grant type",
+			client: storage.Client{GrantTypes: []string{"authorization_code"}},
+			want:   false,
+		},
+		{
+			name:   "should not issue refresh tokens to clients with refresh tokens disabled",
+			client: storage.Client{GrantTypes: []string{"authorization_code", "refresh_token"}, DisableRefreshTokens: true},
+			want:   false,
+		},
+		{
+			name:          "should not issue refresh tokens without offline access if required",
+			client:        storage.Client{GrantTypes: []string{"authorization_code", "refresh_token"}, OfflineAccessRequired: true},
+			grantedScopes: fosite.Arguments{"openid"},
+			want:          false,
+		},
+		{
+			name:          "should issue refresh tokens with offline access if required",
+			client:        storage.Client{GrantTypes: []string{"authorization_code", "refresh_token"}, OfflineAccessRequired: true},
+			grantedScopes: fosite.Arguments{"openid", "offline_access"},
+			want:          true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.client.CanIssueRefreshToken(tt.grantedScopes); got != tt.want {
+				t.Errorf("CanIssueRefreshToken() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_GetGrantTypes_ShouldWithholdDisabledRefreshTokens(t *testing.T) {
+	c := &storage.Client{GrantTypes: []string{"authorization_code", "refresh_token"}, DisableRefreshTokens: true}
+	if got := c.GetGrantTypes(); got.Has("refresh_token") || !got.Has("authorization_code") {
+		t.Errorf("expected only the refresh_token grant type to be withheld, got: %v", got)
+	}
+	if len(c.GrantTypes) != 2 {
+		t.Errorf("withholding the refresh_token grant type should not modify the client, got: %v", c.GrantTypes)
+	}
+}
+
+func TestClient_Equal_ShouldCompareExtra(t *testing.T) {
+	c := storage.Client{ID: "client"}
+	x := storage.Client{ID: "client", Extra: map[string]interface{}{}}
+	if !c.Equal(x) {
+		t.Error("nil and empty extra metadata should be equal")
+	}
+
+	x.Extra["software_id"] = "4NRB1-0XZABZI9E6-5SM3R"
+	if c.Equal(x) {
+		t.Error("clients with differing extra metadata should not be equal")
+	}
+
+	c.Extra = map[string]interface{}{"software_id": "4NRB1-0XZABZI9E6-5SM3R"}
+	if !c.Equal(x) {
+		t.Error("clients with the same extra metadata should be equal")
+	}
+}
+
+func TestClient_Validate(t *testing.T) {
+	storage.RegisterGrantType("urn:example:grant-type:custom")
+	storage.RegisterResponseType("code_custom")
+
+	tests := []struct {
+		name   string
+		client storage.Client
+		want   error
+	}{
+		{
+			name:   "should accept a client without grant or response types",
+			client: storage.Client{},
+		},
+		{
+			name: "should accept known grant and response types",
+			client: storage.Client{
+				GrantTypes:    []string{"authorization_code", "refresh_token", "urn:ietf:params:oauth:grant-type:device_code"},
+				ResponseTypes: []string{"code", "code id_token", "id_token token"},
+			},
+		},
+		{
+			name: "should accept registered grant and response types",
+			client: storage.Client{
+				GrantTypes:    []string{"urn:example:grant-type:custom"},
+				ResponseTypes: []string{"code_custom", "code_custom id_token"},
+			},
+		},
+		{
+			name:   "should reject an unknown grant type",
+			client: storage.Client{GrantTypes: []string{"authorization_code", "authorisation_code"}},
+			want:   storage.ErrUnknownGrantType,
+		},
+		{
+			name:   "should reject an unknown response type",
+			client: storage.Client{ResponseTypes: []string{"code", "status_ok"}},
+			want:   storage.ErrUnknownResponseType,
+		},
+		{
+			name:   "should reject a combination containing an unknown response type",
+			client: storage.Client{ResponseTypes: []string{"code idtoken"}},
+			want:   storage.ErrUnknownResponseType,
+		},
+		{
+			name:   "should reject an empty response type",
+			client: storage.Client{ResponseTypes: []string{" "}},
+			want:   storage.ErrUnknownResponseType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.client.Validate()
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_ValidateSecret(t *testing.T) {
+	tests := []struct {
+		name   string
+		client storage.Client
+		want   error
+	}{
+		{
+			name:   "should accept a public client without a secret",
+			client: storage.Client{Public: true},
+		},
+		{
+			name:   "should accept a confidential client with a secret",
+			client: storage.Client{Secret: "foobar"},
+		},
+		{
+			name:   "should reject a public client with a secret",
+			client: storage.Client{Public: true, Secret: "foobar"},
+			want:   storage.ErrPublicClientSecret,
+		},
+		{
+			name:   "should reject a confidential client without a secret",
+			client: storage.Client{},
+			want:   storage.ErrMissingClientSecret,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.client.ValidateSecret()
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ValidateSecret() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	// Standard Library Imports
+	"time"
+)
+
+// Consent provides the structure for recording the scopes and audiences a
+// user has consented to grant to a given client.
+type Consent struct {
+	// UserID contains the subject's unique ID which links back to a stored
+	// user account.
+	UserID string `bson:"user_id" json:"userId" xml:"userId"`
+	// ClientID contains a link to the Client the user consented to.
+	ClientID string `bson:"client_id" json:"clientId" xml:"clientId"`
+	// CreateTime is when the resource was created in seconds from the epoch.
+	CreateTime int64 `bson:"created_at" json:"createTime" xml:"createTime"`
+	// UpdateTime is the last time the resource was modified in seconds from
+	// the epoch.
+	UpdateTime int64 `bson:"updated_at" json:"updateTime" xml:"updateTime"`
+	// Scopes contains the scopes the user has consented to.
+	Scopes []string `bson:"scopes" json:"scopes" xml:"scopes"`
+	// Audience contains the audiences the user has consented to.
+	Audience []string `bson:"audience" json:"audience" xml:"audience"`
+	// ExpiresAt is when the consent lapses in seconds from the epoch. A zero
+	// value denotes consent that does not expire.
+	ExpiresAt int64 `bson:"expires_at" json:"expiresAt" xml:"expiresAt"`
+}
+
+// IsExpired returns whether the consent has lapsed as at the given time.
+func (c Consent) IsExpired(now time.Time) bool {
+	return c.ExpiresAt > 0 && c.ExpiresAt <= now.Unix()
+}
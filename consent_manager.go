@@ -0,0 +1,25 @@
+package storage
+
+import (
+	// Standard Library Imports
+	"context"
+)
+
+// ConsentManager provides a generic interface to user consent in order to
+// build a Datastore backend.
+type ConsentManager interface {
+	Configure
+	ConsentStore
+}
+
+// ConsentStore enables remembering which scopes a user has consented to for a
+// given client, so the consent screen can be skipped on subsequent logins.
+type ConsentStore interface {
+	// SaveConsent creates, or overwrites, the consent a user has given to a
+	// client.
+	SaveConsent(ctx context.Context, userID string, clientID string, scopes []string, audience []string, expiresAt int64) (Consent, error)
+	// GetConsent returns the consent a user has given to a client.
+	GetConsent(ctx context.Context, userID string, clientID string) (Consent, error)
+	// RevokeConsent removes the consent a user has given to a client.
+	RevokeConsent(ctx context.Context, userID string, clientID string) error
+}
@@ -24,6 +24,18 @@ func NewDeniedJTI(jti string, exp time.Time) DeniedJTI {
 	}
 }
 
+// Normalize returns the denied jti keyed on the signature of its JTI, so it
+// can be found by the JTI regardless of the signature it was built with. If
+// the JTI isn't set, for example, having been read back from storage, the
+// signature is assumed to already be normalized.
+func (d DeniedJTI) Normalize() DeniedJTI {
+	if d.JTI != "" {
+		d.Signature = SignatureFromJTI(d.JTI)
+	}
+
+	return d
+}
+
 // SignatureFromJTI creates a JTI signature from the JWT Token ID.
 func SignatureFromJTI(jti string) string {
 	return fmt.Sprintf("%x", sha256.Sum256([]byte(jti)))
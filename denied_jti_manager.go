@@ -13,6 +13,9 @@ type DeniedJTIManager interface {
 }
 
 // DeniedJTIStore enables storing denied JWT Tokens, by ID.
+//
+// All operations key on the JTI's normalized signature, see SignatureFromJTI,
+// denied JTIs being normalized on creation, see DeniedJTI.Normalize.
 type DeniedJTIStore interface {
 	// Create Standard CRUD Storage API
 	Create(ctx context.Context, deniedJti DeniedJTI) (DeniedJTI, error)
@@ -20,6 +23,18 @@ type DeniedJTIStore interface {
 	Delete(ctx context.Context, jti string) error
 	// DeleteBefore removes all denied JTIs before the given unix time.
 	DeleteBefore(ctx context.Context, expBefore int64) error
+	// PurgeExpired removes all denied JTIs that have expired, returning the
+	// number removed, for deployments unable to rely on a TTL index.
+	PurgeExpired(ctx context.Context) (int64, error)
+	// CountActive returns the number of denied JTIs yet to expire, for
+	// monitoring the denylist's health.
+	CountActive(ctx context.Context) (int64, error)
+
+	// CreateMany denies a batch of JTIs, skipping any that are already
+	// denied, and returns the number of JTIs newly denied.
+	CreateMany(ctx context.Context, deniedJTIs []DeniedJTI) (int, error)
+	// DeleteMany removes a batch of denied JTIs.
+	DeleteMany(ctx context.Context, jtis []string) error
 
 	// IsJWTUsed(ctx context.Context, jti string) (bool, error)
 	// MarkJWTUsedForTime(ctx context.Context, jti string, exp time.Time) error
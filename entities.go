@@ -34,4 +34,16 @@ const (
 	// EntityUsers provides the name of the entity to use in order to create,
 	// read, update and delete Users.
 	EntityUsers = CollectionPrefix + "user"
+
+	// EntityConsents provides the name of the entity to use in order to
+	// create, read, update and delete user consent grants.
+	EntityConsents = CollectionPrefix + "consent"
+
+	// EntityNonces provides the name of the entity to use in order to track
+	// and deny replayed OpenID Connect nonces.
+	EntityNonces = CollectionPrefix + "nonce"
+
+	// EntityIdempotencyKeys provides the name of the entity to use in order
+	// to store and replay the results of idempotent requests.
+	EntityIdempotencyKeys = CollectionPrefix + "idempotency_key"
 )
@@ -96,25 +96,22 @@ func TeardownMongo() {
 }
 
 func createClients(ctx context.Context, store *mongo.Store, clients []storage.Client) {
-	// Clean up after failed runs
 	for _, client := range clients {
 		logger := log.WithFields(log.Fields{
 			"id":   client.ID,
 			"name": client.Name,
 		})
 
-		// Attempt to remove any past remnant from bad builds/panics e.t.c.
-		err := store.ClientManager.Delete(ctx, client.ID)
-		if err == nil {
-			logger.Debug("client found and deleted to enable clean start")
-		}
-
-		// Create the new client!
-		_, err = store.ClientManager.Create(ctx, client)
+		// Reuse any client left behind by failed runs.
+		_, created, err := store.ClientManager.GetOrCreate(ctx, client)
 		if err != nil {
 			// err, it broke... ?
 			panic(err)
 		}
+		if !created {
+			logger.Info("existing client found!")
+			continue
+		}
 		logger.Info("new client created!")
 	}
 }
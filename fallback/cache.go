@@ -0,0 +1,91 @@
+package fallback
+
+import (
+	// Standard Library Imports
+	"container/list"
+	"sync"
+)
+
+// cache provides a bounded key value cache, evicting the least recently used
+// entry once full.
+type cache[V any] struct {
+	mutex   sync.Mutex
+	max     int
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+// cacheEntry is the element stored in the cache's recency list.
+type cacheEntry[V any] struct {
+	key   string
+	value V
+}
+
+// newCache returns a cache holding up to max entries.
+func newCache[V any](max int) *cache[V] {
+	return &cache[V]{
+		max:     max,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// get returns the value cached against the key, if any.
+func (c *cache[V]) get(key string) (value V, ok bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return value, false
+	}
+	c.order.MoveToFront(element)
+
+	return element.Value.(*cacheEntry[V]).value, true
+}
+
+// put caches the value against the key, evicting the least recently used
+// entry if the cache is full.
+func (c *cache[V]) put(key string, value V) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*cacheEntry[V]).value = value
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry[V]{key: key, value: value})
+	if c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry[V]).key)
+	}
+}
+
+// remove evicts the keys from the cache.
+func (c *cache[V]) remove(keys ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, key := range keys {
+		if element, ok := c.entries[key]; ok {
+			c.order.Remove(element)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// removeFunc evicts every entry whose value matches.
+func (c *cache[V]) removeFunc(match func(value V) bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for key, element := range c.entries {
+		if match(element.Value.(*cacheEntry[V]).value) {
+			c.order.Remove(element)
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package fallback
+
+import (
+	// Standard Library Imports
+	"context"
+	"errors"
+	"time"
+
+	// External Imports
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// ClientManager caches clients read from the wrapped client manager, serving
+// them while the wrapped store is unavailable.
+//
+// Implements:
+// - fosite.Storage
+// - fosite.ClientManager
+// - storage.AuthClientMigrator
+// - storage.ClientManager
+// - storage.ClientStore
+type ClientManager struct {
+	storage.ClientManager
+
+	store  *Store
+	hasher fosite.Hasher
+	cache  *cache[storage.Client]
+}
+
+// getKey returns the cache key of a client read via Get.
+func getKey(clientID string) string {
+	return "get:" + clientID
+}
+
+// getClientKey returns the cache key of a client read via GetClient, which
+// may differ from Get, for example, in enforcing PKCE.
+func getClientKey(clientID string) string {
+	return "client:" + clientID
+}
+
+// evict removes the clients from the cache, so stale clients aren't served
+// once they've been changed.
+func (c *ClientManager) evict(clientIDs ...string) {
+	keys := make([]string, 0, len(clientIDs)*2)
+	for _, clientID := range clientIDs {
+		keys = append(keys, getKey(clientID), getClientKey(clientID))
+	}
+	c.cache.remove(keys...)
+}
+
+// Get returns the client, served from the cache if the wrapped store is
+// unavailable.
+func (c *ClientManager) Get(ctx context.Context, clientID string) (storage.Client, error) {
+	return read(ctx, c.store,
+		func() (storage.Client, error) {
+			client, err := c.ClientManager.Get(ctx, clientID)
+			if err == nil {
+				c.cache.put(getKey(clientID), client)
+			}
+			return client, err
+		},
+		func() (storage.Client, bool) {
+			return c.cache.get(getKey(clientID))
+		},
+	)
+}
+
+// GetClient returns the client, served from the cache if the wrapped store is
+// unavailable.
+//
+// GetClient implements:
+// - fosite.Storage
+// - fosite.ClientManager
+func (c *ClientManager) GetClient(ctx context.Context, clientID string) (fosite.Client, error) {
+	return read(ctx, c.store,
+		func() (fosite.Client, error) {
+			client, err := c.ClientManager.GetClient(ctx, clientID)
+			if concrete, ok := client.(*storage.Client); ok && err == nil {
+				c.cache.put(getClientKey(clientID), *concrete)
+			}
+			return client, err
+		},
+		func() (fosite.Client, bool) {
+			client, ok := c.cache.get(getClientKey(clientID))
+			if !ok {
+				return nil, false
+			}
+			return &client, true
+		},
+	)
+}
+
+// Warm reads the clients from the wrapped store into the cache, so that
+// known-hot clients can be served should the wrapped store become unavailable
+// before they've otherwise been read, for example, shortly after startup.
+// Clients which don't exist are skipped.
+func (c *ClientManager) Warm(ctx context.Context, clientIDs ...string) error {
+	for _, clientID := range clientIDs {
+		client, err := c.ClientManager.Get(ctx, clientID)
+		if err == nil {
+			c.cache.put(getKey(clientID), client)
+			var fositeClient fosite.Client
+			fositeClient, err = c.ClientManager.GetClient(ctx, clientID)
+			if concrete, ok := fositeClient.(*storage.Client); ok && err == nil {
+				c.cache.put(getClientKey(clientID), *concrete)
+			}
+		}
+		c.store.observe(err)
+		if err != nil && !errors.Is(err, fosite.ErrNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Authenticate verifies the client's secret, against the cached client if
+// the wrapped store is unavailable.
+func (c *ClientManager) Authenticate(ctx context.Context, clientID string, secret string) (result storage.Client, err error) {
+	if c.store.tryPrimary() {
+		result, err = c.ClientManager.Authenticate(ctx, clientID, secret)
+		if !c.store.observe(err) {
+			if err == nil {
+				c.cache.put(getKey(clientID), result)
+			}
+			return result, err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	client, ok := c.cache.get(getKey(clientID))
+	if !ok {
+		// Clients fosite has looked up hold the same secrets.
+		client, ok = c.cache.get(getClientKey(clientID))
+	}
+	if !ok {
+		return result, c.store.unavailable()
+	}
+
+	return c.authenticate(ctx, client, secret)
+}
+
+// authenticate mirrors the wrapped store's authentication of the cached
+// client.
+func (c *ClientManager) authenticate(ctx context.Context, client storage.Client, secret string) (result storage.Client, err error) {
+	// Public clients don't have a secret, therefore are authenticated
+	// implicitly.
+	if !client.Public && !c.compareSecret(ctx, client, secret) {
+		return result, storage.ErrInvalidCredentials
+	}
+
+	// Deny disabled clients only once the secret has been verified.
+	if client.Disabled {
+		return result, fosite.ErrAccessDenied
+	}
+
+	return client, nil
+}
+
+// compareSecret reports whether the secret matches the client's secret, or a
+// rotated secret within its overlap window.
+func (c *ClientManager) compareSecret(ctx context.Context, client storage.Client, secret string) bool {
+	if c.hasher.Compare(ctx, client.GetHashedSecret(), []byte(secret)) == nil {
+		return true
+	}
+
+	// Accept a rotated secret until its overlap window expires.
+	for _, hash := range client.RotatedHashes(c.store.clock()) {
+		if c.hasher.Compare(ctx, hash, []byte(secret)) == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Update evicts the cached client and updates the client.
+func (c *ClientManager) Update(ctx context.Context, clientID string, client storage.Client) (storage.Client, error) {
+	c.evict(clientID)
+	return c.ClientManager.Update(ctx, clientID, client)
+}
+
+// Upsert evicts the cached client and creates or updates the client.
+func (c *ClientManager) Upsert(ctx context.Context, client storage.Client) (storage.Client, error) {
+	c.evict(client.ID)
+	return c.ClientManager.Upsert(ctx, client)
+}
+
+// Delete evicts the cached client and deletes the client.
+func (c *ClientManager) Delete(ctx context.Context, clientID string) error {
+	c.evict(clientID)
+	return c.ClientManager.Delete(ctx, clientID)
+}
+
+// RotateSecret evicts the cached client and rotates the client's secret.
+func (c *ClientManager) RotateSecret(ctx context.Context, clientID string, secret string, overlap time.Duration) (storage.Client, error) {
+	c.evict(clientID)
+	return c.ClientManager.RotateSecret(ctx, clientID, secret, overlap)
+}
+
+// GrantScopes evicts the cached client and grants the scopes to the client.
+func (c *ClientManager) GrantScopes(ctx context.Context, clientID string, scopes []string) (storage.Client, error) {
+	c.evict(clientID)
+	return c.ClientManager.GrantScopes(ctx, clientID, scopes)
+}
+
+// GrantScopesToMany evicts the cached clients and grants the scopes to each
+// of the clients.
+func (c *ClientManager) GrantScopesToMany(ctx context.Context, clientIDs []string, scopes []string) error {
+	c.evict(clientIDs...)
+	return c.ClientManager.GrantScopesToMany(ctx, clientIDs, scopes)
+}
+
+// RemoveScopes evicts the cached client and removes the scopes from the
+// client.
+func (c *ClientManager) RemoveScopes(ctx context.Context, clientID string, scopes []string) (storage.Client, error) {
+	c.evict(clientID)
+	return c.ClientManager.RemoveScopes(ctx, clientID, scopes)
+}
+
+// RemoveAllScopes evicts the cached client and removes all the client's
+// scopes.
+func (c *ClientManager) RemoveAllScopes(ctx context.Context, clientID string) (storage.Client, error) {
+	c.evict(clientID)
+	return c.ClientManager.RemoveAllScopes(ctx, clientID)
+}
+
+// Disable evicts the cached client and disables the client.
+func (c *ClientManager) Disable(ctx context.Context, clientID string) (storage.Client, error) {
+	c.evict(clientID)
+	return c.ClientManager.Disable(ctx, clientID)
+}
+
+// Enable evicts the cached client and enables the client.
+func (c *ClientManager) Enable(ctx context.Context, clientID string) (storage.Client, error) {
+	c.evict(clientID)
+	return c.ClientManager.Enable(ctx, clientID)
+}
+
+// Migrate evicts the cached client and migrates the client.
+func (c *ClientManager) Migrate(ctx context.Context, migratedClient storage.Client) (storage.Client, error) {
+	c.evict(migratedClient.ID)
+	return c.ClientManager.Migrate(ctx, migratedClient)
+}
+
+// AuthenticateMigration evicts the cached client and authenticates the
+// client, migrating the client's secret.
+func (c *ClientManager) AuthenticateMigration(ctx context.Context, currentAuth storage.AuthClientFunc, clientID string, secret string) (storage.Client, error) {
+	c.evict(clientID)
+	return c.ClientManager.AuthenticateMigration(ctx, currentAuth, clientID, secret)
+}
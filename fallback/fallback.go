@@ -0,0 +1,276 @@
+// Package fallback provides an opt-in storage.Store decorator which keeps
+// authorization working, read only, while the wrapped store is unavailable,
+// for example, during a mongo outage.
+//
+// Clients, users and access token sessions successfully read from the wrapped
+// store are cached in memory. Once the wrapped store fails with an error
+// reporting it's unavailable, the store is degraded and those reads are served
+// from the cache, so that known clients can continue to authenticate, known
+// users can continue to log in and issued access tokens can continue to be
+// introspected.
+//
+// While degraded:
+//   - Nothing new is persisted. Writes, including issuing new tokens, are
+//     always passed to the wrapped store and fail as it does, so they aren't
+//     queued for later.
+//   - Reads of resources that haven't been cached fail with ErrUnavailable.
+//   - Cached resources may be stale, for example, a client disabled by
+//     another instance just before the outage continues to be served.
+//
+// The wrapped store is retried once every retry interval, and the first call
+// it answers, even with an error such as fosite.ErrNotFound, recovers the
+// store.
+package fallback
+
+import (
+	// Standard Library Imports
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	// External Imports
+	"github.com/ory/fosite"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+const (
+	// DefaultMaxEntries is the default number of clients, users and access
+	// token sessions cached.
+	DefaultMaxEntries = 10000
+
+	// DefaultRetryInterval is the default interval at which the wrapped store
+	// is retried while degraded.
+	DefaultRetryInterval = 5 * time.Second
+)
+
+// ErrUnavailable provides an error for when the wrapped store is unavailable
+// and the resource requested hasn't been cached.
+var ErrUnavailable = errors.New("store unavailable")
+
+// Config defines the configuration parameters of the fallback store.
+//
+// MaxEntries bounds the number of resources cached by each of the client,
+// user and access token caches, evicting the least recently used. Defaults to
+// DefaultMaxEntries.
+//
+// RetryInterval is how often the wrapped store is retried while degraded.
+// Between retries, reads are served from the cache without waiting on the
+// wrapped store. Defaults to DefaultRetryInterval.
+//
+// Hasher compares passwords against the hashes of cached users. Defaults to
+// fosite's BCrypt hasher.
+//
+// IsUnavailable reports whether an error returned by the wrapped store means
+// it's unavailable. Defaults to IsUnavailable, which recognises mongo network
+// and timeout errors.
+type Config struct {
+	MaxEntries    int
+	RetryInterval time.Duration
+	Hasher        fosite.Hasher
+	IsUnavailable func(err error) bool
+	Clock         func() time.Time
+}
+
+// Status describes whether the store is degraded.
+type Status struct {
+	// Degraded is true while the wrapped store is unavailable and reads are
+	// being served from the cache.
+	Degraded bool
+	// Since is when the store became degraded.
+	Since time.Time
+	// LastError is the most recent error reporting the wrapped store is
+	// unavailable.
+	LastError error
+}
+
+// Store wraps a storage.Store, serving cached reads while it is unavailable.
+type Store struct {
+	storage.Store
+
+	retryInterval time.Duration
+	isUnavailable func(err error) bool
+	clock         func() time.Time
+
+	mutex   sync.Mutex
+	status  Status
+	retryAt time.Time
+}
+
+// New returns a fallback store wrapping the primary store. The default
+// configuration is used if cfg is nil.
+func New(primary storage.Store, cfg *Config) *Store {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	maxEntries := cfg.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+
+	retryInterval := cfg.RetryInterval
+	if retryInterval <= 0 {
+		retryInterval = DefaultRetryInterval
+	}
+
+	hasher := cfg.Hasher
+	if hasher == nil {
+		hasher = &fosite.BCrypt{Config: &fosite.Config{}}
+	}
+
+	isUnavailable := cfg.IsUnavailable
+	if isUnavailable == nil {
+		isUnavailable = IsUnavailable
+	}
+
+	clock := cfg.Clock
+	if clock == nil {
+		clock = time.Now
+	}
+
+	store := &Store{
+		retryInterval: retryInterval,
+		isUnavailable: isUnavailable,
+		clock:         clock,
+	}
+
+	clients := &ClientManager{
+		ClientManager: primary.ClientManager,
+		store:         store,
+		hasher:        hasher,
+		cache:         newCache[storage.Client](maxEntries),
+	}
+	users := &UserManager{
+		UserManager: primary.UserManager,
+		store:       store,
+		hasher:      hasher,
+		cache:       newCache[storage.User](maxEntries),
+	}
+	requests := &RequestManager{
+		RequestManager: primary.RequestManager,
+		store:          store,
+		users:          users,
+		cache:          newCache[fosite.Requester](maxEntries),
+	}
+
+	primary.ClientManager = clients
+	primary.UserManager = users
+	primary.RequestManager = requests
+	store.Store = primary
+
+	return store
+}
+
+// IsUnavailable reports whether the error indicates mongo couldn't be reached
+// or didn't respond in time, rather than the operation itself failing.
+func IsUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	return errors.Is(err, storage.ErrStorageUnavailable) ||
+		errors.Is(err, storage.ErrTimeout) ||
+		mongo.IsNetworkError(err) ||
+		mongo.IsTimeout(err) ||
+		errors.Is(err, mongo.ErrClientDisconnected)
+}
+
+// Status returns whether the store is degraded.
+func (s *Store) Status() Status {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.status
+}
+
+// Degraded reports whether reads are being served from the cache as the
+// wrapped store is unavailable.
+func (s *Store) Degraded() bool {
+	return s.Status().Degraded
+}
+
+// tryPrimary reports whether the wrapped store should be called. While
+// degraded, the wrapped store is only called once per retry interval.
+func (s *Store) tryPrimary() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.status.Degraded {
+		return true
+	}
+
+	now := s.clock()
+	if now.Before(s.retryAt) {
+		return false
+	}
+	s.retryAt = now.Add(s.retryInterval)
+
+	return true
+}
+
+// observe records the outcome of a call to the wrapped store, returning
+// whether the error reports the wrapped store is unavailable.
+func (s *Store) observe(err error) (unavailable bool) {
+	// A cancelled call says nothing of the wrapped store's health.
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.isUnavailable(err) {
+		// The wrapped store answered, so has recovered.
+		s.status = Status{}
+		return false
+	}
+
+	now := s.clock()
+	if !s.status.Degraded {
+		s.status.Degraded = true
+		s.status.Since = now
+	}
+	s.status.LastError = err
+	s.retryAt = now.Add(s.retryInterval)
+
+	return true
+}
+
+// unavailable returns the error reported for reads that can't be served from
+// the cache.
+func (s *Store) unavailable() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.status.LastError == nil {
+		return ErrUnavailable
+	}
+
+	return fmt.Errorf("%w: %v", ErrUnavailable, s.status.LastError)
+}
+
+// read returns the result of calling the wrapped store, unless it is
+// unavailable, in which case the result is served from the cache.
+func read[T any](ctx context.Context, s *Store, primary func() (T, error), cached func() (T, bool)) (result T, err error) {
+	if s.tryPrimary() {
+		result, err = primary()
+		if !s.observe(err) {
+			return result, err
+		}
+	}
+
+	// Callers giving up aren't served stale data.
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	if result, ok := cached(); ok {
+		return result, nil
+	}
+
+	return result, s.unavailable()
+}
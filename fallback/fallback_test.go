@@ -0,0 +1,368 @@
+package fallback_test
+
+import (
+	// Standard Library Imports
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	// External Imports
+	"github.com/google/uuid"
+	"github.com/ory/fosite"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+	"github.com/p000ic/go-fosite-mongo/fallback"
+	"github.com/p000ic/go-fosite-mongo/memory"
+	"github.com/p000ic/go-fosite-mongo/storagetest"
+)
+
+// outage simulates mongo becoming unreachable.
+type outage struct {
+	down atomic.Bool
+}
+
+func (o *outage) err() error {
+	if o.down.Load() {
+		return mongo.ErrClientDisconnected
+	}
+	return nil
+}
+
+type flakyClients struct {
+	storage.ClientManager
+	outage *outage
+}
+
+func (c *flakyClients) GetClient(ctx context.Context, clientID string) (fosite.Client, error) {
+	if err := c.outage.err(); err != nil {
+		return nil, err
+	}
+	return c.ClientManager.GetClient(ctx, clientID)
+}
+
+func (c *flakyClients) Authenticate(ctx context.Context, clientID string, secret string) (storage.Client, error) {
+	if err := c.outage.err(); err != nil {
+		return storage.Client{}, err
+	}
+	return c.ClientManager.Authenticate(ctx, clientID, secret)
+}
+
+type flakyUsers struct {
+	storage.UserManager
+	outage *outage
+}
+
+func (u *flakyUsers) Get(ctx context.Context, userID string) (storage.User, error) {
+	if err := u.outage.err(); err != nil {
+		return storage.User{}, err
+	}
+	return u.UserManager.Get(ctx, userID)
+}
+
+func (u *flakyUsers) AuthenticateByUsername(ctx context.Context, username string, password string) (storage.User, error) {
+	if err := u.outage.err(); err != nil {
+		return storage.User{}, err
+	}
+	return u.UserManager.AuthenticateByUsername(ctx, username, password)
+}
+
+type flakyRequests struct {
+	storage.RequestManager
+	outage *outage
+}
+
+func (r *flakyRequests) GetAccessTokenSession(ctx context.Context, signature string, session fosite.Session) (fosite.Requester, error) {
+	if err := r.outage.err(); err != nil {
+		return nil, err
+	}
+	return r.RequestManager.GetAccessTokenSession(ctx, signature, session)
+}
+
+func (r *flakyRequests) CreateAccessTokenSession(ctx context.Context, signature string, request fosite.Requester) error {
+	if err := r.outage.err(); err != nil {
+		return err
+	}
+	return r.RequestManager.CreateAccessTokenSession(ctx, signature, request)
+}
+
+// clock provides a manually advanced clock.
+type clock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+const secret = "foobar"
+
+type fixture struct {
+	store     *fallback.Store
+	outage    *outage
+	clock     *clock
+	client    storage.Client
+	user      storage.User
+	signature string
+	requestID string
+}
+
+// setup creates a fallback store over a flaky in-memory store, seeding a
+// client, user and access token which have been read, so are cached.
+func setup(t *testing.T) (fixture, context.Context) {
+	t.Helper()
+
+	ctx := context.Background()
+	primary := memory.NewDefaultStore().Store
+	o := &outage{}
+	c := &clock{now: time.Now()}
+
+	client, err := primary.ClientManager.Create(ctx, storage.Client{ID: uuid.NewString(), Secret: secret})
+	if err != nil {
+		t.Fatalf("create client should return no errors, got: %v", err)
+	}
+	user, err := primary.UserManager.Create(ctx, storage.User{ID: uuid.NewString(), Username: uuid.NewString(), Password: secret})
+	if err != nil {
+		t.Fatalf("create user should return no errors, got: %v", err)
+	}
+
+	request := fosite.NewRequest()
+	request.ID = uuid.NewString()
+	request.Client = &storage.Client{ID: client.ID}
+	request.Session = &fosite.DefaultSession{Subject: user.ID}
+	signature := uuid.NewString()
+	err = primary.RequestManager.CreateAccessTokenSession(ctx, signature, request)
+	if err != nil {
+		t.Fatalf("create access token session should return no errors, got: %v", err)
+	}
+
+	primary.ClientManager = &flakyClients{ClientManager: primary.ClientManager, outage: o}
+	primary.UserManager = &flakyUsers{UserManager: primary.UserManager, outage: o}
+	primary.RequestManager = &flakyRequests{RequestManager: primary.RequestManager, outage: o}
+	store := fallback.New(primary, &fallback.Config{
+		RetryInterval: time.Minute,
+		Clock:         c.Now,
+	})
+
+	// Warm the cache.
+	if _, err := store.GetClient(ctx, client.ID); err != nil {
+		t.Fatalf("get client should return no errors, got: %v", err)
+	}
+	if _, err := store.UserManager.Authenticate(ctx, user.Username, secret); err != nil {
+		t.Fatalf("authenticate should return no errors, got: %v", err)
+	}
+	if _, err := store.GetAccessTokenSession(ctx, signature, &fosite.DefaultSession{}); err != nil {
+		t.Fatalf("get access token session should return no errors, got: %v", err)
+	}
+
+	return fixture{
+		store:     store,
+		outage:    o,
+		clock:     c,
+		client:    client,
+		user:      user,
+		signature: signature,
+		requestID: request.ID,
+	}, ctx
+}
+
+func TestStore_Conformance(t *testing.T) {
+	storagetest.RunStoreConformance(t, fallback.New(memory.NewDefaultStore().Store, nil).Store)
+}
+
+func TestStore_ShouldServeCachedReadsWhileDegraded(t *testing.T) {
+	f, ctx := setup(t)
+	f.outage.down.Store(true)
+
+	got, err := f.store.GetClient(ctx, f.client.ID)
+	if err != nil {
+		t.Fatalf("get client should be served from the cache, got: %v", err)
+	}
+	if got.GetID() != f.client.ID {
+		t.Errorf("get client should return the cached client, got: %s, want: %s", got.GetID(), f.client.ID)
+	}
+	if !f.store.Degraded() {
+		t.Errorf("store should be degraded once the wrapped store is unavailable")
+	}
+
+	_, err = f.store.ClientManager.Authenticate(ctx, f.client.ID, secret)
+	if err != nil {
+		t.Errorf("client authenticate should be served from the cache, got: %v", err)
+	}
+
+	user, err := f.store.UserManager.Authenticate(ctx, f.user.Username, secret)
+	if err != nil {
+		t.Errorf("user authenticate should be served from the cache, got: %v", err)
+	}
+	if user.ID != f.user.ID {
+		t.Errorf("user authenticate should return the cached user, got: %s, want: %s", user.ID, f.user.ID)
+	}
+
+	_, err = f.store.UserManager.Authenticate(ctx, f.user.Username, "wrong")
+	if err == nil {
+		t.Errorf("user authenticate with the wrong password should fail while degraded")
+	}
+
+	err = f.store.Authenticate(ctx, f.user.Username, secret)
+	if err != nil {
+		t.Errorf("password grant authenticate should be served from the cache, got: %v", err)
+	}
+
+	request, err := f.store.GetAccessTokenSession(ctx, f.signature, &fosite.DefaultSession{})
+	if err != nil {
+		t.Fatalf("get access token session should be served from the cache, got: %v", err)
+	}
+	if request.GetID() != f.requestID {
+		t.Errorf("get access token session should return the cached request, got: %s, want: %s", request.GetID(), f.requestID)
+	}
+}
+
+func TestClientManager_Warm_ShouldServeWarmedClientsWhileDegraded(t *testing.T) {
+	f, ctx := setup(t)
+
+	client, err := f.store.ClientManager.Create(ctx, storage.Client{ID: uuid.NewString(), Secret: secret})
+	if err != nil {
+		t.Fatalf("create client should return no errors, got: %v", err)
+	}
+
+	clients := f.store.ClientManager.(*fallback.ClientManager)
+	err = clients.Warm(ctx, client.ID, uuid.NewString())
+	if err != nil {
+		t.Fatalf("warm should return no errors, got: %v", err)
+	}
+
+	f.outage.down.Store(true)
+	got, err := f.store.GetClient(ctx, client.ID)
+	if err != nil {
+		t.Fatalf("get warmed client should be served from the cache, got: %v", err)
+	}
+	if got.GetID() != client.ID {
+		t.Errorf("get warmed client should return the cached client, got: %s, want: %s", got.GetID(), client.ID)
+	}
+
+	_, err = f.store.ClientManager.Authenticate(ctx, client.ID, secret)
+	if err != nil {
+		t.Errorf("authenticate warmed client should be served from the cache, got: %v", err)
+	}
+}
+
+func TestStore_ShouldFailUncachedReadsWhileDegraded(t *testing.T) {
+	f, ctx := setup(t)
+	f.outage.down.Store(true)
+
+	_, err := f.store.GetClient(ctx, uuid.NewString())
+	if !errors.Is(err, fallback.ErrUnavailable) {
+		t.Errorf("get uncached client should return unavailable, got: %v, want: %v", err, fallback.ErrUnavailable)
+	}
+
+	_, err = f.store.UserManager.Get(ctx, f.user.ID)
+	if err != nil {
+		t.Errorf("get user cached on authentication should be served from the cache, got: %v", err)
+	}
+
+	_, err = f.store.GetAccessTokenSession(ctx, uuid.NewString(), &fosite.DefaultSession{})
+	if !errors.Is(err, fallback.ErrUnavailable) {
+		t.Errorf("get uncached access token session should return unavailable, got: %v, want: %v", err, fallback.ErrUnavailable)
+	}
+}
+
+func TestStore_ShouldNotPersistWhileDegraded(t *testing.T) {
+	f, ctx := setup(t)
+	f.outage.down.Store(true)
+
+	request := fosite.NewRequest()
+	request.ID = uuid.NewString()
+	request.Client = &storage.Client{ID: f.client.ID}
+	request.Session = &fosite.DefaultSession{Subject: f.user.ID}
+	err := f.store.CreateAccessTokenSession(ctx, uuid.NewString(), request)
+	if !errors.Is(err, mongo.ErrClientDisconnected) {
+		t.Errorf("create access token session should fail as the wrapped store does, got: %v, want: %v", err, mongo.ErrClientDisconnected)
+	}
+}
+
+func TestStore_ShouldNotServeRevokedTokens(t *testing.T) {
+	f, ctx := setup(t)
+
+	err := f.store.RevokeAccessToken(ctx, f.requestID)
+	if err != nil {
+		t.Fatalf("revoke access token should return no errors, got: %v", err)
+	}
+	f.outage.down.Store(true)
+
+	_, err = f.store.GetAccessTokenSession(ctx, f.signature, &fosite.DefaultSession{})
+	if !errors.Is(err, fallback.ErrUnavailable) {
+		t.Errorf("get revoked access token session should not be served from the cache, got: %v, want: %v", err, fallback.ErrUnavailable)
+	}
+}
+
+func TestStore_ShouldRecover(t *testing.T) {
+	f, ctx := setup(t)
+	f.outage.down.Store(true)
+
+	_, err := f.store.GetClient(ctx, f.client.ID)
+	if err != nil {
+		t.Fatalf("get client should be served from the cache, got: %v", err)
+	}
+	status := f.store.Status()
+	if !status.Degraded || !errors.Is(status.LastError, mongo.ErrClientDisconnected) {
+		t.Fatalf("status should report the wrapped store's error, got: %+v", status)
+	}
+
+	f.outage.down.Store(false)
+
+	// The wrapped store isn't retried until the retry interval has elapsed.
+	_, err = f.store.GetClient(ctx, f.client.ID)
+	if err != nil {
+		t.Fatalf("get client should be served from the cache, got: %v", err)
+	}
+	if !f.store.Degraded() {
+		t.Errorf("store should remain degraded until the wrapped store is retried")
+	}
+
+	f.clock.Advance(time.Minute)
+
+	_, err = f.store.GetClient(ctx, uuid.NewString())
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get client should be answered by the wrapped store, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+	if f.store.Degraded() {
+		t.Errorf("store should recover once the wrapped store answers")
+	}
+}
+
+func TestIsUnavailable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "no error", err: nil, want: false},
+		{name: "not found", err: fosite.ErrNotFound, want: false},
+		{name: "disconnected", err: mongo.ErrClientDisconnected, want: true},
+		{name: "storage unavailable", err: fmt.Errorf("%w: connection refused", storage.ErrStorageUnavailable), want: true},
+		{name: "storage timeout", err: fmt.Errorf("%w: deadline exceeded", storage.ErrTimeout), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fallback.IsUnavailable(tt.err); got != tt.want {
+				t.Errorf("IsUnavailable() = %t, want: %t", got, tt.want)
+			}
+		})
+	}
+}
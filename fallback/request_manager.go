@@ -0,0 +1,200 @@
+package fallback
+
+import (
+	// Standard Library Imports
+	"context"
+	"errors"
+	"time"
+
+	// External Imports
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// RequestManager caches access token sessions read from the wrapped request
+// manager, serving them while the wrapped store is unavailable, so issued
+// access tokens can continue to be introspected.
+//
+// Implements:
+// - storage.Configure
+// - storage.RequestManager
+// - storage.RequestStore
+type RequestManager struct {
+	storage.RequestManager
+
+	store *Store
+	users *UserManager
+	cache *cache[fosite.Requester]
+}
+
+// evictRequest removes the access token sessions belonging to the request
+// from the cache.
+func (r *RequestManager) evictRequest(requestID string) {
+	r.cache.removeFunc(func(request fosite.Requester) bool {
+		return request.GetID() == requestID
+	})
+}
+
+// GetAccessTokenSession returns the access token's session, served from the
+// cache if the wrapped store is unavailable.
+func (r *RequestManager) GetAccessTokenSession(ctx context.Context, signature string, session fosite.Session) (fosite.Requester, error) {
+	return read(ctx, r.store,
+		func() (fosite.Requester, error) {
+			request, err := r.RequestManager.GetAccessTokenSession(ctx, signature, session)
+			if err == nil {
+				r.cache.put(signature, request)
+			}
+			return request, err
+		},
+		func() (fosite.Requester, bool) {
+			return r.cache.get(signature)
+		},
+	)
+}
+
+// GetAccessTokenSessionForAudience returns the access token's session, served
+// from the cache if the wrapped store is unavailable, if the token was granted
+// the audience.
+func (r *RequestManager) GetAccessTokenSessionForAudience(ctx context.Context, signature string, audience string, session fosite.Session) (fosite.Requester, error) {
+	request, err := r.GetAccessTokenSession(ctx, signature, session)
+	if err != nil {
+		return nil, err
+	}
+
+	if !request.GetGrantedAudience().Has(audience) {
+		return nil, storage.ErrAudienceMismatch
+	}
+
+	return request, nil
+}
+
+// DeleteAccessTokenSession evicts the cached session and deletes the access
+// token's session.
+func (r *RequestManager) DeleteAccessTokenSession(ctx context.Context, signature string) error {
+	r.cache.remove(signature)
+	return r.RequestManager.DeleteAccessTokenSession(ctx, signature)
+}
+
+// RevokeAccessToken evicts the request's cached sessions and revokes the
+// request's access tokens. The sessions are evicted even if revoking fails,
+// so a token being revoked is never served from the cache.
+func (r *RequestManager) RevokeAccessToken(ctx context.Context, requestID string) error {
+	r.evictRequest(requestID)
+	return r.RequestManager.RevokeAccessToken(ctx, requestID)
+}
+
+// RevokeRefreshTokenBySignature evicts all cached access token sessions, as
+// the linked access token isn't known until the refresh token has been
+// deleted, and revokes the refresh token and its linked access token.
+func (r *RequestManager) RevokeRefreshTokenBySignature(ctx context.Context, signature string) error {
+	r.cache.removeFunc(func(fosite.Requester) bool {
+		return true
+	})
+
+	return r.RequestManager.RevokeRefreshTokenBySignature(ctx, signature)
+}
+
+// Update evicts any cached access token sessions of the request and updates
+// the request.
+func (r *RequestManager) Update(ctx context.Context, entityName string, requestID string, request storage.Request) (storage.Request, error) {
+	if entityName == storage.EntityAccessTokens {
+		r.evictRequest(requestID)
+	}
+
+	return r.RequestManager.Update(ctx, entityName, requestID, request)
+}
+
+// Delete evicts any cached access token sessions of the request and deletes
+// the request.
+func (r *RequestManager) Delete(ctx context.Context, entityName string, requestID string) error {
+	if entityName == storage.EntityAccessTokens {
+		r.evictRequest(requestID)
+	}
+
+	return r.RequestManager.Delete(ctx, entityName, requestID)
+}
+
+// DeleteBySignature evicts any cached access token session and deletes the
+// request matching the signature.
+func (r *RequestManager) DeleteBySignature(ctx context.Context, entityName string, signature string) error {
+	if entityName == storage.EntityAccessTokens {
+		r.cache.remove(signature)
+	}
+
+	return r.RequestManager.DeleteBySignature(ctx, entityName, signature)
+}
+
+// DeleteBySignatureReturning evicts any cached access token session and
+// deletes the request matching the signature, returning it.
+func (r *RequestManager) DeleteBySignatureReturning(ctx context.Context, entityName string, signature string) (storage.Request, error) {
+	if entityName == storage.EntityAccessTokens {
+		r.cache.remove(signature)
+	}
+
+	return r.RequestManager.DeleteBySignatureReturning(ctx, entityName, signature)
+}
+
+// DeleteByRegion evicts all cached access token sessions, as the region they
+// were issued in isn't cached, and deletes the requests issued in the region.
+func (r *RequestManager) DeleteByRegion(ctx context.Context, region string) error {
+	r.cache.removeFunc(func(fosite.Requester) bool {
+		return true
+	})
+
+	return r.RequestManager.DeleteByRegion(ctx, region)
+}
+
+// DeleteByFilter evicts all cached access token sessions, as the requests
+// matching the filter can't be told apart in the cache, and deletes the
+// requests matching the filter.
+func (r *RequestManager) DeleteByFilter(ctx context.Context, entityName string, filter storage.ListRequestsRequest) (int64, error) {
+	if entityName == storage.EntityAccessTokens {
+		r.cache.removeFunc(func(fosite.Requester) bool {
+			return true
+		})
+	}
+
+	return r.RequestManager.DeleteByFilter(ctx, entityName, filter)
+}
+
+// DeleteByClientAndEntity evicts the client's cached access token sessions and
+// deletes the client's requests of the given entity.
+func (r *RequestManager) DeleteByClientAndEntity(ctx context.Context, clientID string, entityName string) (int64, error) {
+	if entityName == storage.EntityAccessTokens {
+		r.cache.removeFunc(func(request fosite.Requester) bool {
+			return request.GetClient().GetID() == clientID
+		})
+	}
+
+	return r.RequestManager.DeleteByClientAndEntity(ctx, clientID, entityName)
+}
+
+// PurgeExpiredBatched evicts the cached access token sessions that expired
+// before the given time and deletes the requests that expired before it.
+func (r *RequestManager) PurgeExpiredBatched(ctx context.Context, entityName string, before time.Time, batchSize int) (int64, error) {
+	if entityName == storage.EntityAccessTokens {
+		r.cache.removeFunc(func(request fosite.Requester) bool {
+			expiresAt := request.GetSession().GetExpiresAt(fosite.AccessToken)
+			return !expiresAt.IsZero() && expiresAt.Before(before)
+		})
+	}
+
+	return r.RequestManager.PurgeExpiredBatched(ctx, entityName, before, batchSize)
+}
+
+// Authenticate verifies the user's password, against the cached user if the
+// wrapped store is unavailable, so the resource owner password credentials
+// grant continues to work.
+//
+// Authenticate implements:
+// - oauth2.ResourceOwnerPasswordCredentialsGrantStorage
+func (r *RequestManager) Authenticate(ctx context.Context, username string, secret string) error {
+	_, err := r.users.Authenticate(ctx, username, secret)
+	if errors.Is(err, storage.ErrInvalidCredentials) {
+		// fosite reports not found as an invalid grant.
+		return fosite.ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,278 @@
+package fallback
+
+import (
+	// Standard Library Imports
+	"context"
+	"errors"
+
+	// External Imports
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// UserManager caches users read from the wrapped user manager, serving them
+// while the wrapped store is unavailable.
+//
+// Implements:
+// - storage.Configure
+// - storage.AuthUserMigrator
+// - storage.UserStorer
+// - storage.UserManager
+type UserManager struct {
+	storage.UserManager
+
+	store  *Store
+	hasher fosite.Hasher
+	cache  *cache[storage.User]
+}
+
+// idKey returns the cache key of a user looked up by ID.
+func idKey(userID string) string {
+	return "id:" + userID
+}
+
+// usernameKey returns the cache key of a user looked up by username.
+func usernameKey(username string) string {
+	return "username:" + username
+}
+
+// put caches the user against the user's ID and, unless disabled, username.
+// Disabled users' usernames can be reused, so aren't cached to avoid
+// shadowing the enabled user holding the username.
+func (u *UserManager) put(user storage.User) {
+	u.cache.put(idKey(user.ID), user)
+	if !user.Disabled {
+		u.cache.put(usernameKey(user.Username), user)
+	}
+}
+
+// evict removes the users from the cache, so stale users aren't served once
+// they've been changed.
+func (u *UserManager) evict(userIDs ...string) {
+	for _, userID := range userIDs {
+		u.cache.removeFunc(func(user storage.User) bool {
+			return user.ID == userID
+		})
+	}
+}
+
+// cached returns the user cached against the key, excluding disabled users
+// unless the context includes them.
+func (u *UserManager) cached(ctx context.Context, key string) (storage.User, bool) {
+	user, ok := u.cache.get(key)
+	if !ok || (user.Disabled && !storage.IncludeDisabled(ctx)) {
+		return storage.User{}, false
+	}
+
+	return user, true
+}
+
+// Get returns the user, served from the cache if the wrapped store is
+// unavailable.
+func (u *UserManager) Get(ctx context.Context, userID string) (storage.User, error) {
+	return read(ctx, u.store,
+		func() (storage.User, error) {
+			user, err := u.UserManager.Get(ctx, userID)
+			if err == nil {
+				u.put(user)
+			}
+			return user, err
+		},
+		func() (storage.User, bool) {
+			return u.cached(ctx, idKey(userID))
+		},
+	)
+}
+
+// GetByUsername returns the user, served from the cache if the wrapped store
+// is unavailable.
+func (u *UserManager) GetByUsername(ctx context.Context, username string) (storage.User, error) {
+	return read(ctx, u.store,
+		func() (storage.User, error) {
+			user, err := u.UserManager.GetByUsername(ctx, username)
+			if err == nil {
+				u.put(user)
+			}
+			return user, err
+		},
+		func() (storage.User, bool) {
+			return u.cached(ctx, usernameKey(username))
+		},
+	)
+}
+
+// Authenticate verifies the user's password, against the cached user if the
+// wrapped store is unavailable.
+func (u *UserManager) Authenticate(ctx context.Context, username string, password string) (storage.User, error) {
+	return u.AuthenticateByUsername(ctx, username, password)
+}
+
+// AuthenticateByID verifies the user's password, against the cached user if
+// the wrapped store is unavailable.
+func (u *UserManager) AuthenticateByID(ctx context.Context, userID string, password string) (storage.User, error) {
+	return u.authenticate(ctx, idKey(userID), password, func() (storage.User, error) {
+		return u.UserManager.AuthenticateByID(ctx, userID, password)
+	})
+}
+
+// AuthenticateByUsername verifies the user's password, against the cached
+// user if the wrapped store is unavailable.
+func (u *UserManager) AuthenticateByUsername(ctx context.Context, username string, password string) (storage.User, error) {
+	return u.authenticate(ctx, usernameKey(username), password, func() (storage.User, error) {
+		return u.UserManager.AuthenticateByUsername(ctx, username, password)
+	})
+}
+
+// authenticate returns the result of authenticating via the wrapped store,
+// unless it is unavailable, in which case the password is compared against
+// the user cached against the key, mirroring the wrapped store.
+func (u *UserManager) authenticate(ctx context.Context, key string, password string, primary func() (storage.User, error)) (result storage.User, err error) {
+	if u.store.tryPrimary() {
+		result, err = primary()
+		if !u.store.observe(err) {
+			switch {
+			case err == nil:
+				u.put(result)
+			case errors.Is(err, storage.ErrInvalidCredentials), errors.Is(err, fosite.ErrAccessDenied):
+				// The failure may have locked the user out, which the cached
+				// user wouldn't reflect.
+				if user, ok := u.cache.get(key); ok {
+					u.evict(user.ID)
+				}
+			}
+			return result, err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	user, ok := u.cache.get(key)
+	if !ok {
+		return result, u.store.unavailable()
+	}
+
+	err = u.hasher.Compare(ctx, []byte(user.Password), []byte(password))
+	if err != nil {
+		return result, storage.ErrInvalidCredentials
+	}
+
+	// Deny disabled or locked users only once the password has been verified.
+	if user.Disabled || user.IsLocked(u.store.clock()) {
+		return result, fosite.ErrAccessDenied
+	}
+
+	return user, nil
+}
+
+// Update evicts the cached user and updates the user.
+func (u *UserManager) Update(ctx context.Context, userID string, user storage.User) (storage.User, error) {
+	u.evict(userID)
+	return u.UserManager.Update(ctx, userID, user)
+}
+
+// UpdatePassword evicts the cached user and updates the user's password.
+func (u *UserManager) UpdatePassword(ctx context.Context, userID string, password string) error {
+	u.evict(userID)
+	return u.UserManager.UpdatePassword(ctx, userID, password)
+}
+
+// Delete evicts the cached user and deletes the user.
+func (u *UserManager) Delete(ctx context.Context, userID string) error {
+	u.evict(userID)
+	return u.UserManager.Delete(ctx, userID)
+}
+
+// GrantScopes evicts the cached user and grants the scopes to the user.
+func (u *UserManager) GrantScopes(ctx context.Context, userID string, scopes []string) (storage.User, error) {
+	u.evict(userID)
+	return u.UserManager.GrantScopes(ctx, userID, scopes)
+}
+
+// GrantScopesToMany evicts the cached users and grants the scopes to each of
+// the users.
+func (u *UserManager) GrantScopesToMany(ctx context.Context, userIDs []string, scopes []string) error {
+	u.evict(userIDs...)
+	return u.UserManager.GrantScopesToMany(ctx, userIDs, scopes)
+}
+
+// RemoveScopes evicts the cached user and removes the scopes from the user.
+func (u *UserManager) RemoveScopes(ctx context.Context, userID string, scopes []string) (storage.User, error) {
+	u.evict(userID)
+	return u.UserManager.RemoveScopes(ctx, userID, scopes)
+}
+
+// RemoveAllScopes evicts the cached user and removes all the user's scopes.
+func (u *UserManager) RemoveAllScopes(ctx context.Context, userID string) (storage.User, error) {
+	u.evict(userID)
+	return u.UserManager.RemoveAllScopes(ctx, userID)
+}
+
+// Disable evicts the cached user and disables the user.
+func (u *UserManager) Disable(ctx context.Context, userID string) (storage.User, error) {
+	u.evict(userID)
+	return u.UserManager.Disable(ctx, userID)
+}
+
+// Enable evicts the cached user and enables the user.
+func (u *UserManager) Enable(ctx context.Context, userID string) (storage.User, error) {
+	u.evict(userID)
+	return u.UserManager.Enable(ctx, userID)
+}
+
+// ResetFailedLogins evicts the cached user and clears the user's failed
+// logins and lockout.
+func (u *UserManager) ResetFailedLogins(ctx context.Context, userID string) (storage.User, error) {
+	u.evict(userID)
+	return u.UserManager.ResetFailedLogins(ctx, userID)
+}
+
+// SetEmailVerified evicts the cached user and sets whether the user's email
+// is verified.
+func (u *UserManager) SetEmailVerified(ctx context.Context, userID string, verified bool) (storage.User, error) {
+	u.evict(userID)
+	return u.UserManager.SetEmailVerified(ctx, userID, verified)
+}
+
+// VerifyEmailToken verifies the user's email, evicting the verified user.
+func (u *UserManager) VerifyEmailToken(ctx context.Context, token string) (storage.User, error) {
+	user, err := u.UserManager.VerifyEmailToken(ctx, token)
+	if err == nil {
+		u.evict(user.ID)
+	}
+
+	return user, err
+}
+
+// EnrollTOTP evicts the cached user and enrolls the user in TOTP.
+func (u *UserManager) EnrollTOTP(ctx context.Context, userID string, secret string, recoveryCodes []string) (storage.User, error) {
+	u.evict(userID)
+	return u.UserManager.EnrollTOTP(ctx, userID, secret, recoveryCodes)
+}
+
+// DisableMFA evicts the cached user and disables the user's MFA.
+func (u *UserManager) DisableMFA(ctx context.Context, userID string) (storage.User, error) {
+	u.evict(userID)
+	return u.UserManager.DisableMFA(ctx, userID)
+}
+
+// ConsumeRecoveryCode evicts the cached user and consumes the recovery code.
+func (u *UserManager) ConsumeRecoveryCode(ctx context.Context, userID string, code string) error {
+	u.evict(userID)
+	return u.UserManager.ConsumeRecoveryCode(ctx, userID, code)
+}
+
+// Migrate evicts the cached user and migrates the user.
+func (u *UserManager) Migrate(ctx context.Context, migratedUser storage.User) (storage.User, error) {
+	u.evict(migratedUser.ID)
+	return u.UserManager.Migrate(ctx, migratedUser)
+}
+
+// AuthenticateMigration evicts the cached user and authenticates the user,
+// migrating the user's password.
+func (u *UserManager) AuthenticateMigration(ctx context.Context, currentAuth storage.AuthUserFunc, userID string, password string) (storage.User, error) {
+	u.evict(userID)
+	return u.UserManager.AuthenticateMigration(ctx, currentAuth, userID, password)
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	// Standard Library Imports
+	"context"
+)
+
+// Hooks observes, and can veto, changes to a store's entities, such as
+// clients and users, enabling policies to be enforced without forking a
+// store, for example, naming conventions, or uniqueness against an external
+// system.
+//
+// BeforeCreate and BeforeUpdate receive the entity as provided by the caller,
+// with its ID set, before any secret or password is hashed, while
+// BeforeDelete receives the ID of the entity to be deleted. Returning an error
+// vetoes the change, returning the error to the caller.
+//
+// The After hooks are called once the change has been stored, receiving the
+// entity as stored, so can't veto the change.
+//
+// Hooks are called synchronously, so shouldn't block. Embed NopHooks to only
+// implement the hooks of interest.
+type Hooks[T any] interface {
+	BeforeCreate(ctx context.Context, entity T) error
+	AfterCreate(ctx context.Context, entity T)
+	BeforeUpdate(ctx context.Context, entity T) error
+	AfterUpdate(ctx context.Context, entity T)
+	BeforeDelete(ctx context.Context, id string) error
+	AfterDelete(ctx context.Context, id string)
+}
+
+// NopHooks provides a Hooks implementation that allows every change.
+type NopHooks[T any] struct{}
+
+// BeforeCreate implements Hooks.
+func (NopHooks[T]) BeforeCreate(_ context.Context, _ T) error { return nil }
+
+// AfterCreate implements Hooks.
+func (NopHooks[T]) AfterCreate(_ context.Context, _ T) {}
+
+// BeforeUpdate implements Hooks.
+func (NopHooks[T]) BeforeUpdate(_ context.Context, _ T) error { return nil }
+
+// AfterUpdate implements Hooks.
+func (NopHooks[T]) AfterUpdate(_ context.Context, _ T) {}
+
+// BeforeDelete implements Hooks.
+func (NopHooks[T]) BeforeDelete(_ context.Context, _ string) error { return nil }
+
+// AfterDelete implements Hooks.
+func (NopHooks[T]) AfterDelete(_ context.Context, _ string) {}
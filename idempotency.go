@@ -0,0 +1,28 @@
+package storage
+
+import (
+	// Standard Library Imports
+	"time"
+)
+
+// IdempotentResult provides the structure for the stored result of a request
+// made by a client with an idempotency key, recorded in order to replay the
+// result when the request is retried.
+type IdempotentResult struct {
+	Key       string    `bson:"-" json:"-" xml:"-"`
+	ClientID  string    `bson:"client_id" json:"clientId" xml:"clientId"`
+	Signature string    `bson:"signature" json:"signature" xml:"signature"`
+	Result    []byte    `bson:"result" json:"result" xml:"result"`
+	ExpiresAt time.Time `bson:"expires_at" json:"expiresAt" xml:"expiresAt"`
+}
+
+// NewIdempotentResult returns a new idempotent result to be stored.
+func NewIdempotentResult(clientID string, key string, result []byte, expiresAt time.Time) IdempotentResult {
+	return IdempotentResult{
+		Key:       key,
+		ClientID:  clientID,
+		Signature: SignatureFromJTI(key),
+		Result:    result,
+		ExpiresAt: expiresAt,
+	}
+}
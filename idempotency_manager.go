@@ -0,0 +1,37 @@
+package storage
+
+import (
+	// Standard Library Imports
+	"context"
+	"time"
+)
+
+// IdempotencyManager provides a generic interface to idempotent results in
+// order to build a Datastore backend.
+type IdempotencyManager interface {
+	Configure
+	IdempotencyStore
+}
+
+// IdempotencyStore enables storing the results of requests made with an
+// idempotency key, for example, token endpoint responses, in order to replay
+// them when the request is retried. Keys are scoped to the client making the
+// request, so a client can't replay another client's results.
+//
+// Note:
+//   - Results are stored as provided, so a token endpoint response stored
+//     in plaintext exposes live tokens to anyone able to read the datastore
+//     until the result expires. Encrypt sensitive results before storing
+//     them, and keep the ttl to the retry window.
+type IdempotencyStore interface {
+	// StoreIdempotentResult stores the result of the request made by the
+	// client with the key until the ttl elapses. ErrInvalidTTL is returned if
+	// the ttl isn't positive, and ErrResourceExists if a result has already
+	// been stored for the client's key and hasn't expired.
+	StoreIdempotentResult(ctx context.Context, clientID string, key string, result []byte, ttl time.Duration) error
+
+	// GetIdempotentResult returns the result stored for the client's key.
+	// fosite.ErrNotFound is returned if no result has been stored for the
+	// client's key, or the result has expired.
+	GetIdempotentResult(ctx context.Context, clientID string, key string) ([]byte, error)
+}
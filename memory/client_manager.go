@@ -0,0 +1,851 @@
+package memory
+
+import (
+	// Standard Library imports
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	// External Imports
+	"github.com/go-jose/go-jose/v3"
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// ClientManager provides an in-memory storage implementation for Clients.
+//
+// Implements:
+// - fosite.Storage
+// - fosite.ClientManager
+// - storage.AuthClientMigrator
+// - storage.ClientManager
+// - storage.ClientStore
+type ClientManager struct {
+	noopConfigure
+
+	Hasher fosite.Hasher
+
+	// IDGenerator generates IDs for newly created clients. Defaults to
+	// generating UUIDs if not set.
+	IDGenerator func() string
+
+	// Clock provides the current time. Defaults to time.Now if not set.
+	Clock func() time.Time
+
+	// AllowDisabledClients returns disabled clients from GetClient.
+	AllowDisabledClients bool
+
+	// RequirePKCEForPublicClients enforces PKCE for all public clients
+	// returned by GetClient, regardless of the client's EnforcePKCE setting.
+	RequirePKCEForPublicClients bool
+
+	// StrictClientSecrets rejects public clients with a secret, and
+	// confidential clients without one, on create and update, see
+	// storage.Client.ValidateSecret. Public clients are stored without a
+	// secret.
+	StrictClientSecrets bool
+
+	// Hooks, if set, observes and can veto the clients created, updated and
+	// deleted via Create, GetOrCreate, Migrate, Upsert, Update and Delete.
+	// Targeted updates, such as GrantScopes, aren't hooked.
+	Hooks storage.Hooks[storage.Client]
+
+	DeniedJTIs storage.DeniedJTIStore
+
+	mutex   sync.RWMutex
+	clients map[string]storage.Client
+	decoy   decoyHash
+}
+
+// hooks returns the configured hooks, defaulting to allowing every change.
+func (c *ClientManager) hooks() storage.Hooks[storage.Client] {
+	if c.Hooks == nil {
+		return storage.NopHooks[storage.Client]{}
+	}
+
+	return c.Hooks
+}
+
+// getConcrete returns an OAuth 2.0 Client resource.
+func (c *ClientManager) getConcrete(clientID string) (result storage.Client, err error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	client, ok := c.clients[clientID]
+	if !ok {
+		return result, fosite.ErrNotFound
+	}
+
+	return cloneClient(client), nil
+}
+
+// put stores the client, overwriting any existing client with the same ID.
+// The caller must hold the write lock.
+func (c *ClientManager) put(client storage.Client) {
+	if c.clients == nil {
+		c.clients = map[string]storage.Client{}
+	}
+
+	c.clients[client.ID] = cloneClient(client)
+}
+
+// setFields performs a targeted update of the specified client, bumping the
+// client's update time, and returns the updated client.
+func (c *ClientManager) setFields(clientID string, set func(client *storage.Client)) (result storage.Client, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	client, ok := c.clients[clientID]
+	if !ok {
+		return result, fosite.ErrNotFound
+	}
+
+	client = cloneClient(client)
+	set(&client)
+	client.UpdateTime = timeNow(c.Clock).Unix()
+	c.put(client)
+
+	return cloneClient(client), nil
+}
+
+// List filters resources to return a list of OAuth 2.0 client resources.
+func (c *ClientManager) List(_ context.Context, filter storage.ListClientsRequest) (results []storage.Client, err error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	for _, client := range c.clients {
+		if filter.AllowedTenantAccess != "" && !contains(client.AllowedTenantAccess, filter.AllowedTenantAccess) {
+			continue
+		}
+		if filter.AllowedRegion != "" && !contains(client.AllowedRegions, filter.AllowedRegion) {
+			continue
+		}
+		if filter.RedirectURI != "" && !contains(client.RedirectURIs, filter.RedirectURI) {
+			continue
+		}
+		if filter.AllowedCORSOrigin != "" && !contains(client.AllowedCORSOrigins, filter.AllowedCORSOrigin) {
+			continue
+		}
+		if filter.GrantType != "" && !contains(client.GrantTypes, filter.GrantType) {
+			continue
+		}
+		if filter.ResponseType != "" && !contains(client.ResponseTypes, filter.ResponseType) {
+			continue
+		}
+		// A scope union takes precedence, as it returns the wider selection.
+		if len(filter.ScopesUnion) > 0 {
+			if !containsAny(client.Scopes, filter.ScopesUnion) {
+				continue
+			}
+		} else if len(filter.ScopesIntersection) > 0 && !containsAll(client.Scopes, filter.ScopesIntersection) {
+			continue
+		}
+		if filter.ScopePrefix != "" && !containsPrefix(client.Scopes, filter.ScopePrefix) {
+			continue
+		}
+		if filter.Contact != "" && !contains(client.Contacts, filter.Contact) {
+			continue
+		}
+		if filter.Public && !client.Public {
+			continue
+		}
+		if filter.Disabled && !client.Disabled {
+			continue
+		}
+		if filter.After != "" && client.ID <= filter.After {
+			continue
+		}
+		if filter.Published && !client.Published {
+			continue
+		}
+
+		results = append(results, cloneClient(client))
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].ID < results[j].ID
+	})
+	if filter.Limit > 0 && filter.Limit < int64(len(results)) {
+		results = results[:filter.Limit]
+	}
+
+	return results, nil
+}
+
+// ListByScope returns the OAuth 2.0 client resources permitted to request the
+// provided scope.
+func (c *ClientManager) ListByScope(ctx context.Context, scope string) (results []storage.Client, err error) {
+	return c.List(ctx, storage.ListClientsRequest{
+		ScopesIntersection: []string{scope},
+	})
+}
+
+// ListByContact returns the OAuth 2.0 client resources the provided contact,
+// typically an email address, is listed as being responsible for.
+func (c *ClientManager) ListByContact(ctx context.Context, contact string) (results []storage.Client, err error) {
+	return c.List(ctx, storage.ListClientsRequest{
+		Contact: contact,
+	})
+}
+
+// Create stores a new OAuth2.0 Client resource. Clients allowed unknown grant
+// or response types are rejected, see storage.Client.Validate.
+func (c *ClientManager) Create(ctx context.Context, client storage.Client) (result storage.Client, err error) {
+	err = client.Validate()
+	if err != nil {
+		return result, err
+	}
+
+	// Enable developers to provide their own IDs
+	if client.ID == "" {
+		client.ID = generateID(c.IDGenerator)
+	}
+	if client.CreateTime == 0 {
+		client.CreateTime = timeNow(c.Clock).Unix()
+	}
+
+	err = c.hooks().BeforeCreate(ctx, client)
+	if err != nil {
+		return result, err
+	}
+
+	client.Secret, err = c.createSecret(ctx, client)
+	if err != nil {
+		return result, err
+	}
+
+	// Create resource
+	c.mutex.Lock()
+	_, exists := c.clients[client.ID]
+	if !exists {
+		c.put(client)
+	}
+	c.mutex.Unlock()
+
+	if exists {
+		return result, storage.ErrResourceExists
+	}
+
+	c.hooks().AfterCreate(ctx, client)
+	return client, nil
+}
+
+// createSecret enforces the secret rules for a client being created, returning
+// the secret to store: the hash of the client's secret, unless the client is
+// strictly secretless. Shared by each path creating a client, so they enforce
+// the same rules.
+func (c *ClientManager) createSecret(ctx context.Context, client storage.Client) (string, error) {
+	if c.StrictClientSecrets {
+		err := client.ValidateSecret()
+		if err != nil {
+			return "", err
+		}
+		if client.Public {
+			return "", nil
+		}
+	}
+
+	hash, err := c.Hasher.Hash(ctx, []byte(client.Secret))
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// GetOrCreate returns the OAuth 2.0 client resource matching the client's ID,
+// creating it if it does not already exist. created reports whether the
+// client was created by this call. As with Create, clients allowed unknown
+// grant or response types are rejected, see storage.Client.Validate.
+func (c *ClientManager) GetOrCreate(ctx context.Context, client storage.Client) (result storage.Client, created bool, err error) {
+	// Enable developers to provide their own IDs
+	if client.ID == "" {
+		client.ID = generateID(c.IDGenerator)
+	}
+
+	// Avoid hashing the secret if the client already exists.
+	existing, err := c.getConcrete(client.ID)
+	if err == nil {
+		return existing, false, nil
+	}
+
+	created = true
+	result, err = c.Create(ctx, client)
+	if err == storage.ErrResourceExists {
+		// The client was created concurrently.
+		created = false
+		result, err = c.getConcrete(client.ID)
+	}
+	if err != nil {
+		return storage.Client{}, false, err
+	}
+
+	return result, created, nil
+}
+
+// Upsert creates the OAuth 2.0 client resource, or updates it if it already
+// exists, so that clients can be declared idempotently. On update, the stored
+// secret hash is kept if the secret is blank or unchanged, otherwise the new
+// secret is hashed, and the original create time is preserved.
+func (c *ClientManager) Upsert(ctx context.Context, client storage.Client) (result storage.Client, err error) {
+	err = client.Validate()
+	if err != nil {
+		return result, err
+	}
+
+	// Enable developers to provide their own IDs
+	if client.ID == "" {
+		client.ID = generateID(c.IDGenerator)
+	}
+
+	existing, err := c.getConcrete(client.ID)
+	if err == fosite.ErrNotFound {
+		result, err = c.Create(ctx, client)
+		if err != storage.ErrResourceExists {
+			return result, err
+		}
+
+		// The client was created concurrently, so update it instead.
+		existing, err = c.getConcrete(client.ID)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	err = c.hooks().BeforeUpdate(ctx, client)
+	if err != nil {
+		return result, err
+	}
+
+	client.Secret, err = c.upsertSecret(ctx, existing.Secret, client.Secret)
+	if err != nil {
+		return result, err
+	}
+
+	if c.StrictClientSecrets {
+		if client.Public && client.Secret == existing.Secret {
+			// Drop any secret held while the client was confidential.
+			client.Secret = ""
+		}
+		err = client.ValidateSecret()
+		if err != nil {
+			return result, err
+		}
+	}
+
+	client.CreateTime = existing.CreateTime
+	client.UpdateTime = timeNow(c.Clock).Unix()
+
+	result, err = c.replace(client)
+	if err != nil {
+		return result, err
+	}
+
+	c.hooks().AfterUpdate(ctx, result)
+	return result, nil
+}
+
+// replace stores the upserted client over the existing client, preserving
+// the client's metadata and secret rotation if not provided.
+func (c *ClientManager) replace(client storage.Client) (result storage.Client, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	current, ok := c.clients[client.ID]
+	if !ok {
+		return result, fosite.ErrNotFound
+	}
+	if client.Extra == nil {
+		// Preserve unmodeled metadata the caller may not be aware of.
+		client.Extra = current.Extra
+	}
+	// Secret rotation is only managed via RotateSecret.
+	client.PreviousSecret = current.PreviousSecret
+	client.PreviousSecretExpiry = current.PreviousSecretExpiry
+	c.put(client)
+
+	return cloneClient(client), nil
+}
+
+// upsertSecret returns the hash to store for an upserted client's secret,
+// keeping the existing hash if the secret is blank, is the existing hash, or
+// matches the existing hash.
+func (c *ClientManager) upsertSecret(ctx context.Context, hash string, secret string) (string, error) {
+	if secret == "" || secret == hash {
+		return hash, nil
+	}
+
+	if c.Hasher.Compare(ctx, []byte(hash), []byte(secret)) == nil {
+		return hash, nil
+	}
+
+	newHash, err := c.Hasher.Hash(ctx, []byte(secret))
+	if err != nil {
+		return "", err
+	}
+
+	return string(newHash), nil
+}
+
+// Get finds and returns an OAuth 2.0 client resource.
+func (c *ClientManager) Get(_ context.Context, clientID string) (result storage.Client, err error) {
+	return c.getConcrete(clientID)
+}
+
+// Exists returns whether an OAuth 2.0 client resource exists with the given
+// client ID.
+func (c *ClientManager) Exists(_ context.Context, clientID string) (exists bool, err error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	_, exists = c.clients[clientID]
+	return exists, nil
+}
+
+// GetClient finds and returns an OAuth 2.0 client resource. Disabled clients
+// are reported as not found, so fosite rejects them as invalid, unless
+// AllowDisabledClients is set.
+//
+// GetClient implements:
+// - fosite.Storage
+// - fosite.ClientManager
+func (c *ClientManager) GetClient(_ context.Context, clientID string) (fosite.Client, error) {
+	client, err := c.getConcrete(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	if client.Disabled && !c.AllowDisabledClients {
+		return nil, fosite.ErrNotFound
+	}
+
+	if client.Public && c.RequirePKCEForPublicClients {
+		client.EnforcePKCE = true
+	}
+
+	return &client, nil
+}
+
+// ClientAssertionJWTValid returns an error if the JTI is known and nil if the
+// JTI is not known.
+func (c *ClientManager) ClientAssertionJWTValid(ctx context.Context, jti string) error {
+	deniedJti, err := c.DeniedJTIs.Get(ctx, jti)
+	if err != nil {
+		switch err {
+		case fosite.ErrNotFound:
+			// the jti is not known => valid
+			return nil
+
+		default:
+			// Unknown error...
+			return err
+		}
+	}
+
+	if time.Unix(deniedJti.Expiry, 0).After(timeNow(c.Clock)) {
+		// the jti is not expired yet => invalid
+		return fosite.ErrJTIKnown
+	}
+
+	return nil
+}
+
+// SetClientAssertionJWT marks a JTI as known for the given expiry time.
+// Before inserting the new JTI, it will clean up any existing JTIs that have
+// expired as those tokens can not be replayed due to the expiry.
+func (c *ClientManager) SetClientAssertionJWT(ctx context.Context, jti string, exp time.Time) (err error) {
+	// delete expired JTIs
+	err = c.DeniedJTIs.DeleteBefore(ctx, timeNow(c.Clock).Unix())
+	if err != nil && err != fosite.ErrNotFound {
+		// Note: If no expired JTIs were found, there is nothing to clean up,
+		// but the JTI must still be denied.
+		return err
+	}
+
+	_, err = c.DeniedJTIs.Create(ctx, storage.NewDeniedJTI(jti, exp))
+	if err != nil {
+		switch err {
+		case storage.ErrResourceExists:
+			// found a DeniedJTIs
+			return fosite.ErrJTIKnown
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Update updates an OAuth 2.0 client resource. Clients allowed unknown grant
+// or response types are rejected, see storage.Client.Validate.
+func (c *ClientManager) Update(ctx context.Context, clientID string, updatedClient storage.Client) (result storage.Client, err error) {
+	err = updatedClient.Validate()
+	if err != nil {
+		return result, err
+	}
+
+	// Deny updating the entity Id
+	updatedClient.ID = clientID
+
+	err = c.hooks().BeforeUpdate(ctx, updatedClient)
+	if err != nil {
+		return result, err
+	}
+
+	result, err = c.update(updatedClient)
+	if err != nil {
+		return result, err
+	}
+
+	c.hooks().AfterUpdate(ctx, result)
+	return result, nil
+}
+
+// update stores the updated client over the existing client.
+func (c *ClientManager) update(updatedClient storage.Client) (result storage.Client, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	currentResource, ok := c.clients[updatedClient.ID]
+	if !ok {
+		return result, fosite.ErrNotFound
+	}
+
+	// Update modified time
+	updatedClient.UpdateTime = timeNow(c.Clock).Unix()
+
+	if updatedClient.Extra == nil {
+		// Preserve unmodeled metadata the caller may not be aware of.
+		updatedClient.Extra = currentResource.Extra
+	}
+
+	if updatedClient.Secret == "" {
+		// If the password/hash is blank, set using old hash.
+		updatedClient.Secret = currentResource.Secret
+	}
+
+	if c.StrictClientSecrets {
+		if updatedClient.Public && updatedClient.Secret == currentResource.Secret {
+			// Drop any secret held while the client was confidential.
+			updatedClient.Secret = ""
+		}
+		err = updatedClient.ValidateSecret()
+		if err != nil {
+			return result, err
+		}
+	}
+	// Secret rotation is only managed via RotateSecret.
+	updatedClient.PreviousSecret = currentResource.PreviousSecret
+	updatedClient.PreviousSecretExpiry = currentResource.PreviousSecretExpiry
+
+	c.put(updatedClient)
+
+	return cloneClient(updatedClient), nil
+}
+
+// Migrate is provided solely for the case where you want to migrate clients and
+// upgrade their password using the AuthClientMigrator interface.
+// This performs an upsert, either creating or overwriting the record with the
+// newly provided full record. Use with caution, be secure, don't be dumb.
+// Clients allowed unknown grant or response types are rejected, see
+// storage.Client.Validate. BeforeCreate, or BeforeUpdate if the client
+// exists, is called with the migrated client, including its already hashed
+// secret.
+func (c *ClientManager) Migrate(ctx context.Context, migratedClient storage.Client) (result storage.Client, err error) {
+	err = migratedClient.Validate()
+	if err != nil {
+		return result, err
+	}
+
+	// Generate a unique ID if not supplied
+	if migratedClient.ID == "" {
+		migratedClient.ID = generateID(c.IDGenerator)
+	}
+	// Update create time
+	if migratedClient.CreateTime == 0 {
+		migratedClient.CreateTime = timeNow(c.Clock).Unix()
+	} else {
+		// Update modified time
+		migratedClient.UpdateTime = timeNow(c.Clock).Unix()
+	}
+
+	c.mutex.RLock()
+	existing, found := c.clients[migratedClient.ID]
+	c.mutex.RUnlock()
+
+	if migratedClient.Extra == nil {
+		// Preserve unmodeled metadata the migration source may not be aware
+		// of.
+		migratedClient.Extra = existing.Extra
+	}
+
+	if found {
+		err = c.hooks().BeforeUpdate(ctx, migratedClient)
+	} else {
+		err = c.hooks().BeforeCreate(ctx, migratedClient)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	c.mutex.Lock()
+	c.put(migratedClient)
+	c.mutex.Unlock()
+
+	result = cloneClient(migratedClient)
+	if found {
+		c.hooks().AfterUpdate(ctx, result)
+	} else {
+		c.hooks().AfterCreate(ctx, result)
+	}
+	return result, nil
+}
+
+// Delete removes an OAuth 2.0 Client resource.
+func (c *ClientManager) Delete(ctx context.Context, clientID string) (err error) {
+	err = c.hooks().BeforeDelete(ctx, clientID)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	_, exists := c.clients[clientID]
+	delete(c.clients, clientID)
+	c.mutex.Unlock()
+
+	if !exists {
+		return fosite.ErrNotFound
+	}
+
+	c.hooks().AfterDelete(ctx, clientID)
+	return nil
+}
+
+// Authenticate verifies the identity of a client resource. A missing client
+// and a wrong secret are both reported as storage.ErrInvalidCredentials, as is
+// a wrong secret for a disabled client, which is otherwise denied.
+func (c *ClientManager) Authenticate(ctx context.Context, clientID string, secret string) (result storage.Client, err error) {
+	client, err := c.getConcrete(clientID)
+	if err != nil {
+		if err == fosite.ErrNotFound {
+			c.decoy.compare(ctx, c.Hasher, secret)
+			return result, storage.ErrInvalidCredentials
+		}
+		return result, err
+	}
+
+	// Public clients don't have a secret, therefore are authenticated
+	// implicitly.
+	if !client.Public && !c.compareSecret(ctx, client, secret) {
+		return result, storage.ErrInvalidCredentials
+	}
+
+	// Deny disabled clients only once the secret has been verified, so a
+	// client's state isn't revealed without it.
+	if client.Disabled {
+		return result, fosite.ErrAccessDenied
+	}
+
+	return client, nil
+}
+
+// compareSecret reports whether the secret matches the client's secret, or a
+// rotated secret within its overlap window.
+func (c *ClientManager) compareSecret(ctx context.Context, client storage.Client, secret string) bool {
+	if c.Hasher.Compare(ctx, client.GetHashedSecret(), []byte(secret)) == nil {
+		return true
+	}
+
+	// Accept a rotated secret until its overlap window expires.
+	for _, hash := range client.RotatedHashes(timeNow(c.Clock)) {
+		if c.Hasher.Compare(ctx, hash, []byte(secret)) == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RotateSecret replaces the client's secret with the hash of the provided
+// cleartext secret. The previous secret continues to authenticate the client
+// until the overlap has elapsed, giving deployments time to move over to the
+// new secret. A zero overlap invalidates the previous secret immediately.
+func (c *ClientManager) RotateSecret(ctx context.Context, clientID string, secret string, overlap time.Duration) (result storage.Client, err error) {
+	hash, err := c.Hasher.Hash(ctx, []byte(secret))
+	if err != nil {
+		return result, err
+	}
+	now := timeNow(c.Clock)
+
+	return c.setFields(clientID, func(client *storage.Client) {
+		client.PreviousSecret, client.PreviousSecretExpiry = "", 0
+		if overlap > 0 {
+			client.PreviousSecret = client.Secret
+			client.PreviousSecretExpiry = now.Add(overlap).Unix()
+		}
+		client.Secret = string(hash)
+	})
+}
+
+// AuthenticateMigration is provided to authenticate clients that have been
+// migrated from a system that may use a different underlying hashing
+// mechanism.
+// It authenticates a Client first by using the provided AuthClientFunc which,
+// if fails, will otherwise try to authenticate using the configured
+// fosite.hasher.
+// As with Authenticate, a missing client and a wrong secret are both reported
+// as storage.ErrInvalidCredentials, and a disabled client is denied only once
+// the secret has been verified.
+func (c *ClientManager) AuthenticateMigration(ctx context.Context, currentAuth storage.AuthClientFunc, clientID string, secret string) (result storage.Client, err error) {
+	// Authenticate with old Hasher
+	client, authenticated := currentAuth(ctx)
+
+	// Check for client not found
+	if client.IsEmpty() && !authenticated {
+		c.decoy.compare(ctx, c.Hasher, secret)
+		return result, storage.ErrInvalidCredentials
+	}
+
+	// Public clients don't have a secret, therefore are authenticated
+	// implicitly.
+	if !client.Public && !authenticated {
+		// If client isn't authenticated, try authenticating with new Hasher.
+		err := c.Hasher.Compare(ctx, client.GetHashedSecret(), []byte(secret))
+		if err != nil {
+			return result, storage.ErrInvalidCredentials
+		}
+	}
+
+	// Deny disabled clients only once the secret has been verified, so a
+	// client's state isn't revealed without it.
+	if client.Disabled {
+		return result, fosite.ErrAccessDenied
+	}
+
+	if client.Public || !authenticated {
+		return client, nil
+	}
+
+	// If the client is found and authenticated, create a new hash using the new
+	// Hasher, update the stored record and return the record with no error.
+	newHash, err := c.Hasher.Hash(ctx, []byte(secret))
+	if err != nil {
+		return result, err
+	}
+
+	// Save the new hash
+	client.UpdateTime = timeNow(c.Clock).Unix()
+	client.Secret = string(newHash)
+
+	return c.Update(ctx, clientID, client)
+}
+
+// GrantScopes grants the provided scopes to the specified Client resource.
+func (c *ClientManager) GrantScopes(_ context.Context, clientID string, scopes []string) (result storage.Client, err error) {
+	return c.setFields(clientID, func(client *storage.Client) {
+		client.EnableScopeAccess(scopes...)
+	})
+}
+
+// GrantScopesToMany grants the provided scopes to each of the specified Client
+// resources.
+func (c *ClientManager) GrantScopesToMany(_ context.Context, clientIDs []string, scopes []string) (err error) {
+	if len(scopes) == 0 {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := timeNow(c.Clock).Unix()
+	for _, clientID := range clientIDs {
+		client, ok := c.clients[clientID]
+		if !ok {
+			continue
+		}
+
+		client = cloneClient(client)
+		client.EnableScopeAccess(scopes...)
+		client.UpdateTime = now
+		c.put(client)
+	}
+
+	return nil
+}
+
+// RemoveScopes revokes the provided scopes from the specified Client resource.
+func (c *ClientManager) RemoveScopes(_ context.Context, clientID string, scopes []string) (result storage.Client, err error) {
+	return c.setFields(clientID, func(client *storage.Client) {
+		client.DisableScopeAccess(scopes...)
+	})
+}
+
+// RemoveAllScopes revokes every scope from the specified Client resource.
+func (c *ClientManager) RemoveAllScopes(_ context.Context, clientID string) (result storage.Client, err error) {
+	return c.setFields(clientID, func(client *storage.Client) {
+		client.Scopes = []string{}
+	})
+}
+
+// Disable prevents the specified Client resource from authenticating.
+func (c *ClientManager) Disable(_ context.Context, clientID string) (result storage.Client, err error) {
+	return c.setFields(clientID, func(client *storage.Client) {
+		client.Disabled = true
+	})
+}
+
+// Enable allows a previously disabled Client resource to authenticate again.
+func (c *ClientManager) Enable(_ context.Context, clientID string) (result storage.Client, err error) {
+	return c.setFields(clientID, func(client *storage.Client) {
+		client.Disabled = false
+	})
+}
+
+// GetClientAssertionKey returns the client's public key matching the key ID,
+// in order to verify the signature of a private_key_jwt client assertion.
+//
+// The assertion's JTI is checked first, so fosite.ErrJTIKnown is returned for
+// replayed assertions before looking up the key. Returns fosite.ErrNotFound if
+// the client doesn't have a key with the key ID.
+func (c *ClientManager) GetClientAssertionKey(ctx context.Context, clientID string, keyID string, jti string) (key *jose.JSONWebKey, err error) {
+	err = c.ClientAssertionJWTValid(ctx, jti)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := c.getConcrete(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	if client.Disabled {
+		return nil, fosite.ErrAccessDenied
+	}
+
+	if client.JSONWebKeys == nil {
+		return nil, fosite.ErrNotFound
+	}
+
+	keys := client.JSONWebKeys.Key(keyID)
+	if len(keys) == 0 {
+		return nil, fosite.ErrNotFound
+	}
+
+	return &keys[0], nil
+}
+
+func (c *ClientManager) IsJWTUsed(ctx context.Context, jti string) (bool, error) {
+	err := c.ClientAssertionJWTValid(ctx, jti)
+	if err != nil {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (c *ClientManager) MarkJWTUsedForTime(ctx context.Context, jti string, exp time.Time) error {
+	return c.SetClientAssertionJWT(ctx, jti, exp)
+}
@@ -0,0 +1,165 @@
+package memory
+
+import (
+	// Standard Library Imports
+	"net/url"
+	"strings"
+
+	// External Imports
+	"github.com/go-jose/go-jose/v3"
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// Resources are copied on the way in and on the way out of the store, so that
+// callers mutating a resource don't alter the stored copy, matching the
+// isolation provided by a database.
+
+// cloneStrings returns a copy of the slice, preserving whether it is nil.
+func cloneStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+
+	return append([]string{}, s...)
+}
+
+// cloneArguments returns a copy of the arguments, preserving whether they are
+// nil.
+func cloneArguments(a fosite.Arguments) fosite.Arguments {
+	if a == nil {
+		return nil
+	}
+
+	return append(fosite.Arguments{}, a...)
+}
+
+// cloneClient returns a deep copy of the client.
+func cloneClient(c storage.Client) storage.Client {
+	c.AllowedAudiences = cloneStrings(c.AllowedAudiences)
+	c.AllowedRegions = cloneStrings(c.AllowedRegions)
+	c.AllowedTenantAccess = cloneStrings(c.AllowedTenantAccess)
+	c.GrantTypes = cloneStrings(c.GrantTypes)
+	c.ResponseTypes = cloneStrings(c.ResponseTypes)
+	c.Scopes = cloneStrings(c.Scopes)
+	c.RedirectURIs = cloneStrings(c.RedirectURIs)
+	c.AllowedCORSOrigins = cloneStrings(c.AllowedCORSOrigins)
+	c.Contacts = cloneStrings(c.Contacts)
+
+	if c.JSONWebKeys != nil {
+		c.JSONWebKeys = &jose.JSONWebKeySet{
+			Keys: append([]jose.JSONWebKey{}, c.JSONWebKeys.Keys...),
+		}
+	}
+
+	if c.Extra != nil {
+		extra := make(map[string]interface{}, len(c.Extra))
+		for key, value := range c.Extra {
+			extra[key] = value
+		}
+		c.Extra = extra
+	}
+
+	return c
+}
+
+// cloneUser returns a deep copy of the user.
+func cloneUser(u storage.User) storage.User {
+	u.AllowedTenantAccess = cloneStrings(u.AllowedTenantAccess)
+	u.AllowedPersonAccess = cloneStrings(u.AllowedPersonAccess)
+	u.Scopes = cloneStrings(u.Scopes)
+	u.Roles = cloneStrings(u.Roles)
+	u.RecoveryCodes = cloneStrings(u.RecoveryCodes)
+
+	return u
+}
+
+// cloneRequest returns a deep copy of the request.
+func cloneRequest(r storage.Request) storage.Request {
+	r.RequestedScope = cloneArguments(r.RequestedScope)
+	r.GrantedScope = cloneArguments(r.GrantedScope)
+	r.RequestedAudience = cloneArguments(r.RequestedAudience)
+	r.GrantedAudience = cloneArguments(r.GrantedAudience)
+
+	if r.Form != nil {
+		form := make(url.Values, len(r.Form))
+		for key, values := range r.Form {
+			form[key] = cloneStrings(values)
+		}
+		r.Form = form
+	}
+
+	if r.Confirmation != nil {
+		confirmation := *r.Confirmation
+		r.Confirmation = &confirmation
+	}
+
+	if r.Claims != nil {
+		claims := make(map[string]interface{}, len(r.Claims))
+		for key, value := range r.Claims {
+			claims[key] = value
+		}
+		r.Claims = claims
+	}
+
+	if r.Session != nil {
+		r.Session = append([]byte{}, r.Session...)
+	}
+
+	return r
+}
+
+// cloneConsent returns a deep copy of the consent.
+func cloneConsent(c storage.Consent) storage.Consent {
+	c.Scopes = cloneStrings(c.Scopes)
+	c.Audience = cloneStrings(c.Audience)
+
+	return c
+}
+
+// contains returns whether the slice contains the item.
+func contains(s []string, item string) bool {
+	for i := range s {
+		if s[i] == item {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsAll returns whether the slice contains every one of the items.
+func containsAll(s []string, items []string) bool {
+	for i := range items {
+		if !contains(s, items[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// containsAny returns whether the slice contains at least one of the items.
+func containsAny(s []string, items []string) bool {
+	for i := range items {
+		if contains(s, items[i]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsPrefix returns whether the slice contains an item beginning with the
+// prefix.
+func containsPrefix(s []string, prefix string) bool {
+	for i := range s {
+		if strings.HasPrefix(s[i], prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,101 @@
+package memory
+
+import (
+	// Standard Library Imports
+	"context"
+	"sync"
+	"time"
+
+	// External Imports
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// ConsentManager provides an in-memory implementation for remembering the
+// scopes a user has consented to for a given client.
+//
+// Implements:
+// - storage.Configure
+// - storage.ConsentStore
+// - storage.ConsentManager
+type ConsentManager struct {
+	noopConfigure
+
+	// Clock provides the current time. Defaults to time.Now if not set.
+	Clock func() time.Time
+
+	mutex    sync.RWMutex
+	consents map[consentKey]storage.Consent
+}
+
+// consentKey uniquely identifies the consent a user has given to a client.
+type consentKey struct {
+	userID   string
+	clientID string
+}
+
+// SaveConsent creates a consent resource, or overwrites the existing consent
+// resource, for the given user and client.
+func (c *ConsentManager) SaveConsent(_ context.Context, userID string, clientID string, scopes []string, audience []string, expiresAt int64) (result storage.Consent, err error) {
+	if scopes == nil {
+		scopes = []string{}
+	}
+	if audience == nil {
+		audience = []string{}
+	}
+	now := timeNow(c.Clock).Unix()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := consentKey{userID: userID, clientID: clientID}
+	consent, ok := c.consents[key]
+	if !ok {
+		consent = storage.Consent{
+			UserID:     userID,
+			ClientID:   clientID,
+			CreateTime: now,
+		}
+	}
+	consent.UpdateTime = now
+	consent.Scopes = scopes
+	consent.Audience = audience
+	consent.ExpiresAt = expiresAt
+
+	if c.consents == nil {
+		c.consents = map[consentKey]storage.Consent{}
+	}
+	c.consents[key] = cloneConsent(consent)
+
+	return cloneConsent(consent), nil
+}
+
+// GetConsent returns the consent resource for the given user and client.
+// Consent that has expired is reported as not found.
+func (c *ConsentManager) GetConsent(_ context.Context, userID string, clientID string) (result storage.Consent, err error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	consent, ok := c.consents[consentKey{userID: userID, clientID: clientID}]
+	if !ok || consent.IsExpired(timeNow(c.Clock)) {
+		return result, fosite.ErrNotFound
+	}
+
+	return cloneConsent(consent), nil
+}
+
+// RevokeConsent removes the consent resource for the given user and client.
+func (c *ConsentManager) RevokeConsent(_ context.Context, userID string, clientID string) (err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := consentKey{userID: userID, clientID: clientID}
+	if _, ok := c.consents[key]; !ok {
+		return fosite.ErrNotFound
+	}
+	delete(c.consents, key)
+
+	return nil
+}
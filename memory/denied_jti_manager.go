@@ -0,0 +1,181 @@
+package memory
+
+import (
+	// Standard Library Imports
+	"context"
+	"sync"
+	"time"
+
+	// External Imports
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// DeniedJTIManager provides an in-memory implementation for denying JSON Web
+// Tokens (JWTs) by ID.
+//
+// Implements:
+// - storage.Configure
+// - storage.DeniedJTIStore
+// - storage.DeniedJTIManager
+type DeniedJTIManager struct {
+	noopConfigure
+
+	// Clock provides the current time. Defaults to time.Now if not set.
+	Clock func() time.Time
+
+	mutex      sync.RWMutex
+	deniedJTIs map[string]storage.DeniedJTI
+}
+
+// Create stores a new denied jti resource, keyed on the JTI's normalized
+// signature, and returns the newly created denied jti resource.
+func (d *DeniedJTIManager) Create(_ context.Context, deniedJTI storage.DeniedJTI) (result storage.DeniedJTI, err error) {
+	deniedJTI = deniedJTI.Normalize()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, ok := d.deniedJTIs[deniedJTI.Signature]; ok {
+		return result, storage.ErrResourceExists
+	}
+
+	if d.deniedJTIs == nil {
+		d.deniedJTIs = map[string]storage.DeniedJTI{}
+	}
+	d.deniedJTIs[deniedJTI.Signature] = deniedJTI
+
+	return deniedJTI, nil
+}
+
+// Get returns the specified denied jti resource.
+func (d *DeniedJTIManager) Get(_ context.Context, jti string) (result storage.DeniedJTI, err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	deniedJTI, ok := d.deniedJTIs[storage.SignatureFromJTI(jti)]
+	if !ok {
+		return result, fosite.ErrNotFound
+	}
+
+	// The JTI itself isn't stored, only its signature.
+	deniedJTI.JTI = ""
+	return deniedJTI, nil
+}
+
+// Delete removes the specified denied jti resource.
+func (d *DeniedJTIManager) Delete(_ context.Context, jti string) (err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	signature := storage.SignatureFromJTI(jti)
+	if _, ok := d.deniedJTIs[signature]; !ok {
+		return fosite.ErrNotFound
+	}
+	delete(d.deniedJTIs, signature)
+
+	return nil
+}
+
+// CreateMany denies a batch of JTIs, skipping any that are already denied.
+// Returns the number of JTIs newly denied.
+func (d *DeniedJTIManager) CreateMany(_ context.Context, deniedJTIs []storage.DeniedJTI) (inserted int, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.deniedJTIs == nil {
+		d.deniedJTIs = map[string]storage.DeniedJTI{}
+	}
+
+	for _, deniedJTI := range deniedJTIs {
+		deniedJTI = deniedJTI.Normalize()
+		if _, ok := d.deniedJTIs[deniedJTI.Signature]; ok {
+			continue
+		}
+
+		d.deniedJTIs[deniedJTI.Signature] = deniedJTI
+		inserted++
+	}
+
+	return inserted, nil
+}
+
+// DeleteMany removes a batch of denied JTIs. Returns not found if none of the
+// JTIs were denied.
+func (d *DeniedJTIManager) DeleteMany(_ context.Context, jtis []string) (err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	deleted := 0
+	for _, jti := range jtis {
+		signature := storage.SignatureFromJTI(jti)
+		if _, ok := d.deniedJTIs[signature]; ok {
+			delete(d.deniedJTIs, signature)
+			deleted++
+		}
+	}
+
+	if deleted == 0 {
+		return fosite.ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteBefore removes all JTIs before the given time. Returns not found if
+// no tokens were found before the given time.
+func (d *DeniedJTIManager) DeleteBefore(_ context.Context, expBefore int64) (err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	deleted := 0
+	for signature, deniedJTI := range d.deniedJTIs {
+		if deniedJTI.Expiry < expBefore {
+			delete(d.deniedJTIs, signature)
+			deleted++
+		}
+	}
+
+	if deleted == 0 {
+		return fosite.ErrNotFound
+	}
+
+	return nil
+}
+
+// PurgeExpired removes all JTIs which have expired, returning the number of
+// JTIs removed. Unlike DeleteBefore, purging an already compact denylist
+// isn't an error.
+func (d *DeniedJTIManager) PurgeExpired(_ context.Context) (deleted int64, err error) {
+	now := timeNow(d.Clock).Unix()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for signature, deniedJTI := range d.deniedJTIs {
+		if deniedJTI.Expiry < now {
+			delete(d.deniedJTIs, signature)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// CountActive returns the number of JTIs which are yet to expire.
+func (d *DeniedJTIManager) CountActive(_ context.Context) (count int64, err error) {
+	now := timeNow(d.Clock).Unix()
+
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	for _, deniedJTI := range d.deniedJTIs {
+		if deniedJTI.Expiry >= now {
+			count++
+		}
+	}
+
+	return count, nil
+}
@@ -0,0 +1,82 @@
+package memory
+
+import (
+	// Standard Library Imports
+	"context"
+	"sync"
+	"time"
+
+	// External Imports
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// IdempotencyManager provides an in-memory implementation for storing and
+// replaying the results of idempotent requests.
+//
+// Implements:
+// - storage.Configure
+// - storage.IdempotencyStore
+// - storage.IdempotencyManager
+type IdempotencyManager struct {
+	noopConfigure
+
+	// Clock provides the current time. Defaults to time.Now if not set.
+	Clock func() time.Time
+
+	mutex   sync.RWMutex
+	results map[idempotencyKey]storage.IdempotentResult
+}
+
+// idempotencyKey identifies a result by the client that stored it and the
+// signature of its key.
+type idempotencyKey struct {
+	clientID  string
+	signature string
+}
+
+// StoreIdempotentResult stores the result of the request made by the client
+// with the key until the ttl elapses. Returns storage.ErrInvalidTTL if the ttl
+// isn't positive, and storage.ErrResourceExists if a result has already been
+// stored for the client's key and hasn't expired.
+func (i *IdempotencyManager) StoreIdempotentResult(_ context.Context, clientID string, key string, result []byte, ttl time.Duration) (err error) {
+	if ttl <= 0 {
+		return storage.ErrInvalidTTL
+	}
+
+	now := timeNow(i.Clock)
+	stored := storage.NewIdempotentResult(clientID, key, append([]byte(nil), result...), now.Add(ttl))
+	id := idempotencyKey{clientID: stored.ClientID, signature: stored.Signature}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	// Expired results can be reclaimed.
+	if existing, ok := i.results[id]; ok && existing.ExpiresAt.After(now) {
+		return storage.ErrResourceExists
+	}
+
+	if i.results == nil {
+		i.results = map[idempotencyKey]storage.IdempotentResult{}
+	}
+	i.results[id] = stored
+
+	return nil
+}
+
+// GetIdempotentResult returns the result stored for the client's key. Returns
+// fosite.ErrNotFound if no result has been stored for the client's key, or the
+// result has expired.
+func (i *IdempotencyManager) GetIdempotentResult(_ context.Context, clientID string, key string) (result []byte, err error) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	stored, ok := i.results[idempotencyKey{clientID: clientID, signature: storage.SignatureFromJTI(key)}]
+	if !ok || !stored.ExpiresAt.After(timeNow(i.Clock)) {
+		return nil, fosite.ErrNotFound
+	}
+
+	return append([]byte(nil), stored.Result...), nil
+}
@@ -0,0 +1,174 @@
+package memory
+
+import (
+	// Standard Library Imports
+	"context"
+	"time"
+
+	// External Imports
+	"github.com/google/uuid"
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// Store provides an in-memory storage driver compatible with fosite's required
+// storage interfaces, enabling authorization servers built on this package to
+// be tested without a running mongo instance.
+//
+// The store mirrors the semantics of the mongo store, for example, creating a
+// resource with a duplicate key returns storage.ErrResourceExists and missing
+// resources are reported as fosite.ErrNotFound.
+type Store struct {
+	// Public API
+	Hasher fosite.Hasher
+	storage.Store
+}
+
+// Config defines the configuration parameters of the in-memory store. Each
+// parameter matches the behaviour of its mongo.Config counterpart.
+type Config struct {
+	AllowDisabledClients        bool
+	RequirePKCEForPublicClients bool
+	StrictClientSecrets         bool
+	UniquePersonID              bool
+	MaxFailedLogins             uint32
+	LockoutDuration             time.Duration
+	MaxUserSessions             int64
+	DeleteUsedAuthorizeCodes    bool
+	RefreshTokenGracePeriod     time.Duration
+	FormKeys                    []string
+	RedactedFormKeys            []string
+	Region                      string
+	ClaimsExtractor             func(session fosite.Session) map[string]interface{}
+	ClientHooks                 storage.Hooks[storage.Client]
+	UserHooks                   storage.Hooks[storage.User]
+	RoleScopes                  map[string][]string
+	IDGenerator                 func() string
+	Clock                       func() time.Time
+}
+
+// New returns an in-memory store configured with the provided configuration
+// and hasher. The default configuration is used if cfg is nil, and a low cost
+// BCrypt hasher is used if hasher is nil, in order to keep tests fast.
+func New(cfg *Config, hasher fosite.Hasher) *Store {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	if hasher == nil {
+		// Initialize a fosite Hasher using bcrypt's minimum cost.
+		hasher = &fosite.BCrypt{Config: &fosite.Config{HashCost: 4}}
+	}
+
+	idGenerator := cfg.IDGenerator
+	if idGenerator == nil {
+		idGenerator = uuid.NewString
+	}
+
+	clock := cfg.Clock
+	if clock == nil {
+		clock = time.Now
+	}
+
+	// Build up the in-memory endpoints
+	deniedJTIs := &DeniedJTIManager{
+		Clock: clock,
+	}
+	clients := &ClientManager{
+		Hasher:      hasher,
+		IDGenerator: idGenerator,
+		Clock:       clock,
+
+		AllowDisabledClients:        cfg.AllowDisabledClients,
+		RequirePKCEForPublicClients: cfg.RequirePKCEForPublicClients,
+		StrictClientSecrets:         cfg.StrictClientSecrets,
+		Hooks:                       cfg.ClientHooks,
+
+		DeniedJTIs: deniedJTIs,
+	}
+	users := &UserManager{
+		Hasher:      hasher,
+		IDGenerator: idGenerator,
+		Clock:       clock,
+
+		UniquePersonID:  cfg.UniquePersonID,
+		Hooks:           cfg.UserHooks,
+		RoleScopes:      cfg.RoleScopes,
+		MaxFailedLogins: cfg.MaxFailedLogins,
+		LockoutDuration: cfg.LockoutDuration,
+	}
+	consents := &ConsentManager{
+		Clock: clock,
+	}
+	nonces := &NonceManager{
+		Clock: clock,
+	}
+	idempotency := &IdempotencyManager{
+		Clock: clock,
+	}
+	requests := &RequestManager{
+		Clients: clients,
+		Users:   users,
+
+		IDGenerator:     idGenerator,
+		Clock:           clock,
+		MaxUserSessions: cfg.MaxUserSessions,
+		Region:          cfg.Region,
+
+		DeleteUsedAuthorizeCodes: cfg.DeleteUsedAuthorizeCodes,
+		RefreshTokenGracePeriod:  cfg.RefreshTokenGracePeriod,
+		FormKeys:                 cfg.FormKeys,
+		RedactedFormKeys:         cfg.RedactedFormKeys,
+		ClaimsExtractor:          cfg.ClaimsExtractor,
+	}
+
+	return &Store{
+		Hasher: hasher,
+		Store: storage.Store{
+			ClientManager:      clients,
+			ConsentManager:     consents,
+			DeniedJTIManager:   deniedJTIs,
+			IdempotencyManager: idempotency,
+			NonceManager:       nonces,
+			RequestManager:     requests,
+			UserManager:        users,
+		},
+	}
+}
+
+// NewDefaultStore returns a Store configured with the default configuration
+// and a low cost BCrypt hasher.
+func NewDefaultStore() *Store {
+	return New(nil, nil)
+}
+
+// noopConfigure provides a storage.Configure implementation for managers that
+// have nothing to configure.
+type noopConfigure struct{}
+
+// Configure implements storage.Configure.
+func (noopConfigure) Configure(_ context.Context) error {
+	return nil
+}
+
+// generateID returns a new ID from the provided generator, falling back to a
+// UUID if no generator has been provided.
+func generateID(generator func() string) string {
+	if generator == nil {
+		return uuid.NewString()
+	}
+
+	return generator()
+}
+
+// timeNow returns the current time from the provided clock, falling back to
+// the system clock if no clock has been provided.
+func timeNow(clock func() time.Time) time.Time {
+	if clock == nil {
+		return time.Now()
+	}
+
+	return clock()
+}
@@ -0,0 +1,58 @@
+package memory
+
+import (
+	// Standard Library Imports
+	"testing"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+func TestClientManager_ImplementsStorageClientManager(t *testing.T) {
+	var i interface{} = &ClientManager{}
+	if _, ok := i.(storage.ClientManager); !ok {
+		t.Error("ClientManager does not implement interface storage.ClientManager")
+	}
+}
+
+func TestConsentManager_ImplementsStorageConsentManager(t *testing.T) {
+	var i interface{} = &ConsentManager{}
+	if _, ok := i.(storage.ConsentManager); !ok {
+		t.Error("ConsentManager does not implement interface storage.ConsentManager")
+	}
+}
+
+func TestDeniedJTIManager_ImplementsStorageDeniedJTIManager(t *testing.T) {
+	var i interface{} = &DeniedJTIManager{}
+	if _, ok := i.(storage.DeniedJTIManager); !ok {
+		t.Error("DeniedJTIManager does not implement interface storage.DeniedJTIManager")
+	}
+}
+
+func TestIdempotencyManager_ImplementsStorageIdempotencyManager(t *testing.T) {
+	var i interface{} = &IdempotencyManager{}
+	if _, ok := i.(storage.IdempotencyManager); !ok {
+		t.Error("IdempotencyManager does not implement interface storage.IdempotencyManager")
+	}
+}
+
+func TestNonceManager_ImplementsStorageNonceManager(t *testing.T) {
+	var i interface{} = &NonceManager{}
+	if _, ok := i.(storage.NonceManager); !ok {
+		t.Error("NonceManager does not implement interface storage.NonceManager")
+	}
+}
+
+func TestRequestManager_ImplementsStorageRequestManager(t *testing.T) {
+	var i interface{} = &RequestManager{}
+	if _, ok := i.(storage.RequestManager); !ok {
+		t.Error("RequestManager does not implement interface storage.RequestManager")
+	}
+}
+
+func TestUserManager_ImplementsStorageUserManager(t *testing.T) {
+	var i interface{} = &UserManager{}
+	if _, ok := i.(storage.UserManager); !ok {
+		t.Error("UserManager does not implement interface storage.UserManager")
+	}
+}
@@ -0,0 +1,611 @@
+package memory_test
+
+import (
+	// Standard Library Imports
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	// External Imports
+	"github.com/google/uuid"
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/compose"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+	"github.com/p000ic/go-fosite-mongo/memory"
+	"github.com/p000ic/go-fosite-mongo/storagetest"
+)
+
+func TestStore_Conformance(t *testing.T) {
+	storagetest.RunStoreConformance(t, memory.NewDefaultStore().Store)
+}
+
+func TestRequestManager_InvalidateAuthorizeCodeSession_ShouldDeleteUsedCodes(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New(&memory.Config{DeleteUsedAuthorizeCodes: true}, nil)
+
+	client, err := store.ClientManager.Create(ctx, storage.Client{ID: uuid.NewString(), Secret: "foobar"})
+	if err != nil {
+		t.Fatalf("create client should return no errors, got: %v", err)
+	}
+
+	request := fosite.NewRequest()
+	request.ID = uuid.NewString()
+	request.Client = &storage.Client{ID: client.ID}
+	request.Session = &fosite.DefaultSession{Subject: uuid.NewString()}
+	code := uuid.NewString()
+	err = store.CreateAuthorizeCodeSession(ctx, code, request)
+	if err != nil {
+		t.Fatalf("create authorize code session should return no errors, got: %v", err)
+	}
+
+	err = store.InvalidateAuthorizeCodeSession(ctx, code)
+	if err != nil {
+		t.Fatalf("invalidate authorize code session should return no errors, got: %v", err)
+	}
+
+	_, err = store.GetAuthorizeCodeSession(ctx, code, &fosite.DefaultSession{})
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get used authorize code session should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+
+	err = store.InvalidateAuthorizeCodeSession(ctx, code)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("invalidate used authorize code session should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+}
+
+func TestRequestManager_GetRefreshTokenSessionEx_ShouldReportRotationState(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := memory.New(&memory.Config{
+		RefreshTokenGracePeriod: time.Minute,
+		Clock:                   func() time.Time { return now },
+	}, nil)
+
+	client, err := store.ClientManager.Create(ctx, storage.Client{ID: uuid.NewString(), Secret: "foobar"})
+	if err != nil {
+		t.Fatalf("create client should return no errors, got: %v", err)
+	}
+
+	request := fosite.NewRequest()
+	request.ID = uuid.NewString()
+	request.Client = &storage.Client{ID: client.ID}
+	request.Session = &fosite.DefaultSession{Subject: uuid.NewString()}
+	signature := uuid.NewString()
+	err = store.CreateRefreshTokenSession(ctx, signature, request)
+	if err != nil {
+		t.Fatalf("create refresh token session should return no errors, got: %v", err)
+	}
+
+	_, state, err := store.GetRefreshTokenSessionEx(ctx, signature, &fosite.DefaultSession{})
+	if err != nil {
+		t.Fatalf("get refresh token session should return no errors, got: %v", err)
+	}
+	if state != storage.RefreshTokenCurrent {
+		t.Errorf("unused refresh token should be current, got: %v, want: %v", state, storage.RefreshTokenCurrent)
+	}
+
+	err = store.RevokeRefreshTokenMaybeGracePeriod(ctx, request.ID, signature)
+	if err != nil {
+		t.Fatalf("revoke refresh token should return no errors, got: %v", err)
+	}
+
+	now = now.Add(30 * time.Second)
+	_, state, err = store.GetRefreshTokenSessionEx(ctx, signature, &fosite.DefaultSession{})
+	if err != nil {
+		t.Fatalf("get refresh token session should return no errors, got: %v", err)
+	}
+	if state != storage.RefreshTokenGrace {
+		t.Errorf("used refresh token should be within its grace period, got: %v, want: %v", state, storage.RefreshTokenGrace)
+	}
+
+	now = now.Add(time.Minute)
+	_, state, err = store.GetRefreshTokenSessionEx(ctx, signature, &fosite.DefaultSession{})
+	if err != nil {
+		t.Fatalf("get refresh token session should return no errors, got: %v", err)
+	}
+	if state != storage.RefreshTokenReused {
+		t.Errorf("used refresh token past its grace period should be reused, got: %v, want: %v", state, storage.RefreshTokenReused)
+	}
+
+	_, err = store.GetRefreshTokenSession(ctx, signature, &fosite.DefaultSession{})
+	if !errors.Is(err, fosite.ErrInactiveToken) {
+		t.Errorf("reused refresh token should be inactive, got: %v, want: %v", err, fosite.ErrInactiveToken)
+	}
+}
+
+func TestRequestManager_RefreshTokenGrant_ShouldRotateWithinGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New(&memory.Config{RefreshTokenGracePeriod: time.Minute}, nil)
+
+	client, err := store.ClientManager.Create(ctx, storage.Client{
+		ID:         uuid.NewString(),
+		Public:     true,
+		GrantTypes: []string{"refresh_token"},
+		Scopes:     []string{"offline"},
+	})
+	if err != nil {
+		t.Fatalf("create client should return no errors, got: %v", err)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key should return no errors, got: %v", err)
+	}
+	config := &fosite.Config{
+		GlobalSecret: []byte("some-super-cool-secret-that-nobody-knows"),
+	}
+	provider := compose.ComposeAllEnabled(config, store, key)
+
+	request := fosite.NewRequest()
+	request.ID = uuid.NewString()
+	request.Client = &storage.Client{ID: client.ID}
+	request.Session = &fosite.DefaultSession{Subject: uuid.NewString()}
+	request.GrantScope("offline")
+	token, signature, err := compose.NewOAuth2HMACStrategy(config).GenerateRefreshToken(ctx, request)
+	if err != nil {
+		t.Fatalf("generate refresh token should return no errors, got: %v", err)
+	}
+	err = store.CreateRefreshTokenSession(ctx, signature, request)
+	if err != nil {
+		t.Fatalf("create refresh token session should return no errors, got: %v", err)
+	}
+
+	refresh := func(refreshToken string) string {
+		form := url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {refreshToken},
+			"client_id":     {client.ID},
+		}
+		req := httptest.NewRequest(http.MethodPost, "/oauth2/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		accessRequest, err := provider.NewAccessRequest(ctx, req, &fosite.DefaultSession{})
+		if err != nil {
+			t.Fatalf("refresh token grant should be accepted, got: %v", err)
+		}
+		response, err := provider.NewAccessResponse(ctx, accessRequest)
+		if err != nil {
+			t.Fatalf("refresh token grant should rotate the refresh token, got: %v", err)
+		}
+
+		rotated, _ := response.GetExtra("refresh_token").(string)
+		if rotated == "" || rotated == refreshToken {
+			t.Fatalf("refresh token grant should issue a new refresh token, got: %q", rotated)
+		}
+		return rotated
+	}
+
+	rotated := refresh(token)
+	refresh(rotated)
+
+	// The original token is still within its grace period, so can be retried,
+	// for example, if the rotated token was lost in transit.
+	refresh(token)
+
+	err = store.RevokeRefreshToken(ctx, request.ID)
+	if err != nil {
+		t.Fatalf("revoke refresh token should return no errors, got: %v", err)
+	}
+	got, err := store.RequestManager.List(ctx, storage.EntityRefreshTokens, storage.ListRequestsRequest{ClientID: client.ID})
+	if err != nil {
+		t.Fatalf("list should return no errors, got: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("revoke refresh token should delete every refresh token issued under the request, got: %d, want: %d", len(got), 0)
+	}
+}
+
+func TestRequestManager_RedactedFormKeys_ShouldNotStoreRedactedKeys(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New(&memory.Config{RedactedFormKeys: []string{"client_secret", "code_verifier"}}, nil)
+
+	client, err := store.ClientManager.Create(ctx, storage.Client{ID: uuid.NewString(), Secret: "foobar"})
+	if err != nil {
+		t.Fatalf("create client should return no errors, got: %v", err)
+	}
+
+	request := fosite.NewRequest()
+	request.ID = uuid.NewString()
+	request.Client = &storage.Client{ID: client.ID}
+	request.Session = &fosite.DefaultSession{Subject: uuid.NewString()}
+	request.Form.Set("grant_type", "authorization_code")
+	request.Form.Set("client_secret", "foobar")
+	request.Form.Set("code_verifier", uuid.NewString())
+	signature := uuid.NewString()
+	err = store.CreateAccessTokenSession(ctx, signature, request)
+	if err != nil {
+		t.Fatalf("create access token session should return no errors, got: %v", err)
+	}
+
+	if request.Form.Get("client_secret") == "" {
+		t.Errorf("redacting the stored form should leave the request's form untouched")
+	}
+
+	requests, err := store.RequestManager.List(ctx, storage.EntityAccessTokens, storage.ListRequestsRequest{ClientID: client.ID})
+	if err != nil || len(requests) != 1 {
+		t.Fatalf("list should return the stored request, got: %v, %v", requests, err)
+	}
+	stored := requests[0]
+	for _, key := range []string{"client_secret", "code_verifier"} {
+		if _, ok := stored.Form[key]; ok {
+			t.Errorf("stored form should not hold redacted key %s, got: %v", key, stored.Form)
+		}
+	}
+	if got := stored.Form.Get("grant_type"); got != "authorization_code" {
+		t.Errorf("stored form should hold unredacted keys, got: %v, want: %v", got, "authorization_code")
+	}
+
+	got, err := store.GetAccessTokenSession(ctx, signature, &fosite.DefaultSession{})
+	if err != nil {
+		t.Fatalf("get access token session should return no errors, got: %v", err)
+	}
+	if got.GetSession().GetSubject() != request.GetSession().GetSubject() {
+		t.Errorf("get access token session should hydrate the session, got: %v, want: %v", got.GetSession().GetSubject(), request.GetSession().GetSubject())
+	}
+}
+
+func TestRequestManager_FormKeys_ShouldKeepFormKeysFositeReads(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New(&memory.Config{
+		FormKeys:         []string{"response_type"},
+		RedactedFormKeys: []string{"redirect_uri", "nonce"},
+	}, nil)
+
+	client, err := store.ClientManager.Create(ctx, storage.Client{ID: uuid.NewString(), Secret: "foobar"})
+	if err != nil {
+		t.Fatalf("create client should return no errors, got: %v", err)
+	}
+
+	request := fosite.NewAuthorizeRequest()
+	request.ID = uuid.NewString()
+	request.Client = &storage.Client{ID: client.ID}
+	request.Session = &fosite.DefaultSession{Subject: uuid.NewString()}
+	request.Form.Set("response_type", "code")
+	request.Form.Set("redirect_uri", "https://example.com/callback")
+	request.Form.Set("nonce", uuid.NewString())
+	request.Form.Set("code_challenge", uuid.NewString())
+	request.Form.Set("code_challenge_method", "S256")
+	request.Form.Set("state", uuid.NewString())
+	code := uuid.NewString()
+	err = store.CreateAuthorizeCodeSession(ctx, code, request)
+	if err != nil {
+		t.Fatalf("create authorize code session should return no errors, got: %v", err)
+	}
+
+	got, err := store.GetAuthorizeCodeSession(ctx, code, &fosite.DefaultSession{})
+	if err != nil {
+		t.Fatalf("get authorize code session should return no errors, got: %v", err)
+	}
+	for _, key := range []string{"response_type", "redirect_uri", "nonce", "code_challenge", "code_challenge_method"} {
+		if got.GetRequestForm().Get(key) != request.Form.Get(key) {
+			t.Errorf("stored form should hold %s, got: %v, want: %v", key, got.GetRequestForm().Get(key), request.Form.Get(key))
+		}
+	}
+	if _, ok := got.GetRequestForm()["state"]; ok {
+		t.Errorf("stored form should not hold keys outside of the form keys, got: %v", got.GetRequestForm())
+	}
+}
+
+func TestRequestManager_CreateRefreshTokenSession_ShouldOnlyEvictLiveTokens(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New(&memory.Config{MaxUserSessions: 2, RefreshTokenGracePeriod: time.Minute}, nil)
+
+	clientID := uuid.NewString()
+	subject := uuid.NewString()
+	requestedAt := time.Now().UTC().Round(time.Second).Add(-time.Hour)
+	create := func(i int, expiresAt time.Time) string {
+		request := fosite.NewRequest()
+		request.ID = uuid.NewString()
+		request.RequestedAt = requestedAt.Add(time.Duration(i) * time.Minute)
+		request.Client = &storage.Client{ID: clientID}
+		session := &fosite.DefaultSession{Subject: subject}
+		session.SetExpiresAt(fosite.RefreshToken, expiresAt)
+		request.Session = session
+
+		signature := uuid.NewString()
+		err := store.CreateRefreshTokenSession(ctx, signature, request)
+		if err != nil {
+			t.Fatalf("create refresh token session should return no errors, got: %v", err)
+		}
+		return signature
+	}
+
+	// The oldest tokens are dead, so shouldn't count towards the limit.
+	used := create(0, time.Now().Add(time.Hour))
+	err := store.RevokeRefreshTokenMaybeGracePeriod(ctx, "", used)
+	if err != nil {
+		t.Fatalf("revoke refresh token should return no errors, got: %v", err)
+	}
+	expired := create(1, time.Now().Add(-time.Minute))
+	live := []string{
+		create(2, time.Now().Add(time.Hour)),
+		create(3, time.Now().Add(time.Hour)),
+		create(4, time.Now().Add(time.Hour)),
+	}
+
+	got, err := store.RequestManager.List(ctx, storage.EntityRefreshTokens, storage.ListRequestsRequest{UserID: subject})
+	if err != nil {
+		t.Fatalf("list should return no errors, got: %v", err)
+	}
+	remaining := map[string]bool{}
+	for _, request := range got {
+		remaining[request.Signature] = true
+	}
+	for _, signature := range []string{used, expired} {
+		if !remaining[signature] {
+			t.Errorf("dead refresh tokens should be left to be purged, got: %v", remaining)
+		}
+	}
+	if remaining[live[0]] {
+		t.Errorf("the oldest live refresh token should be evicted, got: %v", remaining)
+	}
+	for _, signature := range live[1:] {
+		if !remaining[signature] {
+			t.Errorf("the newest live refresh tokens should be retained, got: %v", remaining)
+		}
+	}
+}
+
+func TestClientManager_StrictClientSecrets(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New(&memory.Config{StrictClientSecrets: true}, nil)
+
+	_, err := store.ClientManager.Create(ctx, storage.Client{ID: uuid.NewString(), Public: true, Secret: "foobar"})
+	if !errors.Is(err, storage.ErrPublicClientSecret) {
+		t.Errorf("create should reject public clients with a secret, got: %v, want: %v", err, storage.ErrPublicClientSecret)
+	}
+	_, err = store.ClientManager.Create(ctx, storage.Client{ID: uuid.NewString()})
+	if !errors.Is(err, storage.ErrMissingClientSecret) {
+		t.Errorf("create should reject confidential clients without a secret, got: %v, want: %v", err, storage.ErrMissingClientSecret)
+	}
+
+	_, _, err = store.ClientManager.GetOrCreate(ctx, storage.Client{ID: uuid.NewString(), Public: true, Secret: "foobar"})
+	if !errors.Is(err, storage.ErrPublicClientSecret) {
+		t.Errorf("get or create should reject public clients with a secret, got: %v, want: %v", err, storage.ErrPublicClientSecret)
+	}
+
+	public, err := store.ClientManager.Create(ctx, storage.Client{ID: uuid.NewString(), Public: true})
+	if err != nil {
+		t.Fatalf("create should accept public clients without a secret, got: %v", err)
+	}
+	if public.Secret != "" {
+		t.Errorf("public clients should be stored without a secret, got: %q", public.Secret)
+	}
+	confidential, err := store.ClientManager.Create(ctx, storage.Client{ID: uuid.NewString(), Secret: "foobar"})
+	if err != nil {
+		t.Fatalf("create should accept confidential clients with a secret, got: %v", err)
+	}
+
+	public.Secret = "foobar"
+	_, err = store.ClientManager.Update(ctx, public.ID, public)
+	if !errors.Is(err, storage.ErrPublicClientSecret) {
+		t.Errorf("update should reject public clients with a secret, got: %v, want: %v", err, storage.ErrPublicClientSecret)
+	}
+	public.Public = false
+	public.Secret = ""
+	_, err = store.ClientManager.Update(ctx, public.ID, public)
+	if !errors.Is(err, storage.ErrMissingClientSecret) {
+		t.Errorf("update should reject confidential clients without a secret, got: %v, want: %v", err, storage.ErrMissingClientSecret)
+	}
+
+	confidential.Public = true
+	confidential.Secret = ""
+	got, err := store.ClientManager.Update(ctx, confidential.ID, confidential)
+	if err != nil {
+		t.Fatalf("update should accept making a client public, got: %v", err)
+	}
+	if got.Secret != "" {
+		t.Errorf("clients made public should drop their secret, got: %q", got.Secret)
+	}
+}
+
+func TestRequestManager_ListByClaim_ShouldExtractClaims(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New(&memory.Config{
+		ClaimsExtractor: func(session fosite.Session) map[string]interface{} {
+			return map[string]interface{}{
+				"org": session.(*fosite.DefaultSession).Extra["org"],
+			}
+		},
+	}, nil)
+
+	org := uuid.NewString()
+	request := fosite.NewRequest()
+	request.ID = uuid.NewString()
+	request.Client = &storage.Client{ID: uuid.NewString()}
+	request.Session = &fosite.DefaultSession{
+		Subject: uuid.NewString(),
+		Extra:   map[string]interface{}{"org": org},
+	}
+	err := store.CreateAccessTokenSession(ctx, uuid.NewString(), request)
+	if err != nil {
+		t.Fatalf("create access token session should return no errors, got: %v", err)
+	}
+
+	got, err := store.RequestManager.ListByClaim(ctx, storage.EntityAccessTokens, "org", org)
+	if err != nil {
+		t.Fatalf("list by claim should return no errors, got: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != request.ID {
+		t.Errorf("list by claim should return the request the claim was extracted from, got: %+v", got)
+	}
+}
+
+// reservedUsernames vetoes creating, or renaming a user to, a reserved
+// username, recording the users created.
+type reservedUsernames struct {
+	storage.NopHooks[storage.User]
+
+	created []string
+}
+
+var errReservedUsername = errors.New("reserved username")
+
+func (h *reservedUsernames) BeforeCreate(_ context.Context, user storage.User) error {
+	if user.Username == "admin" {
+		return errReservedUsername
+	}
+	return nil
+}
+
+func (h *reservedUsernames) AfterCreate(_ context.Context, user storage.User) {
+	h.created = append(h.created, user.ID)
+}
+
+func (h *reservedUsernames) BeforeUpdate(ctx context.Context, user storage.User) error {
+	return h.BeforeCreate(ctx, user)
+}
+
+func TestUserManager_Hooks_ShouldVetoReservedUsernames(t *testing.T) {
+	ctx := context.Background()
+	hooks := &reservedUsernames{}
+	store := memory.New(&memory.Config{UserHooks: hooks}, nil)
+
+	_, err := store.UserManager.Create(ctx, storage.User{Username: "admin", Password: "foobar"})
+	if !errors.Is(err, errReservedUsername) {
+		t.Errorf("create should be vetoed by the hook, got: %v, want: %v", err, errReservedUsername)
+	}
+	exists, err := store.UserManager.UsernameExists(ctx, "admin")
+	if err != nil || exists {
+		t.Errorf("a vetoed user should not be stored, got: %v, %v", exists, err)
+	}
+	if len(hooks.created) != 0 {
+		t.Errorf("after create should not be called for a vetoed user, got: %v", hooks.created)
+	}
+
+	user, err := store.UserManager.Create(ctx, storage.User{Username: "kilgore", Password: "foobar"})
+	if err != nil {
+		t.Fatalf("create should return no errors, got: %v", err)
+	}
+	if len(hooks.created) != 1 || hooks.created[0] != user.ID {
+		t.Errorf("after create should be called with the created user, got: %v, want: %v", hooks.created, []string{user.ID})
+	}
+
+	user.Username = "admin"
+	_, err = store.UserManager.Update(ctx, user.ID, user)
+	if !errors.Is(err, errReservedUsername) {
+		t.Errorf("update should be vetoed by the hook, got: %v, want: %v", err, errReservedUsername)
+	}
+	got, err := store.UserManager.Get(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("get should return no errors, got: %v", err)
+	}
+	if got.Username != "kilgore" {
+		t.Errorf("a vetoed update should not be stored, got: %q, want: %q", got.Username, "kilgore")
+	}
+	_, err = store.UserManager.Migrate(ctx, user)
+	if !errors.Is(err, errReservedUsername) {
+		t.Errorf("migrate over an existing user should be vetoed by the hook, got: %v, want: %v", err, errReservedUsername)
+	}
+	_, err = store.UserManager.Migrate(ctx, storage.User{Username: "admin"})
+	if !errors.Is(err, errReservedUsername) {
+		t.Errorf("migrate of a new user should be vetoed by the hook, got: %v, want: %v", err, errReservedUsername)
+	}
+	got, err = store.UserManager.Get(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("get should return no errors, got: %v", err)
+	}
+	if got.Username != "kilgore" {
+		t.Errorf("a vetoed migration should not be stored, got: %q, want: %q", got.Username, "kilgore")
+	}
+
+	migrated, err := store.UserManager.Migrate(ctx, storage.User{Username: "trout"})
+	if err != nil {
+		t.Fatalf("migrate should return no errors, got: %v", err)
+	}
+	if len(hooks.created) != 2 || hooks.created[1] != migrated.ID {
+		t.Errorf("after create should be called with the migrated user, got: %v, want: %v", hooks.created, []string{user.ID, migrated.ID})
+	}
+}
+
+func TestUserManager_MaxFailedLogins_ShouldLockOutUsers(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := memory.New(&memory.Config{
+		MaxFailedLogins: 3,
+		LockoutDuration: time.Minute,
+		Clock:           func() time.Time { return now },
+	}, nil)
+
+	user, err := store.UserManager.Create(ctx, storage.User{Username: "kilgore", Password: "foobar"})
+	if err != nil {
+		t.Fatalf("create should return no errors, got: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err = store.UserManager.Authenticate(ctx, "kilgore", "wrong")
+		if !errors.Is(err, storage.ErrInvalidCredentials) {
+			t.Errorf("authenticate with a wrong password should fail, got: %v, want: %v", err, storage.ErrInvalidCredentials)
+		}
+	}
+	got, err := store.UserManager.Authenticate(ctx, "kilgore", "foobar")
+	if err != nil {
+		t.Fatalf("authenticate below the threshold should return no errors, got: %v", err)
+	}
+	if got.FailedLoginCount != 0 {
+		t.Errorf("authenticate should clear the failed login count, got: %d, want: %d", got.FailedLoginCount, 0)
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err = store.UserManager.AuthenticateByID(ctx, user.ID, "wrong")
+		if !errors.Is(err, storage.ErrInvalidCredentials) {
+			t.Errorf("authenticate with a wrong password should fail, got: %v, want: %v", err, storage.ErrInvalidCredentials)
+		}
+	}
+	_, err = store.UserManager.Authenticate(ctx, "kilgore", "foobar")
+	if !errors.Is(err, fosite.ErrAccessDenied) {
+		t.Errorf("authenticate should be denied once the threshold is reached, got: %v, want: %v", err, fosite.ErrAccessDenied)
+	}
+	got, err = store.UserManager.Get(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("get should return no errors, got: %v", err)
+	}
+	if want := now.Add(time.Minute).Unix(); got.LockedUntil != want {
+		t.Errorf("the user should be locked out for the lockout duration, got: %d, want: %d", got.LockedUntil, want)
+	}
+
+	now = now.Add(time.Minute + time.Second)
+	got, err = store.UserManager.Authenticate(ctx, "kilgore", "foobar")
+	if err != nil {
+		t.Fatalf("authenticate once the lockout has ended should return no errors, got: %v", err)
+	}
+	if got.LockedUntil != 0 {
+		t.Errorf("authenticate should clear the ended lockout, got: %d, want: %d", got.LockedUntil, 0)
+	}
+}
+
+func TestIdempotencyManager_GetIdempotentResult_ShouldExpire(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := memory.New(&memory.Config{
+		Clock: func() time.Time { return now },
+	}, nil)
+
+	clientID := uuid.NewString()
+	key := uuid.NewString()
+	err := store.IdempotencyManager.StoreIdempotentResult(ctx, clientID, key, []byte("foo"), time.Minute)
+	if err != nil {
+		t.Fatalf("store idempotent result should return no errors, got: %v", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	_, err = store.IdempotencyManager.GetIdempotentResult(ctx, clientID, key)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get expired idempotent result should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+
+	err = store.IdempotencyManager.StoreIdempotentResult(ctx, clientID, key, []byte("bar"), time.Minute)
+	if err != nil {
+		t.Errorf("storing a result for an expired key should return no errors, got: %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package memory
+
+import (
+	// Standard Library Imports
+	"context"
+	"sync"
+	"time"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// NonceManager provides an in-memory implementation for denying replayed
+// OpenID Connect nonces.
+//
+// Implements:
+// - storage.Configure
+// - storage.NonceStore
+// - storage.NonceManager
+type NonceManager struct {
+	noopConfigure
+
+	// Clock provides the current time. Defaults to time.Now if not set.
+	Clock func() time.Time
+
+	mutex  sync.Mutex
+	nonces map[nonceKey]time.Time
+}
+
+// nonceKey uniquely identifies a nonce used by a client.
+type nonceKey struct {
+	clientID  string
+	signature string
+}
+
+// ConsumeNonce records the nonce as used by the client until it expires.
+// Returns storage.ErrNonceReplayed if the nonce has already been used within
+// its validity window.
+func (n *NonceManager) ConsumeNonce(_ context.Context, clientID string, nonce string, expiresAt time.Time) (err error) {
+	consumed := storage.NewNonce(clientID, nonce, expiresAt)
+	key := nonceKey{clientID: consumed.ClientID, signature: consumed.Signature}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	// Expired nonces can be reclaimed.
+	if exp, ok := n.nonces[key]; ok && exp.After(timeNow(n.Clock)) {
+		return storage.ErrNonceReplayed
+	}
+
+	if n.nonces == nil {
+		n.nonces = map[nonceKey]time.Time{}
+	}
+	n.nonces[key] = consumed.ExpiresAt
+
+	return nil
+}
@@ -0,0 +1,718 @@
+package memory
+
+import (
+	// Standard Library Imports
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	// External Imports
+	"github.com/go-jose/go-jose/v3"
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+type IssuerPublicKeys struct {
+	Issuer    string
+	KeysBySub map[string]SubjectPublicKeys
+}
+
+type SubjectPublicKeys struct {
+	Subject string
+	Keys    map[string]PublicKeyScopes
+}
+
+type PublicKeyScopes struct {
+	Key    *jose.JSONWebKey
+	Scopes []string
+}
+
+// sessionEntities lists the entities that store token and session requests.
+var sessionEntities = []string{
+	storage.EntityAccessTokens,
+	storage.EntityAuthorizationCodes,
+	storage.EntityOpenIDSessions,
+	storage.EntityPKCESessions,
+	storage.EntityRefreshTokens,
+}
+
+// RequestManager provides an in-memory storage implementation for Requests.
+type RequestManager struct {
+	noopConfigure
+
+	// Clients provides access to Client entities.
+	// A client is required when cross referencing scope access rights.
+	Clients storage.ClientStore
+
+	// Users provides access to User entities.
+	// Users are required when the Password Credentials Grant, is implemented
+	// in order to find and authenticate users.
+	Users storage.UserStorer
+
+	// IDGenerator generates IDs for newly created requests. Defaults to
+	// generating UUIDs if not set.
+	IDGenerator func() string
+
+	// Clock provides the current time. Defaults to time.Now if not set.
+	Clock func() time.Time
+
+	// Region tags the requests created by the manager with the region they
+	// were issued in. Requests are not tagged if not set.
+	Region string
+
+	// MaxUserSessions caps the number of refresh tokens a user can hold at
+	// any one time. Once exceeded, the oldest refresh tokens are evicted.
+	// A value of 0 denotes an unlimited number of sessions.
+	MaxUserSessions int64
+
+	// DeleteUsedAuthorizeCodes deletes authorization codes once they've been
+	// used, rather than invalidating them.
+	DeleteUsedAuthorizeCodes bool
+
+	// RefreshTokenGracePeriod keeps refresh tokens usable for the given
+	// duration once they've been used, rather than deleting them.
+	RefreshTokenGracePeriod time.Duration
+
+	// FormKeys limits the form data stored with each request to the listed
+	// keys. Every key is stored if not set. The keys fosite reads back, such
+	// as `redirect_uri`, are always stored, see storage.Request.FilterForm.
+	FormKeys []string
+
+	// RedactedFormKeys lists the form keys removed from the form data before
+	// it's stored.
+	RedactedFormKeys []string
+
+	// ClaimsExtractor extracts custom claims from each session as it's
+	// stored, so requests can be listed by claim. Claims aren't extracted if
+	// not set.
+	ClaimsExtractor func(session fosite.Session) map[string]interface{}
+
+	// Public keys to check signature in auth grant jwt assertion.
+	IssuerPublicKeys map[string]IssuerPublicKeys
+
+	mutex    sync.RWMutex
+	requests map[string]map[string]storage.Request
+
+	issuerPublicKeysMutex sync.RWMutex
+}
+
+// find returns the first request stored against the entity that matches.
+// The caller must hold the lock.
+func (r *RequestManager) find(entityName string, match func(request storage.Request) bool) (result storage.Request, err error) {
+	for _, request := range r.requests[entityName] {
+		if match(request) {
+			return cloneRequest(request), nil
+		}
+	}
+
+	return result, fosite.ErrNotFound
+}
+
+// requestKey returns the key the request is stored under. Refresh tokens are
+// rotated under the same request ID, so used refresh tokens, kept for
+// RefreshTokenGracePeriod, are stored under their signature instead, leaving
+// the request ID to the current refresh token.
+func requestKey(entityName string, request storage.Request) string {
+	if entityName == storage.EntityRefreshTokens && !request.Active {
+		return "used:" + request.Signature
+	}
+
+	return request.ID
+}
+
+// put stores the request against the entity, overwriting any existing request
+// with the same key, see requestKey. Returns storage.ErrResourceExists if
+// another request holds the same signature, unless the entity stores access
+// tokens, where signatures aren't unique. The caller must hold the write lock.
+func (r *RequestManager) put(entityName string, request storage.Request) error {
+	key := requestKey(entityName, request)
+	if entityName != storage.EntityAccessTokens {
+		for id, existing := range r.requests[entityName] {
+			if id != key && existing.Signature == request.Signature {
+				return storage.ErrResourceExists
+			}
+		}
+	}
+
+	if r.requests == nil {
+		r.requests = map[string]map[string]storage.Request{}
+	}
+	if r.requests[entityName] == nil {
+		r.requests[entityName] = map[string]storage.Request{}
+	}
+	r.requests[entityName][key] = cloneRequest(request)
+
+	return nil
+}
+
+// deleteWhere deletes the requests stored against the entity that match and
+// returns the number of requests deleted. The caller must hold the write lock.
+func (r *RequestManager) deleteWhere(entityName string, match func(request storage.Request) bool) (deleted int) {
+	for id, request := range r.requests[entityName] {
+		if match(request) {
+			delete(r.requests[entityName], id)
+			deleted++
+		}
+	}
+
+	return deleted
+}
+
+// List returns a list of Request resources that match the provided inputs.
+func (r *RequestManager) List(_ context.Context, entityName string, filter storage.ListRequestsRequest) (results []storage.Request, err error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var after storage.RequestCursor
+	if filter.After != "" {
+		after, err = storage.ParseRequestCursor(filter.After)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, request := range r.filter(entityName, filter) {
+		if filter.After != "" && !requestedAfter(request, after) {
+			continue
+		}
+
+		results = append(results, request)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if !results[i].RequestedAt.Equal(results[j].RequestedAt) {
+			return results[i].RequestedAt.Before(results[j].RequestedAt)
+		}
+		return results[i].ID < results[j].ID
+	})
+
+	return paginate(results, filter), nil
+}
+
+// ListExpiringBefore returns a list of Request resources that match the
+// provided inputs and expire before the given time, soonest first.
+// Requests without a known expiry are never returned.
+func (r *RequestManager) ListExpiringBefore(_ context.Context, entityName string, before time.Time, filter storage.ListRequestsRequest) (results []storage.Request, err error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, request := range r.filter(entityName, filter) {
+		if request.ExpiresAt.IsZero() || !request.ExpiresAt.Before(before) {
+			continue
+		}
+
+		results = append(results, request)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if !results[i].ExpiresAt.Equal(results[j].ExpiresAt) {
+			return results[i].ExpiresAt.Before(results[j].ExpiresAt)
+		}
+		return results[i].ID < results[j].ID
+	})
+
+	return paginate(results, filter), nil
+}
+
+// ListByClaim returns the Request resources with the custom claim set to the
+// value. Unlike the mongo store, the key only names top level claims.
+func (r *RequestManager) ListByClaim(_ context.Context, entityName string, key string, value interface{}) (results []storage.Request, err error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, request := range r.requests[entityName] {
+		claim, ok := request.Claims[key]
+		if !ok || !reflect.DeepEqual(claim, value) {
+			continue
+		}
+
+		results = append(results, cloneRequest(request))
+	}
+
+	return results, nil
+}
+
+// createSession stores the session request, returning whether it was created.
+// Storing a session whose signature is already held by a request with the
+// same ID succeeds without storing a duplicate, so that token creation can be
+// safely retried.
+func (r *RequestManager) createSession(ctx context.Context, entityName string, request storage.Request) (created bool, err error) {
+	_, err = r.Create(ctx, entityName, request)
+	if err == nil {
+		return true, nil
+	}
+	if err != storage.ErrResourceExists || request.ID == "" {
+		return false, err
+	}
+
+	existing, err := r.GetBySignature(ctx, entityName, request.Signature)
+	if err != nil || existing.ID != request.ID {
+		return false, storage.ErrResourceExists
+	}
+
+	return false, nil
+}
+
+// newRequest transforms a fosite.Request to a storage.Request, filtering the
+// form data and extracting the session's custom claims if configured.
+func (r *RequestManager) newRequest(signature string, requester fosite.Requester, tokenType fosite.TokenType) storage.Request {
+	request := storage.NewRequestFromRequester(signature, requester, tokenType)
+	request.FilterForm(r.FormKeys, r.RedactedFormKeys)
+	if r.ClaimsExtractor != nil && requester.GetSession() != nil {
+		request.Claims = r.ClaimsExtractor(requester.GetSession())
+	}
+
+	return request
+}
+
+// filter returns copies of the requests that match the filter. The caller
+// must hold the mutex.
+func (r *RequestManager) filter(entityName string, filter storage.ListRequestsRequest) (results []storage.Request) {
+	for _, request := range r.requests[entityName] {
+		if filter.ClientID != "" && request.ClientID != filter.ClientID {
+			continue
+		}
+		if filter.UserID != "" && request.UserID != filter.UserID {
+			continue
+		}
+		if !matchesScopes(request.RequestedScope, filter.ScopesIntersection, filter.ScopesUnion) {
+			continue
+		}
+		if !matchesScopes(request.GrantedScope, filter.GrantedScopesIntersection, filter.GrantedScopesUnion) {
+			continue
+		}
+		if filter.Region != "" && request.Region != filter.Region {
+			continue
+		}
+
+		results = append(results, cloneRequest(request))
+	}
+
+	return results
+}
+
+// matchesScopes reports whether the scopes hold all of the scopes in the
+// intersection, and at least one of the scopes in the union, where provided.
+func matchesScopes(scopes []string, intersection []string, union []string) bool {
+	if len(intersection) > 0 && !containsAll(scopes, intersection) {
+		return false
+	}
+	if len(union) > 0 && !containsAny(scopes, union) {
+		return false
+	}
+	return true
+}
+
+// requestedAfter reports whether the request is ordered after the cursor when
+// listing requests.
+func requestedAfter(request storage.Request, after storage.RequestCursor) bool {
+	if !request.RequestedAt.Equal(after.RequestedAt) {
+		return request.RequestedAt.After(after.RequestedAt)
+	}
+	return request.ID > after.ID
+}
+
+// paginate returns the page of sorted results selected by the filter.
+func paginate(results []storage.Request, filter storage.ListRequestsRequest) []storage.Request {
+	if filter.Offset > 0 {
+		if filter.Offset >= int64(len(results)) {
+			return nil
+		}
+		results = results[filter.Offset:]
+	}
+	if filter.Limit > 0 && filter.Limit < int64(len(results)) {
+		results = results[:filter.Limit]
+	}
+
+	return results
+}
+
+// Create creates the new Request resource and returns the newly created Request
+// resource.
+func (r *RequestManager) Create(_ context.Context, entityName string, request storage.Request) (result storage.Request, err error) {
+	// Enable developers to provide their own IDs
+	if request.ID == "" {
+		request.ID = generateID(r.IDGenerator)
+	}
+	if request.CreateTime == 0 {
+		request.CreateTime = timeNow(r.Clock).Unix()
+	}
+	if request.RequestedAt.IsZero() {
+		request.RequestedAt = timeNow(r.Clock)
+	}
+	if request.Region == "" {
+		request.Region = r.Region
+	}
+
+	// Create resource
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.requests[entityName][request.ID]; ok {
+		return result, storage.ErrResourceExists
+	}
+
+	err = r.put(entityName, request)
+	if err != nil {
+		return result, err
+	}
+
+	return request, nil
+}
+
+// Get returns the specified Request resource.
+func (r *RequestManager) Get(_ context.Context, entityName string, requestID string) (result storage.Request, err error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	request, ok := r.requests[entityName][requestID]
+	if !ok {
+		return result, fosite.ErrNotFound
+	}
+
+	return cloneRequest(request), nil
+}
+
+// findByIDEntities are the request entities searched by FindByID, in order.
+// Tokens are searched first as they're the most commonly looked up, and
+// outlive the codes and sessions issued under the same request.
+var findByIDEntities = []string{
+	storage.EntityAccessTokens,
+	storage.EntityRefreshTokens,
+	storage.EntityAuthorizationCodes,
+	storage.EntityOpenIDSessions,
+	storage.EntityPKCESessions,
+}
+
+// FindByID returns the Request resource with the given ID, and the name of the
+// entity it was found in, searching each request entity in turn and stopping
+// at the first match.
+func (r *RequestManager) FindByID(ctx context.Context, requestID string) (result storage.Request, entityName string, err error) {
+	for _, entityName := range findByIDEntities {
+		result, err = r.Get(ctx, entityName, requestID)
+		if err == nil {
+			return result, entityName, nil
+		}
+		if err != fosite.ErrNotFound {
+			return result, "", err
+		}
+	}
+
+	return result, "", fosite.ErrNotFound
+}
+
+// GetBySignature returns a Request resource, if the presented signature returns
+// a match.
+func (r *RequestManager) GetBySignature(_ context.Context, entityName string, signature string) (result storage.Request, err error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.find(entityName, func(request storage.Request) bool {
+		return request.Signature == signature
+	})
+}
+
+// Update updates the Request resource and attributes and returns the updated
+// Request resource.
+func (r *RequestManager) Update(_ context.Context, entityName string, requestID string, updatedRequest storage.Request) (result storage.Request, err error) {
+	// Deny updating the entity Id
+	updatedRequest.ID = requestID
+	// Update modified time
+	updatedRequest.UpdateTime = timeNow(r.Clock).Unix()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	existing, ok := r.requests[entityName][requestID]
+	if !ok {
+		return result, fosite.ErrNotFound
+	}
+
+	// The request is re-keyed if the update marks a refresh token as used.
+	delete(r.requests[entityName], requestID)
+	err = r.put(entityName, updatedRequest)
+	if err != nil {
+		r.requests[entityName][requestID] = existing
+		return result, err
+	}
+
+	return updatedRequest, nil
+}
+
+// Delete deletes the specified Request resource.
+func (r *RequestManager) Delete(_ context.Context, entityName string, requestID string) (err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.requests[entityName][requestID]; !ok {
+		return fosite.ErrNotFound
+	}
+	delete(r.requests[entityName], requestID)
+
+	return nil
+}
+
+// DeleteBySignature deletes the specified request resource, if the presented
+// signature returns a match.
+func (r *RequestManager) DeleteBySignature(_ context.Context, entityName string, signature string) (err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	request, err := r.find(entityName, func(request storage.Request) bool {
+		return request.Signature == signature
+	})
+	if err != nil {
+		return err
+	}
+	delete(r.requests[entityName], requestKey(entityName, request))
+
+	return nil
+}
+
+// DeleteBySignatureReturning deletes the specified request resource, if the
+// presented signature returns a match, and returns the deleted request.
+func (r *RequestManager) DeleteBySignatureReturning(_ context.Context, entityName string, signature string) (result storage.Request, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	request, err := r.find(entityName, func(request storage.Request) bool {
+		return request.Signature == signature
+	})
+	if err != nil {
+		return result, err
+	}
+	delete(r.requests[entityName], requestKey(entityName, request))
+
+	return request, nil
+}
+
+// DeleteExpired deletes the request resources that were requested more than
+// ttl seconds ago. Returns not found if no expired requests were found.
+func (r *RequestManager) DeleteExpired(_ context.Context, entityName string, ttl int) (err error) {
+	expiry := timeNow(r.Clock).Add(-time.Duration(ttl) * time.Second)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	deleted := r.deleteWhere(entityName, func(request storage.Request) bool {
+		return request.RequestedAt.Before(expiry)
+	})
+	if deleted == 0 {
+		return fosite.ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteByRegion deletes the request resources issued in the given region
+// across all request entities. Returns not found if no requests were issued in
+// the region.
+func (r *RequestManager) DeleteByRegion(_ context.Context, region string) (err error) {
+	if region == "" {
+		return fosite.ErrNotFound
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	deleted := 0
+	for _, entityName := range sessionEntities {
+		deleted += r.deleteWhere(entityName, func(request storage.Request) bool {
+			return request.Region == region
+		})
+	}
+	if deleted == 0 {
+		return fosite.ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteByFilter deletes the request resources matching the filter, returning
+// the number of requests deleted. The filter matches requests as List does,
+// but pagination is ignored, so every matching request is deleted. Returns
+// storage.ErrEmptyFilter if no filters are provided, rather than deleting
+// every request stored for the entity.
+func (r *RequestManager) DeleteByFilter(_ context.Context, entityName string, filter storage.ListRequestsRequest) (deleted int64, err error) {
+	if filter.IsEmpty() {
+		return 0, storage.ErrEmptyFilter
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, request := range r.filter(entityName, filter) {
+		delete(r.requests[entityName], requestKey(entityName, request))
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// DeleteByClientAndEntity deletes the client's request resources of the given
+// entity, returning the number of requests deleted, leaving the client's
+// requests of other entities in place. For example, deleting a client's
+// refresh tokens forces re-consent while its short-lived access tokens remain
+// valid. An empty client ID deletes nothing.
+func (r *RequestManager) DeleteByClientAndEntity(ctx context.Context, clientID string, entityName string) (deleted int64, err error) {
+	if clientID == "" {
+		return 0, nil
+	}
+
+	filter := storage.ListRequestsRequest{
+		ClientID: clientID,
+	}
+	return r.DeleteByFilter(ctx, entityName, filter)
+}
+
+// defaultPurgeBatchSize is the number of requests deleted per batch by
+// PurgeExpiredBatched if a batch size isn't provided.
+const defaultPurgeBatchSize = 1000
+
+// PurgeExpiredBatched deletes the request resources that expired before the
+// given time, returning the number of requests deleted. Up to batchSize
+// requests are deleted at a time, releasing the lock and checking for
+// cancellation between batches. Requests without a known expiry are never
+// deleted.
+func (r *RequestManager) PurgeExpiredBatched(ctx context.Context, entityName string, before time.Time, batchSize int) (deleted int64, err error) {
+	if batchSize <= 0 {
+		batchSize = defaultPurgeBatchSize
+	}
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return deleted, err
+		}
+
+		purged := r.purgeExpired(entityName, before, batchSize)
+		deleted += int64(purged)
+		if purged < batchSize {
+			return deleted, nil
+		}
+	}
+}
+
+// purgeExpired deletes up to limit requests stored against the entity that
+// expired before the given time, returning the number of requests deleted.
+func (r *RequestManager) purgeExpired(entityName string, before time.Time, limit int) (deleted int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for id, request := range r.requests[entityName] {
+		if deleted == limit {
+			break
+		}
+		if request.ExpiresAt.IsZero() || !request.ExpiresAt.Before(before) {
+			continue
+		}
+
+		delete(r.requests[entityName], id)
+		deleted++
+	}
+
+	return deleted
+}
+
+// RevokeRefreshToken deletes the refresh token session, including any used
+// refresh tokens issued under the same request.
+func (r *RequestManager) RevokeRefreshToken(ctx context.Context, requestID string) (err error) {
+	return r.revokeToken(ctx, storage.EntityRefreshTokens, requestID)
+}
+
+// RevokeAccessToken deletes the access token session.
+func (r *RequestManager) RevokeAccessToken(ctx context.Context, requestID string) (err error) {
+	return r.revokeToken(ctx, storage.EntityAccessTokens, requestID)
+}
+
+// RevokeRefreshTokenMaybeGracePeriod marks the refresh token, and the current
+// refresh token of the request it was issued under, as used if
+// RefreshTokenGracePeriod is set, otherwise the refresh token session is
+// deleted.
+func (r *RequestManager) RevokeRefreshTokenMaybeGracePeriod(ctx context.Context, requestID string, signature string) error {
+	if r.RefreshTokenGracePeriod <= 0 {
+		return r.RevokeRefreshToken(ctx, requestID)
+	}
+
+	return r.useRefreshToken(requestID, signature)
+}
+
+func (r *RequestManager) GetPublicKey(ctx context.Context, issuer string, subject string, keyId string) (*jose.JSONWebKey, error) {
+	r.issuerPublicKeysMutex.RLock()
+	defer r.issuerPublicKeysMutex.RUnlock()
+
+	if issuerKeys, ok := r.IssuerPublicKeys[issuer]; ok {
+		if subKeys, ok := issuerKeys.KeysBySub[subject]; ok {
+			if keyScopes, ok := subKeys.Keys[keyId]; ok {
+				return keyScopes.Key, nil
+			}
+		}
+	}
+
+	return nil, fosite.ErrNotFound
+}
+
+func (r *RequestManager) GetPublicKeys(ctx context.Context, issuer string, subject string) (*jose.JSONWebKeySet, error) {
+	r.issuerPublicKeysMutex.RLock()
+	defer r.issuerPublicKeysMutex.RUnlock()
+
+	if issuerKeys, ok := r.IssuerPublicKeys[issuer]; ok {
+		if subKeys, ok := issuerKeys.KeysBySub[subject]; ok {
+			if len(subKeys.Keys) == 0 {
+				return nil, fosite.ErrNotFound
+			}
+			keys := make([]jose.JSONWebKey, 0, len(subKeys.Keys))
+			for _, keyScopes := range subKeys.Keys {
+				keys = append(keys, *keyScopes.Key)
+			}
+			return &jose.JSONWebKeySet{Keys: keys}, nil
+		}
+	}
+
+	return nil, fosite.ErrNotFound
+}
+
+func (r *RequestManager) GetPublicKeyScopes(ctx context.Context, issuer string, subject string, keyId string) ([]string, error) {
+	r.issuerPublicKeysMutex.RLock()
+	defer r.issuerPublicKeysMutex.RUnlock()
+
+	if issuerKeys, ok := r.IssuerPublicKeys[issuer]; ok {
+		if subKeys, ok := issuerKeys.KeysBySub[subject]; ok {
+			if keyScopes, ok := subKeys.Keys[keyId]; ok {
+				return keyScopes.Scopes, nil
+			}
+		}
+	}
+
+	return nil, fosite.ErrNotFound
+}
+
+// revokeToken deletes every token issued under the provided request id.
+func (r *RequestManager) revokeToken(_ context.Context, entityName string, requestID string) (err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Note: If the token is not found, we can declare it revoked.
+	r.deleteWhere(entityName, func(request storage.Request) bool {
+		return request.ID == requestID
+	})
+
+	return nil
+}
+
+// getSession returns the stored request matching the signature, transformed
+// to a fosite.Request.
+func (r *RequestManager) getSession(ctx context.Context, entityName string, signature string, session fosite.Session) (result storage.Request, request fosite.Requester, err error) {
+	result, err = r.GetBySignature(ctx, entityName, signature)
+	if err != nil {
+		return result, nil, err
+	}
+
+	request, err = result.ToRequest(ctx, session, r.Clients)
+	if err != nil {
+		return result, nil, err
+	}
+
+	return result, request, nil
+}
@@ -0,0 +1,45 @@
+package memory
+
+import (
+	// Standard Library Imports
+	"context"
+
+	// External Imports
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// CreateAccessTokenSession creates a new session for an Access Token
+func (r *RequestManager) CreateAccessTokenSession(ctx context.Context, signature string, request fosite.Requester) (err error) {
+	_, err = r.createSession(ctx, storage.EntityAccessTokens, r.newRequest(signature, request, fosite.AccessToken))
+	return err
+}
+
+// GetAccessTokenSession returns a session if it can be found by signature
+func (r *RequestManager) GetAccessTokenSession(ctx context.Context, signature string, session fosite.Session) (request fosite.Requester, err error) {
+	_, request, err = r.getSession(ctx, storage.EntityAccessTokens, signature, session)
+	return request, err
+}
+
+// GetAccessTokenSessionForAudience returns the access token session, if the
+// token was granted the audience, otherwise storage.ErrAudienceMismatch is
+// returned.
+func (r *RequestManager) GetAccessTokenSessionForAudience(ctx context.Context, signature string, audience string, session fosite.Session) (request fosite.Requester, err error) {
+	request, err = r.GetAccessTokenSession(ctx, signature, session)
+	if err != nil {
+		return nil, err
+	}
+
+	if !request.GetGrantedAudience().Has(audience) {
+		return nil, storage.ErrAudienceMismatch
+	}
+
+	return request, nil
+}
+
+// DeleteAccessTokenSession removes an Access Token's session
+func (r *RequestManager) DeleteAccessTokenSession(ctx context.Context, signature string) (err error) {
+	return r.DeleteBySignature(ctx, storage.EntityAccessTokens, signature)
+}
@@ -0,0 +1,88 @@
+package memory
+
+import (
+	// Standard Library Imports
+	"context"
+	"time"
+
+	// External Imports
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// CreateAuthorizeCodeSession stores the authorization request for a given
+// authorization code.
+func (r *RequestManager) CreateAuthorizeCodeSession(ctx context.Context, code string, request fosite.Requester) (err error) {
+	_, err = r.createSession(ctx, storage.EntityAuthorizationCodes, r.newRequest(code, request, fosite.AuthorizeCode))
+	return err
+}
+
+// GetAuthorizeCodeSession hydrates the session based on the given code and
+// returns the authorization request.
+func (r *RequestManager) GetAuthorizeCodeSession(ctx context.Context, code string, session fosite.Session) (request fosite.Requester, err error) {
+	req, request, err := r.getSession(ctx, storage.EntityAuthorizationCodes, code, session)
+	if err != nil {
+		return nil, err
+	}
+
+	if !req.Active {
+		// If the authorization code has been invalidated with
+		// `InvalidateAuthorizeCodeSession`, fosite expects the request to be
+		// returned along with the ErrInvalidatedAuthorizeCode error.
+		return request, fosite.ErrInvalidatedAuthorizeCode
+	}
+
+	return request, nil
+}
+
+// InvalidateAuthorizeCodeSession is called when an authorize code is being
+// used. The state of the authorization code should be set to invalid and
+// consecutive requests to GetAuthorizeCodeSession should return the
+// ErrInvalidatedAuthorizeCode error.
+//
+// Codes are single use, so invalidating a code that has already been
+// invalidated returns ErrInvalidatedAuthorizeCode. Of any concurrent
+// redemptions of a code, only one succeeds.
+//
+// If DeleteUsedAuthorizeCodes is set, the code is deleted rather than
+// invalidated, so reusing the code returns ErrNotFound.
+func (r *RequestManager) InvalidateAuthorizeCodeSession(_ context.Context, code string) (err error) {
+	// The lookup and update are made under the same lock, so that concurrent
+	// redemptions can't both observe the code as active.
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	req, err := r.find(storage.EntityAuthorizationCodes, func(request storage.Request) bool {
+		return request.Signature == code
+	})
+	if err != nil {
+		return err
+	}
+	if !req.Active {
+		return fosite.ErrInvalidatedAuthorizeCode
+	}
+
+	if r.DeleteUsedAuthorizeCodes {
+		delete(r.requests[storage.EntityAuthorizationCodes], req.ID)
+		return nil
+	}
+
+	req.Active = false
+	req.UpdateTime = timeNow(r.Clock).Unix()
+	return r.put(storage.EntityAuthorizationCodes, req)
+}
+
+// PurgeInvalidatedCodes deletes the authorization codes invalidated before the
+// given time, returning the number of codes deleted.
+func (r *RequestManager) PurgeInvalidatedCodes(_ context.Context, olderThan time.Time) (deleted int64, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	purged := r.deleteWhere(storage.EntityAuthorizationCodes, func(request storage.Request) bool {
+		return !request.Active && request.UpdateTime < olderThan.Unix()
+	})
+
+	return int64(purged), nil
+}
@@ -0,0 +1,170 @@
+package memory
+
+import (
+	// Standard Library Imports
+	"context"
+	"sort"
+
+	// External Imports
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// CreateRefreshTokenSession implements fosite.RefreshTokenStorage.
+func (r *RequestManager) CreateRefreshTokenSession(ctx context.Context, signature string, request fosite.Requester) (err error) {
+	return r.CreateRefreshTokenSessionWithAccess(ctx, signature, "", request)
+}
+
+// CreateRefreshTokenSessionWithAccess stores the refresh token session linked
+// to the signature of the access token issued alongside it, so that
+// RevokeRefreshTokenBySignature can revoke the pair.
+func (r *RequestManager) CreateRefreshTokenSessionWithAccess(ctx context.Context, signature string, accessSignature string, request fosite.Requester) (err error) {
+	session := r.newRequest(signature, request, fosite.RefreshToken)
+	session.AccessSignature = accessSignature
+	created, err := r.createSession(ctx, storage.EntityRefreshTokens, session)
+	if err != nil {
+		return err
+	}
+
+	if created && r.MaxUserSessions > 0 {
+		r.evictExcessRefreshTokens(request.GetSession().GetSubject())
+	}
+
+	return nil
+}
+
+// evictExcessRefreshTokens removes the oldest live refresh tokens held by a
+// user once the user holds more than the configured maximum number of
+// sessions. Used and expired refresh tokens don't count towards the maximum.
+func (r *RequestManager) evictExcessRefreshTokens(userID string) {
+	if userID == "" {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := timeNow(r.Clock)
+	var held []storage.Request
+	for _, request := range r.requests[storage.EntityRefreshTokens] {
+		if request.UserID == userID && request.IsLive(now) {
+			held = append(held, request)
+		}
+	}
+
+	excess := int64(len(held)) - r.MaxUserSessions
+	if excess <= 0 {
+		return
+	}
+
+	sort.Slice(held, func(i, j int) bool {
+		return held[i].RequestedAt.Before(held[j].RequestedAt)
+	})
+	for _, request := range held[:excess] {
+		delete(r.requests[storage.EntityRefreshTokens], request.ID)
+	}
+}
+
+// ActiveSessionCount returns the number of live refresh tokens held by the
+// user. Used and expired refresh tokens aren't counted.
+func (r *RequestManager) ActiveSessionCount(_ context.Context, userID string) (count int64, err error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	now := timeNow(r.Clock)
+	for _, request := range r.requests[storage.EntityRefreshTokens] {
+		if request.UserID == userID && request.IsLive(now) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// GetRefreshTokenSession implements fosite.RefreshTokenStorage.
+//
+// Used refresh tokens are returned within their grace period, otherwise
+// fosite.ErrInactiveToken is returned along with the request.
+func (r *RequestManager) GetRefreshTokenSession(ctx context.Context, signature string, session fosite.Session) (request fosite.Requester, err error) {
+	request, state, err := r.GetRefreshTokenSessionEx(ctx, signature, session)
+	if err != nil {
+		return nil, err
+	}
+
+	if state == storage.RefreshTokenReused {
+		return request, fosite.ErrInactiveToken
+	}
+
+	return request, nil
+}
+
+// GetRefreshTokenSessionEx returns the refresh token session along with its
+// rotation state.
+func (r *RequestManager) GetRefreshTokenSessionEx(ctx context.Context, signature string, session fosite.Session) (request fosite.Requester, state storage.RefreshTokenState, err error) {
+	req, request, err := r.getSession(ctx, storage.EntityRefreshTokens, signature, session)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return request, req.RefreshTokenState(timeNow(r.Clock), r.RefreshTokenGracePeriod), nil
+}
+
+// useRefreshToken marks the refresh token, and the current refresh token of
+// the request it was issued under, as used, starting their grace period.
+// Tokens which have already been used are left untouched.
+func (r *RequestManager) useRefreshToken(requestID string, signature string) (err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var used []storage.Request
+	for _, request := range r.requests[storage.EntityRefreshTokens] {
+		matched := request.Signature == signature || (requestID != "" && request.ID == requestID)
+		if matched && request.Active {
+			used = append(used, request)
+		}
+	}
+
+	for _, req := range used {
+		delete(r.requests[storage.EntityRefreshTokens], requestKey(storage.EntityRefreshTokens, req))
+
+		req.Active = false
+		req.UpdateTime = timeNow(r.Clock).Unix()
+		err = r.put(storage.EntityRefreshTokens, req)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RevokeRefreshTokenBySignature deletes the refresh token session and the
+// access token session linked to it.
+func (r *RequestManager) RevokeRefreshTokenBySignature(ctx context.Context, signature string) (err error) {
+	refreshToken, err := r.DeleteBySignatureReturning(ctx, storage.EntityRefreshTokens, signature)
+	if err != nil {
+		if err == fosite.ErrNotFound {
+			// Note: If the token is not found, we can declare it revoked.
+			return nil
+		}
+		return err
+	}
+
+	if refreshToken.AccessSignature == "" {
+		return nil
+	}
+
+	err = r.DeleteBySignature(ctx, storage.EntityAccessTokens, refreshToken.AccessSignature)
+	if err != nil && err != fosite.ErrNotFound {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteRefreshTokenSession implements fosite.RefreshTokenStorage.
+func (r *RequestManager) DeleteRefreshTokenSession(ctx context.Context, signature string) (err error) {
+	return r.DeleteBySignature(ctx, storage.EntityRefreshTokens, signature)
+}
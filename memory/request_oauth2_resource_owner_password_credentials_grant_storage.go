@@ -0,0 +1,24 @@
+package memory
+
+import (
+	// Standard Library Imports
+	"context"
+	"errors"
+
+	// External Imports
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// Authenticate confirms whether the specified password matches the stored
+// hashed password within a User resource, found by username.
+func (r *RequestManager) Authenticate(ctx context.Context, username string, secret string) (err error) {
+	_, err = r.Users.Authenticate(ctx, username, secret)
+	if errors.Is(err, storage.ErrInvalidCredentials) {
+		// fosite reports not found as an invalid grant.
+		return fosite.ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,73 @@
+package memory
+
+import (
+	// Standard Library Imports
+	"context"
+	"sort"
+
+	// External Imports
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// CreateOpenIDConnectSession creates an open id connect session resource for a
+// given authorize code. This is relevant for explicit open id connect flow.
+func (r *RequestManager) CreateOpenIDConnectSession(ctx context.Context, authorizeCode string, request fosite.Requester) (err error) {
+	_, err = r.createSession(ctx, storage.EntityOpenIDSessions, r.newRequest(authorizeCode, request, fosite.AuthorizeCode))
+	return err
+}
+
+// GetOpenIDConnectSession gets a session resource based off the Authorize Code
+// and returns a fosite.Requester, or an error.
+func (r *RequestManager) GetOpenIDConnectSession(ctx context.Context, authorizeCode string, requester fosite.Requester) (request fosite.Requester, err error) {
+	session := requester.GetSession()
+	if session == nil {
+		return nil, fosite.ErrNotFound
+	}
+
+	_, request, err = r.getSession(ctx, storage.EntityOpenIDSessions, authorizeCode, session)
+	return request, err
+}
+
+// DeleteOpenIDConnectSession removes an open id connect session.
+func (r *RequestManager) DeleteOpenIDConnectSession(ctx context.Context, authorizeCode string) (err error) {
+	return r.DeleteBySignature(ctx, storage.EntityOpenIDSessions, authorizeCode)
+}
+
+// GetOpenIDSessionsBySid returns all open id connect session resources issued
+// under the given OpenID Connect session ID.
+func (r *RequestManager) GetOpenIDSessionsBySid(_ context.Context, sid string) (results []storage.Request, err error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, request := range r.requests[storage.EntityOpenIDSessions] {
+		if request.Sid == sid {
+			results = append(results, cloneRequest(request))
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].ID < results[j].ID
+	})
+
+	return results, nil
+}
+
+// DeleteOpenIDSessionsBySid removes all open id connect session resources
+// issued under the given OpenID Connect session ID. Returns not found if no
+// sessions were found for the given session ID.
+func (r *RequestManager) DeleteOpenIDSessionsBySid(_ context.Context, sid string) (err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	deleted := r.deleteWhere(storage.EntityOpenIDSessions, func(request storage.Request) bool {
+		return request.Sid == sid
+	})
+	if deleted == 0 {
+		return fosite.ErrNotFound
+	}
+
+	return nil
+}
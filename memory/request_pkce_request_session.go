@@ -0,0 +1,29 @@
+package memory
+
+import (
+	// Standard Library Imports
+	"context"
+
+	// External Imports
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// CreatePKCERequestSession implements fosite.PKCERequestStorage.
+func (r *RequestManager) CreatePKCERequestSession(ctx context.Context, signature string, request fosite.Requester) (err error) {
+	_, err = r.createSession(ctx, storage.EntityPKCESessions, r.newRequest(signature, request, fosite.AuthorizeCode))
+	return err
+}
+
+// GetPKCERequestSession implements fosite.PKCERequestStorage.
+func (r *RequestManager) GetPKCERequestSession(ctx context.Context, signature string, session fosite.Session) (request fosite.Requester, err error) {
+	_, request, err = r.getSession(ctx, storage.EntityPKCESessions, signature, session)
+	return request, err
+}
+
+// DeletePKCERequestSession implements fosite.PKCERequestStorage.
+func (r *RequestManager) DeletePKCERequestSession(ctx context.Context, signature string) (err error) {
+	return r.DeleteBySignature(ctx, storage.EntityPKCESessions, signature)
+}
@@ -0,0 +1,903 @@
+package memory
+
+import (
+	// Standard Library Imports
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	// External Imports
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// UserManager provides an in-memory storage implementation for user
+// resources.
+//
+// Implements:
+// - storage.Configure
+// - storage.AuthUserMigrator
+// - storage.UserStorer
+// - storage.UserManager
+type UserManager struct {
+	noopConfigure
+
+	Hasher fosite.Hasher
+
+	// IDGenerator generates IDs for newly created users. Defaults to
+	// generating UUIDs if not set.
+	IDGenerator func() string
+
+	// Clock provides the current time. Defaults to time.Now if not set.
+	Clock func() time.Time
+
+	// UniquePersonID enforces that each person ID is linked to at most one
+	// user.
+	UniquePersonID bool
+
+	// Hooks, if set, observes and can veto the users created, updated and
+	// deleted via Create, Migrate, Update and Delete. Targeted updates, such
+	// as UpdatePassword, aren't hooked.
+	Hooks storage.Hooks[storage.User]
+
+	// RoleScopes maps each role to the scopes it implies, which are granted
+	// to users holding the role, see EffectiveScopes.
+	RoleScopes map[string][]string
+
+	// MaxFailedLogins locks a user out for LockoutDuration once that many
+	// consecutive attempts to authenticate as the user have failed. Zero
+	// disables lockout.
+	MaxFailedLogins uint32
+
+	// LockoutDuration is how long a user is locked out for. Defaults to 15
+	// minutes if not set.
+	LockoutDuration time.Duration
+
+	mutex sync.RWMutex
+	users map[string]storage.User
+	decoy decoyHash
+}
+
+// defaultLockoutDuration is how long a user is locked out for, unless
+// configured otherwise.
+const defaultLockoutDuration = 15 * time.Minute
+
+// hooks returns the configured hooks, defaulting to allowing every change.
+func (u *UserManager) hooks() storage.Hooks[storage.User] {
+	if u.Hooks == nil {
+		return storage.NopHooks[storage.User]{}
+	}
+
+	return u.Hooks
+}
+
+// recordFailedLogin counts a failed attempt to authenticate as the user,
+// locking the user out once MaxFailedLogins consecutive attempts have failed.
+// Attempts against a locked user aren't counted, so the lockout isn't
+// extended.
+func (u *UserManager) recordFailedLogin(userID string) {
+	if u.MaxFailedLogins == 0 {
+		return
+	}
+	now := timeNow(u.Clock)
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	user, ok := u.users[userID]
+	if !ok || user.IsLocked(now) {
+		return
+	}
+
+	user.FailedLoginCount++
+	if user.FailedLoginCount >= int(u.MaxFailedLogins) {
+		lockoutDuration := u.LockoutDuration
+		if lockoutDuration <= 0 {
+			lockoutDuration = defaultLockoutDuration
+		}
+
+		// Restart the count, so the user is allowed MaxFailedLogins attempts
+		// once the lockout ends.
+		user.FailedLoginCount = 0
+		user.LockedUntil = now.Add(lockoutDuration).Unix()
+	}
+	u.users[userID] = user
+}
+
+// resetFailedLogins clears the failed login count of a user who has
+// authenticated, without bumping the user's update time.
+func (u *UserManager) resetFailedLogins(user *storage.User) {
+	if user.FailedLoginCount == 0 && user.LockedUntil == 0 {
+		return
+	}
+
+	u.mutex.Lock()
+	if stored, ok := u.users[user.ID]; ok {
+		stored.FailedLoginCount = 0
+		stored.LockedUntil = 0
+		u.users[user.ID] = stored
+	}
+	u.mutex.Unlock()
+
+	user.FailedLoginCount = 0
+	user.LockedUntil = 0
+}
+
+// withoutSecrets returns a copy of the user excluding the user's MFA secrets,
+// so they are only returned when needed to verify a second factor.
+func withoutSecrets(user storage.User) storage.User {
+	user = cloneUser(user)
+	user.TOTPSecret = ""
+	user.RecoveryCodes = nil
+
+	return user
+}
+
+// getConcrete returns a User resource, including the user's MFA secrets.
+func (u *UserManager) getConcrete(userID string) (result storage.User, err error) {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+
+	user, ok := u.users[userID]
+	if !ok {
+		return result, fosite.ErrNotFound
+	}
+
+	return cloneUser(user), nil
+}
+
+// put stores the user, overwriting any existing user with the same ID.
+// Returns storage.ErrResourceExists if another user holds the same username,
+// or person ID if UniquePersonID is enforced. The caller must hold the write
+// lock.
+func (u *UserManager) put(user storage.User) error {
+	for id, existing := range u.users {
+		if id == user.ID {
+			continue
+		}
+
+		// Usernames are only unique across enabled users, so the username of
+		// a disabled account can be reused.
+		if !user.Disabled && !existing.Disabled && existing.Username == user.Username {
+			return storage.ErrResourceExists
+		}
+
+		if u.UniquePersonID && user.PersonID != "" && existing.PersonID == user.PersonID {
+			return storage.ErrResourceExists
+		}
+	}
+
+	if u.users == nil {
+		u.users = map[string]storage.User{}
+	}
+	u.users[user.ID] = cloneUser(user)
+
+	return nil
+}
+
+// setFields performs a targeted update of the specified user, bumping the
+// user's update time, and returns the updated user.
+func (u *UserManager) setFields(userID string, set func(user *storage.User)) (result storage.User, err error) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	user, ok := u.users[userID]
+	if !ok {
+		return result, fosite.ErrNotFound
+	}
+
+	user = cloneUser(user)
+	set(&user)
+	user.UpdateTime = timeNow(u.Clock).Unix()
+
+	err = u.put(user)
+	if err != nil {
+		return result, err
+	}
+
+	return withoutSecrets(user), nil
+}
+
+// List returns a list of User resources that match the provided inputs.
+func (u *UserManager) List(_ context.Context, filter storage.ListUsersRequest) (results []storage.User, err error) {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+
+	search := strings.ToLower(filter.Search)
+	for _, user := range u.users {
+		if filter.AllowedTenantAccess != "" && !contains(user.AllowedTenantAccess, filter.AllowedTenantAccess) {
+			continue
+		}
+		if filter.AllowedPersonAccess != "" && !contains(user.AllowedPersonAccess, filter.AllowedPersonAccess) {
+			continue
+		}
+		if filter.PersonID != "" && user.PersonID != filter.PersonID {
+			continue
+		}
+		if filter.Username != "" && user.Username != filter.Username {
+			continue
+		}
+		// A scope union takes precedence, as it returns the wider selection.
+		if len(filter.ScopesUnion) > 0 {
+			if !containsAny(user.Scopes, filter.ScopesUnion) {
+				continue
+			}
+		} else if len(filter.ScopesIntersection) > 0 && !containsAll(user.Scopes, filter.ScopesIntersection) {
+			continue
+		}
+		if filter.ScopePrefix != "" && !containsPrefix(user.Scopes, filter.ScopePrefix) {
+			continue
+		}
+		if filter.FirstName != "" && user.FirstName != filter.FirstName {
+			continue
+		}
+		if filter.LastName != "" && user.LastName != filter.LastName {
+			continue
+		}
+		if filter.Disabled && !user.Disabled {
+			continue
+		}
+		if filter.After != "" && user.ID <= filter.After {
+			continue
+		}
+		if search != "" && !containsPrefix(user.SearchTerms(), search) {
+			continue
+		}
+
+		results = append(results, withoutSecrets(user))
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].ID < results[j].ID
+	})
+	if filter.Limit > 0 && filter.Limit < int64(len(results)) {
+		results = results[:filter.Limit]
+	}
+
+	return results, nil
+}
+
+// Create creates a new User resource and returns the newly created User
+// resource.
+func (u *UserManager) Create(ctx context.Context, user storage.User) (result storage.User, err error) {
+	// Enable developers to provide their own IDs
+	if user.ID == "" {
+		user.ID = generateID(u.IDGenerator)
+	}
+	if user.CreateTime == 0 {
+		user.CreateTime = timeNow(u.Clock).Unix()
+	}
+
+	err = u.hooks().BeforeCreate(ctx, user)
+	if err != nil {
+		return result, err
+	}
+
+	// Hash incoming secret
+	hash, err := u.Hasher.Hash(ctx, []byte(user.Password))
+	if err != nil {
+		return result, err
+	}
+	user.Password = string(hash)
+
+	err = u.insert(user)
+	if err != nil {
+		return result, err
+	}
+
+	u.hooks().AfterCreate(ctx, user)
+	return user, nil
+}
+
+// insert stores the new user, returning storage.ErrResourceExists if a user
+// already exists with the same ID.
+func (u *UserManager) insert(user storage.User) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if _, ok := u.users[user.ID]; ok {
+		return storage.ErrResourceExists
+	}
+
+	return u.put(user)
+}
+
+// Get returns the specified User resource. Disabled users aren't found,
+// unless the context is marked with storage.WithIncludeDisabled.
+func (u *UserManager) Get(ctx context.Context, userID string) (result storage.User, err error) {
+	user, err := u.getConcrete(userID)
+	if err != nil {
+		return result, err
+	}
+	if user.Disabled && !storage.IncludeDisabled(ctx) {
+		return result, fosite.ErrNotFound
+	}
+
+	return withoutSecrets(user), nil
+}
+
+// GetByUsername returns a user resource if found by username. Disabled users
+// aren't found, unless the context is marked with storage.WithIncludeDisabled,
+// in which case the enabled user is preferred, as the username of a disabled
+// user can be reused.
+func (u *UserManager) GetByUsername(ctx context.Context, username string) (result storage.User, err error) {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+
+	includeDisabled := storage.IncludeDisabled(ctx)
+	found := false
+	for _, user := range u.users {
+		if user.Username != username || (user.Disabled && !includeDisabled) {
+			continue
+		}
+
+		if !found || !user.Disabled {
+			result = withoutSecrets(user)
+			found = true
+		}
+		if !user.Disabled {
+			break
+		}
+	}
+
+	if !found {
+		return result, fosite.ErrNotFound
+	}
+
+	return result, nil
+}
+
+// EffectiveScopes returns the union of the user's scopes and the scopes
+// implied by the user's roles, as mapped by RoleScopes.
+func (u *UserManager) EffectiveScopes(ctx context.Context, userID string) (scopes []string, err error) {
+	user, err := u.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return user.EffectiveScopes(u.RoleScopes), nil
+}
+
+// GetByLogin returns the user resource whose username or email matches the
+// login. Returns storage.ErrMultipleResults if the login matches different
+// users.
+func (u *UserManager) GetByLogin(ctx context.Context, login string) (result storage.User, err error) {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+
+	if login == "" {
+		return result, fosite.ErrNotFound
+	}
+
+	includeDisabled := storage.IncludeDisabled(ctx)
+	found := false
+	for _, user := range u.users {
+		if user.Username != login && user.Email != login {
+			continue
+		}
+		if user.Disabled && !includeDisabled {
+			continue
+		}
+
+		if found {
+			return storage.User{}, storage.ErrMultipleResults
+		}
+		found = true
+		result = withoutSecrets(user)
+	}
+
+	if !found {
+		return result, fosite.ErrNotFound
+	}
+
+	return result, nil
+}
+
+// GetByPersonID returns the user resource linked to the given person ID.
+// Returns storage.ErrMultipleResults if more than one user is linked to the
+// person, which can only occur if UniquePersonID is not enforced.
+func (u *UserManager) GetByPersonID(_ context.Context, personID string) (result storage.User, err error) {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+
+	found := false
+	for _, user := range u.users {
+		if user.PersonID != personID {
+			continue
+		}
+
+		if found {
+			return storage.User{}, storage.ErrMultipleResults
+		}
+		found = true
+		result = withoutSecrets(user)
+	}
+
+	if !found {
+		return result, fosite.ErrNotFound
+	}
+
+	return result, nil
+}
+
+// UsernameExists returns whether an enabled user resource exists with the
+// given username. The username of a disabled user is free to be reused.
+func (u *UserManager) UsernameExists(_ context.Context, username string) (exists bool, err error) {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+
+	for _, user := range u.users {
+		if user.Username == username && !user.Disabled {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Update updates the User resource and attributes and returns the updated
+// User resource.
+func (u *UserManager) Update(ctx context.Context, userID string, updatedUser storage.User) (result storage.User, err error) {
+	currentResource, err := u.getConcrete(userID)
+	if err != nil {
+		return result, err
+	}
+
+	// Deny updating the entity Id
+	updatedUser.ID = userID
+
+	err = u.hooks().BeforeUpdate(ctx, updatedUser)
+	if err != nil {
+		return result, err
+	}
+
+	// Update modified time
+	updatedUser.UpdateTime = timeNow(u.Clock).Unix()
+
+	if currentResource.Password == updatedUser.Password || updatedUser.Password == "" {
+		// If the password/hash is blank or hash matches, set using old hash.
+		updatedUser.Password = currentResource.Password
+	} else {
+		newHash, err := u.Hasher.Hash(ctx, []byte(updatedUser.Password))
+		if err != nil {
+			return result, err
+		}
+		updatedUser.Password = string(newHash)
+	}
+
+	result, err = u.update(updatedUser)
+	if err != nil {
+		return result, err
+	}
+
+	u.hooks().AfterUpdate(ctx, result)
+	return result, nil
+}
+
+// update stores the updated user over the existing user, preserving the
+// user's MFA enrolment.
+func (u *UserManager) update(updatedUser storage.User) (result storage.User, err error) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	currentResource, ok := u.users[updatedUser.ID]
+	if !ok {
+		return result, fosite.ErrNotFound
+	}
+
+	// MFA enrolment is only managed via EnrollTOTP and DisableMFA.
+	updatedUser.MFAEnabled = currentResource.MFAEnabled
+	updatedUser.TOTPSecret = currentResource.TOTPSecret
+	updatedUser.RecoveryCodes = currentResource.RecoveryCodes
+
+	err = u.put(updatedUser)
+	if err != nil {
+		return result, err
+	}
+
+	return withoutSecrets(updatedUser), nil
+}
+
+// UpdatePassword hashes the provided cleartext password and sets it as the
+// user's password. Unlike Update, the password is always rehashed, so there
+// is no ambiguity as to whether a password or an existing hash is expected.
+func (u *UserManager) UpdatePassword(ctx context.Context, userID string, password string) (err error) {
+	hash, err := u.Hasher.Hash(ctx, []byte(password))
+	if err != nil {
+		return err
+	}
+
+	_, err = u.setFields(userID, func(user *storage.User) {
+		user.Password = string(hash)
+	})
+	return err
+}
+
+// Migrate is provided solely for the case where you want to migrate users and
+// upgrade their password using the AuthUserMigrator interface.
+// This performs an upsert, either creating or overwriting the record with the
+// newly provided full record. Use with caution, be secure, don't be dumb.
+// If the user has a SourceUpdatedAt, a stored user migrated from the same or
+// a newer version isn't overwritten and storage.ErrMigrationStale is returned.
+// BeforeCreate, or BeforeUpdate if the user exists, is called with the
+// migrated user, including its already hashed password.
+func (u *UserManager) Migrate(ctx context.Context, migratedUser storage.User) (result storage.User, err error) {
+	// Generate a unique ID if not supplied
+	if migratedUser.ID == "" {
+		migratedUser.ID = generateID(u.IDGenerator)
+	}
+	// Update create time
+	if migratedUser.CreateTime == 0 {
+		migratedUser.CreateTime = timeNow(u.Clock).Unix()
+	}
+	// Update modified time
+	migratedUser.UpdateTime = timeNow(u.Clock).Unix()
+
+	u.mutex.RLock()
+	_, found := u.users[migratedUser.ID]
+	u.mutex.RUnlock()
+
+	if found {
+		err = u.hooks().BeforeUpdate(ctx, migratedUser)
+	} else {
+		err = u.hooks().BeforeCreate(ctx, migratedUser)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	u.mutex.Lock()
+	if existing, ok := u.users[migratedUser.ID]; ok && migratedUser.SourceUpdatedAt != 0 {
+		if existing.SourceUpdatedAt >= migratedUser.SourceUpdatedAt {
+			u.mutex.Unlock()
+			return result, storage.ErrMigrationStale
+		}
+	}
+	err = u.put(migratedUser)
+	u.mutex.Unlock()
+	if err != nil {
+		return result, err
+	}
+
+	if found {
+		u.hooks().AfterUpdate(ctx, migratedUser)
+	} else {
+		u.hooks().AfterCreate(ctx, migratedUser)
+	}
+	return migratedUser, nil
+}
+
+// Delete deletes the specified User resource.
+func (u *UserManager) Delete(ctx context.Context, userID string) (err error) {
+	err = u.hooks().BeforeDelete(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	u.mutex.Lock()
+	_, exists := u.users[userID]
+	delete(u.users, userID)
+	u.mutex.Unlock()
+
+	if !exists {
+		return fosite.ErrNotFound
+	}
+
+	u.hooks().AfterDelete(ctx, userID)
+	return nil
+}
+
+// Authenticate confirms whether the specified password matches the stored
+// hashed password within the User resource.
+// The User resource returned is matched by username.
+func (u *UserManager) Authenticate(ctx context.Context, username string, password string) (result storage.User, err error) {
+	return u.AuthenticateByUsername(ctx, username, password)
+}
+
+// AuthenticateByID confirms whether the specified password matches the stored
+// hashed password within the User resource.
+// The User resource returned is matched by User ID. A missing user and a
+// wrong password are both reported as storage.ErrInvalidCredentials, as is a
+// wrong password for a disabled or locked user, which is otherwise denied.
+// Wrong passwords count towards locking the user out, see MaxFailedLogins,
+// while a successful authentication clears the count.
+func (u *UserManager) AuthenticateByID(ctx context.Context, userID string, password string) (result storage.User, err error) {
+	user, err := u.getConcrete(userID)
+	if err != nil {
+		if err == fosite.ErrNotFound {
+			u.decoy.compare(ctx, u.Hasher, password)
+			return result, storage.ErrInvalidCredentials
+		}
+		return result, err
+	}
+
+	err = u.Hasher.Compare(ctx, []byte(user.Password), []byte(password))
+	if err != nil {
+		u.recordFailedLogin(user.ID)
+		return result, storage.ErrInvalidCredentials
+	}
+
+	// Deny disabled or locked users only once the password has been verified,
+	// so a user's state isn't revealed without it.
+	if user.Disabled || user.IsLocked(timeNow(u.Clock)) {
+		return result, fosite.ErrAccessDenied
+	}
+
+	u.resetFailedLogins(&user)
+	return withoutSecrets(user), nil
+}
+
+// AuthenticateByUsername confirms whether the specified password matches the
+// stored hashed password within the User resource.
+// The User resource returned is matched by username. Disabled users aren't
+// found, so, as with a wrong password, are reported as
+// storage.ErrInvalidCredentials. A locked user, or a disabled user included by
+// the context, is denied only once the password has been verified. Wrong
+// passwords count towards locking the user out, see MaxFailedLogins, while a
+// successful authentication clears the count.
+func (u *UserManager) AuthenticateByUsername(ctx context.Context, username string, password string) (result storage.User, err error) {
+	user, err := u.GetByUsername(ctx, username)
+	if err != nil {
+		if err == fosite.ErrNotFound {
+			u.decoy.compare(ctx, u.Hasher, password)
+			return result, storage.ErrInvalidCredentials
+		}
+		return result, err
+	}
+
+	err = u.Hasher.Compare(ctx, []byte(user.Password), []byte(password))
+	if err != nil {
+		u.recordFailedLogin(user.ID)
+		return result, storage.ErrInvalidCredentials
+	}
+
+	// Deny disabled or locked users only once the password has been verified,
+	// so a user's state isn't revealed without it.
+	if user.Disabled || user.IsLocked(timeNow(u.Clock)) {
+		return result, fosite.ErrAccessDenied
+	}
+
+	u.resetFailedLogins(&user)
+	return user, nil
+}
+
+// AuthenticateMigration enables developers to supply your own
+// authentication function, which in turn, if true, will migrate the secret
+// to the Hasher implemented within fosite.
+// As with AuthenticateByID, a missing user and a wrong password are both
+// reported as storage.ErrInvalidCredentials, and a disabled or locked user is
+// denied only once the password has been verified.
+func (u *UserManager) AuthenticateMigration(ctx context.Context, currentAuth storage.AuthUserFunc, userID string, password string) (result storage.User, err error) {
+	// Authenticate with old Hasher
+	user, authenticated := currentAuth(ctx)
+
+	// Check for user not found
+	if user.IsEmpty() && !authenticated {
+		u.decoy.compare(ctx, u.Hasher, password)
+		return result, storage.ErrInvalidCredentials
+	}
+
+	if !authenticated {
+		// If user isn't authenticated, try authenticating with new Hasher.
+		err := u.Hasher.Compare(ctx, user.GetHashedSecret(), []byte(password))
+		if err != nil {
+			return result, storage.ErrInvalidCredentials
+		}
+	}
+
+	// Deny disabled or locked users only once the password has been verified,
+	// so a user's state isn't revealed without it.
+	if user.Disabled || user.IsLocked(timeNow(u.Clock)) {
+		return result, fosite.ErrAccessDenied
+	}
+
+	if !authenticated {
+		return user, nil
+	}
+
+	// If the user is found and authenticated, update the stored record with
+	// the password, which Update hashes using the new Hasher, and return the
+	// record with no error.
+	user.UpdateTime = timeNow(u.Clock).Unix()
+	user.Password = password
+
+	return u.Update(ctx, userID, user)
+}
+
+// GrantScopes grants the provided scopes to the specified User resource.
+func (u *UserManager) GrantScopes(_ context.Context, userID string, scopes []string) (result storage.User, err error) {
+	return u.setFields(userID, func(user *storage.User) {
+		user.EnableScopeAccess(scopes...)
+	})
+}
+
+// GrantScopesToMany grants the provided scopes to each of the specified User
+// resources.
+func (u *UserManager) GrantScopesToMany(_ context.Context, userIDs []string, scopes []string) (err error) {
+	if len(scopes) == 0 {
+		return nil
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	now := timeNow(u.Clock).Unix()
+	for _, userID := range userIDs {
+		user, ok := u.users[userID]
+		if !ok {
+			continue
+		}
+
+		// Scopes don't affect uniqueness, so the user can be stored without
+		// the conflict checks performed by put.
+		user = cloneUser(user)
+		user.EnableScopeAccess(scopes...)
+		user.UpdateTime = now
+		u.users[user.ID] = user
+	}
+
+	return nil
+}
+
+// RemoveScopes revokes the provided scopes from the specified User Resource.
+func (u *UserManager) RemoveScopes(_ context.Context, userID string, scopes []string) (result storage.User, err error) {
+	return u.setFields(userID, func(user *storage.User) {
+		user.DisableScopeAccess(scopes...)
+	})
+}
+
+// RemoveAllScopes revokes every scope from the specified User resource.
+func (u *UserManager) RemoveAllScopes(_ context.Context, userID string) (result storage.User, err error) {
+	return u.setFields(userID, func(user *storage.User) {
+		user.Scopes = []string{}
+	})
+}
+
+// Disable prevents the specified User resource from authenticating.
+func (u *UserManager) Disable(_ context.Context, userID string) (result storage.User, err error) {
+	return u.setFields(userID, func(user *storage.User) {
+		user.Disabled = true
+	})
+}
+
+// Enable allows a previously disabled User resource to authenticate again.
+func (u *UserManager) Enable(_ context.Context, userID string) (result storage.User, err error) {
+	return u.setFields(userID, func(user *storage.User) {
+		user.Disabled = false
+	})
+}
+
+// ResetFailedLogins clears the user's failed login count and lockout, so a
+// locked out user can authenticate again.
+func (u *UserManager) ResetFailedLogins(_ context.Context, userID string) (result storage.User, err error) {
+	return u.setFields(userID, func(user *storage.User) {
+		user.FailedLoginCount = 0
+		user.LockedUntil = 0
+	})
+}
+
+// SetEmailVerified sets whether the user's email address has been verified.
+func (u *UserManager) SetEmailVerified(_ context.Context, userID string, verified bool) (result storage.User, err error) {
+	return u.setFields(userID, func(user *storage.User) {
+		user.EmailVerified = verified
+	})
+}
+
+// VerifyEmailToken marks the email address of the user holding the token as
+// verified, clearing the token so it can't be used again. Returns
+// fosite.ErrNotFound if no user holds the token, or the token has expired.
+func (u *UserManager) VerifyEmailToken(_ context.Context, token string) (result storage.User, err error) {
+	if token == "" {
+		return result, fosite.ErrNotFound
+	}
+	now := timeNow(u.Clock)
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	for _, user := range u.users {
+		if user.EmailVerificationToken != token || user.EmailVerificationExpiry <= now.Unix() {
+			continue
+		}
+
+		user = cloneUser(user)
+		user.EmailVerified = true
+		user.EmailVerificationToken = ""
+		user.EmailVerificationExpiry = 0
+		user.UpdateTime = now.Unix()
+		u.users[user.ID] = user
+
+		return withoutSecrets(user), nil
+	}
+
+	return result, fosite.ErrNotFound
+}
+
+// EnrollTOTP enrolls the user in TOTP based multi-factor authentication,
+// replacing any existing enrollment. The recovery codes are hashed before
+// being stored and can each be consumed once via ConsumeRecoveryCode.
+func (u *UserManager) EnrollTOTP(ctx context.Context, userID string, secret string, recoveryCodes []string) (result storage.User, err error) {
+	hashedCodes := make([]string, 0, len(recoveryCodes))
+	for _, code := range recoveryCodes {
+		hash, err := u.Hasher.Hash(ctx, []byte(code))
+		if err != nil {
+			return result, err
+		}
+		hashedCodes = append(hashedCodes, string(hash))
+	}
+
+	return u.setFields(userID, func(user *storage.User) {
+		user.MFAEnabled = true
+		user.TOTPSecret = secret
+		user.RecoveryCodes = hashedCodes
+	})
+}
+
+// GetTOTPSecret returns the user's TOTP secret in order to verify a second
+// factor. Returns fosite.ErrNotFound if the user hasn't enrolled in MFA.
+func (u *UserManager) GetTOTPSecret(_ context.Context, userID string) (secret string, err error) {
+	user, err := u.getConcrete(userID)
+	if err != nil {
+		return "", err
+	}
+
+	if !user.MFAEnabled || user.TOTPSecret == "" {
+		return "", fosite.ErrNotFound
+	}
+
+	return user.TOTPSecret, nil
+}
+
+// DisableMFA removes the user's TOTP enrollment, including the TOTP secret and
+// any unused recovery codes.
+func (u *UserManager) DisableMFA(_ context.Context, userID string) (result storage.User, err error) {
+	return u.setFields(userID, func(user *storage.User) {
+		user.MFAEnabled = false
+		user.TOTPSecret = ""
+		user.RecoveryCodes = []string{}
+	})
+}
+
+// ConsumeRecoveryCode confirms whether the code matches one of the user's
+// unused recovery codes, and if so, removes it so it can't be used again.
+// Returns fosite.ErrAccessDenied if the code doesn't match.
+func (u *UserManager) ConsumeRecoveryCode(ctx context.Context, userID string, code string) (err error) {
+	user, err := u.getConcrete(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range user.RecoveryCodes {
+		if u.Hasher.Compare(ctx, []byte(hash), []byte(code)) != nil {
+			continue
+		}
+
+		// The code is only removed if it's still present, so that concurrent
+		// requests can't both consume the same code.
+		u.mutex.Lock()
+		defer u.mutex.Unlock()
+
+		current, ok := u.users[userID]
+		if !ok || !contains(current.RecoveryCodes, hash) {
+			return fosite.ErrAccessDenied
+		}
+
+		current = cloneUser(current)
+		for i := range current.RecoveryCodes {
+			if current.RecoveryCodes[i] == hash {
+				current.RecoveryCodes = append(current.RecoveryCodes[:i], current.RecoveryCodes[i+1:]...)
+				break
+			}
+		}
+		current.UpdateTime = timeNow(u.Clock).Unix()
+		u.users[userID] = current
+
+		return nil
+	}
+
+	return fosite.ErrAccessDenied
+}
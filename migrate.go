@@ -0,0 +1,100 @@
+package storage
+
+import (
+	// Standard Library Imports
+	"context"
+	"errors"
+	"io"
+)
+
+// MigrationSource provides the clients and users to migrate from another
+// storage backend, such as the ory/fosite SQL store.
+//
+// NextClient and NextUser return the next record to migrate, or io.EOF once
+// all records have been returned.
+type MigrationSource interface {
+	NextClient(ctx context.Context) (Client, error)
+	NextUser(ctx context.Context) (User, error)
+}
+
+// MigrationProgress reports the progress of a migration after each record
+// has been migrated.
+type MigrationProgress struct {
+	// Entity is the name of the entity being migrated.
+	Entity string
+	// ID is the ID of the record that has just been migrated.
+	ID string
+	// Migrated is the number of records of the entity migrated so far.
+	Migrated int
+	// Skipped is true if the record wasn't migrated as the stored record was
+	// migrated from the same or a newer version.
+	Skipped bool
+}
+
+// MigrationProgressFunc is called with the progress of a migration.
+type MigrationProgressFunc func(progress MigrationProgress)
+
+// Migrate streams the clients, then users, provided by source through the
+// migrators, reporting progress via the optional progress callback.
+//
+// Records are upserted with their IDs preserved, so a failed migration can be
+// safely re-run. Secrets and passwords are stored with their existing hashes,
+// so the migrators' AuthenticateMigration should be used to upgrade each hash
+// to fosite's hasher on the record's first successful authentication.
+//
+// Users with a SourceUpdatedAt don't overwrite users migrated from the same
+// or a newer version, and are reported as skipped.
+func Migrate(ctx context.Context, source MigrationSource, clients AuthClientMigrator, users AuthUserMigrator, progress MigrationProgressFunc) error {
+	if progress == nil {
+		progress = func(MigrationProgress) {}
+	}
+
+	for migrated := 1; ; migrated++ {
+		client, err := source.NextClient(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		client, err = clients.Migrate(ctx, client)
+		if err != nil {
+			return err
+		}
+
+		progress(MigrationProgress{
+			Entity:   EntityClients,
+			ID:       client.ID,
+			Migrated: migrated,
+		})
+	}
+
+	for migrated := 1; ; migrated++ {
+		user, err := source.NextUser(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		migratedUser, err := users.Migrate(ctx, user)
+		skipped := errors.Is(err, ErrMigrationStale)
+		if err != nil && !skipped {
+			return err
+		}
+		if !skipped {
+			user = migratedUser
+		}
+
+		progress(MigrationProgress{
+			Entity:   EntityUsers,
+			ID:       user.ID,
+			Migrated: migrated,
+			Skipped:  skipped,
+		})
+	}
+
+	return nil
+}
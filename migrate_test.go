@@ -0,0 +1,136 @@
+package storage
+
+import (
+	// Standard Library Imports
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	// External Imports
+	"github.com/stretchr/testify/assert"
+)
+
+// memorySource provides an in-memory MigrationSource.
+type memorySource struct {
+	clients []Client
+	users   []User
+}
+
+func (m *memorySource) NextClient(_ context.Context) (Client, error) {
+	if len(m.clients) == 0 {
+		return Client{}, io.EOF
+	}
+	client := m.clients[0]
+	m.clients = m.clients[1:]
+	return client, nil
+}
+
+func (m *memorySource) NextUser(_ context.Context) (User, error) {
+	if len(m.users) == 0 {
+		return User{}, io.EOF
+	}
+	user := m.users[0]
+	m.users = m.users[1:]
+	return user, nil
+}
+
+// memoryMigrator provides in-memory, upserting migrators.
+type memoryMigrator struct {
+	clients map[string]Client
+	users   map[string]User
+	err     error
+}
+
+func (m *memoryMigrator) Migrate(_ context.Context, client Client) (Client, error) {
+	if m.err != nil {
+		return Client{}, m.err
+	}
+	m.clients[client.ID] = client
+	return client, nil
+}
+
+func (m *memoryMigrator) AuthenticateMigration(_ context.Context, _ AuthClientFunc, _ string, _ string) (Client, error) {
+	return Client{}, nil
+}
+
+type memoryUserMigrator struct {
+	*memoryMigrator
+}
+
+func (m memoryUserMigrator) Migrate(_ context.Context, user User) (User, error) {
+	if existing, ok := m.users[user.ID]; ok && user.SourceUpdatedAt != 0 && existing.SourceUpdatedAt >= user.SourceUpdatedAt {
+		return User{}, ErrMigrationStale
+	}
+	m.users[user.ID] = user
+	return user, nil
+}
+
+func (m memoryUserMigrator) AuthenticateMigration(_ context.Context, _ AuthUserFunc, _ string, _ string) (User, error) {
+	return User{}, nil
+}
+
+func newMemorySource() *memorySource {
+	return &memorySource{
+		clients: []Client{{ID: "client-1", Secret: "$md5$cats"}, {ID: "client-2"}},
+		users:   []User{{ID: "user-1", Username: "kitteh@example.com", Password: "$md5$dogs"}},
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	migrator := &memoryMigrator{clients: map[string]Client{}, users: map[string]User{}}
+
+	var progress []MigrationProgress
+	report := func(p MigrationProgress) {
+		progress = append(progress, p)
+	}
+
+	// Migrating the same records twice should be idempotent.
+	for i := 0; i < 2; i++ {
+		progress = nil
+		err := Migrate(context.Background(), newMemorySource(), migrator, memoryUserMigrator{migrator}, report)
+		assert.NoError(t, err)
+	}
+
+	assert.Len(t, migrator.clients, 2)
+	assert.Len(t, migrator.users, 1)
+	assert.Equal(t, "$md5$cats", migrator.clients["client-1"].Secret, "existing hashes should be preserved")
+	assert.Equal(t, []MigrationProgress{
+		{Entity: EntityClients, ID: "client-1", Migrated: 1},
+		{Entity: EntityClients, ID: "client-2", Migrated: 2},
+		{Entity: EntityUsers, ID: "user-1", Migrated: 1},
+	}, progress)
+}
+
+func TestMigrate_ShouldReturnMigratorErrors(t *testing.T) {
+	expected := errors.New("boom")
+	migrator := &memoryMigrator{clients: map[string]Client{}, users: map[string]User{}, err: expected}
+
+	err := Migrate(context.Background(), newMemorySource(), migrator, memoryUserMigrator{migrator}, nil)
+	assert.Equal(t, expected, err)
+	assert.Empty(t, migrator.users, "users should not be migrated after a client fails")
+}
+
+func TestMigrate_ShouldReportSkippedUsers(t *testing.T) {
+	migrator := &memoryMigrator{clients: map[string]Client{}, users: map[string]User{
+		"user-1": {ID: "user-1", FirstName: "Newer", SourceUpdatedAt: 200},
+	}}
+	source := &memorySource{
+		users: []User{
+			{ID: "user-1", FirstName: "Older", SourceUpdatedAt: 100},
+			{ID: "user-2", SourceUpdatedAt: 100},
+		},
+	}
+
+	var progress []MigrationProgress
+	err := Migrate(context.Background(), source, migrator, memoryUserMigrator{migrator}, func(p MigrationProgress) {
+		progress = append(progress, p)
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "Newer", migrator.users["user-1"].FirstName, "newer users should not be overwritten")
+	assert.Equal(t, []MigrationProgress{
+		{Entity: EntityUsers, ID: "user-1", Migrated: 1, Skipped: true},
+		{Entity: EntityUsers, ID: "user-2", Migrated: 2},
+	}, progress)
+}
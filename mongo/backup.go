@@ -0,0 +1,183 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	// External Imports
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// backupVersion provides the schema version of the export format, which
+// enables imports to reject exports they are unable to understand.
+const backupVersion = 1
+
+// backupEntities lists the long-lived entities that are always exported.
+var backupEntities = []string{
+	storage.EntityClients,
+	storage.EntityUsers,
+	storage.EntityConsents,
+}
+
+// sessionEntities lists the entities that store token and session requests.
+var sessionEntities = []string{
+	storage.EntityAccessTokens,
+	storage.EntityAuthorizationCodes,
+	storage.EntityOpenIDSessions,
+	storage.EntityPKCESessions,
+	storage.EntityRefreshTokens,
+}
+
+// backupHeader is the first line of an export.
+type backupHeader struct {
+	Version  int      `json:"version"`
+	Entities []string `json:"entities"`
+}
+
+// backupRecord is a single document within an export.
+type backupRecord struct {
+	Entity   string          `json:"entity"`
+	Document json.RawMessage `json:"document"`
+}
+
+// Export streams the stored clients, users and consents to w as newline
+// delimited JSON, for disaster recovery or cloning environments. If
+// includeSessions is set, the token and session records are exported too.
+//
+// The first line is a header containing the export schema version and the
+// exported entities, followed by one line per document. Documents are encoded
+// as canonical MongoDB Extended JSON so that types survive the round trip.
+func (s *Store) Export(ctx context.Context, w io.Writer, includeSessions bool) error {
+	entities := append([]string{}, backupEntities...)
+	if includeSessions {
+		entities = append(entities, sessionEntities...)
+	}
+
+	enc := json.NewEncoder(w)
+	err := enc.Encode(backupHeader{
+		Version:  backupVersion,
+		Entities: entities,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, entity := range entities {
+		if err = s.exportEntity(ctx, enc, entity); err != nil {
+			return classify(err)
+		}
+	}
+
+	return nil
+}
+
+// exportEntity writes every document in the entity's collection to enc.
+func (s *Store) exportEntity(ctx context.Context, enc *json.Encoder, entity string) error {
+	collection, err := s.DB.collection(ctx, entity)
+	if err != nil {
+		return err
+	}
+	cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return err
+	}
+
+	return iterate(ctx, cursor, func(raw bson.Raw) error {
+		document, err := bson.MarshalExtJSON(raw, true, false)
+		if err != nil {
+			return err
+		}
+
+		return enc.Encode(backupRecord{
+			Entity:   entity,
+			Document: document,
+		})
+	})
+}
+
+// Import restores an export produced by Export. Documents are upserted, so
+// existing records are overwritten and importing the same export more than
+// once is safe.
+//
+// Import does not create indices, so call EnsureIndexes when restoring into
+// an empty database.
+func (s *Store) Import(ctx context.Context, r io.Reader) error {
+	dec := json.NewDecoder(r)
+
+	var header backupHeader
+	if err := dec.Decode(&header); err != nil {
+		return fmt.Errorf("%w: unable to read header: %s", ErrInvalidBackup, err)
+	}
+	if header.Version != backupVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidBackup, header.Version)
+	}
+
+	known := map[string]bool{}
+	for _, entity := range append(backupEntities, sessionEntities...) {
+		known[entity] = true
+	}
+	entities := map[string]bool{}
+	for _, entity := range header.Entities {
+		if !known[entity] {
+			return fmt.Errorf("%w: unsupported entity %s", ErrInvalidBackup, entity)
+		}
+		entities[entity] = true
+	}
+
+	for {
+		var record backupRecord
+		err := dec.Decode(&record)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: unable to read record: %s", ErrInvalidBackup, err)
+		}
+
+		if !entities[record.Entity] {
+			return fmt.Errorf("%w: record for entity %s missing from header", ErrInvalidBackup, record.Entity)
+		}
+
+		if err = s.importRecord(ctx, record); err != nil {
+			return classify(err)
+		}
+	}
+}
+
+// importRecord upserts the record's document into the entity's collection.
+func (s *Store) importRecord(ctx context.Context, record backupRecord) error {
+	var document bson.D
+	if err := bson.UnmarshalExtJSON(record.Document, true, &document); err != nil {
+		return fmt.Errorf("%w: unable to decode %s document: %s", ErrInvalidBackup, record.Entity, err)
+	}
+
+	var id interface{}
+	for _, elem := range document {
+		if elem.Key == "_id" {
+			id = elem.Value
+			break
+		}
+	}
+	if id == nil {
+		return fmt.Errorf("%w: %s document is missing an _id", ErrInvalidBackup, record.Entity)
+	}
+
+	// Build Query
+	selector := bson.M{
+		"_id": id,
+	}
+
+	collection, err := s.DB.collection(ctx, record.Entity)
+	if err != nil {
+		return err
+	}
+	_, err = collection.ReplaceOne(ctx, selector, document, options.Replace().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,145 @@
+package mongo_test
+
+import (
+	// Standard Library Imports
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	// External Imports
+	"github.com/google/uuid"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+	"github.com/p000ic/go-fosite-mongo/mongo"
+)
+
+func TestStore_Export_ShouldRoundTrip(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	client := createClient(ctx, t, store)
+	user := createUser(ctx, t, store)
+	signature := uuid.NewString()
+	err := store.CreateRefreshTokenSession(ctx, signature, newRequester(client.ID, user.ID))
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	var backup bytes.Buffer
+	err = store.Export(ctx, &backup, true)
+	if err != nil {
+		AssertFatal(t, err, nil, "export should return no errors")
+	}
+
+	err = store.DB.Drop(ctx)
+	if err != nil {
+		AssertFatal(t, err, nil, "drop should return no database errors")
+	}
+	err = store.EnsureIndexes(ctx)
+	if err != nil {
+		AssertFatal(t, err, nil, "ensure indexes should return no database errors")
+	}
+
+	// Importing twice should be idempotent.
+	exported := backup.Bytes()
+	for i := 0; i < 2; i++ {
+		err = store.Import(ctx, bytes.NewReader(exported))
+		if err != nil {
+			AssertFatal(t, err, nil, "import should return no errors")
+		}
+	}
+
+	gotClient, err := store.ClientManager.Get(ctx, client.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "get client should return no database errors")
+	}
+	if !gotClient.Equal(client) {
+		AssertError(t, gotClient, client, "client should round-trip")
+	}
+
+	gotUser, err := store.UserManager.Get(ctx, user.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "get user should return no database errors")
+	}
+	if !gotUser.Equal(user) {
+		AssertError(t, gotUser, user, "user should round-trip")
+	}
+
+	stats, err := store.Stats(ctx, false)
+	if err != nil {
+		AssertFatal(t, err, nil, "stats should return no database errors")
+	}
+	expected := map[string]int64{
+		storage.EntityClients:       1,
+		storage.EntityUsers:         1,
+		storage.EntityRefreshTokens: 1,
+	}
+	for entity, count := range expected {
+		if stats[entity] != count {
+			AssertError(t, stats[entity], count, "import should restore each document once for "+entity)
+		}
+	}
+}
+
+func TestStore_Export_ShouldExcludeSessions(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	err := store.CreateRefreshTokenSession(ctx, uuid.NewString(), newRequester(uuid.NewString(), uuid.NewString()))
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	var backup bytes.Buffer
+	err = store.Export(ctx, &backup, false)
+	if err != nil {
+		AssertFatal(t, err, nil, "export should return no errors")
+	}
+	if strings.Contains(backup.String(), storage.EntityRefreshTokens) {
+		AssertError(t, backup.String(), "no sessions", "export should exclude sessions unless requested")
+	}
+}
+
+func TestStore_Import_ShouldRejectInvalidBackup(t *testing.T) {
+	tests := []struct {
+		name   string
+		backup string
+	}{
+		{
+			name:   "should reject an empty backup",
+			backup: "",
+		},
+		{
+			name:   "should reject an unsupported version",
+			backup: `{"version":2,"entities":["oauth2_client"]}`,
+		},
+		{
+			name:   "should reject an unsupported entity",
+			backup: `{"version":1,"entities":["oauth2_cats"]}`,
+		},
+		{
+			name: "should reject a record for an entity missing from the header",
+			backup: `{"version":1,"entities":["oauth2_client"]}
+{"entity":"oauth2_user","document":{"_id":{"$oid":"5f1b3c1e9d1e8a0001a1b2c3"}}}`,
+		},
+		{
+			name: "should reject a document without an _id",
+			backup: `{"version":1,"entities":["oauth2_client"]}
+{"entity":"oauth2_client","document":{"id":"cats"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &mongo.Store{}
+
+			err := store.Import(context.Background(), strings.NewReader(tt.backup))
+			if !errors.Is(err, mongo.ErrInvalidBackup) {
+				AssertError(t, err, mongo.ErrInvalidBackup, "import should reject an invalid backup")
+			}
+		})
+	}
+}
@@ -6,7 +6,7 @@ import (
 	"time"
 
 	// External Imports
-	"github.com/google/uuid"
+	"github.com/go-jose/go-jose/v3"
 	"github.com/ory/fosite"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -28,18 +28,61 @@ type ClientManager struct {
 	DB     *DB
 	Hasher fosite.Hasher
 
+	// IDGenerator generates IDs for newly created clients. Defaults to
+	// generating UUIDs if not set.
+	IDGenerator func() string
+
+	// Clock provides the current time. Defaults to time.Now if not set.
+	Clock func() time.Time
+
+	// AllowDisabledClients returns disabled clients from GetClient, restoring
+	// the behaviour prior to disabled clients being rejected by fosite.
+	AllowDisabledClients bool
+
+	// RequirePKCEForPublicClients enforces PKCE for all public clients
+	// returned by GetClient, regardless of the client's EnforcePKCE setting.
+	RequirePKCEForPublicClients bool
+
+	// StrictClientSecrets rejects public clients with a secret, and
+	// confidential clients without one, on create and update, see
+	// storage.Client.ValidateSecret. Public clients are stored without a
+	// secret.
+	StrictClientSecrets bool
+
+	// Hooks, if set, observes and can veto the clients created, updated and
+	// deleted via Create, GetOrCreate, Migrate, Upsert, Update and Delete.
+	// Targeted updates, such as GrantScopes, aren't hooked.
+	Hooks storage.Hooks[storage.Client]
+
 	DeniedJTIs storage.DeniedJTIStore
+
+	decoy decoyHash
+}
+
+// hooks returns the configured hooks, defaulting to allowing every change.
+func (c *ClientManager) hooks() storage.Hooks[storage.Client] {
+	if c.Hooks == nil {
+		return storage.NopHooks[storage.Client]{}
+	}
+
+	return c.Hooks
 }
 
 // Configure sets up the Mongo collection for OAuth 2.0 client resources.
 func (c *ClientManager) Configure(ctx context.Context) (err error) {
+	defer classifyError(&err)
+
 	// Build Index
 	indices := []mongo.IndexModel{
 		NewUniqueIndex(IdxClientID, "id"),
+		NewIndex(IdxCompoundContacts, "contacts", "id"),
 	}
 
-	collection := c.DB.Collection(storage.EntityClients)
-	_, err = collection.Indexes().CreateMany(ctx, indices)
+	collection, err := c.DB.collection(ctx, storage.EntityClients)
+	if err != nil {
+		return err
+	}
+	err = createIndexes(ctx, collection, indices...)
 	if err != nil {
 		return err
 	}
@@ -47,6 +90,12 @@ func (c *ClientManager) Configure(ctx context.Context) (err error) {
 	return nil
 }
 
+// clientProjection excludes mongo's document ID when reading clients, which
+// would otherwise be captured as unmodeled client metadata in Client.Extra.
+var clientProjection = bson.M{
+	"_id": 0,
+}
+
 // getConcrete returns an OAuth 2.0 Client resource.
 func (c *ClientManager) getConcrete(ctx context.Context, clientID string) (result storage.Client, err error) {
 	// Build Query
@@ -54,8 +103,45 @@ func (c *ClientManager) getConcrete(ctx context.Context, clientID string) (resul
 		"id": clientID,
 	}
 	var storageClient storage.Client
-	collection := c.DB.Collection(storage.EntityClients)
-	err = collection.FindOne(ctx, query).Decode(&storageClient)
+	collection, err := c.DB.collection(ctx, storage.EntityClients)
+	if err != nil {
+		return result, err
+	}
+	err = collection.FindOne(ctx, query, options.FindOne().SetProjection(clientProjection)).Decode(&storageClient)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return result, fosite.ErrNotFound
+		}
+		return result, err
+	}
+
+	return storageClient, nil
+}
+
+// setFields performs a targeted update of the provided fields on the
+// specified client, bumping the client's update time, and returns the updated
+// client. Unlike Update, fields that aren't specified are left untouched, so
+// concurrent edits to other fields aren't clobbered.
+func (c *ClientManager) setFields(ctx context.Context, clientID string, fields bson.M) (result storage.Client, err error) {
+	fields["updated_at"] = c.DB.timestamp(timeNow(c.Clock))
+
+	// Build Query
+	selector := bson.M{
+		"id": clientID,
+	}
+	update := bson.M{
+		"$set": fields,
+	}
+
+	var storageClient storage.Client
+	collection, err := c.DB.collection(ctx, storage.EntityClients)
+	if err != nil {
+		return result, err
+	}
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetProjection(clientProjection)
+	err = collection.FindOneAndUpdate(ctx, selector, update, opts).Decode(&storageClient)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return result, fosite.ErrNotFound
@@ -68,6 +154,8 @@ func (c *ClientManager) getConcrete(ctx context.Context, clientID string) (resul
 
 // List filters resources to return a list of OAuth 2.0 client resources.
 func (c *ClientManager) List(ctx context.Context, filter storage.ListClientsRequest) (results []storage.Client, err error) {
+	defer classifyError(&err)
+
 	// Build Query
 	query := bson.M{}
 	if filter.AllowedTenantAccess != "" {
@@ -79,6 +167,9 @@ func (c *ClientManager) List(ctx context.Context, filter storage.ListClientsRequ
 	if filter.RedirectURI != "" {
 		query["redirect_uris"] = filter.RedirectURI
 	}
+	if filter.AllowedCORSOrigin != "" {
+		query["allowed_cors_origins"] = filter.AllowedCORSOrigin
+	}
 	if filter.GrantType != "" {
 		query["grant_types"] = filter.GrantType
 	}
@@ -91,6 +182,7 @@ func (c *ClientManager) List(ctx context.Context, filter storage.ListClientsRequ
 	if len(filter.ScopesUnion) > 0 {
 		query["scopes"] = bson.M{"$in": filter.ScopesUnion}
 	}
+	filterScopePrefix(query, filter.ScopePrefix)
 	if filter.Contact != "" {
 		query["contacts"] = filter.Contact
 	}
@@ -103,8 +195,24 @@ func (c *ClientManager) List(ctx context.Context, filter storage.ListClientsRequ
 	if filter.Published {
 		query["published"] = filter.Published
 	}
-	collection := c.DB.Collection(storage.EntityClients)
-	cursor, err := collection.Find(ctx, query)
+
+	findOptions := options.Find().SetProjection(clientProjection)
+	if filter.After != "" || filter.Limit > 0 {
+		// Page by ID so results remain stable as records are added.
+		findOptions.SetSort(bson.D{{Key: "id", Value: 1}})
+		if filter.After != "" {
+			query["id"] = bson.M{"$gt": filter.After}
+		}
+		if filter.Limit > 0 {
+			findOptions.SetLimit(filter.Limit)
+		}
+	}
+
+	collection, err := c.DB.collection(ctx, storage.EntityClients)
+	if err != nil {
+		return results, err
+	}
+	cursor, err := collection.Find(ctx, query, findOptions)
 	if err != nil {
 		return results, err
 	}
@@ -118,25 +226,59 @@ func (c *ClientManager) List(ctx context.Context, filter storage.ListClientsRequ
 	return clients, nil
 }
 
-// Create stores a new OAuth2.0 Client resource.
+// ListByScope returns the OAuth 2.0 client resources permitted to request the
+// provided scope.
+func (c *ClientManager) ListByScope(ctx context.Context, scope string) (results []storage.Client, err error) {
+	defer classifyError(&err)
+
+	return c.List(ctx, storage.ListClientsRequest{
+		ScopesIntersection: []string{scope},
+	})
+}
+
+// ListByContact returns the OAuth 2.0 client resources the provided contact,
+// typically an email address, is listed as being responsible for.
+func (c *ClientManager) ListByContact(ctx context.Context, contact string) (results []storage.Client, err error) {
+	defer classifyError(&err)
+
+	return c.List(ctx, storage.ListClientsRequest{
+		Contact: contact,
+	})
+}
+
+// Create stores a new OAuth2.0 Client resource. Clients allowed unknown grant
+// or response types are rejected, see storage.Client.Validate.
 func (c *ClientManager) Create(ctx context.Context, client storage.Client) (result storage.Client, err error) {
+	defer classifyError(&err)
+
+	err = client.Validate()
+	if err != nil {
+		return result, err
+	}
+
 	// Enable developers to provide their own IDs
 	if client.ID == "" {
-		client.ID = uuid.NewString()
+		client.ID = generateID(c.IDGenerator)
 	}
 	if client.CreateTime == 0 {
-		client.CreateTime = time.Now().Unix()
+		client.CreateTime = timeNow(c.Clock).Unix()
 	}
 
-	// Hash incoming secret
-	hash, err := c.Hasher.Hash(ctx, []byte(client.Secret))
+	err = c.hooks().BeforeCreate(ctx, client)
+	if err != nil {
+		return result, err
+	}
+
+	client.Secret, err = c.createSecret(ctx, client)
 	if err != nil {
 		return result, err
 	}
-	client.Secret = string(hash)
 
 	// Create resource
-	collection := c.DB.Collection(storage.EntityClients)
+	collection, err := c.DB.collection(ctx, storage.EntityClients)
+	if err != nil {
+		return result, err
+	}
 	_, err = collection.InsertOne(ctx, client)
 	if err != nil {
 		if mongo.IsDuplicateKeyError(err) {
@@ -145,15 +287,254 @@ func (c *ClientManager) Create(ctx context.Context, client storage.Client) (resu
 		return result, err
 	}
 
+	c.hooks().AfterCreate(ctx, client)
 	return client, nil
 }
 
+// createSecret enforces the secret rules for a client being created, returning
+// the secret to store: the hash of the client's secret, unless the client is
+// strictly secretless. Shared by each path creating a client, so they enforce
+// the same rules.
+func (c *ClientManager) createSecret(ctx context.Context, client storage.Client) (string, error) {
+	if c.StrictClientSecrets {
+		err := client.ValidateSecret()
+		if err != nil {
+			return "", err
+		}
+		if client.Public {
+			return "", nil
+		}
+	}
+
+	hash, err := c.Hasher.Hash(ctx, []byte(client.Secret))
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// GetOrCreate returns the OAuth 2.0 client resource matching the client's ID,
+// creating it if it does not already exist. created reports whether the
+// client was created by this call. As with Create, clients allowed unknown
+// grant or response types are rejected, see storage.Client.Validate.
+func (c *ClientManager) GetOrCreate(ctx context.Context, client storage.Client) (result storage.Client, created bool, err error) {
+	defer classifyError(&err)
+
+	err = client.Validate()
+	if err != nil {
+		return result, false, err
+	}
+
+	// Enable developers to provide their own IDs
+	if client.ID == "" {
+		client.ID = generateID(c.IDGenerator)
+	}
+
+	// Avoid hashing the secret if the client already exists.
+	existing, err := c.getConcrete(ctx, client.ID)
+	if err == nil {
+		return existing, false, nil
+	}
+	if err != fosite.ErrNotFound {
+		return result, false, err
+	}
+
+	if client.CreateTime == 0 {
+		client.CreateTime = timeNow(c.Clock).Unix()
+	}
+
+	err = c.hooks().BeforeCreate(ctx, client)
+	if err != nil {
+		return result, false, err
+	}
+
+	client.Secret, err = c.createSecret(ctx, client)
+	if err != nil {
+		return result, false, err
+	}
+
+	// Build Query
+	selector := bson.M{
+		"id": client.ID,
+	}
+	update := bson.M{
+		"$setOnInsert": client,
+	}
+
+	collection, err := c.DB.collection(ctx, storage.EntityClients)
+	if err != nil {
+		return result, created, err
+	}
+	res, err := collection.UpdateOne(ctx, selector, update, options.Update().SetUpsert(true))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return result, false, err
+	}
+	if err == nil && res.UpsertedCount > 0 {
+		c.hooks().AfterCreate(ctx, client)
+		return client, true, nil
+	}
+
+	// The client was created concurrently, either matching the upsert
+	// selector, or winning the race on the unique index.
+	existing, err = c.getConcrete(ctx, client.ID)
+	if err != nil {
+		return result, false, err
+	}
+
+	return existing, false, nil
+}
+
+// Upsert creates the OAuth 2.0 client resource, or updates it if it already
+// exists, so that clients can be declared idempotently. On update, the stored
+// secret hash is kept if the secret is blank or unchanged, otherwise the new
+// secret is hashed, and the original create time is preserved.
+func (c *ClientManager) Upsert(ctx context.Context, client storage.Client) (result storage.Client, err error) {
+	defer classifyError(&err)
+
+	err = client.Validate()
+	if err != nil {
+		return result, err
+	}
+
+	// Copy a new DB session if none specified
+	_, ok := ContextToSession(ctx)
+	if !ok {
+		var closeSession func()
+		ctx, closeSession, err = newSession(ctx, c.DB)
+		if err != nil {
+			return result, err
+		}
+		defer closeSession()
+	}
+
+	// Enable developers to provide their own IDs
+	if client.ID == "" {
+		client.ID = generateID(c.IDGenerator)
+	}
+
+	existing, err := c.getConcrete(ctx, client.ID)
+	if err == fosite.ErrNotFound {
+		result, err = c.Create(ctx, client)
+		if err != storage.ErrResourceExists {
+			return result, err
+		}
+
+		// The client was created concurrently, so update it instead.
+		existing, err = c.getConcrete(ctx, client.ID)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	err = c.hooks().BeforeUpdate(ctx, client)
+	if err != nil {
+		return result, err
+	}
+
+	client.Secret, err = c.upsertSecret(ctx, existing.Secret, client.Secret)
+	if err != nil {
+		return result, err
+	}
+
+	if c.StrictClientSecrets {
+		if client.Public && client.Secret == existing.Secret {
+			// Drop any secret held while the client was confidential.
+			client.Secret = ""
+		}
+		err = client.ValidateSecret()
+		if err != nil {
+			return result, err
+		}
+	}
+
+	client.CreateTime = existing.CreateTime
+	client.UpdateTime = timeNow(c.Clock).Unix()
+	if client.Extra == nil {
+		// Preserve unmodeled metadata the caller may not be aware of.
+		client.Extra = existing.Extra
+	}
+	// Secret rotation is only managed via RotateSecret.
+	client.PreviousSecret = existing.PreviousSecret
+	client.PreviousSecretExpiry = existing.PreviousSecretExpiry
+
+	// Build Query
+	selector := bson.M{
+		"id": client.ID,
+	}
+
+	collection, err := c.DB.collection(ctx, storage.EntityClients)
+	if err != nil {
+		return result, err
+	}
+	res, err := collection.ReplaceOne(ctx, selector, client)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return result, storage.ErrResourceExists
+		}
+		return result, err
+	}
+
+	if res.MatchedCount == 0 {
+		return result, fosite.ErrNotFound
+	}
+
+	c.hooks().AfterUpdate(ctx, client)
+	return client, nil
+}
+
+// upsertSecret returns the hash to store for an upserted client's secret,
+// keeping the existing hash if the secret is blank, is the existing hash, or
+// matches the existing hash.
+func (c *ClientManager) upsertSecret(ctx context.Context, hash string, secret string) (string, error) {
+	if secret == "" || secret == hash {
+		return hash, nil
+	}
+
+	if c.Hasher.Compare(ctx, []byte(hash), []byte(secret)) == nil {
+		return hash, nil
+	}
+
+	newHash, err := c.Hasher.Hash(ctx, []byte(secret))
+	if err != nil {
+		return "", err
+	}
+
+	return string(newHash), nil
+}
+
 // Get finds and returns an OAuth 2.0 client resource.
 func (c *ClientManager) Get(ctx context.Context, clientID string) (result storage.Client, err error) {
+	defer classifyError(&err)
+
 	return c.getConcrete(ctx, clientID)
 }
 
-// GetClient finds and returns an OAuth 2.0 client resource.
+// Exists returns whether an OAuth 2.0 client resource exists with the given
+// client ID.
+func (c *ClientManager) Exists(ctx context.Context, clientID string) (exists bool, err error) {
+	defer classifyError(&err)
+
+	// Build Query
+	query := bson.M{
+		"id": clientID,
+	}
+
+	collection, err := c.DB.collection(ctx, storage.EntityClients)
+	if err != nil {
+		return false, err
+	}
+	count, err := collection.CountDocuments(ctx, query, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// GetClient finds and returns an OAuth 2.0 client resource. Disabled clients
+// are reported as not found, so fosite rejects them as invalid, unless
+// AllowDisabledClients is set.
 //
 // GetClient implements:
 // - fosite.Storage
@@ -161,8 +542,17 @@ func (c *ClientManager) Get(ctx context.Context, clientID string) (result storag
 func (c *ClientManager) GetClient(ctx context.Context, clientID string) (fosite.Client, error) {
 	client, err := c.getConcrete(ctx, clientID)
 	if err != nil {
-		return nil, err
+		return nil, classify(err)
+	}
+
+	if client.Disabled && !c.AllowDisabledClients {
+		return nil, fosite.ErrNotFound
+	}
+
+	if client.Public && c.RequirePKCEForPublicClients {
+		client.EnforcePKCE = true
 	}
+
 	return &client, nil
 }
 
@@ -182,7 +572,7 @@ func (c *ClientManager) ClientAssertionJWTValid(ctx context.Context, jti string)
 		}
 	}
 
-	if time.Unix(deniedJti.Expiry, 0).After(time.Now()) {
+	if time.Unix(deniedJti.Expiry, 0).After(timeNow(c.Clock)) {
 		// the jti is not expired yet => invalid
 		return fosite.ErrJTIKnown
 	}
@@ -194,6 +584,8 @@ func (c *ClientManager) ClientAssertionJWTValid(ctx context.Context, jti string)
 // Before inserting the new JTI, it will clean up any existing JTIs that have
 // expired as those tokens can not be replayed due to the expiry.
 func (c *ClientManager) SetClientAssertionJWT(ctx context.Context, jti string, exp time.Time) (err error) {
+	defer classifyError(&err)
+
 	// Copy a new DB session if none specified
 	_, ok := ContextToSession(ctx)
 	if !ok {
@@ -206,14 +598,11 @@ func (c *ClientManager) SetClientAssertionJWT(ctx context.Context, jti string, e
 	}
 
 	// delete expired JTIs
-	err = c.DeniedJTIs.DeleteBefore(ctx, time.Now().Unix())
-	if err != nil {
-		switch err {
-		case fosite.ErrNotFound:
-			return
-		default:
-			return err
-		}
+	err = c.DeniedJTIs.DeleteBefore(ctx, timeNow(c.Clock).Unix())
+	if err != nil && err != fosite.ErrNotFound {
+		// Note: If no expired JTIs were found, there is nothing to clean up,
+		// but the JTI must still be denied.
+		return err
 	}
 
 	_, err = c.DeniedJTIs.Create(ctx, storage.NewDeniedJTI(jti, exp))
@@ -230,8 +619,16 @@ func (c *ClientManager) SetClientAssertionJWT(ctx context.Context, jti string, e
 	return nil
 }
 
-// Update updates an OAuth 2.0 client resource.
+// Update updates an OAuth 2.0 client resource. Clients allowed unknown grant
+// or response types are rejected, see storage.Client.Validate.
 func (c *ClientManager) Update(ctx context.Context, clientID string, updatedClient storage.Client) (result storage.Client, err error) {
+	defer classifyError(&err)
+
+	err = updatedClient.Validate()
+	if err != nil {
+		return result, err
+	}
+
 	// Copy a new DB session if none specified
 	_, ok := ContextToSession(ctx)
 	if !ok {
@@ -253,8 +650,19 @@ func (c *ClientManager) Update(ctx context.Context, clientID string, updatedClie
 
 	// Deny updating the entity Id
 	updatedClient.ID = clientID
+
+	err = c.hooks().BeforeUpdate(ctx, updatedClient)
+	if err != nil {
+		return result, err
+	}
+
 	// Update modified time
-	updatedClient.UpdateTime = time.Now().Unix()
+	updatedClient.UpdateTime = timeNow(c.Clock).Unix()
+
+	if updatedClient.Extra == nil {
+		// Preserve unmodeled metadata the caller may not be aware of.
+		updatedClient.Extra = currentResource.Extra
+	}
 
 	if currentResource.Secret == updatedClient.Secret || updatedClient.Secret == "" {
 		// If the password/hash is blank or hash matches, set using old hash.
@@ -267,12 +675,29 @@ func (c *ClientManager) Update(ctx context.Context, clientID string, updatedClie
 		// updatedClient.Secret = string(newHash)
 	}
 
+	if c.StrictClientSecrets {
+		if updatedClient.Public && updatedClient.Secret == currentResource.Secret {
+			// Drop any secret held while the client was confidential.
+			updatedClient.Secret = ""
+		}
+		err = updatedClient.ValidateSecret()
+		if err != nil {
+			return result, err
+		}
+	}
+	// Secret rotation is only managed via RotateSecret.
+	updatedClient.PreviousSecret = currentResource.PreviousSecret
+	updatedClient.PreviousSecretExpiry = currentResource.PreviousSecretExpiry
+
 	// Build Query
 	selector := bson.M{
 		"id": clientID,
 	}
 
-	collection := c.DB.Collection(storage.EntityClients)
+	collection, err := c.DB.collection(ctx, storage.EntityClients)
+	if err != nil {
+		return result, err
+	}
 	res, err := collection.ReplaceOne(ctx, selector, updatedClient)
 	if err != nil {
 		if mongo.IsDuplicateKeyError(err) {
@@ -285,6 +710,7 @@ func (c *ClientManager) Update(ctx context.Context, clientID string, updatedClie
 		return result, fosite.ErrNotFound
 	}
 
+	c.hooks().AfterUpdate(ctx, updatedClient)
 	return updatedClient, nil
 }
 
@@ -292,17 +718,47 @@ func (c *ClientManager) Update(ctx context.Context, clientID string, updatedClie
 // upgrade their password using the AuthClientMigrator interface.
 // This performs an upsert, either creating or overwriting the record with the
 // newly provided full record. Use with caution, be secure, don't be dumb.
+// Clients allowed unknown grant or response types are rejected, see
+// storage.Client.Validate. BeforeCreate, or BeforeUpdate if the client
+// exists, is called with the migrated client, including its already hashed
+// secret.
 func (c *ClientManager) Migrate(ctx context.Context, migratedClient storage.Client) (result storage.Client, err error) {
+	defer classifyError(&err)
+
+	err = migratedClient.Validate()
+	if err != nil {
+		return result, err
+	}
+
 	// Generate a unique ID if not supplied
 	if migratedClient.ID == "" {
-		migratedClient.ID = uuid.NewString()
+		migratedClient.ID = generateID(c.IDGenerator)
 	}
 	// Update create time
 	if migratedClient.CreateTime == 0 {
-		migratedClient.CreateTime = time.Now().Unix()
+		migratedClient.CreateTime = timeNow(c.Clock).Unix()
 	} else {
 		// Update modified time
-		migratedClient.UpdateTime = time.Now().Unix()
+		migratedClient.UpdateTime = timeNow(c.Clock).Unix()
+	}
+	existing, err := c.getConcrete(ctx, migratedClient.ID)
+	found := err == nil
+	if err != nil && err != fosite.ErrNotFound {
+		return result, err
+	}
+	if migratedClient.Extra == nil {
+		// Preserve unmodeled metadata the migration source may not be aware
+		// of.
+		migratedClient.Extra = existing.Extra
+	}
+
+	if found {
+		err = c.hooks().BeforeUpdate(ctx, migratedClient)
+	} else {
+		err = c.hooks().BeforeCreate(ctx, migratedClient)
+	}
+	if err != nil {
+		return result, err
 	}
 
 	// Build Query
@@ -310,7 +766,10 @@ func (c *ClientManager) Migrate(ctx context.Context, migratedClient storage.Clie
 		"id": migratedClient.ID,
 	}
 
-	collection := c.DB.Collection(storage.EntityClients)
+	collection, err := c.DB.collection(ctx, storage.EntityClients)
+	if err != nil {
+		return result, err
+	}
 	opts := options.Replace().SetUpsert(true)
 	res, err := collection.ReplaceOne(ctx, selector, migratedClient, opts)
 	if err != nil {
@@ -320,20 +779,35 @@ func (c *ClientManager) Migrate(ctx context.Context, migratedClient storage.Clie
 		return result, err
 	}
 
-	if res.MatchedCount == 0 {
+	if res.MatchedCount == 0 && res.UpsertedCount == 0 {
 		return result, fosite.ErrNotFound
 	}
 
+	if found {
+		c.hooks().AfterUpdate(ctx, migratedClient)
+	} else {
+		c.hooks().AfterCreate(ctx, migratedClient)
+	}
 	return migratedClient, nil
 }
 
 // Delete removes an OAuth 2.0 Client resource.
 func (c *ClientManager) Delete(ctx context.Context, clientID string) (err error) {
+	defer classifyError(&err)
+
+	err = c.hooks().BeforeDelete(ctx, clientID)
+	if err != nil {
+		return err
+	}
+
 	// Build Query
 	query := bson.M{
 		"id": clientID,
 	}
-	collection := c.DB.Collection(storage.EntityClients)
+	collection, err := c.DB.collection(ctx, storage.EntityClients)
+	if err != nil {
+		return err
+	}
 	res, err := collection.DeleteOne(ctx, query)
 	if err != nil {
 		return err
@@ -343,35 +817,108 @@ func (c *ClientManager) Delete(ctx context.Context, clientID string) (err error)
 		return fosite.ErrNotFound
 	}
 
+	c.hooks().AfterDelete(ctx, clientID)
 	return nil
 }
 
-// Authenticate verifies the identity of a client resource.
+// Authenticate verifies the identity of a client resource. A missing client
+// and a wrong secret are both reported as storage.ErrInvalidCredentials, as is
+// a wrong secret for a disabled client, which is otherwise denied.
 func (c *ClientManager) Authenticate(ctx context.Context, clientID string, secret string) (result storage.Client, err error) {
+	defer classifyError(&err)
+
 	client, err := c.getConcrete(ctx, clientID)
 	if err != nil {
 		if err == fosite.ErrNotFound {
-			return result, err
+			c.decoy.compare(ctx, c.Hasher, secret)
+			return result, storage.ErrInvalidCredentials
 		}
 		return result, err
 	}
 
-	if client.Public {
-		// The client doesn't have a secret, therefore is authenticated
-		// implicitly.
-		return client, nil
+	// Public clients don't have a secret, therefore are authenticated
+	// implicitly.
+	if !client.Public && !c.compareSecret(ctx, client, secret) {
+		return result, storage.ErrInvalidCredentials
 	}
 
+	// Deny disabled clients only once the secret has been verified, so a
+	// client's state isn't revealed without it.
 	if client.Disabled {
 		return result, fosite.ErrAccessDenied
 	}
 
-	err = c.Hasher.Compare(ctx, client.GetHashedSecret(), []byte(secret))
+	return client, nil
+}
+
+// compareSecret reports whether the secret matches the client's secret, or a
+// rotated secret within its overlap window.
+func (c *ClientManager) compareSecret(ctx context.Context, client storage.Client, secret string) bool {
+	if c.Hasher.Compare(ctx, client.GetHashedSecret(), []byte(secret)) == nil {
+		return true
+	}
+
+	// Accept a rotated secret until its overlap window expires.
+	for _, hash := range client.RotatedHashes(timeNow(c.Clock)) {
+		if c.Hasher.Compare(ctx, hash, []byte(secret)) == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RotateSecret replaces the client's secret with the hash of the provided
+// cleartext secret. The previous secret continues to authenticate the client
+// until the overlap has elapsed, giving deployments time to move over to the
+// new secret. A zero overlap invalidates the previous secret immediately.
+func (c *ClientManager) RotateSecret(ctx context.Context, clientID string, secret string, overlap time.Duration) (result storage.Client, err error) {
+	defer classifyError(&err)
+
+	hash, err := c.Hasher.Hash(ctx, []byte(secret))
 	if err != nil {
 		return result, err
 	}
+	now := timeNow(c.Clock)
 
-	return client, nil
+	// Build Query
+	// The update is expressed as a pipeline so that the current secret is
+	// carried over to the previous secret in the same atomic operation.
+	var previousSecret, previousSecretExpiry interface{} = "$$REMOVE", "$$REMOVE"
+	if overlap > 0 {
+		previousSecret, previousSecretExpiry = "$secret", now.Add(overlap).Unix()
+	}
+	selector := bson.M{
+		"id": clientID,
+	}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"previous_secret":        previousSecret,
+			"previous_secret_expiry": previousSecretExpiry,
+			// Hashes commonly start with $, so must not be mistaken for a
+			// field path.
+			"secret":     bson.M{"$literal": string(hash)},
+			"updated_at": c.DB.timestamp(now),
+		}}},
+	}
+
+	var storageClient storage.Client
+	collection, err := c.DB.collection(ctx, storage.EntityClients)
+	if err != nil {
+		return result, err
+	}
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetProjection(clientProjection)
+	err = collection.FindOneAndUpdate(ctx, selector, update, opts).Decode(&storageClient)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return result, fosite.ErrNotFound
+		}
+		return result, err
+	}
+
+	return storageClient, nil
 }
 
 // AuthenticateMigration is provided to authenticate clients that have been
@@ -380,7 +927,12 @@ func (c *ClientManager) Authenticate(ctx context.Context, clientID string, secre
 // It authenticates a Client first by using the provided AuthClientFunc which,
 // if fails, will otherwise try to authenticate using the configured
 // fosite.hasher.
+// As with Authenticate, a missing client and a wrong secret are both reported
+// as storage.ErrInvalidCredentials, and a disabled client is denied only once
+// the secret has been verified.
 func (c *ClientManager) AuthenticateMigration(ctx context.Context, currentAuth storage.AuthClientFunc, clientID string, secret string) (result storage.Client, err error) {
+	defer classifyError(&err)
+
 	// Copy a new DB session if none specified
 	_, ok := ContextToSession(ctx)
 	if !ok {
@@ -397,25 +949,27 @@ func (c *ClientManager) AuthenticateMigration(ctx context.Context, currentAuth s
 
 	// Check for client not found
 	if client.IsEmpty() && !authenticated {
-		return result, fosite.ErrNotFound
+		c.decoy.compare(ctx, c.Hasher, secret)
+		return result, storage.ErrInvalidCredentials
 	}
 
-	if client.Public {
-		// The client doesn't have a secret, therefore is authenticated
-		// implicitly.
-		return client, nil
+	// Public clients don't have a secret, therefore are authenticated
+	// implicitly.
+	if !client.Public && !authenticated {
+		// If client isn't authenticated, try authenticating with new Hasher.
+		err := c.Hasher.Compare(ctx, client.GetHashedSecret(), []byte(secret))
+		if err != nil {
+			return result, storage.ErrInvalidCredentials
+		}
 	}
 
+	// Deny disabled clients only once the secret has been verified, so a
+	// client's state isn't revealed without it.
 	if client.Disabled {
 		return result, fosite.ErrAccessDenied
 	}
 
-	if !authenticated {
-		// If client isn't authenticated, try authenticating with new Hasher.
-		err := c.Hasher.Compare(ctx, client.GetHashedSecret(), []byte(secret))
-		if err != nil {
-			return result, err
-		}
+	if client.Public || !authenticated {
 		return client, nil
 	}
 
@@ -427,7 +981,7 @@ func (c *ClientManager) AuthenticateMigration(ctx context.Context, currentAuth s
 	}
 
 	// Save the new hash
-	client.UpdateTime = time.Now().Unix()
+	client.UpdateTime = timeNow(c.Clock).Unix()
 	client.Secret = string(newHash)
 
 	return c.Update(ctx, clientID, client)
@@ -435,55 +989,113 @@ func (c *ClientManager) AuthenticateMigration(ctx context.Context, currentAuth s
 
 // GrantScopes grants the provided scopes to the specified Client resource.
 func (c *ClientManager) GrantScopes(ctx context.Context, clientID string, scopes []string) (result storage.Client, err error) {
-	// Copy a new DB session if none specified
-	_, ok := ContextToSession(ctx)
-	if !ok {
-		var closeSession func()
-		ctx, closeSession, err = newSession(ctx, c.DB)
-		if err != nil {
-			return result, err
-		}
-		defer closeSession()
-	}
-	client, err := c.getConcrete(ctx, clientID)
+	defer classifyError(&err)
+
+	found, err := c.DB.updateScopes(ctx, storage.EntityClients, bson.M{"id": clientID}, addScopes(scopes), timeNow(c.Clock))
 	if err != nil {
-		if err == fosite.ErrNotFound {
-			return result, err
-		}
 		return result, err
 	}
+	if !found {
+		return result, fosite.ErrNotFound
+	}
+
+	return c.getConcrete(ctx, clientID)
+}
 
-	client.UpdateTime = time.Now().Unix()
-	client.EnableScopeAccess(scopes...)
+// GrantScopesToMany grants the provided scopes to each of the specified Client
+// resources with a single update.
+func (c *ClientManager) GrantScopesToMany(ctx context.Context, clientIDs []string, scopes []string) (err error) {
+	defer classifyError(&err)
 
-	return c.Update(ctx, client.ID, client)
+	if len(clientIDs) == 0 || len(scopes) == 0 {
+		return nil
+	}
+
+	// Build Query
+	selector := bson.M{
+		"id": bson.M{"$in": clientIDs},
+	}
+
+	_, err = c.DB.updateScopes(ctx, storage.EntityClients, selector, addScopes(scopes), timeNow(c.Clock))
+	return err
 }
 
 // RemoveScopes revokes the provided scopes from the specified Client resource.
 func (c *ClientManager) RemoveScopes(ctx context.Context, clientID string, scopes []string) (result storage.Client, err error) {
-	// Copy a new DB session if none specified
-	_, ok := ContextToSession(ctx)
-	if !ok {
-		var closeSession func()
-		ctx, closeSession, err = newSession(ctx, c.DB)
-		if err != nil {
-			return result, err
-		}
-		defer closeSession()
+	defer classifyError(&err)
+
+	found, err := c.DB.updateScopes(ctx, storage.EntityClients, bson.M{"id": clientID}, pullScopes(scopes), timeNow(c.Clock))
+	if err != nil {
+		return result, err
+	}
+	if !found {
+		return result, fosite.ErrNotFound
+	}
+
+	return c.getConcrete(ctx, clientID)
+}
+
+// RemoveAllScopes revokes every scope from the specified Client resource.
+func (c *ClientManager) RemoveAllScopes(ctx context.Context, clientID string) (result storage.Client, err error) {
+	defer classifyError(&err)
+
+	return c.setFields(ctx, clientID, bson.M{
+		"scopes": []string{},
+	})
+}
+
+// Disable prevents the specified Client resource from authenticating.
+func (c *ClientManager) Disable(ctx context.Context, clientID string) (result storage.Client, err error) {
+	defer classifyError(&err)
+
+	return c.setFields(ctx, clientID, bson.M{
+		"disabled": true,
+	})
+}
+
+// Enable allows a previously disabled Client resource to authenticate again.
+func (c *ClientManager) Enable(ctx context.Context, clientID string) (result storage.Client, err error) {
+	defer classifyError(&err)
+
+	return c.setFields(ctx, clientID, bson.M{
+		"disabled": false,
+	})
+}
+
+// GetClientAssertionKey returns the client's public key matching the key ID,
+// in order to verify the signature of a private_key_jwt client assertion.
+//
+// The assertion's JTI is checked first, so fosite.ErrJTIKnown is returned for
+// replayed assertions before looking up the key. Once the assertion has been
+// verified, the JTI should be marked as used via SetClientAssertionJWT.
+// Returns fosite.ErrNotFound if the client doesn't have a key with the key ID.
+func (c *ClientManager) GetClientAssertionKey(ctx context.Context, clientID string, keyID string, jti string) (key *jose.JSONWebKey, err error) {
+	defer classifyError(&err)
+
+	err = c.ClientAssertionJWTValid(ctx, jti)
+	if err != nil {
+		return nil, err
 	}
 
 	client, err := c.getConcrete(ctx, clientID)
 	if err != nil {
-		if err == fosite.ErrNotFound {
-			return result, err
-		}
-		return result, err
+		return nil, err
 	}
 
-	client.UpdateTime = time.Now().Unix()
-	client.DisableScopeAccess(scopes...)
+	if client.Disabled {
+		return nil, fosite.ErrAccessDenied
+	}
+
+	if client.JSONWebKeys == nil {
+		return nil, fosite.ErrNotFound
+	}
+
+	keys := client.JSONWebKeys.Key(keyID)
+	if len(keys) == 0 {
+		return nil, fosite.ErrNotFound
+	}
 
-	return c.Update(ctx, client.ID, client)
+	return &keys[0], nil
 }
 
 func (c *ClientManager) IsJWTUsed(ctx context.Context, jti string) (bool, error) {
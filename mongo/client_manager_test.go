@@ -3,13 +3,27 @@ package mongo_test
 import (
 	// Standard Library Imports
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	// External Imports
+	"github.com/go-jose/go-jose/v3"
 	"github.com/google/uuid"
 	"github.com/ory/fosite"
+	"github.com/ory/fosite/compose"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 
 	// Internal Imports
 	"github.com/p000ic/go-fosite-mongo"
@@ -35,6 +49,7 @@ func TestClientManager_List(t *testing.T) {
 		Scopes:              []string{},
 		Name:                "published client",
 		RedirectURIs:        []string{},
+		AllowedCORSOrigins:  []string{},
 		Contacts:            []string{},
 		Published:           true,
 	}
@@ -122,11 +137,35 @@ func TestClientManager_List(t *testing.T) {
 			wantErr:     false,
 			err:         nil,
 		},
+		{
+			name: "should filter clients by Allowed CORS Origin",
+			args: args{
+				filter: storage.ListClientsRequest{
+					AllowedCORSOrigin: expected.AllowedCORSOrigins[1],
+				},
+			},
+			wantResults: []storage.Client{
+				expected,
+			},
+			wantErr: false,
+			err:     nil,
+		},
+		{
+			name: "should return empty if no clients are found by Allowed CORS Origin",
+			args: args{
+				filter: storage.ListClientsRequest{
+					AllowedCORSOrigin: "https://evil.example.com",
+				},
+			},
+			wantResults: []storage.Client(nil),
+			wantErr:     false,
+			err:         nil,
+		},
 		{
 			name: "should filter clients by Grant Type",
 			args: args{
 				filter: storage.ListClientsRequest{
-					GrantType: string(fosite.AuthorizeCode),
+					GrantType: "authorization_code",
 				},
 			},
 			wantResults: []storage.Client{
@@ -415,10 +454,10 @@ func expectedClient() storage.Client {
 			uuid.NewString(),
 		},
 		GrantTypes: []string{
-			string(fosite.AccessToken),
-			string(fosite.RefreshToken),
-			string(fosite.AuthorizeCode),
-			string(fosite.IDToken),
+			"authorization_code",
+			"client_credentials",
+			"implicit",
+			"refresh_token",
 		},
 		ResponseTypes: []string{
 			"code",
@@ -435,6 +474,10 @@ func expectedClient() storage.Client {
 		RedirectURIs: []string{
 			"https://test.example.com",
 		},
+		AllowedCORSOrigins: []string{
+			"https://test.example.com",
+			"https://app.example.com",
+		},
 		Owner:             "Widgets Inc.",
 		PolicyURI:         "https://test.example.com/policy",
 		TermsOfServiceURI: "https://test.example.com/tos",
@@ -483,6 +526,91 @@ func TestClientManager_Create(t *testing.T) {
 	createClient(ctx, t, store)
 }
 
+func TestClientManager_Create_ShouldUseIDGenerator(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.IDGenerator = sequentialIDs("cli_")
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	for _, expected := range []string{"cli_1", "cli_2"} {
+		client := expectedClient()
+		client.ID = ""
+
+		got, err := store.ClientManager.Create(ctx, client)
+		if err != nil {
+			AssertFatal(t, err, nil, "create should return no database errors")
+		}
+		if got.ID != expected {
+			AssertError(t, got.ID, expected, "create should use the configured id generator")
+		}
+	}
+}
+
+func TestClientManager_ShouldUseClock(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cfg := mongo.DefaultConfig()
+	cfg.Clock = frozenClock(&now)
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	client := expectedClient()
+	client.CreateTime = 0
+	client.UpdateTime = 0
+
+	got, err := store.ClientManager.Create(ctx, client)
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+	if got.CreateTime != now.Unix() {
+		AssertError(t, got.CreateTime, now.Unix(), "create time should be set from the clock")
+	}
+
+	now = now.Add(time.Hour)
+	got.Name = "updated client"
+	got, err = store.ClientManager.Update(ctx, got.ID, got)
+	if err != nil {
+		AssertFatal(t, err, nil, "update should return no database errors")
+	}
+	if got.UpdateTime != now.Unix() {
+		AssertError(t, got.UpdateTime, now.Unix(), "update time should be set from the clock")
+	}
+}
+
+func TestClientManager_ClientAssertionJWTValid_ShouldUseClock(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cfg := mongo.DefaultConfig()
+	cfg.Clock = frozenClock(&now)
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	jti := uuid.NewString()
+	err := store.ClientManager.SetClientAssertionJWT(ctx, jti, now.Add(time.Minute))
+	if err != nil {
+		AssertFatal(t, err, nil, "set client assertion should return no database errors")
+	}
+
+	err = store.ClientManager.ClientAssertionJWTValid(ctx, jti)
+	if err != fosite.ErrJTIKnown {
+		AssertError(t, err, fosite.ErrJTIKnown, "jti should be known before it expires")
+	}
+
+	now = now.Add(2 * time.Minute)
+	err = store.ClientManager.ClientAssertionJWTValid(ctx, jti)
+	if err != nil {
+		AssertError(t, err, nil, "jti should be valid once expired")
+	}
+
+	// Setting a new assertion should purge the expired jti.
+	err = store.ClientManager.SetClientAssertionJWT(ctx, uuid.NewString(), now.Add(time.Minute))
+	if err != nil {
+		AssertFatal(t, err, nil, "set client assertion should return no database errors")
+	}
+	_, err = store.DeniedJTIManager.Get(ctx, jti)
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "expired jti should be purged")
+	}
+}
+
 func TestClientManager_Create_ShouldConflict(t *testing.T) {
 	store, ctx, teardown := setup(t)
 	defer teardown()
@@ -511,6 +639,47 @@ func TestClientManager_Get(t *testing.T) {
 	}
 }
 
+func TestClientManager_Get_ShouldHonorReadPreference(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	expected := createClient(ctx, t, store)
+	got, err := store.ClientManager.Get(mongo.WithReadPreference(ctx, readpref.Primary()), expected.ID)
+	if err != nil {
+		AssertError(t, err, nil, "get should return no database errors")
+	}
+	if !reflect.DeepEqual(got, expected) {
+		AssertError(t, got, expected, "client not equal")
+	}
+}
+
+func TestClientManager_Exists(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	expected := createClient(ctx, t, store)
+	got, err := store.ClientManager.Exists(ctx, expected.ID)
+	if err != nil {
+		AssertError(t, err, nil, "exists should return no database errors")
+	}
+	if !got {
+		AssertError(t, got, true, "exists should return true for a stored client")
+	}
+}
+
+func TestClientManager_Exists_ShouldReturnFalse(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	got, err := store.ClientManager.Exists(ctx, "lolNotFound")
+	if err != nil {
+		AssertError(t, err, nil, "exists should return no database errors")
+	}
+	if got {
+		AssertError(t, got, false, "exists should return false for a missing client")
+	}
+}
+
 func TestClientManager_Get_ShouldReturnNotFound(t *testing.T) {
 	store, ctx, teardown := setup(t)
 	defer teardown()
@@ -599,6 +768,63 @@ func TestClientManager_Update_ShouldChangePassword(t *testing.T) {
 	}
 }
 
+func TestClientManager_RotateSecret(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cfg := mongo.DefaultConfig()
+	cfg.Clock = frozenClock(&now)
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	client := createClient(ctx, t, store)
+	newSecret := "s0methingElse!"
+
+	got, err := store.ClientManager.RotateSecret(ctx, client.ID, newSecret, 10*time.Minute)
+	if err != nil {
+		AssertFatal(t, err, nil, "rotate secret should return no database errors")
+	}
+	if got.PreviousSecret != client.Secret {
+		AssertError(t, got.PreviousSecret, client.Secret, "the previous secret hash should be retained")
+	}
+	if got.PreviousSecretExpiry != now.Add(10*time.Minute).Unix() {
+		AssertError(t, got.PreviousSecretExpiry, now.Add(10*time.Minute).Unix(), "the previous secret should expire after the overlap")
+	}
+
+	// Both secrets are accepted during the overlap window.
+	for _, secret := range []string{"foobar", newSecret} {
+		_, err = store.ClientManager.Authenticate(ctx, client.ID, secret)
+		if err != nil {
+			AssertError(t, err, nil, "should authenticate during the overlap window")
+		}
+	}
+
+	// Updates must not drop the previous secret.
+	got.Name = "Rotated"
+	_, err = store.ClientManager.Update(ctx, client.ID, got)
+	if err != nil {
+		AssertFatal(t, err, nil, "update should return no database errors")
+	}
+
+	now = now.Add(10 * time.Minute)
+	_, err = store.ClientManager.Authenticate(ctx, client.ID, "foobar")
+	if err == nil {
+		AssertError(t, err, "hash mismatch", "should reject the previous secret once the overlap has expired")
+	}
+	_, err = store.ClientManager.Authenticate(ctx, client.ID, newSecret)
+	if err != nil {
+		AssertError(t, err, nil, "should authenticate with the new secret")
+	}
+}
+
+func TestClientManager_RotateSecret_ShouldReturnNotFound(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	_, err := store.ClientManager.RotateSecret(ctx, uuid.NewString(), "s0methingElse!", time.Minute)
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "rotate secret should return not found")
+	}
+}
+
 func TestClientManager_Update_ShouldReturnNotFound(t *testing.T) {
 	store, ctx, teardown := setup(t)
 	defer teardown()
@@ -643,3 +869,684 @@ func TestClientManager_Delete_ShouldReturnNotFound(t *testing.T) {
 		AssertError(t, err, nil, "delete should return not found")
 	}
 }
+
+func TestClientManager_GetOrCreate_ShouldCreate(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	expected := expectedClient()
+	got, created, err := store.ClientManager.GetOrCreate(ctx, expected)
+	if err != nil {
+		AssertFatal(t, err, nil, "get or create should return no database errors")
+	}
+	if !created {
+		AssertError(t, created, true, "get or create should report the client as created")
+	}
+	if got.Secret == "" || got.Secret == expected.Secret {
+		AssertError(t, got.Secret, "bcrypt encoded secret", "get or create should hash the secret")
+	}
+
+	stored, err := store.ClientManager.Get(ctx, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "get should return no database errors")
+	}
+	if !stored.Equal(got) {
+		AssertError(t, stored, got, "get or create should store the created client")
+	}
+}
+
+func TestClientManager_GetOrCreate_ShouldReturnExisting(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	expected := createClient(ctx, t, store)
+
+	replacement := expectedClient()
+	replacement.ID = expected.ID
+	got, created, err := store.ClientManager.GetOrCreate(ctx, replacement)
+	if err != nil {
+		AssertFatal(t, err, nil, "get or create should return no database errors")
+	}
+	if created {
+		AssertError(t, created, false, "get or create should not report an existing client as created")
+	}
+	if !got.Equal(expected) {
+		AssertError(t, got, expected, "get or create should return the existing client unchanged")
+	}
+}
+
+func TestClientManager_GetOrCreate_ShouldHandleConcurrentCreates(t *testing.T) {
+	store, _, teardown := setup(t)
+	defer teardown()
+
+	expected := expectedClient()
+
+	const workers = 5
+	var wg sync.WaitGroup
+	var createdCount int32
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Mongo sessions are not safe for concurrent use, so each worker
+			// must use its own context.
+			_, created, err := store.ClientManager.GetOrCreate(context.Background(), expected)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if created {
+				atomic.AddInt32(&createdCount, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		AssertError(t, err, nil, "concurrent get or create should return no database errors")
+	}
+	if createdCount != 1 {
+		AssertError(t, createdCount, 1, "exactly one concurrent get or create should create the client")
+	}
+}
+
+func TestClientManager_GetClient_ShouldRejectDisabledClients(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	expected := expectedClient()
+	expected.Disabled = true
+	client := createNewClient(t, ctx, store, expected)
+
+	_, err := store.GetClient(ctx, client.ID)
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "get client should report disabled clients as not found")
+	}
+
+	_, err = store.ClientManager.Authenticate(ctx, client.ID, "")
+	if err != fosite.ErrAccessDenied {
+		AssertError(t, err, fosite.ErrAccessDenied, "authenticate should deny disabled public clients")
+	}
+}
+
+func TestClientManager_GetClient_ShouldAllowDisabledClientsWhenConfigured(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.AllowDisabledClients = true
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	expected := expectedClient()
+	expected.Disabled = true
+	client := createNewClient(t, ctx, store, expected)
+
+	got, err := store.GetClient(ctx, client.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "get client should return disabled clients when allowed")
+	}
+	if got.GetID() != client.ID {
+		AssertError(t, got.GetID(), client.ID, "get client returned an unexpected client")
+	}
+}
+
+func TestClientManager_GetClient_ShouldRejectDisabledClientsAtAuthorize(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	expected := expectedClient()
+	expected.Disabled = true
+	expected.RedirectURIs = []string{"https://example.com/callback"}
+	client := createNewClient(t, ctx, store, expected)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		AssertFatal(t, err, nil, "unable to generate signing key")
+	}
+	provider := compose.ComposeAllEnabled(&fosite.Config{
+		GlobalSecret: []byte("some-super-cool-secret-that-nobody-knows"),
+	}, store, key)
+
+	query := url.Values{
+		"client_id":     {client.ID},
+		"redirect_uri":  {"https://example.com/callback"},
+		"response_type": {"code"},
+		"scope":         {"openid"},
+		"state":         {"some-random-state-value"},
+	}
+	req := httptest.NewRequest(http.MethodGet, "/oauth2/auth?"+query.Encode(), nil)
+
+	_, err = provider.NewAuthorizeRequest(ctx, req)
+	if !errors.Is(err, fosite.ErrInvalidClient) {
+		AssertError(t, err, fosite.ErrInvalidClient, "authorize should reject disabled clients as invalid")
+	}
+}
+
+func TestClientManager_GetClient_ShouldReportEnforcedPKCE(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	expected := expectedClient()
+	expected.EnforcePKCE = true
+	client := createNewClient(t, ctx, store, expected)
+
+	got, err := store.ClientManager.Get(ctx, client.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "get should return no database errors")
+	}
+	if !got.EnforcePKCE {
+		AssertError(t, got.EnforcePKCE, true, "enforce pkce should round-trip")
+	}
+
+	fositeClient, err := store.GetClient(ctx, client.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "get client should return no database errors")
+	}
+	enforcer, ok := fositeClient.(storage.PKCEEnforcer)
+	if !ok || !enforcer.IsPKCEEnforced() {
+		AssertError(t, fositeClient, "pkce enforced", "get client should report pkce as enforced")
+	}
+}
+
+func TestClientManager_GetClient_ShouldRequirePKCEForPublicClients(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.RequirePKCEForPublicClients = true
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	public := expectedClient()
+	public.Public = true
+	public.EnforcePKCE = false
+	public = createNewClient(t, ctx, store, public)
+
+	confidential := expectedClient()
+	confidential.Public = false
+	confidential.EnforcePKCE = false
+	confidential = createNewClient(t, ctx, store, confidential)
+
+	tests := map[string]bool{
+		public.ID:       true,
+		confidential.ID: false,
+	}
+	for clientID, expected := range tests {
+		got, err := store.GetClient(ctx, clientID)
+		if err != nil {
+			AssertFatal(t, err, nil, "get client should return no database errors")
+		}
+		if got.(storage.PKCEEnforcer).IsPKCEEnforced() != expected {
+			AssertError(t, got, expected, "pkce should only be required for public clients")
+		}
+	}
+}
+
+func TestClientManager_Update_ShouldChangeAllowedCORSOrigins(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	expected := createClient(ctx, t, store)
+	expected.AllowedCORSOrigins = []string{"https://new.example.com"}
+
+	_, err := store.ClientManager.Update(ctx, expected.ID, expected)
+	if err != nil {
+		AssertFatal(t, err, nil, "update should return no database errors")
+	}
+
+	got, err := store.ClientManager.Get(ctx, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "get should return no database errors")
+	}
+	if !reflect.DeepEqual(got.AllowedCORSOrigins, expected.AllowedCORSOrigins) {
+		AssertError(t, got.AllowedCORSOrigins, expected.AllowedCORSOrigins, "allowed cors origins should be updated")
+	}
+}
+
+func TestClientManager_ListByScope(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	scope := "urn:test:" + uuid.NewString()
+	holder := expectedClient()
+	holder.Scopes = append(holder.Scopes, scope)
+	holder = createNewClient(t, ctx, store, holder)
+
+	soleHolder := expectedClient()
+	soleHolder.Scopes = []string{scope}
+	soleHolder = createNewClient(t, ctx, store, soleHolder)
+
+	createClient(ctx, t, store)
+	unscoped := expectedClient()
+	unscoped.Scopes = nil
+	createNewClient(t, ctx, store, unscoped)
+
+	got, err := store.ClientManager.ListByScope(ctx, scope)
+	if err != nil {
+		AssertFatal(t, err, nil, "list by scope should return no database errors")
+	}
+
+	var ids []string
+	for _, client := range got {
+		ids = append(ids, client.ID)
+	}
+	expected := []string{holder.ID, soleHolder.ID}
+	sort.Strings(ids)
+	sort.Strings(expected)
+	if !reflect.DeepEqual(ids, expected) {
+		AssertError(t, ids, expected, "list by scope should only return clients holding the scope")
+	}
+}
+
+func TestClientManager_GrantScopes_ShouldKeepConcurrentGrants(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	expected := createClient(ctx, t, store)
+	scopes := []string{"urn:test:birds:read", "urn:test:fish:read", "urn:test:frogs:read", "urn:test:mice:read"}
+
+	// Each grant runs in its own mongo session, as concurrent admin requests
+	// would.
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, scope := range scopes {
+		wg.Add(1)
+		go func(scope string) {
+			defer wg.Done()
+			<-start
+			_, err := store.ClientManager.GrantScopes(context.Background(), expected.ID, []string{scope})
+			if err != nil {
+				AssertError(t, err, nil, "grant scopes should return no database errors")
+			}
+		}(scope)
+	}
+	close(start)
+	wg.Wait()
+
+	got, err := store.ClientManager.Get(ctx, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "get should return no database errors")
+	}
+	expected.EnableScopeAccess(scopes...)
+	sort.Strings(got.Scopes)
+	sort.Strings(expected.Scopes)
+	if !reflect.DeepEqual(got.Scopes, expected.Scopes) {
+		AssertError(t, got.Scopes, expected.Scopes, "concurrent grants should all survive")
+	}
+}
+
+func TestClientManager_GrantScopesToMany(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cfg := mongo.DefaultConfig()
+	cfg.Clock = frozenClock(&now)
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	first := createClient(ctx, t, store)
+	second := createClient(ctx, t, store)
+	// Clients created without scopes are stored with null scopes.
+	unscoped := expectedClient()
+	unscoped.Scopes = nil
+	unscoped = createNewClient(t, ctx, store, unscoped)
+	untargeted := createClient(ctx, t, store)
+
+	clientIDs := []string{first.ID, second.ID, unscoped.ID, "lolNotFound"}
+	err := store.ClientManager.GrantScopesToMany(ctx, clientIDs, []string{"urn:test:cats:write", "urn:test:birds:read"})
+	if err != nil {
+		AssertFatal(t, err, nil, "grant scopes to many should return no database errors")
+	}
+
+	for _, expected := range []storage.Client{first, second, unscoped} {
+		got, err := store.ClientManager.Get(ctx, expected.ID)
+		if err != nil {
+			AssertFatal(t, err, nil, "get should return no database errors")
+		}
+
+		expected.EnableScopeAccess("urn:test:cats:write", "urn:test:birds:read")
+		expected.UpdateTime = now.Unix()
+		if !got.Equal(expected) {
+			AssertError(t, got, expected, "grant scopes to many should add the missing scopes without duplicates")
+		}
+	}
+
+	got, err := store.ClientManager.Get(ctx, untargeted.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "get should return no database errors")
+	}
+	if !got.Equal(untargeted) {
+		AssertError(t, got, untargeted, "grant scopes to many should leave other clients untouched")
+	}
+}
+
+func TestClientManager_RemoveAllScopes(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cfg := mongo.DefaultConfig()
+	cfg.Clock = frozenClock(&now)
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	expected := createClient(ctx, t, store)
+	if len(expected.Scopes) == 0 {
+		AssertFatal(t, expected.Scopes, "scopes", "the client under test should have scopes to remove")
+	}
+
+	got, err := store.ClientManager.RemoveAllScopes(ctx, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "remove all scopes should return no database errors")
+	}
+
+	expected.Scopes = []string{}
+	expected.UpdateTime = now.Unix()
+	if !got.Equal(expected) {
+		AssertError(t, got, expected, "remove all scopes should only empty the scopes and bump the update time")
+	}
+
+	stored, err := store.ClientManager.Get(ctx, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "get should return no database errors")
+	}
+	if !stored.Equal(expected) {
+		AssertError(t, stored, expected, "remove all scopes should persist the emptied scopes")
+	}
+}
+
+func TestClientManager_RemoveAllScopes_ShouldReturnNotFound(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	_, err := store.ClientManager.RemoveAllScopes(ctx, "lolNotFound")
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "remove all scopes should return not found")
+	}
+}
+
+func TestClientManager_DisableEnable(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	expected := createClient(ctx, t, store)
+
+	got, err := store.ClientManager.Disable(ctx, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "disable should return no database errors")
+	}
+	if !got.Disabled {
+		AssertError(t, got.Disabled, true, "disable should disable the client")
+	}
+
+	_, err = store.ClientManager.Authenticate(ctx, expected.ID, "foobar")
+	if err != fosite.ErrAccessDenied {
+		AssertError(t, err, fosite.ErrAccessDenied, "a disabled client should not authenticate")
+	}
+
+	got, err = store.ClientManager.Enable(ctx, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "enable should return no database errors")
+	}
+	if got.Disabled {
+		AssertError(t, got.Disabled, false, "enable should re-enable the client")
+	}
+
+	_, err = store.ClientManager.Authenticate(ctx, expected.ID, "foobar")
+	if err != nil {
+		AssertError(t, err, nil, "a re-enabled client should authenticate")
+	}
+}
+
+func TestClientManager_DisableEnable_ShouldReturnNotFound(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	_, err := store.ClientManager.Disable(ctx, "lolNotFound")
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "disable should return not found")
+	}
+
+	_, err = store.ClientManager.Enable(ctx, "lolNotFound")
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "enable should return not found")
+	}
+}
+
+func TestClientManager_Update_ShouldPreserveExtra(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	client := expectedClient()
+	client.Extra = map[string]interface{}{
+		"software_id": "4NRB1-0XZABZI9E6-5SM3R",
+	}
+	expected := createNewClient(t, ctx, store, client)
+
+	// Write metadata directly, as another system unaware of the model would.
+	_, err := store.DB.Collection(storage.EntityClients).UpdateOne(ctx, bson.M{"id": expected.ID}, bson.M{
+		"$set": bson.M{"vendor_tier": "gold"},
+	})
+	if err != nil {
+		AssertFatal(t, err, nil, "update one should return no database errors")
+	}
+	expectedExtra := map[string]interface{}{
+		"software_id": "4NRB1-0XZABZI9E6-5SM3R",
+		"vendor_tier": "gold",
+	}
+
+	got, err := store.ClientManager.Get(ctx, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "get should return no database errors")
+	}
+	if !reflect.DeepEqual(got.Extra, expectedExtra) {
+		AssertFatal(t, got.Extra, expectedExtra, "get should capture unmodeled metadata")
+	}
+
+	// Updating a client read from the store should keep the metadata.
+	got.Name = "renamed client"
+	_, err = store.ClientManager.Update(ctx, got.ID, got)
+	if err != nil {
+		AssertFatal(t, err, nil, "update should return no database errors")
+	}
+
+	// Updating a client without any metadata should keep the metadata.
+	update := expectedClient()
+	update.Name = "renamed again"
+	_, err = store.ClientManager.Update(ctx, got.ID, update)
+	if err != nil {
+		AssertFatal(t, err, nil, "update should return no database errors")
+	}
+
+	// Migrating a client without any metadata should keep the metadata.
+	update.ID = got.ID
+	_, err = store.ClientManager.Migrate(ctx, update)
+	if err != nil {
+		AssertFatal(t, err, nil, "migrate should return no database errors")
+	}
+
+	got, err = store.ClientManager.Get(ctx, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "get should return no database errors")
+	}
+	if got.Name != update.Name {
+		AssertError(t, got.Name, update.Name, "update should change modeled fields")
+	}
+	if !reflect.DeepEqual(got.Extra, expectedExtra) {
+		AssertError(t, got.Extra, expectedExtra, "unmodeled metadata should survive updates")
+	}
+}
+
+// createClientWithKey creates a client holding the public key of the returned
+// private key under the given key ID.
+func createClientWithKey(ctx context.Context, t *testing.T, store *mongo.Store, keyID string) (storage.Client, *rsa.PrivateKey) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		AssertFatal(t, err, nil, "generating a key should return no errors")
+	}
+
+	client := expectedClient()
+	client.JSONWebKeys = &jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{
+			{Key: &privateKey.PublicKey, KeyID: keyID, Algorithm: "RS256", Use: "sig"},
+		},
+	}
+
+	return createNewClient(t, ctx, store, client), privateKey
+}
+
+func TestClientManager_GetClientAssertionKey(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	client, privateKey := createClientWithKey(ctx, t, store, "key-1")
+
+	got, err := store.ClientManager.GetClientAssertionKey(ctx, client.ID, "key-1", uuid.NewString())
+	if err != nil {
+		AssertFatal(t, err, nil, "get client assertion key should return no database errors")
+	}
+	if got.KeyID != "key-1" {
+		AssertError(t, got.KeyID, "key-1", "get client assertion key should return the matching key")
+	}
+	publicKey, ok := got.Key.(*rsa.PublicKey)
+	if !ok || !publicKey.Equal(&privateKey.PublicKey) {
+		AssertError(t, got.Key, &privateKey.PublicKey, "get client assertion key should return the stored public key")
+	}
+}
+
+func TestClientManager_GetClientAssertionKey_ShouldReturnNotFoundForUnknownKeyID(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	client, _ := createClientWithKey(ctx, t, store, "key-1")
+
+	_, err := store.ClientManager.GetClientAssertionKey(ctx, client.ID, "lolNotFound", uuid.NewString())
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "get client assertion key should return not found for an unknown key id")
+	}
+}
+
+func TestClientManager_GetClientAssertionKey_ShouldRejectKnownJTI(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	client, _ := createClientWithKey(ctx, t, store, "key-1")
+
+	jti := uuid.NewString()
+	err := store.ClientManager.SetClientAssertionJWT(ctx, jti, time.Now().Add(time.Hour))
+	if err != nil {
+		AssertFatal(t, err, nil, "set client assertion jwt should return no database errors")
+	}
+
+	_, err = store.ClientManager.GetClientAssertionKey(ctx, client.ID, "key-1", jti)
+	if err != fosite.ErrJTIKnown {
+		AssertError(t, err, fosite.ErrJTIKnown, "get client assertion key should reject a replayed assertion")
+	}
+}
+
+func TestClientManager_ListByContact_ShouldUseContactsIndex(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	indexes := indexSpecifications(ctx, t, store, storage.EntityClients)
+	contactsIdx, ok := indexes[mongo.IdxCompoundContacts]
+	if !ok {
+		AssertFatal(t, indexes, mongo.IdxCompoundContacts, "compound contacts index should exist")
+	}
+	expectedKeys := bson.D{{Key: "contacts", Value: int32(1)}, {Key: "id", Value: int32(1)}}
+	var gotKeys bson.D
+	if err := bson.Unmarshal(contactsIdx.KeysDocument, &gotKeys); err != nil {
+		AssertFatal(t, err, nil, "index keys should decode")
+	}
+	if !reflect.DeepEqual(gotKeys, expectedKeys) {
+		AssertError(t, gotKeys, expectedKeys, "compound contacts index should cover contacts and id")
+	}
+
+	contact := uuid.NewString() + "@example.com"
+	expected := expectedClient()
+	expected.Contacts = []string{"admin@example.com", contact}
+	expected = createNewClient(t, ctx, store, expected)
+	other := expectedClient()
+	other.Contacts = []string{"admin@example.com"}
+	createNewClient(t, ctx, store, other)
+
+	got, err := store.ClientManager.ListByContact(ctx, contact)
+	if err != nil {
+		AssertFatal(t, err, nil, "list by contact should return no database errors")
+	}
+	if len(got) != 1 || got[0].ID != expected.ID {
+		AssertError(t, got, []storage.Client{expected}, "list by contact should only return clients listing the contact")
+	}
+
+	explain := bson.D{
+		{Key: "explain", Value: bson.D{
+			{Key: "find", Value: storage.EntityClients},
+			{Key: "filter", Value: bson.M{"contacts": contact}},
+		}},
+		{Key: "verbosity", Value: "queryPlanner"},
+	}
+	plan, err := store.DB.Database().RunCommand(ctx, explain).Raw()
+	if err != nil {
+		AssertFatal(t, err, nil, "explain should return no database errors")
+	}
+	if !strings.Contains(plan.String(), mongo.IdxCompoundContacts) {
+		AssertError(t, plan.String(), mongo.IdxCompoundContacts, "contact filters should use the compound contacts index")
+	}
+}
+
+func TestClientManager_Create_ShouldEnforceStrictClientSecrets(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.StrictClientSecrets = true
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	public := expectedClient()
+	_, err := store.ClientManager.Create(ctx, public)
+	if !errors.Is(err, storage.ErrPublicClientSecret) {
+		AssertError(t, err, storage.ErrPublicClientSecret, "create should reject public clients with a secret")
+	}
+
+	public.Secret = ""
+	got, err := store.ClientManager.Create(ctx, public)
+	if err != nil {
+		AssertFatal(t, err, nil, "create should accept public clients without a secret")
+	}
+	if got.Secret != "" {
+		AssertError(t, got.Secret, "", "public clients should be stored without a secret")
+	}
+
+	confidential := expectedClient()
+	confidential.Public = false
+	confidential.Secret = ""
+	_, err = store.ClientManager.Create(ctx, confidential)
+	if !errors.Is(err, storage.ErrMissingClientSecret) {
+		AssertError(t, err, storage.ErrMissingClientSecret, "create should reject confidential clients without a secret")
+	}
+}
+
+func TestClientManager_GetOrCreate_ShouldEnforceStrictClientSecrets(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.StrictClientSecrets = true
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	public := expectedClient()
+	_, _, err := store.ClientManager.GetOrCreate(ctx, public)
+	if !errors.Is(err, storage.ErrPublicClientSecret) {
+		AssertError(t, err, storage.ErrPublicClientSecret, "get or create should reject public clients with a secret")
+	}
+
+	public.Secret = ""
+	got, created, err := store.ClientManager.GetOrCreate(ctx, public)
+	if err != nil {
+		AssertFatal(t, err, nil, "get or create should accept public clients without a secret")
+	}
+	if !created {
+		AssertError(t, created, true, "get or create should create the public client")
+	}
+	if got.Secret != "" {
+		AssertError(t, got.Secret, "", "public clients should be stored without a secret")
+	}
+
+	confidential := expectedClient()
+	confidential.ID = uuid.NewString()
+	confidential.Public = false
+	confidential.Secret = ""
+	_, _, err = store.ClientManager.GetOrCreate(ctx, confidential)
+	if !errors.Is(err, storage.ErrMissingClientSecret) {
+		AssertError(t, err, storage.ErrMissingClientSecret, "get or create should reject confidential clients without a secret")
+	}
+}
@@ -0,0 +1,66 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"context"
+	"time"
+
+	// External Imports
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Outcomes labeling the command durations reported to a TimingsFunc.
+const (
+	// OutcomeSucceeded labels a command which succeeded.
+	OutcomeSucceeded = "succeeded"
+
+	// OutcomeFailed labels a command which failed.
+	OutcomeFailed = "failed"
+)
+
+// NewCommandMonitor returns a command monitor which reports the duration of
+// each mongo command to timings, if set, and, if trace is set, annotates the
+// span active in the command's context with the command's name and duration,
+// correlating database latency with the storage operation that issued it.
+func NewCommandMonitor(timings TimingsFunc, trace bool) *event.CommandMonitor {
+	observe := func(ctx context.Context, finished event.CommandFinishedEvent, outcome string) {
+		if timings != nil {
+			timings(MetricCommandDuration, finished.Duration, map[string]string{
+				LabelCommand: finished.CommandName,
+				LabelOutcome: outcome,
+			})
+		}
+
+		if trace {
+			annotateSpan(ctx, finished, outcome)
+		}
+	}
+
+	return &event.CommandMonitor{
+		Succeeded: func(ctx context.Context, succeeded *event.CommandSucceededEvent) {
+			observe(ctx, succeeded.CommandFinishedEvent, OutcomeSucceeded)
+		},
+		Failed: func(ctx context.Context, failed *event.CommandFailedEvent) {
+			observe(ctx, failed.CommandFinishedEvent, OutcomeFailed)
+		},
+	}
+}
+
+// annotateSpan records the finished command as an event on the span active in
+// the context, if it's being recorded.
+func annotateSpan(ctx context.Context, finished event.CommandFinishedEvent, outcome string) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+
+	span.AddEvent("mongo."+finished.CommandName, trace.WithAttributes(
+		attribute.String("db.system", "mongodb"),
+		attribute.String("db.name", finished.DatabaseName),
+		attribute.String("db.operation", finished.CommandName),
+		attribute.String("db.outcome", outcome),
+		attribute.Float64("db.duration_ms", float64(finished.Duration)/float64(time.Millisecond)),
+	))
+}
@@ -0,0 +1,59 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	// External Imports
+	"go.mongodb.org/mongo-driver/event"
+)
+
+func TestNewCommandMonitor_ShouldRecordDurations(t *testing.T) {
+	type timing struct {
+		name     string
+		duration time.Duration
+		labels   map[string]string
+	}
+	var got []timing
+	monitor := NewCommandMonitor(func(name string, duration time.Duration, labels map[string]string) {
+		got = append(got, timing{name: name, duration: duration, labels: labels})
+	}, true)
+
+	ctx := context.Background()
+	monitor.Succeeded(ctx, &event.CommandSucceededEvent{
+		CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", Duration: 3 * time.Millisecond},
+	})
+	monitor.Failed(ctx, &event.CommandFailedEvent{
+		CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "insert", Duration: 5 * time.Millisecond},
+	})
+
+	want := []timing{
+		{name: MetricCommandDuration, duration: 3 * time.Millisecond, labels: map[string]string{LabelCommand: "find", LabelOutcome: OutcomeSucceeded}},
+		{name: MetricCommandDuration, duration: 5 * time.Millisecond, labels: map[string]string{LabelCommand: "insert", LabelOutcome: OutcomeFailed}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("command durations = %v, want %v", got, want)
+	}
+}
+
+func TestConnectionInfo_ShouldOnlyMonitorCommandsIfConfigured(t *testing.T) {
+	cfg := DefaultConfig()
+	if connectionInfo(t, cfg).Monitor != nil {
+		t.Errorf("commands should not be monitored by default")
+	}
+
+	cfg = DefaultConfig()
+	cfg.Timings = func(string, time.Duration, map[string]string) {}
+	if connectionInfo(t, cfg).Monitor == nil {
+		t.Errorf("commands should be monitored if timings are configured")
+	}
+
+	cfg = DefaultConfig()
+	cfg.TraceCommands = true
+	if connectionInfo(t, cfg).Monitor == nil {
+		t.Errorf("commands should be monitored if tracing is configured")
+	}
+}
@@ -0,0 +1,72 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"context"
+	"errors"
+	"time"
+
+	// External Imports
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ConnState pings mongo, reporting whether the store's connection is healthy
+// and the round trip latency of the ping, for readiness probes and circuit
+// breakers.
+//
+// If the store has been configured to reconnect, see Config.AutoReconnect, a
+// disconnected client is replaced with a new connection before the state is
+// reported.
+//
+// Note:
+//   - A client is only replaced once it has been disconnected, which the
+//     driver reports, as mongo.ErrClientDisconnected, solely after Disconnect
+//     has been called. A client that has lost its connection to the servers,
+//     for example, during a network partition, isn't replaced, as the driver
+//     reconnects it once the servers are reachable again, so ConnState
+//     reports the failed ping until then.
+func (s *Store) ConnState(ctx context.Context) (ok bool, latency time.Duration, err error) {
+	defer classifyError(&err)
+
+	database := s.DB.Database()
+	latency, err = ping(ctx, database)
+	if errors.Is(err, mongo.ErrClientDisconnected) && s.reconnect != nil {
+		database, err = s.reconnectDatabase(database)
+		if err != nil {
+			return false, latency, err
+		}
+		latency, err = ping(ctx, database)
+	}
+	if err != nil {
+		return false, latency, err
+	}
+
+	return true, latency, nil
+}
+
+// ping pings the database's deployment, returning the round trip latency.
+func ping(ctx context.Context, database *mongo.Database) (time.Duration, error) {
+	start := time.Now()
+	err := database.Client().Ping(ctx, nil)
+
+	return time.Since(start), err
+}
+
+// reconnectDatabase replaces the disconnected database with a new connection,
+// unless a concurrent caller has already done so.
+func (s *Store) reconnectDatabase(disconnected *mongo.Database) (*mongo.Database, error) {
+	s.reconnectMutex.Lock()
+	defer s.reconnectMutex.Unlock()
+
+	if current := s.DB.Database(); current != disconnected {
+		return current, nil
+	}
+
+	database, err := s.reconnect()
+	if err != nil {
+		return nil, err
+	}
+	s.DB.setDatabase(database)
+
+	return database, nil
+}
@@ -0,0 +1,131 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	// External Imports
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// disconnectedDB returns a database opened via a client that has since been
+// disconnected. Connecting is lazy, so no server is required.
+func disconnectedDB(t *testing.T) *DB {
+	t.Helper()
+
+	client, err := mongo.Connect(context.Background(), options.Client())
+	if err != nil {
+		t.Fatalf("connect should return no errors, got: %v", err)
+	}
+	err = client.Disconnect(context.Background())
+	if err != nil {
+		t.Fatalf("disconnect should return no errors, got: %v", err)
+	}
+
+	return &DB{database: client.Database("oauth2")}
+}
+
+func TestStore_ConnState_ShouldReportDisconnectedClients(t *testing.T) {
+	store := &Store{DB: disconnectedDB(t)}
+
+	ok, _, err := store.ConnState(context.Background())
+	if ok {
+		t.Error("ConnState() should report a disconnected client as unhealthy")
+	}
+	if !errors.Is(err, storage.ErrStorageUnavailable) {
+		t.Errorf("ConnState() error = %v, want %v", err, storage.ErrStorageUnavailable)
+	}
+}
+
+func TestStore_ConnState_ShouldReconnectDisconnectedClients(t *testing.T) {
+	// The replacement points at a closed port, so pinging it fails quickly.
+	replacement, err := mongo.Connect(context.Background(), options.Client().
+		ApplyURI("mongodb://127.0.0.1:1").
+		SetServerSelectionTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("connect should return no errors, got: %v", err)
+	}
+	defer func() {
+		_ = replacement.Disconnect(context.Background())
+	}()
+
+	db := disconnectedDB(t)
+	disconnected := db.Database()
+	if _, err := db.Tenant("acme"); err != nil {
+		t.Fatalf("Tenant() should return no errors, got: %v", err)
+	}
+
+	reconnects := 0
+	store := &Store{
+		DB: db,
+		reconnect: func() (*mongo.Database, error) {
+			reconnects++
+			return replacement.Database("oauth2"), nil
+		},
+	}
+
+	ok, _, err := store.ConnState(context.Background())
+	if ok || !errors.Is(err, storage.ErrStorageUnavailable) {
+		t.Errorf("ConnState() = %v, %v, want the replacement's unreachable server reported", ok, err)
+	}
+	if reconnects != 1 {
+		t.Errorf("ConnState() reconnected %d times, want 1", reconnects)
+	}
+	if db.Database() == disconnected || db.Client() != replacement {
+		t.Error("ConnState() should replace the disconnected database")
+	}
+	if tenant, err := db.Tenant("acme"); err != nil || tenant.Client() != replacement {
+		t.Error("ConnState() should reopen tenant databases via the new client")
+	}
+
+	// The replacement is connected, so isn't replaced again.
+	_, _, _ = store.ConnState(context.Background())
+	if reconnects != 1 {
+		t.Errorf("ConnState() reconnected %d times, want 1", reconnects)
+	}
+}
+
+func TestStore_ConnState_ShouldReportReconnectErrors(t *testing.T) {
+	errReconnect := errors.New("reconnect failed")
+	store := &Store{
+		DB: disconnectedDB(t),
+		reconnect: func() (*mongo.Database, error) {
+			return nil, errReconnect
+		},
+	}
+
+	ok, _, err := store.ConnState(context.Background())
+	if ok || !errors.Is(err, errReconnect) {
+		t.Errorf("ConnState() = %v, %v, want %v", ok, err, errReconnect)
+	}
+}
+
+func TestDB_ShouldGuardReplacedDatabase(t *testing.T) {
+	db := disconnectedDB(t)
+	replacement := disconnectedDB(t).Database()
+
+	// Run with -race to detect unguarded reads of the replaced database.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			db.setDatabase(replacement)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_ = db.Client()
+		_ = db.Name()
+	}
+	<-done
+
+	if db.Database() != replacement {
+		t.Error("setDatabase() should replace the database")
+	}
+}
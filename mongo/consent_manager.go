@@ -0,0 +1,157 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"context"
+	"time"
+
+	// External Imports
+	"github.com/ory/fosite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// ConsentManager provides a mongo backed implementation for remembering the
+// scopes a user has consented to for a given client.
+//
+// Implements:
+// - storage.Configure
+// - storage.ConsentStore
+// - storage.ConsentManager
+type ConsentManager struct {
+	DB *DB
+
+	// Clock provides the current time. Defaults to time.Now if not set.
+	Clock func() time.Time
+}
+
+// Configure implements storage.Configure.
+func (c *ConsentManager) Configure(ctx context.Context) (err error) {
+	defer classifyError(&err)
+
+	indices := []mongo.IndexModel{
+		NewUniqueIndex(IdxCompoundConsent, "user_id", "client_id"),
+		NewIndex(IdxClientID, "client_id"),
+	}
+
+	collection, err := c.DB.collection(ctx, storage.EntityConsents)
+	if err != nil {
+		return err
+	}
+	err = createIndexes(ctx, collection, indices...)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SaveConsent creates a consent resource, or overwrites the existing consent
+// resource, for the given user and client.
+func (c *ConsentManager) SaveConsent(ctx context.Context, userID string, clientID string, scopes []string, audience []string, expiresAt int64) (result storage.Consent, err error) {
+	defer classifyError(&err)
+
+	if scopes == nil {
+		scopes = []string{}
+	}
+	if audience == nil {
+		audience = []string{}
+	}
+	now := c.DB.timestamp(timeNow(c.Clock))
+
+	// Build Query
+	selector := bson.M{
+		"user_id":   userID,
+		"client_id": clientID,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"updated_at": now,
+			"scopes":     scopes,
+			"audience":   audience,
+			"expires_at": expiresAt,
+		},
+		"$setOnInsert": bson.M{
+			"created_at": now,
+		},
+	}
+
+	var consent storage.Consent
+	collection, err := c.DB.collection(ctx, storage.EntityConsents)
+	if err != nil {
+		return result, err
+	}
+	opts := options.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(options.After)
+	err = collection.FindOneAndUpdate(ctx, selector, update, opts).Decode(&consent)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return result, storage.ErrResourceExists
+		}
+		return result, err
+	}
+
+	return consent, nil
+}
+
+// GetConsent returns the consent resource for the given user and client.
+// Consent that has expired is reported as not found.
+func (c *ConsentManager) GetConsent(ctx context.Context, userID string, clientID string) (result storage.Consent, err error) {
+	defer classifyError(&err)
+
+	// Build Query
+	query := bson.M{
+		"user_id":   userID,
+		"client_id": clientID,
+	}
+
+	var consent storage.Consent
+	collection, err := c.DB.collection(ctx, storage.EntityConsents)
+	if err != nil {
+		return result, err
+	}
+	err = collection.FindOne(ctx, query).Decode(&consent)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return result, fosite.ErrNotFound
+		}
+		return result, err
+	}
+
+	if consent.IsExpired(timeNow(c.Clock)) {
+		return result, fosite.ErrNotFound
+	}
+
+	return consent, nil
+}
+
+// RevokeConsent removes the consent resource for the given user and client.
+func (c *ConsentManager) RevokeConsent(ctx context.Context, userID string, clientID string) (err error) {
+	defer classifyError(&err)
+
+	// Build Query
+	query := bson.M{
+		"user_id":   userID,
+		"client_id": clientID,
+	}
+
+	collection, err := c.DB.collection(ctx, storage.EntityConsents)
+	if err != nil {
+		return err
+	}
+	res, err := collection.DeleteOne(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return fosite.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,27 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"testing"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+func TestConsentMongoManager_ImplementsStorageConfigurer(t *testing.T) {
+	c := &ConsentManager{}
+
+	var i interface{} = c
+	if _, ok := i.(storage.Configure); !ok {
+		t.Error("ConsentManager does not implement interface storage.Configure")
+	}
+}
+
+func TestConsentMongoManager_ImplementsStorageConsentManager(t *testing.T) {
+	c := &ConsentManager{}
+
+	var i interface{} = c
+	if _, ok := i.(storage.ConsentManager); !ok {
+		t.Error("ConsentManager does not implement interface storage.ConsentManager")
+	}
+}
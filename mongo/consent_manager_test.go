@@ -0,0 +1,150 @@
+package mongo_test
+
+import (
+	// Standard Library Imports
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	// External Imports
+	"github.com/google/uuid"
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+	"github.com/p000ic/go-fosite-mongo/mongo"
+)
+
+func expectedConsent() storage.Consent {
+	return storage.Consent{
+		UserID:   uuid.NewString(),
+		ClientID: uuid.NewString(),
+		Scopes: []string{
+			"openid",
+			"urn:test:cats:read",
+		},
+		Audience: []string{
+			"https://api.example.com",
+		},
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func saveConsent(ctx context.Context, t *testing.T, store *mongo.Store, expected storage.Consent) storage.Consent {
+	got, err := store.ConsentManager.SaveConsent(ctx, expected.UserID, expected.ClientID, expected.Scopes, expected.Audience, expected.ExpiresAt)
+	if err != nil {
+		AssertError(t, err, nil, "save should return no database errors")
+		t.FailNow()
+	}
+
+	if got.CreateTime == 0 {
+		AssertError(t, got.CreateTime, time.Now().Unix(), "create time was not set")
+	}
+
+	expected.CreateTime = got.CreateTime
+	expected.UpdateTime = got.UpdateTime
+	if !reflect.DeepEqual(got, expected) {
+		AssertError(t, got, expected, "consent not equal")
+		t.FailNow()
+	}
+
+	return got
+}
+
+func TestConsentManager_SaveConsent(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	saveConsent(ctx, t, store, expectedConsent())
+}
+
+func TestConsentManager_SaveConsent_ShouldOverwrite(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	original := saveConsent(ctx, t, store, expectedConsent())
+
+	expected := original
+	expected.Scopes = []string{"openid", "offline_access"}
+	expected.Audience = []string{}
+	expected.ExpiresAt = 0
+	got := saveConsent(ctx, t, store, expected)
+	if got.CreateTime != original.CreateTime {
+		AssertError(t, got.CreateTime, original.CreateTime, "create time should be preserved on overwrite")
+	}
+
+	stored, err := store.ConsentManager.GetConsent(ctx, expected.UserID, expected.ClientID)
+	if err != nil {
+		AssertError(t, err, nil, "get should return no database errors")
+	}
+	if !reflect.DeepEqual(stored, got) {
+		AssertError(t, stored, got, "consent should be overwritten")
+	}
+}
+
+func TestConsentManager_GetConsent(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	expected := saveConsent(ctx, t, store, expectedConsent())
+	got, err := store.ConsentManager.GetConsent(ctx, expected.UserID, expected.ClientID)
+	if err != nil {
+		AssertError(t, err, nil, "get should return no database errors")
+	}
+	if !reflect.DeepEqual(got, expected) {
+		AssertError(t, got, expected, "consent not equal")
+	}
+}
+
+func TestConsentManager_GetConsent_ShouldReturnNotFound(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	expected := saveConsent(ctx, t, store, expectedConsent())
+	got, err := store.ConsentManager.GetConsent(ctx, expected.UserID, uuid.NewString())
+	if err != fosite.ErrNotFound {
+		AssertError(t, got, fosite.ErrNotFound, "get should return not found")
+	}
+}
+
+func TestConsentManager_GetConsent_ShouldReturnNotFoundWhenExpired(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	consent := expectedConsent()
+	consent.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	expected := saveConsent(ctx, t, store, consent)
+
+	got, err := store.ConsentManager.GetConsent(ctx, expected.UserID, expected.ClientID)
+	if err != fosite.ErrNotFound {
+		AssertError(t, got, fosite.ErrNotFound, "get should return not found for expired consent")
+	}
+}
+
+func TestConsentManager_RevokeConsent(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	expected := saveConsent(ctx, t, store, expectedConsent())
+	err := store.ConsentManager.RevokeConsent(ctx, expected.UserID, expected.ClientID)
+	if err != nil {
+		AssertError(t, err, nil, "revoke should return no database errors")
+	}
+
+	// Double check that the original reference was deleted
+	got, err := store.ConsentManager.GetConsent(ctx, expected.UserID, expected.ClientID)
+	if err != fosite.ErrNotFound {
+		AssertError(t, got, fosite.ErrNotFound, "get should return not found")
+	}
+}
+
+func TestConsentManager_RevokeConsent_ShouldReturnNotFound(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	err := store.ConsentManager.RevokeConsent(ctx, uuid.NewString(), uuid.NewString())
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "revoke should return not found")
+	}
+}
@@ -0,0 +1,27 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"context"
+	"sync"
+
+	// External Imports
+	"github.com/google/uuid"
+	"github.com/ory/fosite"
+)
+
+// decoyHash lazily hashes a random secret with the manager's hasher, so that
+// authenticating a missing account can compare against it and take as long
+// as authenticating with a wrong secret does.
+type decoyHash struct {
+	once sync.Once
+	hash []byte
+}
+
+// compare compares the secret against the decoy hash, which never matches.
+func (d *decoyHash) compare(ctx context.Context, hasher fosite.Hasher, secret string) {
+	d.once.Do(func() {
+		d.hash, _ = hasher.Hash(ctx, []byte(uuid.NewString()))
+	})
+	_ = hasher.Compare(ctx, d.hash, []byte(secret))
+}
@@ -3,6 +3,7 @@ package mongo
 import (
 	// Standard Library Imports
 	"context"
+	"errors"
 	"sync"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/ory/fosite"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	// Internal Imports
 	"github.com/p000ic/go-fosite-mongo"
@@ -20,6 +22,9 @@ import (
 type DeniedJtiManager struct {
 	DB *DB
 
+	// Clock provides the current time. Defaults to time.Now if not set.
+	Clock func() time.Time
+
 	BlacklistedJTIs        map[string]time.Time
 	AccessTokenRequestIDs  map[string]string
 	RefreshTokenRequestIDs map[string]string
@@ -31,12 +36,17 @@ type DeniedJtiManager struct {
 
 // Configure implements storage.Configure.
 func (d *DeniedJtiManager) Configure(ctx context.Context) (err error) {
+	defer classifyError(&err)
+
 	indices := []mongo.IndexModel{
 		NewUniqueIndex(IdxSignatureID, "signature"),
 		NewIndex(IdxExpires, "exp"),
 	}
-	collection := d.DB.Collection(storage.EntityJtiDenylist)
-	_, err = collection.Indexes().CreateMany(ctx, indices)
+	collection, err := d.DB.collection(ctx, storage.EntityJtiDenylist)
+	if err != nil {
+		return err
+	}
+	err = createIndexes(ctx, collection, indices...)
 	if err != nil {
 		return err
 	}
@@ -51,7 +61,10 @@ func (d *DeniedJtiManager) getConcrete(ctx context.Context, signature string) (r
 		"signature": signature,
 	}
 	var user storage.DeniedJTI
-	collection := d.DB.Collection(storage.EntityJtiDenylist)
+	collection, err := d.DB.collection(ctx, storage.EntityJtiDenylist)
+	if err != nil {
+		return result, err
+	}
 	err = collection.FindOne(ctx, query).Decode(&user)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
@@ -63,11 +76,18 @@ func (d *DeniedJtiManager) getConcrete(ctx context.Context, signature string) (r
 	return user, nil
 }
 
-// Create creates a new User resource and returns the newly created User
-// resource.
+// Create creates a new denied jti resource, keyed on the JTI's normalized
+// signature, and returns the newly created denied jti resource.
 func (d *DeniedJtiManager) Create(ctx context.Context, deniedJTI storage.DeniedJTI) (result storage.DeniedJTI, err error) {
+	defer classifyError(&err)
+
+	deniedJTI = deniedJTI.Normalize()
+
 	// Create resource
-	collection := d.DB.Collection(storage.EntityJtiDenylist)
+	collection, err := d.DB.collection(ctx, storage.EntityJtiDenylist)
+	if err != nil {
+		return result, err
+	}
 	_, err = collection.InsertOne(ctx, deniedJTI)
 	if err != nil {
 		if mongo.IsDuplicateKeyError(err) {
@@ -79,18 +99,26 @@ func (d *DeniedJtiManager) Create(ctx context.Context, deniedJTI storage.DeniedJ
 	return deniedJTI, nil
 }
 
-// Get returns the specified User resource.
-func (d *DeniedJtiManager) Get(ctx context.Context, signature string) (result storage.DeniedJTI, err error) {
-	return d.getConcrete(ctx, signature)
+// Get returns the specified denied jti resource. As denied JTIs are keyed on
+// their signature, the raw JTI is hashed to look it up.
+func (d *DeniedJtiManager) Get(ctx context.Context, jti string) (result storage.DeniedJTI, err error) {
+	defer classifyError(&err)
+
+	return d.getConcrete(ctx, storage.SignatureFromJTI(jti))
 }
 
 func (d *DeniedJtiManager) Delete(ctx context.Context, jti string) (err error) {
+	defer classifyError(&err)
+
 	// Build Query
 	query := bson.M{
 		"signature": storage.SignatureFromJTI(jti),
 	}
 
-	collection := d.DB.Collection(storage.EntityJtiDenylist)
+	collection, err := d.DB.collection(ctx, storage.EntityJtiDenylist)
+	if err != nil {
+		return err
+	}
 	res, err := collection.DeleteOne(ctx, query)
 	if err != nil {
 		return err
@@ -103,17 +131,95 @@ func (d *DeniedJtiManager) Delete(ctx context.Context, jti string) (err error) {
 	return nil
 }
 
-// DeleteBefore DeleteExpired removes all JTIs before the given time. Returns not found if
-// no tokens were found before the given time.
+// CreateMany denies a batch of JTIs in a single unordered insert, so that a
+// JTI that has already been denied doesn't prevent the rest of the batch from
+// being stored. Returns the number of JTIs newly denied.
+func (d *DeniedJtiManager) CreateMany(ctx context.Context, deniedJTIs []storage.DeniedJTI) (inserted int, err error) {
+	defer classifyError(&err)
+
+	if len(deniedJTIs) == 0 {
+		return 0, nil
+	}
+
+	docs := make([]interface{}, len(deniedJTIs))
+	for i := range deniedJTIs {
+		docs[i] = deniedJTIs[i].Normalize()
+	}
+
+	collection, err := d.DB.collection(ctx, storage.EntityJtiDenylist)
+	if err != nil {
+		return inserted, err
+	}
+	res, err := collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err != nil {
+		var bulkErr mongo.BulkWriteException
+		if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+			return 0, err
+		}
+
+		// Duplicates are tolerated, any other write error isn't.
+		for _, writeErr := range bulkErr.WriteErrors {
+			if !mongo.IsDuplicateKeyError(writeErr) {
+				return 0, err
+			}
+		}
+
+		return len(deniedJTIs) - len(bulkErr.WriteErrors), nil
+	}
+
+	return len(res.InsertedIDs), nil
+}
+
+// DeleteMany removes a batch of denied JTIs. Returns not found if none of the
+// JTIs were denied.
+func (d *DeniedJtiManager) DeleteMany(ctx context.Context, jtis []string) (err error) {
+	defer classifyError(&err)
+
+	signatures := make([]string, len(jtis))
+	for i := range jtis {
+		signatures[i] = storage.SignatureFromJTI(jtis[i])
+	}
+
+	// Build Query
+	query := bson.M{
+		"signature": bson.M{
+			"$in": signatures,
+		},
+	}
+
+	collection, err := d.DB.collection(ctx, storage.EntityJtiDenylist)
+	if err != nil {
+		return err
+	}
+	res, err := collection.DeleteMany(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return fosite.ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteBefore removes all JTIs expiring before the given unix time, rather
+// than the current time, so that callers control the cut-off. Returns not
+// found if no JTIs expire before the given time.
 func (d *DeniedJtiManager) DeleteBefore(ctx context.Context, expBefore int64) (err error) {
+	defer classifyError(&err)
+
 	// Build Query
 	query := bson.M{
 		"exp": bson.M{
-			"$lt": time.Now().Unix(),
+			"$lt": expBefore,
 		},
 	}
 
-	collection := d.DB.Collection(storage.EntityJtiDenylist)
+	collection, err := d.DB.collection(ctx, storage.EntityJtiDenylist)
+	if err != nil {
+		return err
+	}
 	res, err := collection.DeleteMany(ctx, query)
 	if err != nil {
 		return err
@@ -126,6 +232,49 @@ func (d *DeniedJtiManager) DeleteBefore(ctx context.Context, expBefore int64) (e
 	return nil
 }
 
+// PurgeExpired removes all JTIs which have expired, returning the number of
+// JTIs removed. Unlike DeleteBefore, purging an already compact denylist
+// isn't an error.
+func (d *DeniedJtiManager) PurgeExpired(ctx context.Context) (deleted int64, err error) {
+	defer classifyError(&err)
+
+	// Build Query
+	query := bson.M{
+		"exp": bson.M{
+			"$lt": timeNow(d.Clock).Unix(),
+		},
+	}
+
+	collection, err := d.DB.collection(ctx, storage.EntityJtiDenylist)
+	if err != nil {
+		return 0, err
+	}
+	res, err := collection.DeleteMany(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.DeletedCount, nil
+}
+
+// CountActive returns the number of JTIs which are yet to expire.
+func (d *DeniedJtiManager) CountActive(ctx context.Context) (count int64, err error) {
+	defer classifyError(&err)
+
+	// Build Query
+	query := bson.M{
+		"exp": bson.M{
+			"$gte": timeNow(d.Clock).Unix(),
+		},
+	}
+
+	collection, err := d.DB.collection(ctx, storage.EntityJtiDenylist)
+	if err != nil {
+		return count, err
+	}
+	return collection.CountDocuments(ctx, query)
+}
+
 // func (d *DeniedJtiManager) IsJWTUsed(ctx context.Context, jti string) (bool, error) {
 //	err := d.ClientAssertionJWTValid(ctx, jti)
 //	if err != nil {
@@ -143,7 +292,7 @@ func (d *DeniedJtiManager) ClientAssertionJWTValid(_ context.Context, jti string
 	d.blacklistedJTIsMutex.RLock()
 	defer d.blacklistedJTIsMutex.RUnlock()
 
-	if exp, exists := d.BlacklistedJTIs[jti]; exists && exp.After(time.Now()) {
+	if exp, exists := d.BlacklistedJTIs[jti]; exists && exp.After(timeNow(d.Clock)) {
 		return fosite.ErrJTIKnown
 	}
 
@@ -156,7 +305,7 @@ func (d *DeniedJtiManager) SetClientAssertionJWT(_ context.Context, jti string,
 
 	// delete expired jtis
 	for j, e := range d.BlacklistedJTIs {
-		if e.Before(time.Now()) {
+		if e.Before(timeNow(d.Clock)) {
 			delete(d.BlacklistedJTIs, j)
 		}
 	}
@@ -0,0 +1,83 @@
+package mongo_test
+
+import (
+	// Standard Library Imports
+	"testing"
+	"time"
+
+	// External Imports
+	"github.com/google/uuid"
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+func TestDeniedJtiManager_CreateMany(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	exp := time.Now().Add(time.Hour)
+	existing := storage.NewDeniedJTI(uuid.NewString(), exp)
+	_, err := store.DeniedJTIManager.Create(ctx, existing)
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	batch := []storage.DeniedJTI{
+		storage.NewDeniedJTI(uuid.NewString(), exp),
+		existing,
+		storage.NewDeniedJTI(uuid.NewString(), exp),
+	}
+	got, err := store.DeniedJTIManager.CreateMany(ctx, batch)
+	if err != nil {
+		AssertFatal(t, err, nil, "create many should tolerate already denied jtis")
+	}
+	if got != 2 {
+		AssertError(t, got, 2, "create many should return the number of newly denied jtis")
+	}
+
+	for _, deniedJTI := range batch {
+		_, err = store.DeniedJTIManager.Get(ctx, deniedJTI.JTI)
+		if err != nil {
+			AssertError(t, err, nil, "each jti in the batch should be denied")
+		}
+	}
+
+	got, err = store.DeniedJTIManager.CreateMany(ctx, nil)
+	if err != nil || got != 0 {
+		AssertError(t, err, nil, "create many with an empty batch should do nothing")
+	}
+}
+
+func TestDeniedJtiManager_DeleteMany(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	exp := time.Now().Add(time.Hour)
+	batch := []storage.DeniedJTI{
+		storage.NewDeniedJTI(uuid.NewString(), exp),
+		storage.NewDeniedJTI(uuid.NewString(), exp),
+	}
+	_, err := store.DeniedJTIManager.CreateMany(ctx, batch)
+	if err != nil {
+		AssertFatal(t, err, nil, "create many should return no database errors")
+	}
+
+	err = store.DeniedJTIManager.DeleteMany(ctx, []string{batch[0].JTI, batch[1].JTI, uuid.NewString()})
+	if err != nil {
+		AssertFatal(t, err, nil, "delete many should return no database errors")
+	}
+
+	for _, deniedJTI := range batch {
+		_, err = store.DeniedJTIManager.Get(ctx, deniedJTI.JTI)
+		if err != fosite.ErrNotFound {
+			AssertError(t, err, fosite.ErrNotFound, "each jti in the batch should be removed")
+		}
+	}
+
+	err = store.DeniedJTIManager.DeleteMany(ctx, []string{batch[0].JTI})
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "delete many should return not found if nothing was removed")
+	}
+}
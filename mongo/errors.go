@@ -0,0 +1,58 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"errors"
+	"fmt"
+
+	// External Imports
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// codeWriteConcernFailed is the server error code reported when a write
+// concern isn't satisfied within its wtimeout.
+const codeWriteConcernFailed = 64
+
+// classify wraps driver errors reporting mongo as unreachable, or as not
+// responding in time, with storage.ErrStorageUnavailable or storage.ErrTimeout
+// respectively, so callers can retry transient failures without matching on
+// driver errors. The driver error remains available to errors.Is and
+// errors.As, and any other error is returned unaltered.
+func classify(err error) error {
+	if err == nil ||
+		errors.Is(err, storage.ErrStorageUnavailable) ||
+		errors.Is(err, storage.ErrTimeout) {
+		return err
+	}
+
+	var selectionErr topology.ServerSelectionError
+	var writeErr mongo.WriteException
+	var labeledErr mongo.LabeledError
+	switch {
+	case errors.As(err, &selectionErr),
+		errors.Is(err, topology.ErrServerSelectionTimeout):
+		// No server was selectable before the selection timeout elapsed.
+		return fmt.Errorf("%w: %w", storage.ErrStorageUnavailable, err)
+
+	case mongo.IsTimeout(err),
+		errors.As(err, &writeErr) && writeErr.WriteConcernError != nil && writeErr.WriteConcernError.Code == codeWriteConcernFailed:
+		return fmt.Errorf("%w: %w", storage.ErrTimeout, err)
+
+	case mongo.IsNetworkError(err),
+		errors.Is(err, mongo.ErrClientDisconnected),
+		errors.As(err, &labeledErr) && labeledErr.HasErrorLabel("RetryableWriteError"):
+		return fmt.Errorf("%w: %w", storage.ErrStorageUnavailable, err)
+	}
+
+	return err
+}
+
+// classifyError classifies the error pointed to, for deferring in methods
+// returning a named error.
+func classifyError(err *error) {
+	*err = classify(*err)
+}
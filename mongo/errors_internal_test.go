@@ -0,0 +1,103 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	// External Imports
+	"github.com/ory/fosite"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{
+			name: "should pass through no error",
+			err:  nil,
+			want: nil,
+		},
+		{
+			name: "should pass through not found",
+			err:  fosite.ErrNotFound,
+			want: fosite.ErrNotFound,
+		},
+		{
+			name: "should pass through a duplicate key error",
+			err: mongo.WriteException{WriteErrors: mongo.WriteErrors{
+				{Code: 11000, Message: "E11000 duplicate key error"},
+			}},
+		},
+		{
+			name: "should classify a server selection error as unavailable",
+			err:  topology.ServerSelectionError{Wrapped: topology.ErrServerSelectionTimeout},
+			want: storage.ErrStorageUnavailable,
+		},
+		{
+			name: "should classify a disconnected client as unavailable",
+			err:  mongo.ErrClientDisconnected,
+			want: storage.ErrStorageUnavailable,
+		},
+		{
+			name: "should classify a network error as unavailable",
+			err:  mongo.CommandError{Code: 6, Labels: []string{"NetworkError"}},
+			want: storage.ErrStorageUnavailable,
+		},
+		{
+			name: "should classify a retryable write error as unavailable",
+			err:  mongo.CommandError{Code: 189, Labels: []string{"RetryableWriteError"}},
+			want: storage.ErrStorageUnavailable,
+		},
+		{
+			name: "should classify an exceeded deadline as a timeout",
+			err:  context.DeadlineExceeded,
+			want: storage.ErrTimeout,
+		},
+		{
+			name: "should classify an exceeded max time as a timeout",
+			err:  mongo.CommandError{Code: 50, Name: "MaxTimeMSExpired"},
+			want: storage.ErrTimeout,
+		},
+		{
+			name: "should classify an unsatisfied write concern as a timeout",
+			err: mongo.WriteException{WriteConcernError: &mongo.WriteConcernError{
+				Code:    64,
+				Message: "waiting for replication timed out",
+			}},
+			want: storage.ErrTimeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classify(tt.err)
+			if tt.want == nil || tt.want == tt.err {
+				if !reflect.DeepEqual(got, tt.err) {
+					t.Errorf("classify() = %v, want the error unaltered: %v", got, tt.err)
+				}
+				return
+			}
+
+			if !errors.Is(got, tt.want) {
+				t.Errorf("classify() = %v, want: %v", got, tt.want)
+			}
+			// Driver errors aren't necessarily comparable, so match by type.
+			driverErr := reflect.New(reflect.TypeOf(tt.err))
+			if !errors.As(got, driverErr.Interface()) {
+				t.Errorf("classify() = %v, should wrap the driver error: %v", got, tt.err)
+			}
+			if again := classify(got); again != got {
+				t.Errorf("classify() should not reclassify a classified error, got: %v", again)
+			}
+		})
+	}
+}
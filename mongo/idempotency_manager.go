@@ -0,0 +1,141 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"context"
+	"time"
+
+	// External Imports
+	"github.com/ory/fosite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// IdempotencyManager provides a mongo backed implementation for storing and
+// replaying the results of idempotent requests.
+//
+// Implements:
+// - storage.Configure
+// - storage.IdempotencyStore
+// - storage.IdempotencyManager
+type IdempotencyManager struct {
+	DB *DB
+
+	// Clock provides the current time. Defaults to time.Now if not set.
+	Clock func() time.Time
+}
+
+// Configure implements storage.Configure.
+func (i *IdempotencyManager) Configure(ctx context.Context) (err error) {
+	defer classifyError(&err)
+
+	indices := []mongo.IndexModel{
+		// Note:
+		// - Stores created before keys were scoped to clients hold a unique
+		//   signature index, which stops clients reusing each other's keys
+		//   until dropped via Store.RebuildIndexes.
+		NewUniqueIndex(IdxCompoundIdempotencyKey, "client_id", "signature"),
+		// Results are purged by mongo as soon as they expire.
+		NewExpiryIndex(IdxExpiry+"ExpiresAt", "expires_at", 0),
+	}
+
+	collection, err := i.DB.collection(ctx, storage.EntityIdempotencyKeys)
+	if err != nil {
+		return err
+	}
+	err = createIndexes(ctx, collection, indices...)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// StoreIdempotentResult stores the result of the request made by the client
+// with the key until the ttl elapses. Returns storage.ErrInvalidTTL if the ttl
+// isn't positive, and storage.ErrResourceExists if a result has already been
+// stored for the client's key and hasn't expired. The result is stored as
+// provided, see storage.IdempotencyStore.
+func (i *IdempotencyManager) StoreIdempotentResult(ctx context.Context, clientID string, key string, result []byte, ttl time.Duration) (err error) {
+	defer classifyError(&err)
+
+	if ttl <= 0 {
+		return storage.ErrInvalidTTL
+	}
+
+	now := timeNow(i.Clock)
+	stored := storage.NewIdempotentResult(clientID, key, result, now.Add(ttl))
+
+	collection, err := i.DB.collection(ctx, storage.EntityIdempotencyKeys)
+	if err != nil {
+		return err
+	}
+	_, err = collection.InsertOne(ctx, stored)
+	if err == nil {
+		return nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	// Mongo's TTL monitor only purges expired records periodically, so an
+	// expired result may still be stored. In which case, the key can be
+	// reclaimed.
+	selector := bson.M{
+		"client_id": stored.ClientID,
+		"signature": stored.Signature,
+		"expires_at": bson.M{
+			"$lte": now,
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"result":     stored.Result,
+			"expires_at": stored.ExpiresAt,
+		},
+	}
+	res, err := collection.UpdateOne(ctx, selector, update)
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return storage.ErrResourceExists
+	}
+
+	return nil
+}
+
+// GetIdempotentResult returns the result stored for the client's key. Returns
+// fosite.ErrNotFound if no result has been stored for the client's key, or the
+// result has expired.
+func (i *IdempotencyManager) GetIdempotentResult(ctx context.Context, clientID string, key string) (result []byte, err error) {
+	defer classifyError(&err)
+
+	// Build Query
+	query := bson.M{
+		"client_id": clientID,
+		"signature": storage.SignatureFromJTI(key),
+		"expires_at": bson.M{
+			"$gt": timeNow(i.Clock),
+		},
+	}
+
+	var stored storage.IdempotentResult
+	collection, err := i.DB.collection(ctx, storage.EntityIdempotencyKeys)
+	if err != nil {
+		return result, err
+	}
+	err = collection.FindOne(ctx, query).Decode(&stored)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fosite.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return stored.Result, nil
+}
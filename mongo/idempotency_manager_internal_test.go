@@ -0,0 +1,27 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"testing"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+func TestIdempotencyMongoManager_ImplementsStorageConfigurer(t *testing.T) {
+	i := &IdempotencyManager{}
+
+	var iface interface{} = i
+	if _, ok := iface.(storage.Configure); !ok {
+		t.Error("IdempotencyManager does not implement interface storage.Configure")
+	}
+}
+
+func TestIdempotencyMongoManager_ImplementsStorageIdempotencyManager(t *testing.T) {
+	i := &IdempotencyManager{}
+
+	var iface interface{} = i
+	if _, ok := iface.(storage.IdempotencyManager); !ok {
+		t.Error("IdempotencyManager does not implement interface storage.IdempotencyManager")
+	}
+}
@@ -0,0 +1,84 @@
+package mongo_test
+
+import (
+	// Standard Library Imports
+	"testing"
+	"time"
+
+	// External Imports
+	"github.com/google/uuid"
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+	"github.com/p000ic/go-fosite-mongo/mongo"
+)
+
+func TestIdempotencyManager_StoreIdempotentResult(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	err := store.StoreIdempotentResult(ctx, uuid.NewString(), uuid.NewString(), []byte("foo"), time.Hour)
+	if err != nil {
+		AssertError(t, err, nil, "first store of a result should succeed")
+	}
+}
+
+func TestIdempotencyManager_GetIdempotentResult_ShouldReplay(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	clientID := uuid.NewString()
+	key := uuid.NewString()
+	err := store.StoreIdempotentResult(ctx, clientID, key, []byte("foo"), time.Hour)
+	if err != nil {
+		AssertFatal(t, err, nil, "first store of a result should succeed")
+	}
+
+	got, err := store.GetIdempotentResult(ctx, clientID, key)
+	if err != nil {
+		AssertFatal(t, err, nil, "get of a stored result should succeed")
+	}
+	if string(got) != "foo" {
+		AssertError(t, string(got), "foo", "get should replay the stored result")
+	}
+
+	err = store.StoreIdempotentResult(ctx, clientID, key, []byte("bar"), time.Hour)
+	if err != storage.ErrResourceExists {
+		AssertError(t, err, storage.ErrResourceExists, "second store of a result within the ttl should be rejected")
+	}
+}
+
+func TestIdempotencyManager_GetIdempotentResult_ShouldExpire(t *testing.T) {
+	now := time.Now()
+	cfg := mongo.DefaultConfig()
+	cfg.Clock = frozenClock(&now)
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	clientID := uuid.NewString()
+	key := uuid.NewString()
+	err := store.StoreIdempotentResult(ctx, clientID, key, []byte("foo"), time.Minute)
+	if err != nil {
+		AssertFatal(t, err, nil, "first store of a result should succeed")
+	}
+
+	now = now.Add(2 * time.Minute)
+	_, err = store.GetIdempotentResult(ctx, clientID, key)
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "get of an expired result should return not found")
+	}
+
+	err = store.StoreIdempotentResult(ctx, clientID, key, []byte("bar"), time.Minute)
+	if err != nil {
+		AssertFatal(t, err, nil, "store of a result for an expired key should succeed")
+	}
+
+	got, err := store.GetIdempotentResult(ctx, clientID, key)
+	if err != nil {
+		AssertFatal(t, err, nil, "get of a restored result should succeed")
+	}
+	if string(got) != "bar" {
+		AssertError(t, string(got), "bar", "get should replay the newly stored result")
+	}
+}
@@ -0,0 +1,47 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"context"
+)
+
+// cursor provides the subset of *mongo.Cursor used to iterate over query
+// results.
+type cursor interface {
+	Next(ctx context.Context) bool
+	Decode(val interface{}) error
+	Err() error
+	Close(ctx context.Context) error
+}
+
+// iterate decodes each document returned by the cursor and passes it to fn,
+// stopping at the first error returned by fn. Cancellation of the context is
+// checked between documents, as the cursor only observes the context when it
+// fetches another batch from the server. The cursor is always closed.
+//
+// Streaming APIs should iterate with this, rather than looping over the cursor
+// by hand, so they honor cancellation promptly and don't leak cursors.
+func iterate[T any](ctx context.Context, cursor cursor, fn func(document T) error) error {
+	// Close the cursor even if the context has been cancelled, so that the
+	// server side cursor is killed rather than left to time out.
+	defer cursor.Close(context.WithoutCancel(ctx))
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !cursor.Next(ctx) {
+			break
+		}
+
+		var document T
+		if err := cursor.Decode(&document); err != nil {
+			return err
+		}
+		if err := fn(document); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
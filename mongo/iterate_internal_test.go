@@ -0,0 +1,104 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	// External Imports
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// closeRecorder records whether the wrapped cursor has been closed.
+type closeRecorder struct {
+	cursor
+	closed bool
+}
+
+func (c *closeRecorder) Close(ctx context.Context) error {
+	c.closed = true
+	return c.cursor.Close(ctx)
+}
+
+// newTestCursor returns a cursor over the given documents, which doesn't
+// require a database.
+func newTestCursor(t *testing.T, documents ...bson.M) *closeRecorder {
+	t.Helper()
+
+	docs := make([]interface{}, len(documents))
+	for i := range documents {
+		docs[i] = documents[i]
+	}
+	c, err := mongo.NewCursorFromDocuments(docs, nil, newTimestampRegistry(false))
+	if err != nil {
+		t.Fatalf("unable to create cursor: %s", err)
+	}
+
+	return &closeRecorder{cursor: c}
+}
+
+func TestIterate(t *testing.T) {
+	c := newTestCursor(t, bson.M{"id": "a"}, bson.M{"id": "b"}, bson.M{"id": "c"})
+
+	var got []string
+	err := iterate(context.Background(), c, func(document bson.Raw) error {
+		got = append(got, document.Lookup("id").StringValue())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("iterate() error = %v", err)
+	}
+	if expected := []string{"a", "b", "c"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("iterate() got: %v, expected: %v", got, expected)
+	}
+	if !c.closed {
+		t.Error("expected the cursor to be closed")
+	}
+}
+
+func TestIterate_ShouldStopWhenCancelled(t *testing.T) {
+	c := newTestCursor(t, bson.M{"id": "a"}, bson.M{"id": "b"}, bson.M{"id": "c"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+	err := iterate(ctx, c, func(document struct{ ID string }) error {
+		calls++
+		if calls == 2 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("iterate() error = %v, expected: %v", err, context.Canceled)
+	}
+	if calls != 2 {
+		t.Errorf("expected iteration to stop once cancelled, got %d calls", calls)
+	}
+	if !c.closed {
+		t.Error("expected the cursor to be closed")
+	}
+}
+
+func TestIterate_ShouldStopOnError(t *testing.T) {
+	c := newTestCursor(t, bson.M{"id": "a"}, bson.M{"id": "b"})
+	expected := errors.New("boom")
+
+	calls := 0
+	err := iterate(context.Background(), c, func(document bson.Raw) error {
+		calls++
+		return expected
+	})
+	if !errors.Is(err, expected) {
+		t.Errorf("iterate() error = %v, expected: %v", err, expected)
+	}
+	if calls != 1 {
+		t.Errorf("expected iteration to stop at the first error, got %d calls", calls)
+	}
+	if !c.closed {
+		t.Error("expected the cursor to be closed")
+	}
+}
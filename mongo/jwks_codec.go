@@ -0,0 +1,76 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"encoding/json"
+	"reflect"
+
+	// External Imports
+	"github.com/go-jose/go-jose/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// baseRegistry encodes and decodes the storage types using the default codecs
+// plus the codecs for types bson is unable to represent natively.
+var baseRegistry = newBaseRegistry()
+
+// newBaseRegistry returns a registry containing the default codecs plus the
+// codecs for types bson is unable to represent natively.
+func newBaseRegistry() *bsoncodec.Registry {
+	registry := bson.NewRegistry()
+	registry.RegisterTypeEncoder(reflect.TypeOf(jose.JSONWebKeySet{}), jwksCodec{})
+	registry.RegisterTypeDecoder(reflect.TypeOf(jose.JSONWebKeySet{}), jwksCodec{})
+
+	return registry
+}
+
+// jwksCodec stores JSON web key sets as a document in their RFC 7517 JSON
+// representation, as the parsed keys hold crypto types that can't otherwise be
+// stored.
+type jwksCodec struct{}
+
+// EncodeValue implements bsoncodec.ValueEncoder.
+func (jwksCodec) EncodeValue(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	b, err := json.Marshal(val.Interface())
+	if err != nil {
+		return err
+	}
+
+	var doc bson.Raw
+	err = bson.UnmarshalExtJSON(b, false, &doc)
+	if err != nil {
+		return err
+	}
+
+	return bsonrw.Copier{}.CopyDocumentFromBytes(vw, doc)
+}
+
+// DecodeValue implements bsoncodec.ValueDecoder.
+func (jwksCodec) DecodeValue(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	if vr.Type() == bsontype.Null {
+		val.Set(reflect.Zero(val.Type()))
+		return vr.ReadNull()
+	}
+
+	doc, err := bsonrw.Copier{}.CopyDocumentToBytes(vr)
+	if err != nil {
+		return err
+	}
+
+	b, err := bson.MarshalExtJSON(bson.Raw(doc), false, false)
+	if err != nil {
+		return err
+	}
+
+	var jwks jose.JSONWebKeySet
+	err = json.Unmarshal(b, &jwks)
+	if err != nil {
+		return err
+	}
+	val.Set(reflect.ValueOf(jwks))
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	// External Imports
+	"github.com/go-jose/go-jose/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+func TestJWKSCodec_ShouldRoundTrip(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating a key should return no errors, got: %v", err)
+	}
+	client := storage.Client{
+		ID: "client",
+		JSONWebKeys: &jose.JSONWebKeySet{
+			Keys: []jose.JSONWebKey{
+				{Key: &privateKey.PublicKey, KeyID: "key-1", Algorithm: "RS256", Use: "sig"},
+			},
+		},
+	}
+
+	doc, err := bson.MarshalWithRegistry(newTimestampRegistry(false), &client)
+	if err != nil {
+		t.Fatalf("marshal should return no errors, got: %v", err)
+	}
+	jwks := bson.Raw(doc).Lookup("jwks")
+	if jwks.Type != bsontype.EmbeddedDocument {
+		t.Fatalf("the key set should be stored as a document, got: %v", jwks.Type)
+	}
+	if kid := bson.Raw(doc).Lookup("jwks", "keys", "0", "kid").StringValue(); kid != "key-1" {
+		t.Errorf("the key set should be stored in its JSON representation, expected kid: key-1, got: %s", kid)
+	}
+
+	var got storage.Client
+	err = bson.UnmarshalWithRegistry(newTimestampRegistry(false), doc, &got)
+	if err != nil {
+		t.Fatalf("unmarshal should return no errors, got: %v", err)
+	}
+	keys := got.JSONWebKeys.Key("key-1")
+	if len(keys) != 1 {
+		t.Fatalf("the key should be decoded, expected: 1 key, got: %d", len(keys))
+	}
+	publicKey, ok := keys[0].Key.(*rsa.PublicKey)
+	if !ok || !publicKey.Equal(&privateKey.PublicKey) {
+		t.Errorf("the decoded key should match, expected: %v, got: %v", &privateKey.PublicKey, keys[0].Key)
+	}
+}
+
+func TestJWKSCodec_ShouldOmitMissingKeySet(t *testing.T) {
+	doc, err := bson.MarshalWithRegistry(newTimestampRegistry(false), &storage.Client{ID: "client"})
+	if err != nil {
+		t.Fatalf("marshal should return no errors, got: %v", err)
+	}
+
+	_, err = bson.Raw(doc).LookupErr("jwks")
+	if err == nil {
+		t.Error("a missing key set should not be stored")
+	}
+
+	var got storage.Client
+	err = bson.UnmarshalWithRegistry(newTimestampRegistry(false), doc, &got)
+	if err != nil {
+		t.Fatalf("unmarshal should return no errors, got: %v", err)
+	}
+	if got.JSONWebKeys != nil {
+		t.Errorf("a missing key set should decode as nil, got: %v", got.JSONWebKeys)
+	}
+}
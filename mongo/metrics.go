@@ -0,0 +1,82 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"time"
+
+	// External Imports
+	"github.com/ory/fosite"
+)
+
+// Counters reported to a MetricsFunc.
+const (
+	// MetricTokensIssued counts the access and refresh tokens issued, labeled
+	// by token type and grant type.
+	MetricTokensIssued = "tokens_issued"
+
+	// MetricTokensRevoked counts the access and refresh tokens revoked,
+	// labeled by token type.
+	MetricTokensRevoked = "tokens_revoked"
+
+	// MetricAuthorizeCodesInvalidated counts the authorization codes
+	// invalidated upon being exchanged.
+	MetricAuthorizeCodesInvalidated = "authorize_codes_invalidated"
+
+	// MetricCommandDuration times the mongo commands issued, labeled by
+	// command and outcome, see NewCommandMonitor.
+	MetricCommandDuration = "command_duration"
+)
+
+// Labels reported to a MetricsFunc.
+const (
+	// LabelTokenType labels a counter with the type of token, either
+	// access_token or refresh_token.
+	LabelTokenType = "token_type"
+
+	// LabelGrantType labels a counter with the grant type the token was
+	// issued for, for example, authorization_code or client_credentials.
+	LabelGrantType = "grant_type"
+
+	// LabelCommand labels a timing with the name of the mongo command, for
+	// example, find or insert.
+	LabelCommand = "command"
+
+	// LabelOutcome labels a timing with whether the command succeeded or
+	// failed.
+	LabelOutcome = "outcome"
+)
+
+// MetricsFunc increments the named counter by one, labeled with the provided
+// labels. It is called synchronously, so shouldn't block.
+type MetricsFunc func(name string, labels map[string]string)
+
+// TimingsFunc records the duration against the named timing, labeled with the
+// provided labels. It is called synchronously, so shouldn't block.
+type TimingsFunc func(name string, duration time.Duration, labels map[string]string)
+
+// incCounter increments the named counter, if metrics have been configured.
+func (r *RequestManager) incCounter(name string, labels map[string]string) {
+	if r.Metrics != nil {
+		r.Metrics(name, labels)
+	}
+}
+
+// grantTypeFromRequest returns the grant type the request was made with.
+// Tokens issued from the authorization endpoint are reported as implicit.
+func grantTypeFromRequest(request fosite.Requester) string {
+	if accessRequest, ok := request.(fosite.AccessRequester); ok {
+		if grantTypes := accessRequest.GetGrantTypes(); len(grantTypes) > 0 {
+			return grantTypes[0]
+		}
+	}
+
+	if grantType := request.GetRequestForm().Get("grant_type"); grantType != "" {
+		return grantType
+	}
+
+	if _, ok := request.(fosite.AuthorizeRequester); ok {
+		return "implicit"
+	}
+
+	return "unknown"
+}
@@ -0,0 +1,51 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"testing"
+
+	// External Imports
+	"github.com/ory/fosite"
+)
+
+func TestGrantTypeFromRequest(t *testing.T) {
+	accessRequest := fosite.NewAccessRequest(&fosite.DefaultSession{})
+	accessRequest.GrantTypes = fosite.Arguments{"client_credentials"}
+
+	formRequest := fosite.NewRequest()
+	formRequest.Form.Set("grant_type", "refresh_token")
+
+	tests := []struct {
+		name     string
+		request  fosite.Requester
+		expected string
+	}{
+		{
+			name:     "should use the access request's grant type",
+			request:  accessRequest,
+			expected: "client_credentials",
+		},
+		{
+			name:     "should fall back to the form's grant type",
+			request:  formRequest,
+			expected: "refresh_token",
+		},
+		{
+			name:     "should report authorize requests as implicit",
+			request:  fosite.NewAuthorizeRequest(),
+			expected: "implicit",
+		},
+		{
+			name:     "should report an unknown grant type",
+			request:  fosite.NewRequest(),
+			expected: "unknown",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := grantTypeFromRequest(tt.request); got != tt.expected {
+				t.Errorf("grantTypeFromRequest() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package mongo_test
+
+import (
+	// Standard Library Imports
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	// External Imports
+	"github.com/google/uuid"
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo/mongo"
+)
+
+// counters records the counters reported to a mongo.MetricsFunc, keyed by
+// name and labels.
+type counters struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (c *counters) inc(name string, labels map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[c.key(name, labels)]++
+}
+
+func (c *counters) get(name string, labels map[string]string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[c.key(name, labels)]
+}
+
+func (c *counters) key(name string, labels map[string]string) string {
+	// fmt prints maps sorted by key.
+	return fmt.Sprintf("%s%v", name, labels)
+}
+
+func TestRequestManager_ShouldCountTokens(t *testing.T) {
+	metrics := &counters{counts: map[string]int{}}
+	cfg := mongo.DefaultConfig()
+	cfg.Metrics = metrics.inc
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	request := fosite.NewAccessRequest(&fosite.DefaultSession{Subject: uuid.NewString()})
+	request.ID = uuid.NewString()
+	request.Client = &fosite.DefaultClient{ID: uuid.NewString()}
+	request.GrantTypes = fosite.Arguments{"authorization_code"}
+
+	err := store.CreateAccessTokenSession(ctx, uuid.NewString(), request)
+	if err != nil {
+		AssertFatal(t, err, nil, "create access token should return no database errors")
+	}
+	err = store.CreateRefreshTokenSession(ctx, uuid.NewString(), request)
+	if err != nil {
+		AssertFatal(t, err, nil, "create refresh token should return no database errors")
+	}
+
+	for _, tokenType := range []fosite.TokenType{fosite.AccessToken, fosite.RefreshToken} {
+		labels := map[string]string{
+			mongo.LabelTokenType: string(tokenType),
+			mongo.LabelGrantType: "authorization_code",
+		}
+		if got := metrics.get(mongo.MetricTokensIssued, labels); got != 1 {
+			AssertError(t, got, 1, fmt.Sprintf("issuing a %s should be counted", tokenType))
+		}
+	}
+
+	err = store.RevokeAccessToken(ctx, request.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "revoke access token should return no database errors")
+	}
+	err = store.RevokeRefreshToken(ctx, request.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "revoke refresh token should return no database errors")
+	}
+
+	// Revoking tokens that no longer exist should not be counted.
+	err = store.RevokeAccessToken(ctx, request.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "revoke access token should return no database errors")
+	}
+
+	for _, tokenType := range []fosite.TokenType{fosite.AccessToken, fosite.RefreshToken} {
+		labels := map[string]string{
+			mongo.LabelTokenType: string(tokenType),
+		}
+		if got := metrics.get(mongo.MetricTokensRevoked, labels); got != 1 {
+			AssertError(t, got, 1, fmt.Sprintf("revoking a %s should be counted", tokenType))
+		}
+	}
+}
+
+func TestRequestManager_ShouldCountInvalidatedAuthorizeCodes(t *testing.T) {
+	metrics := &counters{counts: map[string]int{}}
+	cfg := mongo.DefaultConfig()
+	cfg.Metrics = metrics.inc
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	code := uuid.NewString()
+	err := store.CreateAuthorizeCodeSession(ctx, code, newRequester(uuid.NewString(), uuid.NewString()))
+	if err != nil {
+		AssertFatal(t, err, nil, "create authorize code should return no database errors")
+	}
+
+	err = store.InvalidateAuthorizeCodeSession(ctx, code)
+	if err != nil {
+		AssertFatal(t, err, nil, "invalidate authorize code should return no database errors")
+	}
+
+	if got := metrics.get(mongo.MetricAuthorizeCodesInvalidated, nil); got != 1 {
+		AssertError(t, got, 1, "invalidating an authorize code should be counted")
+	}
+}
+
+func TestStore_ShouldRecordCommandDurations(t *testing.T) {
+	var mu sync.Mutex
+	durations := map[string]time.Duration{}
+	cfg := mongo.DefaultConfig()
+	cfg.Timings = func(name string, duration time.Duration, labels map[string]string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if name == mongo.MetricCommandDuration && labels[mongo.LabelOutcome] == mongo.OutcomeSucceeded {
+			durations[labels[mongo.LabelCommand]] += duration
+		}
+	}
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	_, err := store.ClientManager.Get(ctx, uuid.NewString())
+	if err != fosite.ErrNotFound {
+		AssertFatal(t, err, fosite.ErrNotFound, "get should return not found")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := durations["find"]; !ok {
+		AssertError(t, durations, "find", "the duration of the find command should be recorded")
+	}
+}
@@ -0,0 +1,89 @@
+package mongo_test
+
+import (
+	// Standard Library Imports
+	"context"
+	"io"
+	"testing"
+
+	// External Imports
+	"github.com/google/uuid"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// sliceSource provides an in-memory storage.MigrationSource.
+type sliceSource struct {
+	clients []storage.Client
+	users   []storage.User
+}
+
+func (s *sliceSource) NextClient(_ context.Context) (storage.Client, error) {
+	if len(s.clients) == 0 {
+		return storage.Client{}, io.EOF
+	}
+	client := s.clients[0]
+	s.clients = s.clients[1:]
+	return client, nil
+}
+
+func (s *sliceSource) NextUser(_ context.Context) (storage.User, error) {
+	if len(s.users) == 0 {
+		return storage.User{}, io.EOF
+	}
+	user := s.users[0]
+	s.users = s.users[1:]
+	return user, nil
+}
+
+func TestMigrate_ShouldBeIdempotent(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	clientID := uuid.NewString()
+	userID := uuid.NewString()
+	newSource := func() *sliceSource {
+		return &sliceSource{
+			clients: []storage.Client{{ID: clientID, Name: "legacy", Secret: "$md5$cats"}},
+			users:   []storage.User{{ID: userID, Username: "kitteh@example.com", Password: "$md5$dogs"}},
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		migrated := 0
+		err := storage.Migrate(ctx, newSource(), store.ClientManager, store.UserManager, func(storage.MigrationProgress) {
+			migrated++
+		})
+		if err != nil {
+			AssertFatal(t, err, nil, "migrate should return no database errors")
+		}
+		if migrated != 2 {
+			AssertError(t, migrated, 2, "migrate should report progress for each record")
+		}
+	}
+
+	client, err := store.ClientManager.Get(ctx, clientID)
+	if err != nil {
+		AssertFatal(t, err, nil, "migrated client should be found by its original id")
+	}
+	if client.Secret != "$md5$cats" {
+		AssertError(t, client.Secret, "$md5$cats", "migrate should preserve the existing secret hash")
+	}
+
+	user, err := store.UserManager.Get(ctx, userID)
+	if err != nil {
+		AssertFatal(t, err, nil, "migrated user should be found by its original id")
+	}
+	if user.Password != "$md5$dogs" {
+		AssertError(t, user.Password, "$md5$dogs", "migrate should preserve the existing password hash")
+	}
+
+	stats, err := store.Stats(ctx, false)
+	if err != nil {
+		AssertFatal(t, err, nil, "stats should return no database errors")
+	}
+	if stats[storage.EntityClients] != 1 || stats[storage.EntityUsers] != 1 {
+		AssertError(t, stats, "one client and one user", "re-running a migration should not duplicate records")
+	}
+}
@@ -4,13 +4,23 @@ import (
 	// Standard Library Imports
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	// External Imports
+	"github.com/google/uuid"
+	"github.com/kelseyhightower/envconfig"
 	"github.com/ory/fosite"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -21,10 +31,33 @@ import (
 
 func init() {}
 
+var (
+	// ErrInvalidConfig provides an error for when the provided configuration
+	// is unable to be used to connect to mongo.
+	ErrInvalidConfig = errors.New("invalid mongo config")
+
+	// ErrInvalidBackup provides an error for when an import is unable to be
+	// read.
+	ErrInvalidBackup = errors.New("invalid backup")
+
+	// ErrIndexConflict provides an error for when an index required by the
+	// store conflicts with an existing index of a different definition, which
+	// is left in place until the indices are rebuilt, see
+	// Store.RebuildIndexes.
+	ErrIndexConflict = errors.New("index conflicts with an existing index, rebuild the indices via Store.RebuildIndexes")
+
+	// ErrInvalidTenant provides an error for when a tenant ID doesn't name a
+	// valid mongo database, see WithTenant.
+	ErrInvalidTenant = errors.New("invalid tenant")
+)
+
 const (
 	defaultHost         = "localhost"
 	defaultPort         = 27017
 	defaultDatabaseName = "oauth2"
+
+	defaultTimeout                = 10
+	defaultServerSelectionTimeout = 30
 )
 
 // Store provides a MongoDB storage driver compatible with fosite's required
@@ -37,6 +70,22 @@ type Store struct {
 	// in-flight request.
 	timeout time.Duration
 
+	// ownsClient records whether the store created the underlying mongo
+	// client, and is therefore responsible for disconnecting it.
+	ownsClient bool
+
+	// clock provides the current time.
+	clock func() time.Time
+
+	// tokenTTL records the configured session record TTL in seconds, so that
+	// expiry indices can be restored by RebuildIndexes.
+	tokenTTL int
+
+	// reconnect opens a new connection to replace a disconnected client, if
+	// the store has been configured to reconnect, see ConnState.
+	reconnect      func() (*mongo.Database, error)
+	reconnectMutex sync.Mutex
+
 	// Public API
 	Hasher fosite.Hasher
 	storage.Store
@@ -44,7 +93,204 @@ type Store struct {
 
 // DB wraps the mongo database connection and the features that are enabled.
 type DB struct {
-	*mongo.Database
+	// database is replaced when a store reconnects, so is only accessed via
+	// Database, which holds databaseMutex.
+	database *mongo.Database
+
+	// DisableCausalConsistency turns off causal consistency for sessions
+	// started by the store. Causally consistent sessions guarantee that
+	// reads observe the writes previously made within the same session, even
+	// when the read is served by a secondary.
+	DisableCausalConsistency bool
+
+	// TimestampsAsDates stores resource create and update times as BSON dates
+	// instead of unix timestamps. Either representation is read regardless.
+	TimestampsAsDates bool
+
+	// ReadPreferences sets the read preference of the named collections,
+	// overriding the defaults, see defaultReadPreferences. Collections without
+	// a read preference use the client's.
+	ReadPreferences map[string]*readpref.ReadPref
+
+	// TenantDatabaseName names the database holding a tenant's resources,
+	// see WithTenant. Defaults to the database's name suffixed with the
+	// tenant ID, for example "oauth2_acme".
+	TenantDatabaseName TenantNameFunc
+
+	// databaseMutex guards the database, which is replaced when a store
+	// reconnects, see Store.ConnState.
+	databaseMutex sync.RWMutex
+
+	registryOnce sync.Once
+	registry     *bsoncodec.Registry
+
+	tenantsMutex sync.RWMutex
+	tenants      map[string]*DB
+}
+
+// Collection returns a handle for the named collection, which encodes and
+// decodes resource timestamps as configured by TimestampsAsDates.
+func (db *DB) Collection(name string, opts ...*options.CollectionOptions) *mongo.Collection {
+	db.registryOnce.Do(func() {
+		db.registry = newTimestampRegistry(db.TimestampsAsDates)
+	})
+
+	opts = append([]*options.CollectionOptions{options.Collection().SetRegistry(db.registry)}, opts...)
+	return db.Database().Collection(name, opts...)
+}
+
+// Database returns the current mongo database. The database is replaced if
+// the store reconnects, see Store.ConnState, so the returned database
+// shouldn't be held onto.
+func (db *DB) Database() *mongo.Database {
+	db.databaseMutex.RLock()
+	defer db.databaseMutex.RUnlock()
+
+	return db.database
+}
+
+// Client returns the client of the current mongo database.
+func (db *DB) Client() *mongo.Client {
+	return db.Database().Client()
+}
+
+// Name returns the name of the mongo database.
+func (db *DB) Name() string {
+	return db.Database().Name()
+}
+
+// Drop drops the mongo database, deleting every resource stored within it.
+func (db *DB) Drop(ctx context.Context) error {
+	return db.Database().Drop(ctx)
+}
+
+// setDatabase replaces the mongo database, dropping the tenant databases
+// opened via the previous database's client.
+func (db *DB) setDatabase(database *mongo.Database) {
+	db.databaseMutex.Lock()
+	db.database = database
+	db.databaseMutex.Unlock()
+
+	db.tenantsMutex.Lock()
+	db.tenants = nil
+	db.tenantsMutex.Unlock()
+}
+
+// defaultReadPreferences lists the collections which are read from the
+// primary by default. A secondary lagging behind could otherwise accept a JTI
+// or token the instant after it has been denied or revoked, or miss the result
+// of an idempotent request stored the instant before it was retried.
+var defaultReadPreferences = map[string]*readpref.ReadPref{
+	storage.EntityJtiDenylist:     readpref.Primary(),
+	storage.EntityAccessTokens:    readpref.Primary(),
+	storage.EntityRefreshTokens:   readpref.Primary(),
+	storage.EntityIdempotencyKeys: readpref.Primary(),
+}
+
+// Tenant returns the database holding the tenant's resources, for example,
+// to back up, restore or drop a single tenant. Handles are cached, so each
+// tenant's database is opened once. ErrInvalidTenant is returned if the
+// tenant's database name isn't valid, see validateDatabaseName.
+func (db *DB) Tenant(tenantID string) (*DB, error) {
+	db.tenantsMutex.RLock()
+	tenant, ok := db.tenants[tenantID]
+	db.tenantsMutex.RUnlock()
+	if ok {
+		return tenant, nil
+	}
+
+	if tenantID == "" {
+		return nil, fmt.Errorf("%w: tenant ID is empty", ErrInvalidTenant)
+	}
+
+	db.tenantsMutex.Lock()
+	defer db.tenantsMutex.Unlock()
+	if tenant, ok = db.tenants[tenantID]; ok {
+		return tenant, nil
+	}
+
+	database := db.Database()
+	name := database.Name() + "_" + tenantID
+	if db.TenantDatabaseName != nil {
+		name = db.TenantDatabaseName(tenantID)
+	}
+	if err := validateDatabaseName(name); err != nil {
+		return nil, fmt.Errorf("%w: tenant %q: %s", ErrInvalidTenant, tenantID, err)
+	}
+
+	tenant = &DB{
+		database:                 database.Client().Database(name),
+		DisableCausalConsistency: db.DisableCausalConsistency,
+		TimestampsAsDates:        db.TimestampsAsDates,
+		ReadPreferences:          db.ReadPreferences,
+	}
+	if db.tenants == nil {
+		db.tenants = make(map[string]*DB)
+	}
+	db.tenants[tenantID] = tenant
+
+	return tenant, nil
+}
+
+// maxDatabaseNameLength is the longest database name, in bytes, accepted by
+// mongo.
+const maxDatabaseNameLength = 63
+
+// validateDatabaseName returns an error if mongo would reject the database
+// name, so that an invalid tenant fails before any request is issued rather
+// than part way through an operation.
+func validateDatabaseName(name string) error {
+	if name == "" {
+		return errors.New("database name is empty")
+	}
+	if len(name) > maxDatabaseNameLength {
+		return fmt.Errorf("database name %q is longer than %d bytes", name, maxDatabaseNameLength)
+	}
+	if i := strings.IndexAny(name, "/\\. \"$\x00"); i >= 0 {
+		return fmt.Errorf("database name %q contains the invalid character %q", name, name[i])
+	}
+
+	return nil
+}
+
+// collection returns a handle for the named collection, which reads using the
+// read preference contained within the context, if any, see WithReadPreference.
+// Otherwise, the collection's configured read preference is used.
+//
+// The collection is opened in the tenant's database if the context has been
+// routed to a tenant, see WithTenant, returning ErrInvalidTenant if the tenant
+// is invalid.
+func (db *DB) collection(ctx context.Context, name string) (*mongo.Collection, error) {
+	if tenantID, ok := ctx.Value(tenantKey{}).(string); ok {
+		tenant, err := db.Tenant(tenantID)
+		if err != nil {
+			return nil, err
+		}
+
+		return tenant.Collection(name, db.collectionOptions(ctx, name)), nil
+	}
+
+	return db.Collection(name, db.collectionOptions(ctx, name)), nil
+}
+
+// collectionOptions returns the collection options for the named collection,
+// reading with the preference requested by the context, configured in
+// ReadPreferences, or defaulted for the collection, in that order.
+func (db *DB) collectionOptions(ctx context.Context, name string) *options.CollectionOptions {
+	opts := options.Collection()
+
+	rp := readPreferenceFromContext(ctx)
+	if rp == nil {
+		var ok bool
+		if rp, ok = db.ReadPreferences[name]; !ok {
+			rp = defaultReadPreferences[name]
+		}
+	}
+	if rp != nil {
+		opts.SetReadPreference(rp)
+	}
+
+	return opts
 }
 
 // NewSession creates and returns a new mongo session.
@@ -71,7 +317,9 @@ func (s *Store) NewSession(ctx context.Context) (context.Context, func(), error)
 
 // newSession creates a new mongo session.
 func newSession(ctx context.Context, db *DB) (context.Context, func(), error) {
-	session, err := db.Client().StartSession()
+	opts := options.Session().
+		SetCausalConsistency(!db.DisableCausalConsistency)
+	session, err := db.Client().StartSession(opts)
 	if err != nil {
 		return ctx, nil, err
 	}
@@ -91,8 +339,13 @@ func closeSession(ctx context.Context, session mongo.Session) func() {
 	}
 }
 
-// Close terminates the mongo connection.
+// Close terminates the mongo connection. Clients provided via NewWithClient
+// are shared, so are left connected for the caller to disconnect.
 func (s *Store) Close() {
+	if !s.ownsClient {
+		return
+	}
+
 	err := s.DB.Client().Disconnect(context.Background())
 	if err != nil {
 		return
@@ -100,22 +353,190 @@ func (s *Store) Close() {
 }
 
 // Config defines the configuration parameters which are used by GetMongoSession.
+//
+// Timeout, ServerSelectionTimeout, SocketTimeout, MaxConnIdleTime and
+// HeartbeatInterval are specified in seconds. A zero SocketTimeout or
+// MaxConnIdleTime leaves socket operations and idle connections unbounded,
+// while a zero HeartbeatInterval leaves the driver's default of 10 seconds in
+// place.
+//
+// AutoReconnect replaces the store's connection once Store.ConnState finds
+// its client has been disconnected, which only happens once the client's
+// Disconnect has been called. The driver otherwise recovers from failovers,
+// outages and network failures on its own. Stores built via NewWithClient don't own
+// their client, so never reconnect.
+//
+// AppName identifies the connections opened by the store in the server logs
+// and the Atlas UI, which is useful when multiple services share a database.
+// AppName defaults to the DatabaseName.
+//
+// Compressors lists the wire compressors to negotiate with the server, in
+// order of preference, from snappy, zlib and zstd. ZlibCompressionLevel
+// ranges from -1 to 9, where 0 leaves the driver's default level in place.
+//
+// APIVersion pins the MongoDB Stable API version (currently only "1") for
+// clusters that enforce API versioning, such as MongoDB Atlas. When APIStrict
+// is set, the server rejects any command outside the pinned API version.
+//
+// Disabled clients are rejected by GetClient, and therefore by fosite, unless
+// AllowDisabledClients is set. RequirePKCEForPublicClients reports PKCE as
+// enforced for every public client returned by GetClient, see
+// storage.PKCEEnforcer.
+//
+// StrictClientSecrets rejects public clients given a secret, and confidential
+// clients without one, when clients are created or updated, see
+// storage.Client.ValidateSecret.
+//
+// UniquePersonID enforces one user per person ID, see
+// UserManager.GetByPersonID.
+//
+// MaxFailedLogins locks a user out for LockoutDuration, 15 minutes unless
+// set, once that many consecutive attempts to authenticate as the user have
+// failed, see UserManager.AuthenticateByID. Zero disables lockout.
+//
+// TokenTTL expires session records the given number of seconds after they were
+// requested. TokenTTLDuration expresses the same as a duration, for example
+// "90m", and takes precedence over TokenTTL when set. Zero disables mongo's TTL
+// based expiry of session records, see Store.StartReaper for an alternative.
+//
+// Sessions started by the store are causally consistent, so reads observe the
+// writes previously made within the same session. Set DisableCausalConsistency
+// to opt out.
+//
+// Resource create and update times are stored as unix timestamps, unless
+// TimestampsAsDates is set, in which case they are stored as BSON dates to
+// enable date based queries and aggregations. Either representation is read
+// regardless, so existing resources don't need to be migrated.
+//
+// ReadPreferences sets the read preference, by mode name such as "primary" or
+// "secondaryPreferred", of the named collections, for example
+// "oauth2_client:secondaryPreferred". The JTI denylist, access token and
+// refresh token collections are read from the primary unless configured
+// otherwise, while the remaining collections read from secondaries where
+// possible.
+//
+// SignatureIndexes sets how the signatures of the named request collections
+// are indexed, either "unique" or "hashed", for example
+// "oauth2_refresh_token:hashed". Access token signatures are hashed, and all
+// others unique, unless configured otherwise. Changing the index of an
+// existing collection requires its signature index to be rebuilt, see
+// Store.RebuildIndexes.
+//
+// DeleteUsedAuthorizeCodes deletes authorization codes once they've been
+// used, rather than invalidating them, trading the detection of replayed codes
+// for a smaller authorization code collection. Invalidated codes can otherwise
+// be purged in bulk, see RequestManager.PurgeInvalidatedCodes.
+//
+// RefreshTokenGracePeriod keeps used refresh tokens usable for the given
+// duration, rather than deleting them, so that clients retrying a refresh
+// aren't logged out, see RequestManager.GetRefreshTokenSessionEx. Used refresh
+// tokens share the request ID of the token they were rotated into, so the
+// indices of existing stores must be rebuilt before enabling it, see
+// Store.RebuildIndexes.
+//
+// FormKeys, if set, limits the form data stored with each request to the
+// listed keys, while RedactedFormKeys lists the keys removed from the form
+// data before it's stored, for example, "client_secret,code_verifier", so
+// that sensitive parameters aren't persisted. The keys fosite reads back from
+// stored requests, such as "redirect_uri" and "nonce", are always kept.
+//
+// TenantDatabaseName, if set, names the database holding each tenant's
+// resources, rather than suffixing DatabaseName with the tenant ID, see
+// WithTenant.
+//
+// MaxSessionSize caps the size, in bytes, of the marshaled session stored with
+// each request, rejecting larger sessions with storage.ErrSessionTooLarge
+// before they reach mongo. Zero defaults to just under mongo's 16MB document
+// limit.
+//
+// Idempotent results, see IdempotencyManager, are stored as provided until
+// their ttl elapses, so token endpoint responses stored in plaintext expose
+// live tokens to anyone able to read the database. Encrypt such results
+// before storing them.
+//
+// Region, if set, tags the requests created by the store with the region they
+// were issued in, see RequestManager.DeleteByRegion.
+//
+// Metrics, if set, receives counters for the tokens issued and revoked, and the
+// authorization codes invalidated, see MetricsFunc.
+//
+// Timings, if set, receives the duration of each mongo command issued, while
+// TraceCommands annotates the tracing span active when each command is issued
+// with the command's name and duration, see NewCommandMonitor. Commands aren't
+// monitored unless either is set.
+//
+// ClaimsExtractor, if set, extracts custom claims from each session as it's
+// stored, which are indexed so requests can be listed by claim, see
+// RequestManager.ListByClaim.
+//
+// ClientHooks and UserHooks, if set, observe and can veto the clients and
+// users created, updated and deleted, see storage.Hooks.
+//
+// RoleScopes maps each role to the scopes it implies, which are merged with
+// the user's own scopes by UserManager.EffectiveScopes.
+//
+// When SSL is set and TLSConfig has not been provided programmatically, the
+// TLS config is built by ConnectionInfo from TLSCAFile, a PEM encoded CA
+// bundle used to verify the server, and TLSCertificateKeyFile, a PEM file
+// containing the client certificate and private key used for mutual TLS.
+// TLSInsecure disables server certificate verification and should only be
+// used for testing.
 type Config struct {
-	Hostnames        []string    `default:"localhost" envconfig:"CONNECTIONS_MONGO_HOSTNAMES"`
-	Port             uint16      `default:"27017"     envconfig:"CONNECTIONS_MONGO_PORT"`
-	SSL              bool        `default:"false"     envconfig:"CONNECTIONS_MONGO_SSL"`
-	AuthDB           string      `default:"admin"     envconfig:"CONNECTIONS_MONGO_AUTHDB"`
-	Username         string      `default:""          envconfig:"CONNECTIONS_MONGO_USERNAME"`
-	Password         string      `default:""          envconfig:"CONNECTIONS_MONGO_PASSWORD"`
-	DatabaseName     string      `default:""          envconfig:"CONNECTIONS_MONGO_NAME"`
-	Replset          string      `default:""          envconfig:"CONNECTIONS_MONGO_REPLSET"`
-	Timeout          uint        `default:"10"        envconfig:"CONNECTIONS_MONGO_TIMEOUT"`
-	PoolMinSize      uint64      `default:"0"         envconfig:"CONNECTIONS_MONGO_POOL_MIN_SIZE"`
-	PoolMaxSize      uint64      `default:"100"       envconfig:"CONNECTIONS_MONGO_POOL_MAX_SIZE"`
-	Compressors      []string    `default:""          envconfig:"CONNECTIONS_MONGO_COMPRESSORS"`
-	TokenTTL         uint32      `default:"0"         envconfig:"CONNECTIONS_MONGO_TOKEN_TTL"`
-	CollectionPrefix string      `default:""          envconfig:"CONNECTIONS_MONGO_COLLECTION_PREFIX"`
-	TLSConfig        *tls.Config `ignored:"true"`
+	Hostnames                   []string                      `default:"localhost" envconfig:"CONNECTIONS_MONGO_HOSTNAMES"`
+	Port                        uint16                        `default:"27017"     envconfig:"CONNECTIONS_MONGO_PORT"`
+	SSL                         bool                          `default:"false"     envconfig:"CONNECTIONS_MONGO_SSL"`
+	AuthDB                      string                        `default:"admin"     envconfig:"CONNECTIONS_MONGO_AUTHDB"`
+	Username                    string                        `default:""          envconfig:"CONNECTIONS_MONGO_USERNAME"`
+	Password                    string                        `default:""          envconfig:"CONNECTIONS_MONGO_PASSWORD"`
+	DatabaseName                string                        `default:""          envconfig:"CONNECTIONS_MONGO_NAME"`
+	Replset                     string                        `default:""          envconfig:"CONNECTIONS_MONGO_REPLSET"`
+	Timeout                     uint                          `default:"10"        envconfig:"CONNECTIONS_MONGO_TIMEOUT"`
+	ServerSelectionTimeout      uint                          `default:"30"        envconfig:"CONNECTIONS_MONGO_SERVER_SELECTION_TIMEOUT"`
+	SocketTimeout               uint                          `default:"0"         envconfig:"CONNECTIONS_MONGO_SOCKET_TIMEOUT"`
+	MaxConnIdleTime             uint                          `default:"0"         envconfig:"CONNECTIONS_MONGO_MAX_CONN_IDLE_TIME"`
+	HeartbeatInterval           uint                          `default:"0"         envconfig:"CONNECTIONS_MONGO_HEARTBEAT_INTERVAL"`
+	AutoReconnect               bool                          `default:"false"     envconfig:"CONNECTIONS_MONGO_AUTO_RECONNECT"`
+	AppName                     string                        `default:""          envconfig:"CONNECTIONS_MONGO_APP_NAME"`
+	PoolMinSize                 uint64                        `default:"0"         envconfig:"CONNECTIONS_MONGO_POOL_MIN_SIZE"`
+	PoolMaxSize                 uint64                        `default:"100"       envconfig:"CONNECTIONS_MONGO_POOL_MAX_SIZE"`
+	Compressors                 []string                      `default:""          envconfig:"CONNECTIONS_MONGO_COMPRESSORS"`
+	ZlibCompressionLevel        int                           `default:"0"         envconfig:"CONNECTIONS_MONGO_ZLIB_COMPRESSION_LEVEL"`
+	TokenTTL                    uint32                        `default:"0"         envconfig:"CONNECTIONS_MONGO_TOKEN_TTL"`
+	TokenTTLDuration            time.Duration                 `default:"0s"        envconfig:"CONNECTIONS_MONGO_TOKEN_TTL_DURATION"`
+	MaxUserSessions             uint32                        `default:"0"         envconfig:"CONNECTIONS_MONGO_MAX_USER_SESSIONS"`
+	MaxSessionSize              uint32                        `default:"0"         envconfig:"CONNECTIONS_MONGO_MAX_SESSION_SIZE"`
+	AllowDisabledClients        bool                          `default:"false"     envconfig:"CONNECTIONS_MONGO_ALLOW_DISABLED_CLIENTS"`
+	RequirePKCEForPublicClients bool                          `default:"false"     envconfig:"CONNECTIONS_MONGO_REQUIRE_PKCE_FOR_PUBLIC_CLIENTS"`
+	StrictClientSecrets         bool                          `default:"false"     envconfig:"CONNECTIONS_MONGO_STRICT_CLIENT_SECRETS"`
+	UniquePersonID              bool                          `default:"false"     envconfig:"CONNECTIONS_MONGO_UNIQUE_PERSON_ID"`
+	MaxFailedLogins             uint32                        `default:"0"         envconfig:"CONNECTIONS_MONGO_MAX_FAILED_LOGINS"`
+	LockoutDuration             time.Duration                 `default:"0s"        envconfig:"CONNECTIONS_MONGO_LOCKOUT_DURATION"`
+	CollectionPrefix            string                        `default:""          envconfig:"CONNECTIONS_MONGO_COLLECTION_PREFIX"`
+	APIVersion                  string                        `default:""          envconfig:"CONNECTIONS_MONGO_API_VERSION"`
+	APIStrict                   bool                          `default:"false"     envconfig:"CONNECTIONS_MONGO_API_STRICT"`
+	TraceCommands               bool                          `default:"false"     envconfig:"CONNECTIONS_MONGO_TRACE_COMMANDS"`
+	DisableCausalConsistency    bool                          `default:"false"     envconfig:"CONNECTIONS_MONGO_DISABLE_CAUSAL_CONSISTENCY"`
+	TimestampsAsDates           bool                          `default:"false"     envconfig:"CONNECTIONS_MONGO_TIMESTAMPS_AS_DATES"`
+	DeleteUsedAuthorizeCodes    bool                          `default:"false"     envconfig:"CONNECTIONS_MONGO_DELETE_USED_AUTHORIZE_CODES"`
+	RefreshTokenGracePeriod     time.Duration                 `default:"0s"        envconfig:"CONNECTIONS_MONGO_REFRESH_TOKEN_GRACE_PERIOD"`
+	FormKeys                    []string                      `default:""          envconfig:"CONNECTIONS_MONGO_FORM_KEYS"`
+	RedactedFormKeys            []string                      `default:""          envconfig:"CONNECTIONS_MONGO_REDACTED_FORM_KEYS"`
+	ReadPreferences             map[string]string             `default:""          envconfig:"CONNECTIONS_MONGO_READ_PREFERENCES"`
+	SignatureIndexes            map[string]string             `default:""          envconfig:"CONNECTIONS_MONGO_SIGNATURE_INDEXES"`
+	Region                      string                        `default:""          envconfig:"CONNECTIONS_MONGO_REGION"`
+	TLSCAFile                   string                        `default:""          envconfig:"CONNECTIONS_MONGO_TLS_CA_FILE"`
+	TLSCertificateKeyFile       string                        `default:""          envconfig:"CONNECTIONS_MONGO_TLS_CERTIFICATE_KEY_FILE"`
+	TLSInsecure                 bool                          `default:"false"     envconfig:"CONNECTIONS_MONGO_TLS_INSECURE"`
+	TLSConfig                   *tls.Config                   `ignored:"true"`
+	IDGenerator                 func() string                 `ignored:"true"`
+	TenantDatabaseName          TenantNameFunc                `ignored:"true"`
+	Clock                       func() time.Time              `ignored:"true"`
+	Metrics                     MetricsFunc                   `ignored:"true"`
+	Timings                     TimingsFunc                   `ignored:"true"`
+	ClaimsExtractor             ClaimsFunc                    `ignored:"true"`
+	ClientHooks                 storage.Hooks[storage.Client] `ignored:"true"`
+	UserHooks                   storage.Hooks[storage.User]   `ignored:"true"`
+	RoleScopes                  map[string][]string           `ignored:"true"`
 }
 
 // DefaultConfig returns a configuration for a locally hosted, unauthenticated mongo
@@ -127,8 +548,148 @@ func DefaultConfig() *Config {
 	}
 }
 
+// ConfigFromEnv returns a configuration populated from CONNECTIONS_MONGO_*
+// environment variables, falling back to the field defaults for any variables
+// that have not been set.
+func ConfigFromEnv() (*Config, error) {
+	cfg := &Config{}
+	if err := envconfig.Process("", cfg); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	return cfg, nil
+}
+
+// Validate ensures the configuration contains the fields required to
+// establish a working connection, returning an ErrInvalidConfig wrapped error
+// describing the first problem found.
+func (cfg *Config) Validate() error {
+	if cfg == nil {
+		return fmt.Errorf("%w: config is required", ErrInvalidConfig)
+	}
+
+	if cfg.DatabaseName == "" {
+		return fmt.Errorf("%w: a database name is required, set DatabaseName (CONNECTIONS_MONGO_NAME)", ErrInvalidConfig)
+	}
+
+	if len(cfg.Hostnames) == 0 {
+		return fmt.Errorf("%w: at least one hostname or a mongodb+srv:// URI is required, set Hostnames (CONNECTIONS_MONGO_HOSTNAMES)", ErrInvalidConfig)
+	}
+	for i, hostname := range cfg.Hostnames {
+		if strings.TrimSpace(hostname) == "" {
+			return fmt.Errorf("%w: hostname at index %d is empty", ErrInvalidConfig, i)
+		}
+	}
+
+	isSRV := len(cfg.Hostnames) == 1 && strings.HasPrefix(cfg.Hostnames[0], "mongodb+srv://")
+	if !isSRV && cfg.Port == 0 {
+		return fmt.Errorf("%w: a port is required when not connecting via a mongodb+srv:// URI, set Port (CONNECTIONS_MONGO_PORT)", ErrInvalidConfig)
+	}
+
+	if cfg.Username == "" && cfg.Password != "" {
+		return fmt.Errorf("%w: a password has been provided without a username, set Username (CONNECTIONS_MONGO_USERNAME)", ErrInvalidConfig)
+	}
+	if cfg.Username != "" && cfg.Password == "" {
+		return fmt.Errorf("%w: a username has been provided without a password, set Password (CONNECTIONS_MONGO_PASSWORD)", ErrInvalidConfig)
+	}
+
+	if cfg.PoolMaxSize > 0 && cfg.PoolMinSize > cfg.PoolMaxSize {
+		return fmt.Errorf("%w: the minimum pool size (%d) exceeds the maximum pool size (%d)", ErrInvalidConfig, cfg.PoolMinSize, cfg.PoolMaxSize)
+	}
+
+	for _, compressor := range cfg.Compressors {
+		switch compressor {
+		case "snappy", "zlib", "zstd":
+		default:
+			return fmt.Errorf("%w: unsupported compressor %q, expected one of snappy, zlib or zstd, set Compressors (CONNECTIONS_MONGO_COMPRESSORS)", ErrInvalidConfig, compressor)
+		}
+	}
+	if cfg.ZlibCompressionLevel < -1 || cfg.ZlibCompressionLevel > 9 {
+		return fmt.Errorf("%w: the zlib compression level (%d) must be between -1 and 9", ErrInvalidConfig, cfg.ZlibCompressionLevel)
+	}
+
+	if cfg.APIVersion != "" {
+		if err := options.ServerAPIVersion(cfg.APIVersion).Validate(); err != nil {
+			return fmt.Errorf("%w: invalid stable api version: %s", ErrInvalidConfig, err)
+		}
+	}
+
+	// Mongo's TTL indices are specified in whole seconds, where zero expires
+	// records immediately.
+	if cfg.TokenTTLDuration != 0 && cfg.TokenTTLDuration < time.Second {
+		return fmt.Errorf("%w: the token ttl duration (%s) must be at least one second, set TokenTTLDuration (CONNECTIONS_MONGO_TOKEN_TTL_DURATION)", ErrInvalidConfig, cfg.TokenTTLDuration)
+	}
+
+	if _, err := cfg.readPreferences(); err != nil {
+		return err
+	}
+
+	if _, err := cfg.signatureIndexes(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// tokenTTL returns the number of seconds after which session records expire,
+// preferring TokenTTLDuration over the legacy TokenTTL. Zero disables expiry.
+func (cfg *Config) tokenTTL() int {
+	if cfg.TokenTTLDuration > 0 {
+		return int(cfg.TokenTTLDuration / time.Second)
+	}
+
+	return int(cfg.TokenTTL)
+}
+
+// readPreferences parses the configured collection read preferences.
+func (cfg *Config) readPreferences() (map[string]*readpref.ReadPref, error) {
+	if len(cfg.ReadPreferences) == 0 {
+		return nil, nil
+	}
+
+	readPreferences := make(map[string]*readpref.ReadPref, len(cfg.ReadPreferences))
+	for collection, mode := range cfg.ReadPreferences {
+		readMode, err := readpref.ModeFromString(mode)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid read preference for %s: %s, set ReadPreferences (CONNECTIONS_MONGO_READ_PREFERENCES)", ErrInvalidConfig, collection, err)
+		}
+
+		rp, err := readpref.New(readMode)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid read preference for %s: %s", ErrInvalidConfig, collection, err)
+		}
+		readPreferences[collection] = rp
+	}
+
+	return readPreferences, nil
+}
+
+// signatureIndexes parses the configured request entity signature indexes.
+func (cfg *Config) signatureIndexes() (map[string]SignatureIndex, error) {
+	if len(cfg.SignatureIndexes) == 0 {
+		return nil, nil
+	}
+
+	signatureIndexes := make(map[string]SignatureIndex, len(cfg.SignatureIndexes))
+	for entityName, index := range cfg.SignatureIndexes {
+		if !slices.Contains(sessionEntities, entityName) {
+			return nil, fmt.Errorf("%w: signature indexes can only be set for request entities, got %s, set SignatureIndexes (CONNECTIONS_MONGO_SIGNATURE_INDEXES)", ErrInvalidConfig, entityName)
+		}
+
+		switch SignatureIndex(index) {
+		case SignatureIndexUnique, SignatureIndexHashed:
+		default:
+			return nil, fmt.Errorf("%w: unsupported signature index %q for %s, expected one of unique or hashed, set SignatureIndexes (CONNECTIONS_MONGO_SIGNATURE_INDEXES)", ErrInvalidConfig, index, entityName)
+		}
+		signatureIndexes[entityName] = SignatureIndex(index)
+	}
+
+	return signatureIndexes, nil
+}
+
 // ConnectionInfo configures options for establishing a session with a MongoDB cluster.
-func ConnectionInfo(cfg *Config) *options.ClientOptions {
+// ErrInvalidConfig is returned if the configured TLS files can't be loaded.
+func ConnectionInfo(cfg *Config) (*options.ClientOptions, error) {
 	if len(cfg.Hostnames) == 0 {
 		cfg.Hostnames = []string{defaultHost}
 	}
@@ -143,24 +704,63 @@ func ConnectionInfo(cfg *Config) *options.ClientOptions {
 		// but we can continue to mung with client options after it's set.
 		clientOpts.ApplyURI(cfg.Hostnames[0])
 	} else {
-		for i := range cfg.Hostnames {
-			cfg.Hostnames[i] = fmt.Sprintf("%s:%d", cfg.Hostnames[i], cfg.Port)
+		// Hosts are built separately, as cfg may be reused to reconnect.
+		hosts := make([]string, len(cfg.Hostnames))
+		for i, hostname := range cfg.Hostnames {
+			hosts[i] = fmt.Sprintf("%s:%d", hostname, cfg.Port)
 		}
-		clientOpts.SetHosts(cfg.Hostnames)
+		clientOpts.SetHosts(hosts)
 	}
 
 	if cfg.Timeout == 0 {
-		cfg.Timeout = 10
+		cfg.Timeout = defaultTimeout
+	}
+
+	if cfg.ServerSelectionTimeout == 0 {
+		cfg.ServerSelectionTimeout = defaultServerSelectionTimeout
 	}
 
 	clientOpts.SetReplicaSet(cfg.Replset).
 		SetConnectTimeout(time.Second * time.Duration(cfg.Timeout)).
+		SetServerSelectionTimeout(time.Second * time.Duration(cfg.ServerSelectionTimeout)).
 		SetReadPreference(readpref.SecondaryPreferred()).
 		SetMinPoolSize(cfg.PoolMinSize).
 		SetMaxPoolSize(cfg.PoolMaxSize).
 		SetCompressors(cfg.Compressors).
 		SetAppName(cfg.DatabaseName)
 
+	if cfg.AppName != "" {
+		clientOpts.SetAppName(cfg.AppName)
+	}
+
+	if cfg.ZlibCompressionLevel != 0 {
+		clientOpts.SetZlibLevel(cfg.ZlibCompressionLevel)
+	}
+
+	if cfg.SocketTimeout > 0 {
+		clientOpts.SetSocketTimeout(time.Second * time.Duration(cfg.SocketTimeout))
+	}
+
+	if cfg.MaxConnIdleTime > 0 {
+		clientOpts.SetMaxConnIdleTime(time.Second * time.Duration(cfg.MaxConnIdleTime))
+	}
+
+	if cfg.HeartbeatInterval > 0 {
+		clientOpts.SetHeartbeatInterval(time.Second * time.Duration(cfg.HeartbeatInterval))
+	}
+
+	if cfg.Timings != nil || cfg.TraceCommands {
+		clientOpts.SetMonitor(NewCommandMonitor(cfg.Timings, cfg.TraceCommands))
+	}
+
+	if cfg.APIVersion != "" {
+		// Pin the Stable API version so clusters enforcing API versioning,
+		// such as MongoDB Atlas, accept the commands the driver issues.
+		serverAPI := options.ServerAPI(options.ServerAPIVersion(cfg.APIVersion)).
+			SetStrict(cfg.APIStrict)
+		clientOpts.SetServerAPIOptions(serverAPI)
+	}
+
 	if cfg.Username != "" || cfg.Password != "" {
 		auth := options.Credential{
 			AuthMechanism: "SCRAM-SHA-1",
@@ -172,50 +772,148 @@ func ConnectionInfo(cfg *Config) *options.ClientOptions {
 	}
 
 	if cfg.SSL {
-		tlsConfig := cfg.TLSConfig
+		// Clone the TLS config, so a config shared with other clients isn't
+		// modified by the driver.
+		tlsConfig := cfg.TLSConfig.Clone()
 		if tlsConfig == nil {
-			// Inject a default TLS config if the SSL switch is toggled, but a
-			// TLS config has not been provided programmatically.
-			tlsConfig = &tls.Config{
-				InsecureSkipVerify: false,
-				MinVersion:         tls.VersionTLS12,
+			// Build the TLS config from the configured files if the SSL
+			// switch is toggled, but a TLS config has not been provided
+			// programmatically.
+			var err error
+			tlsConfig, err = NewTLSConfig(cfg)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
 			}
 		}
 
 		clientOpts.SetTLSConfig(tlsConfig)
 	}
 
-	return clientOpts
+	return clientOpts, nil
+}
+
+// NewTLSConfig builds a TLS config from the configured CA bundle and client
+// certificate files.
+func NewTLSConfig(cfg *Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.TLSInsecure,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if cfg.TLSCAFile != "" {
+		caCerts, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read tls ca file: %w", err)
+		}
+
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(caCerts) {
+			return nil, fmt.Errorf("no pem encoded certificates found in tls ca file: %s", cfg.TLSCAFile)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	if cfg.TLSCertificateKeyFile != "" {
+		// The certificate and private key are expected to be bundled in the
+		// same file, as per mongo's tlsCertificateKeyFile option.
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertificateKeyFile, cfg.TLSCertificateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load tls certificate key file: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
 }
 
 // Connect returns a connection to a mongo database.
 func Connect(cfg *Config) (*mongo.Database, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	dialInfo, err := ConnectionInfo(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	ctx := context.Background()
-	dialInfo := ConnectionInfo(cfg)
 	client, err := mongo.Connect(ctx, dialInfo)
 	if err != nil {
-		return nil, err
+		// Driver errors can echo the connection string, credentials included.
+		return nil, redactError(cfg, err)
 	}
 
 	// check connection works as mongo-go lazily connects.
 	err = client.Ping(ctx, nil)
 	if err != nil {
-		return nil, err
+		return nil, redactError(cfg, err)
 	}
 
 	return client.Database(cfg.DatabaseName), nil
 }
 
 // New allows for custom mongo configuration and custom hashers.
+// The configuration is validated before connecting, see Config.Validate.
 func New(cfg *Config, hashee fosite.Hasher) (*Store, error) {
 	database, err := Connect(cfg)
 	if err != nil {
 		return nil, err
 	}
 
+	store, err := newStore(database, cfg, hashee, true)
+	if err != nil {
+		_ = database.Client().Disconnect(context.Background())
+		return nil, err
+	}
+	if cfg.AutoReconnect {
+		store.reconnect = func() (*mongo.Database, error) {
+			return Connect(cfg)
+		}
+	}
+
+	return store, nil
+}
+
+// NewWithClient builds a store on top of an existing, connected mongo client,
+// enabling a connection pool to be shared with other consumers. The store
+// does not own the client, so Close will not disconnect it.
+//
+// Only the non-connection fields of the configuration are used, such as
+// DatabaseName, TokenTTL and MaxUserSessions.
+func NewWithClient(client *mongo.Client, cfg *Config, hashee fosite.Hasher) (*Store, error) {
+	if client == nil {
+		return nil, fmt.Errorf("%w: a mongo client is required", ErrInvalidConfig)
+	}
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	if cfg.DatabaseName == "" {
+		cfg.DatabaseName = defaultDatabaseName
+	}
+
+	return newStore(client.Database(cfg.DatabaseName), cfg, hashee, false)
+}
+
+// newStore wires up the mongo managers against the provided database and
+// configures the required collections and indices.
+func newStore(database *mongo.Database, cfg *Config, hashee fosite.Hasher, ownsClient bool) (*Store, error) {
+	readPreferences, err := cfg.readPreferences()
+	if err != nil {
+		return nil, err
+	}
+	signatureIndexes, err := cfg.signatureIndexes()
+	if err != nil {
+		return nil, err
+	}
+
 	// Wrap database with mongo feature detection.
 	mongoDB := &DB{
-		Database: database,
+		database:                 database,
+		DisableCausalConsistency: cfg.DisableCausalConsistency,
+		TimestampsAsDates:        cfg.TimestampsAsDates,
+		ReadPreferences:          readPreferences,
+		TenantDatabaseName:       cfg.TenantDatabaseName,
 	}
 
 	if hashee == nil {
@@ -223,25 +921,77 @@ func New(cfg *Config, hashee fosite.Hasher) (*Store, error) {
 		hashee = &fosite.BCrypt{Config: &fosite.Config{HashCost: 24}}
 	}
 
+	idGenerator := cfg.IDGenerator
+	if idGenerator == nil {
+		idGenerator = uuid.NewString
+	}
+
+	clock := cfg.Clock
+	if clock == nil {
+		clock = time.Now
+	}
+
 	// Build up the mongo endpoints
 	mongoDeniedJTIs := &DeniedJtiManager{
-		DB: mongoDB,
+		DB:    mongoDB,
+		Clock: clock,
 	}
 	mongoClients := &ClientManager{
-		DB:     mongoDB,
-		Hasher: hashee,
+		DB:          mongoDB,
+		Hasher:      hashee,
+		IDGenerator: idGenerator,
+		Clock:       clock,
+
+		AllowDisabledClients:        cfg.AllowDisabledClients,
+		RequirePKCEForPublicClients: cfg.RequirePKCEForPublicClients,
+		StrictClientSecrets:         cfg.StrictClientSecrets,
+		Hooks:                       cfg.ClientHooks,
 
 		DeniedJTIs: mongoDeniedJTIs,
 	}
 	mongoUsers := &UserManager{
-		DB:     mongoDB,
-		Hasher: hashee,
+		DB:          mongoDB,
+		Hasher:      hashee,
+		IDGenerator: idGenerator,
+		Clock:       clock,
+
+		UniquePersonID:  cfg.UniquePersonID,
+		Hooks:           cfg.UserHooks,
+		RoleScopes:      cfg.RoleScopes,
+		MaxFailedLogins: cfg.MaxFailedLogins,
+		LockoutDuration: cfg.LockoutDuration,
+	}
+	mongoConsents := &ConsentManager{
+		DB:    mongoDB,
+		Clock: clock,
+	}
+	mongoNonces := &NonceManager{
+		DB:    mongoDB,
+		Clock: clock,
+	}
+	mongoIdempotency := &IdempotencyManager{
+		DB:    mongoDB,
+		Clock: clock,
 	}
 	mongoRequests := &RequestManager{
 		DB: mongoDB,
 
 		Clients: mongoClients,
 		Users:   mongoUsers,
+
+		IDGenerator:      idGenerator,
+		Clock:            clock,
+		MaxUserSessions:  int64(cfg.MaxUserSessions),
+		MaxSessionSize:   int(cfg.MaxSessionSize),
+		Region:           cfg.Region,
+		Metrics:          cfg.Metrics,
+		SignatureIndexes: signatureIndexes,
+		ClaimsExtractor:  cfg.ClaimsExtractor,
+
+		DeleteUsedAuthorizeCodes: cfg.DeleteUsedAuthorizeCodes,
+		RefreshTokenGracePeriod:  cfg.RefreshTokenGracePeriod,
+		FormKeys:                 cfg.FormKeys,
+		RedactedFormKeys:         cfg.RedactedFormKeys,
 	}
 
 	// attempt to perform index updates in a session.
@@ -253,39 +1003,143 @@ func New(cfg *Config, hashee fosite.Hasher) (*Store, error) {
 	defer closeSession()
 
 	// Configure DB collections, indices, TTLs e.t.c.
-	if err = configureDatabases(ctx, mongoClients, mongoDeniedJTIs, mongoUsers, mongoRequests); err != nil {
-		return nil, err
-	}
-	if cfg.TokenTTL > 0 {
-		if err = configureExpiry(ctx, int(cfg.TokenTTL), mongoRequests); err != nil {
+	// Outdated indices don't stop the store from working, so are reported
+	// rather than failing, leaving the caller able to rebuild them.
+	err = configureDatabases(ctx, mongoClients, mongoConsents, mongoDeniedJTIs, mongoIdempotency, mongoNonces, mongoUsers, mongoRequests)
+	if err != nil {
+		if !errors.Is(err, ErrIndexConflict) {
 			return nil, err
 		}
+		log.Printf("mongo: %s", err)
+	}
+	tokenTTL := cfg.tokenTTL()
+	if tokenTTL > 0 {
+		err = configureExpiry(ctx, tokenTTL, mongoRequests)
+		if err != nil {
+			if !errors.Is(err, ErrIndexConflict) {
+				return nil, err
+			}
+			log.Printf("mongo: %s", err)
+		}
 	}
 
 	store := &Store{
-		DB:      mongoDB,
-		timeout: time.Second * time.Duration(cfg.Timeout),
-		Hasher:  hashee,
+		DB:         mongoDB,
+		timeout:    time.Second * time.Duration(cfg.Timeout),
+		ownsClient: ownsClient,
+		clock:      clock,
+		tokenTTL:   tokenTTL,
+		Hasher:     hashee,
 		Store: storage.Store{
-			ClientManager:    mongoClients,
-			DeniedJTIManager: mongoDeniedJTIs,
-			RequestManager:   mongoRequests,
-			UserManager:      mongoUsers,
+			ClientManager:      mongoClients,
+			ConsentManager:     mongoConsents,
+			DeniedJTIManager:   mongoDeniedJTIs,
+			IdempotencyManager: mongoIdempotency,
+			NonceManager:       mongoNonces,
+			RequestManager:     mongoRequests,
+			UserManager:        mongoUsers,
 		},
 	}
 	return store, nil
 }
 
+// EnsureIndexes creates the collections and indices required by each of the
+// store's managers. It is safe to call repeatedly, for example, after
+// connecting via NewWithClient or after upgrading to a release that ships
+// new indices. Indices whose definitions have changed since they were
+// created are reported with ErrIndexConflict, and must be rebuilt via
+// RebuildIndexes.
+func (s *Store) EnsureIndexes(ctx context.Context) error {
+	return configureDatabases(
+		ctx,
+		s.ClientManager,
+		s.ConsentManager,
+		s.DeniedJTIManager,
+		s.IdempotencyManager,
+		s.NonceManager,
+		s.UserManager,
+		s.RequestManager,
+	)
+}
+
+// DropIndexes drops every index, other than the default _id index, from each
+// of the collections managed by the store. Indices are never dropped
+// automatically, so this must be called explicitly, for example, when index
+// definitions have changed. Each collection is processed regardless of
+// failures, with the errors returned joined together.
+func (s *Store) DropIndexes(ctx context.Context) error {
+	var errs []error
+	for _, entity := range entities {
+		collection, err := s.DB.collection(ctx, entity)
+		if err != nil {
+			return err
+		}
+		_, err = collection.Indexes().DropAll(ctx)
+		if err != nil && !isNamespaceNotFound(err) {
+			errs = append(errs, fmt.Errorf("dropping %s indices: %w", entity, classify(err)))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// RebuildIndexes drops and then recreates the indices required by each of the
+// store's managers, including the expiry indices for the configured token TTL.
+// Expiry indices created via EnsureTTLIndexes with a different ttl must be
+// recreated by calling EnsureTTLIndexes again.
+//
+// Queries may be slow, and unique constraints unenforced, while the indices
+// are rebuilt.
+func (s *Store) RebuildIndexes(ctx context.Context) error {
+	if err := s.DropIndexes(ctx); err != nil {
+		return err
+	}
+
+	if err := s.EnsureIndexes(ctx); err != nil {
+		return err
+	}
+
+	if s.tokenTTL > 0 {
+		return s.EnsureTTLIndexes(ctx, s.tokenTTL)
+	}
+
+	return nil
+}
+
+// EnsureTTLIndexes creates the indices required to expire session records
+// after ttl seconds. It is safe to call repeatedly.
+//
+// A changed ttl is applied to the existing expiry indices in place.
+func (s *Store) EnsureTTLIndexes(ctx context.Context, ttl int) error {
+	if ttl <= 0 {
+		return fmt.Errorf("%w: ttl must be a positive number of seconds", ErrInvalidConfig)
+	}
+
+	expire, ok := s.RequestManager.(storage.Expire)
+	if !ok {
+		return nil
+	}
+
+	return configureExpiry(ctx, ttl, expire)
+}
+
 // configureDatabases calls the configuration handler for the provided
-// configures.
+// configures. Index conflicts don't stop the remaining configures being
+// called, and are returned joined together.
 func configureDatabases(ctx context.Context, configurers ...storage.Configure) error {
+	var conflicts []error
 	for _, configurer := range configurers {
-		if err := configurer.Configure(ctx); err != nil {
+		err := configurer.Configure(ctx)
+		if errors.Is(err, ErrIndexConflict) {
+			conflicts = append(conflicts, err)
+			continue
+		}
+		if err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return errors.Join(conflicts...)
 }
 
 // configureExpiry calls the configuration handler for the provided expires.
@@ -300,6 +1154,250 @@ func configureExpiry(ctx context.Context, ttl int, expires ...storage.Expire) er
 	return nil
 }
 
+// isNamespaceNotFound returns true if the error was caused by operating on a
+// collection that doesn't exist.
+func isNamespaceNotFound(err error) bool {
+	var cmdErr mongo.CommandError
+	if !errors.As(err, &cmdErr) {
+		return false
+	}
+
+	return cmdErr.Code == 26 // NamespaceNotFound
+}
+
+// isIndexExists returns true if the error was caused by an index already
+// existing, or by the collection being created concurrently while building an
+// index.
+func isIndexExists(err error) bool {
+	var cmdErr mongo.CommandError
+	if !errors.As(err, &cmdErr) {
+		return false
+	}
+
+	switch cmdErr.Code {
+	case 48, // NamespaceExists
+		68: // IndexAlreadyExists
+		return true
+	default:
+		return false
+	}
+}
+
+// isIndexConflict returns true if the error was caused by an index already
+// existing under the same name, or on the same keys, with different options.
+func isIndexConflict(err error) bool {
+	var cmdErr mongo.CommandError
+	if !errors.As(err, &cmdErr) {
+		return false
+	}
+
+	switch cmdErr.Code {
+	case 85, // IndexOptionsConflict
+		86: // IndexKeySpecsConflict
+		return true
+	default:
+		return false
+	}
+}
+
+// createIndexes creates the indices on the collection, tolerating indices
+// which already exist, so that stores starting concurrently on multiple nodes
+// can each configure the database.
+//
+// Indices are created in bulk, falling back to creating each index in turn on
+// a conflict, so that one conflicting index doesn't stop the remaining indices
+// being created. An index conflicting with an existing index of the same name
+// or keys is tolerated if the existing index matches its definition, while a
+// changed expiry is applied in place, see reconcileIndex. Any other conflict
+// is returned as ErrIndexConflict once the remaining indices have been
+// created.
+func createIndexes(ctx context.Context, collection *mongo.Collection, indices ...mongo.IndexModel) error {
+	_, err := collection.Indexes().CreateMany(ctx, indices)
+	if err == nil || !(isIndexExists(err) || isIndexConflict(err)) {
+		return err
+	}
+
+	var conflicts []error
+	for _, index := range indices {
+		_, err = collection.Indexes().CreateOne(ctx, index)
+		if isIndexConflict(err) {
+			err = reconcileIndex(ctx, collection, index)
+		}
+
+		switch {
+		case err == nil, isIndexExists(err):
+		case errors.Is(err, ErrIndexConflict):
+			conflicts = append(conflicts, err)
+		default:
+			return err
+		}
+	}
+
+	return errors.Join(conflicts...)
+}
+
+// reconcileIndex resolves a conflict between the index and the existing index
+// sharing its name or keys. The conflict is resolved if the existing index
+// matches the index's definition, as happens when stores configure the
+// database concurrently, or only differs by expiry, which is updated in place.
+// Otherwise, ErrIndexConflict is returned, as the existing index must be
+// rebuilt for the index's definition to take effect.
+func reconcileIndex(ctx context.Context, collection *mongo.Collection, index mongo.IndexModel) error {
+	want, err := newIndexSpec(index)
+	if err != nil {
+		return err
+	}
+
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return err
+	}
+
+	var existing []indexSpec
+	err = cursor.All(ctx, &existing)
+	if err != nil {
+		return err
+	}
+
+	for _, got := range existing {
+		if got.Name != want.Name && !got.sameKeys(want) {
+			continue
+		}
+
+		if got.matches(want) {
+			return nil
+		}
+
+		if got.Name == want.Name && got.ExpireAfterSeconds != nil && want.ExpireAfterSeconds != nil {
+			expiring := got
+			expiring.ExpireAfterSeconds = want.ExpireAfterSeconds
+			if expiring.matches(want) {
+				return collection.Database().RunCommand(ctx, bson.D{
+					{Key: "collMod", Value: collection.Name()},
+					{Key: "index", Value: bson.D{
+						{Key: "name", Value: got.Name},
+						{Key: "expireAfterSeconds", Value: *want.ExpireAfterSeconds},
+					}},
+				}).Err()
+			}
+		}
+
+		return fmt.Errorf("%w: %s index %q differs from the required definition of index %q", ErrIndexConflict, collection.Name(), got.Name, want.Name)
+	}
+
+	// The conflicting index has since been dropped.
+	_, err = collection.Indexes().CreateOne(ctx, index)
+	if isIndexConflict(err) {
+		return fmt.Errorf("%w: %s index %q: %w", ErrIndexConflict, collection.Name(), want.Name, err)
+	}
+
+	return err
+}
+
+// indexSpec describes an index's definition, as listed by mongo.
+type indexSpec struct {
+	Name                    string   `bson:"name"`
+	Key                     bson.D   `bson:"key"`
+	Unique                  bool     `bson:"unique"`
+	Sparse                  bool     `bson:"sparse"`
+	ExpireAfterSeconds      *int32   `bson:"expireAfterSeconds"`
+	PartialFilterExpression bson.Raw `bson:"partialFilterExpression"`
+}
+
+// newIndexSpec returns the definition of the index model, as mongo would list
+// it once created.
+func newIndexSpec(index mongo.IndexModel) (spec indexSpec, err error) {
+	doc := bson.M{
+		"key": index.Keys,
+	}
+	if opts := index.Options; opts != nil {
+		if opts.Name != nil {
+			doc["name"] = *opts.Name
+		}
+		if opts.Unique != nil {
+			doc["unique"] = *opts.Unique
+		}
+		if opts.Sparse != nil {
+			doc["sparse"] = *opts.Sparse
+		}
+		if opts.ExpireAfterSeconds != nil {
+			doc["expireAfterSeconds"] = *opts.ExpireAfterSeconds
+		}
+		if opts.PartialFilterExpression != nil {
+			doc["partialFilterExpression"] = opts.PartialFilterExpression
+		}
+	}
+
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return spec, err
+	}
+
+	err = bson.Unmarshal(raw, &spec)
+	return spec, err
+}
+
+// sameKeys returns whether the indices are on the same keys, in the same
+// order and direction.
+func (s indexSpec) sameKeys(x indexSpec) bool {
+	if len(s.Key) != len(x.Key) {
+		return false
+	}
+
+	for i := range s.Key {
+		if s.Key[i].Key != x.Key[i].Key || indexDirection(s.Key[i].Value) != indexDirection(x.Key[i].Value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matches returns whether the index matches the wanted index's definition.
+func (s indexSpec) matches(want indexSpec) bool {
+	if want.Name != "" && s.Name != want.Name {
+		return false
+	}
+
+	if !s.sameKeys(want) || s.Unique != want.Unique || s.Sparse != want.Sparse {
+		return false
+	}
+
+	if (s.ExpireAfterSeconds == nil) != (want.ExpireAfterSeconds == nil) ||
+		s.ExpireAfterSeconds != nil && *s.ExpireAfterSeconds != *want.ExpireAfterSeconds {
+		return false
+	}
+
+	var filter, wantFilter bson.M
+	if len(s.PartialFilterExpression) > 0 {
+		if err := bson.Unmarshal(s.PartialFilterExpression, &filter); err != nil {
+			return false
+		}
+	}
+	if len(want.PartialFilterExpression) > 0 {
+		if err := bson.Unmarshal(want.PartialFilterExpression, &wantFilter); err != nil {
+			return false
+		}
+	}
+
+	return reflect.DeepEqual(filter, wantFilter)
+}
+
+// indexDirection normalizes an index key's direction, which mongo may list as
+// any numeric type, or as a string for special indices, such as hashed.
+func indexDirection(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	default:
+		return value
+	}
+}
+
 // NewDefaultStore returns a Store configured with the default mongo
 // configuration and default Hasher.
 func NewDefaultStore() (*Store, error) {
@@ -307,6 +1405,26 @@ func NewDefaultStore() (*Store, error) {
 	return New(cfg, nil)
 }
 
+// generateID returns a new ID from the provided generator, falling back to a
+// UUID if no generator has been provided.
+func generateID(generator func() string) string {
+	if generator == nil {
+		return uuid.NewString()
+	}
+
+	return generator()
+}
+
+// timeNow returns the current time from the provided clock, falling back to
+// the system clock if no clock has been provided.
+func timeNow(clock func() time.Time) time.Time {
+	if clock == nil {
+		return time.Now()
+	}
+
+	return clock()
+}
+
 // NewIndex generates a new index model, ready to be saved in mongo.
 //
 // Note:
@@ -328,6 +1446,29 @@ func NewUniqueIndex(name string, keys ...string) mongo.IndexModel {
 	}
 }
 
+// NewPartialIndex generates a new index model that only indexes the documents
+// matching the filter, ready to be saved in mongo.
+//
+// Note:
+//   - Partial indices can't be sparse, so the filter should exclude documents
+//     missing the indexed keys, if required.
+func NewPartialIndex(name string, filter bson.M, keys ...string) mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys:    generateIndexKeys(keys...),
+		Options: generatePartialIndexOptions(name, false, filter),
+	}
+}
+
+// NewUniquePartialIndex generates a new index model that only indexes, and
+// therefore only enforces uniqueness across, the documents matching the
+// filter, ready to be saved in mongo.
+func NewUniquePartialIndex(name string, filter bson.M, keys ...string) mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys:    generateIndexKeys(keys...),
+		Options: generatePartialIndexOptions(name, true, filter),
+	}
+}
+
 // NewExpiryIndex generates a new index with a time to live value before the
 // record expires in mongodb.
 func NewExpiryIndex(name string, key string, expireAfter int) (model mongo.IndexModel) {
@@ -379,3 +1520,19 @@ func generateIndexOptions(name string, unique bool) *options.IndexOptions {
 
 	return opts
 }
+
+// generatePartialIndexOptions generates new partial index options.
+func generatePartialIndexOptions(name string, unique bool, filter bson.M) *options.IndexOptions {
+	opts := options.Index().
+		SetPartialFilterExpression(filter)
+
+	if unique {
+		opts.SetUnique(true)
+	}
+
+	if name != "" {
+		opts.SetName(name)
+	}
+
+	return opts
+}
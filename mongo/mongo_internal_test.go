@@ -0,0 +1,541 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"context"
+	"crypto/tls"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	// External Imports
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+func TestCollectionOptions(t *testing.T) {
+	primary := readpref.Primary()
+	secondary := readpref.Secondary()
+	nearest := readpref.Nearest()
+
+	db := &DB{
+		ReadPreferences: map[string]*readpref.ReadPref{
+			storage.EntityClients:      secondary,
+			storage.EntityAccessTokens: nearest,
+		},
+	}
+
+	tests := []struct {
+		name       string
+		db         *DB
+		ctx        context.Context
+		collection string
+		expected   *readpref.ReadPref
+	}{
+		{
+			name:       "should use the store's default read preference",
+			db:         &DB{},
+			ctx:        context.Background(),
+			collection: storage.EntityUsers,
+			expected:   nil,
+		},
+		{
+			name:       "should read from the primary",
+			db:         &DB{},
+			ctx:        WithReadPreference(context.Background(), primary),
+			collection: storage.EntityUsers,
+			expected:   primary,
+		},
+		{
+			name:       "should read from secondaries",
+			db:         &DB{},
+			ctx:        WithReadPreference(context.Background(), secondary),
+			collection: storage.EntityUsers,
+			expected:   secondary,
+		},
+		{
+			name:       "should use the innermost read preference",
+			db:         &DB{},
+			ctx:        WithReadPreference(WithReadPreference(context.Background(), secondary), primary),
+			collection: storage.EntityUsers,
+			expected:   primary,
+		},
+		{
+			name:       "should read the denylist from the primary by default",
+			db:         &DB{},
+			ctx:        context.Background(),
+			collection: storage.EntityJtiDenylist,
+			expected:   defaultReadPreferences[storage.EntityJtiDenylist],
+		},
+		{
+			name:       "should read refresh tokens from the primary by default",
+			db:         db,
+			ctx:        context.Background(),
+			collection: storage.EntityRefreshTokens,
+			expected:   defaultReadPreferences[storage.EntityRefreshTokens],
+		},
+		{
+			name:       "should use the collection's configured read preference",
+			db:         db,
+			ctx:        context.Background(),
+			collection: storage.EntityClients,
+			expected:   secondary,
+		},
+		{
+			name:       "should override a default read preference",
+			db:         db,
+			ctx:        context.Background(),
+			collection: storage.EntityAccessTokens,
+			expected:   nearest,
+		},
+		{
+			name:       "should prefer the context's read preference",
+			db:         db,
+			ctx:        WithReadPreference(context.Background(), primary),
+			collection: storage.EntityClients,
+			expected:   primary,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.db.collectionOptions(tt.ctx, tt.collection).ReadPreference
+			if got != tt.expected {
+				t.Errorf("collectionOptions() read preference = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDeniedJtiManager_ShouldReadFromPrimary(t *testing.T) {
+	// Configuring other collections must not relax the denylist's default.
+	db := &DB{
+		ReadPreferences: map[string]*readpref.ReadPref{
+			storage.EntityClients: readpref.SecondaryPreferred(),
+		},
+	}
+
+	got := db.collectionOptions(context.Background(), storage.EntityJtiDenylist).ReadPreference
+	if got == nil || got.Mode() != readpref.PrimaryMode {
+		t.Errorf("expected the denylist to be read from the primary, got: %v", got)
+	}
+}
+
+func TestDB_Tenant(t *testing.T) {
+	// Connecting is lazy, so no server is required to open databases.
+	client, err := mongo.Connect(context.Background(), options.Client())
+	if err != nil {
+		t.Fatalf("connect should return no errors, got: %v", err)
+	}
+	defer func() {
+		_ = client.Disconnect(context.Background())
+	}()
+
+	db := &DB{database: client.Database("oauth2"), TimestampsAsDates: true}
+	tenant, err := db.Tenant("acme")
+	if err != nil {
+		t.Fatalf("Tenant() should return no errors, got: %v", err)
+	}
+	if got := tenant.Name(); got != "oauth2_acme" {
+		t.Errorf("Tenant() name = %q, want %q", got, "oauth2_acme")
+	}
+	if !tenant.TimestampsAsDates {
+		t.Error("Tenant() should inherit the database's configuration")
+	}
+	if cached, _ := db.Tenant("acme"); cached != tenant {
+		t.Error("Tenant() should cache the tenant's database")
+	}
+
+	ctx := WithTenant(context.Background(), "acme")
+	collection, err := db.collection(ctx, storage.EntityClients)
+	if err != nil {
+		t.Fatalf("collection() should return no errors, got: %v", err)
+	}
+	if got := collection.Database().Name(); got != "oauth2_acme" {
+		t.Errorf("collection() database = %q, want %q", got, "oauth2_acme")
+	}
+	collection, err = db.collection(context.Background(), storage.EntityClients)
+	if err != nil {
+		t.Fatalf("collection() should return no errors, got: %v", err)
+	}
+	if got := collection.Database().Name(); got != "oauth2" {
+		t.Errorf("collection() database = %q, want %q", got, "oauth2")
+	}
+
+	db.TenantDatabaseName = func(tenantID string) string {
+		return "tenant-" + tenantID
+	}
+	tenant, err = db.Tenant("globex")
+	if err != nil {
+		t.Fatalf("Tenant() should return no errors, got: %v", err)
+	}
+	if got := tenant.Name(); got != "tenant-globex" {
+		t.Errorf("Tenant() name = %q, want %q", got, "tenant-globex")
+	}
+}
+
+func TestDB_Tenant_ShouldRejectInvalidTenants(t *testing.T) {
+	client, err := mongo.Connect(context.Background(), options.Client())
+	if err != nil {
+		t.Fatalf("connect should return no errors, got: %v", err)
+	}
+	defer func() {
+		_ = client.Disconnect(context.Background())
+	}()
+
+	db := &DB{database: client.Database("oauth2")}
+	tenantIDs := []string{
+		"",
+		"acme.corp",
+		"acme/corp",
+		`acme\corp`,
+		"acme$corp",
+		"acme corp",
+		"acme\x00corp",
+		strings.Repeat("a", maxDatabaseNameLength),
+	}
+	for _, tenantID := range tenantIDs {
+		if _, err := db.Tenant(tenantID); !errors.Is(err, ErrInvalidTenant) {
+			t.Errorf("Tenant(%q) should return ErrInvalidTenant, got: %v", tenantID, err)
+		}
+
+		// Invalid tenants must not fall back to the default database.
+		_, err := db.collection(WithTenant(context.Background(), tenantID), storage.EntityClients)
+		if !errors.Is(err, ErrInvalidTenant) {
+			t.Errorf("collection() for tenant %q should return ErrInvalidTenant, got: %v", tenantID, err)
+		}
+	}
+	if len(db.tenants) != 0 {
+		t.Errorf("Tenant() should not cache invalid tenants, got: %d cached", len(db.tenants))
+	}
+
+	db.TenantDatabaseName = func(tenantID string) string {
+		return "tenant-" + strings.ReplaceAll(tenantID, ".", "-")
+	}
+	if _, err := db.Tenant("acme.corp"); err != nil {
+		t.Errorf("Tenant() should accept tenants named validly by TenantDatabaseName, got: %v", err)
+	}
+}
+
+func TestValidateDatabaseName(t *testing.T) {
+	valid := []string{
+		"oauth2",
+		"oauth2_acme",
+		"tenant-acme",
+		strings.Repeat("a", maxDatabaseNameLength),
+	}
+	for _, name := range valid {
+		if err := validateDatabaseName(name); err != nil {
+			t.Errorf("validateDatabaseName(%q) should return no errors, got: %v", name, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"oauth2.acme",
+		"oauth2/acme",
+		`oauth2\acme`,
+		"oauth2$acme",
+		"oauth2 acme",
+		`oauth2"acme`,
+		"oauth2\x00acme",
+		strings.Repeat("a", maxDatabaseNameLength+1),
+	}
+	for _, name := range invalid {
+		if err := validateDatabaseName(name); err == nil {
+			t.Errorf("validateDatabaseName(%q) should return an error", name)
+		}
+	}
+}
+
+// connectionInfo returns the client options configured from cfg, failing the
+// test if they can't be built.
+func connectionInfo(t *testing.T, cfg *Config) *options.ClientOptions {
+	t.Helper()
+
+	clientOpts, err := ConnectionInfo(cfg)
+	if err != nil {
+		t.Fatalf("ConnectionInfo() should return no errors, got: %v", err)
+	}
+	return clientOpts
+}
+
+func TestConnectionInfo_ShouldNotModifyHostnames(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Hostnames = []string{"localhost"}
+	cfg.Port = 27017
+
+	expected := []string{"localhost:27017"}
+	for i := 0; i < 2; i++ {
+		got := connectionInfo(t, cfg).Hosts
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("ConnectionInfo() call %d hosts = %v, want %v", i+1, got, expected)
+		}
+	}
+	if !reflect.DeepEqual(cfg.Hostnames, []string{"localhost"}) {
+		t.Errorf("ConnectionInfo() modified hostnames = %v, want %v", cfg.Hostnames, []string{"localhost"})
+	}
+}
+
+func TestConnectionInfo_ShouldCloneTLSConfig(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.SSL = true
+	cfg.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS13}
+
+	got := connectionInfo(t, cfg).TLSConfig
+	if got == nil || got == cfg.TLSConfig {
+		t.Fatalf("ConnectionInfo() should clone the tls config, got: %p, shared: %p", got, cfg.TLSConfig)
+	}
+	if got.MinVersion != tls.VersionTLS13 {
+		t.Errorf("ConnectionInfo() tls min version = %x, want %x", got.MinVersion, tls.VersionTLS13)
+	}
+}
+
+func TestConnect_ShouldNotModifyConfig(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Hostnames = []string{"127.0.0.1"}
+	cfg.Port = 1
+	cfg.SSL = true
+	cfg.ServerSelectionTimeout = 1
+
+	_, err := Connect(cfg)
+	if err == nil {
+		t.Fatalf("Connect() should fail without a server")
+	}
+	if cfg.TLSConfig != nil {
+		t.Errorf("Connect() should not set the caller's tls config, got: %+v", cfg.TLSConfig)
+	}
+}
+
+func TestConfig_TokenTTL(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		expected int
+	}{
+		{
+			name:     "should disable expiry by default",
+			cfg:      Config{},
+			expected: 0,
+		},
+		{
+			name:     "should use the legacy ttl in seconds",
+			cfg:      Config{TokenTTL: 3600},
+			expected: 3600,
+		},
+		{
+			name:     "should convert the ttl duration to seconds",
+			cfg:      Config{TokenTTLDuration: 90 * time.Minute},
+			expected: 5400,
+		},
+		{
+			name:     "should truncate the ttl duration to whole seconds",
+			cfg:      Config{TokenTTLDuration: 1500 * time.Millisecond},
+			expected: 1,
+		},
+		{
+			name:     "should prefer the ttl duration over the legacy ttl",
+			cfg:      Config{TokenTTL: 3600, TokenTTLDuration: 2 * time.Hour},
+			expected: 7200,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.cfg.tokenTTL()
+			if got != tt.expected {
+				t.Errorf("token ttl = %d, want %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewPartialIndex(t *testing.T) {
+	filter := bson.M{"disabled": false}
+
+	tests := []struct {
+		name   string
+		index  func() mongo.IndexModel
+		unique bool
+	}{
+		{
+			name: "should create a partial index",
+			index: func() mongo.IndexModel {
+				return NewPartialIndex(IdxUsername, filter, "username")
+			},
+			unique: false,
+		},
+		{
+			name: "should create a unique partial index",
+			index: func() mongo.IndexModel {
+				return NewUniquePartialIndex(IdxUsername, filter, "username")
+			},
+			unique: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.index()
+
+			keys := bson.D{{Key: "username", Value: int32(1)}}
+			if !reflect.DeepEqual(got.Keys, keys) {
+				t.Errorf("keys = %v, want %v", got.Keys, keys)
+			}
+			if got.Options.Name == nil || *got.Options.Name != IdxUsername {
+				t.Errorf("name = %v, want %q", got.Options.Name, IdxUsername)
+			}
+			if !reflect.DeepEqual(got.Options.PartialFilterExpression, filter) {
+				t.Errorf("partial filter expression = %v, want %v", got.Options.PartialFilterExpression, filter)
+			}
+			if got.Options.Sparse != nil {
+				t.Errorf("partial indices can't be sparse, got sparse = %v", *got.Options.Sparse)
+			}
+			if unique := got.Options.Unique != nil && *got.Options.Unique; unique != tt.unique {
+				t.Errorf("unique = %v, want %v", unique, tt.unique)
+			}
+		})
+	}
+}
+
+func TestIsIndexExists(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "should tolerate a concurrently created collection", err: mongo.CommandError{Code: 48, Name: "NamespaceExists"}, want: true},
+		{name: "should tolerate an existing index", err: mongo.CommandError{Code: 68, Name: "IndexAlreadyExists"}, want: true},
+		{name: "should not tolerate conflicting index options", err: mongo.CommandError{Code: 85, Name: "IndexOptionsConflict"}, want: false},
+		{name: "should not tolerate other command errors", err: mongo.CommandError{Code: 13, Name: "Unauthorized"}, want: false},
+		{name: "should not tolerate no error", err: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isIndexExists(tt.err); got != tt.want {
+				t.Errorf("isIndexExists() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsIndexConflict(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "should detect conflicting index options", err: mongo.CommandError{Code: 85, Name: "IndexOptionsConflict"}, want: true},
+		{name: "should detect conflicting index keys", err: mongo.CommandError{Code: 86, Name: "IndexKeySpecsConflict"}, want: true},
+		{name: "should not detect an existing index", err: mongo.CommandError{Code: 68, Name: "IndexAlreadyExists"}, want: false},
+		{name: "should not detect other command errors", err: mongo.CommandError{Code: 13, Name: "Unauthorized"}, want: false},
+		{name: "should not detect other errors", err: context.DeadlineExceeded, want: false},
+		{name: "should not detect no error", err: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isIndexConflict(tt.err); got != tt.want {
+				t.Errorf("isIndexConflict() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexSpec_Matches(t *testing.T) {
+	// listed decodes the index as listed by mongo, which reports directions
+	// as doubles when created by other drivers.
+	listed := func(doc bson.M) indexSpec {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			t.Fatalf("marshal should return no errors, got: %v", err)
+		}
+		var spec indexSpec
+		if err := bson.Unmarshal(raw, &spec); err != nil {
+			t.Fatalf("unmarshal should return no errors, got: %v", err)
+		}
+		return spec
+	}
+
+	tests := []struct {
+		name     string
+		index    mongo.IndexModel
+		existing indexSpec
+		want     bool
+	}{
+		{
+			name:  "should match an identical index",
+			index: NewUniqueIndex(IdxSignatureID, "signature"),
+			existing: listed(bson.M{
+				"name":   IdxSignatureID,
+				"key":    bson.D{{Key: "signature", Value: 1.0}},
+				"unique": true,
+				"sparse": true,
+			}),
+			want: true,
+		},
+		{
+			name:  "should match an identical partial index",
+			index: NewUniquePartialIndex(IdxUsername, bson.M{"disabled": false}, "username"),
+			existing: listed(bson.M{
+				"name":                    IdxUsername,
+				"key":                     bson.D{{Key: "username", Value: int32(1)}},
+				"unique":                  true,
+				"partialFilterExpression": bson.M{"disabled": false},
+			}),
+			want: true,
+		},
+		{
+			name:  "should not match a fully unique index of the same name",
+			index: NewUniquePartialIndex(IdxUsername, bson.M{"disabled": false}, "username"),
+			existing: listed(bson.M{
+				"name":   IdxUsername,
+				"key":    bson.D{{Key: "username", Value: int32(1)}},
+				"unique": true,
+				"sparse": true,
+			}),
+			want: false,
+		},
+		{
+			name:  "should not match a different expiry",
+			index: NewExpiryIndex(IdxExpiry, "requested_at", 3600),
+			existing: listed(bson.M{
+				"name":               IdxExpiry,
+				"key":                bson.D{{Key: "requested_at", Value: int32(1)}},
+				"sparse":             true,
+				"expireAfterSeconds": int32(60),
+			}),
+			want: false,
+		},
+		{
+			name:  "should not match a hashed index on the same key",
+			index: NewUniqueIndex(IdxSignatureID, "signature"),
+			existing: listed(bson.M{
+				"name":   IdxSignatureID,
+				"key":    bson.D{{Key: "signature", Value: "hashed"}},
+				"sparse": true,
+			}),
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := newIndexSpec(tt.index)
+			if err != nil {
+				t.Fatalf("newIndexSpec() should return no errors, got: %v", err)
+			}
+			if got := tt.existing.matches(want); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	// External Imports
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 const (
@@ -25,15 +26,80 @@ const (
 	// IdxUsername provides a mongo index based on username
 	IdxUsername = "idxUsername"
 
+	// IdxEmail provides a mongo index based on a user's email
+	IdxEmail = "idxEmail"
+
+	// IdxSearchTerms provides a mongo multikey index based on the terms a
+	// user is found by when searching
+	IdxSearchTerms = "idxSearchTerms"
+
+	// IdxPersonID provides a mongo index based on personId
+	IdxPersonID = "idxPersonId"
+
+	// IdxEmailVerificationToken provides a mongo index based on a user's email
+	// verification token
+	IdxEmailVerificationToken = "idxEmailVerificationToken"
+
 	// IdxSessionID provides a mongo index based on Session
 	IdxSessionID = "idxSessionId"
 
 	// IdxSignatureID provides a mongo index based on Signature
 	IdxSignatureID = "idxSignatureId"
 
+	// IdxSignatureIDHashed provides a mongo hashed index based on Signature
+	// for sessions with signatures too large to index efficiently.
+	IdxSignatureIDHashed = IdxSignatureID + "Hashed"
+
+	// IdxSid provides a mongo index based on the OpenID Connect session ID
+	IdxSid = "idxSid"
+
+	// IdxRegion provides a mongo index based on the region a request was
+	// issued in
+	IdxRegion = "idxRegion"
+
+	// IdxClaims provides a mongo wildcard index based on the custom claims
+	// extracted from a request's session
+	IdxClaims = "idxClaims"
+
 	// IdxCompoundRequester provides a mongo compound index based on Client ID
 	// and User ID for when filtering request records.
 	IdxCompoundRequester = "idxCompoundRequester"
+
+	// IdxCompoundRequestedAt provides a mongo compound index based on when a
+	// request was made and its ID for paging through request records.
+	IdxCompoundRequestedAt = "idxCompoundRequestedAt"
+
+	// IdxCompoundNonce provides a mongo compound index based on Client ID and
+	// nonce signature for denying replayed nonces.
+	IdxCompoundNonce = "idxCompoundNonce"
+
+	// IdxCompoundIdempotencyKey provides a mongo compound index based on
+	// Client ID and idempotency key signature for replaying the results of
+	// a client's idempotent requests.
+	IdxCompoundIdempotencyKey = "idxCompoundIdempotencyKey"
+
+	// IdxCompoundContacts provides a mongo compound multikey index based on
+	// a client's contacts and ID for finding, and paging through, the
+	// clients a contact is responsible for.
+	IdxCompoundContacts = "idxCompoundContacts"
+
+	// IdxCompoundConsent provides a mongo compound index based on User ID and
+	// Client ID for uniquely identifying consent records.
+	IdxCompoundConsent = "idxCompoundConsent"
+)
+
+// SignatureIndex specifies how request signatures are indexed.
+type SignatureIndex string
+
+const (
+	// SignatureIndexUnique indexes signatures with a unique constraint,
+	// guaranteeing a signature can't be stored twice.
+	SignatureIndexUnique SignatureIndex = "unique"
+
+	// SignatureIndexHashed indexes hashes of signatures, which greatly
+	// reduces the size of the index for large signatures, at the expense of
+	// the unique constraint.
+	SignatureIndexHashed SignatureIndex = "hashed"
 )
 
 // SessionToContext provides a way to push a mongo datastore session into the
@@ -42,6 +108,25 @@ func SessionToContext(ctx context.Context, session mongo.Session) context.Contex
 	return mongo.NewSessionContext(ctx, session)
 }
 
+// WithSession returns a context which runs the store's operations within the
+// given session, so that application code can compose several manager calls
+// within a session, or transaction, that it manages itself. For example:
+//
+//	session, err := store.DB.Client().StartSession()
+//	...
+//	defer session.EndSession(ctx)
+//
+//	ctx = mongo.WithSession(ctx, session)
+//	client, err = store.ClientManager.Create(ctx, client)
+//	...
+//	user, err = store.UserManager.Create(ctx, user)
+//
+// Managers honour a session contained within the context, rather than starting
+// their own, leaving the caller responsible for ending the session.
+func WithSession(ctx context.Context, session mongo.Session) context.Context {
+	return SessionToContext(ctx, session)
+}
+
 // ContextToSession provides a way to obtain a mongo session, if contained
 // within the presented context.
 func ContextToSession(ctx context.Context) (sess mongo.Session, ok bool) {
@@ -51,3 +136,82 @@ func ContextToSession(ctx context.Context) (sess mongo.Session, ok bool) {
 
 	return nil, false
 }
+
+// readPreferenceKey is the context key holding the read preference
+// overriding the store's default.
+type readPreferenceKey struct{}
+
+// WithReadPreference returns a context which instructs the store to read with
+// the given preference, overriding the store's default. For example, token
+// validation can read from the primary, while administrative listings read
+// from secondaries to offload the primary.
+func WithReadPreference(ctx context.Context, rp *readpref.ReadPref) context.Context {
+	return context.WithValue(ctx, readPreferenceKey{}, rp)
+}
+
+// readPreferenceFromContext returns the read preference contained within the
+// context, or nil if the store's default should be used.
+func readPreferenceFromContext(ctx context.Context) *readpref.ReadPref {
+	rp, _ := ctx.Value(readPreferenceKey{}).(*readpref.ReadPref)
+	return rp
+}
+
+// tenantKey is the context key holding the ID of the tenant the store's
+// resources are routed to.
+type tenantKey struct{}
+
+// TenantNameFunc names the database holding the tenant's resources.
+type TenantNameFunc func(tenantID string) string
+
+// WithTenant returns a context which routes the store's reads and writes to
+// the tenant's database, isolating each tenant's resources, see DB.Tenant.
+// A tenant's indices are created by calling EnsureIndexes with the tenant's
+// context.
+//
+// The tenant's database name, the database's name suffixed with the tenant ID
+// unless DB.TenantDatabaseName is set, must be a valid mongo database name: no
+// longer than 63 bytes and free of '/', '\', '.', ' ', '"', '$' and NUL
+// characters. The store's reads and writes for an empty or invalid tenant
+// return ErrInvalidTenant rather than being sent to mongo.
+//
+//	ctx = mongo.WithTenant(ctx, "acme")
+//	err = store.EnsureIndexes(ctx)
+//	...
+//	client, err = store.ClientManager.Get(ctx, clientID)
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext returns the ID of the tenant the context has been routed
+// to, if any.
+func TenantFromContext(ctx context.Context) (tenantID string, ok bool) {
+	tenantID, ok = ctx.Value(tenantKey{}).(string)
+	return tenantID, ok && tenantID != ""
+}
+
+// requestMetadataKey is the context key holding the request metadata.
+type requestMetadataKey struct{}
+
+// requestMetadata contains details of the client a request is being issued
+// to.
+type requestMetadata struct {
+	RemoteIP  string
+	UserAgent string
+}
+
+// WithRequestMetadata provides a way to push the client's IP address and user
+// agent into the current context, which are then recorded against any
+// sessions created with the context.
+func WithRequestMetadata(ctx context.Context, remoteIP string, userAgent string) context.Context {
+	return context.WithValue(ctx, requestMetadataKey{}, requestMetadata{
+		RemoteIP:  remoteIP,
+		UserAgent: userAgent,
+	})
+}
+
+// requestMetadataFromContext returns the request metadata contained within
+// the presented context, if any.
+func requestMetadataFromContext(ctx context.Context) requestMetadata {
+	metadata, _ := ctx.Value(requestMetadataKey{}).(requestMetadata)
+	return metadata
+}
@@ -2,13 +2,37 @@ package mongo_test
 
 import (
 	// Standard Library Imports
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"math/big"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
 	"testing"
+	"time"
+
+	// External Imports
+	"github.com/google/uuid"
+	"github.com/ory/fosite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	mongodriver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	// Public Imports
+	"github.com/p000ic/go-fosite-mongo"
 	"github.com/p000ic/go-fosite-mongo/mongo"
+	"github.com/p000ic/go-fosite-mongo/storagetest"
 )
 
 func TestMain(m *testing.M) {
@@ -28,9 +52,42 @@ func AssertFatal(t *testing.T, got interface{}, want interface{}, msg string) {
 	t.Fatalf(fmt.Sprintf("Fatal: %s\n	 got: %#+v\n	want: %#+v", msg, got, want))
 }
 
+// sequentialIDs returns an ID generator that produces deterministic,
+// prefixed, sequential IDs.
+func sequentialIDs(prefix string) func() string {
+	i := 0
+	return func() string {
+		i++
+		return fmt.Sprintf("%s%d", prefix, i)
+	}
+}
+
+// frozenClock returns a clock that always reports the time pointed to by now,
+// enabling tests to control the passage of time.
+func frozenClock(now *time.Time) func() time.Time {
+	return func() time.Time {
+		return *now
+	}
+}
+
+// connectionInfo returns the client options configured from cfg, failing the
+// test if they can't be built.
+func connectionInfo(t *testing.T, cfg *mongo.Config) *options.ClientOptions {
+	t.Helper()
+
+	clientOpts, err := mongo.ConnectionInfo(cfg)
+	if err != nil {
+		AssertFatal(t, err, nil, "connection info should return no errors")
+	}
+	return clientOpts
+}
+
 func setup(t *testing.T) (*mongo.Store, context.Context, func()) {
 	// Build our default mongo storage layer
-	cfg := mongo.DefaultConfig()
+	return setupWithConfig(t, mongo.DefaultConfig())
+}
+
+func setupWithConfig(t *testing.T, cfg *mongo.Config) (*mongo.Store, context.Context, func()) {
 	cfg.DatabaseName = "fositeStorageTest"
 	store, err := mongo.New(cfg, nil)
 	if err != nil {
@@ -59,3 +116,954 @@ func setup(t *testing.T) (*mongo.Store, context.Context, func()) {
 		store.Close()
 	}
 }
+
+func TestConnectionInfo_ShouldSetServerAPI(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.APIVersion = "1"
+	cfg.APIStrict = true
+
+	got := connectionInfo(t, cfg).ServerAPIOptions
+	if got == nil {
+		AssertFatal(t, got, "server api options", "server api options should be set")
+	}
+	if got.ServerAPIVersion != options.ServerAPIVersion1 {
+		AssertError(t, got.ServerAPIVersion, options.ServerAPIVersion1, "server api version should be set from config")
+	}
+	if got.Strict == nil || !*got.Strict {
+		AssertError(t, got.Strict, true, "server api strict mode should be set from config")
+	}
+}
+
+func TestConnectionInfo_ShouldNotSetServerAPIByDefault(t *testing.T) {
+	got := connectionInfo(t, mongo.DefaultConfig()).ServerAPIOptions
+	if got != nil {
+		AssertError(t, got, nil, "server api options should not be set by default")
+	}
+}
+
+func TestConnect_ShouldRejectInvalidAPIVersion(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.APIVersion = "2"
+
+	_, err := mongo.Connect(cfg)
+	if err == nil {
+		AssertError(t, err, "invalid stable api version", "connect should fail fast on an invalid api version")
+	}
+}
+
+func TestConnectionInfo_ShouldSetTimeouts(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.Timeout = 5
+	cfg.ServerSelectionTimeout = 15
+	cfg.SocketTimeout = 20
+	cfg.MaxConnIdleTime = 60
+
+	got := connectionInfo(t, cfg)
+	if got.ConnectTimeout == nil || *got.ConnectTimeout != 5*time.Second {
+		AssertError(t, got.ConnectTimeout, 5*time.Second, "connect timeout should be set from config")
+	}
+	if got.ServerSelectionTimeout == nil || *got.ServerSelectionTimeout != 15*time.Second {
+		AssertError(t, got.ServerSelectionTimeout, 15*time.Second, "server selection timeout should be set from config")
+	}
+	if got.SocketTimeout == nil || *got.SocketTimeout != 20*time.Second {
+		AssertError(t, got.SocketTimeout, 20*time.Second, "socket timeout should be set from config")
+	}
+	if got.MaxConnIdleTime == nil || *got.MaxConnIdleTime != 60*time.Second {
+		AssertError(t, got.MaxConnIdleTime, 60*time.Second, "max connection idle time should be set from config")
+	}
+}
+
+func TestConnectionInfo_ShouldDefaultTimeouts(t *testing.T) {
+	got := connectionInfo(t, mongo.DefaultConfig())
+	if got.ConnectTimeout == nil || *got.ConnectTimeout != 10*time.Second {
+		AssertError(t, got.ConnectTimeout, 10*time.Second, "connect timeout should default to 10 seconds")
+	}
+	if got.ServerSelectionTimeout == nil || *got.ServerSelectionTimeout != 30*time.Second {
+		AssertError(t, got.ServerSelectionTimeout, 30*time.Second, "server selection timeout should default to 30 seconds")
+	}
+	if got.SocketTimeout != nil {
+		AssertError(t, got.SocketTimeout, nil, "socket timeout should be unbounded by default")
+	}
+	if got.MaxConnIdleTime != nil {
+		AssertError(t, got.MaxConnIdleTime, nil, "max connection idle time should be unbounded by default")
+	}
+}
+
+func TestConnectionInfo_ShouldSetHeartbeatInterval(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.HeartbeatInterval = 30
+
+	got := connectionInfo(t, cfg)
+	if got.HeartbeatInterval == nil || *got.HeartbeatInterval != 30*time.Second {
+		AssertError(t, got.HeartbeatInterval, 30*time.Second, "heartbeat interval should be set from config")
+	}
+
+	got = connectionInfo(t, mongo.DefaultConfig())
+	if got.HeartbeatInterval != nil {
+		AssertError(t, got.HeartbeatInterval, nil, "heartbeat interval should be left to the driver by default")
+	}
+}
+
+func TestConnectionInfo_ShouldSetAppName(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.AppName = "authorization-server"
+
+	got := connectionInfo(t, cfg)
+	if got.AppName == nil || *got.AppName != "authorization-server" {
+		AssertError(t, got.AppName, "authorization-server", "app name should be set from config")
+	}
+
+	got = connectionInfo(t, mongo.DefaultConfig())
+	if got.AppName == nil || *got.AppName != "oauth2" {
+		AssertError(t, got.AppName, "oauth2", "app name should default to the database name")
+	}
+}
+
+func TestConnectionInfo_ShouldSetCompressors(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.Compressors = []string{"zstd", "zlib"}
+	cfg.ZlibCompressionLevel = 9
+
+	got := connectionInfo(t, cfg)
+	if !reflect.DeepEqual(got.Compressors, cfg.Compressors) {
+		AssertError(t, got.Compressors, cfg.Compressors, "compressors should be set from config")
+	}
+	if got.ZlibLevel == nil || *got.ZlibLevel != 9 {
+		AssertError(t, got.ZlibLevel, 9, "zlib compression level should be set from config")
+	}
+
+	got = connectionInfo(t, mongo.DefaultConfig())
+	if got.ZlibLevel != nil {
+		AssertError(t, got.ZlibLevel, nil, "zlib compression level should be left to the driver by default")
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(cfg *mongo.Config)
+		wantErr bool
+	}{
+		{
+			name:    "should accept the default config",
+			mutate:  func(cfg *mongo.Config) {},
+			wantErr: false,
+		},
+		{
+			name: "should accept a mongodb+srv URI without a port",
+			mutate: func(cfg *mongo.Config) {
+				cfg.Hostnames = []string{"mongodb+srv://cluster0.example.mongodb.net"}
+				cfg.Port = 0
+			},
+			wantErr: false,
+		},
+		{
+			name: "should accept consistent auth fields",
+			mutate: func(cfg *mongo.Config) {
+				cfg.Username = "fosite"
+				cfg.Password = "s3cr3t"
+			},
+			wantErr: false,
+		},
+		{
+			name: "should reject an empty database name",
+			mutate: func(cfg *mongo.Config) {
+				cfg.DatabaseName = ""
+			},
+			wantErr: true,
+		},
+		{
+			name: "should reject missing hostnames",
+			mutate: func(cfg *mongo.Config) {
+				cfg.Hostnames = nil
+			},
+			wantErr: true,
+		},
+		{
+			name: "should reject an empty hostname",
+			mutate: func(cfg *mongo.Config) {
+				cfg.Hostnames = []string{"localhost", " "}
+			},
+			wantErr: true,
+		},
+		{
+			name: "should reject a missing port",
+			mutate: func(cfg *mongo.Config) {
+				cfg.Port = 0
+			},
+			wantErr: true,
+		},
+		{
+			name: "should reject a password without a username",
+			mutate: func(cfg *mongo.Config) {
+				cfg.Password = "s3cr3t"
+			},
+			wantErr: true,
+		},
+		{
+			name: "should reject a username without a password",
+			mutate: func(cfg *mongo.Config) {
+				cfg.Username = "fosite"
+			},
+			wantErr: true,
+		},
+		{
+			name: "should reject a minimum pool size larger than the maximum",
+			mutate: func(cfg *mongo.Config) {
+				cfg.PoolMinSize = 10
+				cfg.PoolMaxSize = 5
+			},
+			wantErr: true,
+		},
+		{
+			name: "should accept supported compressors",
+			mutate: func(cfg *mongo.Config) {
+				cfg.Compressors = []string{"zstd", "snappy", "zlib"}
+				cfg.ZlibCompressionLevel = 6
+			},
+			wantErr: false,
+		},
+		{
+			name: "should accept collection read preferences",
+			mutate: func(cfg *mongo.Config) {
+				cfg.ReadPreferences = map[string]string{
+					storage.EntityClients:     "secondaryPreferred",
+					storage.EntityJtiDenylist: "primary",
+				}
+			},
+			wantErr: false,
+		},
+		{
+			name: "should reject an unknown read preference",
+			mutate: func(cfg *mongo.Config) {
+				cfg.ReadPreferences = map[string]string{storage.EntityUsers: "fastest"}
+			},
+			wantErr: true,
+		},
+		{
+			name: "should accept request signature indexes",
+			mutate: func(cfg *mongo.Config) {
+				cfg.SignatureIndexes = map[string]string{
+					storage.EntityAccessTokens:  "unique",
+					storage.EntityRefreshTokens: "hashed",
+				}
+			},
+			wantErr: false,
+		},
+		{
+			name: "should reject an unknown signature index",
+			mutate: func(cfg *mongo.Config) {
+				cfg.SignatureIndexes = map[string]string{storage.EntityRefreshTokens: "sparse"}
+			},
+			wantErr: true,
+		},
+		{
+			name: "should reject a signature index on a non-request collection",
+			mutate: func(cfg *mongo.Config) {
+				cfg.SignatureIndexes = map[string]string{storage.EntityClients: "hashed"}
+			},
+			wantErr: true,
+		},
+		{
+			name: "should reject an unsupported compressor",
+			mutate: func(cfg *mongo.Config) {
+				cfg.Compressors = []string{"zstd", "zstandard"}
+			},
+			wantErr: true,
+		},
+		{
+			name: "should reject an empty compressor",
+			mutate: func(cfg *mongo.Config) {
+				cfg.Compressors = []string{"snappy", ""}
+			},
+			wantErr: true,
+		},
+		{
+			name: "should reject an out of range zlib compression level",
+			mutate: func(cfg *mongo.Config) {
+				cfg.Compressors = []string{"zlib"}
+				cfg.ZlibCompressionLevel = 10
+			},
+			wantErr: true,
+		},
+		{
+			name: "should accept a token ttl duration",
+			mutate: func(cfg *mongo.Config) {
+				cfg.TokenTTLDuration = 90 * time.Minute
+			},
+			wantErr: false,
+		},
+		{
+			name: "should reject a negative token ttl duration",
+			mutate: func(cfg *mongo.Config) {
+				cfg.TokenTTLDuration = -time.Hour
+			},
+			wantErr: true,
+		},
+		{
+			name: "should reject a sub-second token ttl duration",
+			mutate: func(cfg *mongo.Config) {
+				cfg.TokenTTLDuration = 500 * time.Millisecond
+			},
+			wantErr: true,
+		},
+		{
+			name: "should reject an unsupported stable api version",
+			mutate: func(cfg *mongo.Config) {
+				cfg.APIVersion = "2"
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mongo.DefaultConfig()
+			tt.mutate(cfg)
+
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				AssertError(t, err, tt.wantErr, "validate returned an unexpected result")
+				return
+			}
+			if err != nil && !errors.Is(err, mongo.ErrInvalidConfig) {
+				AssertError(t, err, mongo.ErrInvalidConfig, "validate should wrap ErrInvalidConfig")
+			}
+		})
+	}
+}
+
+func TestNew_ShouldRejectInvalidConfig(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.DatabaseName = ""
+
+	_, err := mongo.New(cfg, nil)
+	if !errors.Is(err, mongo.ErrInvalidConfig) {
+		AssertError(t, err, mongo.ErrInvalidConfig, "new should fail fast on an invalid config")
+	}
+}
+
+// unsetenv removes the environment variable for the duration of the test,
+// restoring its original value on cleanup.
+func unsetenv(t *testing.T, key string) {
+	t.Helper()
+	t.Setenv(key, "")
+	if err := os.Unsetenv(key); err != nil {
+		t.Fatalf("unable to unset %s: %s", key, err)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("CONNECTIONS_MONGO_HOSTNAMES", "mongo-0.example.com,mongo-1.example.com")
+	t.Setenv("CONNECTIONS_MONGO_PORT", "27018")
+	t.Setenv("CONNECTIONS_MONGO_SSL", "true")
+	t.Setenv("CONNECTIONS_MONGO_USERNAME", "fosite")
+	t.Setenv("CONNECTIONS_MONGO_PASSWORD", "s3cr3t")
+	t.Setenv("CONNECTIONS_MONGO_NAME", "oauth2")
+	t.Setenv("CONNECTIONS_MONGO_POOL_MAX_SIZE", "50")
+	t.Setenv("CONNECTIONS_MONGO_COMPRESSORS", "zstd,snappy")
+	t.Setenv("CONNECTIONS_MONGO_TOKEN_TTL", "3600")
+	t.Setenv("CONNECTIONS_MONGO_TOKEN_TTL_DURATION", "90m")
+	t.Setenv("CONNECTIONS_MONGO_HEARTBEAT_INTERVAL", "15")
+	t.Setenv("CONNECTIONS_MONGO_APP_NAME", "authorization-server")
+	t.Setenv("CONNECTIONS_MONGO_READ_PREFERENCES", "oauth2_client:secondaryPreferred,oauth2_user:nearest")
+	t.Setenv("CONNECTIONS_MONGO_SIGNATURE_INDEXES", "oauth2_refresh_token:hashed")
+
+	got, err := mongo.ConfigFromEnv()
+	if err != nil {
+		AssertFatal(t, err, nil, "config from env should return no errors")
+	}
+
+	expected := &mongo.Config{
+		Hostnames:              []string{"mongo-0.example.com", "mongo-1.example.com"},
+		Port:                   27018,
+		SSL:                    true,
+		AuthDB:                 "admin",
+		Username:               "fosite",
+		Password:               "s3cr3t",
+		DatabaseName:           "oauth2",
+		Timeout:                10,
+		ServerSelectionTimeout: 30,
+		HeartbeatInterval:      15,
+		AppName:                "authorization-server",
+		PoolMaxSize:            50,
+		Compressors:            []string{"zstd", "snappy"},
+		TokenTTL:               3600,
+		TokenTTLDuration:       90 * time.Minute,
+		ReadPreferences: map[string]string{
+			storage.EntityClients: "secondaryPreferred",
+			storage.EntityUsers:   "nearest",
+		},
+		SignatureIndexes: map[string]string{
+			storage.EntityRefreshTokens: "hashed",
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		AssertError(t, got, expected, "config should be populated from the environment")
+	}
+}
+
+func TestConfigFromEnv_ShouldUseDefaults(t *testing.T) {
+	for _, key := range []string{
+		"CONNECTIONS_MONGO_HOSTNAMES",
+		"CONNECTIONS_MONGO_PORT",
+		"CONNECTIONS_MONGO_AUTHDB",
+		"CONNECTIONS_MONGO_NAME",
+		"CONNECTIONS_MONGO_TIMEOUT",
+		"CONNECTIONS_MONGO_SERVER_SELECTION_TIMEOUT",
+		"CONNECTIONS_MONGO_POOL_MAX_SIZE",
+		"CONNECTIONS_MONGO_COMPRESSORS",
+	} {
+		unsetenv(t, key)
+	}
+
+	got, err := mongo.ConfigFromEnv()
+	if err != nil {
+		AssertFatal(t, err, nil, "config from env should return no errors")
+	}
+
+	if !reflect.DeepEqual(got.Hostnames, []string{"localhost"}) {
+		AssertError(t, got.Hostnames, []string{"localhost"}, "hostnames should default to localhost")
+	}
+	if got.Port != 27017 {
+		AssertError(t, got.Port, 27017, "port should default to 27017")
+	}
+	if got.AuthDB != "admin" {
+		AssertError(t, got.AuthDB, "admin", "auth db should default to admin")
+	}
+	if got.DatabaseName != "" {
+		AssertError(t, got.DatabaseName, "", "database name should default to empty")
+	}
+	if got.Timeout != 10 {
+		AssertError(t, got.Timeout, 10, "timeout should default to 10 seconds")
+	}
+	if got.ServerSelectionTimeout != 30 {
+		AssertError(t, got.ServerSelectionTimeout, 30, "server selection timeout should default to 30 seconds")
+	}
+	if got.PoolMaxSize != 100 {
+		AssertError(t, got.PoolMaxSize, 100, "pool max size should default to 100")
+	}
+	if got.Compressors != nil {
+		AssertError(t, got.Compressors, nil, "compressors should default to none")
+	}
+}
+
+func TestConfigFromEnv_ShouldRejectInvalidValues(t *testing.T) {
+	t.Setenv("CONNECTIONS_MONGO_PORT", "not-a-port")
+
+	_, err := mongo.ConfigFromEnv()
+	if !errors.Is(err, mongo.ErrInvalidConfig) {
+		AssertError(t, err, mongo.ErrInvalidConfig, "config from env should reject unparsable values")
+	}
+}
+
+// writeTestCertificate generates a self-signed certificate, writing the
+// certificate to certFile and the certificate bundled with its private key to
+// keyFile.
+func writeTestCertificate(t *testing.T) (certFile string, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %s", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fosite-mongo-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unable to create certificate: %s", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("unable to marshal key: %s", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "ca.pem")
+	keyFile = filepath.Join(dir, "client.pem")
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatalf("unable to write certificate: %s", err)
+	}
+	if err := os.WriteFile(keyFile, append(certPEM, keyPEM...), 0o600); err != nil {
+		t.Fatalf("unable to write certificate key: %s", err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+
+	cfg := mongo.DefaultConfig()
+	cfg.SSL = true
+	cfg.TLSCAFile = certFile
+	cfg.TLSCertificateKeyFile = keyFile
+
+	got, err := mongo.NewTLSConfig(cfg)
+	if err != nil {
+		AssertFatal(t, err, nil, "new tls config should return no errors")
+	}
+	if got.RootCAs == nil {
+		AssertError(t, got.RootCAs, "ca pool", "root cas should be loaded from the ca file")
+	}
+	if len(got.Certificates) != 1 {
+		AssertError(t, len(got.Certificates), 1, "client certificate should be loaded from the certificate key file")
+	}
+	if got.InsecureSkipVerify {
+		AssertError(t, got.InsecureSkipVerify, false, "server verification should be enabled by default")
+	}
+	if got.MinVersion != tls.VersionTLS12 {
+		AssertError(t, got.MinVersion, tls.VersionTLS12, "minimum tls version should be 1.2")
+	}
+}
+
+func TestConnectionInfo_ShouldBuildTLSConfigFromFiles(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+
+	cfg := mongo.DefaultConfig()
+	cfg.SSL = true
+	cfg.TLSCAFile = certFile
+	cfg.TLSCertificateKeyFile = keyFile
+
+	got := connectionInfo(t, cfg).TLSConfig
+	if got == nil {
+		AssertFatal(t, got, "tls config", "tls config should be set when ssl is enabled")
+	}
+	if got.RootCAs == nil {
+		AssertError(t, got.RootCAs, "ca pool", "root cas should be loaded from the ca file")
+	}
+	if len(got.Certificates) != 1 {
+		AssertError(t, len(got.Certificates), 1, "client certificate should be loaded from the certificate key file")
+	}
+	if cfg.TLSConfig != nil {
+		AssertError(t, cfg.TLSConfig, nil, "connection info should not set the caller's tls config")
+	}
+}
+
+func TestNewTLSConfig_ShouldSetInsecure(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.SSL = true
+	cfg.TLSInsecure = true
+
+	got, err := mongo.NewTLSConfig(cfg)
+	if err != nil {
+		AssertFatal(t, err, nil, "new tls config should return no errors")
+	}
+	if !got.InsecureSkipVerify {
+		AssertError(t, got.InsecureSkipVerify, true, "server verification should be disabled when insecure")
+	}
+	if got.RootCAs != nil || got.Certificates != nil {
+		AssertError(t, got, "system defaults", "tls config should use system defaults without files")
+	}
+}
+
+func TestNewTLSConfig_ShouldRejectInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.pem")
+	if err := os.WriteFile(invalid, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("unable to write file: %s", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(cfg *mongo.Config)
+	}{
+		{
+			name: "should reject a missing ca file",
+			mutate: func(cfg *mongo.Config) {
+				cfg.TLSCAFile = filepath.Join(dir, "missing.pem")
+			},
+		},
+		{
+			name: "should reject a ca file without certificates",
+			mutate: func(cfg *mongo.Config) {
+				cfg.TLSCAFile = invalid
+			},
+		},
+		{
+			name: "should reject an invalid certificate key file",
+			mutate: func(cfg *mongo.Config) {
+				cfg.TLSCertificateKeyFile = invalid
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mongo.DefaultConfig()
+			cfg.SSL = true
+			tt.mutate(cfg)
+
+			_, err := mongo.NewTLSConfig(cfg)
+			if err == nil {
+				AssertError(t, err, "error", "new tls config should reject invalid files")
+			}
+
+			_, err = mongo.ConnectionInfo(cfg)
+			if !errors.Is(err, mongo.ErrInvalidConfig) {
+				AssertError(t, err, mongo.ErrInvalidConfig, "connection info should reject invalid tls files")
+			}
+
+			_, err = mongo.Connect(cfg)
+			if !errors.Is(err, mongo.ErrInvalidConfig) {
+				AssertError(t, err, mongo.ErrInvalidConfig, "connect should fail fast on invalid tls files")
+			}
+		})
+	}
+}
+
+func TestStore_Close_ShouldDisconnectOwnedClient(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	teardown()
+
+	err := store.DB.Client().Ping(ctx, nil)
+	if err == nil {
+		AssertError(t, err, "client is disconnected", "close should disconnect a client owned by the store")
+	}
+}
+
+func TestStore_ConnState(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	ok, latency, err := store.ConnState(ctx)
+	if err != nil {
+		AssertFatal(t, err, nil, "conn state should return no database errors")
+	}
+	if !ok {
+		AssertError(t, ok, true, "conn state should report a healthy connection")
+	}
+	if latency <= 0 {
+		AssertError(t, latency, "a positive latency", "conn state should report the ping's latency")
+	}
+}
+
+func TestStore_ConnState_ShouldAutoReconnect(t *testing.T) {
+	ctx := context.Background()
+	cfg := mongo.DefaultConfig()
+	cfg.DatabaseName = "fositeStorageTest"
+	cfg.AutoReconnect = true
+	store, err := mongo.New(cfg, nil)
+	if err != nil {
+		AssertFatal(t, err, nil, "mongo connection error")
+	}
+	// Sessions are bound to a client, so none are started as the client is
+	// replaced.
+	defer func() {
+		_ = store.DB.Drop(ctx)
+		store.Close()
+	}()
+
+	disconnected := store.DB.Client()
+	err = disconnected.Disconnect(ctx)
+	if err != nil {
+		AssertFatal(t, err, nil, "disconnect should return no errors")
+	}
+
+	ok, _, err := store.ConnState(ctx)
+	if err != nil || !ok {
+		AssertFatal(t, err, nil, "conn state should reconnect a disconnected client")
+	}
+	if store.DB.Client() == disconnected {
+		AssertError(t, store.DB.Client(), "a new client", "conn state should replace the disconnected client")
+	}
+
+	_, err = store.ClientManager.List(ctx, storage.ListClientsRequest{})
+	if err != nil {
+		AssertError(t, err, nil, "the store should be usable once reconnected")
+	}
+}
+
+func TestStore_Close_ShouldNotDisconnectSharedClient(t *testing.T) {
+	ctx := context.Background()
+	cfg := mongo.DefaultConfig()
+	cfg.DatabaseName = "fositeStorageTest"
+
+	client, err := mongodriver.Connect(ctx, connectionInfo(t, cfg))
+	if err != nil {
+		AssertFatal(t, err, nil, "mongo connection error")
+	}
+	defer func() {
+		_ = client.Disconnect(ctx)
+	}()
+
+	store, err := mongo.NewWithClient(client, cfg, nil)
+	if err != nil {
+		AssertFatal(t, err, nil, "new with client should return no errors")
+	}
+	defer func() {
+		_ = store.DB.Drop(ctx)
+	}()
+
+	store.Close()
+
+	err = client.Ping(ctx, nil)
+	if err != nil {
+		AssertError(t, err, nil, "close should not disconnect a shared client")
+	}
+}
+
+func TestWithSession_ShouldShareSessionAcrossManagers(t *testing.T) {
+	ctx := context.Background()
+	cfg := mongo.DefaultConfig()
+	cfg.DatabaseName = "fositeStorageTest"
+
+	// Record the session each insert is sent with.
+	var mutex sync.Mutex
+	lsids := map[string]bson.Raw{}
+	monitor := &event.CommandMonitor{
+		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
+			if evt.CommandName != "insert" {
+				return
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			lsids[evt.Command.Lookup("insert").StringValue()] = evt.Command.Lookup("lsid").Document()
+		},
+	}
+	client, err := mongodriver.Connect(ctx, connectionInfo(t, cfg).SetMonitor(monitor))
+	if err != nil {
+		AssertFatal(t, err, nil, "mongo connection error")
+	}
+	defer func() {
+		_ = client.Disconnect(ctx)
+	}()
+
+	store, err := mongo.NewWithClient(client, cfg, nil)
+	if err != nil {
+		AssertFatal(t, err, nil, "new with client should return no errors")
+	}
+	defer func() {
+		_ = store.DB.Drop(ctx)
+	}()
+
+	session, err := client.StartSession()
+	if err != nil {
+		AssertFatal(t, err, nil, "start session should return no errors")
+	}
+	defer session.EndSession(ctx)
+
+	ctx = mongo.WithSession(ctx, session)
+	got, ok := mongo.ContextToSession(ctx)
+	if !ok || got != session {
+		AssertFatal(t, got, session, "context should contain the session")
+	}
+
+	_, err = store.ClientManager.Create(ctx, storage.Client{ID: uuid.NewString(), Secret: "foobar"})
+	if err != nil {
+		AssertFatal(t, err, nil, "create client should return no errors")
+	}
+	_, err = store.UserManager.Create(ctx, storage.User{ID: uuid.NewString(), Username: uuid.NewString(), Password: "foobar"})
+	if err != nil {
+		AssertFatal(t, err, nil, "create user should return no errors")
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, entityName := range []string{storage.EntityClients, storage.EntityUsers} {
+		lsid, ok := lsids[entityName]
+		if !ok {
+			AssertError(t, lsids, entityName, "insert should have been sent for "+entityName)
+			continue
+		}
+		if !bytes.Equal(lsid, session.ID()) {
+			AssertError(t, lsid, session.ID(), "insert into "+entityName+" should be sent within the session")
+		}
+	}
+}
+
+func TestNew_ShouldRejectMissingClient(t *testing.T) {
+	_, err := mongo.NewWithClient(nil, mongo.DefaultConfig(), nil)
+	if !errors.Is(err, mongo.ErrInvalidConfig) {
+		AssertError(t, err, mongo.ErrInvalidConfig, "new with client should require a client")
+	}
+}
+
+func TestStore_EnsureIndexes_ShouldBeIdempotent(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	for i := 0; i < 2; i++ {
+		err := store.EnsureIndexes(ctx)
+		if err != nil {
+			AssertError(t, err, nil, "ensure indexes should return no errors when called repeatedly")
+		}
+	}
+}
+
+func TestStore_EnsureIndexes_ShouldBeSafeToRunConcurrently(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	// Start from an empty database, as a fresh deployment would.
+	err := store.DB.Drop(ctx)
+	if err != nil {
+		AssertFatal(t, err, nil, "drop database should return no errors")
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- store.EnsureIndexes(ctx)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			AssertError(t, err, nil, "ensure indexes should return no errors when run concurrently")
+		}
+	}
+
+	indexes := indexSpecifications(ctx, t, store, storage.EntityUsers)
+	if indexes[mongo.IdxUsername] == nil {
+		AssertError(t, indexes, mongo.IdxUsername, "ensure indexes should create the user indexes")
+	}
+}
+
+func TestStore_DropIndexes(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	err := store.DropIndexes(ctx)
+	if err != nil {
+		AssertFatal(t, err, nil, "drop indexes should return no errors")
+	}
+
+	for _, entityName := range []string{storage.EntityClients, storage.EntityUsers, storage.EntityAccessTokens, storage.EntityJtiDenylist} {
+		indexes := indexSpecifications(ctx, t, store, entityName)
+		if len(indexes) != 1 || indexes["_id_"] == nil {
+			AssertError(t, indexes, "_id_", "drop indexes should only leave the _id index on "+entityName)
+		}
+	}
+}
+
+func TestStore_RebuildIndexes(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.TokenTTL = 3600
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	err := store.RebuildIndexes(ctx)
+	if err != nil {
+		AssertFatal(t, err, nil, "rebuild indexes should return no errors")
+	}
+
+	clientIndexes := indexSpecifications(ctx, t, store, storage.EntityClients)
+	if clientIndexes[mongo.IdxClientID] == nil {
+		AssertError(t, clientIndexes, mongo.IdxClientID, "rebuild indexes should recreate the client indexes")
+	}
+
+	userIndexes := indexSpecifications(ctx, t, store, storage.EntityUsers)
+	if userIndexes[mongo.IdxUsername] == nil {
+		AssertError(t, userIndexes, mongo.IdxUsername, "rebuild indexes should recreate the user indexes")
+	}
+
+	tokenIndexes := indexSpecifications(ctx, t, store, storage.EntityAccessTokens)
+	expiry := tokenIndexes[mongo.IdxExpiry+"RequestedAt"]
+	if expiry == nil || expiry.ExpireAfterSeconds == nil || *expiry.ExpireAfterSeconds != 3600 {
+		AssertError(t, expiry, 3600, "rebuild indexes should recreate the configured expiry indexes")
+	}
+}
+
+func TestStore_EnsureTTLIndexes_ShouldBeIdempotent(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	for _, ttl := range []int{3600, 3600, 7200} {
+		err := store.EnsureTTLIndexes(ctx, ttl)
+		if err != nil {
+			AssertError(t, err, nil, "ensure ttl indexes should return no errors when called repeatedly")
+		}
+	}
+}
+
+func TestStore_EnsureTTLIndexes_ShouldRejectInvalidTTL(t *testing.T) {
+	store := &mongo.Store{}
+
+	err := store.EnsureTTLIndexes(context.Background(), 0)
+	if !errors.Is(err, mongo.ErrInvalidConfig) {
+		AssertError(t, err, mongo.ErrInvalidConfig, "ensure ttl indexes should reject a non-positive ttl")
+	}
+}
+
+func TestStore_Conformance(t *testing.T) {
+	store, _, teardown := setup(t)
+	defer teardown()
+
+	storagetest.RunStoreConformance(t, store.Store)
+}
+
+func TestWithTenant_ShouldIsolateTenants(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	tenants := []string{"tenantA", "tenantB"}
+	databases := map[string]*mongo.DB{}
+	for _, tenantID := range tenants {
+		tenant, err := store.DB.Tenant(tenantID)
+		if err != nil {
+			AssertFatal(t, err, nil, "tenant should return no errors")
+		}
+		defer func() {
+			_ = tenant.Drop(ctx)
+		}()
+		databases[tenantID] = tenant
+	}
+	if databases[tenants[0]].Name() == databases[tenants[1]].Name() {
+		AssertFatal(t, databases[tenants[1]].Name(), "a distinct database", "tenants should be routed to distinct databases")
+	}
+
+	// Create a client with the same ID, but a different name, per tenant.
+	expected := map[string]storage.Client{}
+	for _, tenantID := range tenants {
+		tenantCtx := mongo.WithTenant(ctx, tenantID)
+		err := store.EnsureIndexes(tenantCtx)
+		if err != nil {
+			AssertFatal(t, err, nil, "ensure indexes should return no database errors")
+		}
+
+		client := expectedClient()
+		client.Name = tenantID
+		expected[tenantID] = createNewClient(t, tenantCtx, store, client)
+	}
+
+	for _, tenantID := range tenants {
+		got, err := store.ClientManager.Get(mongo.WithTenant(ctx, tenantID), expected[tenantID].ID)
+		if err != nil {
+			AssertFatal(t, err, nil, "get should return no database errors")
+		}
+		if got.Name != tenantID {
+			AssertError(t, got.Name, tenantID, "tenants should read their own client")
+		}
+
+		count, err := databases[tenantID].Collection(storage.EntityClients).CountDocuments(ctx, bson.M{})
+		if err != nil {
+			AssertFatal(t, err, nil, "count should return no database errors")
+		}
+		if count != 1 {
+			AssertError(t, count, int64(1), "each tenant's database should hold its own client")
+		}
+	}
+
+	_, err := store.ClientManager.Get(ctx, expected[tenants[0]].ID)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		AssertError(t, err, fosite.ErrNotFound, "tenant clients should not be written to the default database")
+	}
+}
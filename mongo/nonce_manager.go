@@ -0,0 +1,97 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"context"
+	"time"
+
+	// External Imports
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// NonceManager provides a mongo backed implementation for denying replayed
+// OpenID Connect nonces.
+//
+// Implements:
+// - storage.Configure
+// - storage.NonceStore
+// - storage.NonceManager
+type NonceManager struct {
+	DB *DB
+
+	// Clock provides the current time. Defaults to time.Now if not set.
+	Clock func() time.Time
+}
+
+// Configure implements storage.Configure.
+func (n *NonceManager) Configure(ctx context.Context) (err error) {
+	defer classifyError(&err)
+
+	indices := []mongo.IndexModel{
+		NewUniqueIndex(IdxCompoundNonce, "client_id", "signature"),
+		// Nonces are purged by mongo as soon as they expire.
+		NewExpiryIndex(IdxExpiry+"ExpiresAt", "expires_at", 0),
+	}
+
+	collection, err := n.DB.collection(ctx, storage.EntityNonces)
+	if err != nil {
+		return err
+	}
+	err = createIndexes(ctx, collection, indices...)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ConsumeNonce records the nonce as used by the client until it expires.
+// Returns storage.ErrNonceReplayed if the nonce has already been used within
+// its validity window.
+func (n *NonceManager) ConsumeNonce(ctx context.Context, clientID string, nonce string, expiresAt time.Time) (err error) {
+	defer classifyError(&err)
+
+	consumed := storage.NewNonce(clientID, nonce, expiresAt)
+
+	collection, err := n.DB.collection(ctx, storage.EntityNonces)
+	if err != nil {
+		return err
+	}
+	_, err = collection.InsertOne(ctx, consumed)
+	if err == nil {
+		return nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	// Mongo's TTL monitor only purges expired records periodically, so the
+	// nonce may still be stored despite having expired. In which case, the
+	// nonce can be reclaimed.
+	selector := bson.M{
+		"client_id": consumed.ClientID,
+		"signature": consumed.Signature,
+		"expires_at": bson.M{
+			"$lte": timeNow(n.Clock),
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"expires_at": consumed.ExpiresAt,
+		},
+	}
+	res, err := collection.UpdateOne(ctx, selector, update)
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return storage.ErrNonceReplayed
+	}
+
+	return nil
+}
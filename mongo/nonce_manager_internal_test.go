@@ -0,0 +1,27 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"testing"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+func TestNonceMongoManager_ImplementsStorageConfigurer(t *testing.T) {
+	n := &NonceManager{}
+
+	var i interface{} = n
+	if _, ok := i.(storage.Configure); !ok {
+		t.Error("NonceManager does not implement interface storage.Configure")
+	}
+}
+
+func TestNonceMongoManager_ImplementsStorageNonceManager(t *testing.T) {
+	n := &NonceManager{}
+
+	var i interface{} = n
+	if _, ok := i.(storage.NonceManager); !ok {
+		t.Error("NonceManager does not implement interface storage.NonceManager")
+	}
+}
@@ -0,0 +1,73 @@
+package mongo_test
+
+import (
+	// Standard Library Imports
+	"testing"
+	"time"
+
+	// External Imports
+	"github.com/google/uuid"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+func TestNonceManager_ConsumeNonce(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	err := store.ConsumeNonce(ctx, uuid.NewString(), uuid.NewString(), time.Now().Add(time.Hour))
+	if err != nil {
+		AssertError(t, err, nil, "first use of a nonce should succeed")
+	}
+}
+
+func TestNonceManager_ConsumeNonce_ShouldRejectReplay(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	clientID := uuid.NewString()
+	nonce := uuid.NewString()
+	err := store.ConsumeNonce(ctx, clientID, nonce, time.Now().Add(time.Hour))
+	if err != nil {
+		AssertFatal(t, err, nil, "first use of a nonce should succeed")
+	}
+
+	err = store.ConsumeNonce(ctx, clientID, nonce, time.Now().Add(time.Hour))
+	if err != storage.ErrNonceReplayed {
+		AssertError(t, err, storage.ErrNonceReplayed, "second use of a nonce within the window should be rejected")
+	}
+}
+
+func TestNonceManager_ConsumeNonce_ShouldScopeToClient(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	nonce := uuid.NewString()
+	err := store.ConsumeNonce(ctx, uuid.NewString(), nonce, time.Now().Add(time.Hour))
+	if err != nil {
+		AssertFatal(t, err, nil, "first use of a nonce should succeed")
+	}
+
+	err = store.ConsumeNonce(ctx, uuid.NewString(), nonce, time.Now().Add(time.Hour))
+	if err != nil {
+		AssertError(t, err, nil, "use of the same nonce by another client should succeed")
+	}
+}
+
+func TestNonceManager_ConsumeNonce_ShouldAllowReuseOnceExpired(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	clientID := uuid.NewString()
+	nonce := uuid.NewString()
+	err := store.ConsumeNonce(ctx, clientID, nonce, time.Now().Add(-time.Minute))
+	if err != nil {
+		AssertFatal(t, err, nil, "first use of a nonce should succeed")
+	}
+
+	err = store.ConsumeNonce(ctx, clientID, nonce, time.Now().Add(time.Hour))
+	if err != nil {
+		AssertError(t, err, nil, "use of a nonce outside its validity window should succeed")
+	}
+}
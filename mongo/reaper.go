@@ -0,0 +1,92 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	// External Imports
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// defaultReaperInterval is how often the reaper deletes expired records if
+// an interval isn't provided.
+const defaultReaperInterval = time.Minute
+
+// StartReaper starts a background goroutine that deletes expired records
+// every interval, for deployments where mongo's TTL indices are unavailable
+// or intentionally disabled. Sessions that have expired are deleted along with
+// expired denied JTIs. If a token TTL has been configured, sessions requested
+// longer ago than the TTL are deleted too, see Config.TokenTTL. An interval
+// that isn't positive defaults to every minute.
+//
+// Errors are logged and retried on the next tick. The reaper stops once ctx
+// is cancelled, or the returned stop function is called, which blocks until
+// the reaper has exited.
+func (s *Store) StartReaper(ctx context.Context, interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(reaperInterval(interval))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.reap(ctx)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			wg.Wait()
+		})
+	}
+}
+
+// reaperInterval returns the interval to reap at, defaulting an interval that
+// isn't positive, which would otherwise panic the ticker.
+func reaperInterval(interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return defaultReaperInterval
+	}
+
+	return interval
+}
+
+// reap deletes expired records, logging any errors encountered.
+func (s *Store) reap(ctx context.Context) {
+	now := timeNow(s.clock)
+	for _, entityName := range sessionEntities {
+		_, err := s.RequestManager.PurgeExpiredBatched(ctx, entityName, now, 0)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("reaper: unable to delete expired %s: %s", entityName, err)
+		}
+
+		if s.tokenTTL > 0 {
+			err = s.RequestManager.DeleteExpired(ctx, entityName, s.tokenTTL)
+			if err != nil && err != fosite.ErrNotFound && ctx.Err() == nil {
+				log.Printf("reaper: unable to delete expired %s: %s", entityName, err)
+			}
+		}
+	}
+
+	err := s.DeniedJTIManager.DeleteBefore(ctx, now.Unix())
+	if err != nil && err != fosite.ErrNotFound && ctx.Err() == nil {
+		log.Printf("reaper: unable to delete expired %s: %s", storage.EntityJtiDenylist, err)
+	}
+}
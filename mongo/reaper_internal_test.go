@@ -0,0 +1,25 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStore_StartReaper_ShouldDefaultInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if got := reaperInterval(interval); got != defaultReaperInterval {
+			t.Errorf("an interval of %s should default, got: %s, want: %s", interval, got, defaultReaperInterval)
+		}
+
+		// The ticker panics on a non-positive interval, taking the test with
+		// it, unless defaulted.
+		stop := (&Store{}).StartReaper(context.Background(), interval)
+		stop()
+	}
+
+	if got := reaperInterval(time.Second); got != time.Second {
+		t.Errorf("a positive interval should be kept, got: %s, want: %s", got, time.Second)
+	}
+}
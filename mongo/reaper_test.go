@@ -0,0 +1,136 @@
+package mongo_test
+
+import (
+	// Standard Library Imports
+	"context"
+	"testing"
+	"time"
+
+	// External Imports
+	"github.com/google/uuid"
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+	"github.com/p000ic/go-fosite-mongo/mongo"
+)
+
+func TestStore_StartReaper_ShouldDeleteExpired(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	clientID := uuid.NewString()
+	subject := uuid.NewString()
+
+	// Sessions are reaped once expired, without a token TTL configured.
+	expired := newRequester(clientID, subject)
+	expired.Session.SetExpiresAt(fosite.RefreshToken, time.Now().Add(-time.Minute))
+	err := store.CreateRefreshTokenSession(ctx, uuid.NewString(), expired)
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	activeSignature := uuid.NewString()
+	err = store.CreateRefreshTokenSession(ctx, activeSignature, newRequester(clientID, subject))
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	expiredJTI := uuid.NewString()
+	_, err = store.DeniedJTIManager.Create(ctx, storage.NewDeniedJTI(expiredJTI, time.Now().Add(-time.Hour)))
+	if err != nil {
+		AssertFatal(t, err, nil, "create denied jti should return no database errors")
+	}
+
+	// The reaper runs in its own goroutine, so must not share the test's
+	// session.
+	stop := store.StartReaper(context.Background(), 10*time.Millisecond)
+	defer stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, jtiErr := store.DeniedJTIManager.Get(ctx, expiredJTI)
+		got, err := store.RequestManager.List(ctx, storage.EntityRefreshTokens, storage.ListRequestsRequest{UserID: subject})
+		if err != nil {
+			AssertFatal(t, err, nil, "list should return no database errors")
+		}
+		if len(got) == 1 && jtiErr == fosite.ErrNotFound {
+			if got[0].Signature != activeSignature {
+				AssertError(t, got[0].Signature, activeSignature, "reaper should not delete active sessions")
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			AssertFatal(t, len(got), 1, "reaper should delete expired records")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStore_StartReaper_ShouldDeleteSessionsPastTokenTTL(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.TokenTTL = 3600
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	clientID := uuid.NewString()
+	subject := uuid.NewString()
+
+	// Sessions without a known expiry are reaped once past the token TTL.
+	expired := newRequester(clientID, subject)
+	expired.RequestedAt = time.Now().UTC().Add(-2 * time.Hour)
+	err := store.CreateRefreshTokenSession(ctx, uuid.NewString(), expired)
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	activeSignature := uuid.NewString()
+	err = store.CreateRefreshTokenSession(ctx, activeSignature, newRequester(clientID, subject))
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	stop := store.StartReaper(context.Background(), 10*time.Millisecond)
+	defer stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := store.RequestManager.List(ctx, storage.EntityRefreshTokens, storage.ListRequestsRequest{UserID: subject})
+		if err != nil {
+			AssertFatal(t, err, nil, "list should return no database errors")
+		}
+		if len(got) == 1 {
+			if got[0].Signature != activeSignature {
+				AssertError(t, got[0].Signature, activeSignature, "reaper should not delete sessions within the token ttl")
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			AssertFatal(t, len(got), 1, "reaper should delete sessions past the token ttl")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStore_StartReaper_ShouldStop(t *testing.T) {
+	store := &mongo.Store{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stop := store.StartReaper(ctx, time.Hour)
+
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		// Stopping should be safe to repeat.
+		stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("reaper should stop when the stop function is called")
+	}
+}
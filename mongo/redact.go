@@ -0,0 +1,168 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// redacted replaces credentials removed from connection strings, errors and
+// configuration output.
+const redacted = "REDACTED"
+
+// secretURIOptions lists the connection string options, in lower case, whose
+// values carry credentials.
+var secretURIOptions = map[string]bool{
+	"authmechanismproperties":         true,
+	"password":                        true,
+	"sslclientcertificatekeypassword": true,
+	"tlscertificatekeyfilepassword":   true,
+}
+
+// splitURI splits a mongo connection string into the portion preceding the
+// userinfo, the userinfo, the hosts and path, and the query options. The
+// userinfo is empty if the connection string doesn't contain credentials.
+func splitURI(uri string) (scheme, userinfo, hosts, query string) {
+	schemeEnd := strings.Index(uri, "://")
+	if schemeEnd < 0 {
+		return "", "", uri, ""
+	}
+	scheme, rest := uri[:schemeEnd+3], uri[schemeEnd+3:]
+
+	if i := strings.Index(rest, "?"); i >= 0 {
+		rest, query = rest[:i], rest[i+1:]
+	}
+
+	// Passwords are meant to be percent encoded, but search for the last @ so
+	// that a stray @ or / in the password doesn't leave part of it behind.
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		userinfo, rest = rest[:i], rest[i+1:]
+	}
+
+	return scheme, userinfo, rest, query
+}
+
+// redactURI returns the connection string with the userinfo and the values of
+// any secret options replaced, so that it can be safely logged or returned in
+// an error. Strings that aren't connection strings are returned unaltered.
+func redactURI(uri string) string {
+	scheme, userinfo, hosts, query := splitURI(uri)
+	if scheme == "" {
+		return uri
+	}
+
+	redactedURI := scheme
+	if userinfo != "" {
+		redactedURI += redacted + "@"
+	}
+	redactedURI += hosts
+
+	if query != "" {
+		options := strings.Split(query, "&")
+		for i, option := range options {
+			key, _, found := strings.Cut(option, "=")
+			if found && secretURIOptions[strings.ToLower(key)] {
+				options[i] = key + "=" + redacted
+			}
+		}
+		redactedURI += "?" + strings.Join(options, "&")
+	}
+
+	return redactedURI
+}
+
+// uriSecrets returns the password and secret option values contained within
+// the connection string, both as written and percent decoded.
+func uriSecrets(uri string) (secrets []string) {
+	scheme, userinfo, _, query := splitURI(uri)
+	if scheme == "" {
+		return nil
+	}
+
+	if _, password, found := strings.Cut(userinfo, ":"); found {
+		secrets = append(secrets, password)
+	}
+	for _, option := range strings.Split(query, "&") {
+		key, value, found := strings.Cut(option, "=")
+		if found && secretURIOptions[strings.ToLower(key)] {
+			secrets = append(secrets, value)
+		}
+	}
+
+	for _, secret := range secrets {
+		if unescaped, err := url.QueryUnescape(secret); err == nil && unescaped != secret {
+			secrets = append(secrets, unescaped)
+		}
+	}
+
+	return secrets
+}
+
+// redactedError hides credentials from the message of the error it wraps,
+// while leaving the wrapped error available to errors.Is and errors.As.
+type redactedError struct {
+	err     error
+	message string
+}
+
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactError returns the error with any connection strings and credentials
+// contained within the configuration removed from its message.
+func redactError(cfg *Config, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	message := err.Error()
+	secrets := []string{cfg.Password}
+	for _, hostname := range cfg.Hostnames {
+		message = strings.ReplaceAll(message, hostname, redactURI(hostname))
+		secrets = append(secrets, uriSecrets(hostname)...)
+	}
+	for _, secret := range secrets {
+		if secret != "" {
+			message = strings.ReplaceAll(message, secret, redacted)
+		}
+	}
+
+	if message == err.Error() {
+		return err
+	}
+
+	return &redactedError{err: err, message: message}
+}
+
+// String implements fmt.Stringer, formatting the configuration with the
+// password and any credentials within connection strings redacted, so that
+// the configuration can be safely logged.
+func (cfg Config) String() string {
+	if cfg.Password != "" {
+		cfg.Password = redacted
+	}
+
+	if cfg.Hostnames != nil {
+		hostnames := make([]string, len(cfg.Hostnames))
+		for i := range cfg.Hostnames {
+			hostnames[i] = redactURI(cfg.Hostnames[i])
+		}
+		cfg.Hostnames = hostnames
+	}
+
+	// Format via a type without the String method to avoid recursing.
+	type config Config
+	return fmt.Sprintf("%+v", config(cfg))
+}
+
+// GoString implements fmt.GoStringer, ensuring the %#v verb doesn't bypass the
+// redaction performed by String.
+func (cfg Config) GoString() string {
+	return "mongo.Config" + cfg.String()
+}
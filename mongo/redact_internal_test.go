@@ -0,0 +1,138 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const (
+	testUsername = "fosite"
+	testPassword = "s3cr3t-p%40ss"
+	testKeyPass  = "k3y-p4ss"
+)
+
+var testURI = "mongodb+srv://" + testUsername + ":" + testPassword + "@cluster0.example.com/oauth2?tlsCertificateKeyFilePassword=" + testKeyPass + "&retryWrites=true"
+
+// assertRedacted fails the test if the output contains any of the secrets.
+func assertRedacted(t *testing.T, output string) {
+	t.Helper()
+
+	for _, secret := range []string{testPassword, "s3cr3t-p@ss", testKeyPass, testUsername + ":"} {
+		if strings.Contains(output, secret) {
+			t.Errorf("expected %q to be redacted from %q", secret, output)
+		}
+	}
+}
+
+func TestRedactURI(t *testing.T) {
+	tests := []struct {
+		name     string
+		uri      string
+		expected string
+	}{
+		{
+			name:     "should redact userinfo and secret options",
+			uri:      testURI,
+			expected: "mongodb+srv://REDACTED@cluster0.example.com/oauth2?tlsCertificateKeyFilePassword=REDACTED&retryWrites=true",
+		},
+		{
+			name:     "should redact userinfo across multiple hosts",
+			uri:      "mongodb://" + testUsername + ":" + testPassword + "@a:27017,b:27017/?replicaSet=rs0",
+			expected: "mongodb://REDACTED@a:27017,b:27017/?replicaSet=rs0",
+		},
+		{
+			name:     "should redact passwords containing unescaped characters",
+			uri:      "mongodb://" + testUsername + ":p@ss/w0rd@localhost",
+			expected: "mongodb://REDACTED@localhost",
+		},
+		{
+			name:     "should leave connection strings without credentials unaltered",
+			uri:      "mongodb://localhost:27017/?authSource=admin",
+			expected: "mongodb://localhost:27017/?authSource=admin",
+		},
+		{
+			name:     "should leave hostnames unaltered",
+			uri:      "localhost",
+			expected: "localhost",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := redactURI(tt.uri)
+			if got != tt.expected {
+				t.Errorf("redactURI() got: %s\nexpected: %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	cfg := &Config{
+		Hostnames: []string{testURI},
+		Username:  testUsername,
+		Password:  "hunter2",
+	}
+	cause := fmt.Errorf("error parsing uri %s: authentication failed for password hunter2 and key s3cr3t-p@ss", testURI)
+
+	err := redactError(cfg, cause)
+	assertRedacted(t, err.Error())
+	if strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("expected the configured password to be redacted from %q", err.Error())
+	}
+	if !errors.Is(err, cause) {
+		t.Error("expected the redacted error to wrap the original error")
+	}
+
+	untouched := errors.New("server selection timeout")
+	if got := redactError(cfg, untouched); got != untouched {
+		t.Errorf("expected errors without credentials to be returned as is, got: %v", got)
+	}
+
+	if got := redactError(cfg, nil); got != nil {
+		t.Errorf("expected a nil error, got: %v", got)
+	}
+}
+
+func TestConfig_String(t *testing.T) {
+	cfg := &Config{
+		Hostnames:    []string{testURI},
+		Username:     testUsername,
+		Password:     testPassword,
+		DatabaseName: "oauth2",
+	}
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		for _, value := range []interface{}{cfg, *cfg} {
+			output := fmt.Sprintf(format, value)
+			assertRedacted(t, output)
+			if !strings.Contains(output, "oauth2") {
+				t.Errorf("expected %s output to retain non secret fields, got: %s", format, output)
+			}
+		}
+	}
+
+	if cfg.Password != testPassword || cfg.Hostnames[0] != testURI {
+		t.Error("expected formatting the config to leave it unaltered")
+	}
+}
+
+func TestConnect_ShouldRedactCredentials(t *testing.T) {
+	cfg := &Config{
+		// The malformed escape fails parsing before any network access, with
+		// the driver echoing the option value in its error.
+		Hostnames:    []string{"mongodb+srv://" + testUsername + ":" + testPassword + "@cluster0.example.com/?tlsCertificateKeyFilePassword=" + testKeyPass + "%zz"},
+		Username:     testUsername,
+		Password:     testPassword,
+		DatabaseName: "oauth2",
+	}
+
+	_, err := Connect(cfg)
+	if err == nil {
+		t.Fatal("expected connecting with an invalid connection string to fail")
+	}
+	assertRedacted(t, err.Error())
+}
@@ -3,16 +3,17 @@ package mongo
 import (
 	// Standard Library Imports
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 
 	// External Imports
 	"github.com/go-jose/go-jose/v3"
-	"github.com/google/uuid"
 	"github.com/ory/fosite"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	// Internal Imports
 	"github.com/p000ic/go-fosite-mongo"
@@ -33,6 +34,10 @@ type PublicKeyScopes struct {
 	Scopes []string
 }
 
+// ClaimsFunc extracts the custom claims stored alongside a request from the
+// request's session, see storage.Request.Claims.
+type ClaimsFunc func(session fosite.Session) map[string]interface{}
+
 // RequestManager manages the main Mongo Session for a Request.
 type RequestManager struct {
 	// DB contains the Mongo connection that holds the base session that can be
@@ -50,6 +55,62 @@ type RequestManager struct {
 	// in order to find and authenticate users.
 	Users storage.UserStorer
 
+	// IDGenerator generates IDs for newly created requests. Defaults to
+	// generating UUIDs if not set.
+	IDGenerator func() string
+
+	// Clock provides the current time. Defaults to time.Now if not set.
+	Clock func() time.Time
+
+	// Region tags the requests created by the manager with the region they
+	// were issued in. Requests are not tagged if not set.
+	Region string
+
+	// MaxUserSessions caps the number of refresh tokens a user can hold at
+	// any one time. Once exceeded, the oldest refresh tokens are evicted.
+	// A value of 0 denotes an unlimited number of sessions.
+	MaxUserSessions int64
+
+	// Metrics receives counters for tokens issued, tokens revoked and
+	// authorization codes invalidated. Metrics are not reported if not set.
+	Metrics MetricsFunc
+
+	// DeleteUsedAuthorizeCodes deletes authorization codes once they've
+	// been used, rather than invalidating them, to stop consumed codes
+	// lingering until they expire.
+	DeleteUsedAuthorizeCodes bool
+
+	// RefreshTokenGracePeriod keeps refresh tokens usable for the given
+	// duration once they've been used, rather than deleting them, so that
+	// clients retrying a refresh aren't logged out. Used refresh tokens are
+	// deleted immediately if not set.
+	RefreshTokenGracePeriod time.Duration
+
+	// FormKeys limits the form data stored with each request to the listed
+	// keys. Every key is stored if not set. The keys fosite reads back, such
+	// as `redirect_uri`, are always stored, see storage.Request.FilterForm.
+	FormKeys []string
+
+	// RedactedFormKeys lists the form keys removed from the form data before
+	// it's stored, for example, `client_secret`, so secrets aren't persisted.
+	RedactedFormKeys []string
+
+	// SignatureIndexes overrides how the signatures of each request entity
+	// are indexed. Access token signatures are hashed, and all others unique,
+	// if not set.
+	SignatureIndexes map[string]SignatureIndex
+
+	// MaxSessionSize caps the size, in bytes, of the marshaled session stored
+	// with each request, so oversized sessions are rejected with
+	// storage.ErrSessionTooLarge rather than a driver error. Defaults to just
+	// under mongo's 16MB document limit if not set.
+	MaxSessionSize int
+
+	// ClaimsExtractor extracts custom claims from each session as it's
+	// stored, which are indexed so requests can be listed by claim. Claims
+	// aren't extracted if not set.
+	ClaimsExtractor ClaimsFunc
+
 	// Public keys to check signature in auth grant jwt assertion.
 	IssuerPublicKeys map[string]IssuerPublicKeys
 
@@ -63,8 +124,29 @@ type RequestManager struct {
 	issuerPublicKeysMutex sync.RWMutex
 }
 
+// defaultMaxSessionSize leaves room within mongo's 16MB document limit for the
+// fields stored alongside a request's session.
+const defaultMaxSessionSize = 16*1024*1024 - 64*1024
+
+// checkSessionSize returns storage.ErrSessionTooLarge if the request's
+// marshaled session exceeds MaxSessionSize.
+func (r *RequestManager) checkSessionSize(entityName string, request storage.Request) error {
+	maxSize := r.MaxSessionSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxSessionSize
+	}
+
+	if len(request.Session) > maxSize {
+		return fmt.Errorf("%w: %s session is %d bytes, exceeding the maximum of %d bytes", storage.ErrSessionTooLarge, entityName, len(request.Session), maxSize)
+	}
+
+	return nil
+}
+
 // Configure implements storage.Configure.
 func (r *RequestManager) Configure(ctx context.Context) (err error) {
+	defer classifyError(&err)
+
 	// In terms of the underlying entity for session data, the model is the
 	// same across the following entities. I have decided to logically break
 	// them into separate collections rather than have a 'SessionType'.
@@ -76,34 +158,97 @@ func (r *RequestManager) Configure(ctx context.Context) (err error) {
 		storage.EntityRefreshTokens,
 	}
 
+	var conflicts []error
 	for _, entityName := range collections {
 		// Build Indices
 		indices := []mongo.IndexModel{
-			NewUniqueIndex(IdxSessionID, "id"),
+			r.sessionIDIndex(entityName),
 			NewIndex(IdxCompoundRequester, "client_id", "user_id"),
+			NewIndex(IdxCompoundRequestedAt, "requested_at", "id"),
+			// Only requests tagged with a region are indexed.
+			NewPartialIndex(IdxRegion, bson.M{
+				"region": bson.M{"$gt": ""},
+			}, "region"),
+		}
+
+		indices = append(indices, r.signatureIndex(entityName), NewIndex(IdxExpires, "expires_at"))
+
+		if entityName == storage.EntityOpenIDSessions {
+			// OpenID Connect sessions are looked up by session ID in order to
+			// perform front-channel and back-channel logout.
+			indices = append(indices, NewIndex(IdxSid, "sid"))
+		}
+
+		if r.ClaimsExtractor != nil {
+			// Claims are arbitrary, so are covered by a wildcard index.
+			indices = append(indices, NewIndex(IdxClaims, "claims.$**"))
 		}
 
-		// Compute Signature Index
-		signatureIndex := NewUniqueIndex(IdxSignatureID, "signature")
-		if entityName == storage.EntityAccessTokens {
-			// Access Tokens generate a very large signature, which leads to
-			// the index size blowing out. Instead, we can make use of Mongo's
-			// hashed indices to massively reduce the size of the index.
-			//
-			// Note:
-			// - Hashed Indices don't currently support a unique constraint.
-			signatureIndex = NewIndex(IdxSignatureID+"Hashed", "#signature")
+		if entityName == storage.EntityRefreshTokens {
+			// Refresh tokens are counted per user in order to report the
+			// number of sessions a user holds.
+			indices = append(indices, NewIndex(IdxUserID, "user_id"))
 		}
-		indices = append(indices, signatureIndex)
 
-		collection := r.DB.Collection(entityName)
-		_, err = collection.Indexes().CreateMany(ctx, indices)
+		collection, err := r.DB.collection(ctx, entityName)
+		if err != nil {
+			return err
+		}
+		err = createIndexes(ctx, collection, indices...)
+		if errors.Is(err, ErrIndexConflict) {
+			conflicts = append(conflicts, err)
+			continue
+		}
 		if err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return errors.Join(conflicts...)
+}
+
+// sessionIDIndex returns the request ID index model for the entity.
+//
+// Note:
+//   - Refresh tokens are rotated under the same request ID, so used refresh
+//     tokens, kept for RefreshTokenGracePeriod, are excluded from the unique
+//     constraint. Stores created before used tokens were excluded must rebuild
+//     the indices, see Store.RebuildIndexes.
+func (r *RequestManager) sessionIDIndex(entityName string) mongo.IndexModel {
+	if entityName == storage.EntityRefreshTokens {
+		return NewUniquePartialIndex(IdxSessionID, bson.M{"active": true}, "id")
+	}
+
+	return NewUniqueIndex(IdxSessionID, "id")
+}
+
+// signatureIndex returns the signature index model for the entity.
+func (r *RequestManager) signatureIndex(entityName string) mongo.IndexModel {
+	index, ok := r.SignatureIndexes[entityName]
+	if !ok {
+		index = defaultSignatureIndex(entityName)
+	}
+
+	if index == SignatureIndexHashed {
+		// Note:
+		// - Hashed Indices don't currently support a unique constraint.
+		return NewIndex(IdxSignatureIDHashed, "#signature")
+	}
+
+	return NewUniqueIndex(IdxSignatureID, "signature")
+}
+
+// defaultSignatureIndex returns how the entity's signatures are indexed if
+// not configured.
+func defaultSignatureIndex(entityName string) SignatureIndex {
+	if entityName == storage.EntityAccessTokens {
+		// Access Tokens generate a very large signature, which leads to the
+		// index size blowing out. Instead, we can make use of Mongo's hashed
+		// indices to massively reduce the size of the index.
+		return SignatureIndexHashed
+	}
+
+	return SignatureIndexUnique
 }
 
 // ConfigureExpiryWithTTL implements storage.Expire.
@@ -116,16 +261,24 @@ func (r *RequestManager) ConfigureExpiryWithTTL(ctx context.Context, ttl int) er
 		storage.EntityRefreshTokens,
 	}
 
+	var conflicts []error
 	for _, entityName := range collections {
 		index := NewExpiryIndex(IdxExpiry+"RequestedAt", "requested_at", ttl)
-		collection := r.DB.Collection(entityName)
-		_, err := collection.Indexes().CreateOne(ctx, index)
+		collection, err := r.DB.collection(ctx, entityName)
 		if err != nil {
 			return err
 		}
+		err = createIndexes(ctx, collection, index)
+		if errors.Is(err, ErrIndexConflict) {
+			conflicts = append(conflicts, err)
+			continue
+		}
+		if err != nil {
+			return classify(err)
+		}
 	}
 
-	return nil
+	return errors.Join(conflicts...)
 }
 
 // getConcrete returns a Request resource.
@@ -136,7 +289,10 @@ func (r *RequestManager) getConcrete(ctx context.Context, entityName string, req
 	}
 
 	var request storage.Request
-	collection := r.DB.Collection(entityName)
+	collection, err := r.DB.collection(ctx, entityName)
+	if err != nil {
+		return result, err
+	}
 	err = collection.FindOne(ctx, query).Decode(&request)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
@@ -150,7 +306,98 @@ func (r *RequestManager) getConcrete(ctx context.Context, entityName string, req
 
 // List returns a list of Request resources that match the provided inputs.
 func (r *RequestManager) List(ctx context.Context, entityName string, filter storage.ListRequestsRequest) (results []storage.Request, err error) {
+	defer classifyError(&err)
+
+	// Build Query
+	query := listRequestsQuery(filter)
+	if filter.After != "" {
+		after, err := storage.ParseRequestCursor(filter.After)
+		if err != nil {
+			return results, err
+		}
+
+		// Keyset pagination on the sort keys, rather than skipping, so pages
+		// neither repeat nor miss requests created between fetches.
+		query["$or"] = bson.A{
+			bson.M{"requested_at": bson.M{"$gt": after.RequestedAt}},
+			bson.M{"requested_at": after.RequestedAt, "id": bson.M{"$gt": after.ID}},
+		}
+	}
+
+	findOptions := paginate(filter).SetSort(bson.D{
+		{Key: "requested_at", Value: 1},
+		{Key: "id", Value: 1},
+	})
+	return r.find(ctx, entityName, query, findOptions)
+}
+
+// ListExpiringBefore returns a list of Request resources that match the
+// provided inputs and expire before the given time, soonest first.
+// Requests without a known expiry are never returned.
+func (r *RequestManager) ListExpiringBefore(ctx context.Context, entityName string, before time.Time, filter storage.ListRequestsRequest) (results []storage.Request, err error) {
+	defer classifyError(&err)
+
 	// Build Query
+	query := listRequestsQuery(filter)
+	query["expires_at"] = bson.M{
+		"$lt": before,
+	}
+
+	findOptions := paginate(filter).SetSort(bson.D{
+		{Key: "expires_at", Value: 1},
+		{Key: "id", Value: 1},
+	})
+	return r.find(ctx, entityName, query, findOptions)
+}
+
+// ListByClaim returns the Request resources with the custom claim set to the
+// value. The key may be a dotted path to a nested claim.
+func (r *RequestManager) ListByClaim(ctx context.Context, entityName string, key string, value interface{}) (results []storage.Request, err error) {
+	defer classifyError(&err)
+
+	// Build Query
+	query := bson.M{
+		"claims." + key: value,
+	}
+
+	return r.find(ctx, entityName, query, options.Find())
+}
+
+// find returns the Request resources matching the query.
+func (r *RequestManager) find(ctx context.Context, entityName string, query bson.M, findOptions *options.FindOptions) (results []storage.Request, err error) {
+	collection, err := r.DB.collection(ctx, entityName)
+	if err != nil {
+		return results, err
+	}
+	cursor, err := collection.Find(ctx, query, findOptions)
+	if err != nil {
+		return results, err
+	}
+
+	var requests []storage.Request
+	err = cursor.All(ctx, &requests)
+	if err != nil {
+		return results, err
+	}
+
+	return requests, nil
+}
+
+// paginate returns find options that apply the filter's pagination.
+func paginate(filter storage.ListRequestsRequest) *options.FindOptions {
+	findOptions := options.Find()
+	if filter.Offset > 0 {
+		findOptions.SetSkip(filter.Offset)
+	}
+	if filter.Limit > 0 {
+		findOptions.SetLimit(filter.Limit)
+	}
+
+	return findOptions
+}
+
+// listRequestsQuery builds the query matching requests against the filter.
+func listRequestsQuery(filter storage.ListRequestsRequest) bson.M {
 	query := bson.M{}
 	if filter.ClientID != "" {
 		query["client_id"] = filter.ClientID
@@ -158,48 +405,60 @@ func (r *RequestManager) List(ctx context.Context, entityName string, filter sto
 	if filter.UserID != "" {
 		query["user_id"] = filter.UserID
 	}
+
+	// Scope filters can target the same field, so are combined with $and
+	// rather than overwriting each other.
+	var scopes []bson.M
 	if len(filter.ScopesIntersection) > 0 {
-		query["scopes"] = bson.M{"$all": filter.ScopesIntersection}
+		scopes = append(scopes, bson.M{"scopes": bson.M{"$all": filter.ScopesIntersection}})
 	}
 	if len(filter.ScopesUnion) > 0 {
-		query["scopes"] = bson.M{"$in": filter.ScopesUnion}
+		scopes = append(scopes, bson.M{"scopes": bson.M{"$in": filter.ScopesUnion}})
 	}
 	if len(filter.GrantedScopesIntersection) > 0 {
-		query["scopes"] = bson.M{"$all": filter.GrantedScopesIntersection}
+		scopes = append(scopes, bson.M{"granted_scopes": bson.M{"$all": filter.GrantedScopesIntersection}})
 	}
 	if len(filter.GrantedScopesUnion) > 0 {
-		query["scopes"] = bson.M{"$in": filter.GrantedScopesUnion}
+		scopes = append(scopes, bson.M{"granted_scopes": bson.M{"$in": filter.GrantedScopesUnion}})
 	}
-	collection := r.DB.Collection(entityName)
-	cursor, err := collection.Find(ctx, query)
-	if err != nil {
-		return results, err
+	if len(scopes) > 0 {
+		query["$and"] = scopes
 	}
-
-	var requests []storage.Request
-	err = cursor.All(ctx, &requests)
-	if err != nil {
-		return results, err
+	if filter.Region != "" {
+		query["region"] = filter.Region
 	}
 
-	return requests, nil
+	return query
 }
 
 // Create creates the new Request resource and returns the newly created Request
 // resource.
 func (r *RequestManager) Create(ctx context.Context, entityName string, request storage.Request) (result storage.Request, err error) {
+	defer classifyError(&err)
+
 	// Enable developers to provide their own IDs
 	if request.ID == "" {
-		request.ID = uuid.NewString()
+		request.ID = generateID(r.IDGenerator)
 	}
 	if request.CreateTime == 0 {
-		request.CreateTime = time.Now().Unix()
+		request.CreateTime = timeNow(r.Clock).Unix()
 	}
 	if request.RequestedAt.IsZero() {
-		request.RequestedAt = time.Now()
+		request.RequestedAt = timeNow(r.Clock)
+	}
+	if request.Region == "" {
+		request.Region = r.Region
+	}
+	err = r.checkSessionSize(entityName, request)
+	if err != nil {
+		return result, err
 	}
+
 	// Create resource
-	collection := r.DB.Collection(entityName)
+	collection, err := r.DB.collection(ctx, entityName)
+	if err != nil {
+		return result, err
+	}
 	_, err = collection.InsertOne(ctx, request)
 	if err != nil {
 		if mongo.IsDuplicateKeyError(err) {
@@ -213,18 +472,55 @@ func (r *RequestManager) Create(ctx context.Context, entityName string, request
 
 // Get returns the specified Request resource.
 func (r *RequestManager) Get(ctx context.Context, entityName string, requestID string) (result storage.Request, err error) {
+	defer classifyError(&err)
+
 	return r.getConcrete(ctx, entityName, requestID)
 }
 
+// findByIDEntities are the request entities searched by FindByID, in order.
+// Tokens are searched first as they're the most commonly looked up, and
+// outlive the codes and sessions issued under the same request.
+var findByIDEntities = []string{
+	storage.EntityAccessTokens,
+	storage.EntityRefreshTokens,
+	storage.EntityAuthorizationCodes,
+	storage.EntityOpenIDSessions,
+	storage.EntityPKCESessions,
+}
+
+// FindByID returns the Request resource with the given ID, and the name of the
+// entity it was found in, searching each request entity in turn and stopping
+// at the first match.
+func (r *RequestManager) FindByID(ctx context.Context, requestID string) (result storage.Request, entityName string, err error) {
+	defer classifyError(&err)
+
+	for _, entityName := range findByIDEntities {
+		result, err = r.Get(ctx, entityName, requestID)
+		if err == nil {
+			return result, entityName, nil
+		}
+		if err != fosite.ErrNotFound {
+			return result, "", err
+		}
+	}
+
+	return result, "", fosite.ErrNotFound
+}
+
 // GetBySignature returns a Request resource, if the presented signature returns
 // a match.
 func (r *RequestManager) GetBySignature(ctx context.Context, entityName string, signature string) (result storage.Request, err error) {
+	defer classifyError(&err)
+
 	// Build Query
 	query := bson.M{
 		"signature": signature,
 	}
 	var request storage.Request
-	collection := r.DB.Collection(entityName)
+	collection, err := r.DB.collection(ctx, entityName)
+	if err != nil {
+		return result, err
+	}
 	err = collection.FindOne(ctx, query).Decode(&request)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
@@ -239,16 +535,26 @@ func (r *RequestManager) GetBySignature(ctx context.Context, entityName string,
 // Update updates the Request resource and attributes and returns the updated
 // Request resource.
 func (r *RequestManager) Update(ctx context.Context, entityName string, requestID string, updatedRequest storage.Request) (result storage.Request, err error) {
+	defer classifyError(&err)
+
 	// Deny updating the entity Id
 	updatedRequest.ID = requestID
 	// Update modified time
-	updatedRequest.UpdateTime = time.Now().Unix()
+	updatedRequest.UpdateTime = timeNow(r.Clock).Unix()
+
+	err = r.checkSessionSize(entityName, updatedRequest)
+	if err != nil {
+		return result, err
+	}
 
 	// Build Query
 	selector := bson.M{
 		"id": requestID,
 	}
-	collection := r.DB.Collection(entityName)
+	collection, err := r.DB.collection(ctx, entityName)
+	if err != nil {
+		return result, err
+	}
 	res, err := collection.ReplaceOne(ctx, selector, updatedRequest)
 	if err != nil {
 		if mongo.IsDuplicateKeyError(err) {
@@ -266,11 +572,16 @@ func (r *RequestManager) Update(ctx context.Context, entityName string, requestI
 
 // Delete deletes the specified Request resource.
 func (r *RequestManager) Delete(ctx context.Context, entityName string, requestID string) (err error) {
+	defer classifyError(&err)
+
 	// Build Query
 	query := bson.M{
 		"id": requestID,
 	}
-	collection := r.DB.Collection(entityName)
+	collection, err := r.DB.collection(ctx, entityName)
+	if err != nil {
+		return err
+	}
 	res, err := collection.DeleteOne(ctx, query)
 	if err != nil {
 		return err
@@ -286,12 +597,17 @@ func (r *RequestManager) Delete(ctx context.Context, entityName string, requestI
 // DeleteBySignature deletes the specified request resource, if the presented
 // signature returns a match.
 func (r *RequestManager) DeleteBySignature(ctx context.Context, entityName string, signature string) (err error) {
+	defer classifyError(&err)
+
 	// Build Query
 	query := bson.M{
 		"signature": signature,
 	}
 
-	collection := r.DB.Collection(entityName)
+	collection, err := r.DB.collection(ctx, entityName)
+	if err != nil {
+		return err
+	}
 	res, err := collection.DeleteOne(ctx, query)
 	if err != nil {
 		return err
@@ -304,19 +620,310 @@ func (r *RequestManager) DeleteBySignature(ctx context.Context, entityName strin
 	return nil
 }
 
-// RevokeRefreshToken deletes the refresh token session.
+// DeleteBySignatureReturning deletes the specified request resource, if the
+// presented signature returns a match, and returns the deleted request. The
+// request is found and deleted in a single round trip, so concurrent callers
+// can't both observe the request before it is deleted.
+func (r *RequestManager) DeleteBySignatureReturning(ctx context.Context, entityName string, signature string) (result storage.Request, err error) {
+	defer classifyError(&err)
+
+	// Build Query
+	query := bson.M{
+		"signature": signature,
+	}
+
+	var request storage.Request
+	collection, err := r.DB.collection(ctx, entityName)
+	if err != nil {
+		return result, err
+	}
+	err = collection.FindOneAndDelete(ctx, query).Decode(&request)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return result, fosite.ErrNotFound
+		}
+		return result, err
+	}
+
+	return request, nil
+}
+
+// DeleteExpired deletes the request resources that were requested more than
+// ttl seconds ago. Returns not found if no expired requests were found.
+func (r *RequestManager) DeleteExpired(ctx context.Context, entityName string, ttl int) (err error) {
+	defer classifyError(&err)
+
+	// Build Query
+	query := bson.M{
+		"requested_at": bson.M{
+			"$lt": timeNow(r.Clock).Add(-time.Duration(ttl) * time.Second),
+		},
+	}
+
+	collection, err := r.DB.collection(ctx, entityName)
+	if err != nil {
+		return err
+	}
+	res, err := collection.DeleteMany(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return fosite.ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteByRegion deletes the request resources issued in the given region
+// across all request entities. Returns not found if no requests were issued in
+// the region.
+func (r *RequestManager) DeleteByRegion(ctx context.Context, region string) (err error) {
+	defer classifyError(&err)
+
+	if region == "" {
+		return fosite.ErrNotFound
+	}
+
+	// Build Query
+	query := bson.M{
+		"region": region,
+	}
+
+	var deleted int64
+	for _, entityName := range sessionEntities {
+		collection, err := r.DB.collection(ctx, entityName)
+		if err != nil {
+			return err
+		}
+		res, err := collection.DeleteMany(ctx, query)
+		if err != nil {
+			return err
+		}
+		deleted += res.DeletedCount
+	}
+
+	if deleted == 0 {
+		return fosite.ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteByFilter deletes the request resources matching the filter, returning
+// the number of requests deleted. The filter matches requests as List does,
+// but pagination is ignored, so every matching request is deleted. Returns
+// storage.ErrEmptyFilter if no filters are provided, rather than deleting
+// every request stored for the entity.
+func (r *RequestManager) DeleteByFilter(ctx context.Context, entityName string, filter storage.ListRequestsRequest) (deleted int64, err error) {
+	defer classifyError(&err)
+
+	if filter.IsEmpty() {
+		return 0, storage.ErrEmptyFilter
+	}
+
+	// Build Query
+	query := listRequestsQuery(filter)
+
+	collection, err := r.DB.collection(ctx, entityName)
+	if err != nil {
+		return 0, err
+	}
+	res, err := collection.DeleteMany(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.DeletedCount, nil
+}
+
+// DeleteByClientAndEntity deletes the client's request resources of the given
+// entity, returning the number of requests deleted, leaving the client's
+// requests of other entities in place. For example, deleting a client's
+// refresh tokens forces re-consent while its short-lived access tokens remain
+// valid. An empty client ID deletes nothing.
+func (r *RequestManager) DeleteByClientAndEntity(ctx context.Context, clientID string, entityName string) (deleted int64, err error) {
+	if clientID == "" {
+		return 0, nil
+	}
+
+	filter := storage.ListRequestsRequest{
+		ClientID: clientID,
+	}
+	return r.DeleteByFilter(ctx, entityName, filter)
+}
+
+// defaultPurgeBatchSize is the number of requests deleted per batch by
+// PurgeExpiredBatched if a batch size isn't provided.
+const defaultPurgeBatchSize = 1000
+
+// documentID decodes the ID mongo assigned a document.
+type documentID struct {
+	ID interface{} `bson:"_id"`
+}
+
+// PurgeExpiredBatched deletes the request resources that expired before the
+// given time, returning the number of requests deleted. Rather than deleting
+// every expired request in one operation, which can hold up the primary under
+// load, the IDs of up to batchSize expired requests are found and deleted
+// at a time, checking for cancellation between batches. Requests without a
+// known expiry are never deleted.
+//
+// If the context is cancelled, the requests deleted so far are counted, and
+// the context's error returned.
+func (r *RequestManager) PurgeExpiredBatched(ctx context.Context, entityName string, before time.Time, batchSize int) (deleted int64, err error) {
+	defer classifyError(&err)
+
+	if batchSize <= 0 {
+		batchSize = defaultPurgeBatchSize
+	}
+
+	// Build Query
+	query := bson.M{
+		"expires_at": bson.M{
+			"$lt": before,
+		},
+	}
+	findOptions := options.Find().
+		SetProjection(bson.M{"_id": 1}).
+		SetLimit(int64(batchSize))
+
+	collection, err := r.DB.collection(ctx, entityName)
+	if err != nil {
+		return deleted, err
+	}
+	for {
+		if err = ctx.Err(); err != nil {
+			return deleted, err
+		}
+
+		cursor, err := collection.Find(ctx, query, findOptions)
+		if err != nil {
+			return deleted, err
+		}
+
+		var ids bson.A
+		err = iterate(ctx, cursor, func(document documentID) error {
+			ids = append(ids, document.ID)
+			return nil
+		})
+		if err != nil {
+			return deleted, err
+		}
+		if len(ids) == 0 {
+			return deleted, nil
+		}
+
+		// Requests are only deleted if they're still expired, in case they've
+		// been updated since being found.
+		res, err := collection.DeleteMany(ctx, bson.M{
+			"_id":        bson.M{"$in": ids},
+			"expires_at": query["expires_at"],
+		})
+		if err != nil {
+			return deleted, err
+		}
+		deleted += res.DeletedCount
+
+		if len(ids) < batchSize {
+			return deleted, nil
+		}
+	}
+}
+
+// liveQuery adds a filter to the query matching requests whose tokens are live
+// at the given time, in that they're active and either unexpired or without a
+// known expiry, as storage.Request.IsLive does.
+func liveQuery(query bson.M, now time.Time) bson.M {
+	query["active"] = true
+	query["$or"] = []bson.M{
+		{"expires_at": bson.M{"$gt": now}},
+		// Tokens without a known expiry never expire.
+		{"expires_at": nil},
+	}
+
+	return query
+}
+
+// TokenCountsByClient returns the number of requests stored for the given
+// entity, keyed by client ID, in order to surface noisy clients and abandoned
+// integrations.
+//
+// If activeOnly is set, only requests whose tokens are live are counted, so
+// used and expired tokens are left out.
+func (r *RequestManager) TokenCountsByClient(ctx context.Context, entityName string, activeOnly bool) (counts map[string]int64, err error) {
+	defer classifyError(&err)
+
+	// Build Pipeline
+	pipeline := mongo.Pipeline{}
+	if activeOnly {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: liveQuery(bson.M{}, timeNow(r.Clock))}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$group", Value: bson.M{
+		"_id": "$client_id",
+		"count": bson.M{
+			"$sum": 1,
+		},
+	}}})
+
+	collection, err := r.DB.collection(ctx, entityName)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []struct {
+		ClientID string `bson:"_id"`
+		Count    int64  `bson:"count"`
+	}
+	err = cursor.All(ctx, &groups)
+	if err != nil {
+		return nil, err
+	}
+
+	counts = make(map[string]int64, len(groups))
+	for _, group := range groups {
+		counts[group.ClientID] = group.Count
+	}
+
+	return counts, nil
+}
+
+// RevokeRefreshToken deletes the refresh token session, including any used
+// refresh tokens issued under the same request.
 func (r *RequestManager) RevokeRefreshToken(ctx context.Context, requestID string) (err error) {
-	return r.revokeToken(ctx, storage.EntityRefreshTokens, requestID)
+	defer classifyError(&err)
+
+	return r.revokeToken(ctx, storage.EntityRefreshTokens, fosite.RefreshToken, requestID)
 }
 
 // RevokeAccessToken deletes the access token session.
 func (r *RequestManager) RevokeAccessToken(ctx context.Context, requestID string) (err error) {
-	return r.revokeToken(ctx, storage.EntityAccessTokens, requestID)
+	defer classifyError(&err)
+
+	return r.revokeToken(ctx, storage.EntityAccessTokens, fosite.AccessToken, requestID)
 }
 
-func (r *RequestManager) RevokeRefreshTokenMaybeGracePeriod(ctx context.Context, requestID string, signature string) error {
-	// no configuration option is available; grace period is not available with memory store
-	return r.RevokeRefreshToken(ctx, requestID)
+// RevokeRefreshTokenMaybeGracePeriod marks the refresh token as used if
+// RefreshTokenGracePeriod is set, so the token remains usable for the grace
+// period, otherwise the refresh token session is deleted.
+//
+// The request's current refresh token is marked as used along with the
+// presented token, so that fosite can store the rotated refresh token under
+// the same request ID, even if the presented token is itself within its grace
+// period.
+func (r *RequestManager) RevokeRefreshTokenMaybeGracePeriod(ctx context.Context, requestID string, signature string) (err error) {
+	defer classifyError(&err)
+
+	if r.RefreshTokenGracePeriod <= 0 {
+		return r.revokeToken(ctx, storage.EntityRefreshTokens, fosite.RefreshToken, requestID)
+	}
+
+	return r.useRefreshToken(ctx, requestID, signature)
 }
 
 func (r *RequestManager) GetPublicKey(ctx context.Context, issuer string, subject string, keyId string) (*jose.JSONWebKey, error) {
@@ -365,13 +972,29 @@ func (r *RequestManager) GetPublicKeyScopes(ctx context.Context, issuer string,
 	return nil, fosite.ErrNotFound
 }
 
-// revokeToken deletes a token based on the provided request id.
-func (r *RequestManager) revokeToken(ctx context.Context, entityName string, requestID string) (err error) {
-	err = r.Delete(ctx, entityName, requestID)
-	if err != nil && err != fosite.ErrNotFound {
-		// Note: If the token is not found, we can declare it revoked.
+// revokeToken deletes every token issued under the provided request id.
+func (r *RequestManager) revokeToken(ctx context.Context, entityName string, tokenType fosite.TokenType, requestID string) (err error) {
+	// Build Query
+	query := bson.M{
+		"id": requestID,
+	}
+
+	collection, err := r.DB.collection(ctx, entityName)
+	if err != nil {
 		return err
 	}
+	res, err := collection.DeleteMany(ctx, query)
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		// Note: If the token is not found, we can declare it revoked.
+		return nil
+	}
+
+	r.incCounter(MetricTokensRevoked, map[string]string{
+		LabelTokenType: string(tokenType),
+	})
 
 	return nil
 }
@@ -380,20 +1003,49 @@ func (r *RequestManager) revokeToken(ctx context.Context, entityName string, req
 // Signature is a hash that relates to the underlying request method and may not
 // be a strict 'signature', for example, authorization code grant passes in an
 // authorization code.
-func toMongo(signature string, r fosite.Requester) storage.Request {
-	session, _ := json.Marshal(r.GetSession())
-	return storage.Request{
-		ID:                r.GetID(),
-		RequestedAt:       r.GetRequestedAt(),
-		Signature:         signature,
-		ClientID:          r.GetClient().GetID(),
-		UserID:            r.GetSession().GetSubject(),
-		RequestedScope:    r.GetRequestedScopes(),
-		GrantedScope:      r.GetGrantedScopes(),
-		RequestedAudience: r.GetRequestedAudience(),
-		GrantedAudience:   r.GetGrantedAudience(),
-		Form:              r.GetRequestForm(),
-		Active:            true,
-		Session:           session,
+// Request metadata stashed in the context via WithRequestMetadata is recorded
+// against the request.
+func toMongo(ctx context.Context, signature string, r fosite.Requester, tokenType fosite.TokenType) storage.Request {
+	request := storage.NewRequestFromRequester(signature, r, tokenType)
+
+	metadata := requestMetadataFromContext(ctx)
+	request.RemoteIP = metadata.RemoteIP
+	request.UserAgent = metadata.UserAgent
+
+	return request
+}
+
+// createSession stores the session request, returning whether it was created.
+// Sessions are created idempotently, so that token creation can be safely
+// retried, in that storing a session whose signature is already held by a
+// request with the same ID succeeds without storing a duplicate. Otherwise,
+// storage.ErrResourceExists is returned.
+func (r *RequestManager) createSession(ctx context.Context, entityName string, request storage.Request) (created bool, err error) {
+	_, err = r.Create(ctx, entityName, request)
+	if err == nil {
+		return true, nil
+	}
+	if err != storage.ErrResourceExists || request.ID == "" {
+		return false, err
 	}
+
+	existing, err := r.GetBySignature(ctx, entityName, request.Signature)
+	if err != nil || existing.ID != request.ID {
+		return false, storage.ErrResourceExists
+	}
+
+	return false, nil
+}
+
+// newRequest transforms a fosite.Request to a storage.Request, as toMongo
+// does, filtering the form data and extracting the session's custom claims if
+// configured.
+func (r *RequestManager) newRequest(ctx context.Context, signature string, requester fosite.Requester, tokenType fosite.TokenType) storage.Request {
+	request := toMongo(ctx, signature, requester, tokenType)
+	request.FilterForm(r.FormKeys, r.RedactedFormKeys)
+	if r.ClaimsExtractor != nil && requester.GetSession() != nil {
+		request.Claims = r.ClaimsExtractor(requester.GetSession())
+	}
+
+	return request
 }
@@ -0,0 +1,175 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	// External Imports
+	"github.com/ory/fosite"
+	"go.mongodb.org/mongo-driver/bson"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+func TestToMongo_ShouldSetCodeChallenge(t *testing.T) {
+	request := fosite.NewRequest()
+	request.Client = &storage.Client{ID: "client"}
+	request.Session = &fosite.DefaultSession{Subject: "subject"}
+	request.Form.Set("code_challenge", "challenge")
+	request.Form.Set("code_challenge_method", "S256")
+
+	got := toMongo(context.Background(), "signature", request, fosite.AccessToken)
+	if got.CodeChallenge != "challenge" {
+		t.Errorf("code challenge = %q, want %q", got.CodeChallenge, "challenge")
+	}
+	if got.CodeChallengeMethod != "S256" {
+		t.Errorf("code challenge method = %q, want %q", got.CodeChallengeMethod, "S256")
+	}
+}
+
+func TestToMongo_ShouldSetRequestMetadata(t *testing.T) {
+	request := fosite.NewRequest()
+	request.Client = &storage.Client{ID: "client"}
+	request.Session = &fosite.DefaultSession{Subject: "subject"}
+
+	got := toMongo(context.Background(), "signature", request, fosite.AccessToken)
+	if got.RemoteIP != "" || got.UserAgent != "" {
+		t.Errorf("request metadata should be empty when not provided, got: %q, %q", got.RemoteIP, got.UserAgent)
+	}
+
+	ctx := WithRequestMetadata(context.Background(), "203.0.113.7", "curl/8.4.0")
+	got = toMongo(ctx, "signature", request, fosite.AccessToken)
+	if got.RemoteIP != "203.0.113.7" {
+		t.Errorf("remote ip = %q, want %q", got.RemoteIP, "203.0.113.7")
+	}
+	if got.UserAgent != "curl/8.4.0" {
+		t.Errorf("user agent = %q, want %q", got.UserAgent, "curl/8.4.0")
+	}
+}
+
+func TestRequestManager_signatureIndex(t *testing.T) {
+	tests := []struct {
+		name             string
+		signatureIndexes map[string]SignatureIndex
+		entityName       string
+		wantName         string
+		wantUnique       bool
+	}{
+		{
+			name:       "should hash access tokens by default",
+			entityName: storage.EntityAccessTokens,
+			wantName:   IdxSignatureIDHashed,
+		},
+		{
+			name:       "should uniquely index refresh tokens by default",
+			entityName: storage.EntityRefreshTokens,
+			wantName:   IdxSignatureID,
+			wantUnique: true,
+		},
+		{
+			name:             "should hash configured refresh tokens",
+			signatureIndexes: map[string]SignatureIndex{storage.EntityRefreshTokens: SignatureIndexHashed},
+			entityName:       storage.EntityRefreshTokens,
+			wantName:         IdxSignatureIDHashed,
+		},
+		{
+			name:             "should uniquely index configured access tokens",
+			signatureIndexes: map[string]SignatureIndex{storage.EntityAccessTokens: SignatureIndexUnique},
+			entityName:       storage.EntityAccessTokens,
+			wantName:         IdxSignatureID,
+			wantUnique:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &RequestManager{SignatureIndexes: tt.signatureIndexes}
+			got := r.signatureIndex(tt.entityName)
+			if got.Options == nil || got.Options.Name == nil || *got.Options.Name != tt.wantName {
+				t.Fatalf("signature index should be named %s, got: %+v", tt.wantName, got.Options)
+			}
+
+			unique := got.Options.Unique != nil && *got.Options.Unique
+			if unique != tt.wantUnique {
+				t.Errorf("signature index unique = %t, want %t", unique, tt.wantUnique)
+			}
+		})
+	}
+}
+
+func TestRequestManager_Create_ShouldRejectOversizedSessions(t *testing.T) {
+	// The session is rejected before the database is used.
+	r := &RequestManager{MaxSessionSize: 16}
+
+	_, err := r.Create(context.Background(), storage.EntityAccessTokens, storage.Request{Session: make([]byte, 17)})
+	if !errors.Is(err, storage.ErrSessionTooLarge) {
+		t.Errorf("Create() error = %v, want %v", err, storage.ErrSessionTooLarge)
+	}
+
+	_, err = r.Update(context.Background(), storage.EntityAccessTokens, "request", storage.Request{Session: make([]byte, 17)})
+	if !errors.Is(err, storage.ErrSessionTooLarge) {
+		t.Errorf("Update() error = %v, want %v", err, storage.ErrSessionTooLarge)
+	}
+}
+
+func TestRequestManager_checkSessionSize(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxSessionSize int
+		sessionSize    int
+		want           error
+	}{
+		{
+			name:        "should accept sessions within the default maximum",
+			sessionSize: defaultMaxSessionSize,
+		},
+		{
+			name:        "should reject sessions exceeding the default maximum",
+			sessionSize: defaultMaxSessionSize + 1,
+			want:        storage.ErrSessionTooLarge,
+		},
+		{
+			name:           "should accept sessions within the configured maximum",
+			maxSessionSize: 1024,
+			sessionSize:    1024,
+		},
+		{
+			name:           "should reject sessions exceeding the configured maximum",
+			maxSessionSize: 1024,
+			sessionSize:    1025,
+			want:           storage.ErrSessionTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &RequestManager{MaxSessionSize: tt.maxSessionSize}
+			err := r.checkSessionSize(storage.EntityAccessTokens, storage.Request{Session: make([]byte, tt.sessionSize)})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("checkSessionSize() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestListRequestsQuery_ShouldCombineScopeFilters(t *testing.T) {
+	filter := storage.ListRequestsRequest{
+		ScopesIntersection: []string{"read", "write"},
+		ScopesUnion:        []string{"read"},
+		GrantedScopesUnion: []string{"write"},
+	}
+
+	expected := bson.M{
+		"$and": []bson.M{
+			{"scopes": bson.M{"$all": []string{"read", "write"}}},
+			{"scopes": bson.M{"$in": []string{"read"}}},
+			{"granted_scopes": bson.M{"$in": []string{"write"}}},
+		},
+	}
+	got := listRequestsQuery(filter)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("listRequestsQuery() = %v, want %v", got, expected)
+	}
+}
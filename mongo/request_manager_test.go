@@ -0,0 +1,533 @@
+package mongo_test
+
+import (
+	// Standard Library Imports
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	// External Imports
+	"github.com/google/uuid"
+	"github.com/ory/fosite"
+	"go.mongodb.org/mongo-driver/bson"
+	mongodriver "go.mongodb.org/mongo-driver/mongo"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+	"github.com/p000ic/go-fosite-mongo/mongo"
+)
+
+func TestRequestManager_Create_ShouldUseIDGenerator(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.IDGenerator = sequentialIDs("req_")
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	request := storage.NewRequest()
+	request.ID = ""
+	request.Signature = uuid.NewString()
+
+	got, err := store.RequestManager.Create(ctx, storage.EntityRefreshTokens, request)
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+	if got.ID != "req_1" {
+		AssertError(t, got.ID, "req_1", "create should use the configured id generator")
+	}
+}
+
+// indexSpecifications returns the indexes on the given entity's collection,
+// keyed by index name.
+func indexSpecifications(ctx context.Context, t *testing.T, store *mongo.Store, entityName string) map[string]*mongodriver.IndexSpecification {
+	specs, err := store.DB.Collection(entityName).Indexes().ListSpecifications(ctx)
+	if err != nil {
+		AssertFatal(t, err, nil, "list indexes should return no database errors")
+	}
+
+	indexes := map[string]*mongodriver.IndexSpecification{}
+	for _, spec := range specs {
+		indexes[spec.Name] = spec
+	}
+	return indexes
+}
+
+func TestRequestManager_Configure_ShouldCreateSessionIndexes(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	entities := []string{
+		storage.EntityAccessTokens,
+		storage.EntityAuthorizationCodes,
+		storage.EntityOpenIDSessions,
+		storage.EntityPKCESessions,
+		storage.EntityRefreshTokens,
+	}
+	for _, entityName := range entities {
+		indexes := indexSpecifications(ctx, t, store, entityName)
+
+		sessionIdx, ok := indexes[mongo.IdxSessionID]
+		if !ok {
+			AssertError(t, indexes, mongo.IdxSessionID, "session id index should exist on "+entityName)
+		} else if sessionIdx.Unique == nil || !*sessionIdx.Unique {
+			AssertError(t, sessionIdx.Unique, true, "session id index should be unique on "+entityName)
+		}
+
+		requesterIdx, ok := indexes[mongo.IdxCompoundRequester]
+		if !ok {
+			AssertError(t, indexes, mongo.IdxCompoundRequester, "compound requester index should exist on "+entityName)
+			continue
+		}
+		expected := bson.D{{Key: "client_id", Value: int32(1)}, {Key: "user_id", Value: int32(1)}}
+		var got bson.D
+		if err := bson.Unmarshal(requesterIdx.KeysDocument, &got); err != nil {
+			AssertFatal(t, err, nil, "index keys should decode")
+		}
+		if !reflect.DeepEqual(got, expected) {
+			AssertError(t, got, expected, "compound requester index should cover client_id and user_id on "+entityName)
+		}
+
+		if _, ok := indexes[mongo.IdxCompoundRequestedAt]; !ok {
+			AssertError(t, indexes, mongo.IdxCompoundRequestedAt, "compound requested at index should exist on "+entityName)
+		}
+	}
+}
+
+func TestRequestManager_Configure_ShouldCreateSignatureIndexes(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	indexes := indexSpecifications(ctx, t, store, storage.EntityAccessTokens)
+	hashedIdx, ok := indexes[mongo.IdxSignatureIDHashed]
+	if !ok {
+		AssertFatal(t, indexes, mongo.IdxSignatureIDHashed, "hashed signature index should exist on access tokens")
+	}
+	expected := bson.D{{Key: "signature", Value: "hashed"}}
+	var got bson.D
+	if err := bson.Unmarshal(hashedIdx.KeysDocument, &got); err != nil {
+		AssertFatal(t, err, nil, "index keys should decode")
+	}
+	if !reflect.DeepEqual(got, expected) {
+		AssertError(t, got, expected, "access token signatures should use a hashed index")
+	}
+	if _, ok := indexes[mongo.IdxSignatureID]; ok {
+		AssertError(t, indexes, mongo.IdxSignatureID, "access tokens should not use a unique signature index")
+	}
+
+	entities := []string{
+		storage.EntityAuthorizationCodes,
+		storage.EntityOpenIDSessions,
+		storage.EntityPKCESessions,
+		storage.EntityRefreshTokens,
+	}
+	for _, entityName := range entities {
+		indexes := indexSpecifications(ctx, t, store, entityName)
+		signatureIdx, ok := indexes[mongo.IdxSignatureID]
+		if !ok {
+			AssertError(t, indexes, mongo.IdxSignatureID, "signature index should exist on "+entityName)
+			continue
+		}
+		if signatureIdx.Unique == nil || !*signatureIdx.Unique {
+			AssertError(t, signatureIdx.Unique, true, "signature index should be unique on "+entityName)
+		}
+	}
+}
+
+func TestRequestManager_Configure_ShouldCreateConfiguredSignatureIndexes(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.SignatureIndexes = map[string]string{
+		storage.EntityAccessTokens:  string(mongo.SignatureIndexUnique),
+		storage.EntityRefreshTokens: string(mongo.SignatureIndexHashed),
+	}
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	expected := map[string]string{
+		storage.EntityAccessTokens:       mongo.IdxSignatureID,
+		storage.EntityAuthorizationCodes: mongo.IdxSignatureID,
+		storage.EntityOpenIDSessions:     mongo.IdxSignatureID,
+		storage.EntityPKCESessions:       mongo.IdxSignatureID,
+		storage.EntityRefreshTokens:      mongo.IdxSignatureIDHashed,
+	}
+	for entityName, idxName := range expected {
+		indexes := indexSpecifications(ctx, t, store, entityName)
+		signatureIdx, ok := indexes[idxName]
+		if !ok {
+			AssertError(t, indexes, idxName, "signature index should exist on "+entityName)
+			continue
+		}
+
+		unique := signatureIdx.Unique != nil && *signatureIdx.Unique
+		if unique != (idxName == mongo.IdxSignatureID) {
+			AssertError(t, unique, idxName == mongo.IdxSignatureID, "signature index uniqueness should match the configured index on "+entityName)
+		}
+	}
+}
+
+func TestRequestManager_Create_ShouldTagRegion(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.Region = "eu-west-1"
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	clientID := uuid.NewString()
+	err := store.CreateAccessTokenSession(ctx, uuid.NewString(), newRequester(clientID, uuid.NewString()))
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	got, err := store.RequestManager.List(ctx, storage.EntityAccessTokens, storage.ListRequestsRequest{
+		ClientID: clientID,
+		Region:   "eu-west-1",
+	})
+	if err != nil {
+		AssertFatal(t, err, nil, "list should return no database errors")
+	}
+	if len(got) != 1 {
+		AssertFatal(t, len(got), 1, "list should return the access token issued in the region")
+	}
+	if got[0].Region != "eu-west-1" {
+		AssertError(t, got[0].Region, "eu-west-1", "the request should be tagged with the configured region")
+	}
+
+	got, err = store.RequestManager.List(ctx, storage.EntityAccessTokens, storage.ListRequestsRequest{
+		ClientID: clientID,
+		Region:   "us-east-1",
+	})
+	if err != nil {
+		AssertFatal(t, err, nil, "list should return no database errors")
+	}
+	if len(got) != 0 {
+		AssertError(t, len(got), 0, "list should not return access tokens issued in other regions")
+	}
+}
+
+func TestRequestManager_DeleteByRegion(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	region := uuid.NewString()
+	otherRegion := uuid.NewString()
+	for _, r := range []string{region, otherRegion} {
+		for _, entityName := range []string{storage.EntityAccessTokens, storage.EntityRefreshTokens} {
+			request := storage.NewRequest()
+			request.Signature = uuid.NewString()
+			request.Region = r
+			_, err := store.RequestManager.Create(ctx, entityName, request)
+			if err != nil {
+				AssertFatal(t, err, nil, "create should return no database errors")
+			}
+		}
+	}
+
+	err := store.RequestManager.DeleteByRegion(ctx, region)
+	if err != nil {
+		AssertFatal(t, err, nil, "delete by region should return no database errors")
+	}
+
+	for _, entityName := range []string{storage.EntityAccessTokens, storage.EntityRefreshTokens} {
+		got, err := store.RequestManager.List(ctx, entityName, storage.ListRequestsRequest{Region: region})
+		if err != nil {
+			AssertFatal(t, err, nil, "list should return no database errors")
+		}
+		if len(got) != 0 {
+			AssertError(t, len(got), 0, "requests issued in the region should be deleted from "+entityName)
+		}
+
+		got, err = store.RequestManager.List(ctx, entityName, storage.ListRequestsRequest{Region: otherRegion})
+		if err != nil {
+			AssertFatal(t, err, nil, "list should return no database errors")
+		}
+		if len(got) != 1 {
+			AssertError(t, len(got), 1, "requests issued in other regions should be kept in "+entityName)
+		}
+	}
+
+	err = store.RequestManager.DeleteByRegion(ctx, region)
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "delete by region should return not found once purged")
+	}
+}
+
+func TestRequestManager_TokenCountsByClient(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.RefreshTokenGracePeriod = time.Minute
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	clientA := uuid.NewString()
+	clientB := uuid.NewString()
+	expired := time.Now().Add(-time.Minute)
+
+	// Access tokens are deleted on revocation, so are only left out of the
+	// live counts once expired.
+	for _, clientID := range []string{clientA, clientA, clientB} {
+		err := store.CreateAccessTokenSession(ctx, uuid.NewString(), newRequester(clientID, uuid.NewString()))
+		if err != nil {
+			AssertFatal(t, err, nil, "create access token session should return no database errors")
+		}
+	}
+	request := newRequester(clientA, uuid.NewString())
+	request.Session.SetExpiresAt(fosite.AccessToken, expired)
+	err := store.CreateAccessTokenSession(ctx, uuid.NewString(), request)
+	if err != nil {
+		AssertFatal(t, err, nil, "create access token session should return no database errors")
+	}
+	request = newRequester(clientB, uuid.NewString())
+	err = store.CreateAccessTokenSession(ctx, uuid.NewString(), request)
+	if err != nil {
+		AssertFatal(t, err, nil, "create access token session should return no database errors")
+	}
+	err = store.RevokeAccessToken(ctx, request.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "revoke access token should return no database errors")
+	}
+
+	// Refresh tokens are left out of the live counts once used or expired.
+	err = store.CreateRefreshTokenSession(ctx, uuid.NewString(), newRequester(clientA, uuid.NewString()))
+	if err != nil {
+		AssertFatal(t, err, nil, "create refresh token session should return no database errors")
+	}
+	request = newRequester(clientA, uuid.NewString())
+	signature := uuid.NewString()
+	err = store.CreateRefreshTokenSession(ctx, signature, request)
+	if err != nil {
+		AssertFatal(t, err, nil, "create refresh token session should return no database errors")
+	}
+	err = store.RevokeRefreshTokenMaybeGracePeriod(ctx, request.ID, signature)
+	if err != nil {
+		AssertFatal(t, err, nil, "revoke refresh token should return no database errors")
+	}
+	request = newRequester(clientB, uuid.NewString())
+	request.Session.SetExpiresAt(fosite.RefreshToken, expired)
+	err = store.CreateRefreshTokenSession(ctx, uuid.NewString(), request)
+	if err != nil {
+		AssertFatal(t, err, nil, "create refresh token session should return no database errors")
+	}
+
+	requests := store.RequestManager.(*mongo.RequestManager)
+	got, err := requests.TokenCountsByClient(ctx, storage.EntityAccessTokens, false)
+	if err != nil {
+		AssertFatal(t, err, nil, "token counts by client should return no database errors")
+	}
+	expected := map[string]int64{clientA: 3, clientB: 1}
+	if !reflect.DeepEqual(got, expected) {
+		AssertError(t, got, expected, "token counts should be grouped by client")
+	}
+
+	got, err = requests.TokenCountsByClient(ctx, storage.EntityAccessTokens, true)
+	if err != nil {
+		AssertFatal(t, err, nil, "token counts by client should return no database errors")
+	}
+	expected = map[string]int64{clientA: 2, clientB: 1}
+	if !reflect.DeepEqual(got, expected) {
+		AssertError(t, got, expected, "token counts should only include unexpired access tokens")
+	}
+
+	got, err = requests.TokenCountsByClient(ctx, storage.EntityRefreshTokens, false)
+	if err != nil {
+		AssertFatal(t, err, nil, "token counts by client should return no database errors")
+	}
+	expected = map[string]int64{clientA: 2, clientB: 1}
+	if !reflect.DeepEqual(got, expected) {
+		AssertError(t, got, expected, "token counts should include used and expired refresh tokens")
+	}
+
+	got, err = requests.TokenCountsByClient(ctx, storage.EntityRefreshTokens, true)
+	if err != nil {
+		AssertFatal(t, err, nil, "token counts by client should return no database errors")
+	}
+	expected = map[string]int64{clientA: 1}
+	if !reflect.DeepEqual(got, expected) {
+		AssertError(t, got, expected, "token counts should only include live refresh tokens")
+	}
+
+	got, err = requests.TokenCountsByClient(ctx, storage.EntityAuthorizationCodes, false)
+	if err != nil {
+		AssertFatal(t, err, nil, "token counts by client should return no database errors")
+	}
+	if len(got) != 0 {
+		AssertError(t, got, map[string]int64{}, "token counts should be empty when no tokens are stored")
+	}
+}
+
+func TestRequestManager_ListExpiringBefore(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	before := now.Add(5 * time.Minute)
+	clientID := uuid.NewString()
+	expiries := []time.Time{
+		now.Add(4 * time.Minute),
+		now.Add(time.Minute),
+		before,
+		now.Add(10 * time.Minute),
+		{},
+	}
+	for _, expiresAt := range expiries {
+		request := storage.NewRequest()
+		request.Signature = uuid.NewString()
+		request.ClientID = clientID
+		request.ExpiresAt = expiresAt
+		_, err := store.RequestManager.Create(ctx, storage.EntityAccessTokens, request)
+		if err != nil {
+			AssertFatal(t, err, nil, "create should return no database errors")
+		}
+	}
+
+	filter := storage.ListRequestsRequest{ClientID: clientID}
+	got, err := store.RequestManager.ListExpiringBefore(ctx, storage.EntityAccessTokens, before, filter)
+	if err != nil {
+		AssertFatal(t, err, nil, "list expiring before should return no database errors")
+	}
+	if len(got) != 2 {
+		AssertFatal(t, len(got), 2, "list expiring before should only return requests expiring within the window")
+	}
+	if !got[0].ExpiresAt.Equal(expiries[1]) || !got[1].ExpiresAt.Equal(expiries[0]) {
+		AssertError(t, []time.Time{got[0].ExpiresAt, got[1].ExpiresAt}, []time.Time{expiries[1], expiries[0]}, "list expiring before should return the soonest expiring first")
+	}
+
+	filter.Offset = 1
+	filter.Limit = 1
+	got, err = store.RequestManager.ListExpiringBefore(ctx, storage.EntityAccessTokens, before, filter)
+	if err != nil {
+		AssertFatal(t, err, nil, "list expiring before should return no database errors")
+	}
+	if len(got) != 1 || !got[0].ExpiresAt.Equal(expiries[0]) {
+		AssertError(t, got, expiries[0], "list expiring before should respect pagination")
+	}
+}
+
+func TestRequestManager_List_ShouldPageAfter(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	requestedAt := time.Now().UTC().Truncate(time.Millisecond)
+	clientID := uuid.NewString()
+	create := func(id string, requestedAt time.Time) {
+		request := storage.NewRequest()
+		request.ID = id
+		request.Signature = uuid.NewString()
+		request.ClientID = clientID
+		request.RequestedAt = requestedAt
+		_, err := store.RequestManager.Create(ctx, storage.EntityAccessTokens, request)
+		if err != nil {
+			AssertFatal(t, err, nil, "create should return no database errors")
+		}
+	}
+	for _, id := range []string{"d", "b", "a", "c"} {
+		create(clientID+"-"+id, requestedAt)
+	}
+
+	filter := storage.ListRequestsRequest{ClientID: clientID, Limit: 2}
+	var pages [][]string
+	for {
+		got, err := store.RequestManager.List(ctx, storage.EntityAccessTokens, filter)
+		if err != nil {
+			AssertFatal(t, err, nil, "list should return no database errors")
+		}
+		if len(got) == 0 {
+			break
+		}
+
+		var page []string
+		for _, request := range got {
+			page = append(page, strings.TrimPrefix(request.ID, clientID+"-"))
+		}
+		pages = append(pages, page)
+		filter.After = got[len(got)-1].NextAfter()
+
+		if len(pages) == 1 {
+			// Requests landing before and after the cursor between pages.
+			create(clientID+"-0", requestedAt)
+			create(clientID+"-e", requestedAt.Add(time.Millisecond))
+		}
+	}
+
+	expected := [][]string{{"a", "b"}, {"c", "d"}, {"e"}}
+	if !reflect.DeepEqual(pages, expected) {
+		AssertError(t, pages, expected, "list should page after the cursor without duplicates or gaps")
+	}
+}
+
+func TestRequestManager_DeleteBySignatureReturning(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	request := storage.NewRequest()
+	request.Signature = uuid.NewString()
+	request.ClientID = uuid.NewString()
+	request.UserID = uuid.NewString()
+	created, err := store.RequestManager.Create(ctx, storage.EntityAccessTokens, request)
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	got, err := store.RequestManager.DeleteBySignatureReturning(ctx, storage.EntityAccessTokens, request.Signature)
+	if err != nil {
+		AssertFatal(t, err, nil, "delete by signature returning should return no database errors")
+	}
+	if got.ID != created.ID || got.Signature != created.Signature || got.ClientID != created.ClientID || got.UserID != created.UserID {
+		AssertError(t, got, created, "delete by signature returning should return the deleted request")
+	}
+
+	_, err = store.RequestManager.Get(ctx, storage.EntityAccessTokens, created.ID)
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "request should be deleted")
+	}
+}
+
+func TestRequestManager_DeleteBySignatureReturning_ShouldReturnNotFound(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	_, err := store.RequestManager.DeleteBySignatureReturning(ctx, storage.EntityAccessTokens, uuid.NewString())
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "delete by signature returning should return not found")
+	}
+}
+
+func TestRequestManager_RedactedFormKeys_ShouldNotStoreRedactedKeys(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.RedactedFormKeys = []string{"client_secret", "code_verifier"}
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	client, err := store.ClientManager.Create(ctx, storage.Client{ID: uuid.NewString(), Secret: "foobar"})
+	if err != nil {
+		AssertFatal(t, err, nil, "create client should return no database errors")
+	}
+
+	request := newRequester(client.ID, uuid.NewString())
+	request.Form.Set("grant_type", "authorization_code")
+	request.Form.Set("client_secret", "foobar")
+	request.Form.Set("code_verifier", uuid.NewString())
+	signature := uuid.NewString()
+	err = store.CreateAccessTokenSession(ctx, signature, request)
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	stored, err := store.RequestManager.(*mongo.RequestManager).GetBySignature(ctx, storage.EntityAccessTokens, signature)
+	if err != nil {
+		AssertFatal(t, err, nil, "get by signature should return no database errors")
+	}
+	for _, key := range []string{"client_secret", "code_verifier"} {
+		if _, ok := stored.Form[key]; ok {
+			AssertError(t, stored.Form, key, "stored form should not hold redacted keys")
+		}
+	}
+	if got := stored.Form.Get("grant_type"); got != "authorization_code" {
+		AssertError(t, got, "authorization_code", "stored form should hold unredacted keys")
+	}
+
+	got, err := store.GetAccessTokenSession(ctx, signature, &fosite.DefaultSession{})
+	if err != nil {
+		AssertFatal(t, err, nil, "get should return no database errors")
+	}
+	if got.GetSession().GetSubject() != request.GetSession().GetSubject() {
+		AssertError(t, got.GetSession().GetSubject(), request.GetSession().GetSubject(), "session should round-trip")
+	}
+}
@@ -12,19 +12,33 @@ import (
 
 // CreateAccessTokenSession creates a new session for an Access Token
 func (r *RequestManager) CreateAccessTokenSession(ctx context.Context, signature string, request fosite.Requester) (err error) {
+	defer classifyError(&err)
+
 	// Store session request
-	_, err = r.Create(ctx, storage.EntityAccessTokens, toMongo(signature, request))
+	created, err := r.createSession(ctx, storage.EntityAccessTokens, r.newRequest(ctx, signature, request, fosite.AccessToken))
 	if err != nil {
 		if err == storage.ErrResourceExists {
 			return err
 		}
 		return err
 	}
-	return err
+	if !created {
+		// The session has already been stored by a previous attempt.
+		return nil
+	}
+
+	r.incCounter(MetricTokensIssued, map[string]string{
+		LabelTokenType: string(fosite.AccessToken),
+		LabelGrantType: grantTypeFromRequest(request),
+	})
+
+	return nil
 }
 
 // GetAccessTokenSession returns a session if it can be found by signature
 func (r *RequestManager) GetAccessTokenSession(ctx context.Context, signature string, session fosite.Session) (request fosite.Requester, err error) {
+	defer classifyError(&err)
+
 	// Copy a new DB session if none specified
 	_, ok := ContextToSession(ctx)
 	if !ok {
@@ -56,8 +70,26 @@ func (r *RequestManager) GetAccessTokenSession(ctx context.Context, signature st
 	return request, err
 }
 
+// GetAccessTokenSessionForAudience returns the access token session, if the
+// token was granted the audience, otherwise storage.ErrAudienceMismatch is
+// returned.
+func (r *RequestManager) GetAccessTokenSessionForAudience(ctx context.Context, signature string, audience string, session fosite.Session) (request fosite.Requester, err error) {
+	request, err = r.GetAccessTokenSession(ctx, signature, session)
+	if err != nil {
+		return nil, err
+	}
+
+	if !request.GetGrantedAudience().Has(audience) {
+		return nil, storage.ErrAudienceMismatch
+	}
+
+	return request, nil
+}
+
 // DeleteAccessTokenSession removes an Access Token's session
 func (r *RequestManager) DeleteAccessTokenSession(ctx context.Context, signature string) (err error) {
+	defer classifyError(&err)
+
 	// Remove session request
 	err = r.DeleteBySignature(ctx, storage.EntityAccessTokens, signature)
 	if err != nil {
@@ -0,0 +1,227 @@
+package mongo_test
+
+import (
+	// Standard Library Imports
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	// External Imports
+	"github.com/google/uuid"
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/handler/oauth2"
+	"github.com/ory/fosite/handler/openid"
+	"github.com/ory/fosite/token/jwt"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+	"github.com/p000ic/go-fosite-mongo/mongo"
+)
+
+func TestRequestManager_CreateAccessTokenSession_ShouldStoreCertificateBinding(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	clientID := uuid.NewString()
+	subject := uuid.NewString()
+	thumbprint := "bwcK0esc3ACC3DB2Y5_lESsXE8o9ltc05O89jdN-dg2"
+
+	session := &oauth2.JWTSession{
+		JWTClaims: &jwt.JWTClaims{
+			Subject: subject,
+			Extra: map[string]interface{}{
+				"cnf": map[string]interface{}{
+					"x5t#S256": thumbprint,
+				},
+			},
+		},
+		Subject: subject,
+	}
+	request := newRequester(clientID, subject)
+	request.Session = session
+
+	err := store.CreateAccessTokenSession(ctx, uuid.NewString(), request)
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	got, err := store.RequestManager.List(ctx, storage.EntityAccessTokens, storage.ListRequestsRequest{ClientID: clientID})
+	if err != nil {
+		AssertFatal(t, err, nil, "list should return no database errors")
+	}
+	if len(got) != 1 {
+		AssertFatal(t, len(got), 1, "list should return the created access token")
+	}
+
+	expected := &storage.Confirmation{X5tS256: thumbprint}
+	if !reflect.DeepEqual(got[0].Confirmation, expected) {
+		AssertError(t, got[0].Confirmation, expected, "certificate thumbprint confirmation should round-trip")
+	}
+}
+
+func TestRequestManager_CreateAccessTokenSession_ShouldStoreDPoPBinding(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	clientID := uuid.NewString()
+	subject := uuid.NewString()
+	thumbprint := "0ZcOCORZNYy-DWpqq30jZyJGHTN0d2HglBV3uiguA4I"
+
+	session := openid.NewDefaultSession()
+	session.Subject = subject
+	session.Claims.Extra["cnf"] = map[string]interface{}{
+		"jkt": thumbprint,
+	}
+	request := newRequester(clientID, subject)
+	request.Session = session
+
+	err := store.CreateAccessTokenSession(ctx, uuid.NewString(), request)
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	got, err := store.RequestManager.List(ctx, storage.EntityAccessTokens, storage.ListRequestsRequest{ClientID: clientID})
+	if err != nil {
+		AssertFatal(t, err, nil, "list should return no database errors")
+	}
+	if len(got) != 1 {
+		AssertFatal(t, len(got), 1, "list should return the created access token")
+	}
+
+	expected := &storage.Confirmation{JKT: thumbprint}
+	if !reflect.DeepEqual(got[0].Confirmation, expected) {
+		AssertError(t, got[0].Confirmation, expected, "DPoP key thumbprint confirmation should round-trip")
+	}
+}
+
+func TestRequestManager_CreateAccessTokenSession_ShouldNotStoreEmptyBinding(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	clientID := uuid.NewString()
+	err := store.CreateAccessTokenSession(ctx, uuid.NewString(), newRequester(clientID, uuid.NewString()))
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	got, err := store.RequestManager.List(ctx, storage.EntityAccessTokens, storage.ListRequestsRequest{ClientID: clientID})
+	if err != nil {
+		AssertFatal(t, err, nil, "list should return no database errors")
+	}
+	if len(got) != 1 {
+		AssertFatal(t, len(got), 1, "list should return the created access token")
+	}
+	if got[0].Confirmation != nil {
+		AssertError(t, got[0].Confirmation, nil, "unbound tokens should not store a confirmation")
+	}
+}
+
+func TestRequestManager_GetAccessTokenSession_ShouldReadOwnWrites(t *testing.T) {
+	// The store's sessions are causally consistent, so a read following a
+	// write within the same session observes the write, even if the read is
+	// routed to a secondary.
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	client := createClient(ctx, t, store)
+	signature := uuid.NewString()
+	request := newRequester(client.ID, uuid.NewString())
+
+	err := store.CreateAccessTokenSession(ctx, signature, request)
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	got, err := store.GetAccessTokenSession(ctx, signature, &fosite.DefaultSession{})
+	if err != nil {
+		AssertFatal(t, err, nil, "get should observe the write made within the same session")
+	}
+	if got.GetID() != request.ID {
+		AssertError(t, got.GetID(), request.ID, "get should return the access token created within the same session")
+	}
+}
+
+func TestRequestManager_CreateAccessTokenSession_ShouldStoreRequestMetadata(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	subject := uuid.NewString()
+	metadataCtx := mongo.WithRequestMetadata(ctx, "203.0.113.7", "curl/8.4.0")
+	err := store.CreateAccessTokenSession(metadataCtx, uuid.NewString(), newRequester(uuid.NewString(), subject))
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	got, err := store.RequestManager.List(ctx, storage.EntityAccessTokens, storage.ListRequestsRequest{UserID: subject})
+	if err != nil {
+		AssertFatal(t, err, nil, "list should return no database errors")
+	}
+	if len(got) != 1 {
+		AssertFatal(t, len(got), 1, "list should return the created access token")
+	}
+	if got[0].RemoteIP != "203.0.113.7" {
+		AssertError(t, got[0].RemoteIP, "203.0.113.7", "the remote ip should be stored")
+	}
+	if got[0].UserAgent != "curl/8.4.0" {
+		AssertError(t, got[0].UserAgent, "curl/8.4.0", "the user agent should be stored")
+	}
+}
+
+func TestRequestManager_CreateAccessTokenSession_ShouldRejectOversizedSessions(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.MaxSessionSize = 1024
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	subject := uuid.NewString()
+	request := newRequester(uuid.NewString(), subject)
+	request.Session = &fosite.DefaultSession{
+		Subject: subject,
+		Extra: map[string]interface{}{
+			"claims": strings.Repeat("x", 2048),
+		},
+	}
+
+	signature := uuid.NewString()
+	err := store.CreateAccessTokenSession(ctx, signature, request)
+	if !errors.Is(err, storage.ErrSessionTooLarge) {
+		AssertError(t, err, storage.ErrSessionTooLarge, "oversized sessions should be rejected")
+	}
+
+	_, err = store.GetAccessTokenSession(ctx, signature, &fosite.DefaultSession{})
+	if !errors.Is(err, fosite.ErrNotFound) {
+		AssertError(t, err, fosite.ErrNotFound, "oversized sessions should not be stored")
+	}
+}
+
+func TestRequestManager_CreateAccessTokenSession_ShouldExtractClaims(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.ClaimsExtractor = func(session fosite.Session) map[string]interface{} {
+		return map[string]interface{}{
+			"org": session.(*fosite.DefaultSession).Extra["org"],
+		}
+	}
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	org := uuid.NewString()
+	subject := uuid.NewString()
+	request := newRequester(uuid.NewString(), subject)
+	request.Session = &fosite.DefaultSession{
+		Subject: subject,
+		Extra:   map[string]interface{}{"org": org},
+	}
+	err := store.CreateAccessTokenSession(ctx, uuid.NewString(), request)
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	got, err := store.RequestManager.ListByClaim(ctx, storage.EntityAccessTokens, "org", org)
+	if err != nil {
+		AssertFatal(t, err, nil, "list by claim should return no database errors")
+	}
+	if len(got) != 1 || got[0].ID != request.ID {
+		AssertError(t, got, request.ID, "list by claim should return the request the claim was extracted from")
+	}
+}
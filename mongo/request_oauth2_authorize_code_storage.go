@@ -7,6 +7,9 @@ import (
 
 	// External Imports
 	"github.com/ory/fosite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
 	// Internal Imports
 	"github.com/p000ic/go-fosite-mongo"
 )
@@ -14,8 +17,10 @@ import (
 // CreateAuthorizeCodeSession stores the authorization request for a given
 // authorization code.
 func (r *RequestManager) CreateAuthorizeCodeSession(ctx context.Context, code string, request fosite.Requester) (err error) {
+	defer classifyError(&err)
+
 	// Store session request
-	_, err = r.Create(ctx, storage.EntityAuthorizationCodes, toMongo(code, request))
+	_, err = r.createSession(ctx, storage.EntityAuthorizationCodes, r.newRequest(ctx, code, request, fosite.AuthorizeCode))
 	if err != nil {
 		if err == storage.ErrResourceExists {
 			return err
@@ -29,6 +34,8 @@ func (r *RequestManager) CreateAuthorizeCodeSession(ctx context.Context, code st
 // GetAuthorizeCodeSession hydrates the session based on the given code and
 // returns the authorization request.
 func (r *RequestManager) GetAuthorizeCodeSession(ctx context.Context, code string, session fosite.Session) (request fosite.Requester, err error) {
+	defer classifyError(&err)
+
 	// Copy a new DB session if none specified
 	_, ok := ContextToSession(ctx)
 	if !ok {
@@ -72,7 +79,17 @@ func (r *RequestManager) GetAuthorizeCodeSession(ctx context.Context, code strin
 // used. The state of the authorization code should be set to invalid and
 // consecutive requests to GetAuthorizeCodeSession should return the
 // ErrInvalidatedAuthorizeCode error.
+//
+// Codes are single use, so invalidating a code that has already been
+// invalidated returns ErrInvalidatedAuthorizeCode. Of any concurrent
+// redemptions of a code, only one succeeds.
+//
+// If DeleteUsedAuthorizeCodes is set, the code is deleted rather than
+// invalidated, so reusing the code returns ErrNotFound rather than
+// ErrInvalidatedAuthorizeCode, and fosite is unable to detect the replay.
 func (r *RequestManager) InvalidateAuthorizeCodeSession(ctx context.Context, code string) (err error) {
+	defer classifyError(&err)
+
 	// Copy a new DB session if none specified
 	_, ok := ContextToSession(ctx)
 	if !ok {
@@ -83,28 +100,72 @@ func (r *RequestManager) InvalidateAuthorizeCodeSession(ctx context.Context, cod
 		}
 		defer closeSession()
 	}
-	// Get the stored request
-	req, err := r.GetBySignature(ctx, storage.EntityAuthorizationCodes, code)
+
+	// Build Query
+	// Only an active code is matched, so that the code is atomically flipped
+	// to inactive by exactly one of any concurrent redemptions.
+	query := bson.M{
+		"signature": code,
+		"active":    true,
+	}
+	collection, err := r.DB.collection(ctx, storage.EntityAuthorizationCodes)
 	if err != nil {
-		if err == fosite.ErrNotFound {
-			return err
-		}
-		// Log to StdOut
 		return err
 	}
-
-	// InvalidateAuthorizeCodeSession
-	req.UpdateTime = time.Now().Unix()
-	req.Active = false
-
-	// Push the update back
-	req, err = r.Update(ctx, storage.EntityAuthorizationCodes, req.ID, req)
+	if r.DeleteUsedAuthorizeCodes {
+		var res *mongo.DeleteResult
+		res, err = collection.DeleteOne(ctx, query)
+		if err == nil && res.DeletedCount == 0 {
+			err = mongo.ErrNoDocuments
+		}
+	} else {
+		update := bson.M{
+			"$set": bson.M{
+				"active":     false,
+				"updated_at": r.DB.timestamp(timeNow(r.Clock)),
+			},
+		}
+		err = collection.FindOneAndUpdate(ctx, query, update).Err()
+	}
 	if err != nil {
-		if err == fosite.ErrNotFound {
+		if err != mongo.ErrNoDocuments {
 			return err
 		}
-		return err
+
+		// Distinguish between a code that has already been used and one
+		// that doesn't exist.
+		_, err = r.GetBySignature(ctx, storage.EntityAuthorizationCodes, code)
+		if err != nil {
+			return err
+		}
+		return fosite.ErrInvalidatedAuthorizeCode
 	}
 
+	r.incCounter(MetricAuthorizeCodesInvalidated, nil)
+
 	return nil
 }
+
+// PurgeInvalidatedCodes deletes the authorization codes invalidated before the
+// given time, returning the number of codes deleted, so that consumed codes
+// don't linger until they expire.
+func (r *RequestManager) PurgeInvalidatedCodes(ctx context.Context, olderThan time.Time) (deleted int64, err error) {
+	defer classifyError(&err)
+
+	// Build Query
+	query := bson.M{
+		"active": false,
+		"$or":    timestampBefore("updated_at", olderThan),
+	}
+
+	collection, err := r.DB.collection(ctx, storage.EntityAuthorizationCodes)
+	if err != nil {
+		return 0, err
+	}
+	res, err := collection.DeleteMany(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.DeletedCount, nil
+}
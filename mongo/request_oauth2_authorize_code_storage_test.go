@@ -0,0 +1,130 @@
+package mongo_test
+
+import (
+	// Standard Library Imports
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	// External Imports
+	"github.com/google/uuid"
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo/mongo"
+)
+
+func TestRequestManager_InvalidateAuthorizeCodeSession_ShouldRedeemOnce(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	client := createClient(ctx, t, store)
+	code := uuid.NewString()
+	err := store.CreateAuthorizeCodeSession(ctx, code, newRequester(client.ID, uuid.NewString()))
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	// Each redemption runs in its own mongo session, as concurrent token
+	// requests would.
+	const redemptions = 10
+	errs := make(chan error, redemptions)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < redemptions; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			errs <- store.InvalidateAuthorizeCodeSession(context.Background(), code)
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, fosite.ErrInvalidatedAuthorizeCode):
+			AssertError(t, err, fosite.ErrInvalidatedAuthorizeCode, "losing redemptions should return invalidated")
+		}
+	}
+	if succeeded != 1 {
+		AssertError(t, succeeded, 1, "exactly one redemption should succeed")
+	}
+
+	_, err = store.GetAuthorizeCodeSession(ctx, code, &fosite.DefaultSession{})
+	if !errors.Is(err, fosite.ErrInvalidatedAuthorizeCode) {
+		AssertError(t, err, fosite.ErrInvalidatedAuthorizeCode, "code should be invalidated")
+	}
+}
+
+func TestRequestManager_InvalidateAuthorizeCodeSession_ShouldReturnNotFound(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	err := store.InvalidateAuthorizeCodeSession(ctx, uuid.NewString())
+	if !errors.Is(err, fosite.ErrNotFound) {
+		AssertError(t, err, fosite.ErrNotFound, "invalidating an unknown code should return not found")
+	}
+}
+
+func TestRequestManager_InvalidateAuthorizeCodeSession_ShouldDeleteUsedCodes(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.DeleteUsedAuthorizeCodes = true
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	client := createClient(ctx, t, store)
+	code := uuid.NewString()
+	err := store.CreateAuthorizeCodeSession(ctx, code, newRequester(client.ID, uuid.NewString()))
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	err = store.InvalidateAuthorizeCodeSession(ctx, code)
+	if err != nil {
+		AssertFatal(t, err, nil, "invalidate should return no database errors")
+	}
+
+	_, err = store.GetAuthorizeCodeSession(ctx, code, &fosite.DefaultSession{})
+	if !errors.Is(err, fosite.ErrNotFound) {
+		AssertError(t, err, fosite.ErrNotFound, "used code should be deleted")
+	}
+
+	err = store.InvalidateAuthorizeCodeSession(ctx, code)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		AssertError(t, err, fosite.ErrNotFound, "invalidating a used code should return not found")
+	}
+}
+
+func TestRequestManager_PurgeInvalidatedCodes_ShouldMatchTimestampsAsDates(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.TimestampsAsDates = true
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	client := createClient(ctx, t, store)
+	code := uuid.NewString()
+	err := store.CreateAuthorizeCodeSession(ctx, code, newRequester(client.ID, uuid.NewString()))
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+	err = store.InvalidateAuthorizeCodeSession(ctx, code)
+	if err != nil {
+		AssertFatal(t, err, nil, "invalidate should return no database errors")
+	}
+
+	deleted, err := store.PurgeInvalidatedCodes(ctx, time.Now().Add(time.Hour))
+	if err != nil {
+		AssertFatal(t, err, nil, "purge should return no database errors")
+	}
+	if deleted != 1 {
+		AssertError(t, deleted, int64(1), "purge should delete codes invalidated with date timestamps")
+	}
+}
@@ -6,14 +6,30 @@ import (
 
 	// External Imports
 	"github.com/ory/fosite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
 	// Internal Imports
 	"github.com/p000ic/go-fosite-mongo"
 )
 
 // CreateRefreshTokenSession implements fosite.RefreshTokenStorage.
 func (r *RequestManager) CreateRefreshTokenSession(ctx context.Context, signature string, request fosite.Requester) (err error) {
+	defer classifyError(&err)
+
+	return r.CreateRefreshTokenSessionWithAccess(ctx, signature, "", request)
+}
+
+// CreateRefreshTokenSessionWithAccess stores the refresh token session linked
+// to the signature of the access token issued alongside it, so that
+// RevokeRefreshTokenBySignature can revoke the pair.
+func (r *RequestManager) CreateRefreshTokenSessionWithAccess(ctx context.Context, signature string, accessSignature string, request fosite.Requester) (err error) {
+	defer classifyError(&err)
+
 	// Store session request
-	_, err = r.Create(ctx, storage.EntityRefreshTokens, toMongo(signature, request))
+	session := r.newRequest(ctx, signature, request, fosite.RefreshToken)
+	session.AccessSignature = accessSignature
+	created, err := r.createSession(ctx, storage.EntityRefreshTokens, session)
 	if err != nil {
 		if err == storage.ErrResourceExists {
 			return err
@@ -21,19 +37,125 @@ func (r *RequestManager) CreateRefreshTokenSession(ctx context.Context, signatur
 
 		return err
 	}
+	if !created {
+		// The session has already been stored by a previous attempt.
+		return nil
+	}
+
+	r.incCounter(MetricTokensIssued, map[string]string{
+		LabelTokenType: string(fosite.RefreshToken),
+		LabelGrantType: grantTypeFromRequest(request),
+	})
+
+	if r.MaxUserSessions > 0 {
+		err = r.evictExcessRefreshTokens(ctx, request.GetSession().GetSubject())
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
+// evictExcessRefreshTokens removes the oldest live refresh tokens held by a
+// user once the user holds more than the configured maximum number of
+// sessions. Used and expired refresh tokens don't count towards the maximum,
+// so are left to be purged rather than evicting live tokens in their place.
+//
+// Refresh tokens are counted and evicted without a transaction, so concurrent
+// refreshes may briefly leave the user holding more than the maximum. Rather
+// than evicting a counted excess, every live token beyond the newest maximum
+// is evicted, so concurrent evictions converge on the same tokens instead of
+// evicting more than needed.
+func (r *RequestManager) evictExcessRefreshTokens(ctx context.Context, userID string) (err error) {
+	if userID == "" {
+		return nil
+	}
+
+	// Build Query
+	query := liveQuery(bson.M{"user_id": userID}, timeNow(r.Clock))
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "requested_at", Value: -1}, {Key: "id", Value: -1}}).
+		SetSkip(r.MaxUserSessions).
+		SetProjection(bson.M{"id": 1})
+	collection, err := r.DB.collection(ctx, storage.EntityRefreshTokens)
+	if err != nil {
+		return err
+	}
+	cursor, err := collection.Find(ctx, query, opts)
+	if err != nil {
+		return err
+	}
+
+	var excess []storage.Request
+	err = cursor.All(ctx, &excess)
+	if err != nil {
+		return err
+	}
+	if len(excess) == 0 {
+		return nil
+	}
+
+	requestIDs := make([]string, len(excess))
+	for i := range excess {
+		requestIDs[i] = excess[i].ID
+	}
+
+	_, err = collection.DeleteMany(ctx, bson.M{"id": bson.M{"$in": requestIDs}})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ActiveSessionCount returns the number of live refresh tokens held by the
+// user. Used and expired refresh tokens aren't counted.
+func (r *RequestManager) ActiveSessionCount(ctx context.Context, userID string) (count int64, err error) {
+	defer classifyError(&err)
+
+	// Build Query
+	query := liveQuery(bson.M{"user_id": userID}, timeNow(r.Clock))
+
+	collection, err := r.DB.collection(ctx, storage.EntityRefreshTokens)
+	if err != nil {
+		return count, err
+	}
+	return collection.CountDocuments(ctx, query)
+}
+
 // GetRefreshTokenSession implements fosite.RefreshTokenStorage.
+//
+// Used refresh tokens are returned within their grace period, otherwise
+// fosite.ErrInactiveToken is returned along with the request, enabling fosite
+// to detect the token being replayed.
 func (r *RequestManager) GetRefreshTokenSession(ctx context.Context, signature string, session fosite.Session) (request fosite.Requester, err error) {
+	request, state, err := r.GetRefreshTokenSessionEx(ctx, signature, session)
+	if err != nil {
+		return nil, err
+	}
+
+	if state == storage.RefreshTokenReused {
+		return request, fosite.ErrInactiveToken
+	}
+
+	return request, nil
+}
+
+// GetRefreshTokenSessionEx returns the refresh token session along with its
+// rotation state. Refresh tokens are only marked as used, rather than deleted,
+// if RefreshTokenGracePeriod is set, otherwise every token found is current.
+func (r *RequestManager) GetRefreshTokenSessionEx(ctx context.Context, signature string, session fosite.Session) (request fosite.Requester, state storage.RefreshTokenState, err error) {
+	defer classifyError(&err)
+
 	// Copy a new DB session if none specified
 	_, ok := ContextToSession(ctx)
 	if !ok {
 		var closeSession func()
 		ctx, closeSession, err = newSession(ctx, r.DB)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 		defer closeSession()
 	}
@@ -41,25 +163,108 @@ func (r *RequestManager) GetRefreshTokenSession(ctx context.Context, signature s
 	req, err := r.GetBySignature(ctx, storage.EntityRefreshTokens, signature)
 	if err != nil {
 		if err == fosite.ErrNotFound {
-			return nil, err
+			return nil, "", err
 		}
-		return nil, err
+		return nil, "", err
 	}
 
 	// Transform to a fosite.Request
 	request, err = req.ToRequest(ctx, session, r.Clients)
 	if err != nil {
 		if err == fosite.ErrNotFound {
-			return nil, err
+			return nil, "", err
 		}
-		return nil, err
+		return nil, "", err
 	}
 
-	return request, nil
+	return request, req.RefreshTokenState(timeNow(r.Clock), r.RefreshTokenGracePeriod), nil
+}
+
+// useRefreshToken marks the refresh token, and the current refresh token of
+// the request it was issued under, as used, starting their grace period.
+// Tokens which have already been used are left untouched, so that reusing a
+// token doesn't extend its grace period.
+func (r *RequestManager) useRefreshToken(ctx context.Context, requestID string, signature string) (err error) {
+	// Build Query
+	query := bson.M{
+		"signature": signature,
+		"active":    true,
+	}
+	if requestID != "" {
+		query = bson.M{
+			"$or": []bson.M{
+				{"signature": signature},
+				{"id": requestID},
+			},
+			"active": true,
+		}
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"active":     false,
+			"updated_at": r.DB.timestamp(timeNow(r.Clock)),
+		},
+	}
+
+	collection, err := r.DB.collection(ctx, storage.EntityRefreshTokens)
+	if err != nil {
+		return err
+	}
+	res, err := collection.UpdateMany(ctx, query, update)
+	if err != nil {
+		return err
+	}
+
+	if res.ModifiedCount > 0 {
+		r.incCounter(MetricTokensRevoked, map[string]string{
+			LabelTokenType: string(fosite.RefreshToken),
+		})
+	}
+
+	return nil
+}
+
+// RevokeRefreshTokenBySignature deletes the refresh token session and the
+// access token session linked to it.
+func (r *RequestManager) RevokeRefreshTokenBySignature(ctx context.Context, signature string) (err error) {
+	defer classifyError(&err)
+
+	refreshToken, err := r.DeleteBySignatureReturning(ctx, storage.EntityRefreshTokens, signature)
+	if err != nil {
+		if err == fosite.ErrNotFound {
+			// Note: If the token is not found, we can declare it revoked.
+			return nil
+		}
+		return err
+	}
+
+	r.incCounter(MetricTokensRevoked, map[string]string{
+		LabelTokenType: string(fosite.RefreshToken),
+	})
+
+	if refreshToken.AccessSignature == "" {
+		return nil
+	}
+
+	err = r.DeleteBySignature(ctx, storage.EntityAccessTokens, refreshToken.AccessSignature)
+	if err != nil {
+		if err == fosite.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+
+	r.incCounter(MetricTokensRevoked, map[string]string{
+		LabelTokenType: string(fosite.AccessToken),
+	})
+
+	return nil
 }
 
 // DeleteRefreshTokenSession implements fosite.RefreshTokenStorage.
 func (r *RequestManager) DeleteRefreshTokenSession(ctx context.Context, signature string) (err error) {
+	defer classifyError(&err)
+
 	// Remove session request
 	err = r.DeleteBySignature(ctx, storage.EntityRefreshTokens, signature)
 	if err != nil {
@@ -0,0 +1,304 @@
+package mongo_test
+
+import (
+	// Standard Library Imports
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	// External Imports
+	"github.com/google/uuid"
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/compose"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+	"github.com/p000ic/go-fosite-mongo/mongo"
+)
+
+// newRequester returns a fosite request for the given client and subject.
+func newRequester(clientID string, subject string) *fosite.Request {
+	request := fosite.NewRequest()
+	request.ID = uuid.NewString()
+	request.RequestedAt = time.Now().UTC().Round(time.Second)
+	request.Client = &storage.Client{ID: clientID}
+	request.Session = &fosite.DefaultSession{Subject: subject}
+	return request
+}
+
+func TestRequestManager_CreateRefreshTokenSession_ShouldEvictOldestOverLimit(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.MaxUserSessions = 2
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	clientID := uuid.NewString()
+	subject := uuid.NewString()
+	requestedAt := time.Now().UTC().Round(time.Second).Add(-time.Hour)
+
+	var signatures []string
+	for i := 0; i < 4; i++ {
+		request := newRequester(clientID, subject)
+		request.RequestedAt = requestedAt.Add(time.Duration(i) * time.Minute)
+
+		signature := uuid.NewString()
+		err := store.CreateRefreshTokenSession(ctx, signature, request)
+		if err != nil {
+			AssertFatal(t, err, nil, "create should return no database errors")
+		}
+		signatures = append(signatures, signature)
+	}
+
+	// Sessions for other users should not count towards the limit.
+	err := store.CreateRefreshTokenSession(ctx, uuid.NewString(), newRequester(clientID, uuid.NewString()))
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	got, err := store.RequestManager.List(ctx, storage.EntityRefreshTokens, storage.ListRequestsRequest{UserID: subject})
+	if err != nil {
+		AssertFatal(t, err, nil, "list should return no database errors")
+	}
+	if len(got) != 2 {
+		AssertFatal(t, len(got), 2, "refresh tokens over the limit should be evicted")
+	}
+
+	remaining := map[string]bool{}
+	for _, request := range got {
+		remaining[request.Signature] = true
+	}
+	for _, signature := range signatures[:2] {
+		if remaining[signature] {
+			AssertError(t, signature, "evicted", "the oldest refresh tokens should be evicted")
+		}
+	}
+	for _, signature := range signatures[2:] {
+		if !remaining[signature] {
+			AssertError(t, signature, "retained", "the newest refresh tokens should be retained")
+		}
+	}
+}
+
+func TestRequestManager_CreateRefreshTokenSession_ShouldNotEvictWhenUnlimited(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	clientID := uuid.NewString()
+	subject := uuid.NewString()
+	for i := 0; i < 6; i++ {
+		err := store.CreateRefreshTokenSession(ctx, uuid.NewString(), newRequester(clientID, subject))
+		if err != nil {
+			AssertFatal(t, err, nil, "create should return no database errors")
+		}
+	}
+
+	got, err := store.RequestManager.List(ctx, storage.EntityRefreshTokens, storage.ListRequestsRequest{UserID: subject})
+	if err != nil {
+		AssertFatal(t, err, nil, "list should return no database errors")
+	}
+	if len(got) != 6 {
+		AssertError(t, len(got), 6, "refresh tokens should not be evicted when unlimited")
+	}
+}
+
+func TestRequestManager_GetRefreshTokenSessionEx_ShouldReportRotationState(t *testing.T) {
+	now := time.Now().UTC().Round(time.Second)
+	cfg := mongo.DefaultConfig()
+	cfg.RefreshTokenGracePeriod = time.Minute
+	cfg.Clock = func() time.Time { return now }
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	client, err := store.ClientManager.Create(ctx, storage.Client{ID: uuid.NewString(), Secret: "foobar"})
+	if err != nil {
+		AssertFatal(t, err, nil, "create client should return no database errors")
+	}
+
+	request := newRequester(client.ID, uuid.NewString())
+	signature := uuid.NewString()
+	err = store.CreateRefreshTokenSession(ctx, signature, request)
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	_, state, err := store.GetRefreshTokenSessionEx(ctx, signature, &fosite.DefaultSession{})
+	if err != nil {
+		AssertFatal(t, err, nil, "get should return no database errors")
+	}
+	if state != storage.RefreshTokenCurrent {
+		AssertError(t, state, storage.RefreshTokenCurrent, "unused refresh token should be current")
+	}
+
+	err = store.RevokeRefreshTokenMaybeGracePeriod(ctx, request.ID, signature)
+	if err != nil {
+		AssertFatal(t, err, nil, "revoke should return no database errors")
+	}
+
+	now = now.Add(30 * time.Second)
+	_, state, err = store.GetRefreshTokenSessionEx(ctx, signature, &fosite.DefaultSession{})
+	if err != nil {
+		AssertFatal(t, err, nil, "get should return no database errors")
+	}
+	if state != storage.RefreshTokenGrace {
+		AssertError(t, state, storage.RefreshTokenGrace, "used refresh token should be within its grace period")
+	}
+	_, err = store.GetRefreshTokenSession(ctx, signature, &fosite.DefaultSession{})
+	if err != nil {
+		AssertError(t, err, nil, "refresh token within its grace period should be returned")
+	}
+
+	now = now.Add(time.Minute)
+	got, state, err := store.GetRefreshTokenSessionEx(ctx, signature, &fosite.DefaultSession{})
+	if err != nil {
+		AssertFatal(t, err, nil, "get should return no database errors")
+	}
+	if state != storage.RefreshTokenReused {
+		AssertError(t, state, storage.RefreshTokenReused, "used refresh token past its grace period should be reused")
+	}
+	if got == nil || got.GetID() != request.ID {
+		AssertError(t, got, request, "reused refresh token should be returned")
+	}
+	_, err = store.GetRefreshTokenSession(ctx, signature, &fosite.DefaultSession{})
+	if err != fosite.ErrInactiveToken {
+		AssertError(t, err, fosite.ErrInactiveToken, "reused refresh token should be inactive")
+	}
+}
+
+func TestRequestManager_RefreshTokenGrant_ShouldRotateWithinGracePeriod(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.RefreshTokenGracePeriod = time.Minute
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	expected := expectedClient()
+	expected.Scopes = append(expected.Scopes, "offline")
+	client := createNewClient(t, ctx, store, expected)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		AssertFatal(t, err, nil, "unable to generate signing key")
+	}
+	config := &fosite.Config{
+		GlobalSecret: []byte("some-super-cool-secret-that-nobody-knows"),
+	}
+	provider := compose.ComposeAllEnabled(config, store, key)
+
+	request := newRequester(client.ID, uuid.NewString())
+	request.GrantScope("offline")
+	token, signature, err := compose.NewOAuth2HMACStrategy(config).GenerateRefreshToken(ctx, request)
+	if err != nil {
+		AssertFatal(t, err, nil, "generate refresh token should return no errors")
+	}
+	err = store.CreateRefreshTokenSession(ctx, signature, request)
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	refresh := func(refreshToken string) string {
+		form := url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {refreshToken},
+			"client_id":     {client.ID},
+		}
+		req := httptest.NewRequest(http.MethodPost, "/oauth2/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		accessRequest, err := provider.NewAccessRequest(ctx, req, &fosite.DefaultSession{})
+		if err != nil {
+			AssertFatal(t, err, nil, "refresh token grant should be accepted")
+		}
+		response, err := provider.NewAccessResponse(ctx, accessRequest)
+		if err != nil {
+			AssertFatal(t, err, nil, "refresh token grant should rotate the refresh token")
+		}
+
+		rotated, _ := response.GetExtra("refresh_token").(string)
+		if rotated == "" || rotated == refreshToken {
+			AssertFatal(t, rotated, "a new refresh token", "refresh token grant should issue a new refresh token")
+		}
+		return rotated
+	}
+
+	rotated := refresh(token)
+	refresh(rotated)
+
+	// The original token is still within its grace period, so can be retried,
+	// for example, if the rotated token was lost in transit.
+	refresh(token)
+
+	err = store.RevokeRefreshToken(ctx, request.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "revoke should return no database errors")
+	}
+	got, err := store.RequestManager.List(ctx, storage.EntityRefreshTokens, storage.ListRequestsRequest{ClientID: client.ID})
+	if err != nil {
+		AssertFatal(t, err, nil, "list should return no database errors")
+	}
+	if len(got) != 0 {
+		AssertError(t, len(got), 0, "revoke should delete every refresh token issued under the request")
+	}
+}
+
+func TestRequestManager_CreateRefreshTokenSession_ShouldOnlyEvictLiveTokens(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.MaxUserSessions = 2
+	cfg.RefreshTokenGracePeriod = time.Minute
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	clientID := uuid.NewString()
+	subject := uuid.NewString()
+	requestedAt := time.Now().UTC().Round(time.Second).Add(-time.Hour)
+	create := func(i int, expiresAt time.Time) string {
+		request := newRequester(clientID, subject)
+		request.RequestedAt = requestedAt.Add(time.Duration(i) * time.Minute)
+		request.Session.SetExpiresAt(fosite.RefreshToken, expiresAt)
+
+		signature := uuid.NewString()
+		err := store.CreateRefreshTokenSession(ctx, signature, request)
+		if err != nil {
+			AssertFatal(t, err, nil, "create should return no database errors")
+		}
+		return signature
+	}
+
+	// The oldest tokens are dead, so shouldn't count towards the limit.
+	used := create(0, time.Now().Add(time.Hour))
+	err := store.RevokeRefreshTokenMaybeGracePeriod(ctx, "", used)
+	if err != nil {
+		AssertFatal(t, err, nil, "revoke should return no database errors")
+	}
+	expired := create(1, time.Now().Add(-time.Minute))
+	live := []string{
+		create(2, time.Now().Add(time.Hour)),
+		create(3, time.Now().Add(time.Hour)),
+		create(4, time.Now().Add(time.Hour)),
+	}
+
+	got, err := store.RequestManager.List(ctx, storage.EntityRefreshTokens, storage.ListRequestsRequest{UserID: subject})
+	if err != nil {
+		AssertFatal(t, err, nil, "list should return no database errors")
+	}
+	remaining := map[string]bool{}
+	for _, request := range got {
+		remaining[request.Signature] = true
+	}
+	for _, signature := range []string{used, expired} {
+		if !remaining[signature] {
+			AssertError(t, signature, "retained", "dead refresh tokens should be left to be purged")
+		}
+	}
+	if remaining[live[0]] {
+		AssertError(t, live[0], "evicted", "the oldest live refresh token should be evicted")
+	}
+	for _, signature := range live[1:] {
+		if !remaining[signature] {
+			AssertError(t, signature, "retained", "the newest live refresh tokens should be retained")
+		}
+	}
+}
@@ -3,9 +3,13 @@ package mongo
 import (
 	// Standard Library Imports
 	"context"
+	"errors"
 
 	// External Imports
 	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
 )
 
 // Provides a concrete implementation of oauth2.ResourceOwnerPasswordCredentialsGrantStorage
@@ -15,10 +19,13 @@ import (
 // Authenticate confirms whether the specified password matches the stored
 // hashed password within a User resource, found by username.
 func (r *RequestManager) Authenticate(ctx context.Context, username string, secret string) (err error) {
+	defer classifyError(&err)
+
 	_, err = r.Users.Authenticate(ctx, username, secret)
 	if err != nil {
-		if err == fosite.ErrNotFound {
-			return err
+		if errors.Is(err, storage.ErrInvalidCredentials) {
+			// fosite reports not found as an invalid grant.
+			return fosite.ErrNotFound
 		}
 		return err
 	}
@@ -6,6 +6,8 @@ import (
 
 	// External Imports
 	"github.com/ory/fosite"
+	"go.mongodb.org/mongo-driver/bson"
+
 	// Internal Imports
 	"github.com/p000ic/go-fosite-mongo"
 )
@@ -13,8 +15,10 @@ import (
 // CreateOpenIDConnectSession creates an open id connect session resource for a
 // given authorize code. This is relevant for explicit open id connect flow.
 func (r *RequestManager) CreateOpenIDConnectSession(ctx context.Context, authorizeCode string, request fosite.Requester) (err error) {
+	defer classifyError(&err)
+
 	// Store session request
-	_, err = r.Create(ctx, storage.EntityOpenIDSessions, toMongo(authorizeCode, request))
+	_, err = r.createSession(ctx, storage.EntityOpenIDSessions, r.newRequest(ctx, authorizeCode, request, fosite.AuthorizeCode))
 	if err != nil {
 		if err == storage.ErrResourceExists {
 			return err
@@ -29,6 +33,8 @@ func (r *RequestManager) CreateOpenIDConnectSession(ctx context.Context, authori
 // GetOpenIDConnectSession gets a session resource based off the Authorize Code
 // and returns a fosite.Requester, or an error.
 func (r *RequestManager) GetOpenIDConnectSession(ctx context.Context, authorizeCode string, requester fosite.Requester) (request fosite.Requester, err error) {
+	defer classifyError(&err)
+
 	// Copy a new DB session if none specified
 	_, ok := ContextToSession(ctx)
 	if !ok {
@@ -68,6 +74,8 @@ func (r *RequestManager) GetOpenIDConnectSession(ctx context.Context, authorizeC
 
 // DeleteOpenIDConnectSession removes an open id connect session from mongo.
 func (r *RequestManager) DeleteOpenIDConnectSession(ctx context.Context, authorizeCode string) (err error) {
+	defer classifyError(&err)
+
 	// Remove session request
 	err = r.DeleteBySignature(ctx, storage.EntityOpenIDSessions, authorizeCode)
 	if err != nil {
@@ -78,3 +86,58 @@ func (r *RequestManager) DeleteOpenIDConnectSession(ctx context.Context, authori
 	}
 	return nil
 }
+
+// GetOpenIDSessionsBySid returns all open id connect session resources issued
+// under the given OpenID Connect session ID.
+func (r *RequestManager) GetOpenIDSessionsBySid(ctx context.Context, sid string) (results []storage.Request, err error) {
+	defer classifyError(&err)
+
+	// Build Query
+	query := bson.M{
+		"sid": sid,
+	}
+
+	collection, err := r.DB.collection(ctx, storage.EntityOpenIDSessions)
+	if err != nil {
+		return results, err
+	}
+	cursor, err := collection.Find(ctx, query)
+	if err != nil {
+		return results, err
+	}
+
+	var requests []storage.Request
+	err = cursor.All(ctx, &requests)
+	if err != nil {
+		return results, err
+	}
+
+	return requests, nil
+}
+
+// DeleteOpenIDSessionsBySid removes all open id connect session resources
+// issued under the given OpenID Connect session ID. Returns not found if no
+// sessions were found for the given session ID.
+func (r *RequestManager) DeleteOpenIDSessionsBySid(ctx context.Context, sid string) (err error) {
+	defer classifyError(&err)
+
+	// Build Query
+	query := bson.M{
+		"sid": sid,
+	}
+
+	collection, err := r.DB.collection(ctx, storage.EntityOpenIDSessions)
+	if err != nil {
+		return err
+	}
+	res, err := collection.DeleteMany(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return fosite.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package mongo_test
+
+import (
+	// Standard Library Imports
+	"testing"
+	"time"
+
+	// External Imports
+	"github.com/google/uuid"
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/handler/openid"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// newOpenIDRequester returns a fosite request for the given client and
+// subject, with the provided OpenID Connect session ID set in the ID token
+// claims.
+func newOpenIDRequester(clientID string, subject string, sid string) *fosite.Request {
+	session := openid.NewDefaultSession()
+	session.Subject = subject
+	session.Claims.Subject = subject
+	session.Claims.Extra["sid"] = sid
+
+	request := fosite.NewRequest()
+	request.ID = uuid.NewString()
+	request.RequestedAt = time.Now().UTC().Round(time.Second)
+	request.Client = &storage.Client{ID: clientID}
+	request.Session = session
+	return request
+}
+
+func TestRequestManager_CreateOpenIDConnectSession_ShouldStoreSid(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	sid := uuid.NewString()
+	code := uuid.NewString()
+	err := store.CreateOpenIDConnectSession(ctx, code, newOpenIDRequester(uuid.NewString(), uuid.NewString(), sid))
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	got, err := store.GetOpenIDSessionsBySid(ctx, sid)
+	if err != nil {
+		AssertFatal(t, err, nil, "get by sid should return no database errors")
+	}
+	if len(got) != 1 {
+		AssertFatal(t, len(got), 1, "get by sid should return the created session")
+	}
+	if got[0].Signature != code {
+		AssertError(t, got[0].Signature, code, "get by sid returned an unexpected session")
+	}
+	if got[0].Sid != sid {
+		AssertError(t, got[0].Sid, sid, "sid should be stored from the session claims")
+	}
+}
+
+func TestRequestManager_GetOpenIDSessionsBySid(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	sid := uuid.NewString()
+	subject := uuid.NewString()
+	codes := map[string]bool{
+		uuid.NewString(): true,
+		uuid.NewString(): true,
+	}
+	for code := range codes {
+		err := store.CreateOpenIDConnectSession(ctx, code, newOpenIDRequester(uuid.NewString(), subject, sid))
+		if err != nil {
+			AssertFatal(t, err, nil, "create should return no database errors")
+		}
+	}
+
+	// Create an unrelated session that should not be returned.
+	err := store.CreateOpenIDConnectSession(ctx, uuid.NewString(), newOpenIDRequester(uuid.NewString(), subject, uuid.NewString()))
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	got, err := store.GetOpenIDSessionsBySid(ctx, sid)
+	if err != nil {
+		AssertFatal(t, err, nil, "get by sid should return no database errors")
+	}
+	if len(got) != len(codes) {
+		AssertFatal(t, len(got), len(codes), "get by sid should return all sessions sharing the sid")
+	}
+	for _, request := range got {
+		if !codes[request.Signature] {
+			AssertError(t, request.Signature, codes, "get by sid returned an unexpected session")
+		}
+	}
+}
+
+func TestRequestManager_DeleteOpenIDSessionsBySid(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	sid := uuid.NewString()
+	subject := uuid.NewString()
+	for i := 0; i < 3; i++ {
+		err := store.CreateOpenIDConnectSession(ctx, uuid.NewString(), newOpenIDRequester(uuid.NewString(), subject, sid))
+		if err != nil {
+			AssertFatal(t, err, nil, "create should return no database errors")
+		}
+	}
+
+	otherSid := uuid.NewString()
+	err := store.CreateOpenIDConnectSession(ctx, uuid.NewString(), newOpenIDRequester(uuid.NewString(), subject, otherSid))
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	err = store.DeleteOpenIDSessionsBySid(ctx, sid)
+	if err != nil {
+		AssertError(t, err, nil, "delete by sid should return no database errors")
+	}
+
+	got, err := store.GetOpenIDSessionsBySid(ctx, sid)
+	if err != nil {
+		AssertError(t, err, nil, "get by sid should return no database errors")
+	}
+	if len(got) != 0 {
+		AssertError(t, len(got), 0, "delete by sid should remove all sessions sharing the sid")
+	}
+
+	others, err := store.GetOpenIDSessionsBySid(ctx, otherSid)
+	if err != nil {
+		AssertError(t, err, nil, "get by sid should return no database errors")
+	}
+	if len(others) != 1 {
+		AssertError(t, len(others), 1, "delete by sid should not remove sessions with a different sid")
+	}
+}
+
+func TestRequestManager_DeleteOpenIDSessionsBySid_ShouldReturnNotFound(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	err := store.DeleteOpenIDSessionsBySid(ctx, uuid.NewString())
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "delete by sid should return not found")
+	}
+}
@@ -12,8 +12,10 @@ import (
 
 // CreatePKCERequestSession implements fosite.PKCERequestStorage.
 func (r *RequestManager) CreatePKCERequestSession(ctx context.Context, signature string, request fosite.Requester) (err error) {
+	defer classifyError(&err)
+
 	// Store session request
-	_, err = r.Create(ctx, storage.EntityPKCESessions, toMongo(signature, request))
+	_, err = r.createSession(ctx, storage.EntityPKCESessions, r.newRequest(ctx, signature, request, fosite.AuthorizeCode))
 	if err != nil {
 		if err == storage.ErrResourceExists {
 			return err
@@ -26,6 +28,8 @@ func (r *RequestManager) CreatePKCERequestSession(ctx context.Context, signature
 
 // GetPKCERequestSession implements fosite.PKCERequestStorage.
 func (r *RequestManager) GetPKCERequestSession(ctx context.Context, signature string, session fosite.Session) (request fosite.Requester, err error) {
+	defer classifyError(&err)
+
 	// Copy a new DB session if none specified
 	_, ok := ContextToSession(ctx)
 	if !ok {
@@ -58,6 +62,8 @@ func (r *RequestManager) GetPKCERequestSession(ctx context.Context, signature st
 
 // DeletePKCERequestSession implements fosite.PKCERequestStorage.
 func (r *RequestManager) DeletePKCERequestSession(ctx context.Context, signature string) (err error) {
+	defer classifyError(&err)
+
 	// Remove session request
 	err = r.DeleteBySignature(ctx, storage.EntityPKCESessions, signature)
 	if err != nil {
@@ -0,0 +1,90 @@
+package mongo_test
+
+import (
+	// Standard Library Imports
+	"testing"
+
+	// External Imports
+	"github.com/google/uuid"
+	"github.com/ory/fosite"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+func TestRequestManager_CreatePKCERequestSession_ShouldStoreCodeChallenge(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	client := createClient(ctx, t, store)
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	request := newRequester(client.ID, uuid.NewString())
+	request.Form.Set("code_challenge", challenge)
+	request.Form.Set("code_challenge_method", "S256")
+
+	signature := uuid.NewString()
+	err := store.CreatePKCERequestSession(ctx, signature, request)
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	got, err := store.RequestManager.List(ctx, storage.EntityPKCESessions, storage.ListRequestsRequest{ClientID: client.ID})
+	if err != nil {
+		AssertFatal(t, err, nil, "list should return no database errors")
+	}
+	if len(got) != 1 {
+		AssertFatal(t, len(got), 1, "list should return the created pkce session")
+	}
+	if got[0].CodeChallenge != challenge {
+		AssertError(t, got[0].CodeChallenge, challenge, "code challenge should be stored")
+	}
+	if got[0].CodeChallengeMethod != "S256" {
+		AssertError(t, got[0].CodeChallengeMethod, "S256", "code challenge method should be stored")
+	}
+
+	requester, err := store.GetPKCERequestSession(ctx, signature, &fosite.DefaultSession{})
+	if err != nil {
+		AssertFatal(t, err, nil, "get should return no database errors")
+	}
+	form := requester.GetRequestForm()
+	if form.Get("code_challenge") != challenge {
+		AssertError(t, form.Get("code_challenge"), challenge, "code challenge should round-trip")
+	}
+	if form.Get("code_challenge_method") != "S256" {
+		AssertError(t, form.Get("code_challenge_method"), "S256", "code challenge method should round-trip")
+	}
+}
+
+func TestRequestManager_GetPKCERequestSession_ShouldRestoreCodeChallenge(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	client := createClient(ctx, t, store)
+	challenge := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+	// Simulate a record where the challenge is only held in the explicit
+	// fields, not the form.
+	request := storage.NewRequest()
+	request.Signature = uuid.NewString()
+	request.ClientID = client.ID
+	request.CodeChallenge = challenge
+	request.CodeChallengeMethod = "plain"
+	request.Session = []byte("{}")
+	_, err := store.RequestManager.Create(ctx, storage.EntityPKCESessions, request)
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	requester, err := store.GetPKCERequestSession(ctx, request.Signature, &fosite.DefaultSession{})
+	if err != nil {
+		AssertFatal(t, err, nil, "get should return no database errors")
+	}
+	form := requester.GetRequestForm()
+	if form.Get("code_challenge") != challenge {
+		AssertError(t, form.Get("code_challenge"), challenge, "code challenge should be restored into the form")
+	}
+	if form.Get("code_challenge_method") != "plain" {
+		AssertError(t, form.Get("code_challenge_method"), "plain", "code challenge method should be restored into the form")
+	}
+}
@@ -0,0 +1,89 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"context"
+	"regexp"
+	"time"
+
+	// External Imports
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// addScopes returns the update adding the scopes to a record's scopes, without
+// duplicating those already held.
+func addScopes(scopes []string) bson.M {
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return bson.M{
+		"$addToSet": bson.M{"scopes": bson.M{"$each": scopes}},
+	}
+}
+
+// filterScopePrefix restricts the query to records holding at least one scope
+// beginning with the prefix, alongside any other scope filter already applied.
+// Exact scope matches remain unaffected, as the operators apply to the scopes
+// independently.
+func filterScopePrefix(query bson.M, prefix string) {
+	if prefix == "" {
+		return
+	}
+
+	scopes, ok := query["scopes"].(bson.M)
+	if !ok {
+		scopes = bson.M{}
+	}
+	scopes["$regex"] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(prefix)}
+	query["scopes"] = scopes
+}
+
+// pullScopes returns the update removing the scopes from a record's scopes.
+func pullScopes(scopes []string) bson.M {
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return bson.M{
+		"$pull": bson.M{"scopes": bson.M{"$in": scopes}},
+	}
+}
+
+// updateScopes applies the scope update to every record in the entity's
+// collection matched by the selector in a single round trip, bumping each
+// record's update time, and reports whether any record matched. As the scopes
+// are modified in place, rather than the record being read and replaced,
+// concurrent changes to the record aren't clobbered.
+//
+// Records stored without scopes hold null, which $addToSet and $pull refuse to
+// update, so they're first given an empty set within the same ordered bulk
+// write.
+func (db *DB) updateScopes(ctx context.Context, entityName string, selector bson.M, update bson.M, now time.Time) (found bool, err error) {
+	nullScopes := bson.M{"scopes": bson.M{"$type": "null"}}
+	for key, value := range selector {
+		nullScopes[key] = value
+	}
+
+	update["$set"] = bson.M{"updated_at": db.timestamp(now)}
+	models := []mongo.WriteModel{
+		mongo.NewUpdateManyModel().
+			SetFilter(nullScopes).
+			SetUpdate(bson.M{"$set": bson.M{"scopes": bson.A{}}}),
+		mongo.NewUpdateManyModel().
+			SetFilter(selector).
+			SetUpdate(update),
+	}
+
+	collection, err := db.collection(ctx, entityName)
+	if err != nil {
+		return false, err
+	}
+	result, err := collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(true))
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount > 0, nil
+}
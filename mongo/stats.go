@@ -0,0 +1,58 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"context"
+
+	// External Imports
+	"go.mongodb.org/mongo-driver/bson"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// entities lists every collection managed by the store.
+var entities = []string{
+	storage.EntityClients,
+	storage.EntityUsers,
+	storage.EntityConsents,
+	storage.EntityNonces,
+	storage.EntityIdempotencyKeys,
+	storage.EntityJtiDenylist,
+	storage.EntityAccessTokens,
+	storage.EntityRefreshTokens,
+	storage.EntityAuthorizationCodes,
+	storage.EntityOpenIDSessions,
+	storage.EntityPKCESessions,
+}
+
+// Stats returns the number of documents stored in each entity collection,
+// keyed by entity name.
+//
+// If fast is set, counts are estimated from collection metadata rather than
+// scanning the collection, trading accuracy for speed. Estimated counts may
+// be inaccurate after an unclean shutdown or within sharded clusters with
+// orphaned documents.
+func (s *Store) Stats(ctx context.Context, fast bool) (map[string]int64, error) {
+	stats := make(map[string]int64, len(entities))
+	for _, entity := range entities {
+		collection, err := s.DB.collection(ctx, entity)
+		if err != nil {
+			return nil, err
+		}
+
+		var count int64
+		if fast {
+			count, err = collection.EstimatedDocumentCount(ctx)
+		} else {
+			count, err = collection.CountDocuments(ctx, bson.M{})
+		}
+		if err != nil {
+			return nil, classify(err)
+		}
+
+		stats[entity] = count
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,67 @@
+package mongo_test
+
+import (
+	// Standard Library Imports
+	"testing"
+
+	// External Imports
+	"github.com/google/uuid"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+func TestStore_Stats(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	for i := 0; i < 3; i++ {
+		_, err := store.ClientManager.Create(ctx, storage.Client{
+			Name:   uuid.NewString(),
+			Secret: "foobar",
+		})
+		if err != nil {
+			AssertFatal(t, err, nil, "create client should return no database errors")
+		}
+	}
+	for i := 0; i < 2; i++ {
+		_, err := store.UserManager.Create(ctx, storage.User{
+			Username: uuid.NewString(),
+			Password: "foobar",
+		})
+		if err != nil {
+			AssertFatal(t, err, nil, "create user should return no database errors")
+		}
+	}
+	clientID := uuid.NewString()
+	subject := uuid.NewString()
+	for i := 0; i < 4; i++ {
+		err := store.CreateAccessTokenSession(ctx, uuid.NewString(), newRequester(clientID, subject))
+		if err != nil {
+			AssertFatal(t, err, nil, "create access token should return no database errors")
+		}
+	}
+	err := store.CreateRefreshTokenSession(ctx, uuid.NewString(), newRequester(clientID, subject))
+	if err != nil {
+		AssertFatal(t, err, nil, "create refresh token should return no database errors")
+	}
+
+	expected := map[string]int64{
+		storage.EntityClients:        3,
+		storage.EntityUsers:          2,
+		storage.EntityAccessTokens:   4,
+		storage.EntityRefreshTokens:  1,
+		storage.EntityOpenIDSessions: 0,
+	}
+	for _, fast := range []bool{false, true} {
+		got, err := store.Stats(ctx, fast)
+		if err != nil {
+			AssertFatal(t, err, nil, "stats should return no database errors")
+		}
+		for entity, count := range expected {
+			if got[entity] != count {
+				AssertError(t, got[entity], count, "stats returned an unexpected count for "+entity)
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"fmt"
+	"reflect"
+	"time"
+
+	// External Imports
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// timestampFields are the resource fields holding a CreateTime or UpdateTime.
+var timestampFields = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+}
+
+// timestampTypes are the storage types that are stored with a CreateTime and
+// UpdateTime.
+var timestampTypes = []reflect.Type{
+	reflect.TypeOf(storage.Client{}),
+	reflect.TypeOf(storage.Consent{}),
+	reflect.TypeOf(storage.Request{}),
+	reflect.TypeOf(storage.User{}),
+	reflect.TypeOf(userDocument{}),
+}
+
+// newTimestampRegistry returns a registry that encodes resource timestamps as
+// BSON dates if asDates is set, otherwise as unix timestamps. Timestamps are
+// decoded from either representation, so collections holding a mix of both can
+// be read regardless.
+func newTimestampRegistry(asDates bool) *bsoncodec.Registry {
+	codec := &timestampCodec{asDates: asDates}
+
+	registry := newBaseRegistry()
+	for _, t := range timestampTypes {
+		registry.RegisterTypeEncoder(t, codec)
+		registry.RegisterTypeDecoder(t, codec)
+	}
+
+	return registry
+}
+
+// timestampCodec encodes and decodes storage types using the base registry,
+// converting the representation of the resource timestamps.
+type timestampCodec struct {
+	asDates bool
+}
+
+// EncodeValue implements bsoncodec.ValueEncoder.
+func (c *timestampCodec) EncodeValue(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	doc, err := bson.MarshalWithRegistry(baseRegistry, val.Interface())
+	if err != nil {
+		return err
+	}
+
+	if c.asDates {
+		doc, err = convertTimestamps(doc, bsontype.Int64, func(value bson.RawValue) bsoncore.Value {
+			return bsoncore.Value{
+				Type: bsontype.DateTime,
+				Data: bsoncore.AppendDateTime(nil, value.Int64()*1000),
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return bsonrw.Copier{}.CopyDocumentFromBytes(vw, doc)
+}
+
+// DecodeValue implements bsoncodec.ValueDecoder.
+func (c *timestampCodec) DecodeValue(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	if vr.Type() == bsontype.Null {
+		val.Set(reflect.Zero(val.Type()))
+		return vr.ReadNull()
+	}
+
+	doc, err := bsonrw.Copier{}.CopyDocumentToBytes(vr)
+	if err != nil {
+		return fmt.Errorf("cannot decode into a %s: %w", val.Type(), err)
+	}
+
+	doc, err = convertTimestamps(doc, bsontype.DateTime, func(value bson.RawValue) bsoncore.Value {
+		return bsoncore.Value{
+			Type: bsontype.Int64,
+			Data: bsoncore.AppendInt64(nil, value.Time().Unix()),
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	decoded := reflect.New(val.Type())
+	err = bson.UnmarshalWithRegistry(baseRegistry, doc, decoded.Interface())
+	if err != nil {
+		return err
+	}
+	val.Set(decoded.Elem())
+
+	return nil
+}
+
+// convertTimestamps returns a copy of the document with any timestamp fields
+// of the given type converted.
+func convertTimestamps(doc bson.Raw, from bsontype.Type, convert func(bson.RawValue) bsoncore.Value) (bson.Raw, error) {
+	elements, err := doc.Elements()
+	if err != nil {
+		return nil, err
+	}
+
+	idx, converted := bsoncore.AppendDocumentStart(nil)
+	for _, element := range elements {
+		key := element.Key()
+		value := element.Value()
+
+		if timestampFields[key] && value.Type == from {
+			converted = bsoncore.AppendValueElement(converted, key, convert(value))
+			continue
+		}
+
+		converted = bsoncore.AppendValueElement(converted, key, bsoncore.Value{
+			Type: value.Type,
+			Data: value.Value,
+		})
+	}
+
+	return bsoncore.AppendDocumentEnd(converted, idx)
+}
+
+// timestamp returns the time in the representation used to store resource
+// timestamps, for use in targeted updates. Dates are truncated to the
+// millisecond resolution of BSON dates, so the order of updates made within
+// the same second is preserved.
+func (db *DB) timestamp(t time.Time) interface{} {
+	if db.TimestampsAsDates {
+		return primitive.NewDateTimeFromTime(t.Truncate(time.Millisecond))
+	}
+
+	return t.Unix()
+}
+
+// timestampBefore returns the clauses matching a resource timestamp field
+// before the given time, in either representation, for use in an $or query.
+func timestampBefore(field string, t time.Time) bson.A {
+	return bson.A{
+		bson.M{field: bson.M{"$lt": t.Unix()}},
+		bson.M{field: bson.M{"$lt": primitive.NewDateTimeFromTime(t)}},
+	}
+}
@@ -0,0 +1,139 @@
+package mongo
+
+import (
+	// Standard Library Imports
+	"testing"
+	"time"
+
+	// External Imports
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+func TestTimestampCodec_ShouldEncodeUnixTimestamps(t *testing.T) {
+	user := storage.User{ID: "user", CreateTime: 1700000000, UpdateTime: 1700000600}
+
+	doc, err := bson.MarshalWithRegistry(newTimestampRegistry(false), &user)
+	if err != nil {
+		t.Fatalf("marshal should return no errors, got: %v", err)
+	}
+
+	for key, expected := range map[string]int64{"created_at": user.CreateTime, "updated_at": user.UpdateTime} {
+		value := bson.Raw(doc).Lookup(key)
+		if value.Type != bsontype.Int64 || value.Int64() != expected {
+			t.Errorf("%s should be stored as a unix timestamp, expected: %d, got: %v", key, expected, value)
+		}
+	}
+}
+
+func TestTimestampCodec_ShouldEncodeDates(t *testing.T) {
+	client := storage.Client{ID: "client", CreateTime: 1700000000, UpdateTime: 1700000600}
+
+	doc, err := bson.MarshalWithRegistry(newTimestampRegistry(true), &client)
+	if err != nil {
+		t.Fatalf("marshal should return no errors, got: %v", err)
+	}
+
+	for key, expected := range map[string]int64{"created_at": client.CreateTime, "updated_at": client.UpdateTime} {
+		value := bson.Raw(doc).Lookup(key)
+		if value.Type != bsontype.DateTime || value.Time().Unix() != expected {
+			t.Errorf("%s should be stored as a date, expected: %d, got: %v", key, expected, value)
+		}
+	}
+	if id := bson.Raw(doc).Lookup("id").StringValue(); id != client.ID {
+		t.Errorf("other fields should be left untouched, expected: %s, got: %s", client.ID, id)
+	}
+}
+
+func TestTimestampCodec_ShouldDecodeEitherRepresentation(t *testing.T) {
+	createdAt := time.Unix(1700000000, 0)
+	doc, err := bson.Marshal(bson.M{
+		"id":         "user",
+		"created_at": primitive.NewDateTimeFromTime(createdAt),
+		"updated_at": int64(1700000600),
+	})
+	if err != nil {
+		t.Fatalf("marshal should return no errors, got: %v", err)
+	}
+
+	for _, asDates := range []bool{false, true} {
+		var user storage.User
+		err = bson.UnmarshalWithRegistry(newTimestampRegistry(asDates), doc, &user)
+		if err != nil {
+			t.Fatalf("unmarshal should return no errors, got: %v", err)
+		}
+		if user.ID != "user" {
+			t.Errorf("id should be decoded, expected: user, got: %s", user.ID)
+		}
+		if user.CreateTime != createdAt.Unix() {
+			t.Errorf("a date timestamp should be decoded, expected: %d, got: %d", createdAt.Unix(), user.CreateTime)
+		}
+		if user.UpdateTime != 1700000600 {
+			t.Errorf("a unix timestamp should be decoded, expected: %d, got: %d", 1700000600, user.UpdateTime)
+		}
+	}
+}
+
+func TestTimestampCodec_ShouldEncodeUserDocuments(t *testing.T) {
+	user := storage.User{ID: "user", Username: "j.doe@example.com", CreateTime: 1700000000}
+
+	doc, err := bson.MarshalWithRegistry(newTimestampRegistry(true), newUserDocument(user))
+	if err != nil {
+		t.Fatalf("marshal should return no errors, got: %v", err)
+	}
+
+	if value := bson.Raw(doc).Lookup("created_at"); value.Type != bsontype.DateTime {
+		t.Errorf("created_at should be stored as a date, got: %v", value)
+	}
+	if id := bson.Raw(doc).Lookup("id").StringValue(); id != user.ID {
+		t.Errorf("user fields should be stored inline, expected: %s, got: %s", user.ID, id)
+	}
+	if value := bson.Raw(doc).Lookup("search_terms"); value.Type != bsontype.Array {
+		t.Errorf("the user's search terms should be stored, got: %v", value)
+	}
+}
+
+func TestDB_Timestamp_ShouldPreserveSubSecondOrdering(t *testing.T) {
+	db := &DB{TimestampsAsDates: true}
+	registry := newTimestampRegistry(true)
+
+	earlier := time.Unix(1700000000, int64(250*time.Millisecond+999))
+	later := earlier.Add(500 * time.Millisecond)
+
+	var stored []primitive.DateTime
+	for _, at := range []time.Time{earlier, later} {
+		doc, err := bson.MarshalWithRegistry(registry, bson.M{"id": "user", "updated_at": db.timestamp(at)})
+		if err != nil {
+			t.Fatalf("marshal should return no errors, got: %v", err)
+		}
+
+		var raw struct {
+			UpdatedAt primitive.DateTime `bson:"updated_at"`
+		}
+		err = bson.Unmarshal(doc, &raw)
+		if err != nil {
+			t.Fatalf("unmarshal should return no errors, got: %v", err)
+		}
+		if expected := at.Truncate(time.Millisecond); !raw.UpdatedAt.Time().Equal(expected) {
+			t.Errorf("dates should be stored to the millisecond, expected: %s, got: %s", expected, raw.UpdatedAt.Time())
+		}
+		stored = append(stored, raw.UpdatedAt)
+
+		var user storage.User
+		err = bson.UnmarshalWithRegistry(registry, doc, &user)
+		if err != nil {
+			t.Fatalf("unmarshal should return no errors, got: %v", err)
+		}
+		if user.UpdateTime != at.Unix() {
+			t.Errorf("dates should be read as unix timestamps, expected: %d, got: %d", at.Unix(), user.UpdateTime)
+		}
+	}
+
+	if stored[0] >= stored[1] {
+		t.Errorf("updates within the same second should be stored in order, got: %s, then %s", stored[0].Time(), stored[1].Time())
+	}
+}
@@ -0,0 +1,110 @@
+package mongo_test
+
+import (
+	// Standard Library Imports
+	"testing"
+	"time"
+
+	// External Imports
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+	"github.com/p000ic/go-fosite-mongo/mongo"
+)
+
+func TestStore_ShouldStoreTimestampsAsDates(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.TimestampsAsDates = true
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	expected := createUser(ctx, t, store)
+
+	var raw bson.Raw
+	err := store.DB.Database().Collection(storage.EntityUsers).FindOne(ctx, bson.M{"id": expected.ID}).Decode(&raw)
+	if err != nil {
+		AssertFatal(t, err, nil, "find should return no database errors")
+	}
+	for _, key := range []string{"created_at", "updated_at"} {
+		if raw.Lookup(key).Type != bsontype.DateTime {
+			AssertError(t, raw.Lookup(key).Type, bsontype.DateTime, key+" should be stored as a date")
+		}
+	}
+
+	got, err := store.UserManager.Get(ctx, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "get should return no database errors")
+	}
+	if !got.Equal(expected) {
+		AssertError(t, got, expected, "timestamps stored as dates should round-trip")
+	}
+
+	got, err = store.UserManager.SetEmailVerified(ctx, expected.ID, true)
+	if err != nil {
+		AssertFatal(t, err, nil, "set email verified should return no database errors")
+	}
+	if got.UpdateTime == 0 {
+		AssertError(t, got.UpdateTime, "update time", "targeted updates should store a readable update time")
+	}
+}
+
+func TestStore_ShouldReadLegacyTimestamps(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	expected := createUser(ctx, t, store)
+
+	// A store configured to store dates should continue to read the existing
+	// unix timestamps.
+	datesStore, err := mongo.NewWithClient(store.DB.Client(), &mongo.Config{
+		DatabaseName:      store.DB.Name(),
+		TimestampsAsDates: true,
+	}, nil)
+	if err != nil {
+		AssertFatal(t, err, nil, "new store should return no errors")
+	}
+
+	got, err := datesStore.UserManager.Get(ctx, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "get should return no database errors")
+	}
+	if !got.Equal(expected) {
+		AssertError(t, got, expected, "legacy unix timestamps should be read")
+	}
+}
+
+func TestStore_ShouldStoreSubSecondDates(t *testing.T) {
+	now := time.Unix(1700000000, int64(100*time.Millisecond))
+	cfg := mongo.DefaultConfig()
+	cfg.TimestampsAsDates = true
+	cfg.Clock = frozenClock(&now)
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	expected := createUser(ctx, t, store)
+
+	var updates []time.Time
+	for _, verified := range []bool{true, false} {
+		now = now.Add(300 * time.Millisecond)
+		_, err := store.UserManager.SetEmailVerified(ctx, expected.ID, verified)
+		if err != nil {
+			AssertFatal(t, err, nil, "set email verified should return no database errors")
+		}
+
+		var raw bson.Raw
+		err = store.DB.Database().Collection(storage.EntityUsers).FindOne(ctx, bson.M{"id": expected.ID}).Decode(&raw)
+		if err != nil {
+			AssertFatal(t, err, nil, "find should return no database errors")
+		}
+		updates = append(updates, raw.Lookup("updated_at").Time())
+	}
+
+	if !updates[0].Equal(now.Add(-300*time.Millisecond)) || !updates[1].Equal(now) {
+		AssertError(t, updates, []time.Time{now.Add(-300 * time.Millisecond), now}, "update times should be stored to the millisecond")
+	}
+	if !updates[0].Before(updates[1]) {
+		AssertError(t, updates, "ordered update times", "updates within the same second should be stored in order")
+	}
+}
@@ -3,12 +3,15 @@ package mongo
 import (
 	// Standard Library Imports
 	"context"
+	"errors"
+	"regexp"
+	"strings"
 	"time"
 
 	// External Imports
-	"github.com/google/uuid"
 	"github.com/ory/fosite"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
@@ -26,33 +29,253 @@ import (
 type UserManager struct {
 	DB     *DB
 	Hasher fosite.Hasher
+
+	// IDGenerator generates IDs for newly created users. Defaults to
+	// generating UUIDs if not set.
+	IDGenerator func() string
+
+	// Clock provides the current time. Defaults to time.Now if not set.
+	Clock func() time.Time
+
+	// UniquePersonID enforces that each person ID is linked to at most one
+	// user by creating a unique index on person_id.
+	UniquePersonID bool
+
+	// Hooks, if set, observes and can veto the users created, updated and
+	// deleted via Create, Migrate, Update and Delete. Targeted updates, such
+	// as UpdatePassword, aren't hooked.
+	Hooks storage.Hooks[storage.User]
+
+	// RoleScopes maps each role to the scopes it implies, which are granted
+	// to users holding the role, see EffectiveScopes.
+	RoleScopes map[string][]string
+
+	// MaxFailedLogins locks a user out for LockoutDuration once that many
+	// consecutive attempts to authenticate as the user have failed. Zero
+	// disables lockout.
+	MaxFailedLogins uint32
+
+	// LockoutDuration is how long a user is locked out for. Defaults to 15
+	// minutes if not set.
+	LockoutDuration time.Duration
+
+	decoy decoyHash
+}
+
+// defaultLockoutDuration is how long a user is locked out for, unless
+// configured otherwise.
+const defaultLockoutDuration = 15 * time.Minute
+
+// hooks returns the configured hooks, defaulting to allowing every change.
+func (u *UserManager) hooks() storage.Hooks[storage.User] {
+	if u.Hooks == nil {
+		return storage.NopHooks[storage.User]{}
+	}
+
+	return u.Hooks
+}
+
+// recordFailedLogin counts a failed attempt to authenticate as the user,
+// locking the user out once MaxFailedLogins consecutive attempts have failed.
+// The count is incremented atomically, so concurrent attempts are all counted.
+// Attempts against a locked user aren't counted, so the lockout isn't
+// extended.
+func (u *UserManager) recordFailedLogin(ctx context.Context, user storage.User) error {
+	now := timeNow(u.Clock)
+	if u.MaxFailedLogins == 0 || user.IsLocked(now) {
+		return nil
+	}
+
+	var counted storage.User
+	collection, err := u.DB.collection(ctx, storage.EntityUsers)
+	if err != nil {
+		return err
+	}
+	opts := options.FindOneAndUpdate().
+		SetProjection(bson.M{"failed_login_count": 1}).
+		SetReturnDocument(options.After)
+	err = collection.FindOneAndUpdate(ctx, bson.M{"id": user.ID}, bson.M{
+		"$inc": bson.M{"failed_login_count": 1},
+	}, opts).Decode(&counted)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			// The user has been deleted concurrently.
+			return nil
+		}
+		return err
+	}
+	if counted.FailedLoginCount < int(u.MaxFailedLogins) {
+		return nil
+	}
+
+	lockoutDuration := u.LockoutDuration
+	if lockoutDuration <= 0 {
+		lockoutDuration = defaultLockoutDuration
+	}
+
+	// Restart the count, so the user is allowed MaxFailedLogins attempts once
+	// the lockout ends.
+	_, err = collection.UpdateOne(ctx, bson.M{
+		"id":                 user.ID,
+		"failed_login_count": bson.M{"$gte": u.MaxFailedLogins},
+	}, bson.M{
+		"$set": bson.M{
+			"failed_login_count": 0,
+			"locked_until":       now.Add(lockoutDuration).Unix(),
+		},
+	})
+	return err
+}
+
+// resetFailedLogins clears the failed login count of a user who has
+// authenticated, without bumping the user's update time.
+func (u *UserManager) resetFailedLogins(ctx context.Context, user *storage.User) error {
+	if user.FailedLoginCount == 0 && user.LockedUntil == 0 {
+		return nil
+	}
+
+	collection, err := u.DB.collection(ctx, storage.EntityUsers)
+	if err != nil {
+		return err
+	}
+	_, err = collection.UpdateOne(ctx, bson.M{"id": user.ID}, bson.M{
+		"$set": bson.M{
+			"failed_login_count": 0,
+			"locked_until":       0,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	user.FailedLoginCount = 0
+	user.LockedUntil = 0
+	return nil
 }
 
 // Configure implements storage.Configure.
 func (u *UserManager) Configure(ctx context.Context) (err error) {
+	defer classifyError(&err)
+
 	indices := []mongo.IndexModel{
 		NewUniqueIndex(IdxUserID, "id"),
-		NewUniqueIndex(IdxUsername, "username"),
+		// Usernames are only unique across enabled users, so the username of
+		// a disabled account can be reused.
+		//
+		// Note:
+		// - Stores created before usernames could be reused hold a fully
+		//   unique username index, which is left in place, and reported as
+		//   an ErrIndexConflict, until rebuilt via Store.RebuildIndexes.
+		NewUniquePartialIndex(IdxUsername, bson.M{"disabled": false}, "username"),
+		// Only users with an email are indexed.
+		NewPartialIndex(IdxEmail, bson.M{
+			"email": bson.M{"$gt": ""},
+		}, "email"),
+		// Only users with a pending email verification are indexed.
+		NewPartialIndex(IdxEmailVerificationToken, bson.M{
+			"email_verification_token": bson.M{"$gt": ""},
+		}, "email_verification_token"),
+		// Users are searched by prefix, which is able to make use of an
+		// index, see List.
+		NewIndex(IdxSearchTerms, "search_terms"),
+	}
+	if u.UniquePersonID {
+		// Users without a person ID are excluded from the index, which
+		// requires a partial filter, as sparse indices still index empty
+		// strings.
+		indices = append(indices, NewUniquePartialIndex(IdxPersonID, bson.M{
+			"person_id": bson.M{"$gt": ""},
+		}, "person_id"))
 	}
 
-	collection := u.DB.Collection(storage.EntityUsers)
-	_, err = collection.Indexes().CreateMany(ctx, indices)
+	collection, err := u.DB.collection(ctx, storage.EntityUsers)
 	if err != nil {
 		return err
 	}
+	err = createIndexes(ctx, collection, indices...)
+	if err != nil && !errors.Is(err, ErrIndexConflict) {
+		return err
+	}
 
-	return nil
+	// Index conflicts are only reported, see New, so existing users are
+	// still backfilled, otherwise searching would miss them until the
+	// indices are rebuilt.
+	return errors.Join(err, u.indexSearchTerms(ctx))
+}
+
+// userDocument provides the structure of a stored user, including the terms
+// the user is found by when searching, which aren't part of the resource.
+type userDocument struct {
+	storage.User `bson:",inline"`
+
+	SearchTerms []string `bson:"search_terms"`
+}
+
+// newUserDocument returns the document to store for the user.
+func newUserDocument(user storage.User) userDocument {
+	return userDocument{
+		User:        user,
+		SearchTerms: user.SearchTerms(),
+	}
+}
+
+// indexSearchTerms stores the search terms of users stored before users were
+// searched by term, so they can be found when searching.
+func (u *UserManager) indexSearchTerms(ctx context.Context) error {
+	collection, err := u.DB.collection(ctx, storage.EntityUsers)
+	if err != nil {
+		return err
+	}
+	opts := options.Find().SetProjection(bson.M{
+		"id":         1,
+		"username":   1,
+		"first_name": 1,
+		"last_name":  1,
+	})
+	cursor, err := collection.Find(ctx, bson.M{"search_terms": bson.M{"$exists": false}}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var user storage.User
+		err = cursor.Decode(&user)
+		if err != nil {
+			return err
+		}
+
+		_, err = collection.UpdateOne(ctx, bson.M{"id": user.ID}, bson.M{
+			"$set": bson.M{"search_terms": user.SearchTerms()},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+// userSecretsProjection excludes a user's MFA secrets when reading users, so
+// they are only loaded when needed to verify a second factor.
+var userSecretsProjection = bson.M{
+	"totp_secret":    0,
+	"recovery_codes": 0,
+	"search_terms":   0,
 }
 
 // getConcrete returns an OAuth 2.0 User resource.
-func (u *UserManager) getConcrete(ctx context.Context, userID string) (result storage.User, err error) {
+func (u *UserManager) getConcrete(ctx context.Context, userID string, opts ...*options.FindOneOptions) (result storage.User, err error) {
 	// Build Query
 	query := bson.M{
 		"id": userID,
 	}
 	var user storage.User
-	collection := u.DB.Collection(storage.EntityUsers)
-	err = collection.FindOne(ctx, query).Decode(&user)
+	collection, err := u.DB.collection(ctx, storage.EntityUsers)
+	if err != nil {
+		return result, err
+	}
+	err = collection.FindOne(ctx, query, opts...).Decode(&user)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return result, fosite.ErrNotFound
@@ -63,8 +286,47 @@ func (u *UserManager) getConcrete(ctx context.Context, userID string) (result st
 	return user, nil
 }
 
+// setFields performs a targeted update of the provided fields on the
+// specified user, bumping the user's update time, and returns the updated
+// user. Unlike Update, fields that aren't specified are left untouched, so
+// concurrent edits to other fields aren't clobbered.
+func (u *UserManager) setFields(ctx context.Context, userID string, fields bson.M) (result storage.User, err error) {
+	fields["updated_at"] = u.DB.timestamp(timeNow(u.Clock))
+
+	// Build Query
+	selector := bson.M{
+		"id": userID,
+	}
+	update := bson.M{
+		"$set": fields,
+	}
+
+	var user storage.User
+	collection, err := u.DB.collection(ctx, storage.EntityUsers)
+	if err != nil {
+		return result, err
+	}
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetProjection(userSecretsProjection)
+	err = collection.FindOneAndUpdate(ctx, selector, update, opts).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return result, fosite.ErrNotFound
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			return result, storage.ErrResourceExists
+		}
+		return result, err
+	}
+
+	return user, nil
+}
+
 // List returns a list of User resources that match the provided inputs.
 func (u *UserManager) List(ctx context.Context, filter storage.ListUsersRequest) (results []storage.User, err error) {
+	defer classifyError(&err)
+
 	// Build Query
 	query := bson.M{}
 	if filter.AllowedTenantAccess != "" {
@@ -85,6 +347,7 @@ func (u *UserManager) List(ctx context.Context, filter storage.ListUsersRequest)
 	if len(filter.ScopesUnion) > 0 {
 		query["scopes"] = bson.M{"$in": filter.ScopesUnion}
 	}
+	filterScopePrefix(query, filter.ScopePrefix)
 	if filter.FirstName != "" {
 		query["first_name"] = filter.FirstName
 	}
@@ -94,9 +357,32 @@ func (u *UserManager) List(ctx context.Context, filter storage.ListUsersRequest)
 	if filter.Disabled {
 		query["disabled"] = filter.Disabled
 	}
+	if filter.Search != "" {
+		// Text indices only match whole words, so users are searched by a
+		// prefix of their lowercased search terms instead, which, being case
+		// sensitive and anchored, is able to make use of the index.
+		query["search_terms"] = primitive.Regex{
+			Pattern: "^" + regexp.QuoteMeta(strings.ToLower(filter.Search)),
+		}
+	}
 
-	collection := u.DB.Collection(storage.EntityUsers)
-	cursor, err := collection.Find(ctx, query)
+	findOptions := options.Find().SetProjection(userSecretsProjection)
+	if filter.After != "" || filter.Limit > 0 {
+		// Page by ID so results remain stable as records are added.
+		findOptions.SetSort(bson.D{{Key: "id", Value: 1}})
+		if filter.After != "" {
+			query["id"] = bson.M{"$gt": filter.After}
+		}
+		if filter.Limit > 0 {
+			findOptions.SetLimit(filter.Limit)
+		}
+	}
+
+	collection, err := u.DB.collection(ctx, storage.EntityUsers)
+	if err != nil {
+		return results, err
+	}
+	cursor, err := collection.Find(ctx, query, findOptions)
 	if err != nil {
 		return results, err
 	}
@@ -113,12 +399,19 @@ func (u *UserManager) List(ctx context.Context, filter storage.ListUsersRequest)
 // Create creates a new User resource and returns the newly created User
 // resource.
 func (u *UserManager) Create(ctx context.Context, user storage.User) (result storage.User, err error) {
+	defer classifyError(&err)
+
 	// Enable developers to provide their own IDs
 	if user.ID == "" {
-		user.ID = uuid.NewString()
+		user.ID = generateID(u.IDGenerator)
 	}
 	if user.CreateTime == 0 {
-		user.CreateTime = time.Now().Unix()
+		user.CreateTime = timeNow(u.Clock).Unix()
+	}
+
+	err = u.hooks().BeforeCreate(ctx, user)
+	if err != nil {
+		return result, err
 	}
 
 	// Hash incoming secret
@@ -129,8 +422,11 @@ func (u *UserManager) Create(ctx context.Context, user storage.User) (result sto
 	user.Password = string(hash)
 
 	// Create resource
-	collection := u.DB.Collection(storage.EntityUsers)
-	_, err = collection.InsertOne(ctx, user)
+	collection, err := u.DB.collection(ctx, storage.EntityUsers)
+	if err != nil {
+		return result, err
+	}
+	_, err = collection.InsertOne(ctx, newUserDocument(user))
 	if err != nil {
 		if mongo.IsDuplicateKeyError(err) {
 			return result, storage.ErrResourceExists
@@ -138,23 +434,62 @@ func (u *UserManager) Create(ctx context.Context, user storage.User) (result sto
 		return result, err
 	}
 
+	u.hooks().AfterCreate(ctx, user)
 	return user, nil
 }
 
-// Get returns the specified User resource.
+// Get returns the specified User resource. Disabled users aren't found,
+// unless the context is marked with storage.WithIncludeDisabled.
 func (u *UserManager) Get(ctx context.Context, userID string) (result storage.User, err error) {
-	return u.getConcrete(ctx, userID)
+	defer classifyError(&err)
+
+	// Build Query
+	query := bson.M{
+		"id": userID,
+	}
+	if !storage.IncludeDisabled(ctx) {
+		query["disabled"] = false
+	}
+
+	var user storage.User
+	collection, err := u.DB.collection(ctx, storage.EntityUsers)
+	if err != nil {
+		return result, err
+	}
+	err = collection.FindOne(ctx, query, options.FindOne().SetProjection(userSecretsProjection)).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return result, fosite.ErrNotFound
+		}
+		return result, err
+	}
+
+	return user, nil
 }
 
-// GetByUsername returns a user resource if found by username.
+// GetByUsername returns a user resource if found by username. Disabled users
+// aren't found, unless the context is marked with storage.WithIncludeDisabled,
+// in which case the enabled user is preferred, as the username of a disabled
+// user can be reused.
 func (u *UserManager) GetByUsername(ctx context.Context, username string) (result storage.User, err error) {
+	defer classifyError(&err)
+
 	// Build Query
 	query := bson.M{
 		"username": username,
 	}
+	if !storage.IncludeDisabled(ctx) {
+		query["disabled"] = false
+	}
 	var user storage.User
-	collection := u.DB.Collection(storage.EntityUsers)
-	err = collection.FindOne(ctx, query).Decode(&user)
+	collection, err := u.DB.collection(ctx, storage.EntityUsers)
+	if err != nil {
+		return result, err
+	}
+	opts := options.FindOne().
+		SetSort(bson.D{{Key: "disabled", Value: 1}}).
+		SetProjection(userSecretsProjection)
+	err = collection.FindOne(ctx, query, opts).Decode(&user)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return result, fosite.ErrNotFound
@@ -166,9 +501,128 @@ func (u *UserManager) GetByUsername(ctx context.Context, username string) (resul
 	return user, nil
 }
 
+// EffectiveScopes returns the union of the user's scopes and the scopes
+// implied by the user's roles, as mapped by RoleScopes.
+func (u *UserManager) EffectiveScopes(ctx context.Context, userID string) (scopes []string, err error) {
+	user, err := u.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return user.EffectiveScopes(u.RoleScopes), nil
+}
+
+// GetByLogin returns the user resource whose username or email matches the
+// login in a single query. Returns storage.ErrMultipleResults if the login
+// matches different users, for example, the username of one user and the
+// email of another.
+func (u *UserManager) GetByLogin(ctx context.Context, login string) (result storage.User, err error) {
+	defer classifyError(&err)
+
+	if login == "" {
+		return result, fosite.ErrNotFound
+	}
+
+	// Build Query
+	query := bson.M{
+		"$or": bson.A{
+			bson.M{"username": login},
+			bson.M{"email": login},
+		},
+	}
+	if !storage.IncludeDisabled(ctx) {
+		query["disabled"] = false
+	}
+
+	collection, err := u.DB.collection(ctx, storage.EntityUsers)
+	if err != nil {
+		return result, err
+	}
+	cursor, err := collection.Find(ctx, query, options.Find().SetLimit(2).SetProjection(userSecretsProjection))
+	if err != nil {
+		return result, err
+	}
+
+	var users []storage.User
+	err = cursor.All(ctx, &users)
+	if err != nil {
+		return result, err
+	}
+
+	switch len(users) {
+	case 0:
+		return result, fosite.ErrNotFound
+	case 1:
+		return users[0], nil
+	default:
+		return result, storage.ErrMultipleResults
+	}
+}
+
+// GetByPersonID returns the user resource linked to the given person ID.
+// Returns storage.ErrMultipleResults if more than one user is linked to the
+// person, which can only occur if UniquePersonID is not enforced.
+func (u *UserManager) GetByPersonID(ctx context.Context, personID string) (result storage.User, err error) {
+	defer classifyError(&err)
+
+	// Build Query
+	query := bson.M{
+		"person_id": personID,
+	}
+
+	collection, err := u.DB.collection(ctx, storage.EntityUsers)
+	if err != nil {
+		return result, err
+	}
+	cursor, err := collection.Find(ctx, query, options.Find().SetLimit(2).SetProjection(userSecretsProjection))
+	if err != nil {
+		return result, err
+	}
+
+	var users []storage.User
+	err = cursor.All(ctx, &users)
+	if err != nil {
+		return result, err
+	}
+
+	switch len(users) {
+	case 0:
+		return result, fosite.ErrNotFound
+	case 1:
+		return users[0], nil
+	default:
+		return result, storage.ErrMultipleResults
+	}
+}
+
+// UsernameExists returns whether an enabled user resource exists with the
+// given username. The username of a disabled user is free to be reused.
+func (u *UserManager) UsernameExists(ctx context.Context, username string) (exists bool, err error) {
+	defer classifyError(&err)
+
+	// Build Query
+	query := bson.M{
+		"username": username,
+		"disabled": false,
+	}
+
+	collection, err := u.DB.collection(ctx, storage.EntityUsers)
+	if err != nil {
+		return false, err
+	}
+	count, err := collection.CountDocuments(ctx, query, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
 // Update updates the User resource and attributes and returns the updated
 // User resource.
 func (u *UserManager) Update(ctx context.Context, userID string, updatedUser storage.User) (result storage.User, err error) {
+	defer classifyError(&err)
+
 	// Copy a new DB session if none specified
 	_, ok := ContextToSession(ctx)
 	if !ok {
@@ -191,8 +645,14 @@ func (u *UserManager) Update(ctx context.Context, userID string, updatedUser sto
 
 	// Deny updating the entity Id
 	updatedUser.ID = userID
+
+	err = u.hooks().BeforeUpdate(ctx, updatedUser)
+	if err != nil {
+		return result, err
+	}
+
 	// Update modified time
-	updatedUser.UpdateTime = time.Now().Unix()
+	updatedUser.UpdateTime = timeNow(u.Clock).Unix()
 
 	if currentResource.Password == updatedUser.Password || updatedUser.Password == "" {
 		// If the password/hash is blank or hash matches, set using old hash.
@@ -204,13 +664,21 @@ func (u *UserManager) Update(ctx context.Context, userID string, updatedUser sto
 		}
 		updatedUser.Password = string(newHash)
 	}
+	// MFA enrolment is only managed via EnrollTOTP and DisableMFA.
+	updatedUser.MFAEnabled = currentResource.MFAEnabled
+	updatedUser.TOTPSecret = currentResource.TOTPSecret
+	updatedUser.RecoveryCodes = currentResource.RecoveryCodes
+
 	// Build Query
 	selector := bson.M{
 		"id": userID,
 	}
 
-	collection := u.DB.Collection(storage.EntityUsers)
-	res, err := collection.ReplaceOne(ctx, selector, updatedUser)
+	collection, err := u.DB.collection(ctx, storage.EntityUsers)
+	if err != nil {
+		return result, err
+	}
+	res, err := collection.ReplaceOne(ctx, selector, newUserDocument(updatedUser))
 	if err != nil {
 		if mongo.IsDuplicateKeyError(err) {
 			return result, storage.ErrResourceExists
@@ -222,51 +690,128 @@ func (u *UserManager) Update(ctx context.Context, userID string, updatedUser sto
 		return result, fosite.ErrNotFound
 	}
 
+	updatedUser.TOTPSecret = ""
+	updatedUser.RecoveryCodes = nil
+	u.hooks().AfterUpdate(ctx, updatedUser)
 	return updatedUser, nil
 }
 
+// UpdatePassword hashes the provided cleartext password and sets it as the
+// user's password. Unlike Update, the password is always rehashed, so there
+// is no ambiguity as to whether a password or an existing hash is expected.
+func (u *UserManager) UpdatePassword(ctx context.Context, userID string, password string) (err error) {
+	defer classifyError(&err)
+
+	hash, err := u.Hasher.Hash(ctx, []byte(password))
+	if err != nil {
+		return err
+	}
+
+	_, err = u.setFields(ctx, userID, bson.M{
+		"password": string(hash),
+	})
+	return err
+}
+
 // Migrate is provided solely for the case where you want to migrate users and
 // upgrade their password using the AuthUserMigrator interface.
 // This performs an upsert, either creating or overwriting the record with the
 // newly provided full record. Use with caution, be secure, don't be dumb.
+// If the user has a SourceUpdatedAt, a stored user migrated from the same or
+// a newer version isn't overwritten and storage.ErrMigrationStale is returned.
+// BeforeCreate, or BeforeUpdate if the user exists, is called with the
+// migrated user, including its already hashed password.
 func (u *UserManager) Migrate(ctx context.Context, migratedUser storage.User) (result storage.User, err error) {
+	defer classifyError(&err)
+
 	// Generate a unique ID if not supplied
 	if migratedUser.ID == "" {
-		migratedUser.ID = uuid.NewString()
+		migratedUser.ID = generateID(u.IDGenerator)
 	}
 	// Update create time
 	if migratedUser.CreateTime == 0 {
-		migratedUser.CreateTime = time.Now().Unix()
+		migratedUser.CreateTime = timeNow(u.Clock).Unix()
 	}
 	// Update modified time
-	migratedUser.UpdateTime = time.Now().Unix()
+	migratedUser.UpdateTime = timeNow(u.Clock).Unix()
 
 	// Build Query
 	selector := bson.M{
 		"id": migratedUser.ID,
 	}
+	if migratedUser.SourceUpdatedAt != 0 {
+		// Only overwrite users migrated from an older version.
+		selector["$or"] = bson.A{
+			bson.M{"source_updated_at": bson.M{"$exists": false}},
+			bson.M{"source_updated_at": bson.M{"$lt": migratedUser.SourceUpdatedAt}},
+		}
+	}
+
+	collection, err := u.DB.collection(ctx, storage.EntityUsers)
+	if err != nil {
+		return result, err
+	}
+	existing, err := collection.CountDocuments(ctx, bson.M{"id": migratedUser.ID})
+	if err != nil {
+		return result, err
+	}
+	if existing > 0 {
+		err = u.hooks().BeforeUpdate(ctx, migratedUser)
+	} else {
+		err = u.hooks().BeforeCreate(ctx, migratedUser)
+	}
+	if err != nil {
+		return result, err
+	}
 
-	collection := u.DB.Collection(storage.EntityUsers)
 	opts := options.Replace().SetUpsert(true)
-	_, err = collection.ReplaceOne(ctx, selector, migratedUser, opts)
+	_, err = collection.ReplaceOne(ctx, selector, newUserDocument(migratedUser), opts)
 	if err != nil {
 		if mongo.IsDuplicateKeyError(err) {
+			if migratedUser.SourceUpdatedAt != 0 {
+				// The upsert conflicts on ID if the stored user is as new.
+				stale, staleErr := collection.CountDocuments(ctx, bson.M{
+					"id":                migratedUser.ID,
+					"source_updated_at": bson.M{"$gte": migratedUser.SourceUpdatedAt},
+				})
+				if staleErr != nil {
+					return result, staleErr
+				}
+				if stale > 0 {
+					return result, storage.ErrMigrationStale
+				}
+			}
 			return result, storage.ErrResourceExists
 		}
 		return result, err
 	}
 
+	if existing > 0 {
+		u.hooks().AfterUpdate(ctx, migratedUser)
+	} else {
+		u.hooks().AfterCreate(ctx, migratedUser)
+	}
 	return migratedUser, nil
 }
 
 // Delete deletes the specified User resource.
 func (u *UserManager) Delete(ctx context.Context, userID string) (err error) {
+	defer classifyError(&err)
+
+	err = u.hooks().BeforeDelete(ctx, userID)
+	if err != nil {
+		return err
+	}
+
 	// Build Query
 	query := bson.M{
 		"id": userID,
 	}
 
-	collection := u.DB.Collection(storage.EntityUsers)
+	collection, err := u.DB.collection(ctx, storage.EntityUsers)
+	if err != nil {
+		return err
+	}
 	res, err := collection.DeleteOne(ctx, query)
 	if err != nil {
 		return err
@@ -274,6 +819,8 @@ func (u *UserManager) Delete(ctx context.Context, userID string) (err error) {
 	if res.DeletedCount == 0 {
 		return fosite.ErrNotFound
 	}
+
+	u.hooks().AfterDelete(ctx, userID)
 	return nil
 }
 
@@ -281,23 +828,46 @@ func (u *UserManager) Delete(ctx context.Context, userID string) (err error) {
 // hashed password within the User resource.
 // The User resource returned is matched by username.
 func (u *UserManager) Authenticate(ctx context.Context, username string, password string) (result storage.User, err error) {
+	defer classifyError(&err)
+
 	return u.AuthenticateByUsername(ctx, username, password)
 }
 
 // AuthenticateByID confirms whether the specified password matches the stored
 // hashed password within the User resource.
-// The User resource returned is matched by User ID.
+// The User resource returned is matched by User ID. A missing user and a
+// wrong password are both reported as storage.ErrInvalidCredentials, as is a
+// wrong password for a disabled or locked user, which is otherwise denied.
+// Wrong passwords count towards locking the user out, see MaxFailedLogins,
+// while a successful authentication clears the count.
 func (u *UserManager) AuthenticateByID(ctx context.Context, userID string, password string) (result storage.User, err error) {
-	user, err := u.getConcrete(ctx, userID)
+	defer classifyError(&err)
+
+	user, err := u.getConcrete(ctx, userID, options.FindOne().SetProjection(userSecretsProjection))
 	if err != nil {
+		if err == fosite.ErrNotFound {
+			u.decoy.compare(ctx, u.Hasher, password)
+			return result, storage.ErrInvalidCredentials
+		}
 		return result, err
 	}
 
-	if user.Disabled {
+	err = u.Hasher.Compare(ctx, []byte(user.Password), []byte(password))
+	if err != nil {
+		err = u.recordFailedLogin(ctx, user)
+		if err != nil {
+			return result, err
+		}
+		return result, storage.ErrInvalidCredentials
+	}
+
+	// Deny disabled or locked users only once the password has been verified,
+	// so a user's state isn't revealed without it.
+	if user.Disabled || user.IsLocked(timeNow(u.Clock)) {
 		return result, fosite.ErrAccessDenied
 	}
 
-	err = u.Hasher.Compare(ctx, []byte(user.Password), []byte(password))
+	err = u.resetFailedLogins(ctx, &user)
 	if err != nil {
 		return result, err
 	}
@@ -307,18 +877,40 @@ func (u *UserManager) AuthenticateByID(ctx context.Context, userID string, passw
 
 // AuthenticateByUsername confirms whether the specified password matches the
 // stored hashed password within the User resource.
-// The User resource returned is matched by username.
+// The User resource returned is matched by username. Disabled users aren't
+// found, so, as with a wrong password, are reported as
+// storage.ErrInvalidCredentials. A locked user, or a disabled user included by
+// the context, is denied only once the password has been verified. Wrong
+// passwords count towards locking the user out, see MaxFailedLogins, while a
+// successful authentication clears the count.
 func (u *UserManager) AuthenticateByUsername(ctx context.Context, username string, password string) (result storage.User, err error) {
+	defer classifyError(&err)
+
 	user, err := u.GetByUsername(ctx, username)
 	if err != nil {
+		if err == fosite.ErrNotFound {
+			u.decoy.compare(ctx, u.Hasher, password)
+			return result, storage.ErrInvalidCredentials
+		}
 		return result, err
 	}
 
-	if user.Disabled {
+	err = u.Hasher.Compare(ctx, []byte(user.Password), []byte(password))
+	if err != nil {
+		err = u.recordFailedLogin(ctx, user)
+		if err != nil {
+			return result, err
+		}
+		return result, storage.ErrInvalidCredentials
+	}
+
+	// Deny disabled or locked users only once the password has been verified,
+	// so a user's state isn't revealed without it.
+	if user.Disabled || user.IsLocked(timeNow(u.Clock)) {
 		return result, fosite.ErrAccessDenied
 	}
 
-	err = u.Hasher.Compare(ctx, []byte(user.Password), []byte(password))
+	err = u.resetFailedLogins(ctx, &user)
 	if err != nil {
 		return result, err
 	}
@@ -329,7 +921,12 @@ func (u *UserManager) AuthenticateByUsername(ctx context.Context, username strin
 // AuthenticateMigration enables developers to supply your own
 // authentication function, which in turn, if true, will migrate the secret
 // to the Hasher implemented within fosite.
+// As with AuthenticateByID, a missing user and a wrong password are both
+// reported as storage.ErrInvalidCredentials, and a disabled or locked user is
+// denied only once the password has been verified.
 func (u *UserManager) AuthenticateMigration(ctx context.Context, currentAuth storage.AuthUserFunc, userID string, password string) (result storage.User, err error) {
+	defer classifyError(&err)
+
 	// Copy a new DB session if none specified
 	_, ok := ContextToSession(ctx)
 	if !ok {
@@ -345,87 +942,291 @@ func (u *UserManager) AuthenticateMigration(ctx context.Context, currentAuth sto
 
 	// Check for user not found
 	if user.IsEmpty() && !authenticated {
-		return result, fosite.ErrNotFound
-	}
-
-	if user.Disabled {
-		return result, fosite.ErrAccessDenied
+		u.decoy.compare(ctx, u.Hasher, password)
+		return result, storage.ErrInvalidCredentials
 	}
 
 	if !authenticated {
 		// If user isn't authenticated, try authenticating with new Hasher.
 		err := u.Hasher.Compare(ctx, user.GetHashedSecret(), []byte(password))
 		if err != nil {
-			return result, err
+			return result, storage.ErrInvalidCredentials
 		}
-		return user, nil
 	}
 
-	// If the user is found and authenticated, create a new hash using the new
-	// Hasher, update the database record and return the record with no error.
-	newHash, err := u.Hasher.Hash(ctx, []byte(password))
-	if err != nil {
-		return result, err
+	// Deny disabled or locked users only once the password has been verified,
+	// so a user's state isn't revealed without it.
+	if user.Disabled || user.IsLocked(timeNow(u.Clock)) {
+		return result, fosite.ErrAccessDenied
 	}
 
-	// Save the new hash
-	user.UpdateTime = time.Now().Unix()
-	user.Password = string(newHash)
+	if !authenticated {
+		return user, nil
+	}
+
+	// If the user is found and authenticated, update the database record with
+	// the password, which Update hashes using the new Hasher, and return the
+	// record with no error.
+	user.UpdateTime = timeNow(u.Clock).Unix()
+	user.Password = password
 
 	return u.Update(ctx, userID, user)
 }
 
 // GrantScopes grants the provided scopes to the specified User resource.
 func (u *UserManager) GrantScopes(ctx context.Context, userID string, scopes []string) (result storage.User, err error) {
-	// Copy a new DB session if none specified
-	_, ok := ContextToSession(ctx)
-	if !ok {
-		var closeSession func()
-		ctx, closeSession, err = newSession(ctx, u.DB)
+	defer classifyError(&err)
+
+	found, err := u.DB.updateScopes(ctx, storage.EntityUsers, bson.M{"id": userID}, addScopes(scopes), timeNow(u.Clock))
+	if err != nil {
+		return result, err
+	}
+	if !found {
+		return result, fosite.ErrNotFound
+	}
+
+	return u.getConcrete(ctx, userID, options.FindOne().SetProjection(userSecretsProjection))
+}
+
+// GrantScopesToMany grants the provided scopes to each of the specified User
+// resources with a single update.
+func (u *UserManager) GrantScopesToMany(ctx context.Context, userIDs []string, scopes []string) (err error) {
+	defer classifyError(&err)
+
+	if len(userIDs) == 0 || len(scopes) == 0 {
+		return nil
+	}
+
+	// Build Query
+	selector := bson.M{
+		"id": bson.M{"$in": userIDs},
+	}
+
+	_, err = u.DB.updateScopes(ctx, storage.EntityUsers, selector, addScopes(scopes), timeNow(u.Clock))
+	return err
+}
+
+// RemoveScopes revokes the provided scopes from the specified User Resource.
+func (u *UserManager) RemoveScopes(ctx context.Context, userID string, scopes []string) (result storage.User, err error) {
+	defer classifyError(&err)
+
+	found, err := u.DB.updateScopes(ctx, storage.EntityUsers, bson.M{"id": userID}, pullScopes(scopes), timeNow(u.Clock))
+	if err != nil {
+		return result, err
+	}
+	if !found {
+		return result, fosite.ErrNotFound
+	}
+
+	return u.getConcrete(ctx, userID, options.FindOne().SetProjection(userSecretsProjection))
+}
+
+// RemoveAllScopes revokes every scope from the specified User resource.
+func (u *UserManager) RemoveAllScopes(ctx context.Context, userID string) (result storage.User, err error) {
+	defer classifyError(&err)
+
+	return u.setFields(ctx, userID, bson.M{
+		"scopes": []string{},
+	})
+}
+
+// Disable prevents the specified User resource from authenticating.
+func (u *UserManager) Disable(ctx context.Context, userID string) (result storage.User, err error) {
+	defer classifyError(&err)
+
+	return u.setFields(ctx, userID, bson.M{
+		"disabled": true,
+	})
+}
+
+// Enable allows a previously disabled User resource to authenticate again.
+func (u *UserManager) Enable(ctx context.Context, userID string) (result storage.User, err error) {
+	defer classifyError(&err)
+
+	return u.setFields(ctx, userID, bson.M{
+		"disabled": false,
+	})
+}
+
+// ResetFailedLogins clears the user's failed login count and lockout, so a
+// locked out user can authenticate again.
+func (u *UserManager) ResetFailedLogins(ctx context.Context, userID string) (result storage.User, err error) {
+	defer classifyError(&err)
+
+	return u.setFields(ctx, userID, bson.M{
+		"failed_login_count": 0,
+		"locked_until":       0,
+	})
+}
+
+// SetEmailVerified sets whether the user's email address has been verified.
+func (u *UserManager) SetEmailVerified(ctx context.Context, userID string, verified bool) (result storage.User, err error) {
+	defer classifyError(&err)
+
+	return u.setFields(ctx, userID, bson.M{
+		"email_verified": verified,
+	})
+}
+
+// VerifyEmailToken marks the email address of the user holding the token as
+// verified, clearing the token so it can't be used again. Returns
+// fosite.ErrNotFound if no user holds the token, or the token has expired.
+func (u *UserManager) VerifyEmailToken(ctx context.Context, token string) (result storage.User, err error) {
+	defer classifyError(&err)
+
+	if token == "" {
+		return result, fosite.ErrNotFound
+	}
+	now := timeNow(u.Clock)
+
+	// Build Query
+	// Matching and clearing the token in a single operation ensures that
+	// concurrent requests can't both consume the token.
+	selector := bson.M{
+		"email_verification_token": token,
+		"email_verification_expiry": bson.M{
+			"$gt": now.Unix(),
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"email_verified": true,
+			"updated_at":     u.DB.timestamp(now),
+		},
+		"$unset": bson.M{
+			"email_verification_token":  "",
+			"email_verification_expiry": "",
+		},
+	}
+
+	var user storage.User
+	collection, err := u.DB.collection(ctx, storage.EntityUsers)
+	if err != nil {
+		return result, err
+	}
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetProjection(userSecretsProjection)
+	err = collection.FindOneAndUpdate(ctx, selector, update, opts).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return result, fosite.ErrNotFound
+		}
+		return result, err
+	}
+
+	return user, nil
+}
+
+// EnrollTOTP enrolls the user in TOTP based multi-factor authentication,
+// replacing any existing enrollment. The recovery codes are hashed before
+// being stored and can each be consumed once via ConsumeRecoveryCode.
+func (u *UserManager) EnrollTOTP(ctx context.Context, userID string, secret string, recoveryCodes []string) (result storage.User, err error) {
+	defer classifyError(&err)
+
+	hashedCodes := make([]string, 0, len(recoveryCodes))
+	for _, code := range recoveryCodes {
+		hash, err := u.Hasher.Hash(ctx, []byte(code))
 		if err != nil {
 			return result, err
 		}
-		defer closeSession()
+		hashedCodes = append(hashedCodes, string(hash))
 	}
 
+	return u.setFields(ctx, userID, bson.M{
+		"mfa_enabled":    true,
+		"totp_secret":    secret,
+		"recovery_codes": hashedCodes,
+	})
+}
+
+// GetTOTPSecret returns the user's TOTP secret in order to verify a second
+// factor. Returns fosite.ErrNotFound if the user hasn't enrolled in MFA.
+func (u *UserManager) GetTOTPSecret(ctx context.Context, userID string) (secret string, err error) {
+	defer classifyError(&err)
+
 	user, err := u.getConcrete(ctx, userID)
 	if err != nil {
-		if err == fosite.ErrNotFound {
-			return result, err
-		}
+		return "", err
+	}
 
-		return result, err
+	if !user.MFAEnabled || user.TOTPSecret == "" {
+		return "", fosite.ErrNotFound
 	}
 
-	// Enable access to the provided scopes...
-	user.UpdateTime = time.Now().Unix()
-	user.EnableScopeAccess(scopes...)
+	return user.TOTPSecret, nil
+}
+
+// DisableMFA removes the user's TOTP enrollment, including the TOTP secret and
+// any unused recovery codes.
+func (u *UserManager) DisableMFA(ctx context.Context, userID string) (result storage.User, err error) {
+	defer classifyError(&err)
 
-	return u.Update(ctx, user.ID, user)
+	return u.setFields(ctx, userID, bson.M{
+		"mfa_enabled":    false,
+		"totp_secret":    "",
+		"recovery_codes": []string{},
+	})
 }
 
-// RemoveScopes revokes the provided scopes from the specified User Resource.
-func (u *UserManager) RemoveScopes(ctx context.Context, userID string, scopes []string) (result storage.User, err error) {
+// ConsumeRecoveryCode confirms whether the code matches one of the user's
+// unused recovery codes, and if so, removes it so it can't be used again.
+// Returns fosite.ErrAccessDenied if the code doesn't match.
+func (u *UserManager) ConsumeRecoveryCode(ctx context.Context, userID string, code string) (err error) {
+	defer classifyError(&err)
+
 	// Copy a new DB session if none specified
 	_, ok := ContextToSession(ctx)
 	if !ok {
 		var closeSession func()
 		ctx, closeSession, err = newSession(ctx, u.DB)
 		if err != nil {
-			return result, err
+			return err
 		}
 		defer closeSession()
 	}
+
 	user, err := u.getConcrete(ctx, userID)
 	if err != nil {
-		if err == fosite.ErrNotFound {
-			return result, err
+		return err
+	}
+
+	for _, hash := range user.RecoveryCodes {
+		if u.Hasher.Compare(ctx, []byte(hash), []byte(code)) != nil {
+			continue
 		}
-		return result, err
+
+		// Build Query
+		// The code is only pulled if it's still present, so that concurrent
+		// requests can't both consume the same code.
+		selector := bson.M{
+			"id":             userID,
+			"recovery_codes": hash,
+		}
+		update := bson.M{
+			"$pull": bson.M{
+				"recovery_codes": hash,
+			},
+			"$set": bson.M{
+				"updated_at": u.DB.timestamp(timeNow(u.Clock)),
+			},
+		}
+
+		collection, err := u.DB.collection(ctx, storage.EntityUsers)
+		if err != nil {
+			return err
+		}
+		res, err := collection.UpdateOne(ctx, selector, update)
+		if err != nil {
+			return err
+		}
+
+		if res.ModifiedCount == 0 {
+			return fosite.ErrAccessDenied
+		}
+
+		return nil
 	}
 
-	// Disable access to the provided scopes...
-	user.UpdateTime = time.Now().Unix()
-	user.DisableScopeAccess(scopes...)
-	return u.Update(ctx, user.ID, user)
+	return fosite.ErrAccessDenied
 }
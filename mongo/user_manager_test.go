@@ -3,7 +3,11 @@ package mongo_test
 import (
 	// Standard Library Imports
 	"context"
+	"errors"
+	"fmt"
 	"reflect"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
@@ -76,6 +80,57 @@ func TestUserManager_Create(t *testing.T) {
 	createUser(ctx, t, store)
 }
 
+func TestUserManager_Create_ShouldUseIDGenerator(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.IDGenerator = sequentialIDs("usr_")
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	for i, expected := range []string{"usr_1", "usr_2"} {
+		user := expectedUser()
+		user.ID = ""
+		user.Username = fmt.Sprintf("user%d@example.com", i)
+
+		got, err := store.UserManager.Create(ctx, user)
+		if err != nil {
+			AssertFatal(t, err, nil, "create should return no database errors")
+		}
+		if got.ID != expected {
+			AssertError(t, got.ID, expected, "create should use the configured id generator")
+		}
+	}
+}
+
+func TestUserManager_ShouldUseClock(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cfg := mongo.DefaultConfig()
+	cfg.Clock = frozenClock(&now)
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	user := expectedUser()
+	user.CreateTime = 0
+	user.UpdateTime = 0
+
+	got, err := store.UserManager.Create(ctx, user)
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+	if got.CreateTime != now.Unix() {
+		AssertError(t, got.CreateTime, now.Unix(), "create time should be set from the clock")
+	}
+
+	now = now.Add(time.Hour)
+	got.FirstName = "Bob"
+	got, err = store.UserManager.Update(ctx, got.ID, got)
+	if err != nil {
+		AssertFatal(t, err, nil, "update should return no database errors")
+	}
+	if got.UpdateTime != now.Unix() {
+		AssertError(t, got.UpdateTime, now.Unix(), "update time should be set from the clock")
+	}
+}
+
 func TestUserManager_Create_ShouldConflict(t *testing.T) {
 	store, ctx, teardown := setup(t)
 	defer teardown()
@@ -105,6 +160,87 @@ func TestUserManager_Create_ShouldConflictOnUsername(t *testing.T) {
 	}
 }
 
+// usernamePolicy vetoes creating users with a reserved username, and deleting
+// users while deletes are frozen.
+type usernamePolicy struct {
+	storage.NopHooks[storage.User]
+
+	freezeDeletes bool
+	deleted       []string
+}
+
+var (
+	errReservedUsername = errors.New("reserved username")
+	errDeletesFrozen    = errors.New("deletes frozen")
+)
+
+func (p *usernamePolicy) BeforeCreate(_ context.Context, user storage.User) error {
+	if user.Username == "root" {
+		return errReservedUsername
+	}
+	return nil
+}
+
+func (p *usernamePolicy) BeforeDelete(_ context.Context, _ string) error {
+	if p.freezeDeletes {
+		return errDeletesFrozen
+	}
+	return nil
+}
+
+func (p *usernamePolicy) AfterDelete(_ context.Context, userID string) {
+	p.deleted = append(p.deleted, userID)
+}
+
+func TestUserManager_Hooks(t *testing.T) {
+	policy := &usernamePolicy{}
+	cfg := mongo.DefaultConfig()
+	cfg.UserHooks = policy
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	reserved := expectedUser()
+	reserved.Username = "root"
+	_, err := store.UserManager.Create(ctx, reserved)
+	if !errors.Is(err, errReservedUsername) {
+		AssertError(t, err, errReservedUsername, "create should be vetoed by the hook")
+	}
+	_, err = store.UserManager.Get(ctx, reserved.ID)
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "a vetoed user should not be stored")
+	}
+
+	_, err = store.UserManager.Migrate(ctx, reserved)
+	if !errors.Is(err, errReservedUsername) {
+		AssertError(t, err, errReservedUsername, "migrate should be vetoed by the hook")
+	}
+	_, err = store.UserManager.Get(ctx, reserved.ID)
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "a vetoed migration should not be stored")
+	}
+
+	expected := createUser(ctx, t, store)
+
+	policy.freezeDeletes = true
+	err = store.UserManager.Delete(ctx, expected.ID)
+	if !errors.Is(err, errDeletesFrozen) {
+		AssertError(t, err, errDeletesFrozen, "delete should be vetoed by the hook")
+	}
+	_, err = store.UserManager.Get(ctx, expected.ID)
+	if err != nil {
+		AssertError(t, err, nil, "a vetoed delete should leave the user in place")
+	}
+
+	policy.freezeDeletes = false
+	err = store.UserManager.Delete(ctx, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "delete should return no database errors")
+	}
+	if !reflect.DeepEqual(policy.deleted, []string{expected.ID}) {
+		AssertError(t, policy.deleted, []string{expected.ID}, "after delete should be called with the deleted user's id")
+	}
+}
+
 func TestUserManager_Get(t *testing.T) {
 	store, ctx, teardown := setup(t)
 	defer teardown()
@@ -130,6 +266,33 @@ func TestUserManager_Get_ShouldReturnNotFound(t *testing.T) {
 	}
 }
 
+func TestUserManager_UsernameExists(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	expected := createUser(ctx, t, store)
+	got, err := store.UserManager.UsernameExists(ctx, expected.Username)
+	if err != nil {
+		AssertError(t, err, nil, "username exists should return no database errors")
+	}
+	if !got {
+		AssertError(t, got, true, "username exists should return true for a stored user")
+	}
+}
+
+func TestUserManager_UsernameExists_ShouldReturnFalse(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	got, err := store.UserManager.UsernameExists(ctx, "lolNotFound")
+	if err != nil {
+		AssertError(t, err, nil, "username exists should return no database errors")
+	}
+	if got {
+		AssertError(t, got, false, "username exists should return false for a missing user")
+	}
+}
+
 func TestUserManager_Update(t *testing.T) {
 	store, ctx, teardown := setup(t)
 	defer teardown()
@@ -209,6 +372,45 @@ func TestUserManager_Update_ShouldChangePassword(t *testing.T) {
 	}
 }
 
+func TestUserManager_UpdatePassword(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	user := createUser(ctx, t, store)
+
+	// Setting the stored hash as the password must still rehash it, unlike
+	// Update which would treat it as the existing hash.
+	for _, newPassword := range []string{"s0methingElse!", user.Password} {
+		err := store.UserManager.UpdatePassword(ctx, user.ID, newPassword)
+		if err != nil {
+			AssertFatal(t, err, nil, "update password should return no database errors")
+		}
+
+		got, err := store.UserManager.AuthenticateByID(ctx, user.ID, newPassword)
+		if err != nil {
+			AssertError(t, err, nil, "should authenticate with the new password")
+		}
+		if got.UpdateTime == user.UpdateTime {
+			AssertError(t, got.UpdateTime, "a new update time", "update time should be bumped")
+		}
+	}
+
+	_, err := store.UserManager.AuthenticateByID(ctx, user.ID, "foobar")
+	if err == nil {
+		AssertError(t, err, storage.ErrInvalidCredentials, "should not authenticate with the old password")
+	}
+}
+
+func TestUserManager_UpdatePassword_ShouldReturnNotFound(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	err := store.UserManager.UpdatePassword(ctx, uuid.NewString(), "s0methingElse!")
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "update password should return not found")
+	}
+}
+
 func TestUserManager_Update_ShouldConflictUsername(t *testing.T) {
 	store, ctx, teardown := setup(t)
 	defer teardown()
@@ -286,3 +488,753 @@ func TestUserManager_Delete_ShouldReturnNotFound(t *testing.T) {
 		AssertError(t, err, nil, "delete should return not found")
 	}
 }
+
+func TestUserManager_Configure_ShouldIndexSearchTermsDespiteIndexConflicts(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	// Stores created before usernames could be reused hold a fully unique
+	// username index, which conflicts with the current index.
+	collection := store.DB.Collection(storage.EntityUsers)
+	_, err := collection.Indexes().DropOne(ctx, mongo.IdxUsername)
+	if err != nil {
+		AssertFatal(t, err, nil, "drop index should return no database errors")
+	}
+	_, err = collection.Indexes().CreateOne(ctx, mongo.NewUniqueIndex(mongo.IdxUsername, "username"))
+	if err != nil {
+		AssertFatal(t, err, nil, "create index should return no database errors")
+	}
+
+	// Users stored before users were searched by term have no search terms.
+	expected := expectedUser()
+	expected.FirstName = "Legacy"
+	_, err = collection.InsertOne(ctx, expected)
+	if err != nil {
+		AssertFatal(t, err, nil, "insert should return no database errors")
+	}
+
+	err = store.UserManager.Configure(ctx)
+	if !errors.Is(err, mongo.ErrIndexConflict) {
+		AssertError(t, err, mongo.ErrIndexConflict, "configure should report the conflicting username index")
+	}
+
+	got, err := store.UserManager.List(ctx, storage.ListUsersRequest{Search: "legacy"})
+	if err != nil {
+		AssertFatal(t, err, nil, "list should return no database errors")
+	}
+	if len(got) != 1 || got[0].ID != expected.ID {
+		AssertError(t, got, []storage.User{expected}, "existing users should be searchable despite the index conflict")
+	}
+}
+
+func TestUserManager_List_ShouldSearch(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	john := createUser(ctx, t, store)
+
+	jane := expectedUser()
+	jane.Username = "jane.smith@example.org"
+	jane.FirstName = "Jane"
+	jane.LastName = "Smith"
+	jane, err := store.UserManager.Create(ctx, jane)
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	tests := []struct {
+		name   string
+		search string
+		want   []string
+	}{
+		{
+			name:   "should match a partial first name, ignoring case",
+			search: "joh",
+			want:   []string{john.ID},
+		},
+		{
+			name:   "should match a partial last name",
+			search: "SMI",
+			want:   []string{jane.ID},
+		},
+		{
+			name:   "should match a partial email",
+			search: "jane.smith@",
+			want:   []string{jane.ID},
+		},
+		{
+			name:   "should match a partial email domain",
+			search: "example",
+			want:   []string{john.ID, jane.ID},
+		},
+		{
+			name:   "should only match from the start of a word",
+			search: "mit",
+			want:   nil,
+		},
+		{
+			name:   "should treat the search term literally",
+			search: "j.*",
+			want:   nil,
+		},
+		{
+			name:   "should return empty if no users match",
+			search: "kitteh",
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.UserManager.List(ctx, storage.ListUsersRequest{Search: tt.search})
+			if err != nil {
+				AssertFatal(t, err, nil, "list should return no database errors")
+			}
+
+			var gotIDs []string
+			for _, user := range got {
+				gotIDs = append(gotIDs, user.ID)
+			}
+			sort.Strings(gotIDs)
+			want := append([]string(nil), tt.want...)
+			sort.Strings(want)
+			if !reflect.DeepEqual(gotIDs, want) {
+				AssertError(t, gotIDs, want, "search returned unexpected users")
+			}
+		})
+	}
+}
+
+func TestUserManager_GetByPersonID(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	expected := createUser(ctx, t, store)
+	got, err := store.UserManager.GetByPersonID(ctx, expected.PersonID)
+	if err != nil {
+		AssertFatal(t, err, nil, "get by person id should return no database errors")
+	}
+	if !got.Equal(expected) {
+		AssertError(t, got, expected, "get by person id returned an unexpected user")
+	}
+}
+
+func TestUserManager_GetByPersonID_ShouldReturnNotFound(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	_, err := store.UserManager.GetByPersonID(ctx, "lolNotFound")
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "get by person id should return not found")
+	}
+}
+
+func TestUserManager_GetByPersonID_ShouldReturnMultipleResults(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	expected := createUser(ctx, t, store)
+
+	duplicate := expectedUser()
+	duplicate.Username = "duplicate@example.com"
+	duplicate.PersonID = expected.PersonID
+	_, err := store.UserManager.Create(ctx, duplicate)
+	if err != nil {
+		AssertFatal(t, err, nil, "create should allow shared person ids when not unique")
+	}
+
+	_, err = store.UserManager.GetByPersonID(ctx, expected.PersonID)
+	if err != storage.ErrMultipleResults {
+		AssertError(t, err, storage.ErrMultipleResults, "get by person id should report multiple matches")
+	}
+}
+
+func TestUserManager_Create_ShouldConflictOnUniquePersonID(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.UniquePersonID = true
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	expected := createUser(ctx, t, store)
+
+	duplicate := expectedUser()
+	duplicate.Username = "duplicate@example.com"
+	duplicate.PersonID = expected.PersonID
+	_, err := store.UserManager.Create(ctx, duplicate)
+	if err != storage.ErrResourceExists {
+		AssertError(t, err, storage.ErrResourceExists, "create should conflict on a duplicate person id")
+	}
+
+	// Users without a person ID should not conflict with each other.
+	for i := 0; i < 2; i++ {
+		user := expectedUser()
+		user.Username = fmt.Sprintf("unlinked-%d@example.com", i)
+		user.PersonID = ""
+		_, err = store.UserManager.Create(ctx, user)
+		if err != nil {
+			AssertError(t, err, nil, "users without a person id should not conflict")
+		}
+	}
+}
+
+func TestUserManager_GrantScopes_ShouldKeepConcurrentGrants(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	expected := createUser(ctx, t, store)
+	scopes := []string{"urn:test:birds:read", "urn:test:fish:read", "urn:test:frogs:read", "urn:test:mice:read"}
+
+	// Each grant runs in its own mongo session, as concurrent admin requests
+	// would.
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, scope := range scopes {
+		wg.Add(1)
+		go func(scope string) {
+			defer wg.Done()
+			<-start
+			_, err := store.UserManager.GrantScopes(context.Background(), expected.ID, []string{scope})
+			if err != nil {
+				AssertError(t, err, nil, "grant scopes should return no database errors")
+			}
+		}(scope)
+	}
+	close(start)
+	wg.Wait()
+
+	got, err := store.UserManager.Get(ctx, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "get should return no database errors")
+	}
+	expected.EnableScopeAccess(scopes...)
+	sort.Strings(got.Scopes)
+	sort.Strings(expected.Scopes)
+	if !reflect.DeepEqual(got.Scopes, expected.Scopes) {
+		AssertError(t, got.Scopes, expected.Scopes, "concurrent grants should all survive")
+	}
+}
+
+func TestUserManager_GrantScopesToMany(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cfg := mongo.DefaultConfig()
+	cfg.Clock = frozenClock(&now)
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	first := createUser(ctx, t, store)
+	second := createUser(ctx, t, store)
+	untargeted := createUser(ctx, t, store)
+
+	userIDs := []string{first.ID, second.ID, "lolNotFound"}
+	err := store.UserManager.GrantScopesToMany(ctx, userIDs, []string{"urn:test:cats:write", "urn:test:birds:read"})
+	if err != nil {
+		AssertFatal(t, err, nil, "grant scopes to many should return no database errors")
+	}
+
+	for _, expected := range []storage.User{first, second} {
+		got, err := store.UserManager.Get(ctx, expected.ID)
+		if err != nil {
+			AssertFatal(t, err, nil, "get should return no database errors")
+		}
+
+		expected.EnableScopeAccess("urn:test:cats:write", "urn:test:birds:read")
+		expected.UpdateTime = now.Unix()
+		if !got.Equal(expected) {
+			AssertError(t, got, expected, "grant scopes to many should add the missing scopes without duplicates")
+		}
+	}
+
+	got, err := store.UserManager.Get(ctx, untargeted.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "get should return no database errors")
+	}
+	if !got.Equal(untargeted) {
+		AssertError(t, got, untargeted, "grant scopes to many should leave other users untouched")
+	}
+}
+
+func TestUserManager_RemoveAllScopes(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cfg := mongo.DefaultConfig()
+	cfg.Clock = frozenClock(&now)
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	expected := createUser(ctx, t, store)
+	if len(expected.Scopes) == 0 {
+		AssertFatal(t, expected.Scopes, "scopes", "the user under test should have scopes to remove")
+	}
+
+	got, err := store.UserManager.RemoveAllScopes(ctx, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "remove all scopes should return no database errors")
+	}
+
+	expected.Scopes = []string{}
+	expected.UpdateTime = now.Unix()
+	if !got.Equal(expected) {
+		AssertError(t, got, expected, "remove all scopes should only empty the scopes and bump the update time")
+	}
+
+	stored, err := store.UserManager.Get(ctx, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "get should return no database errors")
+	}
+	if !stored.Equal(expected) {
+		AssertError(t, stored, expected, "remove all scopes should persist the emptied scopes")
+	}
+}
+
+func TestUserManager_RemoveAllScopes_ShouldReturnNotFound(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	_, err := store.UserManager.RemoveAllScopes(ctx, "lolNotFound")
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "remove all scopes should return not found")
+	}
+}
+
+func TestUserManager_DisableEnable(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	expected := createUser(ctx, t, store)
+
+	got, err := store.UserManager.Disable(ctx, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "disable should return no database errors")
+	}
+	if !got.Disabled {
+		AssertError(t, got.Disabled, true, "disable should disable the user")
+	}
+
+	_, err = store.UserManager.AuthenticateByID(ctx, expected.ID, "foobar")
+	if err != fosite.ErrAccessDenied {
+		AssertError(t, err, fosite.ErrAccessDenied, "a disabled user should not authenticate")
+	}
+
+	got, err = store.UserManager.Enable(ctx, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "enable should return no database errors")
+	}
+	if got.Disabled {
+		AssertError(t, got.Disabled, false, "enable should re-enable the user")
+	}
+
+	_, err = store.UserManager.AuthenticateByID(ctx, expected.ID, "foobar")
+	if err != nil {
+		AssertError(t, err, nil, "a re-enabled user should authenticate")
+	}
+}
+
+func TestUserManager_Get_ShouldExcludeDisabled(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	expected := createUser(ctx, t, store)
+	_, err := store.UserManager.Disable(ctx, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "disable should return no database errors")
+	}
+
+	_, err = store.UserManager.Get(ctx, expected.ID)
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "get should exclude disabled users")
+	}
+	_, err = store.UserManager.GetByUsername(ctx, expected.Username)
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "get by username should exclude disabled users")
+	}
+	_, err = store.UserManager.Authenticate(ctx, expected.Username, "foobar")
+	if err != storage.ErrInvalidCredentials {
+		AssertError(t, err, storage.ErrInvalidCredentials, "a disabled user should not be found to authenticate")
+	}
+
+	includeDisabled := storage.WithIncludeDisabled(ctx)
+	got, err := store.UserManager.Get(includeDisabled, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "get should include disabled users when requested")
+	}
+	if !got.Disabled {
+		AssertError(t, got.Disabled, true, "get should return the disabled user")
+	}
+	got, err = store.UserManager.GetByUsername(includeDisabled, expected.Username)
+	if err != nil {
+		AssertFatal(t, err, nil, "get by username should include disabled users when requested")
+	}
+	if got.ID != expected.ID {
+		AssertError(t, got.ID, expected.ID, "get by username should return the disabled user")
+	}
+	_, err = store.UserManager.Authenticate(includeDisabled, expected.Username, "foobar")
+	if err != fosite.ErrAccessDenied {
+		AssertError(t, err, fosite.ErrAccessDenied, "an included disabled user should not authenticate")
+	}
+}
+
+func TestUserManager_DisableEnable_ShouldReturnNotFound(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	_, err := store.UserManager.Disable(ctx, "lolNotFound")
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "disable should return not found")
+	}
+
+	_, err = store.UserManager.Enable(ctx, "lolNotFound")
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "enable should return not found")
+	}
+}
+
+func TestUserManager_EnrollTOTP(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	expected := createUser(ctx, t, store)
+	secret := "JBSWY3DPEHPK3PXP"
+
+	got, err := store.UserManager.EnrollTOTP(ctx, expected.ID, secret, []string{"code-1", "code-2"})
+	if err != nil {
+		AssertFatal(t, err, nil, "enroll should return no database errors")
+	}
+	if !got.MFAEnabled {
+		AssertError(t, got.MFAEnabled, true, "enroll should enable mfa")
+	}
+	if got.TOTPSecret != "" || got.RecoveryCodes != nil {
+		AssertError(t, got, "no mfa secrets", "enroll should not return the mfa secrets")
+	}
+
+	stored, err := store.UserManager.Get(ctx, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "get should return no database errors")
+	}
+	if !stored.MFAEnabled {
+		AssertError(t, stored.MFAEnabled, true, "get should report mfa as enabled")
+	}
+	if stored.TOTPSecret != "" || stored.RecoveryCodes != nil {
+		AssertError(t, stored, "no mfa secrets", "get should not return the mfa secrets")
+	}
+
+	users, err := store.UserManager.List(ctx, storage.ListUsersRequest{PersonID: expected.PersonID})
+	if err != nil {
+		AssertFatal(t, err, nil, "list should return no database errors")
+	}
+	for _, user := range users {
+		if user.TOTPSecret != "" || user.RecoveryCodes != nil {
+			AssertError(t, user, "no mfa secrets", "list should not return the mfa secrets")
+		}
+	}
+
+	gotSecret, err := store.UserManager.GetTOTPSecret(ctx, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "get totp secret should return no database errors")
+	}
+	if gotSecret != secret {
+		AssertError(t, gotSecret, secret, "get totp secret should return the enrolled secret")
+	}
+
+	// Updating the user should not clobber the enrollment.
+	stored.FirstName = "Bob"
+	_, err = store.UserManager.Update(ctx, stored.ID, stored)
+	if err != nil {
+		AssertFatal(t, err, nil, "update should return no database errors")
+	}
+	gotSecret, err = store.UserManager.GetTOTPSecret(ctx, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "get totp secret should return no database errors")
+	}
+	if gotSecret != secret {
+		AssertError(t, gotSecret, secret, "update should preserve the enrolled secret")
+	}
+}
+
+func TestUserManager_DisableMFA(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	expected := createUser(ctx, t, store)
+	_, err := store.UserManager.EnrollTOTP(ctx, expected.ID, "JBSWY3DPEHPK3PXP", []string{"code-1"})
+	if err != nil {
+		AssertFatal(t, err, nil, "enroll should return no database errors")
+	}
+
+	got, err := store.UserManager.DisableMFA(ctx, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "disable mfa should return no database errors")
+	}
+	if got.MFAEnabled {
+		AssertError(t, got.MFAEnabled, false, "disable mfa should disable mfa")
+	}
+
+	_, err = store.UserManager.GetTOTPSecret(ctx, expected.ID)
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "disable mfa should remove the totp secret")
+	}
+
+	err = store.UserManager.ConsumeRecoveryCode(ctx, expected.ID, "code-1")
+	if err != fosite.ErrAccessDenied {
+		AssertError(t, err, fosite.ErrAccessDenied, "disable mfa should remove the recovery codes")
+	}
+}
+
+func TestUserManager_ConsumeRecoveryCode(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	expected := createUser(ctx, t, store)
+	_, err := store.UserManager.EnrollTOTP(ctx, expected.ID, "JBSWY3DPEHPK3PXP", []string{"code-1", "code-2"})
+	if err != nil {
+		AssertFatal(t, err, nil, "enroll should return no database errors")
+	}
+
+	err = store.UserManager.ConsumeRecoveryCode(ctx, expected.ID, "lolNotACode")
+	if err != fosite.ErrAccessDenied {
+		AssertError(t, err, fosite.ErrAccessDenied, "an unknown recovery code should be denied")
+	}
+
+	err = store.UserManager.ConsumeRecoveryCode(ctx, expected.ID, "code-1")
+	if err != nil {
+		AssertFatal(t, err, nil, "a valid recovery code should be consumed")
+	}
+
+	err = store.UserManager.ConsumeRecoveryCode(ctx, expected.ID, "code-1")
+	if err != fosite.ErrAccessDenied {
+		AssertError(t, err, fosite.ErrAccessDenied, "a recovery code should only be consumed once")
+	}
+
+	err = store.UserManager.ConsumeRecoveryCode(ctx, expected.ID, "code-2")
+	if err != nil {
+		AssertError(t, err, nil, "other recovery codes should remain usable")
+	}
+}
+
+// createUnverifiedUser creates a user with a pending email verification token
+// that expires after the provided time.
+func createUnverifiedUser(ctx context.Context, t *testing.T, store *mongo.Store, token string, expiresAt time.Time) storage.User {
+	user := expectedUser()
+	user.EmailVerificationToken = token
+	user.EmailVerificationExpiry = expiresAt.Unix()
+
+	got, err := store.UserManager.Create(ctx, user)
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	return got
+}
+
+func TestUserManager_SetEmailVerified(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	expected := createUser(ctx, t, store)
+
+	got, err := store.UserManager.SetEmailVerified(ctx, expected.ID, true)
+	if err != nil {
+		AssertFatal(t, err, nil, "set email verified should return no database errors")
+	}
+	if !got.EmailVerified {
+		AssertError(t, got.EmailVerified, true, "set email verified should verify the email")
+	}
+
+	got, err = store.UserManager.SetEmailVerified(ctx, expected.ID, false)
+	if err != nil {
+		AssertFatal(t, err, nil, "set email verified should return no database errors")
+	}
+	if got.EmailVerified {
+		AssertError(t, got.EmailVerified, false, "set email verified should unverify the email")
+	}
+
+	_, err = store.UserManager.SetEmailVerified(ctx, "lolNotFound", true)
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "set email verified should return not found")
+	}
+}
+
+func TestUserManager_VerifyEmailToken(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cfg := mongo.DefaultConfig()
+	cfg.Clock = frozenClock(&now)
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	token := uuid.NewString()
+	expected := createUnverifiedUser(ctx, t, store, token, now.Add(time.Hour))
+
+	got, err := store.UserManager.VerifyEmailToken(ctx, token)
+	if err != nil {
+		AssertFatal(t, err, nil, "verify email token should return no database errors")
+	}
+	if got.ID != expected.ID {
+		AssertError(t, got.ID, expected.ID, "verify email token should return the token holder")
+	}
+	if !got.EmailVerified {
+		AssertError(t, got.EmailVerified, true, "verify email token should verify the email")
+	}
+	if got.EmailVerificationToken != "" || got.EmailVerificationExpiry != 0 {
+		AssertError(t, got, "cleared token", "verify email token should clear the token")
+	}
+}
+
+func TestUserManager_VerifyEmailToken_ShouldRejectExpiredToken(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cfg := mongo.DefaultConfig()
+	cfg.Clock = frozenClock(&now)
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	token := uuid.NewString()
+	expected := createUnverifiedUser(ctx, t, store, token, now.Add(time.Hour))
+
+	now = now.Add(2 * time.Hour)
+	_, err := store.UserManager.VerifyEmailToken(ctx, token)
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "an expired token should not verify the email")
+	}
+
+	got, err := store.UserManager.Get(ctx, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "get should return no database errors")
+	}
+	if got.EmailVerified {
+		AssertError(t, got.EmailVerified, false, "an expired token should leave the email unverified")
+	}
+}
+
+func TestUserManager_VerifyEmailToken_ShouldRejectReusedToken(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cfg := mongo.DefaultConfig()
+	cfg.Clock = frozenClock(&now)
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	token := uuid.NewString()
+	createUnverifiedUser(ctx, t, store, token, now.Add(time.Hour))
+
+	_, err := store.UserManager.VerifyEmailToken(ctx, token)
+	if err != nil {
+		AssertFatal(t, err, nil, "verify email token should return no database errors")
+	}
+
+	_, err = store.UserManager.VerifyEmailToken(ctx, token)
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "a token should only be used once")
+	}
+}
+
+func TestUserManager_Create_ShouldReuseDisabledUsername(t *testing.T) {
+	store, ctx, teardown := setup(t)
+	defer teardown()
+
+	disabled := createUser(ctx, t, store)
+	_, err := store.UserManager.Disable(ctx, disabled.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "disable should return no database errors")
+	}
+
+	exists, err := store.UserManager.UsernameExists(ctx, disabled.Username)
+	if err != nil || exists {
+		AssertError(t, exists, false, "the username of a disabled user should be free to reuse")
+	}
+
+	reused := expectedUser()
+	reused.Username = disabled.Username
+	reused, err = store.UserManager.Create(ctx, reused)
+	if err != nil {
+		AssertFatal(t, err, nil, "create should reuse the username of a disabled user")
+	}
+
+	got, err := store.UserManager.GetByUsername(ctx, disabled.Username)
+	if err != nil {
+		AssertFatal(t, err, nil, "get by username should return no database errors")
+	}
+	if got.ID != reused.ID {
+		AssertError(t, got.ID, reused.ID, "get by username should prefer the enabled user")
+	}
+
+	duplicate := expectedUser()
+	duplicate.Username = disabled.Username
+	_, err = store.UserManager.Create(ctx, duplicate)
+	if err != storage.ErrResourceExists {
+		AssertError(t, err, storage.ErrResourceExists, "create should keep enabled usernames unique")
+	}
+
+	_, err = store.UserManager.Enable(ctx, disabled.ID)
+	if err != storage.ErrResourceExists {
+		AssertError(t, err, storage.ErrResourceExists, "enable should conflict with the user reusing the username")
+	}
+}
+
+func TestUserManager_EffectiveScopes(t *testing.T) {
+	cfg := mongo.DefaultConfig()
+	cfg.RoleScopes = map[string][]string{
+		"admin": {"users:read", "users:write"},
+	}
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	user, err := store.UserManager.Create(ctx, storage.User{
+		ID:       uuid.NewString(),
+		Username: uuid.NewString(),
+		Password: "foobar",
+		Scopes:   []string{"openid", "users:read"},
+		Roles:    []string{"admin"},
+	})
+	if err != nil {
+		AssertFatal(t, err, nil, "create should return no database errors")
+	}
+
+	got, err := store.UserManager.EffectiveScopes(ctx, user.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "effective scopes should return no database errors")
+	}
+	expected := []string{"openid", "users:read", "users:write"}
+	if !reflect.DeepEqual(got, expected) {
+		AssertError(t, got, expected, "effective scopes should include role-derived scopes")
+	}
+
+	_, err = store.UserManager.EffectiveScopes(ctx, uuid.NewString())
+	if err != fosite.ErrNotFound {
+		AssertError(t, err, fosite.ErrNotFound, "effective scopes should return not found")
+	}
+}
+
+func TestUserManager_MaxFailedLogins_ShouldLockOutUsers(t *testing.T) {
+	now := time.Now()
+	cfg := mongo.DefaultConfig()
+	cfg.Clock = frozenClock(&now)
+	cfg.MaxFailedLogins = 3
+	cfg.LockoutDuration = time.Minute
+	store, ctx, teardown := setupWithConfig(t, cfg)
+	defer teardown()
+
+	expected := createUser(ctx, t, store)
+
+	for i := 0; i < 3; i++ {
+		_, err := store.UserManager.AuthenticateByID(ctx, expected.ID, "wrong")
+		if !errors.Is(err, storage.ErrInvalidCredentials) {
+			AssertError(t, err, storage.ErrInvalidCredentials, "authenticate with a wrong password should fail")
+		}
+	}
+	_, err := store.UserManager.AuthenticateByID(ctx, expected.ID, "foobar")
+	if !errors.Is(err, fosite.ErrAccessDenied) {
+		AssertError(t, err, fosite.ErrAccessDenied, "authenticate should be denied once the threshold is reached")
+	}
+	got, err := store.UserManager.Get(ctx, expected.ID)
+	if err != nil {
+		AssertFatal(t, err, nil, "get should return no database errors")
+	}
+	if want := now.Add(time.Minute).Unix(); got.LockedUntil != want {
+		AssertError(t, got.LockedUntil, want, "the user should be locked out for the lockout duration")
+	}
+
+	now = now.Add(time.Minute + time.Second)
+	got, err = store.UserManager.AuthenticateByID(ctx, expected.ID, "foobar")
+	if err != nil {
+		AssertFatal(t, err, nil, "authenticate once the lockout has ended should return no errors")
+	}
+	if got.FailedLoginCount != 0 || got.LockedUntil != 0 {
+		AssertError(t, got.LockedUntil, 0, "authenticate should clear the failed logins and ended lockout")
+	}
+}
@@ -0,0 +1,25 @@
+package storage
+
+import (
+	// Standard Library Imports
+	"time"
+)
+
+// Nonce provides the structure for a used OpenID Connect nonce, recorded in
+// order to deny replays within the nonce's validity window.
+type Nonce struct {
+	Nonce     string    `bson:"-" json:"-" xml:"-"`
+	ClientID  string    `bson:"client_id" json:"clientId" xml:"clientId"`
+	Signature string    `bson:"signature" json:"signature" xml:"signature"`
+	ExpiresAt time.Time `bson:"expires_at" json:"expiresAt" xml:"expiresAt"`
+}
+
+// NewNonce returns a new nonce to be consumed.
+func NewNonce(clientID string, nonce string, expiresAt time.Time) Nonce {
+	return Nonce{
+		Nonce:     nonce,
+		ClientID:  clientID,
+		Signature: SignatureFromJTI(nonce),
+		ExpiresAt: expiresAt,
+	}
+}
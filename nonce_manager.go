@@ -0,0 +1,23 @@
+package storage
+
+import (
+	// Standard Library Imports
+	"context"
+	"time"
+)
+
+// NonceManager provides a generic interface to nonces in order to build a
+// Datastore backend.
+type NonceManager interface {
+	Configure
+	NonceStore
+}
+
+// NonceStore enables recording used OpenID Connect nonces in order to prevent
+// authorization response replay.
+type NonceStore interface {
+	// ConsumeNonce records the nonce as used by the client until it expires.
+	// ErrNonceReplayed is returned if the nonce has already been used within
+	// its validity window.
+	ConsumeNonce(ctx context.Context, clientID string, nonce string, expiresAt time.Time) error
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	// Standard Library Imports
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RequestCursor marks a position within a listing of requests, which are
+// ordered by the time they were requested, then by ID. Unlike an offset, a
+// cursor keeps its place as requests are created or removed between pages.
+type RequestCursor struct {
+	// RequestedAt is the time the last request on the page was made.
+	RequestedAt time.Time
+	// ID is the ID of the last request on the page.
+	ID string
+}
+
+// String encodes the cursor into an opaque token, which can be provided as
+// ListRequestsRequest.After to fetch the following page.
+func (c RequestCursor) String() string {
+	token := strconv.FormatInt(c.RequestedAt.UnixNano(), 10) + ":" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(token))
+}
+
+// ParseRequestCursor decodes a token produced by RequestCursor.String,
+// returning ErrInvalidCursor if the token is malformed.
+func ParseRequestCursor(token string) (cursor RequestCursor, err error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+
+	nanos, id, found := strings.Cut(string(decoded), ":")
+	if !found || id == "" {
+		return cursor, ErrInvalidCursor
+	}
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+
+	cursor.RequestedAt = time.Unix(0, unixNano).UTC()
+	cursor.ID = id
+	return cursor, nil
+}
+
+// NextAfter returns the token to provide as ListRequestsRequest.After in order
+// to list the requests following this one.
+func (r *Request) NextAfter() string {
+	return RequestCursor{RequestedAt: r.RequestedAt, ID: r.ID}.String()
+}
+
+// NextAfter returns the token to provide as ListClientsRequest.After in order
+// to list the clients following this one.
+func (c *Client) NextAfter() string {
+	return c.ID
+}
+
+// NextAfter returns the token to provide as ListUsersRequest.After in order to
+// list the users following this one.
+func (u *User) NextAfter() string {
+	return u.ID
+}
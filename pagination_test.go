@@ -0,0 +1,55 @@
+package storage
+
+import (
+	// Standard Library Imports
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRequestCursor_ShouldRoundTrip(t *testing.T) {
+	expected := RequestCursor{
+		RequestedAt: time.Date(2023, 4, 5, 6, 7, 8, 123456789, time.UTC),
+		ID:          "c9a5b4d2-4a3f-4d0e-9f4c-6c1c1d8a7b5e",
+	}
+
+	got, err := ParseRequestCursor(expected.String())
+	if err != nil {
+		t.Fatalf("ParseRequestCursor() error = %v", err)
+	}
+	if !got.RequestedAt.Equal(expected.RequestedAt) || got.ID != expected.ID {
+		t.Errorf("ParseRequestCursor() got: %+v, expected: %+v", got, expected)
+	}
+}
+
+func TestRequest_NextAfter(t *testing.T) {
+	request := Request{
+		ID:          "c9a5b4d2-4a3f-4d0e-9f4c-6c1c1d8a7b5e",
+		RequestedAt: time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC),
+	}
+
+	got, err := ParseRequestCursor(request.NextAfter())
+	if err != nil {
+		t.Fatalf("ParseRequestCursor() error = %v", err)
+	}
+	if !got.RequestedAt.Equal(request.RequestedAt) || got.ID != request.ID {
+		t.Errorf("NextAfter() got: %+v, expected the request's position", got)
+	}
+}
+
+func TestParseRequestCursor_ShouldRejectMalformedTokens(t *testing.T) {
+	tokens := []string{
+		"",
+		"not a cursor",
+		"MTIzNDU",    // 12345, missing the ID
+		"MTIzNDU6",   // 12345:, with an empty ID
+		"YWJjOmRlZg", // abc:def, with a non-numeric time
+	}
+
+	for _, token := range tokens {
+		_, err := ParseRequestCursor(token)
+		if !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("ParseRequestCursor(%q) error = %v, expected: %v", token, err, ErrInvalidCursor)
+		}
+	}
+}
@@ -11,6 +11,8 @@ import (
 	// External Imports
 	"github.com/google/uuid"
 	"github.com/ory/fosite"
+	"github.com/ory/fosite/handler/oauth2"
+	"github.com/ory/fosite/handler/openid"
 	"github.com/pkg/errors"
 )
 
@@ -26,8 +28,15 @@ type Request struct {
 	UpdateTime int64 `bson:"updated_at" json:"updateTime" xml:"updateTime"`
 	// RequestedAt is the time the request was made.
 	RequestedAt time.Time `bson:"requested_at" json:"requestedAt" xml:"requestedAt"`
+	// ExpiresAt is when the token, or code, issued by the request expires, if
+	// known.
+	ExpiresAt time.Time `bson:"expires_at,omitempty" json:"expiresAt,omitempty" xml:"expiresAt,omitempty"`
 	// Signature contains a unique session signature.
 	Signature string `bson:"signature" json:"signature" xml:"signature"`
+	// AccessSignature contains the signature of the access token issued
+	// alongside a refresh token, if known, enabling revocation to cascade to
+	// precisely that access token.
+	AccessSignature string `bson:"access_signature,omitempty" json:"accessSignature,omitempty" xml:"accessSignature,omitempty"`
 	// ClientID contains a link to the Client that was used to authenticate
 	// this session.
 	ClientID string `bson:"client_id" json:"clientId" xml:"clientId"`
@@ -47,6 +56,31 @@ type Request struct {
 	// Form contains the url values that were passed in to authenticate the
 	// user's client session.
 	Form url.Values `bson:"form_data" json:"formData" xml:"formData"`
+	// Sid contains the OpenID Connect session ID (`sid`) the request was
+	// issued under, enabling front-channel and back-channel logout.
+	Sid string `bson:"sid,omitempty" json:"sid,omitempty" xml:"sid,omitempty"`
+	// Confirmation contains the proof-of-possession confirmation (`cnf`) the
+	// token has been bound to, if any.
+	Confirmation *Confirmation `bson:"cnf,omitempty" json:"cnf,omitempty" xml:"cnf,omitempty"`
+	// CodeChallenge contains the PKCE code challenge the authorization
+	// request was made with, if any.
+	CodeChallenge string `bson:"code_challenge,omitempty" json:"codeChallenge,omitempty" xml:"codeChallenge,omitempty"`
+	// CodeChallengeMethod contains the PKCE code challenge method the
+	// authorization request was made with, if any.
+	CodeChallengeMethod string `bson:"code_challenge_method,omitempty" json:"codeChallengeMethod,omitempty" xml:"codeChallengeMethod,omitempty"`
+	// RemoteIP contains the IP address of the client the request was issued
+	// to, if known.
+	RemoteIP string `bson:"remote_ip,omitempty" json:"remoteIp,omitempty" xml:"remoteIp,omitempty"`
+	// UserAgent contains the user agent of the client the request was issued
+	// to, if known.
+	UserAgent string `bson:"user_agent,omitempty" json:"userAgent,omitempty" xml:"userAgent,omitempty"`
+	// Region contains the region the request was issued in, enabling data
+	// residency reporting and purges in multi-region deployments.
+	Region string `bson:"region,omitempty" json:"region,omitempty" xml:"region,omitempty"`
+	// Claims contains custom claims extracted from the session when the
+	// request was stored, so requests can be queried by claim, as the session
+	// itself is opaque.
+	Claims map[string]interface{} `bson:"claims,omitempty" json:"claims,omitempty" xml:"claims,omitempty"`
 	// Active is specifically used for Authorize Code flow revocation.
 	Active bool `bson:"active" json:"active" xml:"active"`
 	// Session contains the session data. The underlying structure differs
@@ -56,6 +90,61 @@ type Request struct {
 	Session []byte `bson:"session_data" json:"sessionData" xml:"sessionData"`
 }
 
+// Confirmation provides the structure of a token's confirmation (`cnf`)
+// claim, binding the token to a proof-of-possession key.
+type Confirmation struct {
+	// X5tS256 contains the base64url-encoded SHA-256 thumbprint of the client
+	// certificate the token is bound to, as per RFC 8705.
+	X5tS256 string `bson:"x5t#S256,omitempty" json:"x5t#S256,omitempty" xml:"x5tS256,omitempty"`
+	// JKT contains the base64url-encoded SHA-256 JWK thumbprint of the DPoP
+	// key the token is bound to, as per RFC 9449.
+	JKT string `bson:"jkt,omitempty" json:"jkt,omitempty" xml:"jkt,omitempty"`
+}
+
+// IsEmpty returns whether the confirmation binds the token to no key.
+func (c Confirmation) IsEmpty() bool {
+	return c.X5tS256 == "" && c.JKT == ""
+}
+
+// RefreshTokenState reports where a presented refresh token stands in its
+// rotation, so the authorization server can decide whether to rotate or reject
+// it.
+type RefreshTokenState string
+
+const (
+	// RefreshTokenCurrent denotes a refresh token which has yet to be used.
+	RefreshTokenCurrent RefreshTokenState = "current"
+
+	// RefreshTokenGrace denotes a refresh token which has been used, but is
+	// within its grace period, so should be accepted and rotated.
+	RefreshTokenGrace RefreshTokenState = "grace"
+
+	// RefreshTokenReused denotes a refresh token which has been used and
+	// whose grace period has lapsed, so is being replayed.
+	RefreshTokenReused RefreshTokenState = "reused"
+)
+
+// RefreshTokenState returns the rotation state of the refresh token request at
+// the given time. A used refresh token remains within its grace period for
+// gracePeriod after it was last updated.
+func (r *Request) RefreshTokenState(now time.Time, gracePeriod time.Duration) RefreshTokenState {
+	if r.Active {
+		return RefreshTokenCurrent
+	}
+
+	if now.Before(time.Unix(r.UpdateTime, 0).Add(gracePeriod)) {
+		return RefreshTokenGrace
+	}
+
+	return RefreshTokenReused
+}
+
+// IsLive returns whether the request's token is live at the given time, in
+// that it's active and either unexpired or without a known expiry.
+func (r *Request) IsLive(now time.Time) bool {
+	return r.Active && (r.ExpiresAt.IsZero() || r.ExpiresAt.After(now))
+}
+
 // NewRequest returns a new Mongo Store request object.
 func NewRequest() Request {
 	return Request{
@@ -72,6 +161,133 @@ func NewRequest() Request {
 	}
 }
 
+// NewRequestFromRequester transforms a fosite.Requester to a Request ready to
+// be stored.
+// Signature is a hash that relates to the underlying request method and may not
+// be a strict 'signature', for example, authorization code grant passes in an
+// authorization code.
+// TokenType selects the session expiry recorded against the request.
+func NewRequestFromRequester(signature string, r fosite.Requester, tokenType fosite.TokenType) Request {
+	session, _ := json.Marshal(r.GetSession())
+	form := r.GetRequestForm()
+	return Request{
+		ID:                  r.GetID(),
+		RequestedAt:         r.GetRequestedAt(),
+		ExpiresAt:           r.GetSession().GetExpiresAt(tokenType),
+		Signature:           signature,
+		ClientID:            r.GetClient().GetID(),
+		UserID:              r.GetSession().GetSubject(),
+		RequestedScope:      r.GetRequestedScopes(),
+		GrantedScope:        r.GetGrantedScopes(),
+		RequestedAudience:   r.GetRequestedAudience(),
+		GrantedAudience:     r.GetGrantedAudience(),
+		Form:                form,
+		Sid:                 sidFromSession(r.GetSession()),
+		Confirmation:        confirmationFromSession(r.GetSession()),
+		CodeChallenge:       form.Get("code_challenge"),
+		CodeChallengeMethod: form.Get("code_challenge_method"),
+		Active:              true,
+		Session:             session,
+	}
+}
+
+// requiredFormKeys lists the form keys fosite reads back from stored requests,
+// for example, to check the `redirect_uri` an authorization code was issued
+// for, so are kept regardless of how the form is filtered.
+var requiredFormKeys = []string{
+	"redirect_uri",
+	"nonce",
+	"code_challenge",
+	"code_challenge_method",
+}
+
+// FilterForm limits the form data stored with the request to the keys listed in
+// keep, if any, and removes the keys listed in redact, so that sensitive
+// parameters, such as `client_secret` or `code_verifier`, aren't persisted.
+// The keys fosite reads back from stored requests are always kept, see
+// requiredFormKeys.
+// The form is copied, rather than modified, as it may be shared with the
+// fosite.Requester the request was built from.
+func (r *Request) FilterForm(keep []string, redact []string) {
+	if len(keep) == 0 && len(redact) == 0 {
+		return
+	}
+
+	form := make(url.Values, len(r.Form))
+	for key, values := range r.Form {
+		if !stringInSlice(requiredFormKeys, key) {
+			if len(keep) > 0 && !stringInSlice(keep, key) {
+				continue
+			}
+			if stringInSlice(redact, key) {
+				continue
+			}
+		}
+		form[key] = append([]string(nil), values...)
+	}
+
+	r.Form = form
+}
+
+// sidFromSession returns the OpenID Connect session ID (`sid`) held in the ID
+// token claims of the session, if present.
+func sidFromSession(session fosite.Session) string {
+	idSession, ok := session.(openid.Session)
+	if !ok {
+		return ""
+	}
+
+	claims := idSession.IDTokenClaims()
+	if claims == nil {
+		return ""
+	}
+
+	sid, _ := claims.Extra["sid"].(string)
+	return sid
+}
+
+// confirmationFromSession returns the proof-of-possession confirmation (`cnf`)
+// held in the claims of the session, if present.
+func confirmationFromSession(session fosite.Session) *Confirmation {
+	var cnf interface{}
+	switch s := session.(type) {
+	case openid.Session:
+		if claims := s.IDTokenClaims(); claims != nil {
+			cnf = claims.Extra["cnf"]
+		}
+
+	case oauth2.JWTSessionContainer:
+		if claims := s.GetJWTClaims(); claims != nil {
+			cnf = claims.ToMapClaims()["cnf"]
+		}
+	}
+
+	var confirmation Confirmation
+	switch c := cnf.(type) {
+	case Confirmation:
+		confirmation = c
+
+	case *Confirmation:
+		if c != nil {
+			confirmation = *c
+		}
+
+	case map[string]interface{}:
+		confirmation.X5tS256, _ = c["x5t#S256"].(string)
+		confirmation.JKT, _ = c["jkt"].(string)
+
+	case map[string]string:
+		confirmation.X5tS256 = c["x5t#S256"]
+		confirmation.JKT = c["jkt"]
+	}
+
+	if confirmation.IsEmpty() {
+		return nil
+	}
+
+	return &confirmation
+}
+
 // ToRequest transforms a mongo request to a fosite.Request
 func (r *Request) ToRequest(ctx context.Context, session fosite.Session, cm ClientStore) (*fosite.Request, error) {
 	if session != nil {
@@ -87,13 +303,27 @@ func (r *Request) ToRequest(ctx context.Context, session fosite.Session, cm Clie
 		return nil, err
 	}
 
+	form := r.Form
+	if r.CodeChallenge != "" && form.Get("code_challenge") == "" {
+		// Restore the PKCE challenge into the form, as it is where fosite
+		// expects to find it.
+		form = url.Values{}
+		for key, values := range r.Form {
+			form[key] = values
+		}
+		form.Set("code_challenge", r.CodeChallenge)
+		if r.CodeChallengeMethod != "" {
+			form.Set("code_challenge_method", r.CodeChallengeMethod)
+		}
+	}
+
 	req := &fosite.Request{
 		ID:                r.ID,
 		RequestedAt:       r.RequestedAt,
 		Client:            client,
 		RequestedScope:    r.RequestedScope,
 		GrantedScope:      r.GrantedScope,
-		Form:              r.Form,
+		Form:              form,
 		Session:           session,
 		RequestedAudience: r.RequestedAudience,
 		GrantedAudience:   r.GrantedAudience,
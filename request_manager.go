@@ -3,8 +3,11 @@ package storage
 import (
 	// Standard Library Imports
 	"context"
+	"time"
+
 	// External Imports
 	"github.com/go-jose/go-jose/v3"
+	"github.com/ory/fosite"
 	"github.com/ory/fosite/handler/oauth2"
 	"github.com/ory/fosite/handler/openid"
 	"github.com/ory/fosite/handler/pkce"
@@ -37,6 +40,26 @@ type RequestStore interface {
 	RevokeRefreshToken(ctx context.Context, requestID string) error
 	RevokeAccessToken(ctx context.Context, requestID string) error
 	RevokeRefreshTokenMaybeGracePeriod(ctx context.Context, requestID string, signature string) error
+	// RevokeRefreshTokenBySignature revokes the refresh token and the access
+	// token linked to it, for revoking a single token pair, such as on
+	// detecting a refresh token being reused.
+	RevokeRefreshTokenBySignature(ctx context.Context, signature string) error
+
+	// GetAccessTokenSessionForAudience returns the access token session,
+	// returning ErrAudienceMismatch if the token wasn't granted the audience,
+	// for resource servers verifying presented tokens on introspection.
+	GetAccessTokenSessionForAudience(ctx context.Context, signature string, audience string, session fosite.Session) (fosite.Requester, error)
+	// GetRefreshTokenSessionEx returns the refresh token session along with
+	// its rotation state, so the authorization server can decide whether to
+	// rotate or reject the token. Reused tokens are returned, rather than
+	// rejected, leaving the decision to the caller.
+	GetRefreshTokenSessionEx(ctx context.Context, signature string, session fosite.Session) (fosite.Requester, RefreshTokenState, error)
+
+	// CreateRefreshTokenSessionWithAccess stores the refresh token session
+	// linked to the signature of the access token issued alongside it.
+	// fosite's CreateRefreshTokenSession doesn't provide the access token
+	// signature in the version of fosite supported, so it stores no linkage.
+	CreateRefreshTokenSessionWithAccess(ctx context.Context, signature string, accessSignature string, request fosite.Requester) error
 
 	// Authenticate Implements the rest of oauth2.ResourceOwnerPasswordCredentialsGrantStorage
 	Authenticate(ctx context.Context, username string, secret string) error
@@ -45,31 +68,104 @@ type RequestStore interface {
 	List(ctx context.Context, entityName string, filter ListRequestsRequest) ([]Request, error)
 	Create(ctx context.Context, entityName string, request Request) (Request, error)
 	Get(ctx context.Context, entityName string, requestID string) (Request, error)
+	// FindByID searches each request entity for the request, returning it
+	// with the name of the entity it was found in, for tooling that only
+	// holds a request ID.
+	FindByID(ctx context.Context, requestID string) (Request, string, error)
 	Update(ctx context.Context, entityName string, requestID string, request Request) (Request, error)
 	Delete(ctx context.Context, entityName string, requestID string) error
 	DeleteBySignature(ctx context.Context, entityName string, signature string) error
+	// DeleteBySignatureReturning atomically removes the request matching the
+	// signature and returns it, for flows needing to audit or cascade on what
+	// was deleted.
+	DeleteBySignatureReturning(ctx context.Context, entityName string, signature string) (Request, error)
+	// DeleteExpired removes the requests made more than ttl seconds ago, for
+	// datastores unable to expire records automatically.
+	DeleteExpired(ctx context.Context, entityName string, ttl int) error
+	// DeleteByRegion removes the requests issued in the given region across
+	// all request entities, for data residency driven purges.
+	DeleteByRegion(ctx context.Context, region string) error
+	// DeleteByFilter removes the requests matching the filter, as listed by
+	// List, returning the number of requests deleted, for bulk cleanups.
+	// ErrEmptyFilter is returned if no filters are provided.
+	DeleteByFilter(ctx context.Context, entityName string, filter ListRequestsRequest) (int64, error)
+	// DeleteByClientAndEntity removes the client's requests of a single
+	// entity, returning the number of requests deleted, for selectively
+	// revoking one token type.
+	DeleteByClientAndEntity(ctx context.Context, clientID string, entityName string) (int64, error)
+	// PurgeExpiredBatched removes the requests that expired before the given
+	// time in batches of at most batchSize, returning the number of requests
+	// deleted, so large cleanups don't monopolise the datastore.
+	PurgeExpiredBatched(ctx context.Context, entityName string, before time.Time, batchSize int) (int64, error)
+	// PurgeInvalidatedCodes removes the authorization codes invalidated
+	// before the given time, returning the number of codes deleted, so used
+	// codes don't linger until they expire.
+	PurgeInvalidatedCodes(ctx context.Context, olderThan time.Time) (int64, error)
+	// ListExpiringBefore returns the requests matching the filter that expire
+	// before the given time, soonest first, enabling proactive refresh and
+	// alerting.
+	ListExpiringBefore(ctx context.Context, entityName string, before time.Time, filter ListRequestsRequest) ([]Request, error)
+	// ActiveSessionCount returns the number of live refresh tokens held by
+	// the user, for surfacing how many sessions a user is signed in with.
+	// Used and expired refresh tokens aren't counted.
+	ActiveSessionCount(ctx context.Context, userID string) (int64, error)
+	// ListByClaim returns the requests with the custom claim extracted from
+	// their session set to the value, for example, every session issued for
+	// an organisation.
+	ListByClaim(ctx context.Context, entityName string, key string, value interface{}) ([]Request, error)
+
+	// GetOpenIDSessionsBySid OpenID Connect session management, used to drive
+	// front-channel and back-channel logout.
+	GetOpenIDSessionsBySid(ctx context.Context, sid string) ([]Request, error)
+	DeleteOpenIDSessionsBySid(ctx context.Context, sid string) error
 }
 
-// ListRequestsRequest enables filtering stored Request entities.
+// ListRequestsRequest enables filtering stored Request entities. Requests
+// must match every filter provided.
 type ListRequestsRequest struct {
 	// ClientID enables filtering requests based on Client ID
 	ClientID string `json:"client_id" xml:"client_id"`
 	// UserID enables filtering requests based on User ID
 	UserID string `json:"user_id" xml:"user_id"`
-	// ScopesIntersection filters clients that have all of the listed scopes.
+	// ScopesIntersection filters requests that requested all of the listed
+	// scopes.
 	// ScopesIntersection performs an AND operation.
-	// If ScopesUnion is provided, a union operation will be performed as it
-	// returns the wider selection.
 	ScopesIntersection []string `json:"scopes_intersection" xml:"scopes_intersection"`
-	// ScopesUnion filters users that have at least one of of the listed scopes.
+	// ScopesUnion filters requests that requested at least one of the listed
+	// scopes.
 	// ScopesUnion performs an OR operation.
 	ScopesUnion []string `json:"scopes_union" xml:"scopes_union"`
-	// GrantedScopesIntersection enables filtering requests based on GrantedScopes
+	// GrantedScopesIntersection filters requests that were granted all of the
+	// listed scopes.
 	// GrantedScopesIntersection performs an AND operation.
-	// If GrantedScopesIntersection is provided, a union operation will be
-	// performed as it returns the wider selection.
 	GrantedScopesIntersection []string `json:"granted_scopes_intersection" xml:"granted_scopes_intersection"`
-	// GrantedScopesUnion enables filtering requests based on GrantedScopes
+	// GrantedScopesUnion filters requests that were granted at least one of
+	// the listed scopes.
 	// GrantedScopesUnion performs an OR operation.
 	GrantedScopesUnion []string `json:"granted_scopes_union" xml:"granted_scopes_union"`
+	// Region enables filtering requests based on the region they were issued
+	// in.
+	Region string `json:"region" xml:"region"`
+	// Offset skips the given number of matching requests, enabling paging
+	// through the results.
+	Offset int64 `json:"offset" xml:"offset"`
+	// Limit caps the number of requests returned. If zero, every matching
+	// request is returned.
+	Limit int64 `json:"limit" xml:"limit"`
+	// After lists the requests following the cursor returned by the last
+	// request's NextAfter, enabling stable paging through results that are
+	// being written to. After is only honored by List.
+	After string `json:"after" xml:"after"`
+}
+
+// IsEmpty reports whether none of the filters have been provided. Pagination
+// isn't a filter, so is ignored.
+func (l ListRequestsRequest) IsEmpty() bool {
+	return l.ClientID == "" &&
+		l.UserID == "" &&
+		len(l.ScopesIntersection) == 0 &&
+		len(l.ScopesUnion) == 0 &&
+		len(l.GrantedScopesIntersection) == 0 &&
+		len(l.GrantedScopesUnion) == 0 &&
+		l.Region == ""
 }
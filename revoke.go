@@ -0,0 +1,42 @@
+package storage
+
+import (
+	// Standard Library Imports
+	"context"
+)
+
+// subjectEntities are the request entities holding a subject's sessions.
+var subjectEntities = []string{
+	EntityAccessTokens,
+	EntityRefreshTokens,
+	EntityAuthorizationCodes,
+	EntityOpenIDSessions,
+	EntityPKCESessions,
+}
+
+// RevokeAllForSubject deletes every session held by the subject across the
+// request entities, fully logging the user out everywhere. Returns the number
+// of requests deleted, keyed by entity name. An empty subject revokes nothing.
+//
+// Note:
+//   - Denied JTIs aren't tagged with the subject of the assertion they were
+//     presented in, so are left to expire.
+func (s *Store) RevokeAllForSubject(ctx context.Context, subject string) (map[string]int64, error) {
+	counts := make(map[string]int64, len(subjectEntities))
+	if subject == "" {
+		return counts, nil
+	}
+
+	filter := ListRequestsRequest{
+		UserID: subject,
+	}
+	for _, entityName := range subjectEntities {
+		deleted, err := s.RequestManager.DeleteByFilter(ctx, entityName, filter)
+		if err != nil {
+			return counts, err
+		}
+		counts[entityName] = deleted
+	}
+
+	return counts, nil
+}
@@ -1,12 +1,22 @@
 package storage
 
-import "context"
+import (
+	// Standard Library Imports
+	"context"
+	"errors"
+
+	// External Imports
+	"github.com/ory/fosite"
+)
 
 // Store brings all the interfaces together as a way to be composable into
 // storage backend implementations
 type Store struct {
 	ClientManager
+	ConsentManager
 	DeniedJTIManager
+	IdempotencyManager
+	NonceManager
 	RequestManager
 	UserManager
 }
@@ -21,6 +31,10 @@ type Store struct {
 // - `store.UserManager.Authenticate(ctx, username, secret) (User, error)`
 func (s *Store) Authenticate(ctx context.Context, username string, secret string) error {
 	_, err := s.UserManager.Authenticate(ctx, username, secret)
+	if errors.Is(err, ErrInvalidCredentials) {
+		// fosite reports not found as an invalid grant.
+		return fosite.ErrNotFound
+	}
 	return err
 }
 
@@ -68,6 +82,9 @@ type AuthUserMigrator interface {
 	// creating or overwriting the current record with the newly provided
 	// record.
 	// If User.ID is passed in empty, a new ID will be generated for you.
+	// If User.SourceUpdatedAt is set, the current record is only overwritten
+	// if it was migrated from an older version, otherwise ErrMigrationStale
+	// is returned.
 	// Use with caution, be secure, don't be dumb.
 	Migrate(ctx context.Context, migratedUser User) (User, error)
 
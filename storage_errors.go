@@ -6,4 +6,67 @@ var (
 	// ErrResourceExists provides an error for when, in most cases, a record's
 	// unique identifier already exists in the system.
 	ErrResourceExists = errors.New("resource conflict")
+
+	// ErrNonceReplayed provides an error for when a nonce has already been
+	// used within its validity window.
+	ErrNonceReplayed = errors.New("nonce replayed")
+
+	// ErrMultipleResults provides an error for when a lookup expected to
+	// find a single record matched more than one.
+	ErrMultipleResults = errors.New("multiple results")
+
+	// ErrMigrationStale provides an error for when a migrated record is
+	// skipped as the stored record was migrated from the same or a newer
+	// version.
+	ErrMigrationStale = errors.New("migration stale")
+
+	// ErrStorageUnavailable provides an error for when the datastore couldn't
+	// be reached, or couldn't serve the request at the time, so the operation
+	// may succeed if retried.
+	ErrStorageUnavailable = errors.New("storage unavailable")
+
+	// ErrTimeout provides an error for when the datastore didn't respond in
+	// time, so the operation may succeed if retried.
+	ErrTimeout = errors.New("storage timeout")
+
+	// ErrInvalidCredentials provides an error for when a client or user
+	// couldn't be authenticated, either as the resource doesn't exist or as
+	// the secret provided is wrong, without revealing which.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+
+	// ErrUnknownGrantType provides an error for when a client is allowed to
+	// use a grant type which isn't known, for example, due to a typo.
+	ErrUnknownGrantType = errors.New("unknown grant type")
+
+	// ErrUnknownResponseType provides an error for when a client is allowed
+	// to use a response type which isn't known.
+	ErrUnknownResponseType = errors.New("unknown response type")
+
+	// ErrPublicClientSecret provides an error for when a public client, which
+	// authenticates implicitly, has been provided a secret.
+	ErrPublicClientSecret = errors.New("public client has a secret")
+
+	// ErrMissingClientSecret provides an error for when a confidential client
+	// hasn't been provided a secret to authenticate with.
+	ErrMissingClientSecret = errors.New("confidential client requires a secret")
+
+	// ErrSessionTooLarge provides an error for when a request's marshaled
+	// session exceeds the size the datastore is able to store.
+	ErrSessionTooLarge = errors.New("session too large")
+
+	// ErrInvalidCursor provides an error for when a pagination token provided
+	// as After can't be decoded.
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	// ErrEmptyFilter provides an error for when a bulk delete is requested
+	// without any filters, which would otherwise delete every record.
+	ErrEmptyFilter = errors.New("empty filter")
+
+	// ErrAudienceMismatch provides an error for when a token presented to a
+	// resource server wasn't granted for the resource server's audience.
+	ErrAudienceMismatch = errors.New("audience mismatch")
+
+	// ErrInvalidTTL provides an error for when a record is to be stored with
+	// a time to live that isn't positive, so would expire immediately.
+	ErrInvalidTTL = errors.New("invalid ttl")
 )
@@ -13,3 +13,13 @@ func stringArrayEquals(a []string, b []string) bool {
 	}
 	return true
 }
+
+// stringInSlice returns whether the slice holds the string.
+func stringInSlice(s []string, item string) bool {
+	for _, v := range s {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,2864 @@
+// Package storagetest provides a behavioural conformance suite that
+// storage.Store implementations can run to confirm they honour the semantics
+// fosite and the storage package rely on.
+package storagetest
+
+import (
+	// Standard Library Imports
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	// External Imports
+	"github.com/google/uuid"
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/handler/openid"
+	"github.com/ory/fosite/token/jwt"
+
+	// Internal Imports
+	"github.com/p000ic/go-fosite-mongo"
+)
+
+// RunStoreConformance runs the behavioural conformance suite against the
+// provided store, enabling custom storage.Store implementations to verify they
+// honour the same semantics as the bundled stores, for example, returning
+// storage.ErrResourceExists on conflicts and fosite.ErrNotFound for missing
+// resources.
+//
+// Each test is run as a subtest and creates its own uniquely identified
+// resources, so the store can be shared across the suite.
+func RunStoreConformance(t *testing.T, store storage.Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, ctx context.Context, store storage.Store)
+	}{
+		{name: "ClientManager_Create", test: testClientCreate},
+		{name: "ClientManager_Create_ShouldConflictOnDuplicateID", test: testClientCreateDuplicate},
+		{name: "ClientManager_Get_ShouldReturnNotFound", test: testClientGetNotFound},
+		{name: "ClientManager_Update", test: testClientUpdate},
+		{name: "ClientManager_Update_ShouldReturnNotFound", test: testClientUpdateNotFound},
+		{name: "ClientManager_Upsert", test: testClientUpsert},
+		{name: "ClientManager_ShouldRejectUnknownTypes", test: testClientUnknownTypes},
+		{name: "ClientManager_ShouldStoreRefreshTokenPolicy", test: testClientRefreshTokenPolicy},
+		{name: "ClientManager_Delete", test: testClientDelete},
+		{name: "ClientManager_Authenticate", test: testClientAuthenticate},
+		{name: "ClientManager_AuthenticateMigration", test: testClientAuthenticateMigration},
+		{name: "ClientManager_RotateSecret", test: testClientRotateSecret},
+		{name: "ClientManager_Disable", test: testClientDisable},
+		{name: "ClientManager_Scopes", test: testClientScopes},
+		{name: "ClientManager_ListByScope", test: testClientListByScope},
+		{name: "ClientManager_ListByContact", test: testClientListByContact},
+		{name: "ClientManager_List_ShouldMatchScopePrefix", test: testClientListScopePrefix},
+		{name: "ClientManager_GrantScopesToMany", test: testClientGrantScopesToMany},
+		{name: "ClientManager_GrantScopes_ShouldKeepConcurrentGrants", test: testClientConcurrentGrantScopes},
+		{name: "ClientManager_List_ShouldPageAfter", test: testClientListAfter},
+		{name: "UserManager_Create", test: testUserCreate},
+		{name: "UserManager_Create_ShouldConflictOnDuplicates", test: testUserCreateDuplicate},
+		{name: "UserManager_Create_ShouldReuseDisabledUsername", test: testUserReuseDisabledUsername},
+		{name: "UserManager_Get_ShouldReturnNotFound", test: testUserGetNotFound},
+		{name: "UserManager_Get_ShouldExcludeDisabled", test: testUserGetExcludesDisabled},
+		{name: "UserManager_GetByLogin", test: testUserGetByLogin},
+		{name: "UserManager_Update", test: testUserUpdate},
+		{name: "UserManager_List", test: testUserList},
+		{name: "UserManager_List_ShouldMatchScopePrefix", test: testUserListScopePrefix},
+		{name: "UserManager_List_ShouldPageAfter", test: testUserListAfter},
+		{name: "UserManager_List_ShouldSearchByPrefix", test: testUserListSearch},
+		{name: "UserManager_Authenticate", test: testUserAuthenticate},
+		{name: "UserManager_AuthenticateMigration", test: testUserAuthenticateMigration},
+		{name: "UserManager_ResetFailedLogins", test: testUserResetFailedLogins},
+		{name: "UserManager_UpdatePassword", test: testUserUpdatePassword},
+		{name: "UserManager_Migrate_ShouldGuardBySourceVersion", test: testUserMigrateVersioned},
+		{name: "UserManager_Scopes", test: testUserScopes},
+		{name: "UserManager_GrantScopesToMany", test: testUserGrantScopesToMany},
+		{name: "UserManager_GrantScopes_ShouldKeepConcurrentGrants", test: testUserConcurrentGrantScopes},
+		{name: "UserManager_TOTP", test: testUserTOTP},
+		{name: "UserManager_VerifyEmailToken", test: testUserVerifyEmailToken},
+		{name: "RequestManager_AccessTokenSession", test: testAccessTokenSession},
+		{name: "RequestManager_CreateSession_ShouldBeIdempotent", test: testCreateSessionIdempotent},
+		{name: "RequestManager_GetAccessTokenSessionForAudience", test: testAccessTokenSessionForAudience},
+		{name: "RequestManager_AuthorizeCodeSession", test: testAuthorizeCodeSession},
+		{name: "RequestManager_AuthorizeCodeSession_ShouldRedeemOnce", test: testAuthorizeCodeConcurrentRedemption},
+		{name: "RequestManager_PurgeInvalidatedCodes", test: testPurgeInvalidatedCodes},
+		{name: "RequestManager_RefreshTokenSession", test: testRefreshTokenSession},
+		{name: "RequestManager_RefreshTokenSession_ShouldLinkAccessToken", test: testRefreshTokenAccessLinkage},
+		{name: "RequestManager_PKCERequestSession", test: testPKCERequestSession},
+		{name: "RequestManager_OpenIDConnectSession", test: testOpenIDConnectSession},
+		{name: "RequestManager_DeleteByRegion", test: testDeleteByRegion},
+		{name: "RequestManager_DeleteBySignatureReturning", test: testDeleteBySignatureReturning},
+		{name: "RequestManager_DeleteByFilter", test: testDeleteByFilter},
+		{name: "RequestManager_DeleteByFilter_ShouldMatchGrantedScopes", test: testDeleteByFilterGrantedScopes},
+		{name: "RequestManager_DeleteByClientAndEntity", test: testDeleteByClientAndEntity},
+		{name: "Store_RevokeAllForSubject", test: testRevokeAllForSubject},
+		{name: "RequestManager_FindByID", test: testFindByID},
+		{name: "RequestManager_ListExpiringBefore", test: testListExpiringBefore},
+		{name: "RequestManager_PurgeExpiredBatched", test: testPurgeExpiredBatched},
+		{name: "RequestManager_List_ShouldPageAfter", test: testRequestListAfter},
+		{name: "RequestManager_ActiveSessionCount", test: testActiveSessionCount},
+		{name: "RequestManager_ListByClaim", test: testListByClaim},
+		{name: "ConsentManager", test: testConsent},
+		{name: "NonceManager_ConsumeNonce", test: testConsumeNonce},
+		{name: "IdempotencyManager", test: testIdempotentResult},
+		{name: "DeniedJTIManager", test: testDeniedJTI},
+		{name: "DeniedJTIManager_Batch", test: testDeniedJTIBatch},
+		{name: "DeniedJTIManager_ShouldNormalizeSignatures", test: testDeniedJTINormalized},
+		{name: "DeniedJTIManager_PurgeExpired", test: testDeniedJTIPurgeExpired},
+		{name: "DeniedJTIManager_DeleteBefore", test: testDeniedJTIDeleteBefore},
+		{name: "ClientManager_SetClientAssertionJWT", test: testSetClientAssertionJWT},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, context.Background(), store)
+		})
+	}
+}
+
+// secret is the password and client secret used across the suite.
+const secret = "foobar"
+
+func newClient() storage.Client {
+	return storage.Client{
+		ID:            uuid.NewString(),
+		Name:          "storagetest",
+		Secret:        secret,
+		GrantTypes:    []string{"authorization_code", "refresh_token"},
+		ResponseTypes: []string{"code"},
+		Scopes:        []string{"openid", "offline"},
+		RedirectURIs:  []string{"https://example.com/callback"},
+	}
+}
+
+func newUser() storage.User {
+	return storage.User{
+		ID:        uuid.NewString(),
+		Username:  uuid.NewString() + "@example.com",
+		Password:  secret,
+		FirstName: "Test",
+		LastName:  "User",
+		Scopes:    []string{"openid"},
+	}
+}
+
+func createClient(t *testing.T, ctx context.Context, store storage.Store) storage.Client {
+	t.Helper()
+
+	return createClientFrom(t, ctx, store, newClient())
+}
+
+func createClientFrom(t *testing.T, ctx context.Context, store storage.Store, client storage.Client) storage.Client {
+	t.Helper()
+
+	client, err := store.ClientManager.Create(ctx, client)
+	if err != nil {
+		t.Fatalf("create client should return no errors, got: %v", err)
+	}
+
+	return client
+}
+
+func createUser(t *testing.T, ctx context.Context, store storage.Store) storage.User {
+	t.Helper()
+
+	user, err := store.UserManager.Create(ctx, newUser())
+	if err != nil {
+		t.Fatalf("create user should return no errors, got: %v", err)
+	}
+
+	return user
+}
+
+func newRequester(clientID string, subject string) *fosite.Request {
+	request := fosite.NewRequest()
+	request.ID = uuid.NewString()
+	request.RequestedAt = time.Now().UTC().Round(time.Second)
+	request.Client = &storage.Client{ID: clientID}
+	request.RequestedScope = fosite.Arguments{"openid", "offline"}
+	request.GrantedScope = fosite.Arguments{"openid"}
+	request.Session = &fosite.DefaultSession{Subject: subject}
+	return request
+}
+
+func testClientCreate(t *testing.T, ctx context.Context, store storage.Store) {
+	expected := createClient(t, ctx, store)
+	if expected.Secret == secret {
+		t.Errorf("create should hash the client secret")
+	}
+
+	got, err := store.ClientManager.Get(ctx, expected.ID)
+	if err != nil {
+		t.Fatalf("get should return no errors, got: %v", err)
+	}
+	if got.ID != expected.ID || got.Name != expected.Name {
+		t.Errorf("get should return the created client, got: %+v, want: %+v", got, expected)
+	}
+
+	exists, err := store.ClientManager.Exists(ctx, expected.ID)
+	if err != nil || !exists {
+		t.Errorf("exists should report the created client, got: %v, %v", exists, err)
+	}
+}
+
+func testClientCreateDuplicate(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+
+	duplicate := newClient()
+	duplicate.ID = client.ID
+	_, err := store.ClientManager.Create(ctx, duplicate)
+	if !errors.Is(err, storage.ErrResourceExists) {
+		t.Errorf("create with a duplicate ID should conflict, got: %v, want: %v", err, storage.ErrResourceExists)
+	}
+}
+
+func testClientGetNotFound(t *testing.T, ctx context.Context, store storage.Store) {
+	_, err := store.ClientManager.Get(ctx, uuid.NewString())
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+
+	_, err = store.ClientManager.GetClient(ctx, uuid.NewString())
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get client should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+}
+
+func testClientUpdate(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+
+	client.Name = "updated"
+	client.Secret = ""
+	got, err := store.ClientManager.Update(ctx, client.ID, client)
+	if err != nil {
+		t.Fatalf("update should return no errors, got: %v", err)
+	}
+	if got.Name != "updated" {
+		t.Errorf("update should return the updated client, got: %s, want: %s", got.Name, "updated")
+	}
+
+	_, err = store.ClientManager.Authenticate(ctx, client.ID, secret)
+	if err != nil {
+		t.Errorf("update with a blank secret should retain the existing secret, got: %v", err)
+	}
+}
+
+func testClientUpdateNotFound(t *testing.T, ctx context.Context, store storage.Store) {
+	client := newClient()
+	_, err := store.ClientManager.Update(ctx, client.ID, client)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("update should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+}
+
+func testClientUnknownTypes(t *testing.T, ctx context.Context, store storage.Store) {
+	client := newClient()
+	client.GrantTypes = []string{"authorisation_code"}
+	_, err := store.ClientManager.Create(ctx, client)
+	if !errors.Is(err, storage.ErrUnknownGrantType) {
+		t.Errorf("create should reject unknown grant types, got: %v, want: %v", err, storage.ErrUnknownGrantType)
+	}
+	_, err = store.ClientManager.Upsert(ctx, client)
+	if !errors.Is(err, storage.ErrUnknownGrantType) {
+		t.Errorf("upsert should reject unknown grant types, got: %v, want: %v", err, storage.ErrUnknownGrantType)
+	}
+	_, created, err := store.ClientManager.GetOrCreate(ctx, client)
+	if !errors.Is(err, storage.ErrUnknownGrantType) || created {
+		t.Errorf("get or create should reject unknown grant types, got: %v, %v, want: %v", created, err, storage.ErrUnknownGrantType)
+	}
+	_, err = store.ClientManager.Migrate(ctx, client)
+	if !errors.Is(err, storage.ErrUnknownGrantType) {
+		t.Errorf("migrate should reject unknown grant types, got: %v, want: %v", err, storage.ErrUnknownGrantType)
+	}
+	_, err = store.ClientManager.Get(ctx, client.ID)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("clients with unknown grant types should not be stored, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+
+	client = createClient(t, ctx, store)
+	client.ResponseTypes = []string{"code tokens"}
+	_, err = store.ClientManager.Update(ctx, client.ID, client)
+	if !errors.Is(err, storage.ErrUnknownResponseType) {
+		t.Errorf("update should reject unknown response types, got: %v, want: %v", err, storage.ErrUnknownResponseType)
+	}
+
+	got, err := store.ClientManager.Get(ctx, client.ID)
+	if err != nil {
+		t.Fatalf("get should return no errors, got: %v", err)
+	}
+	if len(got.ResponseTypes) != 1 || got.ResponseTypes[0] != "code" {
+		t.Errorf("rejected updates should not be stored, got: %v", got.ResponseTypes)
+	}
+}
+
+func testClientRefreshTokenPolicy(t *testing.T, ctx context.Context, store storage.Store) {
+	client := newClient()
+	client.DisableRefreshTokens = true
+	client.OfflineAccessRequired = true
+	client = createClientFrom(t, ctx, store, client)
+
+	got, err := store.ClientManager.Get(ctx, client.ID)
+	if err != nil {
+		t.Fatalf("get should return no errors, got: %v", err)
+	}
+	if !got.DisableRefreshTokens || !got.OfflineAccessRequired {
+		t.Errorf("refresh token flags should round trip, got: disable refresh tokens %v, offline access required %v", got.DisableRefreshTokens, got.OfflineAccessRequired)
+	}
+
+	fositeClient, err := store.ClientManager.GetClient(ctx, client.ID)
+	if err != nil {
+		t.Fatalf("get client should return no errors, got: %v", err)
+	}
+	if fositeClient.GetGrantTypes().Has("refresh_token") {
+		t.Errorf("disabled refresh tokens should withhold the refresh_token grant type, got: %v", fositeClient.GetGrantTypes())
+	}
+	policy, ok := fositeClient.(storage.RefreshTokenPolicy)
+	if !ok {
+		t.Fatalf("client should implement storage.RefreshTokenPolicy, got: %T", fositeClient)
+	}
+	if !policy.IsOfflineAccessRequired() {
+		t.Errorf("client should require offline access")
+	}
+	if policy.CanIssueRefreshToken(fosite.Arguments{"offline_access"}) {
+		t.Errorf("refresh tokens should not be issued to clients with refresh tokens disabled")
+	}
+}
+
+func testClientUpsert(t *testing.T, ctx context.Context, store storage.Store) {
+	client := newClient()
+	client.CreateTime = time.Now().Add(-time.Hour).Unix()
+
+	created, err := store.ClientManager.Upsert(ctx, client)
+	if err != nil {
+		t.Fatalf("upsert should create the client, got: %v", err)
+	}
+	if created.Secret == secret {
+		t.Errorf("upsert should hash the client secret")
+	}
+	if created.CreateTime != client.CreateTime {
+		t.Errorf("upsert should keep the provided create time, got: %d, want: %d", created.CreateTime, client.CreateTime)
+	}
+
+	// Redeclare the client with the same secret, as provisioning would.
+	update := newClient()
+	update.ID = client.ID
+	update.Name = "upserted"
+	updated, err := store.ClientManager.Upsert(ctx, update)
+	if err != nil {
+		t.Fatalf("upsert should update the client, got: %v", err)
+	}
+	if updated.Name != update.Name {
+		t.Errorf("upsert should update the client, got: %s, want: %s", updated.Name, update.Name)
+	}
+	if updated.CreateTime != created.CreateTime {
+		t.Errorf("upsert should preserve the create time, got: %d, want: %d", updated.CreateTime, created.CreateTime)
+	}
+	if updated.UpdateTime == 0 {
+		t.Errorf("upsert should set the update time")
+	}
+	if updated.Secret != created.Secret {
+		t.Errorf("upsert with an unchanged secret should keep the stored hash")
+	}
+
+	update.Secret = "rotated"
+	_, err = store.ClientManager.Upsert(ctx, update)
+	if err != nil {
+		t.Fatalf("upsert should update the client, got: %v", err)
+	}
+
+	got, err := store.ClientManager.Get(ctx, client.ID)
+	if err != nil {
+		t.Fatalf("get should return no errors, got: %v", err)
+	}
+	if got.CreateTime != created.CreateTime {
+		t.Errorf("upsert should preserve the stored create time, got: %d, want: %d", got.CreateTime, created.CreateTime)
+	}
+	if got.Secret == update.Secret {
+		t.Errorf("upsert should hash a changed secret")
+	}
+
+	_, err = store.ClientManager.Authenticate(ctx, client.ID, update.Secret)
+	if err != nil {
+		t.Errorf("authenticate with the upserted secret should return no errors, got: %v", err)
+	}
+	_, err = store.ClientManager.Authenticate(ctx, client.ID, secret)
+	if err == nil {
+		t.Errorf("authenticate with the replaced secret should fail")
+	}
+}
+
+func testClientDelete(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+
+	err := store.ClientManager.Delete(ctx, client.ID)
+	if err != nil {
+		t.Fatalf("delete should return no errors, got: %v", err)
+	}
+
+	_, err = store.ClientManager.Get(ctx, client.ID)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get after delete should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+
+	err = store.ClientManager.Delete(ctx, client.ID)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("deleting a missing client should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+}
+
+func testClientAuthenticate(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+
+	got, err := store.ClientManager.Authenticate(ctx, client.ID, secret)
+	if err != nil {
+		t.Fatalf("authenticate should return no errors, got: %v", err)
+	}
+	if got.ID != client.ID {
+		t.Errorf("authenticate should return the client, got: %s, want: %s", got.ID, client.ID)
+	}
+
+	// A wrong secret and a missing client are indistinguishable.
+	_, err = store.ClientManager.Authenticate(ctx, client.ID, "wrong")
+	if !errors.Is(err, storage.ErrInvalidCredentials) {
+		t.Errorf("authenticate with the wrong secret should return invalid credentials, got: %v, want: %v", err, storage.ErrInvalidCredentials)
+	}
+
+	_, err = store.ClientManager.Authenticate(ctx, uuid.NewString(), secret)
+	if !errors.Is(err, storage.ErrInvalidCredentials) {
+		t.Errorf("authenticate of a missing client should return invalid credentials, got: %v, want: %v", err, storage.ErrInvalidCredentials)
+	}
+}
+
+func testClientAuthenticateMigration(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+	currentAuth := func(client storage.Client, authenticated bool) storage.AuthClientFunc {
+		return func(context.Context) (storage.Client, bool) {
+			return client, authenticated
+		}
+	}
+
+	got, err := store.ClientManager.AuthenticateMigration(ctx, currentAuth(client, false), client.ID, secret)
+	if err != nil {
+		t.Fatalf("authenticate migration should fall back to the hasher, got: %v", err)
+	}
+	if got.ID != client.ID {
+		t.Errorf("authenticate migration should return the client, got: %s, want: %s", got.ID, client.ID)
+	}
+
+	// A wrong secret and a missing client are indistinguishable.
+	_, err = store.ClientManager.AuthenticateMigration(ctx, currentAuth(client, false), client.ID, "wrong")
+	if !errors.Is(err, storage.ErrInvalidCredentials) {
+		t.Errorf("authenticate migration with the wrong secret should return invalid credentials, got: %v, want: %v", err, storage.ErrInvalidCredentials)
+	}
+	_, err = store.ClientManager.AuthenticateMigration(ctx, currentAuth(storage.Client{}, false), uuid.NewString(), secret)
+	if !errors.Is(err, storage.ErrInvalidCredentials) {
+		t.Errorf("authenticate migration of a missing client should return invalid credentials, got: %v, want: %v", err, storage.ErrInvalidCredentials)
+	}
+
+	// A disabled client is only denied once the secret has been verified.
+	disabled := client
+	disabled.Disabled = true
+	_, err = store.ClientManager.AuthenticateMigration(ctx, currentAuth(disabled, false), client.ID, "wrong")
+	if !errors.Is(err, storage.ErrInvalidCredentials) {
+		t.Errorf("authenticate migration of a disabled client with the wrong secret should return invalid credentials, got: %v, want: %v", err, storage.ErrInvalidCredentials)
+	}
+	_, err = store.ClientManager.AuthenticateMigration(ctx, currentAuth(disabled, false), client.ID, secret)
+	if !errors.Is(err, fosite.ErrAccessDenied) {
+		t.Errorf("authenticate migration of a disabled client should be denied, got: %v, want: %v", err, fosite.ErrAccessDenied)
+	}
+
+	// A client authenticated by the current function has its hash upgraded.
+	legacySecret := "l3gacySecret!"
+	_, err = store.ClientManager.AuthenticateMigration(ctx, currentAuth(client, true), client.ID, legacySecret)
+	if err != nil {
+		t.Fatalf("authenticate migration should return no errors, got: %v", err)
+	}
+	_, err = store.ClientManager.Authenticate(ctx, client.ID, legacySecret)
+	if err != nil {
+		t.Errorf("authenticate should accept the migrated secret, got: %v", err)
+	}
+}
+
+func testClientRotateSecret(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+	newSecret := "s0methingElse!"
+
+	got, err := store.ClientManager.RotateSecret(ctx, client.ID, newSecret, time.Hour)
+	if err != nil {
+		t.Fatalf("rotate secret should return no errors, got: %v", err)
+	}
+	if got.PreviousSecret != client.Secret {
+		t.Errorf("rotate secret should retain the previous secret hash, got: %s, want: %s", got.PreviousSecret, client.Secret)
+	}
+
+	for _, s := range []string{secret, newSecret} {
+		_, err = store.ClientManager.Authenticate(ctx, client.ID, s)
+		if err != nil {
+			t.Errorf("authenticate should accept both secrets during the overlap, got: %v", err)
+		}
+	}
+
+	// Rotating without an overlap invalidates the previous secret immediately.
+	latestSecret := "an0therSecret!"
+	got, err = store.ClientManager.RotateSecret(ctx, client.ID, latestSecret, 0)
+	if err != nil {
+		t.Fatalf("rotate secret should return no errors, got: %v", err)
+	}
+	if got.PreviousSecret != "" || got.PreviousSecretExpiry != 0 {
+		t.Errorf("rotate secret without an overlap should clear the previous secret, got: %+v", got)
+	}
+	for _, s := range []string{secret, newSecret} {
+		_, err = store.ClientManager.Authenticate(ctx, client.ID, s)
+		if err == nil {
+			t.Errorf("authenticate should reject rotated secrets once the overlap has ended")
+		}
+	}
+	_, err = store.ClientManager.Authenticate(ctx, client.ID, latestSecret)
+	if err != nil {
+		t.Errorf("authenticate should accept the latest secret, got: %v", err)
+	}
+
+	_, err = store.ClientManager.RotateSecret(ctx, uuid.NewString(), newSecret, time.Hour)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("rotate secret should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+}
+
+func testClientDisable(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+
+	got, err := store.ClientManager.Disable(ctx, client.ID)
+	if err != nil {
+		t.Fatalf("disable should return no errors, got: %v", err)
+	}
+	if !got.Disabled {
+		t.Errorf("disable should return the disabled client")
+	}
+
+	_, err = store.ClientManager.Authenticate(ctx, client.ID, secret)
+	if !errors.Is(err, fosite.ErrAccessDenied) {
+		t.Errorf("authenticate of a disabled client should be denied, got: %v, want: %v", err, fosite.ErrAccessDenied)
+	}
+	_, err = store.ClientManager.Authenticate(ctx, client.ID, "wrong")
+	if !errors.Is(err, storage.ErrInvalidCredentials) {
+		t.Errorf("authenticate of a disabled client with the wrong secret should return invalid credentials, got: %v, want: %v", err, storage.ErrInvalidCredentials)
+	}
+
+	_, err = store.ClientManager.GetClient(ctx, client.ID)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get client of a disabled client should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+
+	_, err = store.ClientManager.Enable(ctx, client.ID)
+	if err != nil {
+		t.Fatalf("enable should return no errors, got: %v", err)
+	}
+
+	_, err = store.ClientManager.GetClient(ctx, client.ID)
+	if err != nil {
+		t.Errorf("get client of an enabled client should return no errors, got: %v", err)
+	}
+}
+
+func testClientScopes(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+
+	got, err := store.ClientManager.GrantScopes(ctx, client.ID, []string{"profile", "openid"})
+	if err != nil {
+		t.Fatalf("grant scopes should return no errors, got: %v", err)
+	}
+	if !reflect.DeepEqual(got.Scopes, []string{"openid", "offline", "profile"}) {
+		t.Errorf("grant scopes should add missing scopes, got: %v, want: %v", got.Scopes, []string{"openid", "offline", "profile"})
+	}
+
+	got, err = store.ClientManager.RemoveScopes(ctx, client.ID, []string{"offline"})
+	if err != nil {
+		t.Fatalf("remove scopes should return no errors, got: %v", err)
+	}
+	if !reflect.DeepEqual(got.Scopes, []string{"openid", "profile"}) {
+		t.Errorf("remove scopes should remove the scopes, got: %v, want: %v", got.Scopes, []string{"openid", "profile"})
+	}
+
+	got, err = store.ClientManager.RemoveAllScopes(ctx, client.ID)
+	if err != nil {
+		t.Fatalf("remove all scopes should return no errors, got: %v", err)
+	}
+	if len(got.Scopes) != 0 {
+		t.Errorf("remove all scopes should remove every scope, got: %v", got.Scopes)
+	}
+
+	_, err = store.ClientManager.GrantScopes(ctx, uuid.NewString(), []string{"profile"})
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("grant scopes to a missing client should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+}
+
+func testClientGrantScopesToMany(t *testing.T, ctx context.Context, store storage.Store) {
+	first := createClient(t, ctx, store)
+	second := createClient(t, ctx, store)
+	untargeted := createClient(t, ctx, store)
+
+	clientIDs := []string{first.ID, second.ID, uuid.NewString()}
+	err := store.ClientManager.GrantScopesToMany(ctx, clientIDs, []string{"profile", "openid"})
+	if err != nil {
+		t.Fatalf("grant scopes to many should return no errors, got: %v", err)
+	}
+
+	for _, client := range []storage.Client{first, second} {
+		got, err := store.ClientManager.Get(ctx, client.ID)
+		if err != nil {
+			t.Fatalf("get client should return no errors, got: %v", err)
+		}
+		if !reflect.DeepEqual(got.Scopes, []string{"openid", "offline", "profile"}) {
+			t.Errorf("grant scopes to many should add missing scopes, got: %v, want: %v", got.Scopes, []string{"openid", "offline", "profile"})
+		}
+	}
+
+	got, err := store.ClientManager.Get(ctx, untargeted.ID)
+	if err != nil {
+		t.Fatalf("get client should return no errors, got: %v", err)
+	}
+	if !reflect.DeepEqual(got.Scopes, untargeted.Scopes) {
+		t.Errorf("grant scopes to many should leave other clients untouched, got: %v, want: %v", got.Scopes, untargeted.Scopes)
+	}
+}
+
+// concurrentScopes are granted simultaneously, one per goroutine, by the
+// concurrent grant tests.
+var concurrentScopes = []string{"cats", "dogs", "birds", "fish", "frogs", "mice", "rats", "bats"}
+
+// grantConcurrently calls grant with each of the concurrent scopes at the same
+// time.
+func grantConcurrently(t *testing.T, grant func(scope string) error) {
+	t.Helper()
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, scope := range concurrentScopes {
+		wg.Add(1)
+		go func(scope string) {
+			defer wg.Done()
+			<-start
+			if err := grant(scope); err != nil {
+				t.Errorf("grant scopes should return no errors, got: %v", err)
+			}
+		}(scope)
+	}
+	close(start)
+	wg.Wait()
+}
+
+func testClientConcurrentGrantScopes(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+
+	grantConcurrently(t, func(scope string) error {
+		_, err := store.ClientManager.GrantScopes(ctx, client.ID, []string{scope})
+		return err
+	})
+
+	got, err := store.ClientManager.Get(ctx, client.ID)
+	if err != nil {
+		t.Fatalf("get client should return no errors, got: %v", err)
+	}
+	want := append(client.Scopes, concurrentScopes...)
+	if len(got.Scopes) != len(want) || !containsAll(got.Scopes, want) {
+		t.Errorf("concurrent grants should all be kept, got: %v, want: %v", got.Scopes, want)
+	}
+}
+
+func testUserConcurrentGrantScopes(t *testing.T, ctx context.Context, store storage.Store) {
+	user := createUser(t, ctx, store)
+
+	grantConcurrently(t, func(scope string) error {
+		_, err := store.UserManager.GrantScopes(ctx, user.ID, []string{scope})
+		return err
+	})
+
+	got, err := store.UserManager.Get(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("get user should return no errors, got: %v", err)
+	}
+	want := append(user.Scopes, concurrentScopes...)
+	if len(got.Scopes) != len(want) || !containsAll(got.Scopes, want) {
+		t.Errorf("concurrent grants should all be kept, got: %v, want: %v", got.Scopes, want)
+	}
+}
+
+// containsAll reports whether every one of the wanted values is held.
+func containsAll(held []string, wanted []string) bool {
+	for _, want := range wanted {
+		found := false
+		for _, value := range held {
+			if value == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func testClientListByScope(t *testing.T, ctx context.Context, store storage.Store) {
+	scope := "urn:storagetest:" + uuid.NewString()
+	var expected []string
+	seeds := []struct {
+		scopes  []string
+		matches bool
+	}{
+		{scopes: []string{scope}, matches: true},
+		{scopes: []string{"openid", scope}, matches: true},
+		{scopes: []string{"openid"}, matches: false},
+		{scopes: nil, matches: false},
+	}
+	for _, seed := range seeds {
+		client := newClient()
+		client.Scopes = seed.scopes
+		client = createClientFrom(t, ctx, store, client)
+		if seed.matches {
+			expected = append(expected, client.ID)
+		}
+	}
+
+	got, err := store.ClientManager.ListByScope(ctx, scope)
+	if err != nil {
+		t.Fatalf("list by scope should return no errors, got: %v", err)
+	}
+	var ids []string
+	for _, client := range got {
+		ids = append(ids, client.ID)
+	}
+	sort.Strings(ids)
+	sort.Strings(expected)
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("list by scope should only return clients holding the scope, got: %v, want: %v", ids, expected)
+	}
+}
+
+func testClientListByContact(t *testing.T, ctx context.Context, store storage.Store) {
+	contact := uuid.NewString() + "@example.com"
+	var expected []string
+	seeds := []struct {
+		contacts []string
+		matches  bool
+	}{
+		{contacts: []string{contact}, matches: true},
+		{contacts: []string{"admin@example.com", contact}, matches: true},
+		{contacts: []string{"admin@example.com"}, matches: false},
+		{contacts: nil, matches: false},
+	}
+	for _, seed := range seeds {
+		client := newClient()
+		client.Contacts = seed.contacts
+		client = createClientFrom(t, ctx, store, client)
+		if seed.matches {
+			expected = append(expected, client.ID)
+		}
+	}
+
+	got, err := store.ClientManager.ListByContact(ctx, contact)
+	if err != nil {
+		t.Fatalf("list by contact should return no errors, got: %v", err)
+	}
+	var ids []string
+	for _, client := range got {
+		ids = append(ids, client.ID)
+	}
+	sort.Strings(ids)
+	sort.Strings(expected)
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("list by contact should only return clients listing the contact, got: %v, want: %v", ids, expected)
+	}
+}
+
+func testClientListScopePrefix(t *testing.T, ctx context.Context, store storage.Store) {
+	// Scopes are namespaced per run, as the store is shared between tests.
+	root := uuid.NewString()
+	var expected []string
+	seeds := []struct {
+		scopes  []string
+		matches bool
+	}{
+		{scopes: []string{root}, matches: true},
+		{scopes: []string{"openid", root + ".read"}, matches: true},
+		{scopes: []string{root + ".write.all"}, matches: true},
+		{scopes: []string{"openid", "videos." + root}, matches: false},
+		{scopes: nil, matches: false},
+	}
+	for _, seed := range seeds {
+		client := newClient()
+		client.Scopes = seed.scopes
+		client = createClientFrom(t, ctx, store, client)
+		if seed.matches {
+			expected = append(expected, client.ID)
+		}
+	}
+
+	withOpenID := expected[1]
+
+	got, err := store.ClientManager.List(ctx, storage.ListClientsRequest{ScopePrefix: root})
+	if err != nil {
+		t.Fatalf("list should return no errors, got: %v", err)
+	}
+	var ids []string
+	for _, client := range got {
+		ids = append(ids, client.ID)
+	}
+	sort.Strings(ids)
+	sort.Strings(expected)
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("list should only return clients holding a scope under the prefix, got: %v, want: %v", ids, expected)
+	}
+
+	// Exact scope filters continue to apply alongside the prefix.
+	got, err = store.ClientManager.List(ctx, storage.ListClientsRequest{
+		ScopePrefix: root,
+		ScopesUnion: []string{"openid"},
+	})
+	if err != nil {
+		t.Fatalf("list should return no errors, got: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != withOpenID {
+		t.Errorf("list should apply both the scope prefix and exact scopes, got: %+v", got)
+	}
+}
+
+func testUserCreate(t *testing.T, ctx context.Context, store storage.Store) {
+	expected := createUser(t, ctx, store)
+	if expected.Password == secret {
+		t.Errorf("create should hash the user's password")
+	}
+
+	got, err := store.UserManager.Get(ctx, expected.ID)
+	if err != nil {
+		t.Fatalf("get should return no errors, got: %v", err)
+	}
+	if got.ID != expected.ID || got.Username != expected.Username {
+		t.Errorf("get should return the created user, got: %+v, want: %+v", got, expected)
+	}
+
+	got, err = store.UserManager.GetByUsername(ctx, expected.Username)
+	if err != nil {
+		t.Fatalf("get by username should return no errors, got: %v", err)
+	}
+	if got.ID != expected.ID {
+		t.Errorf("get by username should return the created user, got: %s, want: %s", got.ID, expected.ID)
+	}
+
+	exists, err := store.UserManager.UsernameExists(ctx, expected.Username)
+	if err != nil || !exists {
+		t.Errorf("username exists should report the created user, got: %v, %v", exists, err)
+	}
+}
+
+func testUserCreateDuplicate(t *testing.T, ctx context.Context, store storage.Store) {
+	user := createUser(t, ctx, store)
+
+	duplicateID := newUser()
+	duplicateID.ID = user.ID
+	_, err := store.UserManager.Create(ctx, duplicateID)
+	if !errors.Is(err, storage.ErrResourceExists) {
+		t.Errorf("create with a duplicate ID should conflict, got: %v, want: %v", err, storage.ErrResourceExists)
+	}
+
+	duplicateUsername := newUser()
+	duplicateUsername.Username = user.Username
+	_, err = store.UserManager.Create(ctx, duplicateUsername)
+	if !errors.Is(err, storage.ErrResourceExists) {
+		t.Errorf("create with a duplicate username should conflict, got: %v, want: %v", err, storage.ErrResourceExists)
+	}
+}
+
+func testUserReuseDisabledUsername(t *testing.T, ctx context.Context, store storage.Store) {
+	disabled := createUser(t, ctx, store)
+	_, err := store.UserManager.Disable(ctx, disabled.ID)
+	if err != nil {
+		t.Fatalf("disable should return no errors, got: %v", err)
+	}
+
+	reused := newUser()
+	reused.Username = disabled.Username
+	reused, err = store.UserManager.Create(ctx, reused)
+	if err != nil {
+		t.Fatalf("create should reuse the username of a disabled user, got: %v", err)
+	}
+
+	got, err := store.UserManager.GetByUsername(ctx, disabled.Username)
+	if err != nil {
+		t.Fatalf("get by username should return no errors, got: %v", err)
+	}
+	if got.ID != reused.ID {
+		t.Errorf("get by username should prefer the enabled user, got: %s, want: %s", got.ID, reused.ID)
+	}
+
+	_, err = store.UserManager.Enable(ctx, disabled.ID)
+	if !errors.Is(err, storage.ErrResourceExists) {
+		t.Errorf("enable should conflict with the user reusing the username, got: %v, want: %v", err, storage.ErrResourceExists)
+	}
+}
+
+func testUserGetNotFound(t *testing.T, ctx context.Context, store storage.Store) {
+	_, err := store.UserManager.Get(ctx, uuid.NewString())
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+
+	err = store.UserManager.Delete(ctx, uuid.NewString())
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("deleting a missing user should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+}
+
+func testUserUpdate(t *testing.T, ctx context.Context, store storage.Store) {
+	user := createUser(t, ctx, store)
+
+	user.FirstName = "Updated"
+	user.Password = ""
+	got, err := store.UserManager.Update(ctx, user.ID, user)
+	if err != nil {
+		t.Fatalf("update should return no errors, got: %v", err)
+	}
+	if got.FirstName != "Updated" {
+		t.Errorf("update should return the updated user, got: %s, want: %s", got.FirstName, "Updated")
+	}
+
+	_, err = store.UserManager.Authenticate(ctx, user.Username, secret)
+	if err != nil {
+		t.Errorf("update with a blank password should retain the existing password, got: %v", err)
+	}
+
+	_, err = store.UserManager.Update(ctx, uuid.NewString(), newUser())
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("update of a missing user should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+}
+
+func testUserList(t *testing.T, ctx context.Context, store storage.Store) {
+	user := createUser(t, ctx, store)
+	createUser(t, ctx, store)
+
+	got, err := store.UserManager.List(ctx, storage.ListUsersRequest{Username: user.Username})
+	if err != nil {
+		t.Fatalf("list should return no errors, got: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != user.ID {
+		t.Errorf("list should filter users by username, got: %+v", got)
+	}
+}
+
+func testUserListSearch(t *testing.T, ctx context.Context, store storage.Store) {
+	// Names are unique per run, as the store is shared between tests.
+	name := "x" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	user := newUser()
+	user.LastName = "Van " + name
+	user, err := store.UserManager.Create(ctx, user)
+	if err != nil {
+		t.Fatalf("create user should return no errors, got: %v", err)
+	}
+
+	tests := []struct {
+		search  string
+		matches bool
+	}{
+		{search: name[:12], matches: true},
+		{search: strings.ToUpper(name[:12]), matches: true},
+		{search: "van " + name[:12], matches: true},
+		{search: name[4:16], matches: false},
+	}
+	for _, tt := range tests {
+		got, err := store.UserManager.List(ctx, storage.ListUsersRequest{Search: tt.search})
+		if err != nil {
+			t.Fatalf("list should return no errors, got: %v", err)
+		}
+		if matched := len(got) == 1 && got[0].ID == user.ID; matched != tt.matches || len(got) > 1 {
+			t.Errorf("search for %q should match: %v, got: %+v", tt.search, tt.matches, got)
+		}
+	}
+
+	renamed := "y" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	user.FirstName = renamed
+	_, err = store.UserManager.Update(ctx, user.ID, user)
+	if err != nil {
+		t.Fatalf("update user should return no errors, got: %v", err)
+	}
+	got, err := store.UserManager.List(ctx, storage.ListUsersRequest{Search: renamed[:12]})
+	if err != nil {
+		t.Fatalf("list should return no errors, got: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != user.ID {
+		t.Errorf("search should match an updated user's new name, got: %+v", got)
+	}
+}
+
+func testUserListScopePrefix(t *testing.T, ctx context.Context, store storage.Store) {
+	// Scopes are namespaced per run, as the store is shared between tests.
+	root := uuid.NewString()
+	var expected []string
+	seeds := []struct {
+		scopes  []string
+		matches bool
+	}{
+		{scopes: []string{root + ".read"}, matches: true},
+		{scopes: []string{"openid", root + ".write"}, matches: true},
+		{scopes: []string{"openid", "videos." + root}, matches: false},
+	}
+	for _, seed := range seeds {
+		user := newUser()
+		user.Scopes = seed.scopes
+		user, err := store.UserManager.Create(ctx, user)
+		if err != nil {
+			t.Fatalf("create user should return no errors, got: %v", err)
+		}
+		if seed.matches {
+			expected = append(expected, user.ID)
+		}
+	}
+
+	got, err := store.UserManager.List(ctx, storage.ListUsersRequest{ScopePrefix: root + "."})
+	if err != nil {
+		t.Fatalf("list should return no errors, got: %v", err)
+	}
+	var ids []string
+	for _, user := range got {
+		ids = append(ids, user.ID)
+	}
+	sort.Strings(ids)
+	sort.Strings(expected)
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("list should only return users holding a scope under the prefix, got: %v, want: %v", ids, expected)
+	}
+}
+
+func testUserAuthenticate(t *testing.T, ctx context.Context, store storage.Store) {
+	user := createUser(t, ctx, store)
+
+	got, err := store.UserManager.Authenticate(ctx, user.Username, secret)
+	if err != nil {
+		t.Fatalf("authenticate should return no errors, got: %v", err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("authenticate should return the user, got: %s, want: %s", got.ID, user.ID)
+	}
+
+	// A wrong password and a missing user are indistinguishable.
+	_, err = store.UserManager.Authenticate(ctx, user.Username, "wrong")
+	if !errors.Is(err, storage.ErrInvalidCredentials) {
+		t.Errorf("authenticate with the wrong password should return invalid credentials, got: %v, want: %v", err, storage.ErrInvalidCredentials)
+	}
+	_, err = store.UserManager.Authenticate(ctx, uuid.NewString(), secret)
+	if !errors.Is(err, storage.ErrInvalidCredentials) {
+		t.Errorf("authenticate of a missing user should return invalid credentials, got: %v, want: %v", err, storage.ErrInvalidCredentials)
+	}
+	_, err = store.UserManager.AuthenticateByID(ctx, user.ID, "wrong")
+	if !errors.Is(err, storage.ErrInvalidCredentials) {
+		t.Errorf("authenticate by id with the wrong password should return invalid credentials, got: %v, want: %v", err, storage.ErrInvalidCredentials)
+	}
+	_, err = store.UserManager.AuthenticateByID(ctx, uuid.NewString(), secret)
+	if !errors.Is(err, storage.ErrInvalidCredentials) {
+		t.Errorf("authenticate by id of a missing user should return invalid credentials, got: %v, want: %v", err, storage.ErrInvalidCredentials)
+	}
+
+	// The password grant reports invalid credentials as not found, which
+	// fosite treats as an invalid grant.
+	err = store.RequestManager.Authenticate(ctx, user.Username, "wrong")
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("password grant authenticate with the wrong password should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+
+	_, err = store.UserManager.Disable(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("disable should return no errors, got: %v", err)
+	}
+
+	_, err = store.UserManager.Authenticate(ctx, user.Username, secret)
+	if !errors.Is(err, storage.ErrInvalidCredentials) {
+		t.Errorf("authenticate of a disabled user should return invalid credentials, got: %v, want: %v", err, storage.ErrInvalidCredentials)
+	}
+
+	_, err = store.UserManager.Authenticate(storage.WithIncludeDisabled(ctx), user.Username, secret)
+	if !errors.Is(err, fosite.ErrAccessDenied) {
+		t.Errorf("authenticate of an included disabled user should be denied, got: %v, want: %v", err, fosite.ErrAccessDenied)
+	}
+	_, err = store.UserManager.Authenticate(storage.WithIncludeDisabled(ctx), user.Username, "wrong")
+	if !errors.Is(err, storage.ErrInvalidCredentials) {
+		t.Errorf("authenticate of an included disabled user with the wrong password should return invalid credentials, got: %v, want: %v", err, storage.ErrInvalidCredentials)
+	}
+	_, err = store.UserManager.AuthenticateByID(ctx, user.ID, "wrong")
+	if !errors.Is(err, storage.ErrInvalidCredentials) {
+		t.Errorf("authenticate by id of a disabled user with the wrong password should return invalid credentials, got: %v, want: %v", err, storage.ErrInvalidCredentials)
+	}
+}
+
+func testUserAuthenticateMigration(t *testing.T, ctx context.Context, store storage.Store) {
+	user := createUser(t, ctx, store)
+	currentAuth := func(user storage.User, authenticated bool) storage.AuthUserFunc {
+		return func(context.Context) (storage.User, bool) {
+			return user, authenticated
+		}
+	}
+
+	got, err := store.UserManager.AuthenticateMigration(ctx, currentAuth(user, false), user.ID, secret)
+	if err != nil {
+		t.Fatalf("authenticate migration should fall back to the hasher, got: %v", err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("authenticate migration should return the user, got: %s, want: %s", got.ID, user.ID)
+	}
+
+	// A wrong password and a missing user are indistinguishable.
+	_, err = store.UserManager.AuthenticateMigration(ctx, currentAuth(user, false), user.ID, "wrong")
+	if !errors.Is(err, storage.ErrInvalidCredentials) {
+		t.Errorf("authenticate migration with the wrong password should return invalid credentials, got: %v, want: %v", err, storage.ErrInvalidCredentials)
+	}
+	_, err = store.UserManager.AuthenticateMigration(ctx, currentAuth(storage.User{}, false), uuid.NewString(), secret)
+	if !errors.Is(err, storage.ErrInvalidCredentials) {
+		t.Errorf("authenticate migration of a missing user should return invalid credentials, got: %v, want: %v", err, storage.ErrInvalidCredentials)
+	}
+
+	// Disabled and locked users are only denied once the password has been
+	// verified.
+	disabled := user
+	disabled.Disabled = true
+	locked := user
+	locked.LockedUntil = time.Now().Add(time.Hour).Unix()
+	for _, denied := range []storage.User{disabled, locked} {
+		_, err = store.UserManager.AuthenticateMigration(ctx, currentAuth(denied, false), user.ID, "wrong")
+		if !errors.Is(err, storage.ErrInvalidCredentials) {
+			t.Errorf("authenticate migration of a denied user with the wrong password should return invalid credentials, got: %v, want: %v", err, storage.ErrInvalidCredentials)
+		}
+		_, err = store.UserManager.AuthenticateMigration(ctx, currentAuth(denied, false), user.ID, secret)
+		if !errors.Is(err, fosite.ErrAccessDenied) {
+			t.Errorf("authenticate migration of a disabled or locked user should be denied, got: %v, want: %v", err, fosite.ErrAccessDenied)
+		}
+	}
+
+	// A user authenticated by the current function has their hash upgraded.
+	legacyPassword := "l3gacyPassword!"
+	_, err = store.UserManager.AuthenticateMigration(ctx, currentAuth(user, true), user.ID, legacyPassword)
+	if err != nil {
+		t.Fatalf("authenticate migration should return no errors, got: %v", err)
+	}
+	_, err = store.UserManager.Authenticate(ctx, user.Username, legacyPassword)
+	if err != nil {
+		t.Errorf("authenticate should accept the migrated password, got: %v", err)
+	}
+}
+
+func testUserResetFailedLogins(t *testing.T, ctx context.Context, store storage.Store) {
+	user := createUser(t, ctx, store)
+	user.Password = ""
+	user.FailedLoginCount = 5
+	user.LockedUntil = time.Now().Add(time.Hour).Unix()
+	_, err := store.UserManager.Update(ctx, user.ID, user)
+	if err != nil {
+		t.Fatalf("update should return no errors, got: %v", err)
+	}
+
+	_, err = store.UserManager.Authenticate(ctx, user.Username, secret)
+	if !errors.Is(err, fosite.ErrAccessDenied) {
+		t.Errorf("authenticate of a locked user should be denied, got: %v, want: %v", err, fosite.ErrAccessDenied)
+	}
+	_, err = store.UserManager.AuthenticateByID(ctx, user.ID, secret)
+	if !errors.Is(err, fosite.ErrAccessDenied) {
+		t.Errorf("authenticate by id of a locked user should be denied, got: %v, want: %v", err, fosite.ErrAccessDenied)
+	}
+	_, err = store.UserManager.Authenticate(ctx, user.Username, "wrong")
+	if !errors.Is(err, storage.ErrInvalidCredentials) {
+		t.Errorf("authenticate of a locked user with the wrong password should return invalid credentials, got: %v, want: %v", err, storage.ErrInvalidCredentials)
+	}
+
+	got, err := store.UserManager.ResetFailedLogins(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("reset failed logins should return no errors, got: %v", err)
+	}
+	if got.FailedLoginCount != 0 || got.LockedUntil != 0 {
+		t.Errorf("reset failed logins should clear the lockout, got: count %d, locked until %d", got.FailedLoginCount, got.LockedUntil)
+	}
+
+	_, err = store.UserManager.Authenticate(ctx, user.Username, secret)
+	if err != nil {
+		t.Errorf("authenticate after reset failed logins should return no errors, got: %v", err)
+	}
+
+	_, err = store.UserManager.ResetFailedLogins(ctx, uuid.NewString())
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("reset failed logins of an unknown user should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+}
+
+func testUserGetExcludesDisabled(t *testing.T, ctx context.Context, store storage.Store) {
+	user := createUser(t, ctx, store)
+	_, err := store.UserManager.Disable(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("disable should return no errors, got: %v", err)
+	}
+
+	_, err = store.UserManager.Get(ctx, user.ID)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get should exclude disabled users, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+	_, err = store.UserManager.GetByUsername(ctx, user.Username)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get by username should exclude disabled users, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+
+	includeDisabled := storage.WithIncludeDisabled(ctx)
+	got, err := store.UserManager.Get(includeDisabled, user.ID)
+	if err != nil {
+		t.Fatalf("get should include disabled users when requested, got: %v", err)
+	}
+	if got.ID != user.ID || !got.Disabled {
+		t.Errorf("get should return the disabled user, got: %+v", got)
+	}
+	got, err = store.UserManager.GetByUsername(includeDisabled, user.Username)
+	if err != nil {
+		t.Fatalf("get by username should include disabled users when requested, got: %v", err)
+	}
+	if got.ID != user.ID || !got.Disabled {
+		t.Errorf("get by username should return the disabled user, got: %+v", got)
+	}
+}
+
+func testUserGetByLogin(t *testing.T, ctx context.Context, store storage.Store) {
+	user := newUser()
+	user.Email = uuid.NewString() + "@example.com"
+	user, err := store.UserManager.Create(ctx, user)
+	if err != nil {
+		t.Fatalf("create user should return no errors, got: %v", err)
+	}
+
+	got, err := store.UserManager.GetByLogin(ctx, user.Username)
+	if err != nil {
+		t.Fatalf("get by login should match the username, got: %v", err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("get by login should return the user matching the username, got: %v, want: %v", got.ID, user.ID)
+	}
+
+	got, err = store.UserManager.GetByLogin(ctx, user.Email)
+	if err != nil {
+		t.Fatalf("get by login should match the email, got: %v", err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("get by login should return the user matching the email, got: %v, want: %v", got.ID, user.ID)
+	}
+
+	_, err = store.UserManager.GetByLogin(ctx, uuid.NewString())
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get by login should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+
+	// Another user holding the first user's email as their username makes
+	// the login ambiguous.
+	collision := newUser()
+	collision.Username = user.Email
+	_, err = store.UserManager.Create(ctx, collision)
+	if err != nil {
+		t.Fatalf("create user should return no errors, got: %v", err)
+	}
+
+	_, err = store.UserManager.GetByLogin(ctx, user.Email)
+	if !errors.Is(err, storage.ErrMultipleResults) {
+		t.Errorf("get by login should reject ambiguous logins, got: %v, want: %v", err, storage.ErrMultipleResults)
+	}
+}
+
+func testUserUpdatePassword(t *testing.T, ctx context.Context, store storage.Store) {
+	user := createUser(t, ctx, store)
+	newPassword := "s0methingElse!"
+
+	err := store.UserManager.UpdatePassword(ctx, user.ID, newPassword)
+	if err != nil {
+		t.Fatalf("update password should return no errors, got: %v", err)
+	}
+
+	got, err := store.UserManager.Authenticate(ctx, user.Username, newPassword)
+	if err != nil {
+		t.Fatalf("authenticate with the new password should return no errors, got: %v", err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("authenticate should return the user, got: %s, want: %s", got.ID, user.ID)
+	}
+
+	_, err = store.UserManager.Authenticate(ctx, user.Username, secret)
+	if err == nil {
+		t.Errorf("authenticate with the old password should return an error")
+	}
+
+	err = store.UserManager.UpdatePassword(ctx, uuid.NewString(), newPassword)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("update password should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+}
+
+func testUserMigrateVersioned(t *testing.T, ctx context.Context, store storage.Store) {
+	migrated := newUser()
+	migrated.FirstName = "Created"
+	migrated.SourceUpdatedAt = 100
+
+	_, err := store.UserManager.Migrate(ctx, migrated)
+	if err != nil {
+		t.Fatalf("migrate should create the user, got: %v", err)
+	}
+
+	migrated.FirstName = "Overwritten"
+	migrated.SourceUpdatedAt = 200
+	_, err = store.UserManager.Migrate(ctx, migrated)
+	if err != nil {
+		t.Fatalf("migrate from a newer version should overwrite the user, got: %v", err)
+	}
+
+	for _, version := range []int64{200, 150} {
+		stale := migrated
+		stale.FirstName = "Stale"
+		stale.SourceUpdatedAt = version
+		_, err = store.UserManager.Migrate(ctx, stale)
+		if !errors.Is(err, storage.ErrMigrationStale) {
+			t.Errorf("migrate from version %d should be skipped, got: %v, want: %v", version, err, storage.ErrMigrationStale)
+		}
+	}
+
+	got, err := store.UserManager.Get(ctx, migrated.ID)
+	if err != nil {
+		t.Fatalf("get should return no errors, got: %v", err)
+	}
+	if got.FirstName != "Overwritten" || got.SourceUpdatedAt != 200 {
+		t.Errorf("migrate should keep the newest version, got: %s at %d, want: Overwritten at 200", got.FirstName, got.SourceUpdatedAt)
+	}
+}
+
+func testUserScopes(t *testing.T, ctx context.Context, store storage.Store) {
+	user := createUser(t, ctx, store)
+
+	got, err := store.UserManager.GrantScopes(ctx, user.ID, []string{"profile", "openid"})
+	if err != nil {
+		t.Fatalf("grant scopes should return no errors, got: %v", err)
+	}
+	if !reflect.DeepEqual(got.Scopes, []string{"openid", "profile"}) {
+		t.Errorf("grant scopes should add missing scopes, got: %v, want: %v", got.Scopes, []string{"openid", "profile"})
+	}
+
+	got, err = store.UserManager.RemoveScopes(ctx, user.ID, []string{"openid"})
+	if err != nil {
+		t.Fatalf("remove scopes should return no errors, got: %v", err)
+	}
+	if !reflect.DeepEqual(got.Scopes, []string{"profile"}) {
+		t.Errorf("remove scopes should remove the scopes, got: %v, want: %v", got.Scopes, []string{"profile"})
+	}
+
+	got, err = store.UserManager.RemoveAllScopes(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("remove all scopes should return no errors, got: %v", err)
+	}
+	if len(got.Scopes) != 0 {
+		t.Errorf("remove all scopes should remove every scope, got: %v", got.Scopes)
+	}
+
+	_, err = store.UserManager.RemoveScopes(ctx, uuid.NewString(), []string{"openid"})
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("remove scopes from a missing user should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+}
+
+func testUserGrantScopesToMany(t *testing.T, ctx context.Context, store storage.Store) {
+	first := createUser(t, ctx, store)
+	second := createUser(t, ctx, store)
+	untargeted := createUser(t, ctx, store)
+
+	userIDs := []string{first.ID, second.ID, uuid.NewString()}
+	err := store.UserManager.GrantScopesToMany(ctx, userIDs, []string{"profile", "openid"})
+	if err != nil {
+		t.Fatalf("grant scopes to many should return no errors, got: %v", err)
+	}
+
+	for _, user := range []storage.User{first, second} {
+		got, err := store.UserManager.Get(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("get user should return no errors, got: %v", err)
+		}
+		if !reflect.DeepEqual(got.Scopes, []string{"openid", "profile"}) {
+			t.Errorf("grant scopes to many should add missing scopes, got: %v, want: %v", got.Scopes, []string{"openid", "profile"})
+		}
+	}
+
+	got, err := store.UserManager.Get(ctx, untargeted.ID)
+	if err != nil {
+		t.Fatalf("get user should return no errors, got: %v", err)
+	}
+	if !reflect.DeepEqual(got.Scopes, untargeted.Scopes) {
+		t.Errorf("grant scopes to many should leave other users untouched, got: %v, want: %v", got.Scopes, untargeted.Scopes)
+	}
+}
+
+func testUserTOTP(t *testing.T, ctx context.Context, store storage.Store) {
+	user := createUser(t, ctx, store)
+
+	_, err := store.UserManager.GetTOTPSecret(ctx, user.ID)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get totp secret before enrolling should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+
+	got, err := store.UserManager.EnrollTOTP(ctx, user.ID, "totp-secret", []string{"recovery-code"})
+	if err != nil {
+		t.Fatalf("enroll totp should return no errors, got: %v", err)
+	}
+	if !got.MFAEnabled {
+		t.Errorf("enroll totp should enable mfa")
+	}
+
+	totpSecret, err := store.UserManager.GetTOTPSecret(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("get totp secret should return no errors, got: %v", err)
+	}
+	if totpSecret != "totp-secret" {
+		t.Errorf("get totp secret should return the enrolled secret, got: %s, want: %s", totpSecret, "totp-secret")
+	}
+
+	authenticated, err := store.UserManager.AuthenticateByID(ctx, user.ID, secret)
+	if err != nil {
+		t.Fatalf("authenticate by id should return no errors, got: %v", err)
+	}
+	if authenticated.TOTPSecret != "" || len(authenticated.RecoveryCodes) != 0 {
+		t.Errorf("authenticate by id should not return the mfa secrets, got: %q, %v", authenticated.TOTPSecret, authenticated.RecoveryCodes)
+	}
+
+	authenticated, err = store.UserManager.AuthenticateByUsername(ctx, user.Username, secret)
+	if err != nil {
+		t.Fatalf("authenticate by username should return no errors, got: %v", err)
+	}
+	if authenticated.TOTPSecret != "" || len(authenticated.RecoveryCodes) != 0 {
+		t.Errorf("authenticate by username should not return the mfa secrets, got: %q, %v", authenticated.TOTPSecret, authenticated.RecoveryCodes)
+	}
+
+	err = store.UserManager.ConsumeRecoveryCode(ctx, user.ID, "recovery-code")
+	if err != nil {
+		t.Errorf("consume recovery code should return no errors, got: %v", err)
+	}
+
+	err = store.UserManager.ConsumeRecoveryCode(ctx, user.ID, "recovery-code")
+	if !errors.Is(err, fosite.ErrAccessDenied) {
+		t.Errorf("consuming a recovery code twice should be denied, got: %v, want: %v", err, fosite.ErrAccessDenied)
+	}
+
+	got, err = store.UserManager.DisableMFA(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("disable mfa should return no errors, got: %v", err)
+	}
+	if got.MFAEnabled {
+		t.Errorf("disable mfa should disable mfa")
+	}
+}
+
+func testUserVerifyEmailToken(t *testing.T, ctx context.Context, store storage.Store) {
+	expected := newUser()
+	expected.EmailVerificationToken = uuid.NewString()
+	expected.EmailVerificationExpiry = time.Now().Add(time.Hour).Unix()
+	user, err := store.UserManager.Create(ctx, expected)
+	if err != nil {
+		t.Fatalf("create user should return no errors, got: %v", err)
+	}
+
+	got, err := store.UserManager.VerifyEmailToken(ctx, expected.EmailVerificationToken)
+	if err != nil {
+		t.Fatalf("verify email token should return no errors, got: %v", err)
+	}
+	if got.ID != user.ID || !got.EmailVerified {
+		t.Errorf("verify email token should return the verified user, got: %+v", got)
+	}
+
+	_, err = store.UserManager.VerifyEmailToken(ctx, expected.EmailVerificationToken)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("verifying an email token twice should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+}
+
+func testAccessTokenSession(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+	request := newRequester(client.ID, uuid.NewString())
+	signature := uuid.NewString()
+
+	err := store.RequestManager.CreateAccessTokenSession(ctx, signature, request)
+	if err != nil {
+		t.Fatalf("create access token session should return no errors, got: %v", err)
+	}
+
+	got, err := store.RequestManager.GetAccessTokenSession(ctx, signature, &fosite.DefaultSession{})
+	if err != nil {
+		t.Fatalf("get access token session should return no errors, got: %v", err)
+	}
+	if got.GetID() != request.GetID() {
+		t.Errorf("get access token session should return the request, got: %s, want: %s", got.GetID(), request.GetID())
+	}
+	if got.GetSession().GetSubject() != request.GetSession().GetSubject() {
+		t.Errorf("get access token session should hydrate the session, got: %s, want: %s", got.GetSession().GetSubject(), request.GetSession().GetSubject())
+	}
+
+	err = store.RequestManager.DeleteAccessTokenSession(ctx, signature)
+	if err != nil {
+		t.Fatalf("delete access token session should return no errors, got: %v", err)
+	}
+
+	_, err = store.RequestManager.GetAccessTokenSession(ctx, signature, &fosite.DefaultSession{})
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get access token session after delete should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+}
+
+func testAccessTokenSessionForAudience(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+	request := newRequester(client.ID, uuid.NewString())
+	request.GrantedAudience = fosite.Arguments{"https://api.example.com"}
+	signature := uuid.NewString()
+
+	err := store.RequestManager.CreateAccessTokenSession(ctx, signature, request)
+	if err != nil {
+		t.Fatalf("create access token session should return no errors, got: %v", err)
+	}
+
+	got, err := store.RequestManager.GetAccessTokenSessionForAudience(ctx, signature, "https://api.example.com", &fosite.DefaultSession{})
+	if err != nil {
+		t.Fatalf("get access token session for a granted audience should return no errors, got: %v", err)
+	}
+	if got.GetID() != request.GetID() {
+		t.Errorf("get access token session for a granted audience should return the request, got: %s, want: %s", got.GetID(), request.GetID())
+	}
+
+	_, err = store.RequestManager.GetAccessTokenSessionForAudience(ctx, signature, "https://other.example.com", &fosite.DefaultSession{})
+	if !errors.Is(err, storage.ErrAudienceMismatch) {
+		t.Errorf("get access token session for another audience should mismatch, got: %v, want: %v", err, storage.ErrAudienceMismatch)
+	}
+}
+
+func testCreateSessionIdempotent(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+	request := newRequester(client.ID, uuid.NewString())
+	signature := uuid.NewString()
+
+	for i := 0; i < 2; i++ {
+		err := store.RequestManager.CreateAccessTokenSession(ctx, signature, request)
+		if err != nil {
+			t.Fatalf("create access token session should return no errors on retry, got: %v", err)
+		}
+		err = store.RequestManager.CreateRefreshTokenSession(ctx, signature, request)
+		if err != nil {
+			t.Fatalf("create refresh token session should return no errors on retry, got: %v", err)
+		}
+	}
+
+	for _, entityName := range []string{storage.EntityAccessTokens, storage.EntityRefreshTokens} {
+		got, err := store.RequestManager.List(ctx, entityName, storage.ListRequestsRequest{ClientID: client.ID})
+		if err != nil {
+			t.Fatalf("list should return no errors, got: %v", err)
+		}
+		if len(got) != 1 {
+			t.Errorf("retried create should store a single %s session, got: %d, want: 1", entityName, len(got))
+		}
+	}
+
+	// A different request presenting the same signature isn't a retry.
+	err := store.RequestManager.CreateRefreshTokenSession(ctx, signature, newRequester(client.ID, uuid.NewString()))
+	if !errors.Is(err, storage.ErrResourceExists) {
+		t.Errorf("create refresh token session should conflict on a different request, got: %v, want: %v", err, storage.ErrResourceExists)
+	}
+}
+
+func testAuthorizeCodeSession(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+	request := newRequester(client.ID, uuid.NewString())
+	code := uuid.NewString()
+
+	_, err := store.RequestManager.GetAuthorizeCodeSession(ctx, code, &fosite.DefaultSession{})
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get authorize code session should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+
+	err = store.RequestManager.CreateAuthorizeCodeSession(ctx, code, request)
+	if err != nil {
+		t.Fatalf("create authorize code session should return no errors, got: %v", err)
+	}
+
+	got, err := store.RequestManager.GetAuthorizeCodeSession(ctx, code, &fosite.DefaultSession{})
+	if err != nil {
+		t.Fatalf("get authorize code session should return no errors, got: %v", err)
+	}
+	if got.GetID() != request.GetID() {
+		t.Errorf("get authorize code session should return the request, got: %s, want: %s", got.GetID(), request.GetID())
+	}
+
+	err = store.RequestManager.InvalidateAuthorizeCodeSession(ctx, code)
+	if err != nil {
+		t.Fatalf("invalidate authorize code session should return no errors, got: %v", err)
+	}
+
+	got, err = store.RequestManager.GetAuthorizeCodeSession(ctx, code, &fosite.DefaultSession{})
+	if !errors.Is(err, fosite.ErrInvalidatedAuthorizeCode) {
+		t.Errorf("get invalidated authorize code session should return invalidated, got: %v, want: %v", err, fosite.ErrInvalidatedAuthorizeCode)
+	}
+	if got == nil || got.GetID() != request.GetID() {
+		t.Errorf("get invalidated authorize code session should still return the request")
+	}
+
+	err = store.RequestManager.InvalidateAuthorizeCodeSession(ctx, code)
+	if !errors.Is(err, fosite.ErrInvalidatedAuthorizeCode) {
+		t.Errorf("invalidate authorize code session should only succeed once, got: %v, want: %v", err, fosite.ErrInvalidatedAuthorizeCode)
+	}
+
+	err = store.RequestManager.InvalidateAuthorizeCodeSession(ctx, uuid.NewString())
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("invalidate authorize code session should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+}
+
+func testAuthorizeCodeConcurrentRedemption(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+	request := newRequester(client.ID, uuid.NewString())
+	code := uuid.NewString()
+
+	err := store.RequestManager.CreateAuthorizeCodeSession(ctx, code, request)
+	if err != nil {
+		t.Fatalf("create authorize code session should return no errors, got: %v", err)
+	}
+
+	const redemptions = 2
+	errs := make(chan error, redemptions)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < redemptions; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			errs <- store.RequestManager.InvalidateAuthorizeCodeSession(ctx, code)
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, fosite.ErrInvalidatedAuthorizeCode):
+			t.Errorf("concurrent redemption should return invalidated, got: %v, want: %v", err, fosite.ErrInvalidatedAuthorizeCode)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("exactly one concurrent redemption should succeed, got: %d", succeeded)
+	}
+}
+
+func testPurgeInvalidatedCodes(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+	invalidated := uuid.NewString()
+	active := uuid.NewString()
+	for _, code := range []string{invalidated, active} {
+		err := store.RequestManager.CreateAuthorizeCodeSession(ctx, code, newRequester(client.ID, uuid.NewString()))
+		if err != nil {
+			t.Fatalf("create authorize code session should return no errors, got: %v", err)
+		}
+	}
+
+	err := store.RequestManager.InvalidateAuthorizeCodeSession(ctx, invalidated)
+	if err != nil {
+		t.Fatalf("invalidate authorize code session should return no errors, got: %v", err)
+	}
+
+	_, err = store.RequestManager.PurgeInvalidatedCodes(ctx, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("purge invalidated codes should return no errors, got: %v", err)
+	}
+	_, err = store.RequestManager.GetAuthorizeCodeSession(ctx, invalidated, &fosite.DefaultSession{})
+	if !errors.Is(err, fosite.ErrInvalidatedAuthorizeCode) {
+		t.Errorf("purge should keep codes invalidated after the given time, got: %v, want: %v", err, fosite.ErrInvalidatedAuthorizeCode)
+	}
+
+	deleted, err := store.RequestManager.PurgeInvalidatedCodes(ctx, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("purge invalidated codes should return no errors, got: %v", err)
+	}
+	if deleted < 1 {
+		t.Errorf("purge should return the number of codes deleted, got: %d", deleted)
+	}
+	_, err = store.RequestManager.GetAuthorizeCodeSession(ctx, invalidated, &fosite.DefaultSession{})
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get purged authorize code session should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+
+	_, err = store.RequestManager.GetAuthorizeCodeSession(ctx, active, &fosite.DefaultSession{})
+	if err != nil {
+		t.Errorf("purge should keep active codes, got: %v", err)
+	}
+}
+
+func testRefreshTokenSession(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+	request := newRequester(client.ID, uuid.NewString())
+	signature := uuid.NewString()
+
+	err := store.RequestManager.CreateRefreshTokenSession(ctx, signature, request)
+	if err != nil {
+		t.Fatalf("create refresh token session should return no errors, got: %v", err)
+	}
+
+	err = store.RequestManager.CreateRefreshTokenSession(ctx, signature, newRequester(client.ID, uuid.NewString()))
+	if !errors.Is(err, storage.ErrResourceExists) {
+		t.Errorf("create refresh token session with a duplicate signature should conflict, got: %v, want: %v", err, storage.ErrResourceExists)
+	}
+
+	got, err := store.RequestManager.GetRefreshTokenSession(ctx, signature, &fosite.DefaultSession{})
+	if err != nil {
+		t.Fatalf("get refresh token session should return no errors, got: %v", err)
+	}
+	if got.GetID() != request.GetID() {
+		t.Errorf("get refresh token session should return the request, got: %s, want: %s", got.GetID(), request.GetID())
+	}
+
+	err = store.RequestManager.RevokeRefreshToken(ctx, request.GetID())
+	if err != nil {
+		t.Fatalf("revoke refresh token should return no errors, got: %v", err)
+	}
+
+	_, err = store.RequestManager.GetRefreshTokenSession(ctx, signature, &fosite.DefaultSession{})
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get revoked refresh token session should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+}
+
+func testRefreshTokenAccessLinkage(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+	request := newRequester(client.ID, uuid.NewString())
+	unlinkedSignature := uuid.NewString()
+	accessSignature := uuid.NewString()
+	refreshSignature := uuid.NewString()
+
+	requests := map[string]fosite.Requester{
+		unlinkedSignature: newRequester(client.ID, request.GetSession().GetSubject()),
+		accessSignature:   request,
+	}
+	for signature, requester := range requests {
+		err := store.RequestManager.CreateAccessTokenSession(ctx, signature, requester)
+		if err != nil {
+			t.Fatalf("create access token session should return no errors, got: %v", err)
+		}
+	}
+
+	err := store.RequestManager.CreateRefreshTokenSessionWithAccess(ctx, refreshSignature, accessSignature, request)
+	if err != nil {
+		t.Fatalf("create refresh token session should return no errors, got: %v", err)
+	}
+
+	got, err := store.RequestManager.List(ctx, storage.EntityRefreshTokens, storage.ListRequestsRequest{ClientID: client.ID})
+	if err != nil {
+		t.Fatalf("list should return no errors, got: %v", err)
+	}
+	if len(got) != 1 || got[0].AccessSignature != accessSignature {
+		t.Fatalf("create refresh token session should store the access token signature, got: %+v", got)
+	}
+
+	err = store.RequestManager.RevokeRefreshTokenBySignature(ctx, refreshSignature)
+	if err != nil {
+		t.Fatalf("revoke refresh token by signature should return no errors, got: %v", err)
+	}
+
+	_, err = store.RequestManager.GetRefreshTokenSession(ctx, refreshSignature, &fosite.DefaultSession{})
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get revoked refresh token session should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+
+	_, err = store.RequestManager.GetAccessTokenSession(ctx, accessSignature, &fosite.DefaultSession{})
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get linked access token session should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+
+	_, err = store.RequestManager.GetAccessTokenSession(ctx, unlinkedSignature, &fosite.DefaultSession{})
+	if err != nil {
+		t.Errorf("revoking should not cascade to unlinked access tokens, got: %v", err)
+	}
+
+	err = store.RequestManager.RevokeRefreshTokenBySignature(ctx, refreshSignature)
+	if err != nil {
+		t.Errorf("revoking an already revoked refresh token should return no errors, got: %v", err)
+	}
+}
+
+func testPKCERequestSession(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+	request := newRequester(client.ID, uuid.NewString())
+	request.Form.Set("code_challenge", "challenge")
+	request.Form.Set("code_challenge_method", "S256")
+	signature := uuid.NewString()
+
+	err := store.RequestManager.CreatePKCERequestSession(ctx, signature, request)
+	if err != nil {
+		t.Fatalf("create pkce request session should return no errors, got: %v", err)
+	}
+
+	got, err := store.RequestManager.GetPKCERequestSession(ctx, signature, &fosite.DefaultSession{})
+	if err != nil {
+		t.Fatalf("get pkce request session should return no errors, got: %v", err)
+	}
+	if got.GetRequestForm().Get("code_challenge") != "challenge" {
+		t.Errorf("get pkce request session should return the code challenge, got: %s, want: %s", got.GetRequestForm().Get("code_challenge"), "challenge")
+	}
+
+	err = store.RequestManager.DeletePKCERequestSession(ctx, signature)
+	if err != nil {
+		t.Fatalf("delete pkce request session should return no errors, got: %v", err)
+	}
+
+	err = store.RequestManager.DeletePKCERequestSession(ctx, signature)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("deleting a missing pkce request session should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+}
+
+func testOpenIDConnectSession(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+	sid := uuid.NewString()
+	request := newRequester(client.ID, uuid.NewString())
+	request.Session = &openid.DefaultSession{
+		Subject: request.GetSession().GetSubject(),
+		Claims: &jwt.IDTokenClaims{
+			Subject: request.GetSession().GetSubject(),
+			Extra:   map[string]interface{}{"sid": sid},
+		},
+		Headers: &jwt.Headers{},
+	}
+	code := uuid.NewString()
+
+	err := store.RequestManager.CreateOpenIDConnectSession(ctx, code, request)
+	if err != nil {
+		t.Fatalf("create openid connect session should return no errors, got: %v", err)
+	}
+
+	requester := fosite.NewRequest()
+	requester.Session = &openid.DefaultSession{}
+	got, err := store.RequestManager.GetOpenIDConnectSession(ctx, code, requester)
+	if err != nil {
+		t.Fatalf("get openid connect session should return no errors, got: %v", err)
+	}
+	if got.GetID() != request.GetID() {
+		t.Errorf("get openid connect session should return the request, got: %s, want: %s", got.GetID(), request.GetID())
+	}
+
+	sessions, err := store.RequestManager.GetOpenIDSessionsBySid(ctx, sid)
+	if err != nil {
+		t.Fatalf("get openid sessions by sid should return no errors, got: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != request.GetID() {
+		t.Errorf("get openid sessions by sid should return the session, got: %+v", sessions)
+	}
+
+	err = store.RequestManager.DeleteOpenIDSessionsBySid(ctx, sid)
+	if err != nil {
+		t.Fatalf("delete openid sessions by sid should return no errors, got: %v", err)
+	}
+
+	_, err = store.RequestManager.GetOpenIDConnectSession(ctx, code, requester)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get deleted openid connect session should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+}
+
+func testDeleteByRegion(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+	region := uuid.NewString()
+
+	for _, r := range []string{region, uuid.NewString()} {
+		request := storage.NewRequestFromRequester(uuid.NewString(), newRequester(client.ID, uuid.NewString()), fosite.AccessToken)
+		request.Region = r
+		_, err := store.RequestManager.Create(ctx, storage.EntityAccessTokens, request)
+		if err != nil {
+			t.Fatalf("create should return no errors, got: %v", err)
+		}
+	}
+
+	err := store.RequestManager.DeleteByRegion(ctx, region)
+	if err != nil {
+		t.Fatalf("delete by region should return no errors, got: %v", err)
+	}
+
+	got, err := store.RequestManager.List(ctx, storage.EntityAccessTokens, storage.ListRequestsRequest{ClientID: client.ID})
+	if err != nil {
+		t.Fatalf("list should return no errors, got: %v", err)
+	}
+	if len(got) != 1 || got[0].Region == region {
+		t.Errorf("delete by region should only delete requests in the region, got: %+v", got)
+	}
+
+	err = store.RequestManager.DeleteByRegion(ctx, region)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("delete by region with nothing to delete should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+}
+
+func testDeleteByFilter(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+	otherClient := createClient(t, ctx, store)
+
+	create := func(clientID string, scopes ...string) storage.Request {
+		requester := newRequester(clientID, uuid.NewString())
+		requester.RequestedScope = append(requester.RequestedScope, scopes...)
+		request, err := store.RequestManager.Create(ctx, storage.EntityAccessTokens, storage.NewRequestFromRequester(uuid.NewString(), requester, fosite.AccessToken))
+		if err != nil {
+			t.Fatalf("create should return no errors, got: %v", err)
+		}
+		return request
+	}
+	targeted := create(client.ID, "admin")
+	kept := create(client.ID)
+	create(otherClient.ID, "admin")
+
+	filter := storage.ListRequestsRequest{
+		ClientID:    client.ID,
+		ScopesUnion: []string{"admin"},
+	}
+	deleted, err := store.RequestManager.DeleteByFilter(ctx, storage.EntityAccessTokens, filter)
+	if err != nil {
+		t.Fatalf("delete by filter should return no errors, got: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("delete by filter should return the number of requests deleted, got: %d, want: 1", deleted)
+	}
+
+	_, err = store.RequestManager.Get(ctx, storage.EntityAccessTokens, targeted.ID)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get deleted request should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+
+	got, err := store.RequestManager.List(ctx, storage.EntityAccessTokens, storage.ListRequestsRequest{ClientID: client.ID})
+	if err != nil {
+		t.Fatalf("list should return no errors, got: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != kept.ID {
+		t.Errorf("delete by filter should only delete the matching requests, got: %+v", got)
+	}
+
+	got, err = store.RequestManager.List(ctx, storage.EntityAccessTokens, storage.ListRequestsRequest{ClientID: otherClient.ID})
+	if err != nil {
+		t.Fatalf("list should return no errors, got: %v", err)
+	}
+	if len(got) != 1 {
+		t.Errorf("delete by filter should not delete other clients' requests, got: %+v", got)
+	}
+
+	deleted, err = store.RequestManager.DeleteByFilter(ctx, storage.EntityAccessTokens, filter)
+	if err != nil || deleted != 0 {
+		t.Errorf("delete by filter with nothing to delete should delete nothing, got: %d, %v", deleted, err)
+	}
+
+	deleted, err = store.RequestManager.DeleteByFilter(ctx, storage.EntityAccessTokens, storage.ListRequestsRequest{Limit: 10})
+	if !errors.Is(err, storage.ErrEmptyFilter) || deleted != 0 {
+		t.Errorf("delete by filter without filters should delete nothing, got: %d, %v, want: %v", deleted, err, storage.ErrEmptyFilter)
+	}
+
+	got, err = store.RequestManager.List(ctx, storage.EntityAccessTokens, storage.ListRequestsRequest{ClientID: client.ID})
+	if err != nil {
+		t.Fatalf("list should return no errors, got: %v", err)
+	}
+	if len(got) != 1 {
+		t.Errorf("delete by filter without filters should not delete any requests, got: %+v", got)
+	}
+}
+
+func testDeleteByFilterGrantedScopes(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+
+	// Each request requests both scopes, but is only granted one of them.
+	create := func(granted string) storage.Request {
+		requester := newRequester(client.ID, uuid.NewString())
+		requester.RequestedScope = fosite.Arguments{"read", "write"}
+		requester.GrantedScope = fosite.Arguments{granted}
+		request, err := store.RequestManager.Create(ctx, storage.EntityAccessTokens, storage.NewRequestFromRequester(uuid.NewString(), requester, fosite.AccessToken))
+		if err != nil {
+			t.Fatalf("create should return no errors, got: %v", err)
+		}
+		return request
+	}
+	targeted := create("write")
+	kept := create("read")
+
+	filter := storage.ListRequestsRequest{
+		ClientID:           client.ID,
+		ScopesIntersection: []string{"read", "write"},
+		GrantedScopesUnion: []string{"write"},
+	}
+	deleted, err := store.RequestManager.DeleteByFilter(ctx, storage.EntityAccessTokens, filter)
+	if err != nil {
+		t.Fatalf("delete by filter should return no errors, got: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("delete by filter should only delete requests granted the scope, got: %d, want: 1", deleted)
+	}
+
+	_, err = store.RequestManager.Get(ctx, storage.EntityAccessTokens, targeted.ID)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get deleted request should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+	_, err = store.RequestManager.Get(ctx, storage.EntityAccessTokens, kept.ID)
+	if err != nil {
+		t.Errorf("delete by filter should keep requests not granted the scope, got: %v", err)
+	}
+}
+
+func testDeleteByClientAndEntity(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+	otherClient := createClient(t, ctx, store)
+
+	accessSignature := uuid.NewString()
+	err := store.RequestManager.CreateAccessTokenSession(ctx, accessSignature, newRequester(client.ID, uuid.NewString()))
+	if err != nil {
+		t.Fatalf("create access token session should return no errors, got: %v", err)
+	}
+	refreshSignature := uuid.NewString()
+	err = store.RequestManager.CreateRefreshTokenSession(ctx, refreshSignature, newRequester(client.ID, uuid.NewString()))
+	if err != nil {
+		t.Fatalf("create refresh token session should return no errors, got: %v", err)
+	}
+	otherRefreshSignature := uuid.NewString()
+	err = store.RequestManager.CreateRefreshTokenSession(ctx, otherRefreshSignature, newRequester(otherClient.ID, uuid.NewString()))
+	if err != nil {
+		t.Fatalf("create refresh token session should return no errors, got: %v", err)
+	}
+
+	deleted, err := store.RequestManager.DeleteByClientAndEntity(ctx, client.ID, storage.EntityRefreshTokens)
+	if err != nil {
+		t.Fatalf("delete by client and entity should return no errors, got: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("delete by client and entity should return the number of requests deleted, got: %d, want: 1", deleted)
+	}
+
+	_, err = store.RequestManager.GetRefreshTokenSession(ctx, refreshSignature, &fosite.DefaultSession{})
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get deleted refresh token session should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+
+	_, err = store.RequestManager.GetAccessTokenSession(ctx, accessSignature, &fosite.DefaultSession{})
+	if err != nil {
+		t.Errorf("delete by client and entity should not delete the client's other entities, got: %v", err)
+	}
+
+	_, err = store.RequestManager.GetRefreshTokenSession(ctx, otherRefreshSignature, &fosite.DefaultSession{})
+	if err != nil {
+		t.Errorf("delete by client and entity should not delete other clients' requests, got: %v", err)
+	}
+
+	deleted, err = store.RequestManager.DeleteByClientAndEntity(ctx, "", storage.EntityRefreshTokens)
+	if err != nil || deleted != 0 {
+		t.Errorf("delete by client and entity with an empty client ID should delete nothing, got: %d, %v", deleted, err)
+	}
+}
+
+func testRevokeAllForSubject(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+	subject := uuid.NewString()
+	request := newRequester(client.ID, subject)
+
+	creates := map[string]func(ctx context.Context, signature string, request fosite.Requester) error{
+		storage.EntityAccessTokens:       store.RequestManager.CreateAccessTokenSession,
+		storage.EntityRefreshTokens:      store.RequestManager.CreateRefreshTokenSession,
+		storage.EntityAuthorizationCodes: store.RequestManager.CreateAuthorizeCodeSession,
+		storage.EntityOpenIDSessions:     store.RequestManager.CreateOpenIDConnectSession,
+		storage.EntityPKCESessions:       store.RequestManager.CreatePKCERequestSession,
+	}
+	for entityName, create := range creates {
+		err := create(ctx, uuid.NewString(), request)
+		if err != nil {
+			t.Fatalf("create %s session should return no errors, got: %v", entityName, err)
+		}
+	}
+
+	other := uuid.NewString()
+	err := store.RequestManager.CreateAccessTokenSession(ctx, other, newRequester(client.ID, uuid.NewString()))
+	if err != nil {
+		t.Fatalf("create access token session should return no errors, got: %v", err)
+	}
+
+	counts, err := store.RevokeAllForSubject(ctx, subject)
+	if err != nil {
+		t.Fatalf("revoke all for subject should return no errors, got: %v", err)
+	}
+
+	for entityName := range creates {
+		if counts[entityName] != 1 {
+			t.Errorf("revoke all for subject should count the deleted %s sessions, got: %d, want: 1", entityName, counts[entityName])
+		}
+
+		got, err := store.RequestManager.List(ctx, entityName, storage.ListRequestsRequest{UserID: subject})
+		if err != nil {
+			t.Fatalf("list should return no errors, got: %v", err)
+		}
+		if len(got) != 0 {
+			t.Errorf("revoke all for subject should delete the %s sessions, got: %d, want: 0", entityName, len(got))
+		}
+	}
+
+	_, err = store.RequestManager.GetAccessTokenSession(ctx, other, &fosite.DefaultSession{})
+	if err != nil {
+		t.Errorf("revoke all for subject should keep other subjects' sessions, got: %v", err)
+	}
+}
+
+func testFindByID(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+	request := newRequester(client.ID, uuid.NewString())
+
+	err := store.RequestManager.CreateRefreshTokenSession(ctx, uuid.NewString(), request)
+	if err != nil {
+		t.Fatalf("create refresh token session should return no errors, got: %v", err)
+	}
+
+	got, entityName, err := store.RequestManager.FindByID(ctx, request.GetID())
+	if err != nil {
+		t.Fatalf("find by id should return no errors, got: %v", err)
+	}
+	if got.ID != request.GetID() {
+		t.Errorf("find by id should return the request, got: %s, want: %s", got.ID, request.GetID())
+	}
+	if entityName != storage.EntityRefreshTokens {
+		t.Errorf("find by id should return the entity the request was found in, got: %s, want: %s", entityName, storage.EntityRefreshTokens)
+	}
+
+	_, _, err = store.RequestManager.FindByID(ctx, uuid.NewString())
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("find by id should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+}
+
+func testDeleteBySignatureReturning(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+	request := newRequester(client.ID, uuid.NewString())
+	signature := uuid.NewString()
+
+	err := store.RequestManager.CreateRefreshTokenSession(ctx, signature, request)
+	if err != nil {
+		t.Fatalf("create refresh token session should return no errors, got: %v", err)
+	}
+
+	got, err := store.RequestManager.DeleteBySignatureReturning(ctx, storage.EntityRefreshTokens, signature)
+	if err != nil {
+		t.Fatalf("delete by signature returning should return no errors, got: %v", err)
+	}
+	if got.ID != request.GetID() || got.Signature != signature || got.ClientID != client.ID {
+		t.Errorf("delete by signature returning should return the deleted request, got: %+v", got)
+	}
+
+	_, err = store.RequestManager.GetRefreshTokenSession(ctx, signature, &fosite.DefaultSession{})
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get refresh token session after delete should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+
+	_, err = store.RequestManager.DeleteBySignatureReturning(ctx, storage.EntityRefreshTokens, signature)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("delete by signature returning should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+}
+
+func testListExpiringBefore(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+	now := time.Now().UTC().Round(time.Second)
+	before := now.Add(5 * time.Minute)
+
+	var expected []string
+	for _, expiresIn := range []time.Duration{4 * time.Minute, time.Minute, 5 * time.Minute, 10 * time.Minute} {
+		request := newRequester(client.ID, uuid.NewString())
+		request.Session.SetExpiresAt(fosite.AccessToken, now.Add(expiresIn))
+		signature := uuid.NewString()
+		err := store.RequestManager.CreateAccessTokenSession(ctx, signature, request)
+		if err != nil {
+			t.Fatalf("create access token session should return no errors, got: %v", err)
+		}
+		if expiresIn < 5*time.Minute {
+			expected = append([]string{request.GetID()}, expected...)
+		}
+	}
+
+	filter := storage.ListRequestsRequest{ClientID: client.ID}
+	got, err := store.RequestManager.ListExpiringBefore(ctx, storage.EntityAccessTokens, before, filter)
+	if err != nil {
+		t.Fatalf("list expiring before should return no errors, got: %v", err)
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("list expiring before should only return requests expiring within the window, got: %d, want: %d", len(got), len(expected))
+	}
+	for i := range got {
+		if got[i].ID != expected[i] {
+			t.Errorf("list expiring before should return the soonest expiring first, got: %s, want: %s", got[i].ID, expected[i])
+		}
+	}
+
+	filter.Offset = 1
+	filter.Limit = 1
+	got, err = store.RequestManager.ListExpiringBefore(ctx, storage.EntityAccessTokens, before, filter)
+	if err != nil {
+		t.Fatalf("list expiring before should return no errors, got: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != expected[1] {
+		t.Errorf("list expiring before should respect pagination, got: %+v", got)
+	}
+}
+
+func testPurgeExpiredBatched(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+	// Expiries are set well in the past, so requests created by other tests
+	// aren't purged.
+	expired := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := expired.Add(time.Hour)
+
+	for i := 0; i < 5; i++ {
+		request := newRequester(client.ID, uuid.NewString())
+		request.Session.SetExpiresAt(fosite.AccessToken, expired.Add(time.Duration(i)*time.Minute))
+		err := store.RequestManager.CreateAccessTokenSession(ctx, uuid.NewString(), request)
+		if err != nil {
+			t.Fatalf("create access token session should return no errors, got: %v", err)
+		}
+	}
+
+	active := newRequester(client.ID, uuid.NewString())
+	active.Session.SetExpiresAt(fosite.AccessToken, time.Now().Add(time.Hour))
+	activeSignature := uuid.NewString()
+	err := store.RequestManager.CreateAccessTokenSession(ctx, activeSignature, active)
+	if err != nil {
+		t.Fatalf("create access token session should return no errors, got: %v", err)
+	}
+
+	deleted, err := store.RequestManager.PurgeExpiredBatched(ctx, storage.EntityAccessTokens, before, 2)
+	if err != nil {
+		t.Fatalf("purge expired batched should return no errors, got: %v", err)
+	}
+	if deleted != 5 {
+		t.Errorf("purge expired batched should delete every expired request across batches, got: %d, want: %d", deleted, 5)
+	}
+
+	filter := storage.ListRequestsRequest{ClientID: client.ID}
+	got, err := store.RequestManager.ListExpiringBefore(ctx, storage.EntityAccessTokens, before, filter)
+	if err != nil {
+		t.Fatalf("list expiring before should return no errors, got: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("purge expired batched should leave no expired requests, got: %d", len(got))
+	}
+
+	_, err = store.RequestManager.GetAccessTokenSession(ctx, activeSignature, &fosite.DefaultSession{})
+	if err != nil {
+		t.Errorf("purge expired batched should keep requests yet to expire, got: %v", err)
+	}
+
+	deleted, err = store.RequestManager.PurgeExpiredBatched(ctx, storage.EntityAccessTokens, before, 2)
+	if err != nil {
+		t.Fatalf("purge expired batched should return no errors, got: %v", err)
+	}
+	if deleted != 0 {
+		t.Errorf("purge expired batched should delete nothing once purged, got: %d", deleted)
+	}
+}
+
+func testActiveSessionCount(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+	subject := uuid.NewString()
+
+	var requestIDs []string
+	for i := 0; i < 3; i++ {
+		request := newRequester(client.ID, subject)
+		err := store.RequestManager.CreateRefreshTokenSession(ctx, uuid.NewString(), request)
+		if err != nil {
+			t.Fatalf("create refresh token session should return no errors, got: %v", err)
+		}
+		requestIDs = append(requestIDs, request.GetID())
+	}
+
+	// Neither expired refresh tokens, another user's sessions nor access
+	// tokens are counted.
+	expired := newRequester(client.ID, subject)
+	expired.Session.SetExpiresAt(fosite.RefreshToken, time.Now().Add(-time.Minute))
+	err := store.RequestManager.CreateRefreshTokenSession(ctx, uuid.NewString(), expired)
+	if err != nil {
+		t.Fatalf("create refresh token session should return no errors, got: %v", err)
+	}
+	err = store.RequestManager.CreateRefreshTokenSession(ctx, uuid.NewString(), newRequester(client.ID, uuid.NewString()))
+	if err != nil {
+		t.Fatalf("create refresh token session should return no errors, got: %v", err)
+	}
+	err = store.RequestManager.CreateAccessTokenSession(ctx, uuid.NewString(), newRequester(client.ID, subject))
+	if err != nil {
+		t.Fatalf("create access token session should return no errors, got: %v", err)
+	}
+
+	inactive, err := store.RequestManager.Get(ctx, storage.EntityRefreshTokens, requestIDs[0])
+	if err != nil {
+		t.Fatalf("get should return no errors, got: %v", err)
+	}
+	inactive.Active = false
+	_, err = store.RequestManager.Update(ctx, storage.EntityRefreshTokens, inactive.ID, inactive)
+	if err != nil {
+		t.Fatalf("update should return no errors, got: %v", err)
+	}
+
+	count, err := store.RequestManager.ActiveSessionCount(ctx, subject)
+	if err != nil {
+		t.Fatalf("active session count should return no errors, got: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("active session count should only count the user's live refresh tokens, got: %d, want: %d", count, 2)
+	}
+
+	count, err = store.RequestManager.ActiveSessionCount(ctx, uuid.NewString())
+	if err != nil || count != 0 {
+		t.Errorf("active session count should return zero for users without sessions, got: %d, %v", count, err)
+	}
+}
+
+func testListByClaim(t *testing.T, ctx context.Context, store storage.Store) {
+	client := createClient(t, ctx, store)
+	org := uuid.NewString()
+
+	var expected []string
+	for _, claims := range []map[string]interface{}{
+		{"org": org},
+		{"org": org, "team": "platform"},
+		{"org": uuid.NewString()},
+		nil,
+	} {
+		request := storage.NewRequestFromRequester(uuid.NewString(), newRequester(client.ID, uuid.NewString()), fosite.AccessToken)
+		request.Claims = claims
+		request, err := store.RequestManager.Create(ctx, storage.EntityAccessTokens, request)
+		if err != nil {
+			t.Fatalf("create should return no errors, got: %v", err)
+		}
+		if claims["org"] == org {
+			expected = append(expected, request.ID)
+		}
+	}
+
+	got, err := store.RequestManager.ListByClaim(ctx, storage.EntityAccessTokens, "org", org)
+	if err != nil {
+		t.Fatalf("list by claim should return no errors, got: %v", err)
+	}
+	var ids []string
+	for _, request := range got {
+		ids = append(ids, request.ID)
+	}
+	sort.Strings(ids)
+	sort.Strings(expected)
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("list by claim should only return requests with the claim value, got: %v, want: %v", ids, expected)
+	}
+
+	got, err = store.RequestManager.ListByClaim(ctx, storage.EntityRefreshTokens, "org", org)
+	if err != nil || len(got) != 0 {
+		t.Errorf("list by claim should only search the entity, got: %d, %v", len(got), err)
+	}
+}
+
+// insertConcurrently calls insert the given number of times in the
+// background, simulating writes landing while a listing is paged. The returned
+// function waits for the inserts to complete.
+func insertConcurrently(t *testing.T, inserts int, insert func() error) (wait func()) {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < inserts; i++ {
+			if err := insert(); err != nil {
+				t.Errorf("concurrent insert should return no errors, got: %v", err)
+				return
+			}
+		}
+	}()
+
+	return wg.Wait
+}
+
+// pageAfter lists every page, providing the token returned by the previous
+// page, and returns the IDs in the order they were listed. It fails the test if
+// an ID is listed more than once or a seeded ID is never listed.
+func pageAfter(t *testing.T, seeded []string, list func(after string) (ids []string, next string, err error)) []string {
+	t.Helper()
+
+	var listed []string
+	seen := map[string]bool{}
+	after := ""
+	for {
+		ids, next, err := list(after)
+		if err != nil {
+			t.Fatalf("list should return no errors, got: %v", err)
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		for _, id := range ids {
+			if seen[id] {
+				t.Errorf("paging should not list duplicates, got: %s more than once", id)
+			}
+			seen[id] = true
+		}
+		listed = append(listed, ids...)
+		after = next
+	}
+
+	for _, id := range seeded {
+		if !seen[id] {
+			t.Errorf("paging should list every seeded record, missing: %s", id)
+		}
+	}
+
+	return listed
+}
+
+func testRequestListAfter(t *testing.T, ctx context.Context, store storage.Store) {
+	clientID := uuid.NewString()
+	requestedAt := time.Now().UTC().Round(time.Second).Add(-time.Hour)
+	newRequest := func(requestedAt time.Time) storage.Request {
+		request := storage.NewRequest()
+		request.ClientID = clientID
+		request.Signature = uuid.NewString()
+		request.RequestedAt = requestedAt
+		return request
+	}
+
+	// Pairs of requests share a requested at time, so are ordered by ID.
+	var seeded []string
+	for i := 0; i < 7; i++ {
+		request := newRequest(requestedAt.Add(time.Duration(i/2) * time.Second))
+		request.ID = clientID + "-" + strconv.Itoa(i)
+		request, err := store.RequestManager.Create(ctx, storage.EntityAccessTokens, request)
+		if err != nil {
+			t.Fatalf("create should return no errors, got: %v", err)
+		}
+		seeded = append(seeded, request.ID)
+	}
+
+	wait := insertConcurrently(t, 20, func() error {
+		_, err := store.RequestManager.Create(ctx, storage.EntityAccessTokens, newRequest(time.Now().UTC().Round(time.Millisecond)))
+		return err
+	})
+	listed := pageAfter(t, seeded, func(after string) (ids []string, next string, err error) {
+		filter := storage.ListRequestsRequest{ClientID: clientID, After: after, Limit: 2}
+		requests, err := store.RequestManager.List(ctx, storage.EntityAccessTokens, filter)
+		for _, request := range requests {
+			ids = append(ids, request.ID)
+			next = request.NextAfter()
+		}
+		return ids, next, err
+	})
+	wait()
+
+	if len(listed) < len(seeded) {
+		t.Fatalf("paging should list every seeded request, got: %d, want at least: %d", len(listed), len(seeded))
+	}
+	for i := range seeded {
+		if listed[i] != seeded[i] {
+			t.Errorf("paging should list requests in order, got: %v, want: %v", listed[:len(seeded)], seeded)
+			break
+		}
+	}
+
+	_, err := store.RequestManager.List(ctx, storage.EntityAccessTokens, storage.ListRequestsRequest{After: "not a cursor"})
+	if !errors.Is(err, storage.ErrInvalidCursor) {
+		t.Errorf("list with a malformed cursor should return invalid cursor, got: %v, want: %v", err, storage.ErrInvalidCursor)
+	}
+}
+
+func testClientListAfter(t *testing.T, ctx context.Context, store storage.Store) {
+	contact := uuid.NewString() + "@example.com"
+	newContactClient := func() storage.Client {
+		client := newClient()
+		client.Contacts = []string{contact}
+		return client
+	}
+
+	var seeded []string
+	for i := 0; i < 5; i++ {
+		client, err := store.ClientManager.Create(ctx, newContactClient())
+		if err != nil {
+			t.Fatalf("create client should return no errors, got: %v", err)
+		}
+		seeded = append(seeded, client.ID)
+	}
+
+	wait := insertConcurrently(t, 10, func() error {
+		_, err := store.ClientManager.Create(ctx, newContactClient())
+		return err
+	})
+	pageAfter(t, seeded, func(after string) (ids []string, next string, err error) {
+		filter := storage.ListClientsRequest{Contact: contact, After: after, Limit: 2}
+		clients, err := store.ClientManager.List(ctx, filter)
+		for _, client := range clients {
+			ids = append(ids, client.ID)
+			next = client.NextAfter()
+		}
+		return ids, next, err
+	})
+	wait()
+}
+
+func testUserListAfter(t *testing.T, ctx context.Context, store storage.Store) {
+	personID := uuid.NewString()
+	newPersonUser := func() storage.User {
+		user := newUser()
+		user.PersonID = personID
+		return user
+	}
+
+	var seeded []string
+	for i := 0; i < 5; i++ {
+		user, err := store.UserManager.Create(ctx, newPersonUser())
+		if err != nil {
+			t.Fatalf("create user should return no errors, got: %v", err)
+		}
+		seeded = append(seeded, user.ID)
+	}
+
+	wait := insertConcurrently(t, 10, func() error {
+		_, err := store.UserManager.Create(ctx, newPersonUser())
+		return err
+	})
+	pageAfter(t, seeded, func(after string) (ids []string, next string, err error) {
+		filter := storage.ListUsersRequest{PersonID: personID, After: after, Limit: 2}
+		users, err := store.UserManager.List(ctx, filter)
+		for _, user := range users {
+			ids = append(ids, user.ID)
+			next = user.NextAfter()
+		}
+		return ids, next, err
+	})
+	wait()
+}
+
+func testConsent(t *testing.T, ctx context.Context, store storage.Store) {
+	userID := uuid.NewString()
+	clientID := uuid.NewString()
+
+	_, err := store.ConsentManager.GetConsent(ctx, userID, clientID)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get consent should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+
+	_, err = store.ConsentManager.SaveConsent(ctx, userID, clientID, []string{"openid"}, nil, 0)
+	if err != nil {
+		t.Fatalf("save consent should return no errors, got: %v", err)
+	}
+
+	got, err := store.ConsentManager.GetConsent(ctx, userID, clientID)
+	if err != nil {
+		t.Fatalf("get consent should return no errors, got: %v", err)
+	}
+	if len(got.Scopes) != 1 || got.Scopes[0] != "openid" {
+		t.Errorf("get consent should return the consented scopes, got: %v, want: %v", got.Scopes, []string{"openid"})
+	}
+
+	err = store.ConsentManager.RevokeConsent(ctx, userID, clientID)
+	if err != nil {
+		t.Fatalf("revoke consent should return no errors, got: %v", err)
+	}
+
+	err = store.ConsentManager.RevokeConsent(ctx, userID, clientID)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("revoking missing consent should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+}
+
+func testConsumeNonce(t *testing.T, ctx context.Context, store storage.Store) {
+	clientID := uuid.NewString()
+	nonce := uuid.NewString()
+
+	err := store.NonceManager.ConsumeNonce(ctx, clientID, nonce, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("consume nonce should return no errors, got: %v", err)
+	}
+
+	err = store.NonceManager.ConsumeNonce(ctx, clientID, nonce, time.Now().Add(time.Hour))
+	if !errors.Is(err, storage.ErrNonceReplayed) {
+		t.Errorf("consuming a nonce twice should be replayed, got: %v, want: %v", err, storage.ErrNonceReplayed)
+	}
+
+	err = store.NonceManager.ConsumeNonce(ctx, uuid.NewString(), nonce, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Errorf("consuming the nonce for another client should return no errors, got: %v", err)
+	}
+}
+
+func testIdempotentResult(t *testing.T, ctx context.Context, store storage.Store) {
+	clientID := uuid.NewString()
+	key := uuid.NewString()
+	result := []byte(`{"access_token":"foo"}`)
+
+	_, err := store.IdempotencyManager.GetIdempotentResult(ctx, clientID, key)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get missing idempotent result should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+
+	err = store.IdempotencyManager.StoreIdempotentResult(ctx, clientID, key, result, time.Hour)
+	if err != nil {
+		t.Fatalf("store idempotent result should return no errors, got: %v", err)
+	}
+
+	got, err := store.IdempotencyManager.GetIdempotentResult(ctx, clientID, key)
+	if err != nil {
+		t.Fatalf("get idempotent result should return no errors, got: %v", err)
+	}
+	if string(got) != string(result) {
+		t.Errorf("get idempotent result should replay the stored result, got: %s, want: %s", got, result)
+	}
+
+	err = store.IdempotencyManager.StoreIdempotentResult(ctx, clientID, key, []byte(`{"access_token":"bar"}`), time.Hour)
+	if !errors.Is(err, storage.ErrResourceExists) {
+		t.Errorf("storing a result twice should conflict, got: %v, want: %v", err, storage.ErrResourceExists)
+	}
+
+	otherClientID := uuid.NewString()
+	_, err = store.IdempotencyManager.GetIdempotentResult(ctx, otherClientID, key)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get another client's idempotent result should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+	err = store.IdempotencyManager.StoreIdempotentResult(ctx, otherClientID, key, []byte(`{"access_token":"bar"}`), time.Hour)
+	if err != nil {
+		t.Errorf("storing a result for another client's key should return no errors, got: %v", err)
+	}
+
+	for _, ttl := range []time.Duration{0, -time.Minute} {
+		err = store.IdempotencyManager.StoreIdempotentResult(ctx, clientID, uuid.NewString(), result, ttl)
+		if !errors.Is(err, storage.ErrInvalidTTL) {
+			t.Errorf("storing a result with a ttl of %s should be rejected, got: %v, want: %v", ttl, err, storage.ErrInvalidTTL)
+		}
+	}
+}
+
+func testDeniedJTI(t *testing.T, ctx context.Context, store storage.Store) {
+	jti := uuid.NewString()
+	deniedJTI := storage.NewDeniedJTI(jti, time.Now().Add(time.Hour))
+
+	_, err := store.DeniedJTIManager.Create(ctx, deniedJTI)
+	if err != nil {
+		t.Fatalf("create should return no errors, got: %v", err)
+	}
+
+	_, err = store.DeniedJTIManager.Create(ctx, deniedJTI)
+	if !errors.Is(err, storage.ErrResourceExists) {
+		t.Errorf("create with a duplicate jti should conflict, got: %v, want: %v", err, storage.ErrResourceExists)
+	}
+
+	got, err := store.DeniedJTIManager.Get(ctx, jti)
+	if err != nil {
+		t.Fatalf("get should return no errors, got: %v", err)
+	}
+	if got.Signature != deniedJTI.Signature {
+		t.Errorf("get should return the denied jti, got: %s, want: %s", got.Signature, deniedJTI.Signature)
+	}
+
+	err = store.DeniedJTIManager.Delete(ctx, jti)
+	if err != nil {
+		t.Fatalf("delete should return no errors, got: %v", err)
+	}
+
+	_, err = store.DeniedJTIManager.Get(ctx, jti)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("get after delete should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+}
+
+func testDeniedJTIDeleteBefore(t *testing.T, ctx context.Context, store storage.Store) {
+	jti := uuid.NewString()
+	exp := time.Now().Add(time.Hour)
+	_, err := store.DeniedJTIManager.Create(ctx, storage.NewDeniedJTI(jti, exp))
+	if err != nil {
+		t.Fatalf("create should return no errors, got: %v", err)
+	}
+
+	err = store.DeniedJTIManager.DeleteBefore(ctx, exp.Unix())
+	if err != nil && !errors.Is(err, fosite.ErrNotFound) {
+		t.Fatalf("delete before should return no errors, got: %v", err)
+	}
+	_, err = store.DeniedJTIManager.Get(ctx, jti)
+	if err != nil {
+		t.Errorf("delete before should keep jtis expiring at or after the given time, got: %v", err)
+	}
+
+	err = store.DeniedJTIManager.DeleteBefore(ctx, exp.Add(time.Hour).Unix())
+	if err != nil {
+		t.Fatalf("delete before should return no errors, got: %v", err)
+	}
+	_, err = store.DeniedJTIManager.Get(ctx, jti)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("delete before should delete jtis expiring before the given time, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+}
+
+func testSetClientAssertionJWT(t *testing.T, ctx context.Context, store storage.Store) {
+	// Clear any expired JTIs, so that setting the assertion has nothing to
+	// clean up.
+	_, err := store.DeniedJTIManager.PurgeExpired(ctx)
+	if err != nil {
+		t.Fatalf("purge expired should return no errors, got: %v", err)
+	}
+
+	jti := uuid.NewString()
+	err = store.ClientManager.SetClientAssertionJWT(ctx, jti, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("set client assertion jwt should return no errors, got: %v", err)
+	}
+
+	err = store.ClientManager.ClientAssertionJWTValid(ctx, jti)
+	if !errors.Is(err, fosite.ErrJTIKnown) {
+		t.Errorf("set client assertion jwt should deny the jti without expired jtis to clean up, got: %v, want: %v", err, fosite.ErrJTIKnown)
+	}
+}
+
+func testDeniedJTINormalized(t *testing.T, ctx context.Context, store storage.Store) {
+	exp := time.Now().Add(time.Hour).Unix()
+	deniedJTIs := []storage.DeniedJTI{
+		// Denied by the raw JTI alone.
+		{JTI: uuid.NewString(), Expiry: exp},
+		// Denied with a signature not derived from the JTI.
+		{JTI: uuid.NewString(), Signature: uuid.NewString(), Expiry: exp},
+	}
+
+	for _, deniedJTI := range deniedJTIs {
+		got, err := store.DeniedJTIManager.Create(ctx, deniedJTI)
+		if err != nil {
+			t.Fatalf("create should return no errors, got: %v", err)
+		}
+		if expected := storage.SignatureFromJTI(deniedJTI.JTI); got.Signature != expected {
+			t.Errorf("create should store the normalized signature, got: %s, want: %s", got.Signature, expected)
+		}
+
+		_, err = store.DeniedJTIManager.Get(ctx, deniedJTI.JTI)
+		if err != nil {
+			t.Errorf("get by the jti should return no errors, got: %v", err)
+		}
+
+		err = store.DeniedJTIManager.Delete(ctx, deniedJTI.JTI)
+		if err != nil {
+			t.Fatalf("delete by the jti should return no errors, got: %v", err)
+		}
+
+		_, err = store.DeniedJTIManager.Get(ctx, deniedJTI.JTI)
+		if !errors.Is(err, fosite.ErrNotFound) {
+			t.Errorf("get after delete should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+		}
+	}
+
+	batch := []storage.DeniedJTI{
+		{JTI: uuid.NewString(), Expiry: exp},
+		{JTI: uuid.NewString(), Signature: uuid.NewString(), Expiry: exp},
+	}
+	_, err := store.DeniedJTIManager.CreateMany(ctx, batch)
+	if err != nil {
+		t.Fatalf("create many should return no errors, got: %v", err)
+	}
+	for _, deniedJTI := range batch {
+		err = store.DeniedJTIManager.Delete(ctx, deniedJTI.JTI)
+		if err != nil {
+			t.Errorf("delete by a jti created in a batch should return no errors, got: %v", err)
+		}
+	}
+}
+
+func testDeniedJTIPurgeExpired(t *testing.T, ctx context.Context, store storage.Store) {
+	// Clear out expired JTIs left by other tests.
+	_, err := store.DeniedJTIManager.PurgeExpired(ctx)
+	if err != nil {
+		t.Fatalf("purge expired should return no errors, got: %v", err)
+	}
+	before, err := store.DeniedJTIManager.CountActive(ctx)
+	if err != nil {
+		t.Fatalf("count active should return no errors, got: %v", err)
+	}
+
+	expired := []storage.DeniedJTI{
+		storage.NewDeniedJTI(uuid.NewString(), time.Now().Add(-time.Hour)),
+		storage.NewDeniedJTI(uuid.NewString(), time.Now().Add(-time.Minute)),
+	}
+	active := storage.NewDeniedJTI(uuid.NewString(), time.Now().Add(time.Hour))
+	_, err = store.DeniedJTIManager.CreateMany(ctx, append(expired, active))
+	if err != nil {
+		t.Fatalf("create many should return no errors, got: %v", err)
+	}
+
+	count, err := store.DeniedJTIManager.CountActive(ctx)
+	if err != nil {
+		t.Fatalf("count active should return no errors, got: %v", err)
+	}
+	if count != before+1 {
+		t.Errorf("count active should only count unexpired jtis, got: %d, want: %d", count, before+1)
+	}
+
+	deleted, err := store.DeniedJTIManager.PurgeExpired(ctx)
+	if err != nil {
+		t.Fatalf("purge expired should return no errors, got: %v", err)
+	}
+	if deleted != int64(len(expired)) {
+		t.Errorf("purge expired should return the number of expired jtis, got: %d, want: %d", deleted, len(expired))
+	}
+	for _, deniedJTI := range expired {
+		_, err = store.DeniedJTIManager.Get(ctx, deniedJTI.JTI)
+		if !errors.Is(err, fosite.ErrNotFound) {
+			t.Errorf("get after purge expired should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+		}
+	}
+	_, err = store.DeniedJTIManager.Get(ctx, active.JTI)
+	if err != nil {
+		t.Errorf("purge expired should keep active jtis, got: %v", err)
+	}
+
+	deleted, err = store.DeniedJTIManager.PurgeExpired(ctx)
+	if err != nil || deleted != 0 {
+		t.Errorf("purge expired with nothing to purge should return zero, got: %d, %v", deleted, err)
+	}
+}
+
+func testDeniedJTIBatch(t *testing.T, ctx context.Context, store storage.Store) {
+	exp := time.Now().Add(time.Hour)
+	existing := storage.NewDeniedJTI(uuid.NewString(), exp)
+	_, err := store.DeniedJTIManager.Create(ctx, existing)
+	if err != nil {
+		t.Fatalf("create should return no errors, got: %v", err)
+	}
+
+	batch := []storage.DeniedJTI{
+		storage.NewDeniedJTI(uuid.NewString(), exp),
+		existing,
+		storage.NewDeniedJTI(uuid.NewString(), exp),
+	}
+	inserted, err := store.DeniedJTIManager.CreateMany(ctx, batch)
+	if err != nil {
+		t.Fatalf("create many should tolerate already denied jtis, got: %v", err)
+	}
+	if inserted != 2 {
+		t.Errorf("create many should return the number of newly denied jtis, got: %d, want: %d", inserted, 2)
+	}
+
+	jtis := make([]string, len(batch))
+	for i := range batch {
+		jtis[i] = batch[i].JTI
+	}
+
+	err = store.DeniedJTIManager.DeleteMany(ctx, jtis)
+	if err != nil {
+		t.Fatalf("delete many should return no errors, got: %v", err)
+	}
+
+	for _, jti := range jtis {
+		_, err = store.DeniedJTIManager.Get(ctx, jti)
+		if !errors.Is(err, fosite.ErrNotFound) {
+			t.Errorf("get after delete many should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+		}
+	}
+
+	err = store.DeniedJTIManager.DeleteMany(ctx, jtis)
+	if !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("delete many with nothing to delete should return not found, got: %v, want: %v", err, fosite.ErrNotFound)
+	}
+}
@@ -4,7 +4,10 @@ import (
 	// Standard Library Imports
 	"context"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
+	"unicode"
 
 	// External Imports
 	"github.com/ory/fosite"
@@ -27,6 +30,12 @@ type User struct {
 	// the epoch.
 	UpdateTime int64 `bson:"updated_at" json:"updateTime" xml:"updateTime"`
 
+	// SourceUpdatedAt is the version of the record in the datastore the user
+	// was migrated from, such as the time it was last modified there.
+	// If set, Migrate only overwrites a stored user migrated from an older
+	// version, so migrations can be safely re-run.
+	SourceUpdatedAt int64 `bson:"source_updated_at,omitempty" json:"sourceUpdatedAt,omitempty" xml:"sourceUpdatedAt,omitempty"`
+
 	// AllowedTenantAccess contains the Tenant IDs that the user has been given
 	// rights to access.
 	// This helps in multi-tenanted situations where a user can be given
@@ -56,6 +65,16 @@ type User struct {
 	// Disabled specifies whether the user has been disallowed from signing in
 	Disabled bool `bson:"disabled" json:"disabled" xml:"disabled"`
 
+	// Account Lockout
+	// FailedLoginCount is the number of consecutive failed attempts to
+	// authenticate as the user. Stores count failed attempts, and lock the
+	// user out, once configured with a maximum number of failed logins.
+	FailedLoginCount int `bson:"failed_login_count" json:"failedLoginCount" xml:"failedLoginCount"`
+
+	// LockedUntil is when the user's lockout ends in seconds from the epoch.
+	// The user can't authenticate while locked out, see IsLocked.
+	LockedUntil int64 `bson:"locked_until,omitempty" json:"lockedUntil,omitempty" xml:"lockedUntil,omitempty"`
+
 	// User Content
 	// Username is used to authenticate a user
 	Username string `bson:"username" json:"username" xml:"username"`
@@ -74,6 +93,42 @@ type User struct {
 
 	// ProfileURI is a pointer to where their profile picture lives
 	ProfileURI string `bson:"profile_uri" json:"profileUri,omitempty" xml:"profileUri,omitempty"`
+
+	// Email stores the user's email address, which, along with their
+	// username, can be used to look up the user at login.
+	Email string `bson:"email,omitempty" json:"email,omitempty" xml:"email,omitempty"`
+
+	// Email Verification
+	// EmailVerified specifies whether the user has proven ownership of their
+	// email address (username), backing the OpenID Connect `email_verified`
+	// claim.
+	EmailVerified bool `bson:"email_verified" json:"emailVerified" xml:"emailVerified"`
+
+	// EmailVerificationToken is the single-use token sent to the user in order
+	// to verify their email address.
+	EmailVerificationToken string `bson:"email_verification_token,omitempty" json:"-" xml:"-"`
+
+	// EmailVerificationExpiry is when the email verification token expires in
+	// seconds from the epoch.
+	EmailVerificationExpiry int64 `bson:"email_verification_expiry,omitempty" json:"-" xml:"-"`
+
+	// Multi-Factor Authentication
+	// MFAEnabled specifies whether the user has enrolled in TOTP based
+	// multi-factor authentication.
+	MFAEnabled bool `bson:"mfa_enabled" json:"mfaEnabled" xml:"mfaEnabled"`
+
+	// TOTPSecret is the shared secret used to generate the user's time-based
+	// one-time passwords.
+	// The secret is not returned when reading users and is never marshaled to
+	// json/xml. Use client-side field level encryption on `totp_secret` if the
+	// secret should be encrypted at rest.
+	TOTPSecret string `bson:"totp_secret,omitempty" json:"-" xml:"-"`
+
+	// RecoveryCodes contains hashes of the user's single-use recovery codes,
+	// based on your fosite selected hasher.
+	// The codes are not returned when reading users and are never marshaled
+	// to json/xml.
+	RecoveryCodes []string `bson:"recovery_codes,omitempty" json:"-" xml:"-"`
 }
 
 // FullName concatenates the User's First Name and Last Name for templating
@@ -144,6 +199,46 @@ func (u *User) DisableRoles(roles ...string) {
 	u.Roles = utils.RemoveFromStringSet(u.Roles, roles...)
 }
 
+// EffectiveScopes returns the union of the user's scopes and the scopes
+// implied by the user's roles, as mapped by roleScopes, for layering role
+// based access control on top of scopes.
+func (u User) EffectiveScopes(roleScopes map[string][]string) []string {
+	scopes := utils.AppendToStringSet([]string{}, u.Scopes...)
+	for _, role := range u.Roles {
+		scopes = utils.AppendToStringSet(scopes, roleScopes[role]...)
+	}
+
+	return scopes
+}
+
+// SearchTerms returns the terms the user is found by when searching, see
+// ListUsersRequest.Search, being the user's username, first name and last
+// name, and each of the words within them, lowercased. For example, a user
+// named "j.doe@example.com" is found by searching for "j.d", "doe" or
+// "example".
+func (u User) SearchTerms() []string {
+	var terms []string
+	for _, field := range []string{u.Username, u.FirstName, u.LastName} {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field == "" {
+			continue
+		}
+
+		terms = append(terms, field)
+		terms = append(terms, strings.FieldsFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})...)
+	}
+
+	slices.Sort(terms)
+	return slices.Compact(terms)
+}
+
+// IsLocked returns whether the user is locked out at the given time.
+func (u User) IsLocked(now time.Time) bool {
+	return u.LockedUntil > now.Unix()
+}
+
 // Equal enables checking equality as having a byte array in a struct stops
 // allowing direct equality checks.
 func (u User) Equal(x User) bool {
@@ -159,6 +254,10 @@ func (u User) Equal(x User) bool {
 		return false
 	}
 
+	if u.SourceUpdatedAt != x.SourceUpdatedAt {
+		return false
+	}
+
 	if !stringArrayEquals(u.AllowedTenantAccess, x.AllowedTenantAccess) {
 		return false
 	}
@@ -183,6 +282,14 @@ func (u User) Equal(x User) bool {
 		return false
 	}
 
+	if u.FailedLoginCount != x.FailedLoginCount {
+		return false
+	}
+
+	if u.LockedUntil != x.LockedUntil {
+		return false
+	}
+
 	if u.Username != x.Username {
 		return false
 	}
@@ -203,6 +310,34 @@ func (u User) Equal(x User) bool {
 		return false
 	}
 
+	if u.Email != x.Email {
+		return false
+	}
+
+	if u.EmailVerified != x.EmailVerified {
+		return false
+	}
+
+	if u.EmailVerificationToken != x.EmailVerificationToken {
+		return false
+	}
+
+	if u.EmailVerificationExpiry != x.EmailVerificationExpiry {
+		return false
+	}
+
+	if u.MFAEnabled != x.MFAEnabled {
+		return false
+	}
+
+	if u.TOTPSecret != x.TOTPSecret {
+		return false
+	}
+
+	if !stringArrayEquals(u.RecoveryCodes, x.RecoveryCodes) {
+		return false
+	}
+
 	return true
 }
 
@@ -9,19 +9,64 @@ type UserManager interface {
 	AuthUserMigrator
 }
 
+// includeDisabledKey is the context key marking that disabled users should be
+// returned by lookups.
+type includeDisabledKey struct{}
+
+// WithIncludeDisabled returns a context which instructs Get and GetByUsername
+// to return disabled users. By default, disabled users are excluded from
+// lookups so they can't be authenticated. Administrative tooling, such as
+// re-enabling or impersonating a user, can opt in to seeing them.
+func WithIncludeDisabled(ctx context.Context) context.Context {
+	return context.WithValue(ctx, includeDisabledKey{}, true)
+}
+
+// IncludeDisabled reports whether the context instructs user lookups to
+// return disabled users.
+func IncludeDisabled(ctx context.Context) bool {
+	include, _ := ctx.Value(includeDisabledKey{}).(bool)
+	return include
+}
+
 // UserStorer provides a definition of specific methods that are required to store a User in a data store.
 type UserStorer interface {
 	List(ctx context.Context, filter ListUsersRequest) ([]User, error)
 	Create(ctx context.Context, user User) (User, error)
 	Get(ctx context.Context, userID string) (User, error)
 	GetByUsername(ctx context.Context, username string) (User, error)
+	// GetByLogin returns the user whose username or email matches the login,
+	// for login forms accepting either in one field. Returns
+	// ErrMultipleResults if the login matches different users.
+	GetByLogin(ctx context.Context, login string) (User, error)
+	GetByPersonID(ctx context.Context, personID string) (User, error)
+	UsernameExists(ctx context.Context, username string) (bool, error)
 	Update(ctx context.Context, userID string, user User) (User, error)
+	UpdatePassword(ctx context.Context, userID string, password string) error
 	Delete(ctx context.Context, userID string) error
 	Authenticate(ctx context.Context, username string, password string) (User, error)
 	AuthenticateByID(ctx context.Context, userID string, password string) (User, error)
 	AuthenticateByUsername(ctx context.Context, username string, password string) (User, error)
 	GrantScopes(ctx context.Context, userID string, scopes []string) (User, error)
+	// EffectiveScopes returns the union of the user's scopes and the scopes
+	// implied by the user's roles, as mapped by the store's configured role
+	// scopes.
+	EffectiveScopes(ctx context.Context, userID string) ([]string, error)
+	// GrantScopesToMany grants the scopes to each of the specified users,
+	// ignoring any that don't exist, for onboarding a cohort to a new API.
+	GrantScopesToMany(ctx context.Context, userIDs []string, scopes []string) error
 	RemoveScopes(ctx context.Context, userID string, scopes []string) (User, error)
+	RemoveAllScopes(ctx context.Context, userID string) (User, error)
+	Disable(ctx context.Context, userID string) (User, error)
+	Enable(ctx context.Context, userID string) (User, error)
+	// ResetFailedLogins clears the user's failed logins and lockout, for
+	// when an administrator has verified the user's identity out of band.
+	ResetFailedLogins(ctx context.Context, userID string) (User, error)
+	SetEmailVerified(ctx context.Context, userID string, verified bool) (User, error)
+	VerifyEmailToken(ctx context.Context, token string) (User, error)
+	EnrollTOTP(ctx context.Context, userID string, secret string, recoveryCodes []string) (User, error)
+	GetTOTPSecret(ctx context.Context, userID string) (string, error)
+	DisableMFA(ctx context.Context, userID string) (User, error)
+	ConsumeRecoveryCode(ctx context.Context, userID string, code string) error
 }
 
 // ListUsersRequest enables filtering stored User entities.
@@ -42,10 +87,25 @@ type ListUsersRequest struct {
 	// ScopesIntersection filters users that have all the listed scopes.
 	// ScopesIntersection performs an AND operation.
 	ScopesIntersection []string `json:"scopes_intersection" xml:"scopes_intersection"`
+	// ScopePrefix filters users that have at least one scope beginning with
+	// the prefix, for hierarchical scopes, for example, given "photos" the
+	// user must have a scope such as "photos" or "photos.read".
+	// ScopePrefix applies in addition to ScopesIntersection or ScopesUnion.
+	ScopePrefix string `json:"scope_prefix" xml:"scope_prefix"`
 	// FirstName filters users based on their First Name.
 	FirstName string `json:"first_name" xml:"first_name"`
 	// LastName filters users based on their Last Name.
 	LastName string `json:"last_name" xml:"last_name"`
 	// Disabled filters users to those with disabled accounts.
 	Disabled bool `json:"disabled" xml:"disabled"`
+	// Search filters users to those with a username, first name or last
+	// name, or a word within them, starting with the search term, ignoring
+	// case, see User.SearchTerms.
+	Search string `json:"search" xml:"search"`
+	// After lists the users following the token returned by the last user's
+	// NextAfter, ordered by ID, enabling stable paging.
+	After string `json:"after" xml:"after"`
+	// Limit caps the number of users returned. If zero, every matching user
+	// is returned.
+	Limit int64 `json:"limit" xml:"limit"`
 }
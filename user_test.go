@@ -2,7 +2,9 @@ package storage
 
 import (
 	// Standard Library Imports
+	"reflect"
 	"testing"
+	"time"
 
 	// External Imports
 	"github.com/stretchr/testify/assert"
@@ -95,6 +97,81 @@ func TestUser_FullName(t *testing.T) {
 	}
 }
 
+func TestUser_EffectiveScopes(t *testing.T) {
+	roleScopes := map[string][]string{
+		"admin":  {"users:read", "users:write"},
+		"viewer": {"users:read"},
+	}
+
+	tests := []struct {
+		name       string
+		scopes     []string
+		roles      []string
+		wantScopes []string
+	}{
+		{
+			name:       "Should return no scopes",
+			wantScopes: []string{},
+		},
+		{
+			name:       "Should return the user's scopes",
+			scopes:     []string{"openid"},
+			wantScopes: []string{"openid"},
+		},
+		{
+			name:       "Should include role-derived scopes",
+			scopes:     []string{"openid"},
+			roles:      []string{"admin"},
+			wantScopes: []string{"openid", "users:read", "users:write"},
+		},
+		{
+			name:       "Should not duplicate scopes implied by several roles",
+			scopes:     []string{"users:read"},
+			roles:      []string{"viewer", "admin"},
+			wantScopes: []string{"users:read", "users:write"},
+		},
+		{
+			name:       "Should ignore unmapped roles",
+			scopes:     []string{"openid"},
+			roles:      []string{"unknown"},
+			wantScopes: []string{"openid"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := User{
+				Scopes: tt.scopes,
+				Roles:  tt.roles,
+			}
+			if gotScopes := u.EffectiveScopes(roleScopes); !reflect.DeepEqual(gotScopes, tt.wantScopes) {
+				t.Errorf(
+					"EffectiveScopes()\ngot:  %#+v\nwant: %#+v",
+					gotScopes,
+					tt.wantScopes,
+				)
+			}
+		})
+	}
+}
+
+func TestUser_SearchTerms(t *testing.T) {
+	user := User{
+		Username:  "J.Doe@Example.com",
+		FirstName: "John",
+		LastName:  "van Doe",
+	}
+
+	expected := []string{"com", "doe", "example", "j", "j.doe@example.com", "john", "van", "van doe"}
+	if got := user.SearchTerms(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("search terms should include each lowercased field and word, expected: %v, got: %v", expected, got)
+	}
+
+	if got := (User{}).SearchTerms(); len(got) != 0 {
+		t.Errorf("a user without names should have no search terms, got: %v", got)
+	}
+}
+
 func TestUser_EnableScopeAccess_None(t *testing.T) {
 	u := expectedUser()
 
@@ -871,6 +948,68 @@ func TestUser_Equal(t *testing.T) {
 			},
 			expected: false,
 		},
+		{
+			description: "email verified should not be equal",
+			x: User{
+				EmailVerified: false,
+			},
+			y: User{
+				EmailVerified: true,
+			},
+			expected: false,
+		},
+		{
+			description: "email verification token should not be equal",
+			x: User{
+				EmailVerificationToken:  "token-1",
+				EmailVerificationExpiry: 123,
+			},
+			y: User{
+				EmailVerificationToken:  "token-2",
+				EmailVerificationExpiry: 123,
+			},
+			expected: false,
+		},
+		{
+			description: "email verification expiry should not be equal",
+			x: User{
+				EmailVerificationExpiry: 123,
+			},
+			y: User{
+				EmailVerificationExpiry: 321,
+			},
+			expected: false,
+		},
+		{
+			description: "mfa enabled should not be equal",
+			x: User{
+				MFAEnabled: false,
+			},
+			y: User{
+				MFAEnabled: true,
+			},
+			expected: false,
+		},
+		{
+			description: "totp secret should not be equal",
+			x: User{
+				TOTPSecret: "JBSWY3DPEHPK3PXP",
+			},
+			y: User{
+				TOTPSecret: "KRSXG5CTMVRXEZLU",
+			},
+			expected: false,
+		},
+		{
+			description: "recovery codes should not be equal",
+			x: User{
+				RecoveryCodes: []string{"a"},
+			},
+			y: User{
+				RecoveryCodes: []string{"b"},
+			},
+			expected: false,
+		},
 		{
 			description: "disabled should be equal",
 			x: User{
@@ -987,3 +1126,19 @@ func BenchmarkUser_Equal(b *testing.B) {
 		user.Equal(user)
 	}
 }
+
+func TestUser_IsLocked(t *testing.T) {
+	now := time.Now()
+	u := User{}
+	if u.IsLocked(now) {
+		t.Error("users should not be locked by default")
+	}
+
+	u.LockedUntil = now.Add(time.Minute).Unix()
+	if !u.IsLocked(now) {
+		t.Error("users should be locked until the lockout ends")
+	}
+	if u.IsLocked(now.Add(time.Minute)) {
+		t.Error("users should not be locked once the lockout has ended")
+	}
+}